@@ -11,11 +11,13 @@ import (
 	"nofx/backtest"
 	"nofx/config"
 	"nofx/decision"
+	"nofx/internal/metrics"
 	"nofx/logger"
 	"nofx/manager"
 	"nofx/market"
 	"nofx/mcp"
 	"nofx/review"
+	"nofx/trader"
 	"strconv"
 	"strings"
 	"sync"
@@ -34,6 +36,8 @@ type Server struct {
 	// SSE 流管理
 	streamChannels map[string]chan string // trader_id -> channel
 	streamMutex    sync.RWMutex
+	// 交易所凭证校验（测试中可替换为mock）
+	verifyCredentials trader.CredentialVerifier
 }
 
 // NewServer 创建API服务器
@@ -45,6 +49,7 @@ func NewServer(traderManager *manager.TraderManager, database *config.Database,
 
 	// 启用CORS
 	router.Use(corsMiddleware())
+	router.Use(metricsMiddleware())
 
 	s := &Server{
 		router:         router,
@@ -52,6 +57,8 @@ func NewServer(traderManager *manager.TraderManager, database *config.Database,
 		database:       database,
 		port:           port,
 		streamChannels: make(map[string]chan string),
+
+		verifyCredentials: trader.VerifyExchangeCredentials,
 	}
 
 	// 设置路由
@@ -76,8 +83,26 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
+// metricsMiddleware 记录API请求数与耗时（按路由模板聚合，避免路径参数导致序列膨胀）
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
 // setupRoutes 设置路由
 func (s *Server) setupRoutes() {
+	// Prometheus 指标（无需认证）
+	s.router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	// API路由组
 	api := s.router.Group("/api")
 	{
@@ -97,9 +122,9 @@ func (s *Server) setupRoutes() {
 		// 系统配置（无需认证）
 		api.GET("/config", s.handleGetSystemConfig)
 
-		// 系统提示词模板管理（无需认证）
-		api.GET("/prompt-templates", s.handleGetPromptTemplates)
-		api.GET("/prompt-templates/:name", s.handleGetPromptTemplate)
+		// 系统提示词模板管理（无需认证，登录后合并用户自定义模板）
+		api.GET("/prompt-templates", s.optionalAuthMiddleware(), s.handleGetPromptTemplates)
+		api.GET("/prompt-templates/:name", s.optionalAuthMiddleware(), s.handleGetPromptTemplate)
 
 		// 需要认证的路由
 		protected := api.Group("/", s.authMiddleware())
@@ -108,10 +133,15 @@ func (s *Server) setupRoutes() {
 			protected.GET("/traders", s.handleTraderList)
 			protected.GET("/traders/:id/config", s.handleGetTraderConfig)
 			protected.POST("/traders", s.handleCreateTrader)
+
+			// 用户自定义提示词模板
+			protected.POST("/prompt-templates", s.handleSavePromptTemplate)
+			protected.DELETE("/prompt-templates/:name", s.handleDeletePromptTemplate)
 			protected.PUT("/traders/:id", s.handleUpdateTrader)
 			protected.DELETE("/traders/:id", s.handleDeleteTrader)
 			protected.POST("/traders/:id/start", s.handleStartTrader)
 			protected.POST("/traders/:id/stop", s.handleStopTrader)
+			protected.POST("/traders/:id/paper-reset", s.handlePaperReset)
 			protected.PUT("/traders/:id/prompt", s.handleUpdateTraderPrompt)
 
 			// AI模型配置
@@ -134,13 +164,17 @@ func (s *Server) setupRoutes() {
 			protected.GET("/account", s.handleAccount)
 			protected.GET("/positions", s.handlePositions)
 			protected.GET("/pending-orders", s.handlePendingOrders)
+			protected.GET("/trade-history", s.handleTradeHistory)
+			protected.GET("/market/overview", s.handleMarketOverview)
 			protected.GET("/decisions", s.handleDecisions)
 			protected.GET("/decisions/latest", s.handleLatestDecisions)
 			protected.GET("/statistics", s.handleStatistics)
 			protected.GET("/equity-history", s.handleEquityHistory)
 			protected.GET("/performance", s.handlePerformance)
+			protected.GET("/pnl-daily", s.handleDailyPnL)
 			protected.GET("/cycle-check", s.handleCycleCheck)
 			protected.GET("/close-reviews", s.handleListCloseReviews)
+			protected.GET("/positions-history", s.handlePositionsHistory)
 			protected.GET("/trades/:trade_id/close-review", s.handleGetCloseReview)
 			protected.POST("/trades/:trade_id/close-review", s.handleCreateCloseReview)
 			protected.POST("/review-loss-trades", s.handleReviewLossTrades)
@@ -152,6 +186,8 @@ func (s *Server) setupRoutes() {
 			// 回测（基于规则引擎的离线分析，用于评估硬规则和模块化提示词的匹配度）
 			protected.POST("/backtest", s.handleBacktest)
 			protected.GET("/backtest/status", s.handleBacktestStatus)
+			protected.GET("/backtest/jobs", s.handleListBacktestJobs)
+			protected.DELETE("/backtest", s.handleCancelBacktest)
 
 			// AI 实时思考流（SSE）
 			protected.GET("/ai/stream", s.handleAIStream)
@@ -262,6 +298,41 @@ func (s *Server) handleBacktest(c *gin.Context) {
 	})
 }
 
+// handleListBacktestJobs 列出回测任务摘要（已结束的任务按保留策略定期清理）
+func (s *Server) handleListBacktestJobs(c *gin.Context) {
+	jobs := backtest.ListJobs()
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  jobs,
+		"count": len(jobs),
+	})
+}
+
+// handleCancelBacktest 取消排队中/运行中的回测任务
+func (s *Server) handleCancelBacktest(c *gin.Context) {
+	jobID := c.Query("job_id")
+	if jobID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "job_id is required"})
+		return
+	}
+
+	if err := backtest.CancelJob(jobID); err != nil {
+		switch {
+		case errors.Is(err, backtest.ErrJobNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		case errors.Is(err, backtest.ErrJobFinished):
+			c.JSON(http.StatusConflict, gin.H{"error": "job already finished"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id": jobID,
+		"status": "cancelled",
+	})
+}
+
 // handleBacktestStatus 查询回测任务进度/结果
 func (s *Server) handleBacktestStatus(c *gin.Context) {
 	jobID := c.Query("job_id")
@@ -339,12 +410,20 @@ type CreateTraderRequest struct {
 	BTCETHLeverage       int     `json:"btc_eth_leverage"`
 	AltcoinLeverage      int     `json:"altcoin_leverage"`
 	TradingSymbols       string  `json:"trading_symbols"`
+	AnalysisTimeframes   string  `json:"analysis_timeframes"` // 分析周期，逗号分隔（如 "1h,4h"），为空使用默认
+	IndicatorRules       []decision.IndicatorRule `json:"indicator_rules"` // 指标阈值规则，命中则拒绝开仓
 	CustomPrompt         string  `json:"custom_prompt"`
 	OverrideBasePrompt   bool    `json:"override_base_prompt"`
 	SystemPromptTemplate string  `json:"system_prompt_template"` // 系统提示词模板名称
 	IsCrossMargin        *bool   `json:"is_cross_margin"`        // 指针类型，nil表示使用默认值true
+	IsHedgeMode          bool    `json:"is_hedge_mode"`          // 双向持仓模式（同币种可同时持有多空），默认单向
 	UseCoinPool          bool    `json:"use_coin_pool"`
 	UseOITop             bool    `json:"use_oi_top"`
+	ScanIntervalMinutes  int     `json:"scan_interval_minutes"` // 扫描间隔（分钟），为0使用默认3分钟
+	TraderMode           string  `json:"trader_mode"`           // "binance"(实盘，默认) / "paper"(纸交易) / "shadow"(影子模式)
+	OpeningOrderType     string  `json:"opening_order_type"`    // ""(跟随全局) / "auto" / "limit_maker"
+	DailySummaryTime     string  `json:"daily_summary_time"`    // 每日汇总生成时间（本地时间 "HH:MM"），为空跟随全局
+	PromptRedaction      string  `json:"prompt_redaction"`      // 非管理员查看决策记录时的提示词脱敏: "none"(默认) / "redact" / "omit"
 }
 
 type ModelConfig struct {
@@ -376,7 +455,9 @@ type UpdateModelConfigRequest struct {
 }
 
 type UpdateExchangeConfigRequest struct {
-	Exchanges map[string]struct {
+	// SkipVerification 跳过凭证校验（离线配置时使用）
+	SkipVerification bool `json:"skip_verification"`
+	Exchanges        map[string]struct {
 		Enabled               bool   `json:"enabled"`
 		APIKey                string `json:"api_key"`
 		SecretKey             string `json:"secret_key"`
@@ -388,6 +469,118 @@ type UpdateExchangeConfigRequest struct {
 	} `json:"exchanges"`
 }
 
+// secretMaskPrefix 脱敏占位前缀，前端原样回传时表示"保持原值不变"
+const secretMaskPrefix = "****"
+
+// ModelConfigResponse AI模型配置响应（密钥已脱敏）
+type ModelConfigResponse struct {
+	config.AIModelConfig
+	HasAPIKey bool `json:"hasApiKey"`
+}
+
+// ExchangeConfigResponse 交易所配置响应（密钥已脱敏，私钥永不返回）
+type ExchangeConfigResponse struct {
+	config.ExchangeConfig
+	HasAPIKey          bool `json:"hasApiKey"`
+	HasSecretKey       bool `json:"hasSecretKey"`
+	HasAsterPrivateKey bool `json:"hasAsterPrivateKey"`
+}
+
+// maskSecret 密钥脱敏：仅保留后4位，空值返回空字符串
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		// 过短的密钥保留后4位等于泄露大半，直接全部隐藏
+		return secretMaskPrefix
+	}
+	return secretMaskPrefix + secret[len(secret)-4:]
+}
+
+// maskPrivateKey 私钥脱敏：只表示是否存在，不返回任何字符
+func maskPrivateKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	return secretMaskPrefix
+}
+
+// isMaskedSecret 判断是否为脱敏后的占位值
+func isMaskedSecret(value string) bool {
+	return strings.HasPrefix(value, secretMaskPrefix)
+}
+
+// resolveSecret 前端回传脱敏值时保留数据库中的原值
+// 没有已存在的记录时脱敏值无从还原，直接报错，避免把占位符当作密钥写入数据库
+func resolveSecret(incoming, existing string, exists bool) (string, error) {
+	if !isMaskedSecret(incoming) {
+		return incoming, nil
+	}
+	if !exists {
+		return "", fmt.Errorf("密钥为脱敏占位值且不存在已保存的配置，请填写完整密钥")
+	}
+	return existing, nil
+}
+
+// maskModelConfigs 构造脱敏后的AI模型配置列表
+func maskModelConfigs(models []*config.AIModelConfig) []ModelConfigResponse {
+	result := make([]ModelConfigResponse, 0, len(models))
+	for _, model := range models {
+		masked := ModelConfigResponse{AIModelConfig: *model, HasAPIKey: model.APIKey != ""}
+		masked.APIKey = maskSecret(model.APIKey)
+		result = append(result, masked)
+	}
+	return result
+}
+
+// maskExchangeConfigs 构造脱敏后的交易所配置列表
+func maskExchangeConfigs(exchanges []*config.ExchangeConfig) []ExchangeConfigResponse {
+	result := make([]ExchangeConfigResponse, 0, len(exchanges))
+	for _, exchange := range exchanges {
+		masked := ExchangeConfigResponse{
+			ExchangeConfig:     *exchange,
+			HasAPIKey:          exchange.APIKey != "",
+			HasSecretKey:       exchange.SecretKey != "",
+			HasAsterPrivateKey: exchange.AsterPrivateKey != "",
+		}
+		if exchange.ID == "hyperliquid" {
+			// hyperliquid用APIKey存储private key，不能返回任何字符
+			masked.APIKey = maskPrivateKey(exchange.APIKey)
+		} else {
+			masked.APIKey = maskSecret(exchange.APIKey)
+		}
+		masked.SecretKey = maskSecret(exchange.SecretKey)
+		masked.AsterPrivateKey = maskPrivateKey(exchange.AsterPrivateKey)
+		result = append(result, masked)
+	}
+	return result
+}
+
+// encodeIndicatorRules 校验指标阈值规则并序列化为数据库存储的JSON，空规则返回空字符串
+func encodeIndicatorRules(rules []decision.IndicatorRule) (string, error) {
+	if len(rules) == 0 {
+		return "", nil
+	}
+	if err := decision.ValidateIndicatorRules(rules); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return "", fmt.Errorf("序列化指标规则失败: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeIndicatorRules 解析数据库中的指标阈值规则，解析失败时返回空列表
+func decodeIndicatorRules(value string) []decision.IndicatorRule {
+	rules, err := decision.ParseIndicatorRules(value)
+	if err != nil || rules == nil {
+		return []decision.IndicatorRule{}
+	}
+	return rules
+}
+
 // handleCreateTrader 创建新的AI交易员
 func (s *Server) handleCreateTrader(c *gin.Context) {
 	userID := c.GetString("user_id")
@@ -419,6 +612,51 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 		}
 	}
 
+	// 校验分析周期
+	if _, err := market.ParseTimeframes(req.AnalysisTimeframes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 校验指标阈值规则
+	indicatorRules, err := encodeIndicatorRules(req.IndicatorRules)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 校验交易模式
+	traderMode := "binance"
+	if req.TraderMode != "" {
+		if err := validateTraderMode(req.TraderMode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		traderMode = req.TraderMode
+	}
+
+	// 校验开仓订单类型（为空跟随全局配置）
+	if err := trader.ValidateOpeningOrderType(req.OpeningOrderType); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 校验每日汇总时间（为空跟随全局配置）
+	if req.DailySummaryTime != "" {
+		if _, _, err := logger.ParseReportTime(req.DailySummaryTime); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// 校验提示词脱敏级别
+	if req.PromptRedaction != "" {
+		if err := validatePromptRedaction(req.PromptRedaction); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// 生成交易员ID
 	traderID := fmt.Sprintf("%s_%s_%d", req.ExchangeID, req.AIModelID, time.Now().Unix())
 
@@ -452,6 +690,16 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 		}
 	}
 
+	// 扫描间隔默认3分钟
+	scanIntervalMinutes := defaultScanIntervalMinutes
+	if req.ScanIntervalMinutes != 0 {
+		if err := validateScanIntervalMinutes(req.ScanIntervalMinutes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		scanIntervalMinutes = req.ScanIntervalMinutes
+	}
+
 	// 设置系统提示词模板默认值
 	systemPromptTemplate := "default"
 	if req.SystemPromptTemplate != "" {
@@ -469,18 +717,25 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 		BTCETHLeverage:       btcEthLeverage,
 		AltcoinLeverage:      altcoinLeverage,
 		TradingSymbols:       req.TradingSymbols,
+		AnalysisTimeframes:   req.AnalysisTimeframes,
+		IndicatorRules:       indicatorRules,
 		UseCoinPool:          req.UseCoinPool,
 		UseOITop:             req.UseOITop,
 		CustomPrompt:         req.CustomPrompt,
 		OverrideBasePrompt:   req.OverrideBasePrompt,
 		SystemPromptTemplate: systemPromptTemplate,
 		IsCrossMargin:        isCrossMargin,
-		ScanIntervalMinutes:  3, // 默认3分钟
+		IsHedgeMode:          req.IsHedgeMode,
+		ScanIntervalMinutes:  scanIntervalMinutes,
+		TraderMode:           traderMode,
+		OpeningOrderType:     req.OpeningOrderType,
+		DailySummaryTime:     req.DailySummaryTime,
+		PromptRedaction:      req.PromptRedaction,
 		IsRunning:            false,
 	}
 
 	// 保存到数据库
-	err := s.database.CreateTrader(trader)
+	err = s.database.CreateTrader(trader)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("创建交易员失败: %v", err)})
 		return
@@ -503,6 +758,48 @@ func (s *Server) handleCreateTrader(c *gin.Context) {
 	})
 }
 
+// 扫描间隔（分钟）的默认值与允许范围
+const (
+	defaultScanIntervalMinutes = 3
+	maxScanIntervalMinutes     = 1440
+)
+
+// validateScanIntervalMinutes 校验扫描间隔（1分钟 ~ 1天）
+func validateScanIntervalMinutes(minutes int) error {
+	if minutes < 1 || minutes > maxScanIntervalMinutes {
+		return fmt.Errorf("扫描间隔必须在1-%d分钟之间", maxScanIntervalMinutes)
+	}
+	return nil
+}
+
+// validateTraderMode 校验交易模式
+func validateTraderMode(mode string) error {
+	switch mode {
+	case "binance", "paper", "shadow":
+		return nil
+	}
+	return fmt.Errorf("无效的交易模式: %s（可选 binance/paper/shadow）", mode)
+}
+
+// 决策记录提示词脱敏级别（仅影响非管理员的API响应，决策日志中仍完整保存）
+const (
+	promptRedactionNone   = "none"   // 不脱敏
+	promptRedactionRedact = "redact" // 替换为占位符
+	promptRedactionOmit   = "omit"   // 从响应中省略
+)
+
+// redactedPromptPlaceholder 脱敏后的提示词占位符
+const redactedPromptPlaceholder = "[redacted]"
+
+// validatePromptRedaction 校验提示词脱敏级别
+func validatePromptRedaction(level string) error {
+	switch level {
+	case promptRedactionNone, promptRedactionRedact, promptRedactionOmit:
+		return nil
+	}
+	return fmt.Errorf("无效的提示词脱敏级别: %s（可选 none/redact/omit）", level)
+}
+
 // UpdateTraderRequest 更新交易员请求
 type UpdateTraderRequest struct {
 	Name               string  `json:"name" binding:"required"`
@@ -512,9 +809,17 @@ type UpdateTraderRequest struct {
 	BTCETHLeverage     int     `json:"btc_eth_leverage"`
 	AltcoinLeverage    int     `json:"altcoin_leverage"`
 	TradingSymbols     string  `json:"trading_symbols"`
+	AnalysisTimeframes *string `json:"analysis_timeframes"` // nil 保持原值
+	IndicatorRules     *[]decision.IndicatorRule `json:"indicator_rules"` // nil 保持原值，空列表清除
 	CustomPrompt       string  `json:"custom_prompt"`
 	OverrideBasePrompt bool    `json:"override_base_prompt"`
 	IsCrossMargin      *bool   `json:"is_cross_margin"`
+	IsHedgeMode        *bool   `json:"is_hedge_mode"`         // nil 保持原值
+	ScanIntervalMinutes int    `json:"scan_interval_minutes"` // 扫描间隔（分钟），为0保持原值
+	TraderMode         string  `json:"trader_mode"`           // 为空保持原值
+	OpeningOrderType   string  `json:"opening_order_type"`    // 为空保持原值
+	DailySummaryTime   string  `json:"daily_summary_time"`    // 为空保持原值
+	PromptRedaction    string  `json:"prompt_redaction"`      // 为空保持原值
 }
 
 // handleUpdateTrader 更新交易员配置
@@ -548,11 +853,35 @@ func (s *Server) handleUpdateTrader(c *gin.Context) {
 		return
 	}
 
+	// 分析周期：未指定保持原值
+	analysisTimeframes := existingTrader.AnalysisTimeframes
+	if req.AnalysisTimeframes != nil {
+		if _, err := market.ParseTimeframes(*req.AnalysisTimeframes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		analysisTimeframes = *req.AnalysisTimeframes
+	}
+
+	// 指标阈值规则：未指定保持原值，显式传空列表清除
+	indicatorRules := existingTrader.IndicatorRules
+	if req.IndicatorRules != nil {
+		indicatorRules, err = encodeIndicatorRules(*req.IndicatorRules)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// 设置默认值
 	isCrossMargin := existingTrader.IsCrossMargin // 保持原值
 	if req.IsCrossMargin != nil {
 		isCrossMargin = *req.IsCrossMargin
 	}
+	isHedgeMode := existingTrader.IsHedgeMode // 保持原值
+	if req.IsHedgeMode != nil {
+		isHedgeMode = *req.IsHedgeMode
+	}
 
 	// 设置杠杆默认值
 	btcEthLeverage := req.BTCETHLeverage
@@ -564,6 +893,56 @@ func (s *Server) handleUpdateTrader(c *gin.Context) {
 		altcoinLeverage = existingTrader.AltcoinLeverage // 保持原值
 	}
 
+	// 扫描间隔：为0保持原值
+	scanIntervalMinutes := existingTrader.ScanIntervalMinutes
+	if req.ScanIntervalMinutes != 0 {
+		if err := validateScanIntervalMinutes(req.ScanIntervalMinutes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		scanIntervalMinutes = req.ScanIntervalMinutes
+	}
+
+	// 交易模式：为空保持原值
+	traderMode := existingTrader.TraderMode
+	if req.TraderMode != "" {
+		if err := validateTraderMode(req.TraderMode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		traderMode = req.TraderMode
+	}
+
+	// 开仓订单类型：为空保持原值
+	openingOrderType := existingTrader.OpeningOrderType
+	if req.OpeningOrderType != "" {
+		if err := trader.ValidateOpeningOrderType(req.OpeningOrderType); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		openingOrderType = req.OpeningOrderType
+	}
+
+	// 每日汇总时间：为空保持原值
+	dailySummaryTime := existingTrader.DailySummaryTime
+	if req.DailySummaryTime != "" {
+		if _, _, err := logger.ParseReportTime(req.DailySummaryTime); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		dailySummaryTime = req.DailySummaryTime
+	}
+
+	// 提示词脱敏级别：为空保持原值
+	promptRedaction := existingTrader.PromptRedaction
+	if req.PromptRedaction != "" {
+		if err := validatePromptRedaction(req.PromptRedaction); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		promptRedaction = req.PromptRedaction
+	}
+
 	// 更新交易员配置
 	trader := &config.TraderRecord{
 		ID:                  traderID,
@@ -575,10 +954,17 @@ func (s *Server) handleUpdateTrader(c *gin.Context) {
 		BTCETHLeverage:      btcEthLeverage,
 		AltcoinLeverage:     altcoinLeverage,
 		TradingSymbols:      req.TradingSymbols,
+		AnalysisTimeframes:  analysisTimeframes,
+		IndicatorRules:      indicatorRules,
 		CustomPrompt:        req.CustomPrompt,
 		OverrideBasePrompt:  req.OverrideBasePrompt,
 		IsCrossMargin:       isCrossMargin,
-		ScanIntervalMinutes: existingTrader.ScanIntervalMinutes, // 保持原值
+		IsHedgeMode:         isHedgeMode,
+		ScanIntervalMinutes: scanIntervalMinutes,
+		TraderMode:          traderMode,
+		OpeningOrderType:    openingOrderType,
+		DailySummaryTime:    dailySummaryTime,
+		PromptRedaction:     promptRedaction,
 		IsRunning:           existingTrader.IsRunning,           // 保持原值
 	}
 
@@ -595,6 +981,11 @@ func (s *Server) handleUpdateTrader(c *gin.Context) {
 		log.Printf("⚠️ 重新加载用户交易员到内存失败: %v", err)
 	}
 
+	// 已加载的交易员不会被重新创建，直接更新扫描间隔（运行中立即生效）
+	if at, err := s.traderManager.GetTrader(traderID); err == nil {
+		at.SetScanInterval(time.Duration(scanIntervalMinutes) * time.Minute)
+	}
+
 	log.Printf("✓ 更新交易员成功: %s (模型: %s, 交易所: %s)", req.Name, req.AIModelID, req.ExchangeID)
 
 	c.JSON(http.StatusOK, gin.H{
@@ -625,6 +1016,7 @@ func (s *Server) handleDeleteTrader(c *gin.Context) {
 			log.Printf("⏹  已停止运行中的交易员: %s", traderID)
 		}
 	}
+	metrics.DeleteTrader(traderID)
 
 	log.Printf("✓ 交易员已删除: %s", traderID)
 	c.JSON(http.StatusOK, gin.H{"message": "交易员已删除"})
@@ -697,6 +1089,42 @@ func (s *Server) handleStopTrader(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "交易员已停止"})
 }
 
+// handlePaperReset 重置纸交易员的余额、持仓和跟踪状态
+func (s *Server) handlePaperReset(c *gin.Context) {
+	traderID := c.Param("id")
+
+	var req struct {
+		WipeDecisionLog bool `json:"wipe_decision_log"`
+	}
+	// 请求体可选
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "交易员不存在"})
+		return
+	}
+
+	// 禁止对真实交易的交易员执行重置
+	if !trader.IsPaperMode() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "仅纸交易模式的交易员支持重置"})
+		return
+	}
+
+	if err := trader.ResetPaperState(req.WipeDecisionLog); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("🔄 纸交易员 %s 已重置", trader.GetName())
+	c.JSON(http.StatusOK, gin.H{"message": "纸交易员已重置"})
+}
+
 // handleUpdateTraderPrompt 更新交易员自定义Prompt
 func (s *Server) handleUpdateTraderPrompt(c *gin.Context) {
 	traderID := c.Param("id")
@@ -742,7 +1170,7 @@ func (s *Server) handleGetModelConfigs(c *gin.Context) {
 	}
 	log.Printf("✅ 找到 %d 个AI模型配置", len(models))
 
-	c.JSON(http.StatusOK, models)
+	c.JSON(http.StatusOK, maskModelConfigs(models))
 }
 
 // handleUpdateModelConfigs 更新AI模型配置
@@ -754,9 +1182,26 @@ func (s *Server) handleUpdateModelConfigs(c *gin.Context) {
 		return
 	}
 
+	// 读取现有配置，用于还原前端回传的脱敏密钥
+	existingModels, err := s.database.GetAIModels(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取AI模型配置失败: %v", err)})
+		return
+	}
+	existingKeys := make(map[string]string, len(existingModels))
+	for _, model := range existingModels {
+		existingKeys[model.ID] = model.APIKey
+	}
+
 	// 更新每个模型的配置
 	for modelID, modelData := range req.Models {
-		err := s.database.UpdateAIModel(userID, modelID, modelData.Enabled, modelData.APIKey, modelData.CustomAPIURL, modelData.CustomModelName)
+		existingKey, exists := existingKeys[modelID]
+		apiKey, err := resolveSecret(modelData.APIKey, existingKey, exists)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("模型 %s: %v", modelID, err)})
+			return
+		}
+		err = s.database.UpdateAIModel(userID, modelID, modelData.Enabled, apiKey, modelData.CustomAPIURL, modelData.CustomModelName)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("更新模型 %s 失败: %v", modelID, err)})
 			return
@@ -764,13 +1209,13 @@ func (s *Server) handleUpdateModelConfigs(c *gin.Context) {
 	}
 
 	// 重新加载该用户的所有交易员，使新配置立即生效
-	err := s.traderManager.LoadUserTraders(s.database, userID)
+	err = s.traderManager.LoadUserTraders(s.database, userID)
 	if err != nil {
 		log.Printf("⚠️ 重新加载用户交易员到内存失败: %v", err)
 		// 这里不返回错误，因为模型配置已经成功更新到数据库
 	}
 
-	log.Printf("✓ AI模型配置已更新: %+v", req.Models)
+	log.Printf("✓ AI模型配置已更新: %d 个", len(req.Models))
 	c.JSON(http.StatusOK, gin.H{"message": "模型配置已更新"})
 }
 
@@ -786,7 +1231,7 @@ func (s *Server) handleGetExchangeConfigs(c *gin.Context) {
 	}
 	log.Printf("✅ 找到 %d 个交易所配置", len(exchanges))
 
-	c.JSON(http.StatusOK, exchanges)
+	c.JSON(http.StatusOK, maskExchangeConfigs(exchanges))
 }
 
 // handleUpdateExchangeConfigs 更新交易所配置
@@ -798,23 +1243,78 @@ func (s *Server) handleUpdateExchangeConfigs(c *gin.Context) {
 		return
 	}
 
+	skipVerification := req.SkipVerification || c.Query("skip_verify") == "true"
+	warnings := make(map[string]string)
+
+	// 读取现有配置，用于还原前端回传的脱敏密钥
+	existingExchanges, err := s.database.GetExchanges(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取交易所配置失败: %v", err)})
+		return
+	}
+	existingByID := make(map[string]*config.ExchangeConfig, len(existingExchanges))
+	for _, exchange := range existingExchanges {
+		existingByID[exchange.ID] = exchange
+	}
+
 	// 更新每个交易所的配置
 	for exchangeID, exchangeData := range req.Exchanges {
-		err := s.database.UpdateExchange(userID, exchangeID, exchangeData.Enabled, exchangeData.APIKey, exchangeData.SecretKey, exchangeData.Testnet, exchangeData.HyperliquidWalletAddr, exchangeData.AsterUser, exchangeData.AsterSigner, exchangeData.AsterPrivateKey)
+		existing, exists := existingByID[exchangeID]
+		if !exists {
+			existing = &config.ExchangeConfig{}
+		}
+		apiKey, err := resolveSecret(exchangeData.APIKey, existing.APIKey, exists)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("交易所 %s: %v", exchangeID, err)})
+			return
+		}
+		secretKey, err := resolveSecret(exchangeData.SecretKey, existing.SecretKey, exists)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("交易所 %s: %v", exchangeID, err)})
+			return
+		}
+		asterPrivateKey, err := resolveSecret(exchangeData.AsterPrivateKey, existing.AsterPrivateKey, exists)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("交易所 %s: %v", exchangeID, err)})
+			return
+		}
+		err = s.database.UpdateExchange(userID, exchangeID, exchangeData.Enabled, apiKey, secretKey, exchangeData.Testnet, exchangeData.HyperliquidWalletAddr, exchangeData.AsterUser, exchangeData.AsterSigner, asterPrivateKey)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("更新交易所 %s 失败: %v", exchangeID, err)})
 			return
 		}
+
+		// 校验已启用交易所的凭证，失败只返回警告，不阻止保存
+		if !exchangeData.Enabled || skipVerification || s.verifyCredentials == nil {
+			continue
+		}
+		creds := trader.ExchangeCredentials{
+			APIKey:                apiKey,
+			SecretKey:             secretKey,
+			Testnet:               exchangeData.Testnet,
+			HyperliquidWalletAddr: exchangeData.HyperliquidWalletAddr,
+			AsterUser:             exchangeData.AsterUser,
+			AsterSigner:           exchangeData.AsterSigner,
+			AsterPrivateKey:       asterPrivateKey,
+		}
+		if err := s.verifyCredentials(exchangeID, creds); err != nil {
+			log.Printf("⚠️ 交易所 %s 凭证校验失败: %v", exchangeID, err)
+			warnings[exchangeID] = fmt.Sprintf("凭证校验失败: %v", err)
+		}
 	}
 
 	// 重新加载该用户的所有交易员，使新配置立即生效
-	err := s.traderManager.LoadUserTraders(s.database, userID)
+	err = s.traderManager.LoadUserTraders(s.database, userID)
 	if err != nil {
 		log.Printf("⚠️ 重新加载用户交易员到内存失败: %v", err)
 		// 这里不返回错误，因为交易所配置已经成功更新到数据库
 	}
 
-	log.Printf("✓ 交易所配置已更新: %+v", req.Exchanges)
+	log.Printf("✓ 交易所配置已更新: %d 个", len(req.Exchanges))
+	if len(warnings) > 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "交易所配置已更新，但部分凭证校验失败", "warnings": warnings})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "交易所配置已更新"})
 }
 
@@ -955,12 +1455,16 @@ func (s *Server) handleGetTraderConfig(c *gin.Context) {
 		"btc_eth_leverage":       traderConfig.BTCETHLeverage,
 		"altcoin_leverage":       traderConfig.AltcoinLeverage,
 		"trading_symbols":        traderConfig.TradingSymbols,
+		"analysis_timeframes":    traderConfig.AnalysisTimeframes,
+		"indicator_rules":        decodeIndicatorRules(traderConfig.IndicatorRules),
 		"custom_prompt":          traderConfig.CustomPrompt,
 		"override_base_prompt":   traderConfig.OverrideBasePrompt,
 		"system_prompt_template": traderConfig.SystemPromptTemplate, // 添加此字段
 		"is_cross_margin":        traderConfig.IsCrossMargin,
+		"is_hedge_mode":          traderConfig.IsHedgeMode,
 		"use_coin_pool":          traderConfig.UseCoinPool,
 		"use_oi_top":             traderConfig.UseOITop,
+		"scan_interval_minutes":  traderConfig.ScanIntervalMinutes,
 		"is_running":             isRunning,
 	}
 
@@ -1065,7 +1569,85 @@ func (s *Server) handlePendingOrders(c *gin.Context) {
 	})
 }
 
-// handleDecisions 决策日志列表
+// tradeHistoryDefaultWindow 未指定 since 时默认查询最近7天的成交（币安单次查询窗口上限）
+const tradeHistoryDefaultWindow = 7 * 24 * time.Hour
+
+// handleTradeHistory 交易所成交记录（可选 symbol/since 过滤），用于与AI记录的盈亏对账
+func (s *Server) handleTradeHistory(c *gin.Context) {
+	_, traderID, err := s.getTraderFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// since 支持毫秒时间戳或与 equity-history 相同的时间格式
+	since := time.Now().Add(-tradeHistoryDefaultWindow).UnixMilli()
+	if value := c.Query("since"); value != "" {
+		if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+			since = ms
+		} else if t, err := parseEquityHistoryTime(value); err == nil {
+			since = t.UnixMilli()
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("since 时间格式错误: %v", err)})
+			return
+		}
+	}
+
+	fills, err := trader.GetTradeHistory(c.Query("symbol"), since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("获取成交记录失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trades": fills,
+		"count":  len(fills),
+	})
+}
+
+// handleMarketOverview 候选币种的市场概览（价格变化、资金费率、持仓量变化、市场状态）
+func (s *Server) handleMarketOverview(c *gin.Context) {
+	_, traderID, err := s.getTraderFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	symbols, err := trader.GetCandidateSymbols()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取候选币种失败: %v", err)})
+		return
+	}
+
+	overview := market.GetOverview(symbols)
+
+	c.JSON(http.StatusOK, gin.H{
+		"trader_id": traderID,
+		"symbols":   overview,
+		"count":     len(overview),
+	})
+}
+
+const (
+	decisionsDefaultLimit = 200  // 决策日志列表默认返回条数
+	decisionsMaxLimit     = 1000 // 决策日志列表单页上限
+)
+
+// handleDecisions 决策日志列表（支持 limit/offset 分页）
 func (s *Server) handleDecisions(c *gin.Context) {
 	_, traderID, err := s.getTraderFromQuery(c)
 	if err != nil {
@@ -1079,16 +1661,62 @@ func (s *Server) handleDecisions(c *gin.Context) {
 		return
 	}
 
-	// 获取所有历史决策记录（无限制）
-	records, err := trader.GetDecisionLogger().GetLatestRecords(10000)
+	limit := parseLimit(c.Query("limit"), decisionsDefaultLimit)
+	if limit > decisionsMaxLimit {
+		limit = decisionsMaxLimit
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	// 分页读取（offset 从最新一条起算，页内从旧到新）
+	records, total, err := trader.GetDecisionLogger().GetRecordsPage(offset, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("获取决策日志失败: %v", err),
 		})
 		return
 	}
+	s.redactDecisionPrompts(c, traderID, records)
 
-	c.JSON(http.StatusOK, records)
+	// 未指定分页参数时保持原有的数组响应（仅返回最近 decisionsDefaultLimit 条）
+	if c.Query("limit") == "" && c.Query("offset") == "" {
+		c.Header("X-Total-Count", strconv.Itoa(total))
+		c.JSON(http.StatusOK, records)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trader_id":   traderID,
+		"records":     records,
+		"total_count": total,
+		"limit":       limit,
+		"offset":      offset,
+	})
+}
+
+// redactDecisionPrompts 按交易员配置对非管理员隐藏决策记录中的 SystemPrompt/InputPrompt，决策与思维链保持不变
+func (s *Server) redactDecisionPrompts(c *gin.Context, traderID string, records []*logger.DecisionRecord) {
+	if c.GetString("user_id") == "admin" {
+		return
+	}
+	level, err := s.database.GetTraderPromptRedaction(traderID)
+	if err != nil || level == promptRedactionNone {
+		return
+	}
+	for _, record := range records {
+		if level == promptRedactionOmit {
+			record.SystemPrompt, record.InputPrompt = "", ""
+			continue
+		}
+		if record.SystemPrompt != "" {
+			record.SystemPrompt = redactedPromptPlaceholder
+		}
+		if record.InputPrompt != "" {
+			record.InputPrompt = redactedPromptPlaceholder
+		}
+	}
 }
 
 // handleLatestDecisions 最新决策日志（最近100条，最新的在前）
@@ -1114,6 +1742,8 @@ func (s *Server) handleLatestDecisions(c *gin.Context) {
 		return
 	}
 
+	s.redactDecisionPrompts(c, traderID, records)
+
 	// 反转数组，让最新的在前面（用于列表显示）
 	// GetLatestRecords返回的是从旧到新（用于图表），这里需要从新到旧
 	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
@@ -1148,6 +1778,45 @@ func (s *Server) handleStatistics(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+// handleDailyPnL 按日已实现盈亏（?trader_id=xxx&days=30&tz=Asia/Shanghai，默认按UTC划分日期）
+func (s *Server) handleDailyPnL(c *gin.Context) {
+	_, traderID, err := s.getTraderFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	loc := time.UTC
+	if tz := c.Query("tz"); tz != "" {
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("无效的时区: %s", tz)})
+			return
+		}
+	}
+	days := parseLimit(c.Query("days"), 30)
+
+	trader, err := s.traderManager.GetTrader(traderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	daily, err := trader.GetDecisionLogger().DailyPnLSummary(days, loc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("获取每日盈亏失败: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trader_id": traderID,
+		"timezone":  loc.String(),
+		"days":      daily,
+	})
+}
+
 // handleCompetition 竞赛总览（对比所有trader）
 func (s *Server) handleCompetition(c *gin.Context) {
 	userID := c.GetString("user_id")
@@ -1169,7 +1838,19 @@ func (s *Server) handleCompetition(c *gin.Context) {
 	c.JSON(http.StatusOK, competition)
 }
 
+// parseEquityHistoryTime 解析 from/to 查询参数（"2006-01-02 15:04:05" 本地时间或 RFC3339），为空时返回零值
+func parseEquityHistoryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 // handleEquityHistory 收益率历史数据
+// 优先读取定时记录的净值快照（可选 from/to 过滤），该区间尚无快照时回退到从决策记录重建
 func (s *Server) handleEquityHistory(c *gin.Context) {
 	_, traderID, err := s.getTraderFromQuery(c)
 	if err != nil {
@@ -1183,13 +1864,14 @@ func (s *Server) handleEquityHistory(c *gin.Context) {
 		return
 	}
 
-	// 获取尽可能多的历史数据（几天的数据）
-	// 每3分钟一个周期：10000条 = 约20天的数据
-	records, err := trader.GetDecisionLogger().GetLatestRecords(10000)
+	from, err := parseEquityHistoryTime(c.Query("from"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("获取历史数据失败: %v", err),
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("from 时间格式错误: %v", err)})
+		return
+	}
+	to, err := parseEquityHistoryTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("to 时间格式错误: %v", err)})
 		return
 	}
 
@@ -1213,6 +1895,56 @@ func (s *Server) handleEquityHistory(c *gin.Context) {
 		}
 	}
 
+	var snapshots []*config.EquitySnapshot
+	if s.database != nil {
+		snapshots, err = s.database.ListEquitySnapshots(traderID, from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": fmt.Sprintf("获取净值快照失败: %v", err),
+			})
+			return
+		}
+	}
+	if len(snapshots) > 0 {
+		if initialBalance == 0 {
+			initialBalance = snapshots[0].TotalEquity
+		}
+		history := make([]EquityPoint, 0, len(snapshots))
+		for _, snapshot := range snapshots {
+			totalPnL := snapshot.TotalEquity - initialBalance
+			totalPnLPct := 0.0
+			if initialBalance > 0 {
+				totalPnLPct = (totalPnL / initialBalance) * 100
+			}
+			marginUsedPct := 0.0
+			if snapshot.TotalEquity > 0 {
+				marginUsedPct = (snapshot.MarginUsed / snapshot.TotalEquity) * 100
+			}
+			history = append(history, EquityPoint{
+				Timestamp:        snapshot.Timestamp.Format("2006-01-02 15:04:05"),
+				TotalEquity:      snapshot.TotalEquity,
+				AvailableBalance: snapshot.AvailableBalance,
+				TotalPnL:         totalPnL,
+				TotalPnLPct:      totalPnLPct,
+				PositionCount:    snapshot.PositionCount,
+				MarginUsedPct:    marginUsedPct,
+			})
+		}
+		c.JSON(http.StatusOK, history)
+		return
+	}
+
+	// 尚无净值快照：从决策记录重建
+	// 获取尽可能多的历史数据（几天的数据）
+	// 每3分钟一个周期：10000条 = 约20天的数据
+	records, err := trader.GetDecisionLogger().GetLatestRecords(10000)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("获取历史数据失败: %v", err),
+		})
+		return
+	}
+
 	// 如果无法从status获取，且有历史记录，则从第一条记录获取
 	if initialBalance == 0 && len(records) > 0 {
 		// 第一条记录的equity作为初始余额
@@ -1229,6 +1961,9 @@ func (s *Server) handleEquityHistory(c *gin.Context) {
 
 	var history []EquityPoint
 	for _, record := range records {
+		if (!from.IsZero() && record.Timestamp.Before(from)) || (!to.IsZero() && record.Timestamp.After(to)) {
+			continue
+		}
 		// TotalBalance字段实际存储的是TotalEquity
 		totalEquity := record.AccountState.TotalBalance
 		// TotalUnrealizedProfit字段实际存储的是TotalPnL（相对初始余额）
@@ -1385,23 +2120,7 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		var token string
-		
-		// 优先从 Authorization header 获取
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" {
-			// 检查Bearer token格式
-			tokenParts := strings.Split(authHeader, " ")
-			if len(tokenParts) == 2 && tokenParts[0] == "Bearer" {
-				token = tokenParts[1]
-			}
-		}
-		
-		// 如果 header 中没有，尝试从 query 参数获取（用于 SSE/EventSource）
-		if token == "" {
-			token = c.Query("token")
-		}
-
+		token := requestToken(c)
 		if token == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "缺少Authorization头或token参数"})
 			c.Abort()
@@ -1423,6 +2142,38 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 	}
 }
 
+// optionalAuthMiddleware 可选认证：携带有效token时写入用户信息，否则按匿名请求继续
+func (s *Server) optionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auth.IsAdminMode() {
+			c.Set("user_id", "admin")
+			c.Set("email", "admin@localhost")
+		} else if token := requestToken(c); token != "" {
+			if claims, err := auth.ValidateJWT(token); err == nil {
+				c.Set("user_id", claims.UserID)
+				c.Set("email", claims.Email)
+			}
+		}
+		c.Next()
+	}
+}
+
+// requestToken 从请求中提取JWT token
+func requestToken(c *gin.Context) string {
+	// 优先从 Authorization header 获取
+	authHeader := c.GetHeader("Authorization")
+	if authHeader != "" {
+		// 检查Bearer token格式
+		tokenParts := strings.Split(authHeader, " ")
+		if len(tokenParts) == 2 && tokenParts[0] == "Bearer" {
+			return tokenParts[1]
+		}
+	}
+
+	// 如果 header 中没有，尝试从 query 参数获取（用于 SSE/EventSource）
+	return c.Query("token")
+}
+
 // handleRegister 处理用户注册请求
 func (s *Server) handleRegister(c *gin.Context) {
 	var req struct {
@@ -1673,6 +2424,8 @@ func (s *Server) Start() error {
 	log.Printf("  • GET  /api/account?trader_id=xxx    - 指定trader的账户信息")
 	log.Printf("  • GET  /api/positions?trader_id=xxx  - 指定trader的持仓列表")
 	log.Printf("  • GET  /api/pending-orders?trader_id=xxx - 指定trader的待成交限价单")
+	log.Printf("  • GET  /api/market/overview?trader_id=xxx - 指定trader候选币种的市场概览")
+	log.Printf("  • GET  /api/positions-history?trader_id=xxx&limit=50&offset=0 - 指定trader的已平仓交易历史")
 	log.Printf("  • GET  /api/decisions?trader_id=xxx  - 指定trader的决策日志")
 	log.Printf("  • GET  /api/decisions/latest?trader_id=xxx - 指定trader的最新决策")
 	log.Printf("  • GET  /api/statistics?trader_id=xxx - 指定trader的统计信息")
@@ -1685,14 +2438,15 @@ func (s *Server) Start() error {
 
 // handleGetPromptTemplates 获取所有系统提示词模板列表
 func (s *Server) handleGetPromptTemplates(c *gin.Context) {
-	// 导入 decision 包
-	templates := decision.GetAllPromptTemplates()
+	userID := c.GetString("user_id")
+	templates := decision.GetAllPromptTemplatesForUser(userID)
 
 	// 转换为响应格式
 	response := make([]map[string]interface{}, 0, len(templates))
 	for _, tmpl := range templates {
 		response = append(response, map[string]interface{}{
-			"name": tmpl.Name,
+			"name":   tmpl.Name,
+			"custom": tmpl.UserID != "",
 		})
 	}
 
@@ -1704,8 +2458,9 @@ func (s *Server) handleGetPromptTemplates(c *gin.Context) {
 // handleGetPromptTemplate 获取指定名称的提示词模板内容
 func (s *Server) handleGetPromptTemplate(c *gin.Context) {
 	templateName := c.Param("name")
+	userID := c.GetString("user_id")
 
-	template, err := decision.GetPromptTemplate(templateName)
+	template, err := decision.GetPromptTemplateForUser(userID, templateName)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("模板不存在: %s", templateName)})
 		return
@@ -1714,9 +2469,83 @@ func (s *Server) handleGetPromptTemplate(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"name":    template.Name,
 		"content": template.Content,
+		"custom":  template.UserID != "",
+	})
+}
+
+// loadUserPromptTemplates 从数据库重新加载用户自定义模板到提示词管理器（保存模板后调用）
+func (s *Server) loadUserPromptTemplates(userID string) {
+	records, err := s.database.GetUserPromptTemplates(userID)
+	if err != nil {
+		log.Printf("⚠️ 加载用户 %s 的提示词模板失败: %v", userID, err)
+		return
+	}
+	templates := make([]*decision.PromptTemplate, 0, len(records))
+	for _, record := range records {
+		templates = append(templates, &decision.PromptTemplate{Name: record.Name, Content: record.Content})
+	}
+	decision.SetUserPromptTemplates(userID, templates)
+}
+
+// handleSavePromptTemplate 创建或更新用户自定义提示词模板
+func (s *Server) handleSavePromptTemplate(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Name    string `json:"name" binding:"required"`
+		Content string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || strings.ContainsAny(name, "/\\") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "模板名称无效"})
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "模板内容不能为空"})
+		return
+	}
+	if decision.IsBuiltinPromptTemplate(name) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("模板名称与内置模板重名: %s", name)})
+		return
+	}
+
+	if err := s.database.UpsertUserPromptTemplate(userID, name, req.Content); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("保存提示词模板失败: %v", err)})
+		return
+	}
+	s.loadUserPromptTemplates(userID)
+
+	log.Printf("✓ 用户 %s 保存提示词模板: %s", userID, name)
+	c.JSON(http.StatusOK, gin.H{
+		"name":    name,
+		"message": "提示词模板已保存",
 	})
 }
 
+// handleDeletePromptTemplate 删除用户自定义提示词模板
+func (s *Server) handleDeletePromptTemplate(c *gin.Context) {
+	userID := c.GetString("user_id")
+	name := c.Param("name")
+
+	if err := s.database.DeleteUserPromptTemplate(userID, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("模板不存在: %s", name)})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("删除提示词模板失败: %v", err)})
+		return
+	}
+	decision.DeleteUserPromptTemplate(userID, name)
+
+	log.Printf("✓ 用户 %s 删除提示词模板: %s", userID, name)
+	c.JSON(http.StatusOK, gin.H{"message": "提示词模板已删除"})
+}
+
 // handleKlines 获取K线数据
 func (s *Server) handleKlines(c *gin.Context) {
 	// 获取参数
@@ -1884,6 +2713,7 @@ func (s *Server) handleCycleCheck(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("获取决策记录失败: %v", err)})
 		return
 	}
+	s.redactDecisionPrompts(c, traderID, records)
 
 	c.JSON(http.StatusOK, gin.H{
 		"trader_id": traderID,
@@ -1914,6 +2744,81 @@ func (s *Server) handleListCloseReviews(c *gin.Context) {
 	})
 }
 
+// positionsHistoryRecordLimit 平仓历史最多回看的决策记录数
+const positionsHistoryRecordLimit = 10000
+
+// positionHistoryItem 平仓历史中的单笔交易
+type positionHistoryItem struct {
+	TradeID        string    `json:"trade_id"`
+	Symbol         string    `json:"symbol"`
+	Side           string    `json:"side"`
+	EntryPrice     float64   `json:"entry_price"`
+	ExitPrice      float64   `json:"exit_price"`
+	Quantity       float64   `json:"quantity"`
+	Leverage       int       `json:"leverage"`
+	RealizedPnL    float64   `json:"realized_pnl"`
+	PnLPct         float64   `json:"pnl_pct"`
+	OpenTime       time.Time `json:"open_time"`
+	CloseTime      time.Time `json:"close_time"`
+	HoldingMinutes int       `json:"holding_minutes"`
+}
+
+// handlePositionsHistory 已平仓交易历史（按平仓时间倒序，支持 limit/offset 分页）
+func (s *Server) handlePositionsHistory(c *gin.Context) {
+	traderMgr, traderID, err := s.getTraderFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := parseLimit(c.Query("limit"), 50)
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	// 交易员运行中使用其决策日志记录器，否则直接读取文件系统中的决策日志
+	var decisionLogger *logger.DecisionLogger
+	if trader, err := traderMgr.GetTrader(traderID); err == nil && trader != nil && trader.GetDecisionLogger() != nil {
+		decisionLogger = trader.GetDecisionLogger()
+	} else {
+		decisionLogger = logger.NewDecisionLogger(fmt.Sprintf("decision_logs/%s", traderID))
+	}
+
+	trades, err := review.ExtractClosedTrades(decisionLogger, positionsHistoryRecordLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("提取平仓历史失败: %v", err)})
+		return
+	}
+
+	items := make([]positionHistoryItem, 0, limit)
+	for i := len(trades) - 1 - offset; i >= 0 && len(items) < limit; i-- {
+		trade := trades[i]
+		items = append(items, positionHistoryItem{
+			TradeID:        trade.TradeID,
+			Symbol:         trade.Symbol,
+			Side:           trade.Side,
+			EntryPrice:     trade.EntryPrice,
+			ExitPrice:      trade.ExitPrice,
+			Quantity:       trade.Quantity,
+			Leverage:       trade.Leverage,
+			RealizedPnL:    trade.PnL,
+			PnLPct:         trade.PnLPct,
+			OpenTime:       trade.EntryTime,
+			CloseTime:      trade.ExitTime,
+			HoldingMinutes: trade.HoldingMinutes,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trader_id": traderID,
+		"trades":    items,
+		"total":     len(trades),
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
 // handleGetCloseReview 返回某个trade的close review详情
 func (s *Server) handleGetCloseReview(c *gin.Context) {
 	tradeID := c.Param("trade_id")
@@ -2096,6 +3001,7 @@ func (s *Server) handleReviewLossTrades(c *gin.Context) {
 
 	// 创建复盘生成器
 	reviewGen := review.NewReviewGenerator(mcpClient)
+	reviewGen.SetKlineFetcher(market.GetKlinesRange)
 
 	// 批量生成复盘
 	reviewed := 0
@@ -2230,6 +3136,7 @@ func (s *Server) handleReviewSingleTrade(c *gin.Context) {
 
 	// 创建复盘生成器
 	reviewGen := review.NewReviewGenerator(mcpClient)
+	reviewGen.SetKlineFetcher(market.GetKlinesRange)
 
 	// 首先尝试从亏损交易列表中查找（更快）
 	lossTrades, err := review.ExtractLossTrades(decisionLogger, 1000)
@@ -2449,11 +3356,6 @@ func (s *Server) handleAIDecisionStream(c *gin.Context) {
 	})
 	c.Writer.Flush()
 
-	// 获取 trader 的上下文信息（需要从 trader 获取）
-	// 这里需要调用 trader 的方法来构建决策上下文
-	// 由于 trader 接口可能没有直接暴露构建上下文的方法，我们需要通过反射或添加新方法
-	// 为了简化，我们先尝试获取账户和持仓信息来构建上下文
-
 	account, err := trader.GetAccountInfo()
 	if err != nil {
 		c.SSEvent("message", gin.H{
@@ -2474,61 +3376,49 @@ func (s *Server) handleAIDecisionStream(c *gin.Context) {
 		return
 	}
 
-	// 构建决策上下文（简化版，实际需要更多信息）
+	// 构建决策上下文（运行时长/调用次数取自交易员状态）
+	status := trader.GetStatus()
+	runtimeMinutes, _ := status["runtime_minutes"].(int)
+	callCount, _ := status["call_count"].(int)
+	positionCount, _ := account["position_count"].(int)
 	ctx := &decision.Context{
 		CurrentTime:    time.Now().Format("2006-01-02 15:04:05"),
-		RuntimeMinutes: 0, // 需要从 trader 获取
-		CallCount:      0, // 需要从 trader 获取
+		RuntimeMinutes: runtimeMinutes,
+		CallCount:      callCount,
+		UserID:         trader.GetUserID(),
 		Account: decision.AccountInfo{
-			TotalEquity:      account["total_equity"].(float64),
-			AvailableBalance: account["available_balance"].(float64),
-			TotalPnL:         account["total_pnl"].(float64),
-			TotalPnLPct:      account["total_pnl_pct"].(float64),
-			MarginUsed:       account["margin_used"].(float64),
-			MarginUsedPct:    account["margin_used_pct"].(float64),
-			PositionCount:    int(account["position_count"].(float64)),
+			TotalEquity:      floatField(account, "total_equity"),
+			AvailableBalance: floatField(account, "available_balance"),
+			TotalPnL:         floatField(account, "total_pnl"),
+			TotalPnLPct:      floatField(account, "total_pnl_pct"),
+			MarginUsed:       floatField(account, "margin_used"),
+			MarginUsedPct:    floatField(account, "margin_used_pct"),
+			PositionCount:    positionCount,
 		},
-		Positions:     make([]decision.PositionInfo, 0),
-		PendingOrders: make([]decision.PendingOrderInfo, 0),
+		Positions:      make([]decision.PositionInfo, 0),
+		PendingOrders:  make([]decision.PendingOrderInfo, 0),
 		CandidateCoins: make([]decision.CandidateCoin, 0),
 	}
 
 	// 转换持仓信息
 	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		leverage, _ := pos["leverage"].(int)
 		ctx.Positions = append(ctx.Positions, decision.PositionInfo{
-			Symbol:           pos["symbol"].(string),
-			Side:             pos["side"].(string),
-			EntryPrice:       pos["entry_price"].(float64),
-			MarkPrice:        pos["mark_price"].(float64),
-			Quantity:         pos["quantity"].(float64),
-			Leverage:         int(pos["leverage"].(float64)),
-			UnrealizedPnL:    pos["unrealized_pnl"].(float64),
-			UnrealizedPnLPct: pos["unrealized_pnl_pct"].(float64),
-			LiquidationPrice: pos["liquidation_price"].(float64),
-			MarginUsed:       pos["margin_used"].(float64),
-		})
-	}
-
-	// 获取 MCP 客户端（需要从 trader 获取）
-	// 这里假设 trader 有 GetMCPClient 方法，如果没有需要添加
-	// 为了简化，我们先使用流式回调来推送内容
-
-	// 创建流式回调
-	var fullResponse strings.Builder
-	_ = func(chunk string) error {
-		fullResponse.WriteString(chunk)
-		// 推送增量内容
-		c.SSEvent("message", gin.H{
-			"type": "partial_cot",
-			"data": chunk,
+			Symbol:           symbol,
+			Side:             side,
+			EntryPrice:       floatField(pos, "entry_price"),
+			MarkPrice:        floatField(pos, "mark_price"),
+			Quantity:         floatField(pos, "quantity"),
+			Leverage:         leverage,
+			UnrealizedPnL:    floatField(pos, "unrealized_pnl"),
+			UnrealizedPnLPct: floatField(pos, "unrealized_pnl_pct"),
+			LiquidationPrice: floatField(pos, "liquidation_price"),
+			MarginUsed:       floatField(pos, "margin_used"),
 		})
-		c.Writer.Flush()
-		return nil
 	}
 
-	// 获取 trader 的 MCP 客户端（需要添加方法或通过接口获取）
-	// 这里先注释，需要根据实际 trader 接口实现
-	/*
 	mcpClient := trader.GetMCPClient()
 	if mcpClient == nil {
 		c.SSEvent("message", gin.H{
@@ -2539,8 +3429,17 @@ func (s *Server) handleAIDecisionStream(c *gin.Context) {
 		return
 	}
 
-	// 调用流式决策
-	decisionResult, err := decision.GetFullDecisionStream(ctx, mcpClient, "", false, "", streamCallback)
+	// 流式回调：推送增量 CoT 内容
+	streamCallback := func(chunk string) error {
+		c.SSEvent("message", gin.H{
+			"type": "partial_cot",
+			"data": chunk,
+		})
+		c.Writer.Flush()
+		return nil
+	}
+
+	decisionResult, err := decision.GetFullDecisionStream(ctx, mcpClient, "", false, trader.GetSystemPromptTemplate(), streamCallback, trader.GetGlobalConfig())
 	if err != nil {
 		c.SSEvent("message", gin.H{
 			"type":    "error",
@@ -2552,17 +3451,15 @@ func (s *Server) handleAIDecisionStream(c *gin.Context) {
 
 	// 发送最终决策
 	c.SSEvent("message", gin.H{
-		"type":     "final_decision",
+		"type":      "final_decision",
 		"decision":  decisionResult,
 		"cot_trace": decisionResult.CoTTrace,
 	})
 	c.Writer.Flush()
-	*/
+}
 
-	// 临时实现：发送提示信息
-	c.SSEvent("message", gin.H{
-		"type":    "info",
-		"message": "流式决策功能需要 trader 接口支持 GetMCPClient 方法",
-	})
-	c.Writer.Flush()
+// floatField 从 map 中读取 float64 字段，缺失或类型不符时返回0
+func floatField(m map[string]interface{}, key string) float64 {
+	v, _ := m[key].(float64)
+	return v
 }
@@ -0,0 +1,1098 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nofx/config"
+	"nofx/logger"
+	"nofx/manager"
+	"nofx/market"
+	"nofx/trader"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestServer 创建使用临时数据库的测试服务器
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	db, err := config.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Server{database: db, traderManager: manager.NewTraderManager(nil)}
+}
+
+// performGet 以指定用户身份调用处理函数
+func performGet(handler gin.HandlerFunc, userID string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Set("user_id", userID)
+	handler(c)
+	return w
+}
+
+// performJSON 以指定用户身份携带JSON请求体调用处理函数
+func performJSON(handler gin.HandlerFunc, userID, method, target, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", userID)
+	handler(c)
+	return w
+}
+
+// TestMaskSecret 测试密钥脱敏规则
+func TestMaskSecret(t *testing.T) {
+	cases := map[string]string{
+		"":                    "",
+		"short":               "****",
+		"sk-1234567890abcdef": "****cdef",
+	}
+	for input, expected := range cases {
+		if got := maskSecret(input); got != expected {
+			t.Errorf("maskSecret(%q) 期望 %q，实际 %q", input, expected, got)
+		}
+	}
+
+	if got := maskPrivateKey("0xdeadbeefcafebabe"); got != "****" {
+		t.Errorf("私钥脱敏不应保留任何字符，实际 %q", got)
+	}
+	if got, err := resolveSecret("****cdef", "sk-1234567890abcdef", true); err != nil || got != "sk-1234567890abcdef" {
+		t.Errorf("回传脱敏值应保留原值，实际 %q, err=%v", got, err)
+	}
+	if got, err := resolveSecret("sk-new", "sk-old", true); err != nil || got != "sk-new" {
+		t.Errorf("回传新值应覆盖原值，实际 %q, err=%v", got, err)
+	}
+	if _, err := resolveSecret("****cdef", "", false); err == nil {
+		t.Error("没有已保存记录时回传脱敏值应报错")
+	}
+	if got, err := resolveSecret("sk-new", "", false); err != nil || got != "sk-new" {
+		t.Errorf("没有已保存记录时新值应直接使用，实际 %q, err=%v", got, err)
+	}
+}
+
+// TestGetModelConfigsMasksAPIKey 测试AI模型配置响应不包含完整密钥
+func TestGetModelConfigsMasksAPIKey(t *testing.T) {
+	s := newTestServer(t)
+	secret := "sk-model-secret-9f8e7d6c"
+	if err := s.database.UpdateAIModel("user1", "deepseek", true, secret, "", ""); err != nil {
+		t.Fatalf("写入模型配置失败: %v", err)
+	}
+
+	w := performGet(s.handleGetModelConfigs, "user1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if strings.Contains(body, secret) {
+		t.Fatalf("响应中包含完整密钥: %s", body)
+	}
+
+	var models []ModelConfigResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &models); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(models) != 1 {
+		t.Fatalf("期望 1 个模型，实际 %d", len(models))
+	}
+	if models[0].APIKey != "****7d6c" {
+		t.Errorf("期望脱敏为 ****7d6c，实际 %q", models[0].APIKey)
+	}
+	if !models[0].HasAPIKey {
+		t.Errorf("期望 hasApiKey=true")
+	}
+}
+
+// TestGetExchangeConfigsNeverReturnsPrivateKeys 测试交易所配置响应不返回私钥
+func TestGetExchangeConfigsNeverReturnsPrivateKeys(t *testing.T) {
+	s := newTestServer(t)
+	binanceKey := "binance-api-key-AAAA1111"
+	binanceSecret := "binance-secret-BBBB2222"
+	hlPrivateKey := "0xhyperliquidprivatekey3333"
+	asterPrivateKey := "0xasterprivatekey4444"
+
+	if err := s.database.UpdateExchange("user1", "binance", true, binanceKey, binanceSecret, false, "", "", "", ""); err != nil {
+		t.Fatalf("写入binance配置失败: %v", err)
+	}
+	if err := s.database.UpdateExchange("user1", "hyperliquid", true, hlPrivateKey, "", false, "0xwallet", "", "", ""); err != nil {
+		t.Fatalf("写入hyperliquid配置失败: %v", err)
+	}
+	if err := s.database.UpdateExchange("user1", "aster", true, "", "", false, "", "0xuser", "0xsigner", asterPrivateKey); err != nil {
+		t.Fatalf("写入aster配置失败: %v", err)
+	}
+
+	w := performGet(s.handleGetExchangeConfigs, "user1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, secret := range []string{binanceKey, binanceSecret, hlPrivateKey, asterPrivateKey, "3333", "4444"} {
+		if strings.Contains(body, secret) {
+			t.Fatalf("响应中包含敏感值 %q: %s", secret, body)
+		}
+	}
+
+	var exchanges []ExchangeConfigResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &exchanges); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	byID := make(map[string]ExchangeConfigResponse)
+	for _, e := range exchanges {
+		byID[e.ID] = e
+	}
+
+	if got := byID["binance"].APIKey; got != "****1111" {
+		t.Errorf("binance apiKey 期望 ****1111，实际 %q", got)
+	}
+	if got := byID["binance"].SecretKey; got != "****2222" {
+		t.Errorf("binance secretKey 期望 ****2222，实际 %q", got)
+	}
+	if got := byID["hyperliquid"].APIKey; got != "****" || !byID["hyperliquid"].HasAPIKey {
+		t.Errorf("hyperliquid 私钥应仅标记存在，实际 %q", got)
+	}
+	if got := byID["aster"].AsterPrivateKey; got != "****" || !byID["aster"].HasAsterPrivateKey {
+		t.Errorf("aster 私钥应仅标记存在，实际 %q", got)
+	}
+	if byID["aster"].AsterUser != "0xuser" {
+		t.Errorf("非敏感字段应原样返回，实际 %q", byID["aster"].AsterUser)
+	}
+}
+
+// mockCredentialVerifier 只接受指定API Key的mock校验器
+func mockCredentialVerifier(validKey string, calls *int) trader.CredentialVerifier {
+	return func(exchangeID string, creds trader.ExchangeCredentials) error {
+		*calls++
+		if creds.APIKey != validKey {
+			return errors.New("invalid api key")
+		}
+		return nil
+	}
+}
+
+// TestUpdateExchangeConfigsVerifiesCredentials 测试保存交易所配置时的凭证校验
+func TestUpdateExchangeConfigsVerifiesCredentials(t *testing.T) {
+	s := newTestServer(t)
+	calls := 0
+	s.verifyCredentials = mockCredentialVerifier("good-key", &calls)
+
+	// 有效凭证：无警告
+	w := performJSON(s.handleUpdateExchangeConfigs, "user1", http.MethodPut, "/",
+		`{"exchanges":{"binance":{"enabled":true,"api_key":"good-key","secret_key":"secret"}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "warnings") {
+		t.Errorf("有效凭证不应返回警告: %s", w.Body.String())
+	}
+
+	// 无效凭证：仍然保存，但返回警告
+	w = performJSON(s.handleUpdateExchangeConfigs, "user1", http.MethodPut, "/",
+		`{"exchanges":{"binance":{"enabled":true,"api_key":"bad-key","secret_key":"secret"}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Warnings map[string]string `json:"warnings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Warnings["binance"] == "" {
+		t.Errorf("无效凭证应返回警告: %s", w.Body.String())
+	}
+	exchanges, err := s.database.GetExchanges("user1")
+	if err != nil || len(exchanges) != 1 || exchanges[0].APIKey != "bad-key" {
+		t.Fatalf("校验失败时配置仍应保存: %+v, err=%v", exchanges, err)
+	}
+
+	if calls != 2 {
+		t.Errorf("期望校验 2 次，实际 %d", calls)
+	}
+}
+
+// TestUpdateExchangeConfigsSkipVerification 测试离线配置跳过凭证校验
+func TestUpdateExchangeConfigsSkipVerification(t *testing.T) {
+	s := newTestServer(t)
+	calls := 0
+	s.verifyCredentials = mockCredentialVerifier("good-key", &calls)
+
+	w := performJSON(s.handleUpdateExchangeConfigs, "user1", http.MethodPut, "/",
+		`{"skip_verification":true,"exchanges":{"binance":{"enabled":true,"api_key":"bad-key","secret_key":"secret"}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	w = performJSON(s.handleUpdateExchangeConfigs, "user1", http.MethodPut, "/?skip_verify=true",
+		`{"exchanges":{"binance":{"enabled":true,"api_key":"bad-key","secret_key":"secret"}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	// 未启用的交易所同样不校验
+	w = performJSON(s.handleUpdateExchangeConfigs, "user1", http.MethodPut, "/",
+		`{"exchanges":{"binance":{"enabled":false,"api_key":"bad-key","secret_key":"secret"}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+
+	if calls != 0 {
+		t.Errorf("跳过校验时不应调用校验器，实际调用 %d 次", calls)
+	}
+}
+
+// TestUpdateExchangeConfigsRejectsMaskedWithoutRecord 测试没有已保存记录时拒绝脱敏占位值
+func TestUpdateExchangeConfigsRejectsMaskedWithoutRecord(t *testing.T) {
+	s := newTestServer(t)
+
+	w := performJSON(s.handleUpdateExchangeConfigs, "user1", http.MethodPut, "/",
+		`{"skip_verification":true,"exchanges":{"binance":{"enabled":true,"api_key":"****cdef","secret_key":"secret"}}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("期望 400，实际 %d: %s", w.Code, w.Body.String())
+	}
+	if exchanges, _ := s.database.GetExchanges("user1"); len(exchanges) != 0 {
+		t.Fatalf("占位值不应写入数据库: %+v", exchanges)
+	}
+
+	w = performJSON(s.handleUpdateModelConfigs, "user1", http.MethodPut, "/",
+		`{"models":{"unknown-model":{"enabled":true,"api_key":"****cdef"}}}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("期望 400，实际 %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// addTestTrader 向内存中添加一个交易员（不连接交易所）
+func addTestTrader(t *testing.T, s *Server, id, traderMode string) {
+	t.Helper()
+	record := &config.TraderRecord{
+		ID:             id,
+		UserID:         "user1",
+		Name:           id,
+		TraderMode:     traderMode,
+		InitialBalance: 1000,
+		BTCETHLeverage: 5,
+	}
+	aiModel := &config.AIModelConfig{ID: "deepseek", Provider: "deepseek"}
+	exchange := &config.ExchangeConfig{ID: "binance"}
+	if err := s.traderManager.AddTraderFromDB(record, aiModel, exchange, "", "", 10, 20, 60, []string{"BTCUSDT"}); err != nil {
+		t.Fatalf("添加交易员失败: %v", err)
+	}
+}
+
+// TestPaperResetHandler 测试纸交易员重置接口
+func TestPaperResetHandler(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策日志写入临时目录
+	s := newTestServer(t)
+	addTestTrader(t, s, "paper_trader", "paper")
+	addTestTrader(t, s, "live_trader", "binance")
+
+	at, err := s.traderManager.GetTrader("paper_trader")
+	if err != nil {
+		t.Fatalf("获取交易员失败: %v", err)
+	}
+
+	// 模拟几笔交易的决策记录
+	for _, action := range []string{"open_long", "close_long"} {
+		record := &logger.DecisionRecord{
+			Success:   true,
+			Decisions: []logger.DecisionAction{{Action: action, Symbol: "BTCUSDT", Success: true}},
+		}
+		if err := at.GetDecisionLogger().LogDecision(record); err != nil {
+			t.Fatalf("写入决策记录失败: %v", err)
+		}
+	}
+
+	resetFor := func(id, body string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		c.Set("user_id", "user1")
+		s.handlePaperReset(c)
+		return w
+	}
+
+	// 真实交易员禁止重置
+	if w := resetFor("live_trader", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("真实交易员重置期望 400，实际 %d: %s", w.Code, w.Body.String())
+	}
+	if w := resetFor("missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("不存在的交易员期望 404，实际 %d", w.Code)
+	}
+
+	// 不清空决策记录
+	if w := resetFor("paper_trader", ""); w.Code != http.StatusOK {
+		t.Fatalf("纸交易员重置期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	records, err := at.GetDecisionLogger().GetLatestRecords(10)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("未要求清空时应保留决策记录: %d, err=%v", len(records), err)
+	}
+
+	// 清空决策记录
+	if w := resetFor("paper_trader", `{"wipe_decision_log":true}`); w.Code != http.StatusOK {
+		t.Fatalf("纸交易员重置期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	records, err = at.GetDecisionLogger().GetLatestRecords(10)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("决策记录应被清空: %d, err=%v", len(records), err)
+	}
+	if len(at.GetPendingOrders()) != 0 {
+		t.Errorf("重置后不应有待成交订单")
+	}
+}
+
+// TestTradeHistoryHandler 测试交易所成交记录接口
+func TestTradeHistoryHandler(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	addTestTrader(t, s, "paper_trader", "paper")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/trade-history?"+query, nil)
+		c.Set("user_id", "user1")
+		s.handleTradeHistory(c)
+		return w
+	}
+
+	if w := get("trader_id=paper_trader&symbol=BTCUSDT&since=yesterday"); w.Code != http.StatusBadRequest {
+		t.Errorf("since 格式错误期望 400，实际 %d", w.Code)
+	}
+	if w := get("trader_id=missing"); w.Code != http.StatusNotFound {
+		t.Errorf("不存在的交易员期望 404，实际 %d", w.Code)
+	}
+
+	w := get("trader_id=paper_trader&symbol=BTCUSDT&since=1700000000000")
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Count  int                `json:"count"`
+		Trades []trader.TradeFill `json:"trades"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Count != 0 || resp.Trades == nil {
+		t.Errorf("纸交易员无成交时应返回空列表: %s", w.Body.String())
+	}
+}
+
+// overviewMarketProvider 返回固定市场数据的模拟提供者
+type overviewMarketProvider struct {
+	data map[string]*market.Data
+}
+
+func (p *overviewMarketProvider) Get(symbol string) (*market.Data, error) {
+	if data, ok := p.data[symbol]; ok {
+		return data, nil
+	}
+	return nil, errors.New("no data")
+}
+
+// TestMarketOverviewHandler 测试候选币种市场概览接口
+func TestMarketOverviewHandler(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+
+	record := &config.TraderRecord{
+		ID:             "overview_trader",
+		UserID:         "user1",
+		Name:           "overview_trader",
+		TraderMode:     "paper",
+		InitialBalance: 1000,
+		BTCETHLeverage: 5,
+		TradingSymbols: "BTCUSDT,ETHUSDT",
+	}
+	aiModel := &config.AIModelConfig{ID: "deepseek", Provider: "deepseek"}
+	exchange := &config.ExchangeConfig{ID: "binance"}
+	if err := s.traderManager.AddTraderFromDB(record, aiModel, exchange, "", "", 10, 20, 60, nil); err != nil {
+		t.Fatalf("添加交易员失败: %v", err)
+	}
+
+	market.SetMarketDataProvider(&overviewMarketProvider{data: map[string]*market.Data{
+		"BTCUSDT": {
+			Symbol:        "BTCUSDT",
+			CurrentPrice:  100000,
+			PriceChange1h: 0.5,
+			PriceChange4h: 2.1,
+			FundingRate:   0.0001,
+			OpenInterest:  &market.OIData{Latest: 110, Average: 100},
+			PriceAction4h: &market.PriceActionSummary{LastSignal: "BOS_up"},
+			TrendPhase:    &market.TrendPhaseInfo{TrendStrength4h: 70},
+		},
+		"ETHUSDT": {
+			Symbol:        "ETHUSDT",
+			CurrentPrice:  4000,
+			PriceChange4h: -0.3,
+			FundingRate:   -0.0002,
+			OpenInterest:  &market.OIData{Latest: 95, Average: 100},
+			TrendPhase:    &market.TrendPhaseInfo{TrendStrength4h: 20},
+		},
+	}})
+	defer market.ResetMarketDataProvider()
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/market/overview?trader_id=overview_trader", nil)
+	c.Set("user_id", "user1")
+	s.handleMarketOverview(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Count   int                     `json:"count"`
+		Symbols []market.SymbolOverview `json:"symbols"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Count != 2 || len(resp.Symbols) != 2 {
+		t.Fatalf("期望 2 个币种，实际 %d: %s", resp.Count, w.Body.String())
+	}
+
+	btc, eth := resp.Symbols[0], resp.Symbols[1]
+	if btc.Symbol != "BTCUSDT" || btc.Regime != "trending_up" || btc.PriceChange4h != 2.1 {
+		t.Errorf("BTC 概览错误: %+v", btc)
+	}
+	if math.Abs(btc.OIDeltaPct-10) > 1e-9 {
+		t.Errorf("BTC OI变化期望 10%%，实际 %.4f", btc.OIDeltaPct)
+	}
+	if eth.Symbol != "ETHUSDT" || eth.Regime != "ranging" || eth.FundingRate != -0.0002 {
+		t.Errorf("ETH 概览错误: %+v", eth)
+	}
+	if math.Abs(eth.OIDeltaPct+5) > 1e-9 {
+		t.Errorf("ETH OI变化期望 -5%%，实际 %.4f", eth.OIDeltaPct)
+	}
+}
+
+// TestUserPromptTemplateHandlers 测试用户自定义提示词模板的创建、获取和删除
+func TestUserPromptTemplateHandlers(t *testing.T) {
+	s := newTestServer(t)
+
+	withName := func(handler gin.HandlerFunc, method, userID, name string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(method, "/", nil)
+		c.Params = gin.Params{{Key: "name", Value: name}}
+		c.Set("user_id", userID)
+		handler(c)
+		return w
+	}
+
+	// 内容为空被拒绝
+	if w := performJSON(s.handleSavePromptTemplate, "user1", http.MethodPost, "/", `{"name":"scalper","content":"   "}`); w.Code != http.StatusBadRequest {
+		t.Errorf("空内容期望 400，实际 %d: %s", w.Code, w.Body.String())
+	}
+
+	// 创建
+	if w := performJSON(s.handleSavePromptTemplate, "user1", http.MethodPost, "/", `{"name":"scalper","content":"只做15m剥头皮"}`); w.Code != http.StatusOK {
+		t.Fatalf("创建模板期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+
+	// 获取内容
+	w := withName(s.handleGetPromptTemplate, http.MethodGet, "user1", "scalper")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "只做15m剥头皮") {
+		t.Fatalf("获取模板期望 200 且包含内容，实际 %d: %s", w.Code, w.Body.String())
+	}
+
+	// 同名再次提交为更新
+	if w := performJSON(s.handleSavePromptTemplate, "user1", http.MethodPost, "/", `{"name":"scalper","content":"只做5m剥头皮"}`); w.Code != http.StatusOK {
+		t.Fatalf("更新模板期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	records, err := s.database.GetUserPromptTemplates("user1")
+	if err != nil || len(records) != 1 || records[0].Content != "只做5m剥头皮" {
+		t.Fatalf("同名模板应被更新而不是新增: %+v, err=%v", records, err)
+	}
+
+	// 列表合并用户模板，其他用户不可见
+	w = performGet(s.handleGetPromptTemplates, "user1")
+	if !strings.Contains(w.Body.String(), `"name":"scalper"`) {
+		t.Errorf("用户模板应出现在列表中: %s", w.Body.String())
+	}
+	if w := performGet(s.handleGetPromptTemplates, "user2"); strings.Contains(w.Body.String(), "scalper") {
+		t.Errorf("其他用户不应看到该模板: %s", w.Body.String())
+	}
+	if w := withName(s.handleGetPromptTemplate, http.MethodGet, "user2", "scalper"); w.Code != http.StatusNotFound {
+		t.Errorf("其他用户获取模板期望 404，实际 %d", w.Code)
+	}
+
+	// 删除
+	if w := withName(s.handleDeletePromptTemplate, http.MethodDelete, "user1", "scalper"); w.Code != http.StatusOK {
+		t.Fatalf("删除模板期望 200，实际 %d: %s", w.Code, w.Body.String())
+	}
+	if w := withName(s.handleGetPromptTemplate, http.MethodGet, "user1", "scalper"); w.Code != http.StatusNotFound {
+		t.Errorf("删除后获取期望 404，实际 %d", w.Code)
+	}
+	if w := withName(s.handleDeletePromptTemplate, http.MethodDelete, "user1", "scalper"); w.Code != http.StatusNotFound {
+		t.Errorf("重复删除期望 404，实际 %d", w.Code)
+	}
+}
+
+// TestPositionsHistoryHandler 测试已平仓交易历史接口
+func TestPositionsHistoryHandler(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	addTestTrader(t, s, "history_trader", "paper")
+
+	at, err := s.traderManager.GetTrader("history_trader")
+	if err != nil {
+		t.Fatalf("获取交易员失败: %v", err)
+	}
+
+	// 一笔盈利多单、一笔亏损空单（写在同一条记录中保证配对顺序，ETH后平仓）
+	if err := at.GetDecisionLogger().LogDecision(&logger.DecisionRecord{
+		Success: true,
+		Decisions: []logger.DecisionAction{
+			{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Leverage: 5, Price: 100000, Success: true},
+			{Action: "close_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 101000, Success: true},
+			{Action: "open_short", Symbol: "ETHUSDT", Quantity: 1, Leverage: 5, Price: 4000, Success: true},
+			{Action: "close_short", Symbol: "ETHUSDT", Quantity: 1, Price: 4040, Success: true},
+		},
+	}); err != nil {
+		t.Fatalf("写入决策记录失败: %v", err)
+	}
+
+	get := func(query string) (int, map[string]json.RawMessage, []map[string]interface{}) {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/positions-history?trader_id=history_trader"+query, nil)
+		c.Set("user_id", "user1")
+		s.handlePositionsHistory(c)
+
+		var resp map[string]json.RawMessage
+		var trades []map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		json.Unmarshal(resp["trades"], &trades)
+		return w.Code, resp, trades
+	}
+
+	code, resp, trades := get("")
+	if code != http.StatusOK || len(trades) != 2 || string(resp["total"]) != "2" {
+		t.Fatalf("期望 200 且返回2笔交易，实际 %d: %v", code, trades)
+	}
+	// 最近平仓的排在前面
+	if trades[0]["symbol"] != "ETHUSDT" || trades[1]["symbol"] != "BTCUSDT" {
+		t.Errorf("排序错误: %v", trades)
+	}
+	if pnl := trades[1]["realized_pnl"].(float64); math.Abs(pnl-100) > 1e-9 {
+		t.Errorf("BTC 盈亏期望 100，实际 %.4f", pnl)
+	}
+	if pnl := trades[0]["realized_pnl"].(float64); math.Abs(pnl+40) > 1e-9 {
+		t.Errorf("ETH 盈亏期望 -40，实际 %.4f", pnl)
+	}
+	for _, field := range []string{"entry_price", "exit_price", "quantity", "pnl_pct", "open_time", "close_time", "holding_minutes", "side"} {
+		if _, ok := trades[0][field]; !ok {
+			t.Errorf("缺少字段 %s", field)
+		}
+	}
+
+	// 分页
+	if _, _, trades := get("&limit=1&offset=1"); len(trades) != 1 || trades[0]["symbol"] != "BTCUSDT" {
+		t.Errorf("分页结果错误: %v", trades)
+	}
+}
+
+// TestUpdateTraderScanInterval 测试更新交易员扫描间隔：写入数据库并同步到已加载的交易员
+func TestUpdateTraderScanInterval(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	if err := s.database.CreateTrader(&config.TraderRecord{
+		ID: "scan_trader", UserID: "user1", Name: "scan_trader",
+		AIModelID: "deepseek", ExchangeID: "binance", ScanIntervalMinutes: 3,
+	}); err != nil {
+		t.Fatalf("创建交易员记录失败: %v", err)
+	}
+	addTestTrader(t, s, "scan_trader", "paper")
+
+	update := func(body string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/traders/scan_trader", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: "scan_trader"}}
+		c.Set("user_id", "user1")
+		s.handleUpdateTrader(c)
+		return w
+	}
+	storedInterval := func() int {
+		traders, err := s.database.GetTraders("user1")
+		if err != nil || len(traders) != 1 {
+			t.Fatalf("读取交易员失败: %v", err)
+		}
+		return traders[0].ScanIntervalMinutes
+	}
+	const base = `"name":"scan_trader","ai_model_id":"deepseek","exchange_id":"binance"`
+
+	if w := update(`{` + base + `,"scan_interval_minutes":2000}`); w.Code != http.StatusBadRequest {
+		t.Errorf("超出范围的扫描间隔应返回400，实际 %d", w.Code)
+	}
+
+	if w := update(`{` + base + `}`); w.Code != http.StatusOK {
+		t.Fatalf("未指定扫描间隔时更新失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedInterval(); got != 3 {
+		t.Errorf("未指定时应保持原值3，实际 %d", got)
+	}
+
+	if w := update(`{` + base + `,"scan_interval_minutes":10}`); w.Code != http.StatusOK {
+		t.Fatalf("更新扫描间隔失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedInterval(); got != 10 {
+		t.Errorf("数据库中扫描间隔 = %d, want 10", got)
+	}
+	at, err := s.traderManager.GetTrader("scan_trader")
+	if err != nil {
+		t.Fatalf("获取交易员失败: %v", err)
+	}
+	if got := at.GetStatus()["scan_interval"]; got != "10m0s" {
+		t.Errorf("已加载交易员的扫描间隔 = %v, want 10m0s", got)
+	}
+}
+
+// TestDecisionsPagination 测试决策日志分页：无参数时返回数组，分页参数返回总数与对应页
+func TestDecisionsPagination(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	addTestTrader(t, s, "paged_trader", "paper")
+
+	at, err := s.traderManager.GetTrader("paged_trader")
+	if err != nil {
+		t.Fatalf("获取交易员失败: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := at.GetDecisionLogger().LogDecision(&logger.DecisionRecord{Success: true}); err != nil {
+			t.Fatalf("写入决策记录失败: %v", err)
+		}
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/decisions?trader_id=paged_trader"+query, nil)
+		c.Set("user_id", "user1")
+		s.handleDecisions(c)
+		return w
+	}
+	page := func(query string) (int, []int) {
+		var resp struct {
+			TotalCount int                      `json:"total_count"`
+			Records    []*logger.DecisionRecord `json:"records"`
+		}
+		if err := json.Unmarshal(get(query).Body.Bytes(), &resp); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		var cycles []int
+		for _, r := range resp.Records {
+			cycles = append(cycles, r.CycleNumber)
+		}
+		return resp.TotalCount, cycles
+	}
+
+	// 无参数：保持数组响应
+	w := get("")
+	var all []*logger.DecisionRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil || len(all) != 5 || w.Header().Get("X-Total-Count") != "5" {
+		t.Fatalf("无参数时应返回全部5条数组, got %d 条, err=%v", len(all), err)
+	}
+
+	if total, cycles := page("&limit=2"); total != 5 || fmt.Sprint(cycles) != "[4 5]" {
+		t.Errorf("第一页 total=%d cycles=%v, want 5 [4 5]", total, cycles)
+	}
+	if _, cycles := page("&limit=2&offset=4"); fmt.Sprint(cycles) != "[1]" {
+		t.Errorf("最后一页 cycles=%v, want [1]", cycles)
+	}
+	if total, cycles := page("&limit=2&offset=10"); total != 5 || len(cycles) != 0 {
+		t.Errorf("超出末尾应返回空页, total=%d cycles=%v", total, cycles)
+	}
+}
+
+func TestDailyPnLHandler(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	addTestTrader(t, s, "pnl_trader", "paper")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/pnl-daily?trader_id=pnl_trader"+query, nil)
+		c.Set("user_id", "user1")
+		s.handleDailyPnL(c)
+		return w
+	}
+
+	w := get("&days=7&tz=Asia/Shanghai")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Timezone string            `json:"timezone"`
+		Days     []logger.DailyPnL `json:"days"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Timezone != "Asia/Shanghai" || len(resp.Days) != 7 {
+		t.Errorf("timezone=%s days=%d, want Asia/Shanghai 7", resp.Timezone, len(resp.Days))
+	}
+
+	if w := get("&tz=Mars/Base"); w.Code != http.StatusBadRequest {
+		t.Errorf("无效时区应返回400, got %d", w.Code)
+	}
+}
+
+// TestUpdateTraderMode 测试更新交易模式：校验取值，未指定时保持原值
+func TestUpdateTraderMode(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	if err := s.database.CreateTrader(&config.TraderRecord{
+		ID: "mode_trader", UserID: "user1", Name: "mode_trader",
+		AIModelID: "deepseek", ExchangeID: "binance", ScanIntervalMinutes: 3,
+	}); err != nil {
+		t.Fatalf("创建交易员记录失败: %v", err)
+	}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/traders/mode_trader", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: "mode_trader"}}
+		c.Set("user_id", "user1")
+		s.handleUpdateTrader(c)
+		return w
+	}
+	storedMode := func() string {
+		traders, err := s.database.GetTraders("user1")
+		if err != nil || len(traders) != 1 {
+			t.Fatalf("读取交易员失败: %v", err)
+		}
+		return traders[0].TraderMode
+	}
+	const base = `"name":"mode_trader","ai_model_id":"deepseek","exchange_id":"binance"`
+
+	if got := storedMode(); got != "binance" {
+		t.Errorf("默认交易模式 = %s, want binance", got)
+	}
+	if w := update(`{` + base + `,"trader_mode":"dry"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("无效的交易模式应返回400，实际 %d", w.Code)
+	}
+	if w := update(`{` + base + `,"trader_mode":"shadow"}`); w.Code != http.StatusOK {
+		t.Fatalf("更新交易模式失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedMode(); got != "shadow" {
+		t.Errorf("数据库中交易模式 = %s, want shadow", got)
+	}
+	if w := update(`{` + base + `}`); w.Code != http.StatusOK {
+		t.Fatalf("未指定交易模式时更新失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedMode(); got != "shadow" {
+		t.Errorf("未指定时应保持原值 shadow，实际 %s", got)
+	}
+}
+
+// TestUpdateTraderOpeningOrderType 测试更新开仓订单类型：校验取值，未指定时保持原值
+func TestUpdateTraderOpeningOrderType(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	if err := s.database.CreateTrader(&config.TraderRecord{
+		ID: "order_type_trader", UserID: "user1", Name: "order_type_trader",
+		AIModelID: "deepseek", ExchangeID: "binance", ScanIntervalMinutes: 3,
+	}); err != nil {
+		t.Fatalf("创建交易员记录失败: %v", err)
+	}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/traders/order_type_trader", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: "order_type_trader"}}
+		c.Set("user_id", "user1")
+		s.handleUpdateTrader(c)
+		return w
+	}
+	storedType := func() string {
+		traders, err := s.database.GetTraders("user1")
+		if err != nil || len(traders) != 1 {
+			t.Fatalf("读取交易员失败: %v", err)
+		}
+		return traders[0].OpeningOrderType
+	}
+	const base = `"name":"order_type_trader","ai_model_id":"deepseek","exchange_id":"binance"`
+
+	if got := storedType(); got != "" {
+		t.Errorf("默认开仓订单类型应为空（跟随全局），实际 %s", got)
+	}
+	if w := update(`{` + base + `,"opening_order_type":"maker"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("无效的开仓订单类型应返回400，实际 %d", w.Code)
+	}
+	if w := update(`{` + base + `,"opening_order_type":"limit_maker"}`); w.Code != http.StatusOK {
+		t.Fatalf("更新开仓订单类型失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedType(); got != "limit_maker" {
+		t.Errorf("数据库中开仓订单类型 = %s, want limit_maker", got)
+	}
+	if w := update(`{` + base + `}`); w.Code != http.StatusOK {
+		t.Fatalf("未指定开仓订单类型时更新失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedType(); got != "limit_maker" {
+		t.Errorf("未指定时应保持原值 limit_maker，实际 %s", got)
+	}
+}
+
+// TestUpdateTraderDailySummaryTime 测试更新每日汇总时间：校验 HH:MM 格式，未指定时保持原值
+func TestUpdateTraderDailySummaryTime(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	if err := s.database.CreateTrader(&config.TraderRecord{
+		ID: "summary_trader", UserID: "user1", Name: "summary_trader",
+		AIModelID: "deepseek", ExchangeID: "binance", ScanIntervalMinutes: 3,
+	}); err != nil {
+		t.Fatalf("创建交易员记录失败: %v", err)
+	}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/traders/summary_trader", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: "summary_trader"}}
+		c.Set("user_id", "user1")
+		s.handleUpdateTrader(c)
+		return w
+	}
+	storedTime := func() string {
+		traders, err := s.database.GetTraders("user1")
+		if err != nil || len(traders) != 1 {
+			t.Fatalf("读取交易员失败: %v", err)
+		}
+		return traders[0].DailySummaryTime
+	}
+	const base = `"name":"summary_trader","ai_model_id":"deepseek","exchange_id":"binance"`
+
+	if w := update(`{` + base + `,"daily_summary_time":"25:00"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("无效的汇总时间应返回400，实际 %d", w.Code)
+	}
+	if w := update(`{` + base + `,"daily_summary_time":"23:30"}`); w.Code != http.StatusOK {
+		t.Fatalf("更新汇总时间失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedTime(); got != "23:30" {
+		t.Errorf("数据库中汇总时间 = %s, want 23:30", got)
+	}
+	if w := update(`{` + base + `}`); w.Code != http.StatusOK {
+		t.Fatalf("未指定汇总时间时更新失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedTime(); got != "23:30" {
+		t.Errorf("未指定时应保持原值 23:30，实际 %s", got)
+	}
+}
+
+// TestUpdateTraderAnalysisTimeframes 测试更新分析周期：未指定时保持原值，显式传空串恢复默认
+func TestUpdateTraderAnalysisTimeframes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	if err := s.database.CreateTrader(&config.TraderRecord{
+		ID: "tf_trader", UserID: "user1", Name: "tf_trader",
+		AIModelID: "deepseek", ExchangeID: "binance", ScanIntervalMinutes: 3,
+		AnalysisTimeframes: "1h,4h",
+	}); err != nil {
+		t.Fatalf("创建交易员记录失败: %v", err)
+	}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/traders/tf_trader", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: "tf_trader"}}
+		c.Set("user_id", "user1")
+		s.handleUpdateTrader(c)
+		return w
+	}
+	storedTimeframes := func() string {
+		traders, err := s.database.GetTraders("user1")
+		if err != nil || len(traders) != 1 {
+			t.Fatalf("读取交易员失败: %v", err)
+		}
+		return traders[0].AnalysisTimeframes
+	}
+	const base = `"name":"tf_trader","ai_model_id":"deepseek","exchange_id":"binance"`
+
+	if w := update(`{` + base + `}`); w.Code != http.StatusOK {
+		t.Fatalf("未指定分析周期时更新失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedTimeframes(); got != "1h,4h" {
+		t.Errorf("未指定时应保持原值 1h,4h，实际 %q", got)
+	}
+	if w := update(`{` + base + `,"analysis_timeframes":"7x"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("无效的分析周期应返回400，实际 %d", w.Code)
+	}
+	if w := update(`{` + base + `,"analysis_timeframes":""}`); w.Code != http.StatusOK {
+		t.Fatalf("清空分析周期失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedTimeframes(); got != "" {
+		t.Errorf("显式传空串应恢复默认，实际 %q", got)
+	}
+}
+
+// TestUpdateTraderIndicatorRules 测试更新指标阈值规则：未指定时保持原值，显式传空列表清除
+func TestUpdateTraderIndicatorRules(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	if err := s.database.CreateTrader(&config.TraderRecord{
+		ID: "rules_trader", UserID: "user1", Name: "rules_trader",
+		AIModelID: "deepseek", ExchangeID: "binance", ScanIntervalMinutes: 3,
+	}); err != nil {
+		t.Fatalf("创建交易员记录失败: %v", err)
+	}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/traders/rules_trader", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "id", Value: "rules_trader"}}
+		c.Set("user_id", "user1")
+		s.handleUpdateTrader(c)
+		return w
+	}
+	storedRules := func() string {
+		traders, err := s.database.GetTraders("user1")
+		if err != nil || len(traders) != 1 {
+			t.Fatalf("读取交易员失败: %v", err)
+		}
+		return traders[0].IndicatorRules
+	}
+	const base = `"name":"rules_trader","ai_model_id":"deepseek","exchange_id":"binance"`
+
+	if w := update(`{` + base + `,"indicator_rules":[{"side":"long","timeframe":"1h","indicator":"rsi7","operator":"<","value":70}]}`); w.Code != http.StatusOK {
+		t.Fatalf("设置指标规则失败: %d %s", w.Code, w.Body.String())
+	}
+	rules := storedRules()
+	if !strings.Contains(rules, `"rsi7"`) {
+		t.Fatalf("数据库中应保存指标规则，实际 %q", rules)
+	}
+	if w := update(`{` + base + `}`); w.Code != http.StatusOK {
+		t.Fatalf("未指定指标规则时更新失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedRules(); got != rules {
+		t.Errorf("未指定时应保持原规则 %q，实际 %q", rules, got)
+	}
+	if w := update(`{` + base + `,"indicator_rules":[]}`); w.Code != http.StatusOK {
+		t.Fatalf("清除指标规则失败: %d %s", w.Code, w.Body.String())
+	}
+	if got := storedRules(); got != "" {
+		t.Errorf("显式传空列表应清除规则，实际 %q", got)
+	}
+}
+
+// TestDecisionsPromptRedaction 测试提示词脱敏：非管理员看不到提示词，管理员和决策日志仍保留完整内容
+func TestDecisionsPromptRedaction(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := newTestServer(t)
+	for id, level := range map[string]string{"redact_trader": "redact", "omit_trader": "omit", "plain_trader": ""} {
+		if err := s.database.CreateTrader(&config.TraderRecord{
+			ID: id, UserID: "user1", Name: id, AIModelID: "deepseek", ExchangeID: "binance", PromptRedaction: level,
+		}); err != nil {
+			t.Fatalf("创建交易员记录失败: %v", err)
+		}
+		addTestTrader(t, s, id, "paper")
+		at, err := s.traderManager.GetTrader(id)
+		if err != nil {
+			t.Fatalf("获取交易员失败: %v", err)
+		}
+		if err := at.GetDecisionLogger().LogDecision(&logger.DecisionRecord{
+			SystemPrompt: "secret system", InputPrompt: "secret input", CoTTrace: "思维链", DecisionJSON: "[]", Success: true,
+		}); err != nil {
+			t.Fatalf("写入决策记录失败: %v", err)
+		}
+	}
+
+	get := func(handler func(*gin.Context), traderID, userID string) map[string]interface{} {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/decisions?trader_id="+traderID, nil)
+		c.Set("user_id", userID)
+		handler(c)
+		var records []map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil || len(records) != 1 {
+			t.Fatalf("解析决策记录失败: %v %s", err, w.Body.String())
+		}
+		return records[0]
+	}
+
+	for _, handler := range []func(*gin.Context){s.handleDecisions, s.handleLatestDecisions} {
+		record := get(handler, "redact_trader", "user1")
+		if record["system_prompt"] != "[redacted]" || record["input_prompt"] != "[redacted]" {
+			t.Errorf("redact 级别应替换提示词，实际 system=%v input=%v", record["system_prompt"], record["input_prompt"])
+		}
+		if record["cot_trace"] != "思维链" || record["decision_json"] != "[]" {
+			t.Errorf("脱敏不应影响决策与思维链: %v", record)
+		}
+
+		record = get(handler, "omit_trader", "user1")
+		if _, ok := record["system_prompt"]; ok {
+			t.Errorf("omit 级别不应返回 system_prompt: %v", record)
+		}
+		if _, ok := record["input_prompt"]; ok {
+			t.Errorf("omit 级别不应返回 input_prompt: %v", record)
+		}
+
+		if record := get(handler, "plain_trader", "user1"); record["input_prompt"] != "secret input" {
+			t.Errorf("未配置脱敏时应返回完整提示词，实际 %v", record["input_prompt"])
+		}
+		if record := get(handler, "redact_trader", "admin"); record["system_prompt"] != "secret system" {
+			t.Errorf("管理员应看到完整提示词，实际 %v", record["system_prompt"])
+		}
+	}
+
+	// 决策日志中仍完整保存
+	at, _ := s.traderManager.GetTrader("omit_trader")
+	stored, err := at.GetDecisionLogger().GetLatestRecords(1)
+	if err != nil || len(stored) != 1 || stored[0].InputPrompt != "secret input" {
+		t.Errorf("决策日志应保留完整提示词: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/traders/plain_trader",
+		strings.NewReader(`{"name":"plain_trader","ai_model_id":"deepseek","exchange_id":"binance","prompt_redaction":"hide"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: "plain_trader"}}
+	c.Set("user_id", "user1")
+	s.handleUpdateTrader(c)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("无效的脱敏级别应返回400，实际 %d", w.Code)
+	}
+}
@@ -1,10 +1,13 @@
 package backtest
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"nofx/decision"
 	"nofx/market"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -39,18 +42,87 @@ type JobStatus struct {
 	Params       Params     `json:"params"`
 	TotalCycles  int        `json:"total_cycles"`
 	CurrentCycle int        `json:"current_cycle"`
-	Status       string     `json:"status"` // pending/running/completed/failed
+	Status       string     `json:"status"` // pending/running/completed/failed/cancelled
 	Error        string     `json:"error,omitempty"`
 	Result       *Result    `json:"result,omitempty"`
 	StartedAt    time.Time  `json:"started_at"`
 	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// JobSummary 任务列表中的简要信息（不含回测结果）
+type JobSummary struct {
+	ID           string     `json:"id"`
+	Symbols      []string   `json:"symbols"`
+	Status       string     `json:"status"`
+	Error        string     `json:"error,omitempty"`
+	TotalCycles  int        `json:"total_cycles"`
+	CurrentCycle int        `json:"current_cycle"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
 }
 
+var (
+	// ErrJobNotFound 任务不存在（或已被清理）
+	ErrJobNotFound = errors.New("backtest job not found")
+	// ErrJobFinished 任务已结束，无法取消
+	ErrJobFinished = errors.New("backtest job already finished")
+)
+
 var (
 	jobStore   = make(map[string]*JobStatus)
 	jobStoreMu sync.RWMutex
+
+	// 已结束任务的保留策略：超过 jobMaxAge 的清理；总数超过 jobMaxCount 时从最早结束的开始清理
+	jobMaxAge   = 24 * time.Hour
+	jobMaxCount = 50
 )
 
+// SetJobRetention 设置已结束任务的保留策略，maxAge<=0 或 maxJobs<=0 表示不按该维度清理。
+// 运行中/排队中的任务不会被清理
+func SetJobRetention(maxAge time.Duration, maxJobs int) {
+	jobStoreMu.Lock()
+	defer jobStoreMu.Unlock()
+	jobMaxAge = maxAge
+	jobMaxCount = maxJobs
+	evictJobsLocked(time.Now())
+}
+
+// isFinished 任务是否已结束（完成/失败/取消）
+func (j *JobStatus) isFinished() bool {
+	return j.FinishedAt != nil
+}
+
+// evictJobsLocked 按保留策略清理已结束的任务，调用方需持有 jobStoreMu 写锁
+func evictJobsLocked(now time.Time) {
+	var finished []*JobStatus
+	for id, job := range jobStore {
+		if !job.isFinished() {
+			continue
+		}
+		if jobMaxAge > 0 && now.Sub(*job.FinishedAt) > jobMaxAge {
+			delete(jobStore, id)
+			continue
+		}
+		finished = append(finished, job)
+	}
+
+	if jobMaxCount <= 0 || len(jobStore) <= jobMaxCount {
+		return
+	}
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].FinishedAt.Before(*finished[k].FinishedAt)
+	})
+	for _, job := range finished {
+		if len(jobStore) <= jobMaxCount {
+			break
+		}
+		delete(jobStore, job.ID)
+	}
+}
+
 // NewJob 创建一个新的回测任务并保存到内存
 func NewJob(p Params) *JobStatus {
 	id := fmt.Sprintf("bt_%d", time.Now().UnixNano())
@@ -62,6 +134,7 @@ func NewJob(p Params) *JobStatus {
 		total = int(dur/p.ScanInterval) + 1
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	job := &JobStatus{
 		ID:           id,
 		Params:       p,
@@ -69,9 +142,12 @@ func NewJob(p Params) *JobStatus {
 		CurrentCycle: 0,
 		Status:       "pending",
 		StartedAt:    time.Now(),
+		ctx:          ctx,
+		cancel:       cancel,
 	}
 
 	jobStoreMu.Lock()
+	evictJobsLocked(time.Now())
 	jobStore[id] = job
 	jobStoreMu.Unlock()
 
@@ -86,6 +162,52 @@ func GetJob(id string) (*JobStatus, bool) {
 	return job, ok
 }
 
+// ListJobs 返回所有任务的摘要（按开始时间倒序），列出前先按保留策略清理
+func ListJobs() []JobSummary {
+	jobStoreMu.Lock()
+	defer jobStoreMu.Unlock()
+	evictJobsLocked(time.Now())
+
+	summaries := make([]JobSummary, 0, len(jobStore))
+	for _, job := range jobStore {
+		summaries = append(summaries, JobSummary{
+			ID:           job.ID,
+			Symbols:      job.Params.Symbols,
+			Status:       job.Status,
+			Error:        job.Error,
+			TotalCycles:  job.TotalCycles,
+			CurrentCycle: job.CurrentCycle,
+			StartedAt:    job.StartedAt,
+			FinishedAt:   job.FinishedAt,
+		})
+	}
+	sort.Slice(summaries, func(i, k int) bool {
+		return summaries[i].StartedAt.After(summaries[k].StartedAt)
+	})
+	return summaries
+}
+
+// CancelJob 取消一个排队中/运行中的任务：通知扫描循环停止，并立即标记为 cancelled。
+// 扫描循环在周期之间检查取消信号，最多再跑完当前周期
+func CancelJob(id string) error {
+	jobStoreMu.Lock()
+	defer jobStoreMu.Unlock()
+	job, ok := jobStore[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if job.isFinished() {
+		return ErrJobFinished
+	}
+	if job.cancel != nil {
+		job.cancel()
+	}
+	job.Status = "cancelled"
+	now := time.Now()
+	job.FinishedAt = &now
+	return nil
+}
+
 // StartJob 创建并异步启动一个回测任务
 func StartJob(p Params) *JobStatus {
 	job := NewJob(p)
@@ -125,12 +247,22 @@ func (oa *OfflineAnalyzer) Run() (*Result, error) {
 
 // RunWithJob 在异步任务中执行回测，并实时更新 JobStatus（用于前端进度显示）
 func (oa *OfflineAnalyzer) RunWithJob(job *JobStatus) {
+	ctx := job.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	jobStoreMu.Lock()
+	if job.Status == "cancelled" {
+		// 启动前已被取消
+		jobStoreMu.Unlock()
+		return
+	}
 	job.Status = "running"
 	job.CurrentCycle = 0
 	jobStoreMu.Unlock()
 
-	result, err := oa.RunWithProgress(func(cycle int) {
+	result, err := oa.RunWithContext(ctx, func(cycle int) {
 		jobStoreMu.Lock()
 		job.CurrentCycle = cycle
 		jobStoreMu.Unlock()
@@ -138,6 +270,10 @@ func (oa *OfflineAnalyzer) RunWithJob(job *JobStatus) {
 
 	jobStoreMu.Lock()
 	defer jobStoreMu.Unlock()
+	if job.Status == "cancelled" {
+		// CancelJob 已记录取消状态和结束时间
+		return
+	}
 	if err != nil {
 		job.Status = "failed"
 		job.Error = err.Error()
@@ -153,6 +289,11 @@ func (oa *OfflineAnalyzer) RunWithJob(job *JobStatus) {
 
 // RunWithProgress 是 Run 的内部版本，允许传入一个回调在每个周期更新进度
 func (oa *OfflineAnalyzer) RunWithProgress(onCycle func(cycle int)) (*Result, error) {
+	return oa.RunWithContext(context.Background(), onCycle)
+}
+
+// RunWithContext 同 RunWithProgress，每个周期开始前检查 ctx，取消后停止扫描并返回 ctx 的错误
+func (oa *OfflineAnalyzer) RunWithContext(ctx context.Context, onCycle func(cycle int)) (*Result, error) {
 	log.Printf("🚀 开始规则层回测，时间范围: %s ~ %s，币种: %v，周期: %v",
 		oa.params.StartTime.Format("2006-01-02 15:04:05"),
 		oa.params.EndTime.Format("2006-01-02 15:04:05"),
@@ -172,6 +313,10 @@ func (oa *OfflineAnalyzer) RunWithProgress(onCycle func(cycle int)) (*Result, er
 	var pending []decision.PendingOrderInfo
 
 	for !current.After(oa.params.EndTime) {
+		if err := ctx.Err(); err != nil {
+			log.Printf("⏹️  回测在周期 #%d 前被取消", cycle+1)
+			return nil, err
+		}
 		cycle++
 		if onCycle != nil {
 			onCycle(cycle)
@@ -181,7 +326,7 @@ func (oa *OfflineAnalyzer) RunWithProgress(onCycle func(cycle int)) (*Result, er
 		}
 
 		for _, symbol := range oa.params.Symbols {
-			data, err := market.Get(symbol)
+			data, err := market.GetAt(symbol, current)
 			if err != nil || data == nil {
 				log.Printf("⚠️ 获取 %s 市场数据失败: %v", symbol, err)
 				continue
@@ -0,0 +1,123 @@
+package backtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// resetJobStore 清空任务表并恢复默认保留策略
+func resetJobStore(t *testing.T) {
+	t.Helper()
+	jobStoreMu.Lock()
+	jobStore = make(map[string]*JobStatus)
+	jobStoreMu.Unlock()
+	t.Cleanup(func() {
+		jobStoreMu.Lock()
+		jobStore = make(map[string]*JobStatus)
+		jobMaxAge = 24 * time.Hour
+		jobMaxCount = 50
+		jobStoreMu.Unlock()
+	})
+}
+
+func testParams() Params {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return Params{
+		Symbols:      []string{"BTCUSDT"},
+		StartTime:    start,
+		EndTime:      start.Add(time.Hour),
+		ScanInterval: 3 * time.Minute,
+	}
+}
+
+// finishJob 将任务标记为在 at 时刻完成
+func finishJob(job *JobStatus, at time.Time) {
+	jobStoreMu.Lock()
+	job.Status = "completed"
+	job.FinishedAt = &at
+	jobStoreMu.Unlock()
+}
+
+func TestCancelJob(t *testing.T) {
+	resetJobStore(t)
+
+	job := NewJob(testParams())
+	if err := CancelJob(job.ID); err != nil {
+		t.Fatalf("CancelJob: %v", err)
+	}
+	if job.Status != "cancelled" || job.FinishedAt == nil {
+		t.Fatalf("status=%s finished=%v, want cancelled with finish time", job.Status, job.FinishedAt)
+	}
+	if job.ctx.Err() == nil {
+		t.Fatal("job context should be cancelled")
+	}
+
+	// 已取消的任务启动后不应被覆盖为 running/completed，也不应访问行情
+	NewOfflineAnalyzer(job.Params).RunWithJob(job)
+	if job.Status != "cancelled" || job.CurrentCycle != 0 {
+		t.Fatalf("status=%s cycle=%d after run, want cancelled at cycle 0", job.Status, job.CurrentCycle)
+	}
+
+	if err := CancelJob(job.ID); !errors.Is(err, ErrJobFinished) {
+		t.Fatalf("cancel finished job err=%v, want ErrJobFinished", err)
+	}
+	if err := CancelJob("bt_missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("cancel missing job err=%v, want ErrJobNotFound", err)
+	}
+}
+
+func TestRunWithContextStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cycles := 0
+	result, err := NewOfflineAnalyzer(testParams()).RunWithContext(ctx, func(int) { cycles++ })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v, want context.Canceled", err)
+	}
+	if result != nil || cycles != 0 {
+		t.Fatalf("result=%v cycles=%d, want no result and no cycles", result, cycles)
+	}
+}
+
+func TestJobRetention(t *testing.T) {
+	resetJobStore(t)
+	now := time.Now()
+
+	stale := NewJob(testParams())
+	finishJob(stale, now.Add(-3*time.Hour))
+	running := NewJob(testParams())
+	running.StartedAt = now.Add(-5 * time.Hour)
+	older := NewJob(testParams())
+	finishJob(older, now.Add(-time.Hour))
+	newer := NewJob(testParams())
+	finishJob(newer, now.Add(-time.Minute))
+
+	SetJobRetention(2*time.Hour, 2)
+
+	if _, ok := GetJob(stale.ID); ok {
+		t.Error("job finished beyond max age should be evicted")
+	}
+	if _, ok := GetJob(older.ID); ok {
+		t.Error("oldest finished job beyond max count should be evicted")
+	}
+	if _, ok := GetJob(running.ID); !ok {
+		t.Error("unfinished job must never be evicted")
+	}
+	if _, ok := GetJob(newer.ID); !ok {
+		t.Error("newest finished job should be kept")
+	}
+
+	jobs := ListJobs()
+	if len(jobs) != 2 {
+		t.Fatalf("ListJobs returned %d jobs, want 2", len(jobs))
+	}
+	if jobs[0].ID != newer.ID || jobs[1].ID != running.ID {
+		t.Errorf("ListJobs order = [%s %s], want newest started first", jobs[0].ID, jobs[1].ID)
+	}
+	if jobs[1].Status != "pending" || len(jobs[1].Symbols) != 1 {
+		t.Errorf("summary = %+v, want pending job with its symbols", jobs[1])
+	}
+}
@@ -473,17 +473,58 @@ func runScenarioPartial() {
 	}
 }
 
+// runScenarioCycle 用固定的AI回复跑一个完整决策周期（行情/过滤器/纸交易由 trader.SimulateCycle 统一注入）
+func runScenarioCycle() {
+	fmt.Println("🎯 场景: 完整决策周期 (cycle)")
+
+	globalConfig := &config.Config{}
+	globalConfig.RiskManagement.ConservativeMode.MaxLeverage = 100
+
+	aiResponse := `BTC 回踩支撑，挂限价多单。
+[{"symbol":"BTCUSDT","action":"limit_open_long","leverage":50,"position_size_usd":1000,"limit_price":50000,"stop_loss":49500,"take_profit":51800,"tp1":50600,"tp2":51200,"tp3":51800,"reasoning":"grade=S score=90 回踩支撑"}]`
+
+	record, err := trader.SimulateCycle(trader.SimulationConfig{
+		Trader: trader.AutoTraderConfig{
+			ID:                       "debug-force-trade",
+			Name:                     "Debug Force Trade",
+			InitialBalance:           10000.0,
+			BTCETHLeverage:           100,
+			AltcoinLeverage:          75,
+			LimitOrderWaitSeconds:    5,
+			LimitOrderMaxRetries:     3,
+			LimitOrderPollIntervalMs: 100,
+		},
+		Global:     globalConfig,
+		AIResponse: aiResponse,
+	}, map[string]*market.Data{"BTCUSDT": createLimitOnlyMarketData()}, &trader.DeterministicBehavior{
+		Enabled:        true,
+		FillDelayMs:    10,
+		FixedFillPrice: 50000.0,
+	})
+	if err != nil {
+		log.Fatalf("❌ 决策周期执行失败: %v", err)
+	}
+
+	fmt.Printf("📋 决策记录: success=%v status=%s 净值=%.2f\n",
+		record.Success, record.Status, record.AccountState.TotalBalance)
+	for _, action := range record.Decisions {
+		fmt.Printf("   %s %s: success=%v status=%s qty=%.6f price=%.2f error=%s\n",
+			action.Symbol, action.Action, action.Success, action.Status, action.Quantity, action.Price, action.Error)
+	}
+}
+
 func main() {
-	var scenario = flag.String("scenario", "", "场景名称: filled, timeout, partial")
+	var scenario = flag.String("scenario", "", "场景名称: filled, timeout, partial, cycle")
 	flag.Parse()
 
 	if *scenario == "" {
 		fmt.Println("❌ 必须指定 --scenario 参数")
-		fmt.Println("📖 用法: go run ./cmd/debug_force_trade --scenario=filled|timeout|partial")
+		fmt.Println("📖 用法: go run ./cmd/debug_force_trade --scenario=filled|timeout|partial|cycle")
 		fmt.Println("📋 场景说明:")
 		fmt.Println("   filled: 快速成交")
 		fmt.Println("   timeout: 永不成交，触发重试耗尽")
 		fmt.Println("   partial: 部分成交后取消")
+		fmt.Println("   cycle: 固定AI回复跑完整决策周期")
 		os.Exit(1)
 	}
 
@@ -494,9 +535,11 @@ func main() {
 		runScenarioTimeout()
 	case "partial":
 		runScenarioPartial()
+	case "cycle":
+		runScenarioCycle()
 	default:
 		fmt.Printf("❌ 未知场景: %s\n", *scenario)
-		fmt.Println("📖 支持的场景: filled, timeout, partial")
+		fmt.Println("📖 支持的场景: filled, timeout, partial, cycle")
 		os.Exit(1)
 	}
 
@@ -87,6 +87,10 @@ type RiskManagementConfig struct {
 		MarginUsageLimitPct    float64 `json:"margin_usage_limit_pct"`
 		NotionalCapPct         float64 `json:"notional_cap_pct"` // 名义价值上限(%)
 	} `json:"conservative_mode"`
+
+	// 按止损距离定仓（风险平价）：开启后忽略AI给出的 position_size_usd，
+	// 按 risk_usd / 止损距离% / 杠杆 重新计算保证金
+	UseATRSizing bool `json:"use_atr_sizing"`
 }
 
 // Config 总配置
@@ -101,6 +105,14 @@ type Config struct {
 	Leverage           LeverageConfig       `json:"leverage"`             // 杠杆配置
 	ExecutionGate      ExecutionGateConfig `json:"execution_gate"`       // 执行门禁配置
 	RiskManagement     RiskManagementConfig `json:"risk_management"`     // 分层风控配置
+	OpeningOrderType   string               `json:"opening_order_type"`  // 全局开仓订单类型: "auto" 或 "limit_maker"
+	DailySummaryTime   string               `json:"daily_summary_time"`  // 每日汇总生成时间（本地时间 "HH:MM"），为空不生成
+	MinRewardRisk      float64              `json:"min_reward_risk"`     // 开仓最低盈亏比（TP3距离/止损距离），<=0 时默认1.8
+	MinTPDistancePct   float64              `json:"min_tp_distance_pct"` // 相邻TP分段最小间距（占当前价的百分比），<=0 时默认0.2
+	UserDataStream     bool                 `json:"user_data_stream"`    // 启用交易所用户数据流（websocket）推送订单成交，轮询作为兜底
+	TP3TrailATRMult    float64              `json:"tp3_trail_atr_mult"`  // 到达TP3后撤销止盈、剩余仓位按 N×ATR14(4h) 移动止损，0 表示TP3照常平仓
+	TP3TrailPct        float64              `json:"tp3_trail_pct"`       // 同上，按距标记价百分比移动止损（ATR倍数优先）
+	ZoneMergeTolerancePct float64           `json:"zone_merge_tolerance_pct"` // 支撑/压力区合并容差（占价格的百分比），<=0 时默认0.1
 }
 
 // LoadConfig 从文件加载配置
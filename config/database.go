@@ -9,6 +9,7 @@ import (
 	"log"
 	"nofx/review"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -16,7 +17,9 @@ import (
 
 // Database 配置数据库
 type Database struct {
-	db *sql.DB
+	db       *sql.DB
+	cipher   *SecretCipher // 敏感字段加密器，未配置主密钥时为nil（明文存储）
+	cipherMu sync.RWMutex  // 保护 cipher；读写敏感字段时持读锁，轮换主密钥时持写锁
 }
 
 // NewDatabase 创建配置数据库
@@ -35,6 +38,10 @@ func NewDatabase(dbPath string) (*Database, error) {
 		return nil, fmt.Errorf("初始化默认数据失败: %w", err)
 	}
 
+	if err := database.initSecretEncryption(); err != nil {
+		return nil, fmt.Errorf("初始化密钥加密失败: %w", err)
+	}
+
 	return database, nil
 }
 
@@ -87,6 +94,17 @@ func (d *Database) createTables() error {
 			UNIQUE(user_id)
 		)`,
 
+		// 用户自定义系统提示词模板表
+		`CREATE TABLE IF NOT EXISTS user_prompt_templates (
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			content TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, name),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
 		// 交易员配置表
 		`CREATE TABLE IF NOT EXISTS traders (
 			id TEXT PRIMARY KEY,
@@ -101,6 +119,8 @@ func (d *Database) createTables() error {
 			btc_eth_leverage INTEGER DEFAULT 5,
 			altcoin_leverage INTEGER DEFAULT 5,
 			trading_symbols TEXT DEFAULT '',
+			analysis_timeframes TEXT DEFAULT '',
+			indicator_rules TEXT DEFAULT '',
 			use_coin_pool BOOLEAN DEFAULT 0,
 			use_oi_top BOOLEAN DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
@@ -153,6 +173,30 @@ func (d *Database) createTables() error {
 			FOREIGN KEY (trader_id) REFERENCES traders(id) ON DELETE CASCADE
 		)`,
 
+		// 交易员运行状态表（重启后恢复调用次数/运行时长/风控暂停）
+		`CREATE TABLE IF NOT EXISTS trader_runtime_state (
+			trader_id TEXT PRIMARY KEY,
+			call_count INTEGER DEFAULT 0,
+			start_time DATETIME,
+			last_reset_time DATETIME,
+			stop_until DATETIME,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (trader_id) REFERENCES traders(id) ON DELETE CASCADE
+		)`,
+
+		// 账户净值快照表（独立于决策周期定时记录，用于收益曲线）
+		`CREATE TABLE IF NOT EXISTS equity_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			trader_id TEXT NOT NULL,
+			timestamp INTEGER NOT NULL,
+			total_equity REAL DEFAULT 0,
+			available_balance REAL DEFAULT 0,
+			margin_used REAL DEFAULT 0,
+			position_count INTEGER DEFAULT 0,
+			FOREIGN KEY (trader_id) REFERENCES traders(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_equity_snapshots_trader_time ON equity_snapshots(trader_id, timestamp)`,
+
 		// 触发器：自动更新 updated_at
 		`CREATE TRIGGER IF NOT EXISTS update_users_updated_at
 			AFTER UPDATE ON users
@@ -214,6 +258,12 @@ func (d *Database) createTables() error {
 		`ALTER TABLE traders ADD COLUMN use_coin_pool BOOLEAN DEFAULT 0`,               // 是否使用COIN POOL信号源
 		`ALTER TABLE traders ADD COLUMN use_oi_top BOOLEAN DEFAULT 0`,                  // 是否使用OI TOP信号源
 		`ALTER TABLE traders ADD COLUMN system_prompt_template TEXT DEFAULT 'default'`, // 系统提示词模板名称
+		`ALTER TABLE traders ADD COLUMN analysis_timeframes TEXT DEFAULT ''`,           // 分析周期，逗号分隔
+		`ALTER TABLE traders ADD COLUMN indicator_rules TEXT DEFAULT ''`,               // 指标阈值规则（JSON数组）
+		`ALTER TABLE traders ADD COLUMN opening_order_type TEXT DEFAULT ''`,            // 开仓订单类型，为空跟随全局配置
+		`ALTER TABLE traders ADD COLUMN daily_summary_time TEXT DEFAULT ''`,            // 每日汇总生成时间（本地时间 HH:MM），为空跟随全局配置
+		`ALTER TABLE traders ADD COLUMN prompt_redaction TEXT DEFAULT 'none'`,          // 决策记录提示词脱敏级别
+		`ALTER TABLE traders ADD COLUMN is_hedge_mode BOOLEAN DEFAULT 0`,               // 双向持仓模式，默认单向
 		`ALTER TABLE ai_models ADD COLUMN custom_api_url TEXT DEFAULT ''`,              // 自定义API地址
 		`ALTER TABLE ai_models ADD COLUMN custom_model_name TEXT DEFAULT ''`,           // 自定义模型名称
 	}
@@ -433,19 +483,25 @@ type TraderRecord struct {
 	Name                 string    `json:"name"`
 	AIModelID            string    `json:"ai_model_id"`
 	ExchangeID           string    `json:"exchange_id"`
-	TraderMode           string    `json:"trader_mode"`            // "paper" 或 "binance"，默认 "binance"
+	TraderMode           string    `json:"trader_mode"`            // "paper"、"shadow" 或 "binance"，默认 "binance"
 	InitialBalance       float64   `json:"initial_balance"`
 	ScanIntervalMinutes  int       `json:"scan_interval_minutes"`
 	IsRunning            bool      `json:"is_running"`
 	BTCETHLeverage       int       `json:"btc_eth_leverage"`       // BTC/ETH杠杆倍数
 	AltcoinLeverage      int       `json:"altcoin_leverage"`       // 山寨币杠杆倍数
 	TradingSymbols       string    `json:"trading_symbols"`        // 交易币种，逗号分隔
+	AnalysisTimeframes   string    `json:"analysis_timeframes"`    // 分析周期，逗号分隔（如 "1h,4h"），为空使用默认5m/15m/1h/4h
+	IndicatorRules       string    `json:"indicator_rules"`        // 指标阈值规则（JSON数组），命中则拒绝开仓
 	UseCoinPool          bool      `json:"use_coin_pool"`          // 是否使用COIN POOL信号源
 	UseOITop             bool      `json:"use_oi_top"`             // 是否使用OI TOP信号源
 	CustomPrompt         string    `json:"custom_prompt"`          // 自定义交易策略prompt
 	OverrideBasePrompt   bool      `json:"override_base_prompt"`   // 是否覆盖基础prompt
 	SystemPromptTemplate string    `json:"system_prompt_template"` // 系统提示词模板名称
 	IsCrossMargin        bool      `json:"is_cross_margin"`        // 是否为全仓模式（true=全仓，false=逐仓）
+	IsHedgeMode          bool      `json:"is_hedge_mode"`          // 是否为双向持仓模式（同币种可同时持有多空）
+	OpeningOrderType     string    `json:"opening_order_type"`     // 开仓订单类型: ""(跟随全局)/"auto"/"limit_maker"
+	DailySummaryTime     string    `json:"daily_summary_time"`     // 每日汇总生成时间（本地时间 "HH:MM"），为空跟随全局配置
+	PromptRedaction      string    `json:"prompt_redaction"`       // 非管理员查看决策记录时的提示词脱敏: "none"(默认)/"redact"/"omit"
 	CreatedAt            time.Time `json:"created_at"`
 	UpdatedAt            time.Time `json:"updated_at"`
 }
@@ -460,6 +516,15 @@ type UserSignalSource struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// UserPromptTemplate 用户自定义系统提示词模板
+type UserPromptTemplate struct {
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // CloseReviewSummary 存储在数据库中的close review概要
 type CloseReviewSummary struct {
 	TradeID                   string                         `json:"trade_id"`
@@ -484,6 +549,26 @@ type CloseReviewSummary struct {
 	CreatedAt                 time.Time                      `json:"created_at"`
 }
 
+// TraderRuntimeState 交易员运行状态（跨重启保留）
+type TraderRuntimeState struct {
+	TraderID      string    `json:"trader_id"`
+	CallCount     int       `json:"call_count"`
+	StartTime     time.Time `json:"start_time"`
+	LastResetTime time.Time `json:"last_reset_time"`
+	StopUntil     time.Time `json:"stop_until"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// EquitySnapshot 账户净值快照
+type EquitySnapshot struct {
+	TraderID         string    `json:"trader_id"`
+	Timestamp        time.Time `json:"timestamp"`
+	TotalEquity      float64   `json:"total_equity"`
+	AvailableBalance float64   `json:"available_balance"`
+	MarginUsed       float64   `json:"margin_used"`
+	PositionCount    int       `json:"position_count"`
+}
+
 // GenerateOTPSecret 生成OTP密钥
 func GenerateOTPSecret() (string, error) {
 	secret := make([]byte, 20)
@@ -588,6 +673,8 @@ func (d *Database) UpdateUserOTPVerified(userID string, verified bool) error {
 
 // GetAIModels 获取用户的AI模型配置
 func (d *Database) GetAIModels(userID string) ([]*AIModelConfig, error) {
+	d.cipherMu.RLock()
+	defer d.cipherMu.RUnlock()
 	rows, err := d.db.Query(`
 		SELECT id, user_id, name, provider, enabled, api_key,
 		       COALESCE(custom_api_url, '') as custom_api_url,
@@ -612,6 +699,9 @@ func (d *Database) GetAIModels(userID string) ([]*AIModelConfig, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := d.decryptSecrets(&model.APIKey); err != nil {
+			return nil, err
+		}
 		models = append(models, &model)
 	}
 
@@ -620,9 +710,16 @@ func (d *Database) GetAIModels(userID string) ([]*AIModelConfig, error) {
 
 // UpdateAIModel 更新AI模型配置，如果不存在则创建用户特定配置
 func (d *Database) UpdateAIModel(userID, id string, enabled bool, apiKey, customAPIURL, customModelName string) error {
+	d.cipherMu.RLock()
+	defer d.cipherMu.RUnlock()
+	apiKey, err := d.encryptSecret(apiKey)
+	if err != nil {
+		return err
+	}
+
 	// 先尝试精确匹配 ID（新版逻辑，支持多个相同 provider 的模型）
 	var existingID string
-	err := d.db.QueryRow(`
+	err = d.db.QueryRow(`
 		SELECT id FROM ai_models WHERE user_id = ? AND id = ? LIMIT 1
 	`, userID, id).Scan(&existingID)
 
@@ -701,6 +798,8 @@ func (d *Database) UpdateAIModel(userID, id string, enabled bool, apiKey, custom
 
 // GetExchanges 获取用户的交易所配置
 func (d *Database) GetExchanges(userID string) ([]*ExchangeConfig, error) {
+	d.cipherMu.RLock()
+	defer d.cipherMu.RUnlock()
 	rows, err := d.db.Query(`
 		SELECT id, user_id, name, type, enabled, api_key, secret_key, testnet, 
 		       COALESCE(hyperliquid_wallet_addr, '') as hyperliquid_wallet_addr,
@@ -729,6 +828,9 @@ func (d *Database) GetExchanges(userID string) ([]*ExchangeConfig, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := d.decryptSecrets(&exchange.APIKey, &exchange.SecretKey, &exchange.AsterPrivateKey); err != nil {
+			return nil, err
+		}
 		exchanges = append(exchanges, &exchange)
 	}
 
@@ -738,6 +840,13 @@ func (d *Database) GetExchanges(userID string) ([]*ExchangeConfig, error) {
 // UpdateExchange 更新交易所配置，如果不存在则创建用户特定配置
 func (d *Database) UpdateExchange(userID, id string, enabled bool, apiKey, secretKey string, testnet bool, hyperliquidWalletAddr, asterUser, asterSigner, asterPrivateKey string) error {
 	log.Printf("🔧 UpdateExchange: userID=%s, id=%s, enabled=%v", userID, id, enabled)
+
+	d.cipherMu.RLock()
+	defer d.cipherMu.RUnlock()
+
+	if err := d.encryptSecrets(&apiKey, &secretKey, &asterPrivateKey); err != nil {
+		return err
+	}
 	
 	// 首先尝试更新现有的用户配置
 	result, err := d.db.Exec(`
@@ -802,6 +911,11 @@ func (d *Database) UpdateExchange(userID, id string, enabled bool, apiKey, secre
 
 // CreateAIModel 创建AI模型配置
 func (d *Database) CreateAIModel(userID, id, name, provider string, enabled bool, apiKey, customAPIURL string) error {
+	d.cipherMu.RLock()
+	defer d.cipherMu.RUnlock()
+	if err := d.encryptSecrets(&apiKey); err != nil {
+		return err
+	}
 	_, err := d.db.Exec(`
 		INSERT OR IGNORE INTO ai_models (id, user_id, name, provider, enabled, api_key, custom_api_url) 
 		VALUES (?, ?, ?, ?, ?, ?, ?)
@@ -811,6 +925,11 @@ func (d *Database) CreateAIModel(userID, id, name, provider string, enabled bool
 
 // CreateExchange 创建交易所配置
 func (d *Database) CreateExchange(userID, id, name, typ string, enabled bool, apiKey, secretKey string, testnet bool, hyperliquidWalletAddr, asterUser, asterSigner, asterPrivateKey string) error {
+	d.cipherMu.RLock()
+	defer d.cipherMu.RUnlock()
+	if err := d.encryptSecrets(&apiKey, &secretKey, &asterPrivateKey); err != nil {
+		return err
+	}
 	_, err := d.db.Exec(`
 		INSERT OR IGNORE INTO exchanges (id, user_id, name, type, enabled, api_key, secret_key, testnet, hyperliquid_wallet_addr, aster_user, aster_signer, aster_private_key) 
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
@@ -821,9 +940,9 @@ func (d *Database) CreateExchange(userID, id, name, typ string, enabled bool, ap
 // CreateTrader 创建交易员
 func (d *Database) CreateTrader(trader *TraderRecord) error {
 	_, err := d.db.Exec(`
-		INSERT INTO traders (id, user_id, name, ai_model_id, exchange_id, initial_balance, scan_interval_minutes, is_running, btc_eth_leverage, altcoin_leverage, trading_symbols, use_coin_pool, use_oi_top, custom_prompt, override_base_prompt, system_prompt_template, is_cross_margin)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, trader.ID, trader.UserID, trader.Name, trader.AIModelID, trader.ExchangeID, trader.InitialBalance, trader.ScanIntervalMinutes, trader.IsRunning, trader.BTCETHLeverage, trader.AltcoinLeverage, trader.TradingSymbols, trader.UseCoinPool, trader.UseOITop, trader.CustomPrompt, trader.OverrideBasePrompt, trader.SystemPromptTemplate, trader.IsCrossMargin)
+		INSERT INTO traders (id, user_id, name, ai_model_id, exchange_id, initial_balance, scan_interval_minutes, is_running, btc_eth_leverage, altcoin_leverage, trading_symbols, analysis_timeframes, indicator_rules, use_coin_pool, use_oi_top, custom_prompt, override_base_prompt, system_prompt_template, is_cross_margin, trader_mode, opening_order_type, daily_summary_time, prompt_redaction, is_hedge_mode)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, trader.ID, trader.UserID, trader.Name, trader.AIModelID, trader.ExchangeID, trader.InitialBalance, trader.ScanIntervalMinutes, trader.IsRunning, trader.BTCETHLeverage, trader.AltcoinLeverage, trader.TradingSymbols, trader.AnalysisTimeframes, trader.IndicatorRules, trader.UseCoinPool, trader.UseOITop, trader.CustomPrompt, trader.OverrideBasePrompt, trader.SystemPromptTemplate, trader.IsCrossMargin, traderModeOrDefault(trader.TraderMode), trader.OpeningOrderType, trader.DailySummaryTime, promptRedactionOrDefault(trader.PromptRedaction), trader.IsHedgeMode)
 	return err
 }
 
@@ -832,11 +951,17 @@ func (d *Database) GetTraders(userID string) ([]*TraderRecord, error) {
 	rows, err := d.db.Query(`
 		SELECT id, user_id, name, ai_model_id, exchange_id, initial_balance, scan_interval_minutes, is_running,
 		       COALESCE(btc_eth_leverage, 5) as btc_eth_leverage, COALESCE(altcoin_leverage, 5) as altcoin_leverage,
-		       COALESCE(trading_symbols, '') as trading_symbols,
+		       COALESCE(trading_symbols, '') as trading_symbols, COALESCE(analysis_timeframes, '') as analysis_timeframes,
+		       COALESCE(indicator_rules, '') as indicator_rules,
 		       COALESCE(use_coin_pool, 0) as use_coin_pool, COALESCE(use_oi_top, 0) as use_oi_top,
 		       COALESCE(custom_prompt, '') as custom_prompt, COALESCE(override_base_prompt, 0) as override_base_prompt,
 		       COALESCE(system_prompt_template, 'default') as system_prompt_template,
-		       COALESCE(is_cross_margin, 1) as is_cross_margin, created_at, updated_at
+		       COALESCE(is_cross_margin, 1) as is_cross_margin, COALESCE(trader_mode, 'binance') as trader_mode,
+		       COALESCE(opening_order_type, '') as opening_order_type,
+		       COALESCE(daily_summary_time, '') as daily_summary_time,
+		       COALESCE(prompt_redaction, 'none') as prompt_redaction,
+		       COALESCE(is_hedge_mode, 0) as is_hedge_mode,
+		       created_at, updated_at
 		FROM traders WHERE user_id = ? ORDER BY created_at DESC
 	`, userID)
 	if err != nil {
@@ -850,10 +975,15 @@ func (d *Database) GetTraders(userID string) ([]*TraderRecord, error) {
 		err := rows.Scan(
 			&trader.ID, &trader.UserID, &trader.Name, &trader.AIModelID, &trader.ExchangeID,
 			&trader.InitialBalance, &trader.ScanIntervalMinutes, &trader.IsRunning,
-			&trader.BTCETHLeverage, &trader.AltcoinLeverage, &trader.TradingSymbols,
+			&trader.BTCETHLeverage, &trader.AltcoinLeverage, &trader.TradingSymbols, &trader.AnalysisTimeframes,
+			&trader.IndicatorRules,
 			&trader.UseCoinPool, &trader.UseOITop,
 			&trader.CustomPrompt, &trader.OverrideBasePrompt, &trader.SystemPromptTemplate,
-			&trader.IsCrossMargin,
+			&trader.IsCrossMargin, &trader.TraderMode,
+			&trader.OpeningOrderType,
+			&trader.DailySummaryTime,
+			&trader.PromptRedaction,
+			&trader.IsHedgeMode,
 			&trader.CreatedAt, &trader.UpdatedAt,
 		)
 		if err != nil {
@@ -877,16 +1007,43 @@ func (d *Database) UpdateTrader(trader *TraderRecord) error {
 		UPDATE traders SET
 			name = ?, ai_model_id = ?, exchange_id = ?, initial_balance = ?,
 			scan_interval_minutes = ?, btc_eth_leverage = ?, altcoin_leverage = ?,
-			trading_symbols = ?, custom_prompt = ?, override_base_prompt = ?,
-			system_prompt_template = ?, is_cross_margin = ?, updated_at = CURRENT_TIMESTAMP
+			trading_symbols = ?, analysis_timeframes = ?, indicator_rules = ?, custom_prompt = ?, override_base_prompt = ?,
+			system_prompt_template = ?, is_cross_margin = ?, trader_mode = ?, opening_order_type = ?, daily_summary_time = ?, prompt_redaction = ?, is_hedge_mode = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ? AND user_id = ?
 	`, trader.Name, trader.AIModelID, trader.ExchangeID, trader.InitialBalance,
 		trader.ScanIntervalMinutes, trader.BTCETHLeverage, trader.AltcoinLeverage,
-		trader.TradingSymbols, trader.CustomPrompt, trader.OverrideBasePrompt,
-		trader.SystemPromptTemplate, trader.IsCrossMargin, trader.ID, trader.UserID)
+		trader.TradingSymbols, trader.AnalysisTimeframes, trader.IndicatorRules, trader.CustomPrompt, trader.OverrideBasePrompt,
+		trader.SystemPromptTemplate, trader.IsCrossMargin, traderModeOrDefault(trader.TraderMode),
+		trader.OpeningOrderType, trader.DailySummaryTime, promptRedactionOrDefault(trader.PromptRedaction), trader.IsHedgeMode, trader.ID, trader.UserID)
 	return err
 }
 
+// traderModeOrDefault 交易模式为空时默认实盘（binance）
+func traderModeOrDefault(mode string) string {
+	if mode == "" {
+		return "binance"
+	}
+	return mode
+}
+
+// promptRedactionOrDefault 提示词脱敏级别为空时默认不脱敏
+func promptRedactionOrDefault(level string) string {
+	if level == "" {
+		return "none"
+	}
+	return level
+}
+
+// GetTraderPromptRedaction 获取交易员的提示词脱敏级别（按交易员ID，不限用户）
+func (d *Database) GetTraderPromptRedaction(traderID string) (string, error) {
+	var level string
+	err := d.db.QueryRow(`SELECT COALESCE(prompt_redaction, 'none') FROM traders WHERE id = ?`, traderID).Scan(&level)
+	if err != nil {
+		return "", err
+	}
+	return level, nil
+}
+
 // UpdateTraderCustomPrompt 更新交易员自定义Prompt
 func (d *Database) UpdateTraderCustomPrompt(userID, id string, customPrompt string, overrideBase bool) error {
 	_, err := d.db.Exec(`UPDATE traders SET custom_prompt = ?, override_base_prompt = ? WHERE id = ? AND user_id = ?`, customPrompt, overrideBase, id, userID)
@@ -901,6 +1058,8 @@ func (d *Database) DeleteTrader(userID, id string) error {
 
 // GetTraderConfig 获取交易员完整配置（包含AI模型和交易所信息）
 func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIModelConfig, *ExchangeConfig, error) {
+	d.cipherMu.RLock()
+	defer d.cipherMu.RUnlock()
     var trader TraderRecord
 	var aiModel AIModelConfig
 	var exchange ExchangeConfig
@@ -912,6 +1071,12 @@ func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIM
 			COALESCE(t.trading_symbols, '') as trading_symbols, COALESCE(t.use_coin_pool, 0) as use_coin_pool, 
 			COALESCE(t.use_oi_top, 0) as use_oi_top, COALESCE(t.custom_prompt, '') as custom_prompt, 
 			COALESCE(t.override_base_prompt, 0) as override_base_prompt, COALESCE(t.is_cross_margin, 1) as is_cross_margin,
+			COALESCE(t.trader_mode, 'binance') as trader_mode, COALESCE(t.analysis_timeframes, '') as analysis_timeframes,
+			COALESCE(t.indicator_rules, '') as indicator_rules,
+			COALESCE(t.opening_order_type, '') as opening_order_type,
+			COALESCE(t.daily_summary_time, '') as daily_summary_time,
+			COALESCE(t.prompt_redaction, 'none') as prompt_redaction,
+			COALESCE(t.is_hedge_mode, 0) as is_hedge_mode,
 			t.created_at, t.updated_at,
 			a.id, a.user_id, a.name, a.provider, a.enabled, a.api_key, 
 			COALESCE(a.custom_api_url, '') as custom_api_url, COALESCE(a.custom_model_name, '') as custom_model_name,
@@ -931,6 +1096,11 @@ func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIM
 		&trader.InitialBalance, &trader.ScanIntervalMinutes, &trader.IsRunning,
 		&trader.BTCETHLeverage, &trader.AltcoinLeverage, &trader.TradingSymbols, &trader.UseCoinPool, 
 		&trader.UseOITop, &trader.CustomPrompt, &trader.OverrideBasePrompt, &trader.IsCrossMargin,
+		&trader.TraderMode, &trader.AnalysisTimeframes, &trader.IndicatorRules,
+		&trader.OpeningOrderType,
+		&trader.DailySummaryTime,
+		&trader.PromptRedaction,
+		&trader.IsHedgeMode,
 		&trader.CreatedAt, &trader.UpdatedAt,
 		&aiModel.ID, &aiModel.UserID, &aiModel.Name, &aiModel.Provider, &aiModel.Enabled, &aiModel.APIKey,
 		&aiModel.CustomAPIURL, &aiModel.CustomModelName,
@@ -948,6 +1118,10 @@ func (d *Database) GetTraderConfig(userID, traderID string) (*TraderRecord, *AIM
 		return nil, nil, nil, err
 	}
 
+	if err := d.decryptSecrets(&aiModel.APIKey, &exchange.APIKey, &exchange.SecretKey, &exchange.AsterPrivateKey); err != nil {
+		return nil, nil, nil, err
+	}
+
 	return &trader, &aiModel, &exchange, nil
 }
 
@@ -1000,6 +1174,159 @@ func (d *Database) UpdateUserSignalSource(userID, coinPoolURL, oiTopURL string)
 	return err
 }
 
+// UpsertUserPromptTemplate 创建或更新用户自定义提示词模板
+func (d *Database) UpsertUserPromptTemplate(userID, name, content string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_prompt_templates (user_id, name, content)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id, name) DO UPDATE SET content = excluded.content, updated_at = CURRENT_TIMESTAMP
+	`, userID, name, content)
+	return err
+}
+
+// GetUserPromptTemplates 获取用户的所有自定义提示词模板
+func (d *Database) GetUserPromptTemplates(userID string) ([]*UserPromptTemplate, error) {
+	rows, err := d.db.Query(`
+		SELECT user_id, name, content, created_at, updated_at
+		FROM user_prompt_templates WHERE user_id = ? ORDER BY name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*UserPromptTemplate
+	for rows.Next() {
+		var tmpl UserPromptTemplate
+		if err := rows.Scan(&tmpl.UserID, &tmpl.Name, &tmpl.Content, &tmpl.CreatedAt, &tmpl.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, &tmpl)
+	}
+	return templates, rows.Err()
+}
+
+// GetAllUserPromptTemplates 获取所有用户的自定义提示词模板（启动时加载到提示词管理器）
+func (d *Database) GetAllUserPromptTemplates() ([]*UserPromptTemplate, error) {
+	rows, err := d.db.Query(`
+		SELECT user_id, name, content, created_at, updated_at
+		FROM user_prompt_templates ORDER BY user_id, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []*UserPromptTemplate
+	for rows.Next() {
+		var tmpl UserPromptTemplate
+		if err := rows.Scan(&tmpl.UserID, &tmpl.Name, &tmpl.Content, &tmpl.CreatedAt, &tmpl.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, &tmpl)
+	}
+	return templates, rows.Err()
+}
+
+// DeleteUserPromptTemplate 删除用户自定义提示词模板，模板不存在时返回 sql.ErrNoRows
+func (d *Database) DeleteUserPromptTemplate(userID, name string) error {
+	result, err := d.db.Exec(`DELETE FROM user_prompt_templates WHERE user_id = ? AND name = ?`, userID, name)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SaveTraderRuntimeState 创建或更新交易员运行状态
+func (d *Database) SaveTraderRuntimeState(state *TraderRuntimeState) error {
+	if state == nil || state.TraderID == "" {
+		return fmt.Errorf("交易员运行状态缺少trader_id")
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO trader_runtime_state (trader_id, call_count, start_time, last_reset_time, stop_until, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(trader_id) DO UPDATE SET
+			call_count = excluded.call_count,
+			start_time = excluded.start_time,
+			last_reset_time = excluded.last_reset_time,
+			stop_until = excluded.stop_until,
+			updated_at = CURRENT_TIMESTAMP
+	`, state.TraderID, state.CallCount, state.StartTime, state.LastResetTime, state.StopUntil)
+	return err
+}
+
+// GetTraderRuntimeState 获取交易员运行状态（从未保存过时返回 sql.ErrNoRows）
+func (d *Database) GetTraderRuntimeState(traderID string) (*TraderRuntimeState, error) {
+	var state TraderRuntimeState
+	err := d.db.QueryRow(`
+		SELECT trader_id, call_count, start_time, last_reset_time, stop_until, updated_at
+		FROM trader_runtime_state WHERE trader_id = ?
+	`, traderID).Scan(
+		&state.TraderID, &state.CallCount, &state.StartTime, &state.LastResetTime,
+		&state.StopUntil, &state.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// CreateEquitySnapshot 写入一条账户净值快照（时间戳按毫秒存储）
+func (d *Database) CreateEquitySnapshot(snapshot *EquitySnapshot) error {
+	if snapshot == nil || snapshot.TraderID == "" {
+		return fmt.Errorf("净值快照缺少trader_id")
+	}
+	ts := snapshot.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO equity_snapshots (trader_id, timestamp, total_equity, available_balance, margin_used, position_count)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, snapshot.TraderID, ts.UnixMilli(), snapshot.TotalEquity, snapshot.AvailableBalance,
+		snapshot.MarginUsed, snapshot.PositionCount)
+	return err
+}
+
+// ListEquitySnapshots 按时间升序获取交易员的净值快照，from/to 为零值时不限制该端
+func (d *Database) ListEquitySnapshots(traderID string, from, to time.Time) ([]*EquitySnapshot, error) {
+	query := `
+		SELECT trader_id, timestamp, total_equity, available_balance, margin_used, position_count
+		FROM equity_snapshots WHERE trader_id = ?`
+	args := []interface{}{traderID}
+	if !from.IsZero() {
+		query += ` AND timestamp >= ?`
+		args = append(args, from.UnixMilli())
+	}
+	if !to.IsZero() {
+		query += ` AND timestamp <= ?`
+		args = append(args, to.UnixMilli())
+	}
+	query += ` ORDER BY timestamp ASC`
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []*EquitySnapshot
+	for rows.Next() {
+		var snapshot EquitySnapshot
+		var tsMs int64
+		if err := rows.Scan(&snapshot.TraderID, &tsMs, &snapshot.TotalEquity, &snapshot.AvailableBalance,
+			&snapshot.MarginUsed, &snapshot.PositionCount); err != nil {
+			return nil, err
+		}
+		snapshot.Timestamp = time.UnixMilli(tsMs)
+		snapshots = append(snapshots, &snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
 // UpsertCloseReview 创建或更新close review概要
 func (d *Database) UpsertCloseReview(summary *CloseReviewSummary) error {
 	if summary == nil {
@@ -0,0 +1,317 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// MasterKeyEnv 数据库密钥加密主密钥的环境变量
+	MasterKeyEnv = "NOFX_MASTER_KEY"
+	// PreviousMasterKeyEnv 轮换主密钥时旧主密钥的环境变量（启动时自动重新加密）
+	PreviousMasterKeyEnv = "NOFX_MASTER_KEY_PREVIOUS"
+
+	// encryptedSecretPrefix 密文前缀，用于区分历史明文数据
+	encryptedSecretPrefix = "enc:v1:"
+
+	// secretSaltConfigKey 主密钥派生盐值在 system_config 中的键
+	secretSaltConfigKey = "secret_cipher_salt"
+	secretSaltSize      = 16
+
+	// scrypt 派生参数（约数十毫秒，仅在加载主密钥时执行一次）
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	secretKeyLen = 32
+)
+
+// SecretCipher 敏感字段加解密器（AES-256-GCM）
+type SecretCipher struct {
+	aead cipher.AEAD
+}
+
+// NewSecretCipher 根据主密钥创建加解密器，主密钥与盐值经scrypt派生为256位密钥
+func NewSecretCipher(masterKey string, salt []byte) (*SecretCipher, error) {
+	if masterKey == "" {
+		return nil, fmt.Errorf("主密钥不能为空")
+	}
+	if len(salt) == 0 {
+		return nil, fmt.Errorf("盐值不能为空")
+	}
+	key, err := scrypt.Key([]byte(masterKey), salt, scryptN, scryptR, scryptP, secretKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("派生密钥失败: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建AES加密器失败: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建GCM失败: %w", err)
+	}
+	return &SecretCipher{aead: aead}, nil
+}
+
+// newSecretCipherFromEnv 从环境变量读取主密钥，未配置时返回nil（明文存储）
+func newSecretCipherFromEnv(envKey string, salt []byte) (*SecretCipher, error) {
+	masterKey := strings.TrimSpace(os.Getenv(envKey))
+	if masterKey == "" {
+		return nil, nil
+	}
+	return NewSecretCipher(masterKey, salt)
+}
+
+// secretSalt 读取数据库的密钥派生盐值，不存在时随机生成并保存
+func (d *Database) secretSalt() ([]byte, error) {
+	encoded, err := d.GetSystemConfig(secretSaltConfigKey)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("读取盐值失败: %w", err)
+	}
+	if encoded != "" {
+		salt, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("解码盐值失败: %w", err)
+		}
+		return salt, nil
+	}
+
+	salt := make([]byte, secretSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("生成盐值失败: %w", err)
+	}
+	if err := d.SetSystemConfig(secretSaltConfigKey, base64.StdEncoding.EncodeToString(salt)); err != nil {
+		return nil, fmt.Errorf("保存盐值失败: %w", err)
+	}
+	return salt, nil
+}
+
+// IsEncryptedSecret 判断值是否为加密后的密文
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+// Encrypt 加密明文，空值与已加密的值原样返回
+func (c *SecretCipher) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密密文，历史明文数据原样返回
+func (c *SecretCipher) Decrypt(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("解码密文失败: %w", err)
+	}
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", fmt.Errorf("密文长度无效")
+	}
+	plaintext, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("解密失败（主密钥可能不匹配）: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// initSecretEncryption 初始化敏感字段加密：加载主密钥、轮换旧密钥、加密历史明文
+func (d *Database) initSecretEncryption() error {
+	if strings.TrimSpace(os.Getenv(MasterKeyEnv)) == "" {
+		if strings.TrimSpace(os.Getenv(PreviousMasterKeyEnv)) != "" {
+			return fmt.Errorf("设置了 %s 但未设置 %s", PreviousMasterKeyEnv, MasterKeyEnv)
+		}
+		log.Printf("⚠️  未设置 %s，API密钥将以明文存储", MasterKeyEnv)
+		return nil
+	}
+
+	salt, err := d.secretSalt()
+	if err != nil {
+		return err
+	}
+	current, err := newSecretCipherFromEnv(MasterKeyEnv, salt)
+	if err != nil {
+		return err
+	}
+	previous, err := newSecretCipherFromEnv(PreviousMasterKeyEnv, salt)
+	if err != nil {
+		return err
+	}
+
+	d.cipherMu.Lock()
+	defer d.cipherMu.Unlock()
+
+	// previous 为nil时仅加密历史明文；否则同时把旧密钥密文重新加密为新密钥
+	count, err := d.reencryptSecrets(previous, current)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Printf("🔐 已重新加密 %d 个敏感字段", count)
+	}
+	d.cipher = current
+	return nil
+}
+
+// RotateMasterKey 使用新主密钥重新加密所有敏感字段
+// 轮换期间持有写锁，读写敏感字段的操作会等待轮换完成，避免写入旧密钥的密文
+func (d *Database) RotateMasterKey(newMasterKey string) error {
+	salt, err := d.secretSalt()
+	if err != nil {
+		return err
+	}
+	next, err := NewSecretCipher(newMasterKey, salt)
+	if err != nil {
+		return err
+	}
+
+	d.cipherMu.Lock()
+	defer d.cipherMu.Unlock()
+	count, err := d.reencryptSecrets(d.cipher, next)
+	if err != nil {
+		return fmt.Errorf("主密钥轮换失败: %w", err)
+	}
+	d.cipher = next
+	log.Printf("🔐 主密钥轮换完成，重新加密 %d 个敏感字段", count)
+	return nil
+}
+
+// secretColumns 需要加密存储的敏感字段
+var secretColumns = []struct {
+	table  string
+	column string
+}{
+	{"ai_models", "api_key"},
+	{"exchanges", "api_key"},
+	{"exchanges", "secret_key"},
+	{"exchanges", "aster_private_key"},
+}
+
+// reencryptSecrets 将所有敏感字段重新加密为 to 的密文
+// 已是 to 密文的值跳过，历史明文直接加密，其余密文用 from 解密
+func (d *Database) reencryptSecrets(from, to *SecretCipher) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	count := 0
+	for _, col := range secretColumns {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT rowid, COALESCE(%s, '') FROM %s`, col.column, col.table))
+		if err != nil {
+			return 0, fmt.Errorf("读取 %s.%s 失败: %w", col.table, col.column, err)
+		}
+
+		updates := make(map[int64]string)
+		for rows.Next() {
+			var rowID int64
+			var value string
+			if err := rows.Scan(&rowID, &value); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			if value == "" {
+				continue
+			}
+
+			plaintext := value
+			if IsEncryptedSecret(value) {
+				if _, err := to.Decrypt(value); err == nil {
+					continue
+				}
+				if from == nil {
+					rows.Close()
+					return 0, fmt.Errorf("%s.%s 存在无法用当前主密钥解密的密文，请通过 %s 提供旧主密钥", col.table, col.column, PreviousMasterKeyEnv)
+				}
+				plaintext, err = from.Decrypt(value)
+				if err != nil {
+					rows.Close()
+					return 0, fmt.Errorf("解密 %s.%s 失败: %w", col.table, col.column, err)
+				}
+			}
+
+			encrypted, err := to.Encrypt(plaintext)
+			if err != nil {
+				rows.Close()
+				return 0, err
+			}
+			updates[rowID] = encrypted
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		for rowID, encrypted := range updates {
+			if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, col.table, col.column), encrypted, rowID); err != nil {
+				return 0, fmt.Errorf("更新 %s.%s 失败: %w", col.table, col.column, err)
+			}
+			count++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("提交事务失败: %w", err)
+	}
+	return count, nil
+}
+
+// encryptSecret 写入前加密敏感字段，未配置主密钥时原样返回
+// 调用方需在加密到写入数据库期间持有 cipherMu 读锁
+func (d *Database) encryptSecret(value string) (string, error) {
+	if d.cipher == nil {
+		return value, nil
+	}
+	return d.cipher.Encrypt(value)
+}
+
+// encryptSecrets 原地加密多个敏感字段
+func (d *Database) encryptSecrets(values ...*string) error {
+	for _, v := range values {
+		encrypted, err := d.encryptSecret(*v)
+		if err != nil {
+			return fmt.Errorf("加密敏感字段失败: %w", err)
+		}
+		*v = encrypted
+	}
+	return nil
+}
+
+// decryptSecrets 原地解密多个敏感字段，调用方需在查询到解密期间持有 cipherMu 读锁
+func (d *Database) decryptSecrets(values ...*string) error {
+	for _, v := range values {
+		if !IsEncryptedSecret(*v) {
+			continue
+		}
+		if d.cipher == nil {
+			return fmt.Errorf("数据库中的密钥已加密，但未设置 %s", MasterKeyEnv)
+		}
+		plaintext, err := d.cipher.Decrypt(*v)
+		if err != nil {
+			return err
+		}
+		*v = plaintext
+	}
+	return nil
+}
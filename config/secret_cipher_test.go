@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testSalt 测试用固定盐值
+var testSalt = []byte("0123456789abcdef")
+
+// openTestDatabase 使用指定主密钥打开临时数据库
+func openTestDatabase(t *testing.T, path, masterKey, previousKey string) *Database {
+	t.Helper()
+	t.Setenv(MasterKeyEnv, masterKey)
+	t.Setenv(PreviousMasterKeyEnv, previousKey)
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	return db
+}
+
+// rawColumn 直接读取数据库中存储的原始值
+func rawColumn(t *testing.T, d *Database, query string, args ...interface{}) string {
+	t.Helper()
+	var value string
+	if err := d.db.QueryRow(query, args...).Scan(&value); err != nil {
+		t.Fatalf("读取原始值失败: %v", err)
+	}
+	return value
+}
+
+// TestSecretCipherRoundTrip 测试加解密往返
+func TestSecretCipherRoundTrip(t *testing.T) {
+	c, err := NewSecretCipher("master-key-1", testSalt)
+	if err != nil {
+		t.Fatalf("创建加密器失败: %v", err)
+	}
+
+	encrypted, err := c.Encrypt("my-secret")
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	if !IsEncryptedSecret(encrypted) || strings.Contains(encrypted, "my-secret") {
+		t.Fatalf("期望密文，实际 %q", encrypted)
+	}
+	plaintext, err := c.Decrypt(encrypted)
+	if err != nil || plaintext != "my-secret" {
+		t.Fatalf("解密结果 %q, err=%v", plaintext, err)
+	}
+
+	other, _ := NewSecretCipher("master-key-2", testSalt)
+	if _, err := other.Decrypt(encrypted); err == nil {
+		t.Fatalf("错误的主密钥不应能解密")
+	}
+	otherSalt, _ := NewSecretCipher("master-key-1", []byte("fedcba9876543210"))
+	if _, err := otherSalt.Decrypt(encrypted); err == nil {
+		t.Fatalf("不同盐值派生的密钥不应能解密")
+	}
+	if _, err := NewSecretCipher("master-key-1", nil); err == nil {
+		t.Fatalf("盐值为空时应报错")
+	}
+}
+
+// TestDatabaseStoresSecretsEncrypted 测试数据库中存储的是密文且读取时透明解密
+func TestDatabaseStoresSecretsEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openTestDatabase(t, path, "master-key-1", "")
+	defer db.Close()
+
+	if err := db.UpdateAIModel("user1", "deepseek", true, "sk-model-key", "", ""); err != nil {
+		t.Fatalf("更新模型失败: %v", err)
+	}
+	if err := db.UpdateExchange("user1", "aster", true, "api-key", "secret-key", false, "", "0xuser", "0xsigner", "0xprivate"); err != nil {
+		t.Fatalf("更新交易所失败: %v", err)
+	}
+
+	storedModelKey := rawColumn(t, db, `SELECT api_key FROM ai_models WHERE user_id = ?`, "user1")
+	storedSecret := rawColumn(t, db, `SELECT secret_key FROM exchanges WHERE user_id = ? AND id = ?`, "user1", "aster")
+	storedPrivate := rawColumn(t, db, `SELECT aster_private_key FROM exchanges WHERE user_id = ? AND id = ?`, "user1", "aster")
+	for _, stored := range []string{storedModelKey, storedSecret, storedPrivate} {
+		if !IsEncryptedSecret(stored) {
+			t.Errorf("期望存储密文，实际 %q", stored)
+		}
+	}
+
+	models, err := db.GetAIModels("user1")
+	if err != nil || len(models) != 1 || models[0].APIKey != "sk-model-key" {
+		t.Fatalf("读取模型解密失败: %+v, err=%v", models, err)
+	}
+	exchanges, err := db.GetExchanges("user1")
+	if err != nil || len(exchanges) != 1 {
+		t.Fatalf("读取交易所失败: err=%v", err)
+	}
+	if exchanges[0].SecretKey != "secret-key" || exchanges[0].AsterPrivateKey != "0xprivate" {
+		t.Errorf("交易所密钥解密结果不正确: %+v", exchanges[0])
+	}
+}
+
+// TestDatabaseKeyRotation 测试历史明文加密迁移与主密钥轮换
+func TestDatabaseKeyRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// 未配置主密钥时写入明文
+	plainDB := openTestDatabase(t, path, "", "")
+	if err := plainDB.UpdateExchange("user1", "binance", true, "api-key", "secret-key", false, "", "", "", ""); err != nil {
+		t.Fatalf("更新交易所失败: %v", err)
+	}
+	if stored := rawColumn(t, plainDB, `SELECT secret_key FROM exchanges WHERE user_id = ?`, "user1"); stored != "secret-key" {
+		t.Fatalf("未配置主密钥时应存储明文，实际 %q", stored)
+	}
+	plainDB.Close()
+
+	// 配置主密钥后启动，历史明文被加密
+	db := openTestDatabase(t, path, "old-key", "")
+	stored := rawColumn(t, db, `SELECT secret_key FROM exchanges WHERE user_id = ?`, "user1")
+	if !IsEncryptedSecret(stored) {
+		t.Fatalf("启动后历史明文应被加密，实际 %q", stored)
+	}
+	db.Close()
+
+	// 通过环境变量轮换主密钥
+	db = openTestDatabase(t, path, "new-key", "old-key")
+	exchanges, err := db.GetExchanges("user1")
+	if err != nil || exchanges[0].SecretKey != "secret-key" {
+		t.Fatalf("轮换后读取失败: %+v, err=%v", exchanges, err)
+	}
+	salt, err := db.secretSalt()
+	if err != nil {
+		t.Fatalf("读取盐值失败: %v", err)
+	}
+	newCipher, _ := NewSecretCipher("new-key", salt)
+	stored = rawColumn(t, db, `SELECT secret_key FROM exchanges WHERE user_id = ?`, "user1")
+	if _, err := newCipher.Decrypt(stored); err != nil {
+		t.Fatalf("轮换后应可用新主密钥解密: %v", err)
+	}
+
+	// 运行时轮换
+	if err := db.RotateMasterKey("newer-key"); err != nil {
+		t.Fatalf("运行时轮换失败: %v", err)
+	}
+	exchanges, err = db.GetExchanges("user1")
+	if err != nil || exchanges[0].APIKey != "api-key" {
+		t.Fatalf("运行时轮换后读取失败: %+v, err=%v", exchanges, err)
+	}
+	db.Close()
+
+	// 旧主密钥无法再打开已轮换的数据库
+	t.Setenv(MasterKeyEnv, "old-key")
+	t.Setenv(PreviousMasterKeyEnv, "")
+	if _, err := NewDatabase(path); err == nil {
+		t.Fatalf("使用旧主密钥启动应失败")
+	}
+}
+
+// TestRotateMasterKeyConcurrentWrites 测试轮换主密钥时并发写入不会留下旧密钥的密文
+func TestRotateMasterKeyConcurrentWrites(t *testing.T) {
+	db := openTestDatabase(t, filepath.Join(t.TempDir(), "test.db"), "key-0", "")
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 3; i++ {
+			if err := db.RotateMasterKey(fmt.Sprintf("key-%d", i)); err != nil {
+				t.Errorf("轮换失败: %v", err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := db.UpdateExchange("user1", "binance", true, fmt.Sprintf("api-%d", i), "secret", false, "", "", "", ""); err != nil {
+			t.Fatalf("更新交易所失败: %v", err)
+		}
+	}
+	wg.Wait()
+
+	exchanges, err := db.GetExchanges("user1")
+	if err != nil || len(exchanges) != 1 || exchanges[0].APIKey != "api-19" {
+		t.Fatalf("并发轮换后读取失败: %+v, err=%v", exchanges, err)
+	}
+}
@@ -0,0 +1,98 @@
+package decision
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"nofx/config"
+	"nofx/market"
+	"nofx/mcp"
+)
+
+// splitCandidateBatches 按 batchSize 切分候选币，batchSize <= 0 时不分批
+func splitCandidateBatches(coins []CandidateCoin, batchSize int) [][]CandidateCoin {
+	if batchSize <= 0 || len(coins) <= batchSize {
+		return [][]CandidateCoin{coins}
+	}
+
+	batches := make([][]CandidateCoin, 0, (len(coins)+batchSize-1)/batchSize)
+	for start := 0; start < len(coins); start += batchSize {
+		end := start + batchSize
+		if end > len(coins) {
+			end = len(coins)
+		}
+		batches = append(batches, coins[start:end])
+	}
+	return batches
+}
+
+// batchContext 构造单批次的上下文：只保留本批候选币，以及所有持仓/挂单币种的市场数据
+func batchContext(ctx *Context, batch []CandidateCoin) *Context {
+	batchCtx := *ctx
+	batchCtx.CandidateCoins = batch
+
+	batchCtx.MarketDataMap = make(map[string]*market.Data)
+	for _, symbol := range collectAllAnalyzedSymbols(&batchCtx) {
+		if data, ok := ctx.MarketDataMap[symbol]; ok {
+			batchCtx.MarketDataMap[symbol] = data
+		}
+	}
+	return &batchCtx
+}
+
+// getBatchedDecision 分批调用AI并合并决策（同一 symbol+action 只保留首个）
+// 任一批次调用失败即返回错误；风控拦截的批次仍合并其决策，并在最后返回拦截错误
+func getBatchedDecision(ctx *Context, mcpClient *mcp.Client, customPrompt string, overrideBase bool, templateName string, streamCallback mcp.StreamCallback, config *config.Config, batches [][]CandidateCoin) (*FullDecision, error) {
+	merged := &FullDecision{Decisions: []Decision{}}
+	seen := make(map[string]bool)
+	var userPrompts, cotTraces []string
+	var rejectErr error
+
+	for i, batch := range batches {
+		batchCtx := batchContext(ctx, batch)
+		systemPrompt := buildSystemPromptWithCustom(batchCtx, customPrompt, overrideBase, templateName)
+		userPrompt := buildUserPrompt(batchCtx)
+		log.Printf("🤖 [AI调用] 分批 %d/%d: %d个候选币, 用户提示词长度: %d字符", i+1, len(batches), len(batch), len(userPrompt))
+
+		decision, err := requestDecision(batchCtx, mcpClient, systemPrompt, userPrompt, streamCallback, config)
+		if err != nil {
+			decisionErr, ok := err.(*DecisionError)
+			if !ok || decisionErr.Type != DECISION_VALIDATION_REJECTED {
+				return nil, fmt.Errorf("分批 %d/%d: %w", i+1, len(batches), err)
+			}
+			if rejectErr == nil {
+				rejectErr = err
+			}
+		}
+
+		if merged.SystemPrompt == "" {
+			merged.SystemPrompt = decision.SystemPrompt
+		}
+		userPrompts = append(userPrompts, decision.UserPrompt)
+		cotTraces = append(cotTraces, decision.CoTTrace)
+		for _, d := range decision.Decisions {
+			key := market.Normalize(d.Symbol) + "|" + d.Action
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged.Decisions = append(merged.Decisions, d)
+		}
+	}
+
+	separator := func(i int) string { return fmt.Sprintf("\n\n=== 分批 %d/%d ===\n\n", i+1, len(batches)) }
+	var userSB, cotSB strings.Builder
+	for i := range batches {
+		userSB.WriteString(separator(i))
+		userSB.WriteString(userPrompts[i])
+		cotSB.WriteString(separator(i))
+		cotSB.WriteString(cotTraces[i])
+	}
+	merged.UserPrompt = strings.TrimSpace(userSB.String())
+	merged.CoTTrace = strings.TrimSpace(cotSB.String())
+	merged.Timestamp = time.Now()
+
+	return merged, rejectErr
+}
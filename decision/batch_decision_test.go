@@ -0,0 +1,96 @@
+package decision
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"nofx/market"
+	"nofx/mcp"
+)
+
+func TestSplitCandidateBatches(t *testing.T) {
+	coins := []CandidateCoin{{Symbol: "A"}, {Symbol: "B"}, {Symbol: "C"}, {Symbol: "D"}, {Symbol: "E"}}
+
+	if got := splitCandidateBatches(coins, 0); len(got) != 1 || len(got[0]) != 5 {
+		t.Errorf("batchSize=0 不应分批, got %d 批", len(got))
+	}
+	got := splitCandidateBatches(coins, 2)
+	if len(got) != 3 || len(got[0]) != 2 || len(got[2]) != 1 || got[2][0].Symbol != "E" {
+		t.Errorf("batchSize=2 应分为 2/2/1, got %v", got)
+	}
+}
+
+func TestGetFullDecisionBatched(t *testing.T) {
+	t.Chdir(t.TempDir())
+	market.SetMarketDataProvider(&countingMarketDataProvider{fetchCount: make(map[string]int)})
+	defer market.ResetMarketDataProvider()
+
+	// 模拟 OpenAI 兼容接口：每批都对持仓 BTC 给出 hold，并对本批首个候选币给出 wait
+	var calls int32
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var req struct {
+			Messages []map[string]string `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		userPrompt := req.Messages[len(req.Messages)-1]["content"]
+		prompts = append(prompts, userPrompt)
+
+		candidate := ""
+		for _, symbol := range []string{"ETHUSDT", "BNBUSDT", "DOGEUSDT"} {
+			if strings.Contains(userPrompt, "'"+symbol+"'") {
+				candidate = symbol
+				break
+			}
+		}
+		content := fmt.Sprintf(`分析完成 [{"symbol":"BTCUSDT","action":"hold","reasoning":"持有"},{"symbol":"%s","action":"wait","reasoning":"观望"}]`, candidate)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+		})
+	}))
+	defer server.Close()
+
+	client := mcp.New()
+	client.SetCustomAPI(server.URL, "test-key", "test-model")
+	client.SetUseStream(false)
+
+	ctx := &Context{
+		Account:   AccountInfo{TotalEquity: 1000, AvailableBalance: 1000},
+		Positions: []PositionInfo{{Symbol: "BTCUSDT", Side: "long"}},
+		CandidateCoins: []CandidateCoin{
+			{Symbol: "ETHUSDT"}, {Symbol: "SOLUSDT"},
+			{Symbol: "BNBUSDT"}, {Symbol: "XRPUSDT"},
+			{Symbol: "DOGEUSDT"},
+		},
+		AnalysisBatchSize: 2,
+	}
+
+	resp, err := GetFullDecisionWithCustomPrompt(ctx, client, "system", true, "", nil)
+	if err != nil {
+		t.Fatalf("GetFullDecisionWithCustomPrompt() error = %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("5个候选币、每批2个应调用AI 3次, got %d", n)
+	}
+	if strings.Contains(prompts[0], "'BNBUSDT'") || !strings.Contains(prompts[1], "'BNBUSDT'") {
+		t.Errorf("每批提示词只应包含本批候选币")
+	}
+
+	var summary []string
+	for _, d := range resp.Decisions {
+		summary = append(summary, d.Symbol+":"+d.Action)
+	}
+	want := "BTCUSDT:hold,ETHUSDT:wait,BNBUSDT:wait,DOGEUSDT:wait"
+	if got := strings.Join(summary, ","); got != want {
+		t.Errorf("合并去重后的决策 = %s, want %s", got, want)
+	}
+	if !strings.Contains(resp.UserPrompt, "分批 3/3") {
+		t.Errorf("合并后的 UserPrompt 应包含各批次提示词")
+	}
+}
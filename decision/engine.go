@@ -1,6 +1,7 @@
 package decision
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -231,27 +233,38 @@ type OITopData struct {
 
 // Context 交易上下文
 type Context struct {
-	CurrentTime          string                       `json:"current_time"`
-	RuntimeMinutes       int                          `json:"runtime_minutes"`
-	CallCount            int                          `json:"call_count"`
-	Account              AccountInfo                  `json:"account"`
-	Positions            []PositionInfo               `json:"positions"`
-	PendingOrders        []PendingOrderInfo           `json:"pending_orders"` // 待成交限价单
-	CandidateCoins       []CandidateCoin              `json:"candidate_coins"`
-	DailyPairTrades      map[string]int               `json:"daily_pair_trades"` // 每个币种当日已开单数（市价+限价）
-	LastDecisionRecord   *logger.DecisionRecord       `json:"-"`                 // 上一轮AI决策记录
-	MarketDataMap        map[string]*market.Data      `json:"-"`
-	OITopDataMap         map[string]*OITopData        `json:"-"`
-	Performance          interface{}                  `json:"-"`
-	BTCETHLeverage       int                          `json:"-"`
-	AltcoinLeverage      int                          `json:"-"`
-	RiskManagementConfig *config.RiskManagementConfig `json:"-"` // 风险管理配置
+	CurrentTime          string                        `json:"current_time"`
+	RuntimeMinutes       int                           `json:"runtime_minutes"`
+	CallCount            int                           `json:"call_count"`
+	Account              AccountInfo                   `json:"account"`
+	Positions            []PositionInfo                `json:"positions"`
+	PendingOrders        []PendingOrderInfo            `json:"pending_orders"` // 待成交限价单
+	CandidateCoins       []CandidateCoin               `json:"candidate_coins"`
+	DailyPairTrades      map[string]int                `json:"daily_pair_trades"` // 每个币种当日已开单数（市价+限价）
+	LastDecisionRecord   *logger.DecisionRecord        `json:"-"`                 // 上一轮AI决策记录
+	MarketDataMap        map[string]*market.Data       `json:"-"`
+	OITopDataMap         map[string]*OITopData         `json:"-"`
+	Performance          interface{}                   `json:"-"`
+	BTCETHLeverage       int                           `json:"-"`
+	AltcoinLeverage      int                           `json:"-"`
+	UserID               string                        `json:"-"` // 交易员所属用户，用于解析用户自定义提示词模板
+	RiskManagementConfig *config.RiskManagementConfig  `json:"-"` // 风险管理配置
+	Timeframes           []string                      `json:"-"` // 分析周期，为空使用默认5m/15m/1h/4h
+	IndicatorRules       []IndicatorRule               `json:"-"` // 指标阈值规则，命中则拒绝开仓
+	ObserveOnlySymbols   []string                      `json:"-"` // 仅观察币种：获取行情并写入提示词作为市场参考，禁止开仓
+	CorrelationMatrix    map[string]map[string]float64 `json:"-"` // 1h收益率相关系数矩阵（由市场数据计算）
+	MarketRegime         *market.MarketRegime          `json:"-"` // 由BTC 4h数据判断的大盘状态，获取失败时为nil
+
+	MarketDataConcurrency int             `json:"-"` // 并发获取市场数据的币种数上限，<=0 时默认10
+	AnalysisBatchSize     int             `json:"-"` // 每次AI调用分析的候选币数量，<=0 时不分批
+	MaxPromptChars        int             `json:"-"` // 用户提示词字符预算，超出时按优先级裁剪行情数据，<=0 不限制
+	RequestContext        context.Context `json:"-"` // 取消信号（交易员停止时中断市场数据请求），nil 表示不可取消
 }
 
 // Decision AI的交易决策
 type Decision struct {
 	Symbol          string  `json:"symbol"`
-	Action          string  `json:"action"` // open_long, open_short, close_long, close_short, partial_close_long, partial_close_short, hold, wait, update_stop_loss, update_take_profit, cancel_limit_order
+	Action          string  `json:"action"` // open_long, open_short, close_long, close_short, partial_close_long, partial_close_short, hold, wait, update_stop_loss, update_take_profit, update_trailing_stop, cancel_limit_order
 	Leverage        int     `json:"leverage,omitempty"`
 	PositionSizeUSD float64 `json:"position_size_usd,omitempty"`
 	StopLoss        float64 `json:"stop_loss,omitempty"`
@@ -275,6 +288,8 @@ type Decision struct {
 
 	NewStopLoss       float64 `json:"new_stop_loss,omitempty"`
 	NewTakeProfit     float64 `json:"new_take_profit,omitempty"`
+	TrailingATRMult   float64 `json:"trailing_atr_mult,omitempty"` // update_trailing_stop：距标记价 N×ATR14(4h)
+	TrailingPct       float64 `json:"trailing_pct,omitempty"`      // update_trailing_stop：距标记价百分比（与 trailing_atr_mult 二选一）
 	Confidence        int     `json:"confidence,omitempty"`
 	RiskUSD           float64 `json:"risk_usd,omitempty"`
 	Reasoning         string  `json:"reasoning"`
@@ -322,20 +337,31 @@ func GetFullDecisionWithCustomPromptAndTraderID(ctx *Context, mcpClient *mcp.Cli
 		ctx.LastDecisionRecord = latestRecords[0]
 	}
 
-	systemPrompt := buildSystemPromptWithCustom(ctx, customPrompt, overrideBase, templateName)
-	userPrompt := buildUserPrompt(ctx)
-
 	// 检查是否有该 trader 的流式回调
 	var streamCallback mcp.StreamCallback
 	if traderID != "" {
 		streamCallback = GetStreamCallback(traderID)
 	}
 
+	// 候选币过多时分批调用AI，避免单次提示词超出模型上下文
+	if batches := splitCandidateBatches(ctx.CandidateCoins, ctx.AnalysisBatchSize); len(batches) > 1 {
+		return getBatchedDecision(ctx, mcpClient, customPrompt, overrideBase, templateName, streamCallback, config, batches)
+	}
+
+	systemPrompt := buildSystemPromptWithCustom(ctx, customPrompt, overrideBase, templateName)
+	userPrompt := buildUserPrompt(ctx)
+
 	log.Printf("🤖 [AI调用] 系统提示词长度: %d字符", len(systemPrompt))
 	log.Printf("🤖 [AI调用] 用户提示词长度: %d字符", len(userPrompt))
 	log.Printf("🤖 [AI调用] 系统提示词预览: %q", systemPrompt[:min(200, len(systemPrompt))])
 	log.Printf("🤖 [AI调用] 用户提示词预览: %q", userPrompt[:min(200, len(userPrompt))])
 
+	return requestDecision(ctx, mcpClient, systemPrompt, userPrompt, streamCallback, config)
+}
+
+// requestDecision 调用AI并解析决策，JSON提取失败时追加一次格式纠错调用
+// 风控拦截时返回决策及 DECISION_VALIDATION_REJECTED 错误
+func requestDecision(ctx *Context, mcpClient *mcp.Client, systemPrompt, userPrompt string, streamCallback mcp.StreamCallback, config *config.Config) (*FullDecision, error) {
 	var aiResponse string
 	var err error
 
@@ -352,7 +378,7 @@ func GetFullDecisionWithCustomPromptAndTraderID(ctx *Context, mcpClient *mcp.Cli
 	}
 
 	usedUserPrompt := userPrompt
-	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, config, ctx.MarketDataMap)
+	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, config, ctx.MarketDataMap, ctx.IndicatorRules)
 	if err != nil && errors.Is(err, errDecisionExtraction) {
 		initialErr := err
 		log.Printf("⚠️  决策 JSON 提取失败，尝试格式纠错: %v", initialErr)
@@ -364,7 +390,7 @@ func GetFullDecisionWithCustomPromptAndTraderID(ctx *Context, mcpClient *mcp.Cli
 
 		usedUserPrompt = retryPrompt
 		aiResponse = retryResponse
-		decision, err = parseFullDecisionResponse(retryResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, config, ctx.MarketDataMap)
+		decision, err = parseFullDecisionResponse(retryResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, config, ctx.MarketDataMap, ctx.IndicatorRules)
 	}
 	if err != nil {
 		// 检查是否是DecisionError
@@ -408,7 +434,7 @@ func GetFullDecisionStream(ctx *Context, mcpClient *mcp.Client, customPrompt str
 	}
 
 	usedUserPrompt := userPrompt
-	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, config, ctx.MarketDataMap)
+	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, config, ctx.MarketDataMap, ctx.IndicatorRules)
 	if err != nil && errors.Is(err, errDecisionExtraction) {
 		initialErr := err
 		log.Printf("⚠️  决策 JSON 提取失败，尝试格式纠错: %v", initialErr)
@@ -421,7 +447,7 @@ func GetFullDecisionStream(ctx *Context, mcpClient *mcp.Client, customPrompt str
 
 		usedUserPrompt = retryPrompt
 		aiResponse = retryResponse
-		decision, err = parseFullDecisionResponse(retryResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, config, ctx.MarketDataMap)
+		decision, err = parseFullDecisionResponse(retryResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, config, ctx.MarketDataMap, ctx.IndicatorRules)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("解析AI响应失败: %w", err)
@@ -437,9 +463,13 @@ func fetchMarketDataForContext(ctx *Context) error {
 	ctx.MarketDataMap = make(map[string]*market.Data)
 	ctx.OITopDataMap = make(map[string]*OITopData)
 
+	// 所有symbol统一标准化后再去重，避免同一币种因大小写/后缀不同被重复获取
 	symbolSet := make(map[string]bool)
+	positionSymbols := make(map[string]bool)
 	for _, pos := range ctx.Positions {
-		symbolSet[pos.Symbol] = true
+		symbol := market.Normalize(pos.Symbol)
+		symbolSet[symbol] = true
+		positionSymbols[symbol] = true
 	}
 
 	maxCandidates := calculateMaxCandidates(ctx)
@@ -447,22 +477,24 @@ func fetchMarketDataForContext(ctx *Context) error {
 		if i >= maxCandidates {
 			break
 		}
-		symbolSet[coin.Symbol] = true
+		symbolSet[market.Normalize(coin.Symbol)] = true
 	}
-
-	positionSymbols := make(map[string]bool)
-	for _, pos := range ctx.Positions {
-		positionSymbols[pos.Symbol] = true
+	observeOnly := make(map[string]bool)
+	for _, symbol := range ctx.ObserveOnlySymbols {
+		symbol = market.Normalize(symbol)
+		symbolSet[symbol] = true
+		observeOnly[symbol] = true
 	}
 
+	symbols := make([]string, 0, len(symbolSet))
 	for symbol := range symbolSet {
-		data, err := market.Get(symbol)
-		if err != nil {
-			continue
-		}
+		symbols = append(symbols, symbol)
+	}
+	fetched := fetchMarketDataConcurrently(ctx.RequestContext, symbols, ctx.Timeframes, ctx.MarketDataConcurrency)
 
+	for symbol, data := range fetched {
 		isExistingPosition := positionSymbols[symbol]
-		if !isExistingPosition && data.OpenInterest != nil && data.CurrentPrice > 0 {
+		if !isExistingPosition && !observeOnly[symbol] && data.OpenInterest != nil && data.CurrentPrice > 0 {
 			oiValue := data.OpenInterest.Latest * data.CurrentPrice
 			oiValueInMillions := oiValue / 1_000_000
 			if oiValueInMillions < 15 {
@@ -474,6 +506,31 @@ func fetchMarketDataForContext(ctx *Context) error {
 		ctx.MarketDataMap[symbol] = data
 	}
 
+	// 大盘状态：BTC 不在本轮分析列表中时单独获取（不写入 MarketDataMap）
+	btcData, ok := fetched["BTCUSDT"]
+	if !ok {
+		reqCtx := ctx.RequestContext
+		if reqCtx == nil {
+			reqCtx = context.Background()
+		}
+		if data, err := fetchSymbolMarketData(reqCtx, "BTCUSDT", ctx.Timeframes, &rateLimitGate{}); err == nil {
+			btcData = data
+		} else {
+			log.Printf("⚠️  获取BTC行情失败，跳过大盘状态判断: %v", err)
+		}
+	}
+	if btcData != nil {
+		regime := market.DetectMarketRegime(btcData)
+		ctx.MarketRegime = &regime
+	}
+
+	ctx.CorrelationMatrix = buildCorrelationMatrix(ctx.MarketDataMap)
+	for _, pair := range correlatedPositionPairs(ctx) {
+		if math.Abs(pair.Corr) > MaxCorrelatedExposure {
+			log.Printf("⚠️  持仓 %s 与 %s 高度相关(%.2f > %.2f)，风险敞口集中", pair.A, pair.B, pair.Corr, MaxCorrelatedExposure)
+		}
+	}
+
 	oiPositions, err := pool.GetOITopPositions()
 	if err == nil {
 		for _, pos := range oiPositions {
@@ -492,6 +549,65 @@ func fetchMarketDataForContext(ctx *Context) error {
 	return nil
 }
 
+const (
+	// MaxCorrelatedExposure 两个持仓收益率相关系数绝对值超过该值时视为同向风险敞口
+	MaxCorrelatedExposure = 0.85
+	correlationPeriod     = 48 // 相关性计算使用的1h收益率根数
+	maxCorrelationPairs   = 3  // 提示词中展示的持仓相关币种对数量
+)
+
+// correlatedPair 一对币种的相关系数
+type correlatedPair struct {
+	A, B string
+	Corr float64
+}
+
+// buildCorrelationMatrix 基于各币种1h收盘价计算相关系数矩阵
+func buildCorrelationMatrix(dataMap map[string]*market.Data) map[string]map[string]float64 {
+	symbols := make([]string, 0, len(dataMap))
+	klines := make(map[string][]market.Kline, len(dataMap))
+	for symbol, data := range dataMap {
+		if data == nil || data.MidTermSeries1h == nil {
+			continue
+		}
+		closes := data.MidTermSeries1h.MidPrices
+		series := make([]market.Kline, len(closes))
+		for i, c := range closes {
+			series[i] = market.Kline{Close: c}
+		}
+		symbols = append(symbols, symbol)
+		klines[symbol] = series
+	}
+	sort.Strings(symbols)
+	return market.CalculateCorrelationMatrix(symbols, klines, correlationPeriod)
+}
+
+// correlatedPositionPairs 当前持仓两两之间的相关系数，按绝对值从高到低排序
+func correlatedPositionPairs(ctx *Context) []correlatedPair {
+	var symbols []string
+	seen := make(map[string]bool)
+	for _, pos := range ctx.Positions {
+		symbol := market.Normalize(pos.Symbol)
+		if !seen[symbol] {
+			seen[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	var pairs []correlatedPair
+	for i := 0; i < len(symbols); i++ {
+		for j := i + 1; j < len(symbols); j++ {
+			if corr, ok := ctx.CorrelationMatrix[symbols[i]][symbols[j]]; ok {
+				pairs = append(pairs, correlatedPair{A: symbols[i], B: symbols[j], Corr: corr})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return math.Abs(pairs[i].Corr) > math.Abs(pairs[j].Corr)
+	})
+	return pairs
+}
+
 func calculateMaxCandidates(ctx *Context) int {
 	return len(ctx.CandidateCoins)
 }
@@ -501,21 +617,22 @@ func calculateMaxCandidates(ctx *Context) int {
 func collectAllAnalyzedSymbols(ctx *Context) []string {
 	symbolMap := make(map[string]bool)
 	var symbols []string
+	add := func(raw string) {
+		symbol := market.Normalize(raw)
+		if !symbolMap[symbol] {
+			symbolMap[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
 
 	// 1) 当前持仓 symbols（优先级最高）
 	for _, pos := range ctx.Positions {
-		if !symbolMap[pos.Symbol] {
-			symbolMap[pos.Symbol] = true
-			symbols = append(symbols, pos.Symbol)
-		}
+		add(pos.Symbol)
 	}
 
 	// 2) 待成交限价单 symbols
 	for _, order := range ctx.PendingOrders {
-		if !symbolMap[order.Symbol] {
-			symbolMap[order.Symbol] = true
-			symbols = append(symbols, order.Symbol)
-		}
+		add(order.Symbol)
 	}
 
 	// 3) 候选币 symbols（取前N个，与maxCandidates一致）
@@ -524,15 +641,28 @@ func collectAllAnalyzedSymbols(ctx *Context) []string {
 		if i >= maxCandidates {
 			break
 		}
-		if !symbolMap[candidate.Symbol] {
-			symbolMap[candidate.Symbol] = true
-			symbols = append(symbols, candidate.Symbol)
-		}
+		add(candidate.Symbol)
+	}
+
+	// 4) 仅观察币种（市场参考）
+	for _, symbol := range ctx.ObserveOnlySymbols {
+		add(symbol)
 	}
 
 	return symbols
 }
 
+// isObserveOnly 判断币种是否为仅观察币种
+func isObserveOnly(ctx *Context, symbol string) bool {
+	symbol = market.Normalize(symbol)
+	for _, s := range ctx.ObserveOnlySymbols {
+		if market.Normalize(s) == symbol {
+			return true
+		}
+	}
+	return false
+}
+
 func buildSystemPromptWithCustom(ctx *Context, customPrompt string, overrideBase bool, templateName string) string {
 	if overrideBase && customPrompt != "" {
 		return customPrompt
@@ -553,13 +683,20 @@ func buildSystemPromptWithCustom(ctx *Context, customPrompt string, overrideBase
 
 func buildSystemPrompt(ctx *Context, templateName string) string {
 	if templateName != "" && templateName != "default" {
-		log.Printf("⚠️  模板 '%s' 已禁用，强制使用模块化提示词", templateName)
+		// 用户自定义模板按所属用户解析后生效；内置的非默认模板仍禁用
+		if template, err := GetPromptTemplateForUser(ctx.UserID, templateName); err == nil && template.UserID != "" {
+			return buildLegacySystemPrompt(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, ctx.UserID, templateName)
+		} else if err != nil {
+			log.Printf("⚠️  用户 %s 的提示词模板 '%s' 不存在，使用模块化提示词", ctx.UserID, templateName)
+		} else {
+			log.Printf("⚠️  模板 '%s' 已禁用，强制使用模块化提示词", templateName)
+		}
 	}
 
 	modularPrompt, err := buildModularSystemPrompt(ctx)
 	if err != nil {
 		log.Printf("⚠️  构建模块化提示词失败，回退到 default 模板: %v", err)
-		return buildLegacySystemPrompt(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, "default")
+		return buildLegacySystemPrompt(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, ctx.UserID, "default")
 	}
 
 	return modularPrompt
@@ -739,14 +876,14 @@ func moduleDisplayName(moduleName string) string {
 	}
 }
 
-func buildLegacySystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int, templateName string) string {
+func buildLegacySystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int, userID, templateName string) string {
 	var sb strings.Builder
 
 	if templateName == "" {
 		templateName = "default"
 	}
 
-	template, err := GetPromptTemplate(templateName)
+	template, err := GetPromptTemplateForUser(userID, templateName)
 	if err != nil {
 		log.Printf("⚠️  提示词模板 '%s' 不存在，使用 default: %v", templateName, err)
 		template, err = GetPromptTemplate("default")
@@ -778,10 +915,11 @@ func buildLegacySystemPrompt(accountEquity float64, btcEthLeverage, altcoinLever
 	sb.WriteString("字段说明:\n")
 	sb.WriteString("- `position_size_usd`: 本笔单**实际占用的保证金**（单位 USDT，不是名义价值，不等于保证金×杠杆）。\n")
 	sb.WriteString("- 开仓时必须同时返回: tp1, tp2, tp3；且 take_profit 必须等于 tp3。\n")
-	sb.WriteString("- `action`: open_long | open_short | cancel_limit_order | close_long | close_short | partial_close_long | partial_close_short | hold | wait | update_stop_loss | update_take_profit\n")
+	sb.WriteString("- `action`: open_long | open_short | cancel_limit_order | close_long | close_short | partial_close_long | partial_close_short | hold | wait | update_stop_loss | update_take_profit | update_trailing_stop\n")
 	sb.WriteString("- `confidence`: 0-100（开仓建议≥75）\n")
 	sb.WriteString("- 市价开仓（open_long/open_short）必填: leverage, position_size_usd, stop_loss, take_profit, tp1, tp2, tp3, confidence, risk_usd, reasoning\n")
 	sb.WriteString("- 限价挂单（limit_open_long/limit_open_short）适用于市价与理想价偏离 ≥0.5%、4h 已进入 Late 阶段或 15m/5m 出现极端瀑布/拉升的场景。必须提供 limit_price，并在 reasoning 中写明挂单价区、触发确认（如“15m CHoCH_up + OI 回流”）与撤单条件。\n")
+	sb.WriteString("- 移动止损（update_trailing_stop）必填: trailing_atr_mult（距标记价的4h ATR倍数）或 trailing_pct（距标记价百分比）二选一, reasoning；系统每周期按标记价重算，只收紧不放宽\n")
 	sb.WriteString("- 取消限价单（cancel_limit_order）必填: order_id（从\"待成交限价单\"中获取）, reasoning（必须详细说明取消原因：点位是否合理、市场条件是否变化、价格是否偏离目标、取消后的计划等）\n\n")
 	sb.WriteString("⚠️ 限价单管理：系统会在持仓信息中显示所有待成交限价单。如果AI发现限价单点位有问题、市场条件已变化或不应继续挂单，可以自主使用 cancel_limit_order 取消，但必须在 reasoning 中详细说明取消原因。\n\n")
 	sb.WriteString("⚠️ 若暂不挂单，请使用 wait，并写出计划价位/确认条件/放弃条件；若决定挂单，reasoning 中要说明结构位置和确认逻辑。\n\n")
@@ -789,7 +927,14 @@ func buildLegacySystemPrompt(accountEquity float64, btcEthLeverage, altcoinLever
 	return sb.String()
 }
 
+// buildUserPrompt 构建用户提示词，设置了 MaxPromptChars 时超出预算会逐级裁剪行情数据
 func buildUserPrompt(ctx *Context) string {
+	return fitUserPromptBudget(ctx, func(t *promptTrimmer) string {
+		return renderUserPrompt(ctx, t)
+	})
+}
+
+func renderUserPrompt(ctx *Context, trimmer *promptTrimmer) string {
 	var sb strings.Builder
 
 	sb.WriteString(fmt.Sprintf("时间: %s | 周期: #%d | 运行: %d分钟\n\n",
@@ -801,6 +946,11 @@ func buildUserPrompt(ctx *Context) string {
 			btcData.CurrentMACD, btcData.CurrentRSI7))
 	}
 
+	if r := ctx.MarketRegime; r != nil {
+		sb.WriteString(fmt.Sprintf("大盘状态: %s (置信度%.0f%%) | BTC 4h波动率%.2f%% | ADX %.1f\n\n",
+			r.Regime, r.RegimeConfidence*100, r.VolatilityPct, r.TrendStrength))
+	}
+
 	sb.WriteString(fmt.Sprintf("账户: 净值%.2f | 余额%.2f (%.1f%%) | 盈亏%+.2f%% | 保证金%.1f%% | 持仓%d个\n\n",
 		ctx.Account.TotalEquity,
 		ctx.Account.AvailableBalance,
@@ -855,8 +1005,8 @@ func buildUserPrompt(ctx *Context) string {
 				sb.WriteString("\n")
 			}
 
-			if marketData, ok := ctx.MarketDataMap[pos.Symbol]; ok {
-				sb.WriteString(market.Format(marketData))
+			if marketData, ok := ctx.MarketDataMap[market.Normalize(pos.Symbol)]; ok {
+				sb.WriteString(trimmer.formatMarket(market.Normalize(pos.Symbol), marketData))
 				sb.WriteString("\n")
 			}
 		}
@@ -864,13 +1014,29 @@ func buildUserPrompt(ctx *Context) string {
 		sb.WriteString("当前持仓: 无\n\n")
 	}
 
+	// 持仓相关性（取相关度最高的几对）
+	if pairs := correlatedPositionPairs(ctx); len(pairs) > 0 {
+		sb.WriteString("## 持仓相关性（1h收益率）\n")
+		for i, pair := range pairs {
+			if i >= maxCorrelationPairs {
+				break
+			}
+			warning := ""
+			if math.Abs(pair.Corr) > MaxCorrelatedExposure {
+				warning = fmt.Sprintf(" ⚠️ 高度相关(>|%.2f|)，风险敞口集中，避免继续同向加仓", MaxCorrelatedExposure)
+			}
+			sb.WriteString(fmt.Sprintf("- %s / %s: %+.2f%s\n", pair.A, pair.B, pair.Corr, warning))
+		}
+		sb.WriteString("\n")
+	}
+
 	// 显示待成交限价单
 	if len(ctx.PendingOrders) > 0 {
 		sb.WriteString("## 待成交限价单\n")
 		for i, order := range ctx.PendingOrders {
 			// 获取当前市价
 			currentPrice := 0.0
-			if marketData, ok := ctx.MarketDataMap[order.Symbol]; ok {
+			if marketData, ok := ctx.MarketDataMap[market.Normalize(order.Symbol)]; ok {
 				currentPrice = marketData.CurrentPrice
 			}
 
@@ -937,13 +1103,39 @@ func buildUserPrompt(ctx *Context) string {
 		sourceTags := ""
 		// 简化sourceTags，因为我们不再有coin.Sources信息
 		sourceTags = " (主要交易币种)"
+		if isObserveOnly(ctx, symbol) {
+			sourceTags = " (仅观察，禁止开仓)"
+		}
 
 		sb.WriteString(fmt.Sprintf("### %d. %s%s\n\n", displayedCount, symbol, sourceTags))
-		sb.WriteString(market.Format(marketData))
+		sb.WriteString(trimmer.formatMarket(symbol, marketData))
 		sb.WriteString("\n")
 	}
 	sb.WriteString("\n")
 
+	// 仅观察币种：只作为市场参考（如BTC作为大盘风向标），任何开仓都会被拒绝
+	displayed := make(map[string]bool, len(mainSymbols))
+	for _, symbol := range mainSymbols {
+		displayed[symbol] = true
+	}
+	var observed []string
+	for _, raw := range ctx.ObserveOnlySymbols {
+		symbol := market.Normalize(raw)
+		if _, ok := ctx.MarketDataMap[symbol]; ok && !displayed[symbol] {
+			displayed[symbol] = true
+			observed = append(observed, symbol)
+		}
+	}
+	if len(observed) > 0 {
+		sb.WriteString("## 仅观察币种（市场参考，禁止开仓）\n\n")
+		for _, symbol := range observed {
+			sb.WriteString(fmt.Sprintf("### %s (仅观察，禁止开仓)\n\n", symbol))
+			sb.WriteString(trimmer.formatMarket(symbol, ctx.MarketDataMap[symbol]))
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+
 	if ctx.Performance != nil {
 		type PerformanceData struct {
 			SharpeRatio float64 `json:"sharpe_ratio"`
@@ -965,7 +1157,7 @@ func buildUserPrompt(ctx *Context) string {
 	return sb.String()
 }
 
-func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthLeverage, altcoinLeverage int, config *config.Config, marketDataMap map[string]*market.Data) (*FullDecision, error) {
+func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthLeverage, altcoinLeverage int, config *config.Config, marketDataMap map[string]*market.Data, indicatorRules []IndicatorRule) (*FullDecision, error) {
 	log.Printf("🔍 [解析] 开始解析AI响应 (长度: %d字符)", len(aiResponse))
 	log.Printf("🔍 [解析] AI响应预览: %q", aiResponse[:min(300, len(aiResponse))])
 
@@ -988,7 +1180,7 @@ func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthL
 		}
 	}
 
-	if err := validateDecisions(decisions, accountEquity, btcEthLeverage, altcoinLeverage, config); err != nil {
+	if err := validateDecisions(decisions, accountEquity, btcEthLeverage, altcoinLeverage, config, indicatorRules, marketDataMap); err != nil {
 		decisionResp := &FullDecision{
 			CoTTrace:  cotTrace,
 			Decisions: decisions,
@@ -1333,16 +1525,22 @@ func fixMissingQuotes(jsonStr string) string {
 	return jsonStr
 }
 
-func validateDecisions(decisions []Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int, config *config.Config) error {
+func validateDecisions(decisions []Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int, config *config.Config, indicatorRules []IndicatorRule, marketDataMap map[string]*market.Data) error {
 	extremeCount := 0
 
 	for i := range decisions {
 		if decisions[i].InterventionLevel == interventionLevelExtreme {
 			extremeCount++
 		}
+		if err := applyATRSizing(&decisions[i], accountEquity, config, marketDataMap); err != nil {
+			return fmt.Errorf("决策 #%d 验证失败: %w", i+1, err)
+		}
 		if err := validateDecision(&decisions[i], accountEquity, btcEthLeverage, altcoinLeverage, config); err != nil {
 			return fmt.Errorf("决策 #%d 验证失败: %w", i+1, err)
 		}
+		if err := checkIndicatorRules(&decisions[i], indicatorRules, marketDataMap); err != nil {
+			return fmt.Errorf("决策 #%d 验证失败: %w", i+1, err)
+		}
 	}
 
 	if extremeCount > 1 {
@@ -1352,6 +1550,66 @@ func validateDecisions(decisions []Decision, accountEquity float64, btcEthLevera
 	return nil
 }
 
+// applyATRSizing 开启 risk_management.use_atr_sizing 时按止损距离重新计算开仓保证金：
+// position_size_usd = risk_usd / (|entry - stop_loss| / entry) / leverage，覆盖AI给出的数值。
+// entry 限价单取 limit_price，市价单取当前价；非补仓单夹紧到单笔保证金 5%~13% 区间，
+// 夹紧后按实际保证金回算 risk_usd，保证后续风控真实性校验一致
+func applyATRSizing(d *Decision, accountEquity float64, config *config.Config, marketDataMap map[string]*market.Data) error {
+	if config == nil || !config.RiskManagement.UseATRSizing {
+		return nil
+	}
+	if d.Action != "open_long" && d.Action != "open_short" && d.Action != "limit_open_long" && d.Action != "limit_open_short" {
+		return nil
+	}
+
+	var entryPrice float64
+	if d.Action == "limit_open_long" || d.Action == "limit_open_short" {
+		entryPrice = d.LimitPrice
+	} else if data, ok := marketDataMap[d.Symbol]; ok && data != nil && data.CurrentPrice > 0 {
+		entryPrice = data.CurrentPrice
+	} else {
+		entryPrice = d.CurrentPrice
+	}
+	if entryPrice <= 0 {
+		return fmt.Errorf("%s 止损定仓缺少入场价（limit_price/当前价）", d.Symbol)
+	}
+	if d.StopLoss <= 0 || d.StopLoss == entryPrice {
+		return fmt.Errorf("%s 止损定仓要求有效止损：entry=%.4f stop_loss=%.4f", d.Symbol, entryPrice, d.StopLoss)
+	}
+	if d.RiskUSD <= 0 {
+		return fmt.Errorf("%s 止损定仓必须提供有效的risk_usd", d.Symbol)
+	}
+	if d.Leverage <= 0 {
+		return fmt.Errorf("%s 止损定仓必须提供有效的杠杆", d.Symbol)
+	}
+
+	riskPct := math.Abs(entryPrice-d.StopLoss) / entryPrice
+	margin := roundToPrecision(d.RiskUSD/riskPct/float64(d.Leverage), 2)
+	riskUSD := d.RiskUSD
+
+	if !d.IsAddOn {
+		minMargin := roundToPrecision(accountEquity*0.05, 2)
+		maxMargin := roundToPrecision(accountEquity*0.13, 2)
+		clamped := margin
+		if clamped < minMargin {
+			clamped = minMargin
+		} else if clamped > maxMargin {
+			clamped = maxMargin
+		}
+		if clamped != margin {
+			log.Printf("⚠️ 止损定仓: %s 计算保证金 %.2f 超出区间 [%.2f, %.2f]，夹紧到 %.2f", d.Symbol, margin, minMargin, maxMargin, clamped)
+			margin = clamped
+			riskUSD = roundToPrecision(margin*float64(d.Leverage)*riskPct, 2)
+		}
+	}
+
+	log.Printf("📐 止损定仓: %s entry=%.4f stop=%.4f (%.2f%%) risk_usd %.2f→%.2f，position_size_usd %.2f→%.2f（%dx）",
+		d.Symbol, entryPrice, d.StopLoss, riskPct*100, d.RiskUSD, riskUSD, d.PositionSizeUSD, margin, d.Leverage)
+	d.PositionSizeUSD = margin
+	d.RiskUSD = riskUSD
+	return nil
+}
+
 // validateRiskManagement 验证分层风控规则
 func validateRiskManagement(d *Decision, accountEquity float64, config *config.Config) error {
 	// 确定当前账户模式
@@ -1510,22 +1768,32 @@ func findMatchingBracket(s string, start int) int {
 	return -1
 }
 
+// defaultMinRewardRisk 未配置 min_reward_risk 时的开仓最低盈亏比
+const defaultMinRewardRisk = 1.8
+
+// defaultMinTPDistancePct 未配置 min_tp_distance_pct 时相邻TP分段的最小间距（占当前价的百分比）
+const defaultMinTPDistancePct = 0.2
+
+// maxTrailingStopPct update_trailing_stop 百分比距离上限（%）
+const maxTrailingStopPct = 20.0
+
 func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int, config *config.Config) error {
 	// 只保留你现在要的几种 action
 	validActions := map[string]bool{
-		"open_long":           true,
-		"open_short":          true,
-		"close_long":          true,
-		"close_short":         true,
-		"partial_close_long":  true,
-		"partial_close_short": true,
-		"hold":                true,
-		"wait":                true,
-		"update_stop_loss":    true,
-		"update_take_profit":  true,
-		"limit_open_long":     true,
-		"limit_open_short":    true,
-		"cancel_limit_order":  true,
+		"open_long":            true,
+		"open_short":           true,
+		"close_long":           true,
+		"close_short":          true,
+		"partial_close_long":   true,
+		"partial_close_short":  true,
+		"hold":                 true,
+		"wait":                 true,
+		"update_stop_loss":     true,
+		"update_take_profit":   true,
+		"update_trailing_stop": true,
+		"limit_open_long":      true,
+		"limit_open_short":     true,
+		"cancel_limit_order":   true,
 	}
 
 	if !validActions[d.Action] {
@@ -1579,7 +1847,7 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 			return fmt.Errorf("%s 杠杆必须在 %d-%d 之间，当前: %d", d.Symbol, minLeverage, maxLeverage, d.Leverage)
 		}
 
-		// 1.1) RR真实性校验（用tp3计算，要求RR≥1.8）
+		// 1.1) RR真实性校验（用tp3计算，要求RR≥min_reward_risk，默认1.8）
 		var entryPrice float64
 		var hasEntryPrice bool
 		if d.Action == "limit_open_long" || d.Action == "limit_open_short" {
@@ -1612,9 +1880,12 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 			}
 
 			rr := reward / risk
-			minRR := 1.8 // 可以做成配置项，默认1.8
+			minRR := defaultMinRewardRisk
+			if config != nil && config.MinRewardRisk > 0 {
+				minRR = config.MinRewardRisk
+			}
 			if rr < minRR {
-				return fmt.Errorf("盈亏比过低，RR=%.2f（要求≥%.1f），risk=%.4f, reward=%.4f，请收紧止损或降低止盈预期",
+				return fmt.Errorf("盈亏比过低，RR=%.2f（要求≥%g），risk=%.4f, reward=%.4f，请收紧止损或降低止盈预期",
 					rr, minRR, risk, reward)
 			}
 		}
@@ -1757,6 +2028,24 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 			}
 		}
 
+		// TP分段间距校验：相邻TP过近时分批止盈失去意义，且会连续快速推进止损阶段
+		refPrice := d.CurrentPrice
+		if refPrice <= 0 {
+			refPrice = entryPrice
+		}
+		if refPrice > 0 {
+			minGapPct := defaultMinTPDistancePct
+			if config != nil && config.MinTPDistancePct > 0 {
+				minGapPct = config.MinTPDistancePct
+			}
+			gap12 := math.Abs(d.TP2-d.TP1) / refPrice * 100
+			gap23 := math.Abs(d.TP3-d.TP2) / refPrice * 100
+			if gap12 < minGapPct || gap23 < minGapPct {
+				return fmt.Errorf("TP分段过于密集：tp1→tp2 间距%.3f%%、tp2→tp3 间距%.3f%%（要求≥%g%%，参考价%.4f），请拉开TP分段",
+					gap12, gap23, minGapPct, refPrice)
+			}
+		}
+
 		// 5) 分层风控校验（根据账户净值自动切换模式）
 		if err := validateRiskManagement(d, accountEquity, config); err != nil {
 			return err
@@ -1807,6 +2096,17 @@ func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoi
 			return fmt.Errorf("update_take_profit 需要给出调整理由")
 		}
 
+	case "update_trailing_stop":
+		if (d.TrailingATRMult > 0) == (d.TrailingPct > 0) {
+			return fmt.Errorf("update_trailing_stop 需要提供 trailing_atr_mult 或 trailing_pct（二选一且 > 0）")
+		}
+		if d.TrailingPct > maxTrailingStopPct {
+			return fmt.Errorf("update_trailing_stop 的 trailing_pct 不能超过 %g%%，当前 %.2f", maxTrailingStopPct, d.TrailingPct)
+		}
+		if d.Reasoning == "" {
+			return fmt.Errorf("update_trailing_stop 需要给出调整理由")
+		}
+
 	case "close_long", "close_short", "hold", "wait":
 		if d.Reasoning == "" {
 			return fmt.Errorf("%s 需要给出reasoning说明", d.Action)
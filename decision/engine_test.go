@@ -1,9 +1,17 @@
 package decision
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"nofx/config"
+	"nofx/market"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func TestCollectAllAnalyzedSymbols(t *testing.T) {
@@ -78,6 +86,112 @@ func TestCollectAllAnalyzedSymbols(t *testing.T) {
 	}
 }
 
+// countingMarketDataProvider 记录每个symbol被获取次数的市场数据提供者
+type countingMarketDataProvider struct {
+	mu         sync.Mutex
+	fetchCount map[string]int
+}
+
+func (p *countingMarketDataProvider) Get(symbol string) (*market.Data, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetchCount[symbol]++
+	return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+}
+
+func TestFetchMarketDataForContextDedup(t *testing.T) {
+	provider := &countingMarketDataProvider{fetchCount: make(map[string]int)}
+	market.SetMarketDataProvider(provider)
+	defer market.ResetMarketDataProvider()
+	fetchCount := provider.fetchCount
+
+	ctx := &Context{
+		Positions: []PositionInfo{
+			{Symbol: "btcusdt"},
+		},
+		CandidateCoins: []CandidateCoin{
+			{Symbol: "BTCUSDT"}, // 与持仓重复（大小写不同）
+			{Symbol: " BTC "},   // 与持仓重复（缺少后缀）
+			{Symbol: "ETHUSDT"},
+		},
+	}
+
+	if err := fetchMarketDataForContext(ctx); err != nil {
+		t.Fatalf("fetchMarketDataForContext() error = %v", err)
+	}
+
+	if fetchCount["BTCUSDT"] != 1 {
+		t.Errorf("BTCUSDT fetched %d times, expected 1", fetchCount["BTCUSDT"])
+	}
+	if len(fetchCount) != 2 {
+		t.Errorf("fetched symbols = %v, expected BTCUSDT and ETHUSDT only", fetchCount)
+	}
+	if _, ok := ctx.MarketDataMap["BTCUSDT"]; !ok {
+		t.Errorf("MarketDataMap missing normalized key BTCUSDT")
+	}
+}
+
+// slowMarketDataProvider 模拟网络延迟、慢币种和限频的市场数据提供者
+type slowMarketDataProvider struct {
+	inFlight    int32
+	maxInFlight int32
+	rateLimited sync.Map // symbol -> 已返回过限频错误
+}
+
+func (p *slowMarketDataProvider) Get(symbol string) (*market.Data, error) {
+	n := atomic.AddInt32(&p.inFlight, 1)
+	defer atomic.AddInt32(&p.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&p.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&p.maxInFlight, max, n) {
+			break
+		}
+	}
+
+	switch symbol {
+	case "SLOWUSDT":
+		time.Sleep(500 * time.Millisecond)
+	case "LIMITEDUSDT":
+		if _, seen := p.rateLimited.LoadOrStore(symbol, true); !seen {
+			return nil, fmt.Errorf("获取5m K线失败: %w", market.ErrRateLimited)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return &market.Data{Symbol: symbol, CurrentPrice: 100}, nil
+}
+
+func TestFetchMarketDataConcurrently(t *testing.T) {
+	provider := &slowMarketDataProvider{}
+	market.SetMarketDataProvider(provider)
+	defer market.ResetMarketDataProvider()
+
+	prevTimeout, prevBackoff := marketDataFetchTimeout, rateLimitBackoff
+	marketDataFetchTimeout, rateLimitBackoff = 150*time.Millisecond, 10*time.Millisecond
+	defer func() { marketDataFetchTimeout, rateLimitBackoff = prevTimeout, prevBackoff }()
+
+	symbols := []string{"AUSDT", "BUSDT", "CUSDT", "DUSDT", "EUSDT", "FUSDT", "SLOWUSDT", "LIMITEDUSDT"}
+	start := time.Now()
+	results := fetchMarketDataConcurrently(context.Background(), symbols, nil, 3)
+	elapsed := time.Since(start)
+
+	if max := atomic.LoadInt32(&provider.maxInFlight); max > 3 || max < 2 {
+		t.Errorf("最大并发 = %d，期望受上限3约束且确实并发", max)
+	}
+	if _, ok := results["SLOWUSDT"]; ok {
+		t.Errorf("超时的币种不应出现在结果中")
+	}
+	if _, ok := results["LIMITEDUSDT"]; !ok {
+		t.Errorf("限频后重试应成功获取 LIMITEDUSDT")
+	}
+	if len(results) != len(symbols)-1 {
+		t.Errorf("结果数量 = %d, want %d", len(results), len(symbols)-1)
+	}
+	// 串行需要 >= 8×20ms + 500ms；慢币种只占用一个worker直到超时
+	if elapsed > 400*time.Millisecond {
+		t.Errorf("批量获取耗时 %v，慢币种不应阻塞整批", elapsed)
+	}
+}
+
 func TestBoundaryStabilityStrategy(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -888,3 +1002,430 @@ func TestNormalizeExecutionPreference(t *testing.T) {
 		})
 	}
 }
+
+func TestIndicatorRules(t *testing.T) {
+	rules, err := ParseIndicatorRules(`[
+		{"side":"long","timeframe":"4h","indicator":"rsi14","operator":">","value":75},
+		{"side":"short","timeframe":"4h","indicator":"rsi14","operator":"<","value":25}
+	]`)
+	if err != nil {
+		t.Fatalf("ParseIndicatorRules 失败: %v", err)
+	}
+
+	marketDataMap := map[string]*market.Data{
+		"BTCUSDT": {Symbol: "BTCUSDT", CurrentPrice: 50000, MidTermSeries4h: &market.MidTermSeries4h{RSI14Values: []float64{70, 78.5}}},
+		"ETHUSDT": {Symbol: "ETHUSDT", CurrentPrice: 3000, MidTermSeries4h: &market.MidTermSeries4h{RSI14Values: []float64{52, 55}}},
+		"SOLUSDT": {Symbol: "SOLUSDT", CurrentPrice: 150}, // 4h未启用，规则跳过
+	}
+
+	tests := []struct {
+		name    string
+		d       Decision
+		wantErr bool
+	}{
+		{"超买开多被拒绝", Decision{Symbol: "BTCUSDT", Action: "open_long"}, true},
+		{"超买限价开多被拒绝", Decision{Symbol: "BTCUSDT", Action: "limit_open_long"}, true},
+		{"超买开空不受多单规则限制", Decision{Symbol: "BTCUSDT", Action: "open_short"}, false},
+		{"中性开多通过", Decision{Symbol: "ETHUSDT", Action: "open_long"}, false},
+		{"缺少指标数据时跳过", Decision{Symbol: "SOLUSDT", Action: "open_long"}, false},
+		{"平仓不校验", Decision{Symbol: "BTCUSDT", Action: "close_long"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkIndicatorRules(&tt.d, rules, marketDataMap)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkIndicatorRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	for _, invalid := range []string{
+		`[{"side":"long","timeframe":"4h","indicator":"unknown","operator":">","value":1}]`,
+		`[{"side":"long","timeframe":"4h","indicator":"rsi14","operator":"==","value":1}]`,
+		`[{"side":"long","timeframe":"","indicator":"rsi14","operator":">","value":1}]`,
+		`not json`,
+	} {
+		if _, err := ParseIndicatorRules(invalid); err == nil {
+			t.Errorf("ParseIndicatorRules(%s) 期望返回错误", invalid)
+		}
+	}
+}
+
+func TestMinRewardRiskGate(t *testing.T) {
+	cfg := &config.Config{MinRewardRisk: 1.5}
+	cfg.RiskManagement.AggressiveMode.MaxConcurrentPositions = 1
+	cfg.RiskManagement.AggressiveMode.AllowedSymbols = []string{"BTCUSDT"}
+	cfg.RiskManagement.AggressiveMode.MaxLeverage = 100
+	cfg.RiskManagement.AggressiveMode.MinLeverage = 40
+	cfg.RiskManagement.AggressiveMode.RiskUsdMinPct = 8.0
+	cfg.RiskManagement.AggressiveMode.RiskUsdMaxPct = 15.0
+
+	// 入场 50000，止损距离 615（risk_usd ≈ 8.0）
+	long := func(tp1, tp2, tp3 float64) *Decision {
+		return &Decision{
+			Symbol: "BTCUSDT", Action: "limit_open_long", PositionSizeUSD: 10.0, Leverage: 65,
+			LimitPrice: 50000.0, StopLoss: 49385.0, RiskUSD: 8.0,
+			TP1: tp1, TP2: tp2, TP3: tp3, TakeProfit: tp3,
+			Reasoning: "grade=S score=88 测试用例",
+		}
+	}
+	short := func(tp1, tp2, tp3 float64) *Decision {
+		return &Decision{
+			Symbol: "BTCUSDT", Action: "limit_open_short", PositionSizeUSD: 10.0, Leverage: 65,
+			LimitPrice: 50000.0, StopLoss: 50615.0, RiskUSD: 8.0,
+			TP1: tp1, TP2: tp2, TP3: tp3, TakeProfit: tp3,
+			Reasoning: "grade=S score=88 测试用例",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		d       *Decision
+		wantErr bool
+	}{
+		{"多单1:1被拒绝", long(50200, 50400, 50615), true},
+		{"多单2:1通过", long(50400, 50800, 51230), false},
+		{"空单1:1被拒绝", short(49800, 49600, 49385), true},
+		{"空单2:1通过", short(49600, 49200, 48770), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDecision(tt.d, 100.0, 100, 50, cfg)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "盈亏比过低") {
+					t.Errorf("期望盈亏比校验失败，实际: %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("期望通过，实际: %v", err)
+			}
+		})
+	}
+
+	// 阈值可配置：2:1 在阈值 2.5 下被拒绝
+	cfg.MinRewardRisk = 2.5
+	if err := validateDecision(long(50400, 50800, 51230), 100.0, 100, 50, cfg); err == nil || !strings.Contains(err.Error(), "盈亏比过低") {
+		t.Errorf("阈值2.5时2:1应被拒绝，实际: %v", err)
+	}
+}
+
+func TestObserveOnlySymbolsInContext(t *testing.T) {
+	provider := &countingMarketDataProvider{fetchCount: make(map[string]int)}
+	market.SetMarketDataProvider(provider)
+	defer market.ResetMarketDataProvider()
+
+	ctx := &Context{
+		CandidateCoins:     []CandidateCoin{{Symbol: "ETHUSDT"}},
+		ObserveOnlySymbols: []string{"BTCUSDT", "DOGE"},
+	}
+	if err := fetchMarketDataForContext(ctx); err != nil {
+		t.Fatalf("fetchMarketDataForContext() error = %v", err)
+	}
+	for _, symbol := range []string{"ETHUSDT", "BTCUSDT", "DOGEUSDT"} {
+		if _, ok := ctx.MarketDataMap[symbol]; !ok {
+			t.Errorf("MarketDataMap 缺少 %s", symbol)
+		}
+	}
+	if got := collectAllAnalyzedSymbols(ctx); len(got) != 3 || got[2] != "DOGEUSDT" {
+		t.Errorf("collectAllAnalyzedSymbols = %v, 应包含仅观察币种", got)
+	}
+
+	prompt := buildUserPrompt(ctx)
+	if !strings.Contains(prompt, "BTCUSDT (仅观察，禁止开仓)") {
+		t.Error("主要币种中的仅观察币种应标注禁止开仓")
+	}
+	if !strings.Contains(prompt, "## 仅观察币种（市场参考，禁止开仓）") || !strings.Contains(prompt, "### DOGEUSDT (仅观察，禁止开仓)") {
+		t.Error("提示词应包含仅观察币种段落")
+	}
+}
+
+func TestCorrelatedPositionsInPrompt(t *testing.T) {
+	series := func(sign float64) *market.Data {
+		closes := make([]float64, 50)
+		price := 100.0
+		for i := range closes {
+			price *= 1 + sign*0.01*math.Sin(float64(i))
+			closes[i] = price
+		}
+		return &market.Data{MidTermSeries1h: &market.MidTermData1h{MidPrices: closes}}
+	}
+
+	ctx := &Context{
+		Positions: []PositionInfo{
+			{Symbol: "BTCUSDT", Side: "long"},
+			{Symbol: "ETHUSDT", Side: "long"},
+			{Symbol: "SOLUSDT", Side: "short"},
+		},
+		MarketDataMap: map[string]*market.Data{
+			"BTCUSDT": series(1),
+			"ETHUSDT": series(1),
+			"SOLUSDT": series(-1),
+		},
+	}
+	ctx.CorrelationMatrix = buildCorrelationMatrix(ctx.MarketDataMap)
+
+	pairs := correlatedPositionPairs(ctx)
+	if len(pairs) != 3 {
+		t.Fatalf("应有3对持仓相关性, got %d", len(pairs))
+	}
+	for _, pair := range pairs {
+		if math.Abs(pair.Corr) <= MaxCorrelatedExposure {
+			t.Errorf("%s/%s 相关系数 %.2f 应超过阈值", pair.A, pair.B, pair.Corr)
+		}
+	}
+
+	prompt := buildUserPrompt(ctx)
+	if !strings.Contains(prompt, "## 持仓相关性") {
+		t.Fatal("提示词应包含持仓相关性段落")
+	}
+	if !strings.Contains(prompt, "- BTCUSDT / ETHUSDT: +1.00 ⚠️ 高度相关") {
+		t.Error("高度相关的持仓对应带有警告")
+	}
+}
+
+func TestBuildSystemPromptUserTemplate(t *testing.T) {
+	SetUserPromptTemplates("user1", []*PromptTemplate{{Name: "scalper", Content: "只做15m剥头皮"}})
+	t.Cleanup(func() { SetUserPromptTemplates("user1", nil) })
+
+	ctx := &Context{UserID: "user1", BTCETHLeverage: 5, AltcoinLeverage: 3}
+	if prompt := buildSystemPrompt(ctx, "scalper"); !strings.HasPrefix(prompt, "只做15m剥头皮") {
+		t.Errorf("用户自定义模板应生效，prompt 开头: %.40q", prompt)
+	}
+
+	// 其他用户的交易员无法使用该模板
+	other := &Context{UserID: "user2", BTCETHLeverage: 5, AltcoinLeverage: 3}
+	if prompt := buildSystemPrompt(other, "scalper"); strings.Contains(prompt, "只做15m剥头皮") {
+		t.Error("其他用户的交易员不应解析到 user1 的模板")
+	}
+}
+
+func TestMinTPDistanceGate(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RiskManagement.AggressiveMode.MaxConcurrentPositions = 1
+	cfg.RiskManagement.AggressiveMode.AllowedSymbols = []string{"BTCUSDT"}
+	cfg.RiskManagement.AggressiveMode.MaxLeverage = 100
+	cfg.RiskManagement.AggressiveMode.MinLeverage = 40
+	cfg.RiskManagement.AggressiveMode.RiskUsdMinPct = 8.0
+	cfg.RiskManagement.AggressiveMode.RiskUsdMaxPct = 15.0
+
+	// 入场 50000，止损距离 615（risk_usd ≈ 8.0），TP3 保持 RR=2
+	long := func(tp1, tp2 float64) *Decision {
+		return &Decision{
+			Symbol: "BTCUSDT", Action: "limit_open_long", PositionSizeUSD: 10.0, Leverage: 65,
+			LimitPrice: 50000.0, StopLoss: 49385.0, RiskUSD: 8.0, CurrentPrice: 50100.0,
+			TP1: tp1, TP2: tp2, TP3: 51230, TakeProfit: 51230,
+			Reasoning: "grade=S score=88 测试用例",
+		}
+	}
+	short := func(tp1, tp2 float64) *Decision {
+		return &Decision{
+			Symbol: "BTCUSDT", Action: "limit_open_short", PositionSizeUSD: 10.0, Leverage: 65,
+			LimitPrice: 50000.0, StopLoss: 50615.0, RiskUSD: 8.0,
+			TP1: tp1, TP2: tp2, TP3: 48770, TakeProfit: 48770,
+			Reasoning: "grade=S score=88 测试用例",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		d       *Decision
+		wantErr bool
+	}{
+		{"多单TP1/TP2过近被拒绝", long(51150, 51180), true},
+		{"多单TP2/TP3过近被拒绝", long(50400, 51200), true},
+		{"多单间距充足通过", long(50400, 50800), false},
+		{"空单TP分段过近被拒绝", short(48820, 48800), true},
+		{"空单间距充足通过", short(49600, 49200), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDecision(tt.d, 100.0, 100, 50, cfg)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "TP分段过于密集") {
+					t.Errorf("期望TP间距校验失败，实际: %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("期望通过，实际: %v", err)
+			}
+		})
+	}
+
+	// 阈值可配置：间距 0.8% 在阈值 1% 下被拒绝
+	cfg.MinTPDistancePct = 1.0
+	if err := validateDecision(long(50400, 50800), 100.0, 100, 50, cfg); err == nil || !strings.Contains(err.Error(), "TP分段过于密集") {
+		t.Errorf("阈值1%%时0.8%%间距应被拒绝，实际: %v", err)
+	}
+}
+
+func TestATRSizing(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RiskManagement.UseATRSizing = true
+	cfg.RiskManagement.ConservativeMode.MaxLeverage = 100
+
+	marketDataMap := map[string]*market.Data{
+		"BTCUSDT": {Symbol: "BTCUSDT", CurrentPrice: 50000},
+	}
+	// 账户净值 2000：单笔保证金区间 100~260；risk_usd=60、止损距离1%、50x → 保证金 120
+	open := func(action string, limitPrice, stopLoss, tp1, tp2, tp3, riskUSD float64) Decision {
+		return Decision{
+			Symbol: "BTCUSDT", Action: action, PositionSizeUSD: 200, Leverage: 50,
+			LimitPrice: limitPrice, StopLoss: stopLoss, RiskUSD: riskUSD, CurrentPrice: 50000,
+			TP1: tp1, TP2: tp2, TP3: tp3, TakeProfit: tp3,
+			Reasoning: "grade=S score=88 测试用例",
+		}
+	}
+
+	tests := []struct {
+		name       string
+		d          Decision
+		wantMargin float64
+		wantRisk   float64
+	}{
+		{"市价多单按当前价定仓", open("open_long", 0, 49500, 50400, 50800, 51200, 60), 120, 60},
+		{"市价空单按当前价定仓", open("open_short", 0, 50500, 49600, 49200, 48800, 60), 120, 60},
+		{"限价多单按limit_price定仓", open("limit_open_long", 49800, 49302, 50200, 50600, 51000, 60), 120, 60},
+		{"限价空单按limit_price定仓", open("limit_open_short", 50200, 50702, 49800, 49400, 49000, 60), 120, 60},
+		{"超出上限夹紧并回算risk_usd", open("open_long", 0, 49500, 50400, 50800, 51200, 150), 260, 130},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decisions := []Decision{tt.d}
+			if err := validateDecisions(decisions, 2000, 100, 50, cfg, nil, marketDataMap); err != nil {
+				t.Fatalf("期望通过，实际: %v", err)
+			}
+			if decisions[0].PositionSizeUSD != tt.wantMargin || decisions[0].RiskUSD != tt.wantRisk {
+				t.Errorf("position_size_usd=%.2f risk_usd=%.2f，期望 %.2f / %.2f",
+					decisions[0].PositionSizeUSD, decisions[0].RiskUSD, tt.wantMargin, tt.wantRisk)
+			}
+		})
+	}
+
+	t.Run("止损为0被拒绝", func(t *testing.T) {
+		decisions := []Decision{open("open_long", 0, 0, 50400, 50800, 51200, 60)}
+		err := validateDecisions(decisions, 2000, 100, 50, cfg, nil, marketDataMap)
+		if err == nil || !strings.Contains(err.Error(), "止损定仓要求有效止损") {
+			t.Errorf("期望止损定仓失败，实际: %v", err)
+		}
+	})
+
+	t.Run("止损等于入场价被拒绝", func(t *testing.T) {
+		d := open("limit_open_long", 49800, 49800, 50200, 50600, 51000, 60)
+		if err := applyATRSizing(&d, 2000, cfg, marketDataMap); err == nil {
+			t.Error("止损距离为0时应拒绝")
+		}
+	})
+
+	t.Run("未开启时保留AI数值", func(t *testing.T) {
+		off := &config.Config{}
+		d := open("open_long", 0, 49500, 50400, 50800, 51200, 60)
+		if err := applyATRSizing(&d, 2000, off, marketDataMap); err != nil || d.PositionSizeUSD != 200 {
+			t.Errorf("未开启时不应调整，position_size_usd=%.2f err=%v", d.PositionSizeUSD, err)
+		}
+	})
+}
+
+func TestMarketRegimeInContext(t *testing.T) {
+	provider := &countingMarketDataProvider{fetchCount: make(map[string]int)}
+	market.SetMarketDataProvider(provider)
+	defer market.ResetMarketDataProvider()
+
+	ctx := &Context{CandidateCoins: []CandidateCoin{{Symbol: "ETHUSDT"}}}
+	if err := fetchMarketDataForContext(ctx); err != nil {
+		t.Fatalf("fetchMarketDataForContext() error = %v", err)
+	}
+	if ctx.MarketRegime == nil {
+		t.Fatal("BTC 不在候选中时也应单独获取并判断大盘状态")
+	}
+	if _, ok := ctx.MarketDataMap["BTCUSDT"]; ok {
+		t.Error("单独获取的BTC不应写入 MarketDataMap")
+	}
+
+	ctx.MarketRegime = &market.MarketRegime{Regime: market.RegimeTrendingBear, VolatilityPct: 1.8, TrendStrength: 31, RegimeConfidence: 0.62}
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "大盘状态: trending_bear (置信度62%)") {
+		t.Error("提示词开头应包含大盘状态")
+	}
+}
+
+func TestBuildUserPromptTrimsToBudget(t *testing.T) {
+	richData := func(symbol string, price float64) *market.Data {
+		series := make([]float64, 10)
+		for i := range series {
+			series[i] = price + float64(i)
+		}
+		candles := make([]market.CandleShape, 5)
+		for i := range candles {
+			candles[i] = market.CandleShape{Direction: "bull", BodyPct: 0.5, RangeVsATR: 1}
+		}
+		return &market.Data{
+			Symbol:       symbol,
+			CurrentPrice: price,
+			IntradaySeries: &market.IntradayData{
+				OBVValues: series, VolumeDeltas: series, VWAPValues: series,
+			},
+			MidTermSeries15m: &market.MidTermData15m{MidPrices: series, EMA20Values: series, RSI7Values: series},
+			MidTermSeries1h:  &market.MidTermData1h{MidPrices: series, EMA20Values: series, RSI7Values: series},
+			CandleShapes15m:  candles,
+			HeikinAshi15m:    candles,
+			Fib4h: &market.FibSet{SwingLow: price * 0.9, SwingHigh: price * 1.1, Direction: "up",
+				Levels: []market.FibLevel{{Ratio: 0.618, Price: price * 0.976}}},
+		}
+	}
+	ctx := &Context{
+		Account:   AccountInfo{TotalEquity: 1000, AvailableBalance: 800},
+		Positions: []PositionInfo{{Symbol: "BTCUSDT", Side: "long", EntryPrice: 60000, MarkPrice: 61000, Leverage: 5}},
+		CandidateCoins: []CandidateCoin{
+			{Symbol: "ETHUSDT"}, {Symbol: "SOLUSDT"}, {Symbol: "BNBUSDT"},
+		},
+		MarketDataMap: map[string]*market.Data{
+			"BTCUSDT": richData("BTCUSDT", 61000),
+			"ETHUSDT": richData("ETHUSDT", 3000),
+			"SOLUSDT": richData("SOLUSDT", 150),
+			"BNBUSDT": richData("BNBUSDT", 600),
+		},
+	}
+
+	full := buildUserPrompt(ctx)
+	budget := utf8.RuneCountInString(full) * 2 / 3
+	ctx.MaxPromptChars = budget
+	trimmed := buildUserPrompt(ctx)
+
+	if n := utf8.RuneCountInString(trimmed); n > budget {
+		t.Fatalf("裁剪后长度 %d 仍超过预算 %d", n, budget)
+	}
+	if !strings.Contains(trimmed, "BTCUSDT LONG | 入场价60000.0000") {
+		t.Error("裁剪后应保留持仓信息")
+	}
+	if !strings.Contains(trimmed, "swing_low=54900.00 swing_high=67100.00") {
+		t.Error("裁剪后应保留持仓币种的斐波那契位")
+	}
+	if strings.Count(trimmed, "15m recent candle shapes") >= strings.Count(full, "15m recent candle shapes") {
+		t.Error("应优先裁剪候选币的K线形态")
+	}
+	if ctx.MarketDataMap["ETHUSDT"].CandleShapes15m == nil || len(ctx.MarketDataMap["ETHUSDT"].IntradaySeries.OBVValues) != 10 {
+		t.Error("裁剪不应修改原始行情数据")
+	}
+}
+
+func TestTrimMarketDataCandlesAllTimeframes(t *testing.T) {
+	candles := make([]market.CandleShape, 5)
+	data := &market.Data{
+		CandleShapes5m: candles, CandleShapes15m: candles,
+		CandleShapes1h: candles, CandleShapes4h: candles,
+		HeikinAshi1h: candles,
+	}
+
+	trimmed := trimMarketData(data, trimCandles)
+	for name, shapes := range map[string][]market.CandleShape{
+		"5m": trimmed.CandleShapes5m, "15m": trimmed.CandleShapes15m,
+		"1h": trimmed.CandleShapes1h, "4h": trimmed.CandleShapes4h,
+	} {
+		if len(shapes) != trimmedTailLen {
+			t.Errorf("%s K线形态应只保留 %d 根，实际 %d", name, trimmedTailLen, len(shapes))
+		}
+	}
+	if trimmed.HeikinAshi1h != nil {
+		t.Error("trimCandles 级别应去掉 Heikin-Ashi 摘要")
+	}
+	if len(data.CandleShapes4h) != 5 {
+		t.Error("裁剪不应修改原始行情数据")
+	}
+}
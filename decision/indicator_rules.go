@@ -0,0 +1,214 @@
+package decision
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"nofx/market"
+)
+
+// IndicatorRule 指标阈值规则：开仓时若指标满足条件则拒绝该开仓
+// 例如 {"side":"long","timeframe":"4h","indicator":"rsi14","operator":">","value":75}
+// 表示 4h RSI14 > 75 时拒绝开多。多条规则任一命中即拒绝，指标数据缺失时该规则跳过
+type IndicatorRule struct {
+	Side      string  `json:"side"`                // "long" / "short"，为空对多空都生效
+	Timeframe string  `json:"timeframe,omitempty"` // 指标周期（如 "1h"、"4h"），funding_rate 无需周期
+	Indicator string  `json:"indicator"`           // rsi7 / rsi14 / ema20_distance_pct / macd_hist / adx / funding_rate
+	Operator  string  `json:"operator"`            // > / >= / < / <=
+	Value     float64 `json:"value"`               // 阈值
+}
+
+// supportedRuleIndicators 规则支持的指标
+var supportedRuleIndicators = map[string]bool{
+	"rsi7":               true,
+	"rsi14":              true,
+	"ema20_distance_pct": true, // (价格-EMA20)/EMA20 百分比
+	"macd_hist":          true,
+	"adx":                true,
+	"funding_rate":       true,
+}
+
+// ValidateIndicatorRules 校验规则配置是否合法
+func ValidateIndicatorRules(rules []IndicatorRule) error {
+	for i, rule := range rules {
+		switch rule.Side {
+		case "", "long", "short":
+		default:
+			return fmt.Errorf("指标规则 #%d 的side无效: %s", i+1, rule.Side)
+		}
+		if !supportedRuleIndicators[rule.Indicator] {
+			return fmt.Errorf("指标规则 #%d 的指标不支持: %s", i+1, rule.Indicator)
+		}
+		switch rule.Operator {
+		case ">", ">=", "<", "<=":
+		default:
+			return fmt.Errorf("指标规则 #%d 的比较符无效: %s", i+1, rule.Operator)
+		}
+		if rule.Indicator != "funding_rate" {
+			if _, err := market.NormalizeTimeframes([]string{rule.Timeframe}); err != nil || rule.Timeframe == "" {
+				return fmt.Errorf("指标规则 #%d 的周期无效: %q", i+1, rule.Timeframe)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseIndicatorRules 解析JSON数组格式的规则配置并校验，空字符串返回nil
+func ParseIndicatorRules(value string) ([]IndicatorRule, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var rules []IndicatorRule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, fmt.Errorf("解析指标规则失败: %w", err)
+	}
+	if err := ValidateIndicatorRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// String 规则的可读描述（用于拒绝原因）
+func (r IndicatorRule) String() string {
+	side := "多空"
+	if r.Side == "long" {
+		side = "多"
+	} else if r.Side == "short" {
+		side = "空"
+	}
+	name := r.Indicator
+	if r.Timeframe != "" {
+		name = r.Timeframe + " " + r.Indicator
+	}
+	return fmt.Sprintf("%s %s %g 时禁止开%s", name, r.Operator, r.Value, side)
+}
+
+// checkIndicatorRules 对开仓决策执行指标阈值规则，命中任一规则返回错误
+func checkIndicatorRules(d *Decision, rules []IndicatorRule, marketDataMap map[string]*market.Data) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var side string
+	switch d.Action {
+	case "open_long", "limit_open_long":
+		side = "long"
+	case "open_short", "limit_open_short":
+		side = "short"
+	default:
+		return nil
+	}
+
+	data := marketDataMap[d.Symbol]
+	if data == nil {
+		return nil
+	}
+
+	for _, rule := range rules {
+		if rule.Side != "" && rule.Side != side {
+			continue
+		}
+		value, ok := ruleIndicatorValue(data, rule.Timeframe, rule.Indicator)
+		if !ok {
+			continue
+		}
+		if compareRuleValue(value, rule.Operator, rule.Value) {
+			return fmt.Errorf("%s 指标规则拦截: %s（当前 %.4f）", d.Symbol, rule, value)
+		}
+	}
+	return nil
+}
+
+// compareRuleValue 按比较符比较指标值与阈值
+func compareRuleValue(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	}
+	return false
+}
+
+// ruleIndicatorValue 从市场数据中取指定周期指标的最新值，数据缺失时返回 false
+func ruleIndicatorValue(data *market.Data, timeframe, indicator string) (float64, bool) {
+	if indicator == "funding_rate" {
+		return data.FundingRate, true
+	}
+
+	var rsi7, rsi14, ema20 []float64
+	var macd *market.MACDSignal
+	adx, hasADX := 0.0, false
+
+	switch strings.TrimSpace(timeframe) {
+	case "5m":
+		if s := data.IntradaySeries; s != nil {
+			rsi7, rsi14, ema20 = s.RSI7Values, s.RSI14Values, s.EMA20Values
+			macd = lastMACD(s.MACDValues)
+		}
+	case "15m":
+		if s := data.MidTermSeries15m; s != nil {
+			rsi7, rsi14, ema20 = s.RSI7Values, s.RSI14Values, s.EMA20Values
+			macd = lastMACD(s.MACDValues)
+		}
+	case "1h":
+		if s := data.MidTermSeries1h; s != nil {
+			rsi7, rsi14, ema20 = s.RSI7Values, s.RSI14Values, s.EMA20Values
+			macd = lastMACD(s.MACDValues)
+			adx, hasADX = s.ADX, true
+		}
+	case "4h":
+		if s := data.MidTermSeries4h; s != nil {
+			rsi7, rsi14, ema20 = s.RSI7Values, s.RSI14Values, s.EMA20Values
+			macd = lastMACD(s.MACDValues)
+			adx, hasADX = s.ADX, true
+		}
+	default:
+		if s := data.ExtraSeries[timeframe]; s != nil {
+			rsi7, ema20 = s.RSI7Values, s.EMA20Values
+			macd = s.MACD
+		}
+	}
+
+	switch indicator {
+	case "rsi7":
+		return lastValue(rsi7)
+	case "rsi14":
+		return lastValue(rsi14)
+	case "ema20_distance_pct":
+		ema, ok := lastValue(ema20)
+		if !ok || ema <= 0 || data.CurrentPrice <= 0 {
+			return 0, false
+		}
+		return (data.CurrentPrice - ema) / ema * 100, true
+	case "macd_hist":
+		if macd == nil {
+			return 0, false
+		}
+		return macd.Histogram, true
+	case "adx":
+		return adx, hasADX
+	}
+	return 0, false
+}
+
+// lastValue 返回序列最后一个值
+func lastValue(values []float64) (float64, bool) {
+	if len(values) == 0 {
+		return 0, false
+	}
+	return values[len(values)-1], true
+}
+
+// lastMACD 返回MACD序列最后一个信号
+func lastMACD(values []*market.MACDSignal) *market.MACDSignal {
+	if len(values) == 0 {
+		return nil
+	}
+	return values[len(values)-1]
+}
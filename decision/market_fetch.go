@@ -0,0 +1,133 @@
+package decision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"nofx/market"
+)
+
+const (
+	defaultMarketDataConcurrency = 10 // 默认同时获取市场数据的币种数
+	maxRateLimitRetries          = 3  // 单币种遇到限频时的最大重试次数
+)
+
+var (
+	// marketDataFetchTimeout 单币种获取超时，避免个别慢币种拖住整批（测试可调小）
+	marketDataFetchTimeout = 20 * time.Second
+	// rateLimitBackoff 遇到限频后全部worker暂停的基础时长，之后按次数翻倍
+	rateLimitBackoff = 2 * time.Second
+)
+
+// rateLimitGate 限频退避闸门：任一worker遇到429后，所有worker在恢复时间前都暂停请求
+type rateLimitGate struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (g *rateLimitGate) wait() {
+	g.mu.Lock()
+	until := g.until
+	g.mu.Unlock()
+	if d := time.Until(until); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+func (g *rateLimitGate) backoff(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if next := time.Now().Add(d); next.After(g.until) {
+		g.until = next
+	}
+}
+
+// fetchMarketDataConcurrently 以有限并发获取多个币种的市场数据，获取失败、超时或被取消的币种不出现在结果中
+func fetchMarketDataConcurrently(ctx context.Context, symbols []string, timeframes []string, concurrency int) map[string]*market.Data {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if concurrency <= 0 {
+		concurrency = defaultMarketDataConcurrency
+	}
+
+	results := make(map[string]*market.Data, len(symbols))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	gate := &rateLimitGate{}
+
+	for _, symbol := range symbols {
+		wg.Add(1)
+		go func(symbol string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			data, err := fetchSymbolMarketData(ctx, symbol, timeframes, gate)
+			if err != nil {
+				log.Printf("⚠️  获取 %s 市场数据失败: %v", symbol, err)
+				return
+			}
+			mu.Lock()
+			results[symbol] = data
+			mu.Unlock()
+		}(symbol)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// fetchSymbolMarketData 获取单个币种数据：带超时，遇到限频时触发全局退避后重试
+func fetchSymbolMarketData(ctx context.Context, symbol string, timeframes []string, gate *rateLimitGate) (*market.Data, error) {
+	for attempt := 0; ; attempt++ {
+		gate.wait()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		data, err := getMarketDataWithTimeout(ctx, symbol, timeframes, marketDataFetchTimeout)
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, market.ErrRateLimited) || attempt >= maxRateLimitRetries {
+			return nil, err
+		}
+
+		delay := rateLimitBackoff << attempt
+		log.Printf("⏳ %s 触发交易所限频，%v 后重试 (%d/%d)", symbol, delay, attempt+1, maxRateLimitRetries)
+		gate.backoff(delay)
+	}
+}
+
+// getMarketDataWithTimeout 超时或 parent 取消后直接返回错误，并通过 context 中断进行中的HTTP请求
+// （不支持 context 的提供者由后台完成，结果被丢弃）
+func getMarketDataWithTimeout(parent context.Context, symbol string, timeframes []string, timeout time.Duration) (*market.Data, error) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	type result struct {
+		data *market.Data
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		data, err := market.GetWithTimeframesContext(ctx, symbol, timeframes)
+		ch <- result{data: data, err: err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.data, r.err
+	case <-ctx.Done():
+		if parent.Err() != nil {
+			return nil, fmt.Errorf("获取市场数据已取消: %w", parent.Err())
+		}
+		return nil, fmt.Errorf("获取市场数据超时(%v)", timeout)
+	}
+}
@@ -0,0 +1,202 @@
+package decision
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"nofx/market"
+)
+
+// 行情数据的裁剪级别（数值越大裁剪越多），支撑阻力/斐波那契/关键价位在任何级别都保留
+const (
+	trimNone        = iota
+	trimCandles     // 各周期（5m/15m/1h/4h）K线形态只保留最近2根，去掉 Heikin-Ashi 摘要
+	trimSeries      // 去掉K线形态；长序列（OBV/成交量差/VWAP等）及各周期序列只保留最近2个值
+	trimSecondary   // 去掉衍生品明细、ICT、成交量分布、5m/15m价格行为及扩展周期
+	trimDropSection // 整段省略（仅用于非持仓币种）
+)
+
+var trimLevelNames = map[int]string{
+	trimCandles:     "K线形态",
+	trimSeries:      "指标序列",
+	trimSecondary:   "次要指标",
+	trimDropSection: "整段行情",
+}
+
+const trimmedTailLen = 2 // 裁剪后序列保留的最新值个数
+
+// promptTrimmer 记录每个币种行情数据的裁剪级别，渲染提示词时按级别格式化
+type promptTrimmer struct {
+	levels map[string]int
+}
+
+// formatMarket 按当前裁剪级别格式化币种行情
+func (t *promptTrimmer) formatMarket(symbol string, data *market.Data) string {
+	level := trimNone
+	if t != nil {
+		level = t.levels[symbol]
+	}
+	if level >= trimDropSection {
+		return "（行情数据已省略：提示词超出长度预算）\n"
+	}
+	return market.Format(trimMarketData(data, level))
+}
+
+// fitUserPromptBudget 渲染用户提示词，超出 ctx.MaxPromptChars 时逐级裁剪行情数据：
+// 先裁剪非持仓币种（仅观察币种优先），再裁剪持仓币种，持仓币种的行情段落不会被整段省略
+func fitUserPromptBudget(ctx *Context, render func(t *promptTrimmer) string) string {
+	trimmer := &promptTrimmer{levels: make(map[string]int)}
+	prompt := render(trimmer)
+	budget := ctx.MaxPromptChars
+	if budget <= 0 || utf8.RuneCountInString(prompt) <= budget {
+		return prompt
+	}
+	originalLen := utf8.RuneCountInString(prompt)
+
+	positionSymbols := make(map[string]bool, len(ctx.Positions))
+	for _, pos := range ctx.Positions {
+		positionSymbols[market.Normalize(pos.Symbol)] = true
+	}
+	// 裁剪顺序：仅观察币种 → 候选币种（排名靠后的优先） → 持仓币种
+	var observeOnly, candidates, positions []string
+	for _, symbol := range collectAllAnalyzedSymbols(ctx) {
+		if _, ok := ctx.MarketDataMap[symbol]; !ok {
+			continue
+		}
+		switch {
+		case positionSymbols[symbol]:
+			positions = append(positions, symbol)
+		case isObserveOnly(ctx, symbol):
+			observeOnly = append(observeOnly, symbol)
+		default:
+			candidates = append(candidates, symbol)
+		}
+	}
+	for i, j := 0, len(candidates)-1; i < j; i, j = i+1, j-1 {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+	nonPosition := append(observeOnly, candidates...)
+
+	var trimmed []string
+	promptLen := originalLen
+	apply := func(symbols []string, level int) bool {
+		for _, symbol := range symbols {
+			trimmer.levels[symbol] = level
+			next := render(trimmer)
+			nextLen := utf8.RuneCountInString(next)
+			if nextLen < promptLen {
+				trimmed = append(trimmed, fmt.Sprintf("%s:%s", symbol, trimLevelNames[level]))
+			}
+			prompt, promptLen = next, nextLen
+			if promptLen <= budget {
+				return true
+			}
+		}
+		return false
+	}
+
+	done := false
+	for level := trimCandles; level <= trimDropSection && !done; level++ {
+		done = apply(nonPosition, level)
+	}
+	for level := trimCandles; level < trimDropSection && !done; level++ {
+		done = apply(positions, level)
+	}
+
+	if done {
+		log.Printf("✂️  用户提示词超出预算(%d > %d字符)，已裁剪: %s，裁剪后%d字符",
+			originalLen, budget, strings.Join(trimmed, ", "), promptLen)
+	} else {
+		log.Printf("⚠️  用户提示词裁剪后仍超出预算(%d > %d字符)，已裁剪: %s",
+			promptLen, budget, strings.Join(trimmed, ", "))
+	}
+	return prompt
+}
+
+// trimMarketData 返回按级别裁剪后的行情数据副本（不修改原数据，原数据可能被多个交易员共享）
+func trimMarketData(data *market.Data, level int) *market.Data {
+	if data == nil || level <= trimNone {
+		return data
+	}
+	d := *data
+	d.HeikinAshi15m, d.HeikinAshi1h, d.HeikinAshi4h = nil, nil, nil
+	d.CandleShapes5m = tailCandles(d.CandleShapes5m, trimmedTailLen)
+	d.CandleShapes15m = tailCandles(d.CandleShapes15m, trimmedTailLen)
+	d.CandleShapes1h = tailCandles(d.CandleShapes1h, trimmedTailLen)
+	d.CandleShapes4h = tailCandles(d.CandleShapes4h, trimmedTailLen)
+	if level < trimSeries {
+		return &d
+	}
+
+	d.CandleShapes5m, d.CandleShapes15m, d.CandleShapes1h, d.CandleShapes4h = nil, nil, nil, nil
+	if s := d.IntradaySeries; s != nil {
+		c := *s
+		c.OBVValues = tailFloats(c.OBVValues, trimmedTailLen)
+		c.VolumeDeltas = tailFloats(c.VolumeDeltas, trimmedTailLen)
+		c.VWAPValues = tailFloats(c.VWAPValues, trimmedTailLen)
+		c.StochRSIK = tailFloats(c.StochRSIK, trimmedTailLen)
+		c.StochRSID = tailFloats(c.StochRSID, trimmedTailLen)
+		d.IntradaySeries = &c
+	}
+	if s := d.MidTermSeries15m; s != nil {
+		c := *s
+		c.MidPrices = tailFloats(c.MidPrices, trimmedTailLen)
+		c.EMA20Values = tailFloats(c.EMA20Values, trimmedTailLen)
+		c.MACDValues = tailMACD(c.MACDValues, trimmedTailLen)
+		c.RSI7Values = tailFloats(c.RSI7Values, trimmedTailLen)
+		c.StochRSIK = tailFloats(c.StochRSIK, trimmedTailLen)
+		c.StochRSID = tailFloats(c.StochRSID, trimmedTailLen)
+		d.MidTermSeries15m = &c
+	}
+	if s := d.MidTermSeries1h; s != nil {
+		c := *s
+		c.MidPrices = tailFloats(c.MidPrices, trimmedTailLen)
+		c.EMA20Values = tailFloats(c.EMA20Values, trimmedTailLen)
+		c.MACDValues = tailMACD(c.MACDValues, trimmedTailLen)
+		c.RSI7Values = tailFloats(c.RSI7Values, trimmedTailLen)
+		c.StochRSIK = tailFloats(c.StochRSIK, trimmedTailLen)
+		c.StochRSID = tailFloats(c.StochRSID, trimmedTailLen)
+		d.MidTermSeries1h = &c
+	}
+	if s := d.MidTermSeries4h; s != nil {
+		c := *s
+		c.MACDValues = tailMACD(c.MACDValues, trimmedTailLen)
+		c.RSI7Values = tailFloats(c.RSI7Values, trimmedTailLen)
+		c.StochRSIK = tailFloats(c.StochRSIK, trimmedTailLen)
+		c.StochRSID = tailFloats(c.StochRSID, trimmedTailLen)
+		d.MidTermSeries4h = &c
+	}
+	if level < trimSecondary {
+		return &d
+	}
+
+	d.Derivatives = nil
+	d.ICTPOI, d.ICTLiquidity, d.ICTPremiumDiscount = nil, nil, nil
+	d.VolumeProfile4h, d.VolumeProfile15m = nil, nil
+	d.PriceAction5m, d.PriceAction15m = nil, nil
+	d.ExtraSeries = nil
+	return &d
+}
+
+func tailFloats(values []float64, n int) []float64 {
+	if len(values) <= n {
+		return values
+	}
+	return values[len(values)-n:]
+}
+
+func tailMACD(values []*market.MACDSignal, n int) []*market.MACDSignal {
+	if len(values) <= n {
+		return values
+	}
+	return values[len(values)-n:]
+}
+
+func tailCandles(values []market.CandleShape, n int) []market.CandleShape {
+	if len(values) <= n {
+		return values
+	}
+	return values[len(values)-n:]
+}
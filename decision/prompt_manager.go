@@ -13,12 +13,14 @@ import (
 type PromptTemplate struct {
 	Name    string // 模板名称（文件名，不含扩展名）
 	Content string // 模板内容
+	UserID  string // 用户自定义模板所属用户，内置模板为空
 }
 
 // PromptManager 提示词管理器
 type PromptManager struct {
-	templates map[string]*PromptTemplate
-	mu        sync.RWMutex
+	templates     map[string]*PromptTemplate            // 内置模板（prompts目录）
+	userTemplates map[string]map[string]*PromptTemplate // 用户自定义模板 userID -> name -> 模板
+	mu            sync.RWMutex
 }
 
 var (
@@ -41,7 +43,8 @@ func init() {
 // NewPromptManager 创建提示词管理器
 func NewPromptManager() *PromptManager {
 	return &PromptManager{
-		templates: make(map[string]*PromptTemplate),
+		templates:     make(map[string]*PromptTemplate),
+		userTemplates: make(map[string]map[string]*PromptTemplate),
 	}
 }
 
@@ -139,6 +142,70 @@ func (pm *PromptManager) GetAllTemplates() []*PromptTemplate {
 	return templates
 }
 
+// IsBuiltinTemplate 判断是否为内置模板名称
+func (pm *PromptManager) IsBuiltinTemplate(name string) bool {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	_, exists := pm.templates[name]
+	return exists
+}
+
+// SetUserTemplates 替换指定用户的全部自定义模板（从数据库加载后调用）
+func (pm *PromptManager) SetUserTemplates(userID string, templates []*PromptTemplate) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	userTemplates := make(map[string]*PromptTemplate, len(templates))
+	for _, template := range templates {
+		userTemplates[template.Name] = &PromptTemplate{Name: template.Name, Content: template.Content, UserID: userID}
+	}
+	pm.userTemplates[userID] = userTemplates
+}
+
+// SetUserTemplate 创建或更新用户自定义模板
+func (pm *PromptManager) SetUserTemplate(userID, name, content string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.userTemplates[userID] == nil {
+		pm.userTemplates[userID] = make(map[string]*PromptTemplate)
+	}
+	pm.userTemplates[userID][name] = &PromptTemplate{Name: name, Content: content, UserID: userID}
+}
+
+// DeleteUserTemplate 删除用户自定义模板
+func (pm *PromptManager) DeleteUserTemplate(userID, name string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	delete(pm.userTemplates[userID], name)
+}
+
+// GetTemplateForUser 获取模板，优先查找用户自定义模板，其次内置模板
+func (pm *PromptManager) GetTemplateForUser(userID, name string) (*PromptTemplate, error) {
+	pm.mu.RLock()
+	template, exists := pm.userTemplates[userID][name]
+	pm.mu.RUnlock()
+	if exists {
+		return template, nil
+	}
+	return pm.GetTemplate(name)
+}
+
+// GetAllTemplatesForUser 获取内置模板与用户自定义模板的合集
+func (pm *PromptManager) GetAllTemplatesForUser(userID string) []*PromptTemplate {
+	templates := pm.GetAllTemplates()
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, template := range pm.userTemplates[userID] {
+		templates = append(templates, template)
+	}
+	return templates
+}
+
 // ReloadTemplates 重新加载所有模板
 func (pm *PromptManager) ReloadTemplates(dir string) error {
 	pm.mu.Lock()
@@ -160,11 +227,44 @@ func GetAllPromptTemplateNames() []string {
 	return globalPromptManager.GetAllTemplateNames()
 }
 
-// GetAllPromptTemplates 获取所有模板（全局函数）
+// GetAllPromptTemplates 获取所有内置模板（全局函数）
 func GetAllPromptTemplates() []*PromptTemplate {
 	return globalPromptManager.GetAllTemplates()
 }
 
+// GetAllPromptTemplatesForUser 获取内置模板与指定用户的自定义模板，userID 为空时只返回内置模板
+func GetAllPromptTemplatesForUser(userID string) []*PromptTemplate {
+	if userID == "" {
+		return globalPromptManager.GetAllTemplates()
+	}
+	return globalPromptManager.GetAllTemplatesForUser(userID)
+}
+
+// GetPromptTemplateForUser 获取指定用户可见的模板（自定义模板优先）
+func GetPromptTemplateForUser(userID, name string) (*PromptTemplate, error) {
+	return globalPromptManager.GetTemplateForUser(userID, name)
+}
+
+// IsBuiltinPromptTemplate 判断是否为内置模板名称
+func IsBuiltinPromptTemplate(name string) bool {
+	return globalPromptManager.IsBuiltinTemplate(name)
+}
+
+// SetUserPromptTemplates 替换用户的全部自定义模板（全局函数）
+func SetUserPromptTemplates(userID string, templates []*PromptTemplate) {
+	globalPromptManager.SetUserTemplates(userID, templates)
+}
+
+// SetUserPromptTemplate 创建或更新用户自定义模板（全局函数）
+func SetUserPromptTemplate(userID, name, content string) {
+	globalPromptManager.SetUserTemplate(userID, name, content)
+}
+
+// DeleteUserPromptTemplate 删除用户自定义模板（全局函数）
+func DeleteUserPromptTemplate(userID, name string) {
+	globalPromptManager.DeleteUserTemplate(userID, name)
+}
+
 // ReloadPromptTemplates 重新加载所有模板（全局函数）
 func ReloadPromptTemplates() error {
 	return globalPromptManager.ReloadTemplates(promptsDir)
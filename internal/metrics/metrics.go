@@ -0,0 +1,84 @@
+// Package metrics 交易与API运行指标（/metrics 由 promhttp 以 Prometheus 格式导出，无需认证）
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 交易员指标（标签 trader_id）
+var (
+	TraderEquity = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nofx_trader_equity_usdt",
+		Help: "账户净值（USDT），每个决策周期更新",
+	}, []string{"trader_id"})
+	TraderUnrealizedPnL = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nofx_trader_unrealized_pnl_usdt",
+		Help: "持仓未实现盈亏合计（USDT）",
+	}, []string{"trader_id"})
+	TraderOpenPositions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nofx_trader_open_positions",
+		Help: "当前持仓数量",
+	}, []string{"trader_id"})
+	TraderPendingOrders = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "nofx_trader_pending_orders",
+		Help: "待成交限价单数量",
+	}, []string{"trader_id"})
+	DecisionCycles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nofx_decision_cycles_total",
+		Help: "已执行的决策周期数",
+	}, []string{"trader_id"})
+	DecisionFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nofx_decision_failures_total",
+		Help: "失败的决策周期数（构建上下文或获取AI决策失败）",
+	}, []string{"trader_id"})
+	AICallLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nofx_ai_call_duration_seconds",
+		Help:    "AI决策请求耗时（秒，含备用模型重试）",
+		Buckets: []float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"trader_id"})
+	OrderFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nofx_order_execution_failures_total",
+		Help: "决策动作执行失败次数",
+	}, []string{"trader_id", "action"})
+)
+
+// API指标
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nofx_http_requests_total",
+		Help: "API请求数",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nofx_http_request_duration_seconds",
+		Help:    "API请求耗时（秒）",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"method", "route"})
+)
+
+// traderVecs 带 trader_id 标签的指标，删除交易员时逐个清理
+var traderVecs = []*prometheus.MetricVec{
+	TraderEquity.MetricVec,
+	TraderUnrealizedPnL.MetricVec,
+	TraderOpenPositions.MetricVec,
+	TraderPendingOrders.MetricVec,
+	DecisionCycles.MetricVec,
+	DecisionFailures.MetricVec,
+	AICallLatency.MetricVec,
+	OrderFailures.MetricVec,
+}
+
+// DeleteTrader 清理交易员的所有指标（交易员被删除后调用）
+func DeleteTrader(traderID string) {
+	for _, vec := range traderVecs {
+		vec.DeletePartialMatch(prometheus.Labels{"trader_id": traderID})
+	}
+}
+
+// Handler 导出默认注册表（含 Go 运行时与进程指标）的 HTTP handler
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
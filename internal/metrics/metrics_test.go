@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+// scrape 请求 /metrics 并用 expfmt 解析输出
+func scrape(t *testing.T) map[string]*dto.MetricFamily {
+	t.Helper()
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(w.Body)
+	if err != nil {
+		t.Fatalf("解析 /metrics 输出失败: %v", err)
+	}
+	return families
+}
+
+// findMetric 按标签查找序列，不存在时返回 nil
+func findMetric(mf *dto.MetricFamily, labels map[string]string) *dto.Metric {
+	if mf == nil {
+		return nil
+	}
+	for _, m := range mf.GetMetric() {
+		matched := 0
+		for _, lp := range m.GetLabel() {
+			if v, ok := labels[lp.GetName()]; ok && v == lp.GetValue() {
+				matched++
+			}
+		}
+		if matched == len(labels) {
+			return m
+		}
+	}
+	return nil
+}
+
+// TestConcurrentUpdates 测试多个 goroutine 并发更新计数器和直方图
+func TestConcurrentUpdates(t *testing.T) {
+	defer DeleteTrader("concurrent")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				DecisionCycles.WithLabelValues("concurrent").Inc()
+				AICallLatency.WithLabelValues("concurrent").Observe(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := testutil.ToFloat64(DecisionCycles.WithLabelValues("concurrent")); got != 8000 {
+		t.Errorf("cycles = %v, want 8000", got)
+	}
+	m := findMetric(scrape(t)["nofx_ai_call_duration_seconds"], map[string]string{"trader_id": "concurrent"})
+	if m == nil || m.GetHistogram().GetSampleCount() != 8000 {
+		t.Errorf("latency count 应为 8000，实际 %v", m)
+	}
+}
+
+// TestExposition 测试导出内容可被 expfmt 解析，且删除交易员后不再导出其序列
+func TestExposition(t *testing.T) {
+	defer DeleteTrader("expo-a")
+	defer DeleteTrader("expo-b")
+
+	TraderEquity.WithLabelValues("expo-a").Set(980)
+	TraderEquity.WithLabelValues("expo-b").Set(1050.5)
+	OrderFailures.WithLabelValues("expo-a", `open"long`).Add(2)
+	AICallLatency.WithLabelValues("expo-a").Observe(0.5)
+	AICallLatency.WithLabelValues("expo-a").Observe(3)
+	AICallLatency.WithLabelValues("expo-a").Observe(500)
+
+	families := scrape(t)
+	equity := families["nofx_trader_equity_usdt"]
+	if equity.GetType() != dto.MetricType_GAUGE {
+		t.Errorf("equity 类型 = %v, want GAUGE", equity.GetType())
+	}
+	if m := findMetric(equity, map[string]string{"trader_id": "expo-b"}); m.GetGauge().GetValue() != 1050.5 {
+		t.Errorf("expo-b equity = %v, want 1050.5", m)
+	}
+	failures := findMetric(families["nofx_order_execution_failures_total"],
+		map[string]string{"trader_id": "expo-a", "action": `open"long`})
+	if failures.GetCounter().GetValue() != 2 {
+		t.Errorf("order failures = %v, want 2", failures)
+	}
+	latency := findMetric(families["nofx_ai_call_duration_seconds"], map[string]string{"trader_id": "expo-a"}).GetHistogram()
+	if latency.GetSampleCount() != 3 || latency.GetSampleSum() != 503.5 {
+		t.Errorf("latency count/sum = %d/%v, want 3/503.5", latency.GetSampleCount(), latency.GetSampleSum())
+	}
+	// 首个桶上界为1，只有0.5落入
+	if b := latency.GetBucket()[0]; b.GetUpperBound() != 1 || b.GetCumulativeCount() != 1 {
+		t.Errorf("首个桶 = %v, want le=1 count=1", b)
+	}
+	if _, ok := families["go_goroutines"]; !ok {
+		t.Error("promhttp 默认注册表应导出 Go 运行时指标")
+	}
+
+	DeleteTrader("expo-a")
+	families = scrape(t)
+	for _, name := range []string{"nofx_trader_equity_usdt", "nofx_order_execution_failures_total", "nofx_ai_call_duration_seconds"} {
+		if m := findMetric(families[name], map[string]string{"trader_id": "expo-a"}); m != nil {
+			t.Errorf("删除后不应再导出 %s 中 trader expo-a 的序列: %v", name, m)
+		}
+	}
+	if findMetric(families["nofx_trader_equity_usdt"], map[string]string{"trader_id": "expo-b"}) == nil {
+		t.Error("删除 expo-a 不应影响 expo-b")
+	}
+}
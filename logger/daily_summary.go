@@ -0,0 +1,316 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTakerFeeRate 默认手续费率（用于估算每日手续费，Binance U本位taker 0.04%）
+const DefaultTakerFeeRate = 0.0004
+
+// maxDailyEvents 每日汇总中保留的事件数量上限
+const maxDailyEvents = 20
+
+// DailySummary 交易员每日汇总
+type DailySummary struct {
+	TraderID      string         `json:"trader_id"`
+	Date          string         `json:"date"` // YYYY-MM-DD（本地时间）
+	GeneratedAt   time.Time      `json:"generated_at"`
+	TotalCycles   int            `json:"total_cycles"`
+	FailedCycles  int            `json:"failed_cycles"`
+	OpenedTrades  int            `json:"opened_trades"`  // 当日开仓次数
+	ClosedTrades  int            `json:"closed_trades"`  // 当日平仓（完成）交易数
+	WinningTrades int            `json:"winning_trades"` // 盈利交易数
+	LosingTrades  int            `json:"losing_trades"`  // 亏损交易数
+	WinRate       float64        `json:"win_rate"`       // 胜率（%）
+	RealizedPnL   float64        `json:"realized_pnl"`   // 已实现盈亏（USDT）
+	EstimatedFees float64        `json:"estimated_fees"` // 估算手续费（USDT）
+	NetPnL        float64        `json:"net_pnl"`        // 扣除手续费后的盈亏
+	StopLossHits  int            `json:"stop_loss_hits"` // 止损次数
+	StartEquity   float64        `json:"start_equity"`   // 当日首个周期净值
+	EndEquity     float64        `json:"end_equity"`     // 当日最后周期净值
+	Trades        []TradeOutcome `json:"trades"`         // 当日完成的交易
+	Events        []string       `json:"events"`         // 值得关注的事件（止损、执行失败、周期错误等）
+}
+
+// GenerateDailySummary 根据决策日志生成指定日期的汇总
+// feeRate <= 0 时使用 DefaultTakerFeeRate；前一日未平仓的持仓用于配对当日平仓
+func (l *DecisionLogger) GenerateDailySummary(traderID string, day time.Time, feeRate float64) (*DailySummary, error) {
+	if feeRate <= 0 {
+		feeRate = DefaultTakerFeeRate
+	}
+
+	records, err := l.GetRecordByDate(day)
+	if err != nil {
+		return nil, fmt.Errorf("读取当日决策记录失败: %w", err)
+	}
+
+	summary := &DailySummary{
+		TraderID:    traderID,
+		Date:        day.Format("2006-01-02"),
+		GeneratedAt: time.Now(),
+		Trades:      []TradeOutcome{},
+		Events:      []string{},
+	}
+
+	// 用前一日记录恢复跨日持仓，避免隔夜仓位的平仓无法配对
+	openPositions := make(map[string]map[string]interface{})
+	if prevRecords, err := l.GetRecordByDate(day.AddDate(0, 0, -1)); err == nil {
+		collectTradeOutcomes(prevRecords, openPositions)
+	}
+
+	for _, record := range records {
+		summary.TotalCycles++
+		if !record.Success {
+			summary.FailedCycles++
+			if record.ErrorMessage != "" {
+				summary.addEvent(record.Timestamp, "周期失败: "+record.ErrorMessage)
+			}
+		}
+		if equity := record.AccountState.TotalBalance; equity > 0 {
+			if summary.StartEquity == 0 {
+				summary.StartEquity = equity
+			}
+			summary.EndEquity = equity
+		}
+
+		for _, action := range record.Decisions {
+			if !action.Success {
+				if action.Error != "" {
+					summary.addEvent(action.Timestamp, fmt.Sprintf("%s %s 执行失败: %s", action.Symbol, action.Action, action.Error))
+				}
+				continue
+			}
+			switch action.Action {
+			case "open_long", "open_short":
+				summary.OpenedTrades++
+				summary.EstimatedFees += action.Quantity * action.Price * feeRate
+			}
+			if action.Status == "ABORTED" {
+				summary.addEvent(action.Timestamp, fmt.Sprintf("%s %s 放弃执行: %s", action.Symbol, action.Action, action.Reason))
+			}
+		}
+	}
+
+	for _, trade := range collectTradeOutcomes(records, openPositions) {
+		summary.Trades = append(summary.Trades, trade)
+		summary.ClosedTrades++
+		summary.RealizedPnL += trade.PnL
+		summary.EstimatedFees += trade.Quantity * trade.ClosePrice * feeRate
+		if trade.PnL > 0 {
+			summary.WinningTrades++
+		} else if trade.PnL < 0 {
+			summary.LosingTrades++
+		}
+		if trade.WasStopLoss {
+			summary.StopLossHits++
+			summary.addEvent(trade.CloseTime, fmt.Sprintf("%s %s 止损出场 PnL=%.2f", trade.Symbol, trade.Side, trade.PnL))
+		}
+	}
+
+	if summary.ClosedTrades > 0 {
+		summary.WinRate = float64(summary.WinningTrades) / float64(summary.ClosedTrades) * 100
+	}
+	summary.NetPnL = summary.RealizedPnL - summary.EstimatedFees
+	return summary, nil
+}
+
+// addEvent 记录事件（超过上限后丢弃）
+func (s *DailySummary) addEvent(ts time.Time, text string) {
+	if len(s.Events) >= maxDailyEvents {
+		return
+	}
+	if !ts.IsZero() {
+		text = ts.Format("15:04") + " " + text
+	}
+	s.Events = append(s.Events, text)
+}
+
+// Format 生成便于推送/阅读的文本摘要
+func (s *DailySummary) Format() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📊 [%s] %s 每日汇总\n", s.TraderID, s.Date))
+	sb.WriteString(fmt.Sprintf("周期: %d (失败 %d) | 开仓: %d | 平仓: %d\n", s.TotalCycles, s.FailedCycles, s.OpenedTrades, s.ClosedTrades))
+	sb.WriteString(fmt.Sprintf("胜率: %.1f%% (%d胜/%d负) | 止损: %d次\n", s.WinRate, s.WinningTrades, s.LosingTrades, s.StopLossHits))
+	sb.WriteString(fmt.Sprintf("已实现盈亏: %+.2f USDT | 估算手续费: %.2f | 净盈亏: %+.2f\n", s.RealizedPnL, s.EstimatedFees, s.NetPnL))
+	if s.StartEquity > 0 {
+		sb.WriteString(fmt.Sprintf("净值: %.2f → %.2f\n", s.StartEquity, s.EndEquity))
+	}
+	for _, event := range s.Events {
+		sb.WriteString("• " + event + "\n")
+	}
+	return sb.String()
+}
+
+// SaveDailySummary 将汇总保存到日志目录下的 daily_summaries 子目录（作为审计记录）
+func (l *DecisionLogger) SaveDailySummary(summary *DailySummary) error {
+	dir := filepath.Join(l.logDir, "daily_summaries")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建汇总目录失败: %w", err)
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化每日汇总失败: %w", err)
+	}
+	filename := fmt.Sprintf("summary_%s.json", strings.ReplaceAll(summary.Date, "-", ""))
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return fmt.Errorf("写入每日汇总失败: %w", err)
+	}
+	return nil
+}
+
+// maxDailyPnLDays 按日盈亏最多统计的天数
+const maxDailyPnLDays = 365
+
+// DailyPnL 单日已实现盈亏（按平仓时间归属日期）
+type DailyPnL struct {
+	Date        string  `json:"date"`         // YYYY-MM-DD（按请求时区）
+	RealizedPnL float64 `json:"realized_pnl"` // 已实现盈亏（USDT，未扣手续费）
+	TradeCount  int     `json:"trade_count"`  // 完成的交易数
+	WinCount    int     `json:"win_count"`    // 盈利交易数
+	Fees        float64 `json:"fees"`         // 估算手续费（开仓+平仓名义价值 × DefaultTakerFeeRate）
+}
+
+// DailyPnLSummary 按日统计最近 days 天（含今天）的已实现盈亏，无交易的日期也返回零值以便绘制连续曲线
+// loc 为 nil 时按 UTC 划分日期；days <= 0 时默认30天，最多365天
+func (l *DecisionLogger) DailyPnLSummary(days int, loc *time.Location) ([]DailyPnL, error) {
+	if days <= 0 {
+		days = 30
+	}
+	if days > maxDailyPnLDays {
+		days = maxDailyPnLDays
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	records, err := l.GetLatestRecords(0)
+	if err != nil {
+		return nil, fmt.Errorf("读取决策记录失败: %w", err)
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	result := make([]DailyPnL, days)
+	index := make(map[string]int, days)
+	for i := range result {
+		date := today.AddDate(0, 0, i-days+1).Format("2006-01-02")
+		result[i] = DailyPnL{Date: date}
+		index[date] = i
+	}
+
+	for _, trade := range collectTradeOutcomes(records, make(map[string]map[string]interface{})) {
+		i, ok := index[trade.CloseTime.In(loc).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		day := &result[i]
+		day.RealizedPnL += trade.PnL
+		day.TradeCount++
+		if trade.PnL > 0 {
+			day.WinCount++
+		}
+		day.Fees += trade.Quantity * (trade.OpenPrice + trade.ClosePrice) * DefaultTakerFeeRate
+	}
+	return result, nil
+}
+
+// DailySummarySink 每日汇总的输出目标（通知推送、审计存储等）
+type DailySummarySink func(summary *DailySummary) error
+
+// DailySummaryScheduler 每日汇总调度器：每天在指定本地时间生成当天的汇总并分发到各输出目标
+type DailySummaryScheduler struct {
+	logger   *DecisionLogger
+	traderID string
+	hour     int
+	minute   int
+	feeRate  float64
+	sinks    []DailySummarySink
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// ParseReportTime 解析 "HH:MM" 格式的本地时间
+func ParseReportTime(value string) (hour, minute int, err error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("无效的汇总时间 %q，格式应为 HH:MM", value)
+	}
+	hour, err1 := strconv.Atoi(parts[0])
+	minute, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("无效的汇总时间 %q，格式应为 HH:MM", value)
+	}
+	return hour, minute, nil
+}
+
+// NewDailySummaryScheduler 创建每日汇总调度器，reportTime 为本地时间 "HH:MM"
+func NewDailySummaryScheduler(l *DecisionLogger, traderID, reportTime string, feeRate float64, sinks ...DailySummarySink) (*DailySummaryScheduler, error) {
+	hour, minute, err := ParseReportTime(reportTime)
+	if err != nil {
+		return nil, err
+	}
+	return &DailySummaryScheduler{
+		logger:   l,
+		traderID: traderID,
+		hour:     hour,
+		minute:   minute,
+		feeRate:  feeRate,
+		sinks:    sinks,
+		stopCh:   make(chan struct{}),
+	}, nil
+}
+
+// nextReportTime 计算 now 之后下一次触发时间
+func nextReportTime(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Start 在后台启动调度
+func (s *DailySummaryScheduler) Start() {
+	go func() {
+		for {
+			next := nextReportTime(time.Now(), s.hour, s.minute)
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+				if _, err := s.RunOnce(next); err != nil {
+					fmt.Printf("⚠ 生成每日汇总失败: %v\n", err)
+				}
+			case <-s.stopCh:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止调度
+func (s *DailySummaryScheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+}
+
+// RunOnce 立即生成指定日期的汇总并分发到所有输出目标
+func (s *DailySummaryScheduler) RunOnce(day time.Time) (*DailySummary, error) {
+	summary, err := s.logger.GenerateDailySummary(s.traderID, day, s.feeRate)
+	if err != nil {
+		return nil, err
+	}
+	for _, sink := range s.sinks {
+		if err := sink(summary); err != nil {
+			fmt.Printf("⚠ 每日汇总输出失败: %v\n", err)
+		}
+	}
+	return summary, nil
+}
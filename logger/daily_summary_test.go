@@ -0,0 +1,139 @@
+package logger
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenerateDailySummaryTotals(t *testing.T) {
+	dir := t.TempDir()
+	l := NewDecisionLogger(dir)
+	now := time.Now()
+
+	// 一个周期内：BTC多单盈利平仓，ETH空单止损亏损，SOL开仓失败
+	if err := l.LogDecision(&DecisionRecord{
+		Success:      true,
+		AccountState: AccountSnapshot{TotalBalance: 1000},
+		Decisions: []DecisionAction{
+			{Action: "open_long", Symbol: "BTCUSDT", Quantity: 0.1, Leverage: 5, Price: 100000, Timestamp: now, Success: true},
+			{Action: "open_short", Symbol: "ETHUSDT", Quantity: 1, Leverage: 5, Price: 4000, Timestamp: now, Success: true},
+			{Action: "close_long", Symbol: "BTCUSDT", Quantity: 0.1, Price: 101000, Timestamp: now, Success: true},
+			{Action: "close_short", Symbol: "ETHUSDT", Quantity: 1, Price: 4040, Timestamp: now, Success: true, WasStopLoss: true},
+			{Action: "open_long", Symbol: "SOLUSDT", Quantity: 10, Price: 200, Timestamp: now, Success: false, Error: "insufficient margin"},
+		},
+	}); err != nil {
+		t.Fatalf("LogDecision: %v", err)
+	}
+	if err := l.LogDecision(&DecisionRecord{
+		Success:      false,
+		ErrorMessage: "AI调用失败",
+		AccountState: AccountSnapshot{TotalBalance: 1060},
+	}); err != nil {
+		t.Fatalf("LogDecision: %v", err)
+	}
+
+	summary, err := l.GenerateDailySummary("trader_1", now, 0.001)
+	if err != nil {
+		t.Fatalf("GenerateDailySummary: %v", err)
+	}
+
+	if summary.TotalCycles != 2 || summary.FailedCycles != 1 {
+		t.Fatalf("cycles = %d/%d, want 2/1", summary.TotalCycles, summary.FailedCycles)
+	}
+	if summary.OpenedTrades != 2 || summary.ClosedTrades != 2 {
+		t.Fatalf("opened/closed = %d/%d, want 2/2", summary.OpenedTrades, summary.ClosedTrades)
+	}
+	if summary.WinningTrades != 1 || summary.LosingTrades != 1 || summary.WinRate != 50 {
+		t.Fatalf("wins/losses/rate = %d/%d/%.1f, want 1/1/50", summary.WinningTrades, summary.LosingTrades, summary.WinRate)
+	}
+	if summary.StopLossHits != 1 {
+		t.Fatalf("StopLossHits = %d, want 1", summary.StopLossHits)
+	}
+
+	// BTC: +100，ETH: -40
+	assertClose(t, "RealizedPnL", summary.RealizedPnL, 60)
+	// 手续费 = (10000 + 4000 + 10100 + 4040) × 0.1%
+	assertClose(t, "EstimatedFees", summary.EstimatedFees, 28.14)
+	assertClose(t, "NetPnL", summary.NetPnL, 31.86)
+
+	if summary.StartEquity != 1000 || summary.EndEquity != 1060 {
+		t.Fatalf("equity = %.2f → %.2f, want 1000 → 1060", summary.StartEquity, summary.EndEquity)
+	}
+	// 周期失败、执行失败、止损各一条
+	if len(summary.Events) != 3 {
+		t.Fatalf("Events = %v, want 3 entries", summary.Events)
+	}
+
+	if err := l.SaveDailySummary(summary); err != nil {
+		t.Fatalf("SaveDailySummary: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "daily_summaries", "summary_"+now.Format("20060102")+".json")); err != nil {
+		t.Fatalf("summary file not written: %v", err)
+	}
+}
+
+func TestParseReportTime(t *testing.T) {
+	hour, minute, err := ParseReportTime("08:30")
+	if err != nil || hour != 8 || minute != 30 {
+		t.Fatalf("ParseReportTime(08:30) = %d, %d, %v", hour, minute, err)
+	}
+	for _, value := range []string{"", "8", "24:00", "12:60", "ab:cd"} {
+		if _, _, err := ParseReportTime(value); err == nil {
+			t.Errorf("ParseReportTime(%q) expected error", value)
+		}
+	}
+}
+
+func TestNextReportTime(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.Local)
+
+	if got := nextReportTime(now, 23, 55); !got.Equal(time.Date(2025, 1, 10, 23, 55, 0, 0, time.Local)) {
+		t.Errorf("later today: got %v", got)
+	}
+	if got := nextReportTime(now, 12, 0); !got.Equal(time.Date(2025, 1, 11, 12, 0, 0, 0, time.Local)) {
+		t.Errorf("same minute should roll to tomorrow: got %v", got)
+	}
+}
+
+func assertClose(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-6 {
+		t.Fatalf("%s = %.6f, want %.6f", name, got, want)
+	}
+}
+
+func TestDailyPnLSummary(t *testing.T) {
+	l := NewDecisionLogger(t.TempDir())
+	now := time.Now().UTC()
+	twoDaysAgo := now.AddDate(0, 0, -2)
+
+	l.LogDecision(&DecisionRecord{Success: true, Decisions: []DecisionAction{
+		{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Leverage: 5, Price: 100, Timestamp: twoDaysAgo, Success: true},
+		{Action: "close_long", Symbol: "BTCUSDT", Quantity: 1, Price: 110, Timestamp: twoDaysAgo, Success: true},
+		{Action: "open_short", Symbol: "ETHUSDT", Quantity: 2, Leverage: 5, Price: 50, Timestamp: now, Success: true},
+		{Action: "close_short", Symbol: "ETHUSDT", Quantity: 2, Price: 55, Timestamp: now, Success: true},
+	}})
+
+	daily, err := l.DailyPnLSummary(3, nil)
+	if err != nil {
+		t.Fatalf("DailyPnLSummary: %v", err)
+	}
+	if len(daily) != 3 {
+		t.Fatalf("应返回连续 3 天, got %d", len(daily))
+	}
+	if daily[0].Date != twoDaysAgo.Format("2006-01-02") || daily[2].Date != now.Format("2006-01-02") {
+		t.Errorf("日期范围不正确: %s ~ %s", daily[0].Date, daily[2].Date)
+	}
+	if d := daily[0]; d.RealizedPnL != 10 || d.TradeCount != 1 || d.WinCount != 1 || math.Abs(d.Fees-210*DefaultTakerFeeRate) > 1e-9 {
+		t.Errorf("两天前 = %+v", d)
+	}
+	if d := daily[1]; d.TradeCount != 0 || d.RealizedPnL != 0 {
+		t.Errorf("无交易的日期应为零值: %+v", d)
+	}
+	if d := daily[2]; d.RealizedPnL != -10 || d.TradeCount != 1 || d.WinCount != 0 {
+		t.Errorf("今天 = %+v", d)
+	}
+}
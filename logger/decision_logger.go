@@ -7,6 +7,8 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -21,8 +23,8 @@ type ValidationError struct {
 type DecisionRecord struct {
 	Timestamp      time.Time          `json:"timestamp"`       // 决策时间
 	CycleNumber    int                `json:"cycle_number"`    // 周期编号
-	SystemPrompt   string             `json:"system_prompt"`   // 系统提示词（发送给AI的系统prompt）
-	InputPrompt    string             `json:"input_prompt"`    // 发送给AI的输入prompt
+	SystemPrompt   string             `json:"system_prompt,omitempty"` // 系统提示词（发送给AI的系统prompt）
+	InputPrompt    string             `json:"input_prompt,omitempty"`  // 发送给AI的输入prompt
 	CoTTrace       string             `json:"cot_trace"`       // AI思维链（输出）
 	DecisionJSON   string             `json:"decision_json"`   // 决策JSON
 	AccountState   AccountSnapshot    `json:"account_state"`   // 账户状态快照
@@ -36,6 +38,7 @@ type DecisionRecord struct {
 	ErrorType        string             `json:"error_type,omitempty"` // 错误类型
 	ErrorSeverity    string             `json:"error_severity,omitempty"` // 错误严重程度: "warning"|"error"
 	ValidationErrors []ValidationError  `json:"validation_errors,omitempty"` // 验证错误详情
+	AIModel          string             `json:"ai_model,omitempty"` // 产生本轮决策的模型（主模型失败时为备用模型）
 
 	// PreLLM Gate相关字段
 	CooldownSkipLLM  bool     `json:"cooldown_skip_llm,omitempty"`  // 是否因冷却跳过LLM
@@ -80,6 +83,8 @@ type DecisionAction struct {
 	Status          string      `json:"status,omitempty"`           // 执行状态 (EXECUTED, ABORTED, etc.)
 	Reason          string      `json:"reason,omitempty"`           // 失败原因
 	ExecutionReport interface{} `json:"execution_report,omitempty"` // M2.2 执行报告
+	Commission      float64     `json:"commission,omitempty"`       // 成交手续费（限价执行报告提供时填充）
+	SlippageBps     float64     `json:"slippage_bps,omitempty"`     // 成交均价相对限价的滑点（基点），正值表示不利
 
 	// ExecutionGate 相关字段
 	GateMode            string `json:"gate_mode,omitempty"`            // limit_only/limit_preferred/market_ok
@@ -89,14 +94,36 @@ type DecisionAction struct {
 
 	// 止损相关字段
 	StopLossSource string `json:"stop_loss_source,omitempty"` // 止损来源: structure/formula
+
+	SymbolDataSource string `json:"symbol_data_source,omitempty"` // 决策币种数据来源: cycle(本周期已分析)/lazy_fetch(不在分析集合内，按需补拉)
 	Override            bool   `json:"override,omitempty"`             // 是否被 gate 强制改写
+	Simulated           bool   `json:"simulated,omitempty"`            // 影子模式模拟执行（未向交易所发送订单）
 	OverrideReason      string `json:"override_reason,omitempty"`      // 强制改写原因
 }
 
+const (
+	defaultBufferMaxRecords    = 20              // 缓冲写入默认每攒够多少条记录落盘一次
+	defaultBufferFlushInterval = 5 * time.Second // 缓冲写入默认落盘间隔
+)
+
 // DecisionLogger 决策日志记录器
 type DecisionLogger struct {
 	logDir      string
 	cycleNumber int
+
+	// 缓冲写入（EnableBuffering 开启）：记录先放入内存，按数量/间隔批量落盘；读取前先落盘
+	mu          sync.Mutex
+	buffering   bool
+	pending     []pendingRecord
+	maxPending  int
+	stopFlusher chan struct{}
+	flusherDone chan struct{}
+}
+
+// pendingRecord 待落盘的决策记录
+type pendingRecord struct {
+	filename string
+	data     []byte
 }
 
 // NewDecisionLogger 创建决策日志记录器
@@ -116,6 +143,11 @@ func NewDecisionLogger(logDir string) *DecisionLogger {
 	}
 }
 
+// LogDir 决策记录所在目录（交易员的其他运行时文件也保存在此目录）
+func (l *DecisionLogger) LogDir() string {
+	return l.logDir
+}
+
 // LogDecision 记录决策
 func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 	l.cycleNumber++
@@ -127,16 +159,27 @@ func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 		record.Timestamp.Format("20060102_150405"),
 		record.CycleNumber)
 
-	filepath := filepath.Join(l.logDir, filename)
-
 	// 序列化为JSON（带缩进，方便阅读）
 	data, err := json.MarshalIndent(record, "", "  ")
 	if err != nil {
 		return fmt.Errorf("序列化决策记录失败: %w", err)
 	}
 
+	// 缓冲模式：攒够 maxPending 条再批量写入
+	l.mu.Lock()
+	if l.buffering {
+		l.pending = append(l.pending, pendingRecord{filename: filename, data: data})
+		full := len(l.pending) >= l.maxPending
+		l.mu.Unlock()
+		if full {
+			return l.Flush()
+		}
+		return nil
+	}
+	l.mu.Unlock()
+
 	// 写入文件
-	if err := ioutil.WriteFile(filepath, data, 0644); err != nil {
+	if err := ioutil.WriteFile(filepath.Join(l.logDir, filename), data, 0644); err != nil {
 		return fmt.Errorf("写入决策记录失败: %w", err)
 	}
 
@@ -144,8 +187,89 @@ func (l *DecisionLogger) LogDecision(record *DecisionRecord) error {
 	return nil
 }
 
+// EnableBuffering 开启缓冲写入：记录每攒够 maxRecords 条或每隔 flushInterval 批量落盘
+// maxRecords/flushInterval <= 0 时使用默认值（20条 / 5秒）；重复调用只更新批量大小
+func (l *DecisionLogger) EnableBuffering(maxRecords int, flushInterval time.Duration) {
+	if maxRecords <= 0 {
+		maxRecords = defaultBufferMaxRecords
+	}
+	if flushInterval <= 0 {
+		flushInterval = defaultBufferFlushInterval
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxPending = maxRecords
+	if l.buffering {
+		return
+	}
+	l.buffering = true
+	l.stopFlusher = make(chan struct{})
+	l.flusherDone = make(chan struct{})
+	go l.runFlusher(flushInterval, l.stopFlusher, l.flusherDone)
+}
+
+// runFlusher 定时落盘缓冲中的记录，直到 stop 关闭
+func (l *DecisionLogger) runFlusher(interval time.Duration, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.Flush(); err != nil {
+				fmt.Printf("⚠ 定时落盘决策记录失败: %v\n", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Flush 将缓冲中的记录全部写入磁盘（写入失败的记录保留在缓冲中，下次重试）
+func (l *DecisionLogger) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) == 0 {
+		return nil
+	}
+
+	for i, rec := range l.pending {
+		if err := ioutil.WriteFile(filepath.Join(l.logDir, rec.filename), rec.data, 0644); err != nil {
+			l.pending = l.pending[i:]
+			return fmt.Errorf("写入决策记录失败: %w", err)
+		}
+	}
+	fmt.Printf("📝 已批量保存 %d 条决策记录\n", len(l.pending))
+	l.pending = nil
+	return nil
+}
+
+// Stop 停止定时落盘并写入缓冲中的全部记录，之后恢复为逐条同步写入（可重复调用）
+func (l *DecisionLogger) Stop() error {
+	l.mu.Lock()
+	stop, done := l.stopFlusher, l.flusherDone
+	l.buffering = false
+	l.stopFlusher, l.flusherDone = nil, nil
+	l.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return l.Flush()
+}
+
+// flushBeforeRead 读取前先落盘缓冲中的记录，保证读到最新数据
+func (l *DecisionLogger) flushBeforeRead() {
+	if err := l.Flush(); err != nil {
+		fmt.Printf("⚠ 读取前落盘决策记录失败: %v\n", err)
+	}
+}
+
 // GetLatestRecords 获取最近N条记录（按时间正序：从旧到新）
 func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
+	l.flushBeforeRead()
 	files, err := ioutil.ReadDir(l.logDir)
 	if err != nil {
 		return nil, fmt.Errorf("读取日志目录失败: %w", err)
@@ -185,8 +309,52 @@ func (l *DecisionLogger) GetLatestRecords(n int) ([]*DecisionRecord, error) {
 	return records, nil
 }
 
+// GetRecordsPage 分页获取记录：跳过最新的 offset 条后取 limit 条（页内按时间正序：从旧到新），同时返回记录总数
+// 按文件名（含时间戳）定位，只反序列化本页的文件
+func (l *DecisionLogger) GetRecordsPage(offset, limit int) ([]*DecisionRecord, int, error) {
+	l.flushBeforeRead()
+	files, err := ioutil.ReadDir(l.logDir)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取日志目录失败: %w", err)
+	}
+
+	var names []string
+	for _, file := range files {
+		if !file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	total := len(names)
+	if offset < 0 {
+		offset = 0
+	}
+
+	// names 按时间正序，本页为 [total-offset-limit, total-offset)
+	end := total - offset
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	records := make([]*DecisionRecord, 0, max(end-start, 0))
+	for i := start; i < end; i++ {
+		data, err := ioutil.ReadFile(filepath.Join(l.logDir, names[i]))
+		if err != nil {
+			continue
+		}
+
+		var record DecisionRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+
+	return records, total, nil
+}
+
 // GetRecordByDate 获取指定日期的所有记录
 func (l *DecisionLogger) GetRecordByDate(date time.Time) ([]*DecisionRecord, error) {
+	l.flushBeforeRead()
 	dateStr := date.Format("20060102")
 	pattern := filepath.Join(l.logDir, fmt.Sprintf("decision_%s_*.json", dateStr))
 
@@ -213,6 +381,31 @@ func (l *DecisionLogger) GetRecordByDate(date time.Time) ([]*DecisionRecord, err
 	return records, nil
 }
 
+// Clear 删除全部决策记录并重置周期编号
+func (l *DecisionLogger) Clear() error {
+	l.mu.Lock()
+	l.pending = nil
+	l.mu.Unlock()
+
+	files, err := ioutil.ReadDir(l.logDir)
+	if err != nil {
+		return fmt.Errorf("读取日志目录失败: %w", err)
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), "decision_") || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(l.logDir, file.Name())); err != nil {
+			return fmt.Errorf("删除决策记录失败 %s: %w", file.Name(), err)
+		}
+	}
+
+	l.cycleNumber = 0
+	fmt.Printf("🗑️ 已清空决策记录: %s\n", l.logDir)
+	return nil
+}
+
 // CleanOldRecords 清理N天前的旧记录
 func (l *DecisionLogger) CleanOldRecords(days int) error {
 	cutoffTime := time.Now().AddDate(0, 0, -days)
@@ -247,6 +440,7 @@ func (l *DecisionLogger) CleanOldRecords(days int) error {
 
 // GetStatistics 获取统计信息
 func (l *DecisionLogger) GetStatistics() (*Statistics, error) {
+	l.flushBeforeRead()
 	files, err := ioutil.ReadDir(l.logDir)
 	if err != nil {
 		return nil, fmt.Errorf("读取日志目录失败: %w", err)
@@ -412,6 +606,106 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 	}
 
 	// 遍历分析窗口内的记录，生成交易结果
+	for _, outcome := range collectTradeOutcomes(records, openPositions) {
+		pnl := outcome.PnL
+		analysis.RecentTrades = append(analysis.RecentTrades, outcome)
+		analysis.TotalTrades++
+
+		// 分类交易：盈利、亏损、持平（避免将pnl=0算入亏损）
+		if pnl > 0 {
+			analysis.WinningTrades++
+			analysis.AvgWin += pnl
+		} else if pnl < 0 {
+			analysis.LosingTrades++
+			analysis.AvgLoss += pnl
+		}
+		// pnl == 0 的交易不计入盈利也不计入亏损，但计入总交易数
+
+		// 更新币种统计
+		if _, exists := analysis.SymbolStats[outcome.Symbol]; !exists {
+			analysis.SymbolStats[outcome.Symbol] = &SymbolPerformance{
+				Symbol: outcome.Symbol,
+			}
+		}
+		stats := analysis.SymbolStats[outcome.Symbol]
+		stats.TotalTrades++
+		stats.TotalPnL += pnl
+		if pnl > 0 {
+			stats.WinningTrades++
+		} else if pnl < 0 {
+			stats.LosingTrades++
+		}
+	}
+
+	// 计算统计指标
+	if analysis.TotalTrades > 0 {
+		analysis.WinRate = (float64(analysis.WinningTrades) / float64(analysis.TotalTrades)) * 100
+
+		// 计算总盈利和总亏损
+		totalWinAmount := analysis.AvgWin   // 当前是累加的总和
+		totalLossAmount := analysis.AvgLoss // 当前是累加的总和（负数）
+
+		if analysis.WinningTrades > 0 {
+			analysis.AvgWin /= float64(analysis.WinningTrades)
+		}
+		if analysis.LosingTrades > 0 {
+			analysis.AvgLoss /= float64(analysis.LosingTrades)
+		}
+
+		// Profit Factor = 总盈利 / 总亏损（绝对值）
+		// 注意：totalLossAmount 是负数，所以取负号得到绝对值
+		if totalLossAmount != 0 {
+			analysis.ProfitFactor = totalWinAmount / (-totalLossAmount)
+		} else if totalWinAmount > 0 {
+			// 只有盈利没有亏损的情况，设置为一个很大的值表示完美策略
+			analysis.ProfitFactor = 999.0
+		}
+	}
+
+	// 计算各币种胜率和平均盈亏
+	bestPnL := -999999.0
+	worstPnL := 999999.0
+	for symbol, stats := range analysis.SymbolStats {
+		if stats.TotalTrades > 0 {
+			stats.WinRate = (float64(stats.WinningTrades) / float64(stats.TotalTrades)) * 100
+			stats.AvgPnL = stats.TotalPnL / float64(stats.TotalTrades)
+
+			if stats.TotalPnL > bestPnL {
+				bestPnL = stats.TotalPnL
+				analysis.BestSymbol = symbol
+			}
+			if stats.TotalPnL < worstPnL {
+				worstPnL = stats.TotalPnL
+				analysis.WorstSymbol = symbol
+			}
+		}
+	}
+
+	// 只保留最近的交易（倒序：最新的在前）
+	const maxRecentTrades = 100 // 增加到100笔，前端会按需滚动加载
+	if len(analysis.RecentTrades) > maxRecentTrades {
+		// 反转数组，让最新的在前
+		for i, j := 0, len(analysis.RecentTrades)-1; i < j; i, j = i+1, j-1 {
+			analysis.RecentTrades[i], analysis.RecentTrades[j] = analysis.RecentTrades[j], analysis.RecentTrades[i]
+		}
+		analysis.RecentTrades = analysis.RecentTrades[:maxRecentTrades]
+	} else if len(analysis.RecentTrades) > 0 {
+		// 反转数组
+		for i, j := 0, len(analysis.RecentTrades)-1; i < j; i, j = i+1, j-1 {
+			analysis.RecentTrades[i], analysis.RecentTrades[j] = analysis.RecentTrades[j], analysis.RecentTrades[i]
+		}
+	}
+
+	// 计算夏普比率（需要至少2个数据点）
+	analysis.SharpeRatio = l.calculateSharpeRatio(records)
+
+	return analysis, nil
+}
+
+// collectTradeOutcomes 按时间顺序配对开仓/平仓动作，生成交易结果
+// openPositions 为窗口外预先收集的未平仓持仓（symbol_side -> 开仓信息），会被原地更新
+func collectTradeOutcomes(records []*DecisionRecord, openPositions map[string]map[string]interface{}) []TradeOutcome {
+	var outcomes []TradeOutcome
 	for _, record := range records {
 		for _, action := range record.Decisions {
 			if !action.Success {
@@ -468,9 +762,14 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 
 					// 计算持仓时长
 					duration := action.Timestamp.Sub(openTime)
-					
-					// 记录交易结果
-					outcome := TradeOutcome{
+
+					// 调试日志：检测异常长的持仓时间
+					if duration.Hours() > 24 {
+						fmt.Printf("⚠️ 检测到异常长的持仓时间: %s %s, 持仓时长: %v (开仓: %v, 平仓: %v)\n",
+							symbol, side, duration, openTime, action.Timestamp)
+					}
+
+					outcomes = append(outcomes, TradeOutcome{
 						TradeID:       fmt.Sprintf("%s_%d_%d", symbol, openTime.Unix(), action.Timestamp.Unix()),
 						Symbol:        symbol,
 						Side:          side,
@@ -486,41 +785,7 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 						OpenTime:      openTime,
 						CloseTime:     action.Timestamp,
 						WasStopLoss:   action.WasStopLoss,
-					}
-					
-					// 调试日志：检测异常长的持仓时间
-					if duration.Hours() > 24 {
-						fmt.Printf("⚠️ 检测到异常长的持仓时间: %s %s, 持仓时长: %v (开仓: %v, 平仓: %v)\n",
-							symbol, side, duration, openTime, action.Timestamp)
-					}
-
-					analysis.RecentTrades = append(analysis.RecentTrades, outcome)
-					analysis.TotalTrades++
-
-					// 分类交易：盈利、亏损、持平（避免将pnl=0算入亏损）
-					if pnl > 0 {
-						analysis.WinningTrades++
-						analysis.AvgWin += pnl
-					} else if pnl < 0 {
-						analysis.LosingTrades++
-						analysis.AvgLoss += pnl
-					}
-					// pnl == 0 的交易不计入盈利也不计入亏损，但计入总交易数
-
-					// 更新币种统计
-					if _, exists := analysis.SymbolStats[symbol]; !exists {
-						analysis.SymbolStats[symbol] = &SymbolPerformance{
-							Symbol: symbol,
-						}
-					}
-					stats := analysis.SymbolStats[symbol]
-					stats.TotalTrades++
-					stats.TotalPnL += pnl
-					if pnl > 0 {
-						stats.WinningTrades++
-					} else if pnl < 0 {
-						stats.LosingTrades++
-					}
+					})
 
 					// 移除已平仓记录
 					delete(openPositions, posKey)
@@ -528,70 +793,7 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 			}
 		}
 	}
-
-	// 计算统计指标
-	if analysis.TotalTrades > 0 {
-		analysis.WinRate = (float64(analysis.WinningTrades) / float64(analysis.TotalTrades)) * 100
-
-		// 计算总盈利和总亏损
-		totalWinAmount := analysis.AvgWin   // 当前是累加的总和
-		totalLossAmount := analysis.AvgLoss // 当前是累加的总和（负数）
-
-		if analysis.WinningTrades > 0 {
-			analysis.AvgWin /= float64(analysis.WinningTrades)
-		}
-		if analysis.LosingTrades > 0 {
-			analysis.AvgLoss /= float64(analysis.LosingTrades)
-		}
-
-		// Profit Factor = 总盈利 / 总亏损（绝对值）
-		// 注意：totalLossAmount 是负数，所以取负号得到绝对值
-		if totalLossAmount != 0 {
-			analysis.ProfitFactor = totalWinAmount / (-totalLossAmount)
-		} else if totalWinAmount > 0 {
-			// 只有盈利没有亏损的情况，设置为一个很大的值表示完美策略
-			analysis.ProfitFactor = 999.0
-		}
-	}
-
-	// 计算各币种胜率和平均盈亏
-	bestPnL := -999999.0
-	worstPnL := 999999.0
-	for symbol, stats := range analysis.SymbolStats {
-		if stats.TotalTrades > 0 {
-			stats.WinRate = (float64(stats.WinningTrades) / float64(stats.TotalTrades)) * 100
-			stats.AvgPnL = stats.TotalPnL / float64(stats.TotalTrades)
-
-			if stats.TotalPnL > bestPnL {
-				bestPnL = stats.TotalPnL
-				analysis.BestSymbol = symbol
-			}
-			if stats.TotalPnL < worstPnL {
-				worstPnL = stats.TotalPnL
-				analysis.WorstSymbol = symbol
-			}
-		}
-	}
-
-	// 只保留最近的交易（倒序：最新的在前）
-	const maxRecentTrades = 100 // 增加到100笔，前端会按需滚动加载
-	if len(analysis.RecentTrades) > maxRecentTrades {
-		// 反转数组，让最新的在前
-		for i, j := 0, len(analysis.RecentTrades)-1; i < j; i, j = i+1, j-1 {
-			analysis.RecentTrades[i], analysis.RecentTrades[j] = analysis.RecentTrades[j], analysis.RecentTrades[i]
-		}
-		analysis.RecentTrades = analysis.RecentTrades[:maxRecentTrades]
-	} else if len(analysis.RecentTrades) > 0 {
-		// 反转数组
-		for i, j := 0, len(analysis.RecentTrades)-1; i < j; i, j = i+1, j-1 {
-			analysis.RecentTrades[i], analysis.RecentTrades[j] = analysis.RecentTrades[j], analysis.RecentTrades[i]
-		}
-	}
-
-	// 计算夏普比率（需要至少2个数据点）
-	analysis.SharpeRatio = l.calculateSharpeRatio(records)
-
-	return analysis, nil
+	return outcomes
 }
 
 // calculateSharpeRatio 计算夏普比率
@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func countRecordFiles(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	return len(entries)
+}
+
+func TestDecisionLoggerBuffering(t *testing.T) {
+	dir := t.TempDir()
+	l := NewDecisionLogger(dir)
+	l.EnableBuffering(3, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if err := l.LogDecision(&DecisionRecord{Success: true}); err != nil {
+			t.Fatalf("LogDecision: %v", err)
+		}
+	}
+	if n := countRecordFiles(t, dir); n != 0 {
+		t.Fatalf("未达到批量大小前不应写盘, files=%d", n)
+	}
+
+	// 读取前先落盘
+	records, err := l.GetLatestRecords(0)
+	if err != nil || len(records) != 2 {
+		t.Fatalf("读取应看到缓冲中的记录: len=%d err=%v", len(records), err)
+	}
+	if n := countRecordFiles(t, dir); n != 2 {
+		t.Errorf("读取后缓冲应已落盘, files=%d", n)
+	}
+
+	// 攒够 3 条自动落盘
+	for i := 0; i < 3; i++ {
+		l.LogDecision(&DecisionRecord{Success: true})
+	}
+	if n := countRecordFiles(t, dir); n != 5 {
+		t.Errorf("达到批量大小应落盘, files=%d", n)
+	}
+
+	// Stop 时落盘剩余记录，之后恢复同步写入
+	l.LogDecision(&DecisionRecord{Success: true})
+	if err := l.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if n := countRecordFiles(t, dir); n != 6 {
+		t.Errorf("Stop 后缓冲应全部落盘, files=%d", n)
+	}
+	if records, _ := NewDecisionLogger(dir).GetLatestRecords(0); len(records) != 6 {
+		t.Errorf("重新打开应读到全部 6 条记录, got %d", len(records))
+	}
+	l.LogDecision(&DecisionRecord{Success: true})
+	if n := countRecordFiles(t, dir); n != 7 {
+		t.Errorf("Stop 后应逐条同步写入, files=%d", n)
+	}
+	if err := l.Stop(); err != nil {
+		t.Errorf("重复 Stop 不应出错: %v", err)
+	}
+}
+
+func TestDecisionLoggerIntervalFlush(t *testing.T) {
+	dir := t.TempDir()
+	l := NewDecisionLogger(dir)
+	l.EnableBuffering(100, 20*time.Millisecond)
+	defer l.Stop()
+
+	l.LogDecision(&DecisionRecord{Success: true})
+	deadline := time.Now().Add(time.Second)
+	for countRecordFiles(t, dir) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("应按间隔定时落盘")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
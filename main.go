@@ -7,9 +7,12 @@ import (
 	"nofx/api"
 	"nofx/auth"
 	"nofx/config"
+	"nofx/decision"
+	"nofx/logger"
 	"nofx/manager"
 	"nofx/market"
 	"nofx/pool"
+	"nofx/trader"
 	"os"
 	"os/signal"
 	"strconv"
@@ -36,6 +39,17 @@ type ConfigFile struct {
 	StopTradingMinutes int            `json:"stop_trading_minutes"`
 	Leverage           LeverageConfig `json:"leverage"`
 	JWTSecret          string         `json:"jwt_secret"`
+	OpeningOrderType   string         `json:"opening_order_type"`  // 开仓订单类型: "auto" 或 "limit_maker"
+	DailySummaryTime   string         `json:"daily_summary_time"`  // 每日汇总生成时间（本地时间 "HH:MM"）
+	MinRewardRisk      float64        `json:"min_reward_risk"`     // 开仓最低盈亏比（TP3距离/止损距离）
+	MinTPDistancePct   float64        `json:"min_tp_distance_pct"` // 相邻TP分段最小间距（占当前价的百分比）
+	MarketDataSource   string         `json:"market_data_source"`  // 行情数据源: "binance"(默认)/"hyperliquid"/"aster"
+	UserDataStream     bool           `json:"user_data_stream"`    // 启用交易所用户数据流推送订单成交
+	MarketWebSocket    bool           `json:"market_websocket"`    // 启用 Binance 实时行情推送（仅 binance 行情源）
+	TP3TrailATRMult    float64        `json:"tp3_trail_atr_mult"`  // 到达TP3后剩余仓位按 N×ATR 移动止损（0 不启用）
+	TP3TrailPct        float64        `json:"tp3_trail_pct"`       // 到达TP3后剩余仓位按百分比移动止损（0 不启用）
+
+	ZoneMergeTolerancePct float64 `json:"zone_merge_tolerance_pct"` // 支撑/压力区合并容差（占价格的百分比）
 }
 
 // syncGlobalConfigFromDatabase 从数据库同步配置到全局Config结构
@@ -84,6 +98,61 @@ func syncGlobalConfigFromDatabase(globalConfig *config.Config, database *config.
 		},
 	}
 
+	// 每日汇总生成时间
+	if dailySummaryTime, _ := database.GetSystemConfig("daily_summary_time"); dailySummaryTime != "" {
+		if _, _, err := logger.ParseReportTime(dailySummaryTime); err != nil {
+			log.Printf("⚠️  忽略无效的每日汇总时间: %v", err)
+		} else {
+			globalConfig.DailySummaryTime = dailySummaryTime
+		}
+	}
+
+	// 开仓最低盈亏比
+	if minRewardRisk, _ := database.GetSystemConfig("min_reward_risk"); minRewardRisk != "" {
+		if value, err := strconv.ParseFloat(minRewardRisk, 64); err == nil {
+			globalConfig.MinRewardRisk = value
+		}
+	}
+
+	// 相邻TP分段最小间距
+	if minTPDistancePct, _ := database.GetSystemConfig("min_tp_distance_pct"); minTPDistancePct != "" {
+		if value, err := strconv.ParseFloat(minTPDistancePct, 64); err == nil {
+			globalConfig.MinTPDistancePct = value
+		}
+	}
+
+	// 用户数据流（websocket 推送订单成交/持仓变化）
+	if userDataStream, _ := database.GetSystemConfig("user_data_stream"); userDataStream != "" {
+		globalConfig.UserDataStream = userDataStream == "true"
+	}
+
+	// 到达TP3后改为移动止损（让利润奔跑）
+	if tp3TrailATRMult, _ := database.GetSystemConfig("tp3_trail_atr_mult"); tp3TrailATRMult != "" {
+		if value, err := strconv.ParseFloat(tp3TrailATRMult, 64); err == nil {
+			globalConfig.TP3TrailATRMult = value
+		}
+	}
+	if tp3TrailPct, _ := database.GetSystemConfig("tp3_trail_pct"); tp3TrailPct != "" {
+		if value, err := strconv.ParseFloat(tp3TrailPct, 64); err == nil {
+			globalConfig.TP3TrailPct = value
+		}
+	}
+
+	// 支撑/压力区合并容差
+	if zoneMergeTolerancePct, _ := database.GetSystemConfig("zone_merge_tolerance_pct"); zoneMergeTolerancePct != "" {
+		if value, err := strconv.ParseFloat(zoneMergeTolerancePct, 64); err == nil {
+			globalConfig.ZoneMergeTolerancePct = value
+		}
+	}
+
+	// 全局开仓订单类型（limit_maker 时所有开仓强制maker限价）
+	if openingOrderType, _ := database.GetSystemConfig("opening_order_type"); openingOrderType != "" {
+		if err := trader.ValidateOpeningOrderType(openingOrderType); err != nil {
+			return err
+		}
+		globalConfig.OpeningOrderType = openingOrderType
+	}
+
 	return nil
 }
 
@@ -107,6 +176,15 @@ func syncConfigToDatabase(database *config.Database) error {
 		return fmt.Errorf("解析config.json失败: %w", err)
 	}
 
+	if err := trader.ValidateOpeningOrderType(configFile.OpeningOrderType); err != nil {
+		return err
+	}
+	if configFile.DailySummaryTime != "" {
+		if _, _, err := logger.ParseReportTime(configFile.DailySummaryTime); err != nil {
+			return err
+		}
+	}
+
 	log.Printf("🔄 开始同步config.json到数据库...")
 
 	// 同步各配置项到数据库
@@ -137,6 +215,46 @@ func syncConfigToDatabase(database *config.Database) error {
 		configs["altcoin_leverage"] = strconv.Itoa(configFile.Leverage.AltcoinLeverage)
 	}
 
+	// 同步开仓订单类型
+	if configFile.OpeningOrderType != "" {
+		configs["opening_order_type"] = configFile.OpeningOrderType
+	}
+
+	// 同步每日汇总时间
+	if configFile.DailySummaryTime != "" {
+		configs["daily_summary_time"] = configFile.DailySummaryTime
+	}
+
+	// 同步开仓最低盈亏比
+	if configFile.MinRewardRisk > 0 {
+		configs["min_reward_risk"] = strconv.FormatFloat(configFile.MinRewardRisk, 'f', -1, 64)
+	}
+
+	// 同步相邻TP分段最小间距
+	if configFile.MinTPDistancePct > 0 {
+		configs["min_tp_distance_pct"] = strconv.FormatFloat(configFile.MinTPDistancePct, 'f', -1, 64)
+	}
+
+	// 同步用户数据流开关
+	configs["user_data_stream"] = fmt.Sprintf("%t", configFile.UserDataStream)
+
+	// 同步实时行情开关
+	configs["market_websocket"] = fmt.Sprintf("%t", configFile.MarketWebSocket)
+
+	// 同步TP3后移动止损距离（0 表示TP3照常平仓，需写入以便关闭）
+	configs["tp3_trail_atr_mult"] = strconv.FormatFloat(configFile.TP3TrailATRMult, 'f', -1, 64)
+	configs["tp3_trail_pct"] = strconv.FormatFloat(configFile.TP3TrailPct, 'f', -1, 64)
+
+	// 同步支撑/压力区合并容差
+	if configFile.ZoneMergeTolerancePct > 0 {
+		configs["zone_merge_tolerance_pct"] = strconv.FormatFloat(configFile.ZoneMergeTolerancePct, 'f', -1, 64)
+	}
+
+	// 同步行情数据源
+	if configFile.MarketDataSource != "" {
+		configs["market_data_source"] = configFile.MarketDataSource
+	}
+
 	// 如果JWT密钥不为空，也同步
 	if configFile.JWTSecret != "" {
 		configs["jwt_secret"] = configFile.JWTSecret
@@ -231,6 +349,16 @@ func main() {
 
 	pool.SetDefaultCoins(defaultCoins)
 
+	// 行情数据源（K线/持仓量/资金费率），在 Hyperliquid/Aster 交易时使用该交易所行情避免价格偏差
+	if sourceName, _ := database.GetSystemConfig("market_data_source"); sourceName != "" {
+		if source, err := market.NewMarketDataSource(sourceName); err != nil {
+			log.Printf("⚠️  %v，继续使用 Binance 行情", err)
+		} else {
+			market.SetDefaultSource(source)
+			log.Printf("✓ 行情数据源: %s", sourceName)
+		}
+	}
+
 	// 设置是否使用默认主流币种
 	pool.SetUseDefaultCoins(useDefaultCoins)
 	if useDefaultCoins {
@@ -285,6 +413,24 @@ func main() {
 	if err := syncGlobalConfigFromDatabase(globalConfig, database); err != nil {
 		log.Printf("⚠️ 同步全局配置失败，使用默认配置: %v", err)
 	}
+	if globalConfig.ZoneMergeTolerancePct > 0 {
+		market.SetZoneConfig(market.ZoneConfig{MergeTolerancePct: globalConfig.ZoneMergeTolerancePct})
+		log.Printf("✓ 支撑/压力区合并容差: %.2f%%", globalConfig.ZoneMergeTolerancePct)
+	}
+
+	// 加载用户自定义提示词模板，交易员构建提示词时按所属用户解析
+	if records, err := database.GetAllUserPromptTemplates(); err != nil {
+		log.Printf("⚠️  加载用户提示词模板失败: %v", err)
+	} else {
+		userTemplates := make(map[string][]*decision.PromptTemplate)
+		for _, record := range records {
+			userTemplates[record.UserID] = append(userTemplates[record.UserID], &decision.PromptTemplate{Name: record.Name, Content: record.Content})
+		}
+		for userID, templates := range userTemplates {
+			decision.SetUserPromptTemplates(userID, templates)
+		}
+		log.Printf("✓ 已加载 %d 个用户自定义提示词模板", len(records))
+	}
 
 	// 创建TraderManager
 	traderManager := manager.NewTraderManager(globalConfig)
@@ -312,6 +458,21 @@ func main() {
 		allTraders = append(allTraders, traders...)
 	}
 
+	// 实时行情：订阅默认币种和各交易员配置的币种，market.Get() 优先读取推送快照
+	var marketFeed *market.WebSocketFeed
+	if enabled, _ := database.GetSystemConfig("market_websocket"); enabled == "true" {
+		sourceName, _ := database.GetSystemConfig("market_data_source")
+		if sourceName != "" && !strings.EqualFold(sourceName, "binance") {
+			log.Printf("⚠️  实时行情仅支持 Binance 行情源（当前 %s），继续使用REST", sourceName)
+		} else {
+			if feed, err := market.StartWebSocketFeed(websocketFeedSymbols(defaultCoins, allTraders), nil); err != nil {
+				log.Printf("⚠️  启动实时行情失败，继续使用REST: %v", err)
+			} else {
+				marketFeed = feed
+			}
+		}
+	}
+
 	// 显示加载的交易员信息
 	fmt.Println()
 	fmt.Println("🤖 数据库中的AI交易员配置:")
@@ -371,7 +532,23 @@ func main() {
 	fmt.Println()
 	log.Println("📛 收到退出信号，正在停止所有trader...")
 	traderManager.StopAll()
+	if marketFeed != nil {
+		marketFeed.Stop()
+	}
 
 	fmt.Println()
 	fmt.Println("👋 感谢使用AI交易系统！")
 }
+
+// websocketFeedSymbols 合并默认币种与各交易员的交易币种（去重与格式化由 StartWebSocketFeed 处理）
+func websocketFeedSymbols(defaultCoins []string, traders []*config.TraderRecord) []string {
+	symbols := append([]string(nil), defaultCoins...)
+	for _, trader := range traders {
+		for _, symbol := range strings.Split(trader.TradingSymbols, ",") {
+			if symbol = strings.TrimSpace(symbol); symbol != "" {
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	return symbols
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"nofx/config"
+	"nofx/decision"
+	"nofx/market"
 	"nofx/trader"
 	"strconv"
 	"strings"
@@ -16,6 +18,8 @@ import (
 type TraderManager struct {
 	traders      map[string]*trader.AutoTrader // key: trader ID
 	globalConfig *config.Config                // 全局配置
+	runtimeStore trader.RuntimeStateStore      // 交易员运行状态存储（加载数据库时设置）
+	equityStore  trader.EquitySnapshotStore    // 净值快照存储（加载数据库时设置）
 	mu           sync.RWMutex
 }
 
@@ -27,10 +31,19 @@ func NewTraderManager(globalConfig *config.Config) *TraderManager {
 	}
 }
 
+// setRuntimeStore 使用数据库持久化交易员运行状态与净值快照（调用方持有锁）
+func (tm *TraderManager) setRuntimeStore(database *config.Database) {
+	if database != nil {
+		tm.runtimeStore = database
+		tm.equityStore = database
+	}
+}
+
 // LoadTradersFromDatabase 从数据库加载所有交易员到内存
 func (tm *TraderManager) LoadTradersFromDatabase(database *config.Database) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
+	tm.setRuntimeStore(database)
 
 	// 获取所有用户
 	userIDs, err := database.GetAllUsers()
@@ -208,6 +221,8 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		AIModel:               aiModelCfg.Provider, // 使用provider作为模型标识
 		Exchange:              exchangeCfg.ID,      // 使用exchange ID
 		TraderMode:            traderCfg.TraderMode, // 纸交易或真实交易
+		OpeningOrderType:      traderCfg.OpeningOrderType,
+		DailySummaryTime:      traderCfg.DailySummaryTime,
 		BinanceAPIKey:         "",
 		BinanceSecretKey:      "",
 		HyperliquidPrivateKey: "",
@@ -232,9 +247,13 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		PostOnlyWhenLimitOnly:     true,
 		StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
 		IsCrossMargin:         traderCfg.IsCrossMargin,
+		IsHedgeMode:           traderCfg.IsHedgeMode,
 		DefaultCoins:          defaultCoins,
 		TradingCoins:          tradingCoins,
 		SystemPromptTemplate:  traderCfg.SystemPromptTemplate, // 系统提示词模板
+		UserID:                traderCfg.UserID,
+		AnalysisTimeframes:    parseAnalysisTimeframes(traderCfg),
+		IndicatorRules:        parseIndicatorRules(traderCfg),
 	}
 
 	// 根据交易所类型设置API密钥
@@ -274,6 +293,13 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		}
 	}
 
+	if tm.runtimeStore != nil {
+		at.SetRuntimeStateStore(tm.runtimeStore)
+	}
+	if tm.equityStore != nil {
+		at.SetEquitySnapshotStore(tm.equityStore)
+	}
+
 	tm.traders[traderCfg.ID] = at
 	log.Printf("✓ Trader '%s' (%s + %s) 已加载到内存", traderCfg.Name, aiModelCfg.Provider, exchangeCfg.ID)
 	return nil
@@ -321,6 +347,9 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		Name:                  traderCfg.Name,
 		AIModel:               aiModelCfg.Provider, // 使用provider作为模型标识
 		Exchange:              exchangeCfg.ID,      // 使用exchange ID
+		TraderMode:            traderCfg.TraderMode, // 纸交易或真实交易
+		OpeningOrderType:      traderCfg.OpeningOrderType,
+		DailySummaryTime:      traderCfg.DailySummaryTime,
 		BinanceAPIKey:         "",
 		BinanceSecretKey:      "",
 		HyperliquidPrivateKey: "",
@@ -339,8 +368,13 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		MaxDrawdown:           maxDrawdown,
 		StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
 		IsCrossMargin:         traderCfg.IsCrossMargin,
+		IsHedgeMode:           traderCfg.IsHedgeMode,
 		DefaultCoins:          defaultCoins,
 		TradingCoins:          tradingCoins,
+		SystemPromptTemplate:  traderCfg.SystemPromptTemplate, // 系统提示词模板
+		UserID:                traderCfg.UserID,
+		AnalysisTimeframes:    parseAnalysisTimeframes(traderCfg),
+		IndicatorRules:        parseIndicatorRules(traderCfg),
 	}
 
 	// 根据交易所类型设置API密钥
@@ -380,6 +414,13 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		}
 	}
 
+	if tm.runtimeStore != nil {
+		at.SetRuntimeStateStore(tm.runtimeStore)
+	}
+	if tm.equityStore != nil {
+		at.SetEquitySnapshotStore(tm.equityStore)
+	}
+
 	tm.traders[traderCfg.ID] = at
 	log.Printf("✓ Trader '%s' (%s + %s) 已添加", traderCfg.Name, aiModelCfg.Provider, exchangeCfg.ID)
 	return nil
@@ -574,6 +615,7 @@ func containsUserPrefix(traderID string) bool {
 func (tm *TraderManager) LoadUserTraders(database *config.Database, userID string) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
+	tm.setRuntimeStore(database)
 
 	// 获取指定用户的所有交易员
 	traders, err := database.GetTraders(userID)
@@ -736,6 +778,9 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 		Name:                  traderCfg.Name,
 		AIModel:               aiModelCfg.Provider, // 使用provider作为模型标识
 		Exchange:              exchangeCfg.ID,      // 使用exchange ID
+		TraderMode:            traderCfg.TraderMode, // 纸交易或真实交易
+		OpeningOrderType:      traderCfg.OpeningOrderType,
+		DailySummaryTime:      traderCfg.DailySummaryTime,
 		InitialBalance:        traderCfg.InitialBalance,
 		BTCETHLeverage:        traderCfg.BTCETHLeverage,
 		AltcoinLeverage:       traderCfg.AltcoinLeverage,
@@ -748,9 +793,13 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 		MaxDrawdown:           maxDrawdown,
 		StopTradingTime:       time.Duration(stopTradingMinutes) * time.Minute,
 		IsCrossMargin:         traderCfg.IsCrossMargin,
+		IsHedgeMode:           traderCfg.IsHedgeMode,
 		DefaultCoins:          defaultCoins,
 		TradingCoins:          tradingCoins,
 		SystemPromptTemplate:  traderCfg.SystemPromptTemplate, // 系统提示词模板
+		UserID:                traderCfg.UserID,
+		AnalysisTimeframes:    parseAnalysisTimeframes(traderCfg),
+		IndicatorRules:        parseIndicatorRules(traderCfg),
 	}
 
 	// 根据交易所类型设置API密钥
@@ -790,7 +839,37 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 		}
 	}
 
+	if tm.runtimeStore != nil {
+		at.SetRuntimeStateStore(tm.runtimeStore)
+	}
+	if tm.equityStore != nil {
+		at.SetEquitySnapshotStore(tm.equityStore)
+	}
+
 	tm.traders[traderCfg.ID] = at
 	log.Printf("✓ Trader '%s' (%s + %s) 已为用户加载到内存", traderCfg.Name, aiModelCfg.Provider, exchangeCfg.ID)
 	return nil
 }
+
+// parseIndicatorRules 解析交易员的指标阈值规则，配置无效时不启用规则
+func parseIndicatorRules(traderCfg *config.TraderRecord) []decision.IndicatorRule {
+	rules, err := decision.ParseIndicatorRules(traderCfg.IndicatorRules)
+	if err != nil {
+		log.Printf("⚠️ 交易员 %s 指标阈值规则配置无效，已忽略: %v", traderCfg.Name, err)
+		return nil
+	}
+	return rules
+}
+
+// parseAnalysisTimeframes 解析交易员的分析周期配置，配置无效时回退到默认周期
+func parseAnalysisTimeframes(traderCfg *config.TraderRecord) []string {
+	if strings.TrimSpace(traderCfg.AnalysisTimeframes) == "" {
+		return nil
+	}
+	timeframes, err := market.ParseTimeframes(traderCfg.AnalysisTimeframes)
+	if err != nil {
+		log.Printf("⚠️ 交易员 %s 分析周期配置无效，使用默认周期: %v", traderCfg.Name, err)
+		return nil
+	}
+	return timeframes
+}
@@ -0,0 +1,87 @@
+package market
+
+import "math"
+
+// minCorrelationSamples 计算相关系数所需的最少收益率样本数
+const minCorrelationSamples = 10
+
+// CalculateCorrelationMatrix 计算各币种最近 period 根K线收盘价收益率的皮尔逊相关系数
+// K线需为同一周期、截止时间相同（按末尾对齐）；样本不足的币种对不写入结果，对角线为1
+func CalculateCorrelationMatrix(symbols []string, klines map[string][]Kline, period int) map[string]map[string]float64 {
+	returns := make(map[string][]float64, len(symbols))
+	for _, symbol := range symbols {
+		if r := closeReturns(klines[symbol], period); len(r) >= minCorrelationSamples {
+			returns[symbol] = r
+		}
+	}
+
+	matrix := make(map[string]map[string]float64, len(returns))
+	for i, a := range symbols {
+		ra, ok := returns[a]
+		if !ok {
+			continue
+		}
+		if matrix[a] == nil {
+			matrix[a] = make(map[string]float64)
+		}
+		matrix[a][a] = 1
+		for _, b := range symbols[i+1:] {
+			rb, ok := returns[b]
+			if !ok || a == b {
+				continue
+			}
+			n := min(len(ra), len(rb))
+			if n < minCorrelationSamples {
+				continue
+			}
+			corr, ok := pearsonCorrelation(ra[len(ra)-n:], rb[len(rb)-n:])
+			if !ok {
+				continue
+			}
+			if matrix[b] == nil {
+				matrix[b] = map[string]float64{b: 1}
+			}
+			matrix[a][b] = corr
+			matrix[b][a] = corr
+		}
+	}
+	return matrix
+}
+
+// closeReturns 最近 period 个收盘价收益率（period <= 0 时使用全部K线）
+func closeReturns(klines []Kline, period int) []float64 {
+	if period > 0 && len(klines) > period+1 {
+		klines = klines[len(klines)-period-1:]
+	}
+	var returns []float64
+	for i := 1; i < len(klines); i++ {
+		if klines[i-1].Close <= 0 {
+			continue
+		}
+		returns = append(returns, klines[i].Close/klines[i-1].Close-1)
+	}
+	return returns
+}
+
+// pearsonCorrelation 皮尔逊相关系数，任一序列方差为0时返回 false
+func pearsonCorrelation(x, y []float64) (float64, bool) {
+	n := float64(len(x))
+	var sumX, sumY float64
+	for i := range x {
+		sumX += x[i]
+		sumY += y[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var cov, varX, varY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 || varY == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(varX*varY), true
+}
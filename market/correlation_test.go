@@ -0,0 +1,43 @@
+package market
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalculateCorrelationMatrix(t *testing.T) {
+	base := make([]Kline, 60)
+	inverse := make([]Kline, 60)
+	price, inv := 100.0, 100.0
+	for i := range base {
+		step := 0.01 * math.Sin(float64(i))
+		price *= 1 + step
+		inv *= 1 - step
+		base[i] = Kline{Close: price}
+		inverse[i] = Kline{Close: inv}
+	}
+	scaled := make([]Kline, 40) // 长度不同，按末尾对齐
+	for i := range scaled {
+		scaled[i] = Kline{Close: base[len(base)-len(scaled)+i].Close * 3}
+	}
+	short := base[:5]
+
+	klines := map[string][]Kline{"BTC": base, "ETH": scaled, "SOL": inverse, "XRP": short}
+	matrix := CalculateCorrelationMatrix([]string{"BTC", "ETH", "SOL", "XRP"}, klines, 30)
+
+	if got := matrix["BTC"]["BTC"]; got != 1 {
+		t.Errorf("对角线应为1, got %v", got)
+	}
+	if got := matrix["BTC"]["ETH"]; math.Abs(got-1) > 1e-9 || matrix["ETH"]["BTC"] != got {
+		t.Errorf("同步序列相关系数应为1且对称, got %v / %v", got, matrix["ETH"]["BTC"])
+	}
+	if got := matrix["BTC"]["SOL"]; got > -0.99 {
+		t.Errorf("反向序列相关系数应接近-1, got %v", got)
+	}
+	if _, ok := matrix["XRP"]; ok {
+		t.Error("样本不足的币种不应出现在矩阵中")
+	}
+	if _, ok := matrix["BTC"]["XRP"]; ok {
+		t.Error("样本不足的币种对不应写入结果")
+	}
+}
@@ -86,6 +86,36 @@ type FibSet struct {
 	Levels    []FibLevel `json:"levels"`     // 各个比例位
 }
 
+// FibConfluence 4h 与 1h 斐波那契价位在容差内重合形成的共振区（高胜率入场价位）
+type FibConfluence struct {
+	Price              float64 `json:"price"`               // 两个价位的中点
+	Ratio4h            float64 `json:"ratio_4h"`            // 4h 比例
+	Ratio1h            float64 `json:"ratio_1h"`            // 1h 比例
+	ConfluenceStrength int     `json:"confluence_strength"` // 1~3：基础1，两侧均为关键比例+1，间距不超过容差一半+1
+}
+
+// fibConfluenceTolerancePct 4h/1h 斐波那契价位视为重合的最大间距（占价格百分比）
+const fibConfluenceTolerancePct = 0.3
+
+// VolumeProfile 成交量分布（按价格分桶统计成交量）
+type VolumeProfile struct {
+	POC            float64   `json:"poc"`                        // 成交量最大的价格桶中心（Point of Control）
+	VAH            float64   `json:"vah"`                        // 价值区上沿（包含70%成交量）
+	VAL            float64   `json:"val"`                        // 价值区下沿
+	LowVolumeNodes []float64 `json:"low_volume_nodes,omitempty"` // 低成交量节点（价格真空区）的桶中心，从低到高
+}
+
+// PivotPoints 经典枢轴点（由上一交易时段的最高/最低/收盘价计算）
+type PivotPoints struct {
+	PP float64 `json:"pp"`
+	R1 float64 `json:"r1"`
+	R2 float64 `json:"r2"`
+	R3 float64 `json:"r3"`
+	S1 float64 `json:"s1"`
+	S2 float64 `json:"s2"`
+	S3 float64 `json:"s3"`
+}
+
 // PriceActionSummary 价格行为（精简版）
 type PriceActionSummary struct {
 	Timeframe      string          `json:"timeframe"`   // "4h"/"15m"
@@ -97,6 +127,16 @@ type PriceActionSummary struct {
 	SweptLows      []LiquidityLine `json:"swept_lows"`  // 最近1~2条
 	BullSlope      float64         `json:"bull_slope"`  // 由最近两个pivot low计算
 	BearSlope      float64         `json:"bear_slope"`  // 由最近两个pivot high计算
+
+	// 最近信号时效：距今超过 maxSignalAgeCandles 根的信号已被过滤为 "none"
+	LastSignalAgeCandles int  `json:"last_signal_age_candles"` // 距最新K线的根数（0=最新一根），无信号时为0
+	SignalFresh          bool `json:"signal_fresh"`            // 距今不超过 freshSignalMaxAgeCandles 根
+
+	// RSI14 常规背离：比较最近两个 ZigZag pivot 的价格与 RSI
+	BullishDivergence      bool    `json:"bullish_divergence"`                 // 价格低点更低，RSI 低点抬高
+	BearishDivergence      bool    `json:"bearish_divergence"`                 // 价格高点更高，RSI 高点降低
+	BullishDivergenceTimes []int64 `json:"bullish_divergence_times,omitempty"` // 参与背离的两个pivot low时间（旧→新）
+	BearishDivergenceTimes []int64 `json:"bearish_divergence_times,omitempty"` // 参与背离的两个pivot high时间（旧→新）
 }
 
 // OB 订单块（精简字段）
@@ -248,11 +288,22 @@ type Data struct {
 	CurrentRSI7      float64
 	OpenInterest     *OIData
 	FundingRate      float64
+	FundingHistory   []float64        `json:"funding_history,omitempty"`   // 最近几次资金费率（从旧到新）
+	NextFundingTime  int64            `json:"next_funding_time,omitempty"` // 下次资金费结算时间（毫秒）
+	VWAP5m           float64          `json:"vwap_5m,omitempty"`           // 5m 会话VWAP（UTC日初锚定）
+	VWAP15m          float64          `json:"vwap_15m,omitempty"`          // 15m 会话VWAP（UTC日初锚定）
+	VWAP1h           float64          `json:"vwap_1h,omitempty"`           // 1h 会话VWAP（UTC日初锚定）
+	DailyPivots      *PivotPoints     `json:"daily_pivots,omitempty"`      // 上一根已收盘日线计算的经典枢轴点
 	IntradaySeries   *IntradayData    // 5分钟数据 - 日内
 	MidTermSeries15m *MidTermData15m  // 15分钟数据 - 短期趋势
 	MidTermSeries1h  *MidTermData1h   // 1小时数据 - 中期趋势
 	MidTermSeries4h  *MidTermSeries4h // 4小时数据 - 长期趋势
 
+	// 本次分析的周期（从小到大），未启用周期对应的序列为nil
+	Timeframes []string `json:"timeframes,omitempty"`
+	// 非默认周期（如1m/1d）的通用指标序列
+	ExtraSeries map[string]*TimeframeSeries `json:"extra_series,omitempty"`
+
 	// 新增：识别出来的关键区（内部可用，但不再通过 JSON 提交给 AI）
 	FourHourZones   []SRZone `json:"-"`
 	FifteenMinZones []SRZone `json:"-"`
@@ -260,6 +311,12 @@ type Data struct {
 	// 新增：直接算好的斐波那契
 	Fib4h *FibSet `json:"fib_4h"`
 	Fib1h *FibSet `json:"fib_1h"`
+	// 4h/1h 斐波那契共振区（按价格从低到高）
+	FibConfluence []FibConfluence `json:"fib_confluence,omitempty"`
+
+	// 成交量分布（POC/价值区/低成交量节点）
+	VolumeProfile4h  *VolumeProfile `json:"volume_profile_4h,omitempty"`
+	VolumeProfile15m *VolumeProfile `json:"volume_profile_15m,omitempty"`
 
 	PriceAction5m   *PriceActionSummary `json:"price_action_5m"`
 	PriceAction15m  *PriceActionSummary `json:"price_action_15m"`
@@ -269,6 +326,9 @@ type Data struct {
 	CandleShapes15m []CandleShape       `json:"candles_15m,omitempty"`
 	CandleShapes1h  []CandleShape       `json:"candles_1h,omitempty"`
 	CandleShapes4h  []CandleShape       `json:"candles_4h,omitempty"`
+	HeikinAshi15m   []CandleShape       `json:"heikin_ashi_15m,omitempty"` // Heikin-Ashi K线几何特征（平滑噪声，便于判断趋势方向）
+	HeikinAshi1h    []CandleShape       `json:"heikin_ashi_1h,omitempty"`
+	HeikinAshi4h    []CandleShape       `json:"heikin_ashi_4h,omitempty"`
 	Derivatives     *DerivativesData    `json:"derivatives,omitempty"`
 
 	// ICT 派生字段（可选）
@@ -367,6 +427,15 @@ type BollingerBand struct {
 	Percent float64 // (price - Lower)/(Upper - Lower)
 }
 
+// IchimokuData 一目均衡表（9/26/52），云带取前移26周期后对应当前K线的值
+type IchimokuData struct {
+	TenkanSen   float64 // 转换线：9周期最高最低中点
+	KijunSen    float64 // 基准线：26周期最高最低中点
+	SenkouSpanA float64 // 先行带A：26周期前 (转换线+基准线)/2
+	SenkouSpanB float64 // 先行带B：26周期前的52周期最高最低中点
+	ChikouSpan  float64 // 迟行线：当前收盘价（与26周期前价格比较）
+}
+
 // MACDSignal MACD指标完整信号
 type MACDSignal struct {
 	MACDLine   float64 `json:"macd_line"`   // MACD线 (EMA12 - EMA26)
@@ -390,9 +459,21 @@ type IntradayData struct {
 	MACDValues    []*MACDSignal // 5分钟MACD信号序列（使用优化参数8,17,6）
 	RSI7Values    []float64
 	RSI14Values   []float64
+	StochRSIK     []float64 // StochRSI %K 序列
+	StochRSID     []float64 // StochRSI %D 序列
 	Volumes       []float64 // 成交量序列（用于放量检测）
 	BuySellRatios []float64 // 买卖压力比序列（>0.6多方强，<0.4空方强）
 	OBVValues     []float64 // OBV指标序列
+	OBVDivergence string    // 最近5根OBV与价格背离: "bullish"/"bearish"/"none"
+	VolumeDeltas  []float64 // 主动买入量-主动卖出量序列（最近10根）
+
+	ParabolicSARValues    []float64 // 抛物线SAR序列（最近10根）
+	ParabolicSARDirection string    // 最新SAR相对收盘价的位置: "above"(空头)/"below"(多头)
+
+	VWAPValues       []float64 // UTC日初锚定的会话VWAP序列（最近10根）
+	AnchoredVWAP     float64   // 自最近一个4h摆动高/低点起的锚定VWAP，0表示无可用锚点
+	AnchoredVWAPFrom string    // 锚点类型: "swing_high"/"swing_low"
+	AnchoredVWAPTime int64     // 锚点K线开盘时间（毫秒）
 }
 
 // MidTermData15m 15分钟时间框架数据 - 短期趋势过滤
@@ -403,10 +484,15 @@ type MidTermData15m struct {
 	MACDValues  []*MACDSignal // 完整的MACD信号序列（包括金叉死叉）
 	RSI7Values  []float64
 	RSI14Values []float64
+	StochRSIK   []float64 // StochRSI %K 序列
+	StochRSID   []float64 // StochRSI %D 序列
 	Bollinger   *BollingerBand
 	VWAP        float64   // 当前VWAP
 	OBVValues   []float64 // OBV指标序列
 	MFI         float64   // 资金流量指标
+
+	ParabolicSARValues    []float64 // 抛物线SAR序列（最近10根）
+	ParabolicSARDirection string    // 最新SAR相对收盘价的位置: "above"(空头)/"below"(多头)
 }
 
 // MidTermData1h 1小时时间框架数据 - 中期趋势确认
@@ -419,11 +505,16 @@ type MidTermData1h struct {
 	MACDValues   []*MACDSignal // 完整的MACD信号序列（包括金叉死叉）
 	RSI7Values   []float64
 	RSI14Values  []float64
-	ADX          float64 // 趋势强度指标
-	DIPlus       float64 // DI+
-	DIMinus      float64 // DI-
-	VWAP         float64 // 当前VWAP
+	StochRSIK    []float64 // StochRSI %K 序列
+	StochRSID    []float64 // StochRSI %D 序列
+	ADX          float64   // 趋势强度指标
+	DIPlus       float64   // DI+
+	DIMinus      float64   // DI-
+	WilliamsR14  float64   // Williams %R(14)，-100~0
+	CCI14        float64   // CCI(14)
+	VWAP         float64   // 当前VWAP
 	OBVValues    []float64
+	Ichimoku     *IchimokuData // 一目均衡表（K线不足时为nil）
 }
 
 // MidTermSeries4h 4小时时间框架数据 - 长期趋势
@@ -436,18 +527,24 @@ type MidTermSeries4h struct {
 	MACDValues    []*MACDSignal // 完整的MACD信号序列（包括金叉死叉）
 	RSI7Values    []float64
 	RSI14Values   []float64
+	StochRSIK     []float64      // StochRSI %K 序列
+	StochRSID     []float64      // StochRSI %D 序列
 	Bollinger     *BollingerBand // 4h布林带
 	ADX           float64        // 趋势强度指标
 	DIPlus        float64        // DI+
 	DIMinus       float64        // DI-
+	TrendStrength string         // 按 ADX 划分：strong/moderate/weak/ranging
+	WilliamsR14   float64        // Williams %R(14)，-100~0
+	CCI14         float64        // CCI(14)
 	ATR3          float64
 	ATR14         float64
 	CurrentVolume float64
 	AverageVolume float64
 	VWAP          float64 // 当前VWAP
 	OBVValues     []float64
-	CMF           float64 // 资金流量指标
-	MFI           float64 // 资金流量强度
+	CMF           float64       // 资金流量指标
+	MFI           float64       // 资金流量强度
+	Ichimoku      *IchimokuData // 一目均衡表（K线不足时为nil）
 }
 
 // Kline K线数据
@@ -471,60 +568,211 @@ type Kline struct {
 
 // Get 获取指定代币的市场数据
 func Get(symbol string) (*Data, error) {
-	return marketDataProvider.Get(symbol)
+	return GetWithContext(context.Background(), symbol)
 }
 
-// getMarketDataFromAPI 从API获取市场数据（原始实现）
-func getMarketDataFromAPI(symbol string) (*Data, error) {
-	// 标准化symbol
-	symbol = Normalize(symbol)
+// GetWithContext 获取指定代币的市场数据，ctx 取消（如交易员停止）时中断进行中的HTTP请求
+// 启用实时行情（WebSocketProvider）时优先返回实时快照，不可用时回退REST并刷新快照基础数据；
+// 实时行情来自 Binance，ctx 指定了其他行情数据源（见 WithSource）时直接走REST
+func GetWithContext(ctx context.Context, symbol string) (*Data, error) {
+	ws := currentWebSocketProvider()
+	if _, ok := SourceFromContext(ctx).(*BinanceSource); !ok {
+		ws = nil
+	}
+	if ws != nil {
+		if data, ok := ws.Snapshot(symbol); ok {
+			return data, nil
+		}
+	}
 
-	// 获取5分钟K线数据 (最近40个) - 日内
-	klines5m, err := GetKlines(symbol, "5m", 40)
-	if err != nil {
-		return nil, fmt.Errorf("获取5分钟K线失败: %v", err)
+	data, err := getRESTWithContext(ctx, symbol)
+	if err == nil && ws != nil {
+		ws.SetBase(data)
 	}
+	return data, err
+}
 
-	// 获取15分钟K线数据（多取一些做结构/流动性检测）
-	klines15m, err := GetKlines(symbol, "15m", 120)
-	if err != nil {
-		return nil, fmt.Errorf("获取15分钟K线失败: %v", err)
+// getRESTWithContext 通过 MarketDataProvider 获取（默认REST）
+func getRESTWithContext(ctx context.Context, symbol string) (*Data, error) {
+	if provider, ok := marketDataProvider.(ContextMarketDataProvider); ok {
+		return provider.GetWithTimeframesContext(ctx, symbol, nil)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return marketDataProvider.Get(symbol)
+}
 
-	// 获取1小时K线数据（顺便也多取一些，给Fib/趋势用）
-	klines1h, err := GetKlines(symbol, "1h", 120)
-	if err != nil {
-		return nil, fmt.Errorf("获取1小时K线失败: %v", err)
+// klineFetcher K线获取函数（实时或历史）
+type klineFetcher func(symbol, interval string, limit int) ([]Kline, error)
+
+// GetWithTimeframes 按指定分析周期获取市场数据，未启用的周期不会请求K线
+// timeframes 为空时使用默认周期（5m/15m/1h/4h）
+func GetWithTimeframes(symbol string, timeframes []string) (*Data, error) {
+	return GetWithTimeframesContext(context.Background(), symbol, timeframes)
+}
+
+// GetWithTimeframesContext 同 GetWithTimeframes，ctx 取消时中断进行中的HTTP请求
+func GetWithTimeframesContext(ctx context.Context, symbol string, timeframes []string) (*Data, error) {
+	if provider, ok := marketDataProvider.(ContextMarketDataProvider); ok {
+		return provider.GetWithTimeframesContext(ctx, symbol, timeframes)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if provider, ok := marketDataProvider.(TimeframeMarketDataProvider); ok {
+		return provider.GetWithTimeframes(symbol, timeframes)
 	}
+	return marketDataProvider.Get(symbol)
+}
 
-	// 获取4小时K线数据（多取一些做结构/流动性检测）
-	klines4h, err := GetKlines(symbol, "4h", 120)
-	if err != nil {
-		return nil, fmt.Errorf("获取4小时K线失败: %v", err)
+// GetAt 获取截止到指定历史时刻的市场数据（回测用）
+// 只使用历史K线计算；OI、资金费率、衍生品、盘口等只有实时值的数据不获取
+func GetAt(symbol string, at time.Time) (*Data, error) {
+	return buildMarketData(context.Background(), Normalize(symbol), closedKlinesAt(at), false, defaultTimeframes)
+}
+
+// closedKlinesAt 返回截止到 at 已收盘的K线获取函数
+// Binance endTime 按开盘时间过滤，会包含 at 时刻仍在进行中的K线（且带最终OHLC），这里多取一根并丢弃未收盘的K线，避免回测看到未来价格
+func closedKlinesAt(at time.Time) klineFetcher {
+	atMs := at.UnixMilli()
+	return func(symbol, interval string, limit int) ([]Kline, error) {
+		klines, err := GetKlinesRange(symbol, interval, time.Time{}, at, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		for len(klines) > 0 && klines[len(klines)-1].CloseTime > atMs {
+			klines = klines[:len(klines)-1]
+		}
+		if len(klines) > limit {
+			klines = klines[len(klines)-limit:]
+		}
+		return klines, nil
 	}
+}
+
+// pivotKlinesLimit 计算日线枢轴点时获取的日线根数（当日未收盘K线+上一交易日，多取一根容错）
+const pivotKlinesLimit = 3
 
-	// 基于5m最新数据的当前指标
-	currentPrice := klines5m[len(klines5m)-1].Close
-	currentEMA20 := CalculateEMA(klines5m, 20)
-	currentMACD := CalculateMACD(klines5m)
-	currentRSI7 := CalculateRSI(klines5m, 7)
+// sessionKlines5mLimit 5m 会话VWAP需覆盖整个UTC日（288根已收盘+当前K线），其余5m计算仍只用最近 limit 根
+const sessionKlines5mLimit = 24*60/5 + 1
 
-	// 1h 涨跌幅，用5m往前推1h
+// buildMarketData 根据K线计算市场数据，live=false 时跳过仅有实时数据的接口
+// timeframes 须为 NormalizeTimeframes 规范化后的周期列表（从小到大），只获取和计算其中的周期
+// ctx 用于实时接口（OI/资金费率/衍生品/盘口），K线请求的取消由 getKlines 自行处理
+func buildMarketData(ctx context.Context, symbol string, getKlines klineFetcher, live bool, timeframes []string) (*Data, error) {
+	// OI / funding / 衍生品多周期数据（仅实时），与K线并发获取
+	oiData := &OIData{Latest: 0, Average: 0}
+	fundingRate := 0.0
+	var fundingHistory []float64
+	var nextFundingTime int64
+	var derivativesData *DerivativesData
+	var wg sync.WaitGroup
+	if live {
+		source := SourceFromContext(ctx)
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if oi, err := source.GetOpenInterest(ctx, symbol); err == nil {
+				oiData = oi
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if infoSource, ok := source.(FundingInfoSource); ok {
+				if info, err := infoSource.GetFundingInfo(ctx, symbol, fundingHistoryLimit); err == nil {
+					fundingRate = info.Rate
+					fundingHistory = info.History
+					nextFundingTime = info.NextFundingTime
+				}
+				return
+			}
+			fundingRate, _ = source.GetFundingRate(ctx, symbol)
+		}()
+		go func() {
+			defer wg.Done()
+			derivativesData = fetchDerivativesSuite(ctx, symbol)
+		}()
+	}
+
+	// 按周期并发获取K线（5m取40根做日内，另多取至UTC日初供会话VWAP；其余多取一些做结构/流动性/Fib检测）
+	klineResults := make([][]Kline, len(timeframes))
+	klineErrs := make([]error, len(timeframes))
+	hasDaily := false
+	for i, tf := range timeframes {
+		limit := supportedTimeframes[tf].limit
+		if tf == "5m" {
+			limit = sessionKlines5mLimit
+		}
+		if tf == "1d" {
+			hasDaily = true
+		}
+		wg.Add(1)
+		go func(i int, tf string, limit int) {
+			defer wg.Done()
+			klineResults[i], klineErrs[i] = getKlines(symbol, tf, limit)
+		}(i, tf, limit)
+	}
+	// 日线枢轴点只需最近几根日线，未启用1d周期时单独获取（失败不影响其他数据）
+	var pivotKlines []Kline
+	if !hasDaily {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pivotKlines, _ = getKlines(symbol, "1d", pivotKlinesLimit)
+		}()
+	}
+	wg.Wait()
+
+	// 按周期顺序返回第一个失败的错误，保证错误信息稳定
+	klinesByTF := make(map[string][]Kline, len(timeframes))
+	for i, tf := range timeframes {
+		if klineErrs[i] != nil {
+			return nil, fmt.Errorf("获取%s K线失败: %w", tf, klineErrs[i])
+		}
+		klinesByTF[tf] = klineResults[i]
+	}
+	sessionKlines5m := klinesByTF["5m"]
+	if limit := supportedTimeframes["5m"].limit; len(sessionKlines5m) > limit {
+		klinesByTF["5m"] = sessionKlines5m[len(sessionKlines5m)-limit:]
+	}
+	klines5m := klinesByTF["5m"]
+	klines15m := klinesByTF["15m"]
+	klines1h := klinesByTF["1h"]
+	klines4h := klinesByTF["4h"]
+	if hasDaily {
+		pivotKlines = klinesByTF["1d"]
+	}
+
+	// 最小周期作为当前价格与当前指标的基准（默认即5m）
+	baseTF := timeframes[0]
+	baseKlines := klinesByTF[baseTF]
+	if len(baseKlines) == 0 {
+		return nil, fmt.Errorf("%s K线为空", baseTF)
+	}
+	baseMinutes := supportedTimeframes[baseTF].minutes
+
+	currentPrice := baseKlines[len(baseKlines)-1].Close
+	var dailyPivots *PivotPoints
+	if prior, ok := priorSessionKline(pivotKlines, baseKlines[len(baseKlines)-1].OpenTime); ok {
+		dailyPivots = calculateDailyPivots(prior)
+	}
+	currentEMA20 := CalculateEMA(baseKlines, 20)
+	currentMACD := CalculateMACD(baseKlines)
+	currentRSI7 := CalculateRSI(baseKlines, 7)
+
+	// 1h 涨跌幅，用基准周期往前推1h（5m即往前12根）
 	priceChange1h := 0.0
-	if len(klines5m) >= 13 { // 5m * 12 = 60m，这里留1根缓冲
-		price1hAgo := klines5m[len(klines5m)-13].Close
-		if price1hAgo > 0 {
-			priceChange1h = ((currentPrice - price1hAgo) / price1hAgo) * 100
-		}
+	if baseMinutes <= 60 {
+		priceChange1h = priceChangePct(baseKlines, 60/baseMinutes)
 	}
 
-	// 4h 涨跌幅，用一根4h前
+	// 4h 涨跌幅，优先用一根4h前，未启用4h时用基准周期往前推4h
 	priceChange4h := 0.0
 	if len(klines4h) >= 2 {
-		price4hAgo := klines4h[len(klines4h)-2].Close
-		if price4hAgo > 0 {
-			priceChange4h = ((currentPrice - price4hAgo) / price4hAgo) * 100
-		}
+		priceChange4h = priceChangePct(klines4h, 1)
+	} else if baseMinutes <= 240 {
+		priceChange4h = priceChangePct(baseKlines, 240/baseMinutes)
 	}
 
 	// 计算距离历史极值（ATH）的百分比
@@ -542,58 +790,86 @@ func getMarketDataFromAPI(symbol string) (*Data, error) {
 		}
 	}
 
-	// OI
-	oiData, err := getOpenInterestData(symbol)
-	if err != nil {
-		oiData = &OIData{Latest: 0, Average: 0}
+	// 各周期序列（未启用的周期保持nil，Format中自动跳过）
+	var intradayData *IntradayData
+	var midTermData15m *MidTermData15m
+	var midTermData1h *MidTermData1h
+	var midTermData4h *MidTermSeries4h
+	if len(klines5m) > 0 {
+		intradayData = calculateIntradaySeries(klines5m)
+		intradayData.VWAPValues = rollingSessionVWAP(sessionKlines5m, 10)
+		intradayData.AnchoredVWAP, intradayData.AnchoredVWAPFrom, intradayData.AnchoredVWAPTime = swingAnchoredVWAP(klines5m, klines4h)
+	}
+	if len(klines15m) > 0 {
+		midTermData15m = calculateMidTermSeries15m(klines15m)
+	}
+	if len(klines1h) > 0 {
+		midTermData1h = calculateMidTermSeries1h(klines1h)
+	}
+	if len(klines4h) > 0 {
+		midTermData4h = calculateMidTermSeries4h(klines4h)
 	}
 
-	// funding
-	fundingRate, _ := getFundingRate(symbol)
-
-	// 衍生品多周期数据
-	derivativesData := fetchDerivativesSuite(symbol)
-
-	// 5m 日内序列
-	intradayData := calculateIntradaySeries(klines5m)
-
-	// 15m 序列
-	midTermData15m := calculateMidTermSeries15m(klines15m)
-
-	// 1h 序列
-	midTermData1h := calculateMidTermSeries1h(klines1h)
-
-	// 4h 长周期
-	midTermData4h := calculateMidTermSeries4h(klines4h)
+	// 非默认周期（如1m/1d）计算通用指标序列
+	var extraSeries map[string]*TimeframeSeries
+	for _, tf := range timeframes {
+		if coreTimeframes[tf] {
+			continue
+		}
+		if extraSeries == nil {
+			extraSeries = make(map[string]*TimeframeSeries)
+		}
+		extraSeries[tf] = calculateTimeframeSeries(klinesByTF[tf], tf)
+	}
 
 	// 新增：4h 强支撑/压力区识别
-	// 已注释：不再计算4h支撑/压力位，不再提交给AI
-	// fourHourZones := detect4hZones(klines4h, longerTermData)
+	// 不再提交给AI，仅供结构止损等内部逻辑使用
 	var fourHourZones []SRZone
+	if len(klines4h) > 0 && midTermData4h != nil {
+		fourHourZones = detect4hZonesInternal(klines4h, midTermData4h)
+	}
 
 	// 新增：15m 小支撑/小压力区识别
 	// 恢复：计算15m支撑/压力位，只给AI最关键的结构锚点
-	fifteenMinZones := detect15mZones(klines15m, midTermData15m)
+	var fifteenMinZones []SRZone
+	if len(klines15m) > 0 {
+		fifteenMinZones = detect15mZones(klines15m, midTermData15m)
+	}
 
 	// 新增：5m/15m/4h/1h 价格行为 & 斐波那契
 	fib4h := calcFibFromKlines(klines4h, "4h")
 	fib1h := calcFibFromKlines(klines1h, "1h")
+	fibConfluence := FindFibConfluence(fib4h, fib1h, fibConfluenceTolerancePct)
+	volumeProfile4h := calculateVolumeProfile(klines4h, volumeProfileBuckets)
+	volumeProfile15m := calculateVolumeProfile(klines15m, volumeProfileBuckets)
 
 	// 价格行为：结构+OB+liquidity（根据周期优化参数）
 	// 5m: zigzagLen=5, liquidityLen=10, trendLineLen=10 (最敏感，适应高频噪音)
 	// 15m: zigzagLen=7, liquidityLen=15, trendLineLen=15 (平衡参数)
 	// 1h: zigzagLen=9, liquidityLen=20, trendLineLen=20 (当前参数)
 	// 4h: zigzagLen=11, liquidityLen=25, trendLineLen=25 (最保守，过滤长期噪音)
-	pa5 := calcPriceActionSummary(klines5m, "5m", 5, 10, 10)
-	pa15 := calcPriceActionSummary(klines15m, "15m", 7, 15, 15)
-	pa1h := calcPriceActionSummary(klines1h, "1h", 9, 20, 20)
-	pa4h := calcPriceActionSummary(klines4h, "4h", 11, 25, 25)
+	var pa5, pa15, pa1h, pa4h *PriceActionSummary
+	if len(klines5m) > 0 {
+		pa5 = calcPriceActionSummary(klines5m, "5m", 5, 10, 10, defaultMaxSignalAgeCandles)
+	}
+	if len(klines15m) > 0 {
+		pa15 = calcPriceActionSummary(klines15m, "15m", 7, 15, 15, defaultMaxSignalAgeCandles)
+	}
+	if len(klines1h) > 0 {
+		pa1h = calcPriceActionSummary(klines1h, "1h", 9, 20, 20, defaultMaxSignalAgeCandles)
+	}
+	if len(klines4h) > 0 {
+		pa4h = calcPriceActionSummary(klines4h, "4h", 11, 25, 25, defaultMaxSignalAgeCandles)
+	}
 
 	// 新增：提取最近K线的几何特征，让AI做形态识别（每个周期只给最近20根）
 	candles5m := extractCandleShapes(klines5m, 20, 20)
 	candles15m := extractCandleShapes(klines15m, 20, 20)
 	candles1h := extractCandleShapes(klines1h, 20, 20)
 	candles4h := extractCandleShapes(klines4h, 20, 20)
+	heikinAshi15m := extractCandleShapes(convertToHeikinAshi(klines15m), 20, 20)
+	heikinAshi1h := extractCandleShapes(convertToHeikinAshi(klines1h), 20, 20)
+	heikinAshi4h := extractCandleShapes(convertToHeikinAshi(klines4h), 20, 20)
 
 	// 计算派生指标
 	keyLevels := detectKeyLevels(klines4h, klines15m, currentPrice, midTermData4h, midTermData15m)
@@ -687,12 +963,14 @@ func getMarketDataFromAPI(symbol string) (*Data, error) {
 		}
 	}
 
-	// 获取订单簿微观摘要（非致命错误）
+	// 获取订单簿微观摘要（非致命错误，仅实时）
 	var micro *MicrostructureSummary
-	if m, err := getOrderbookSummary(symbol); err != nil {
-		fmt.Printf("⚠ getOrderbookSummary failed for %s: %v\n", symbol, err)
-	} else {
-		micro = m
+	if live {
+		if m, err := getOrderbookSummary(ctx, symbol); err != nil {
+			fmt.Printf("⚠ getOrderbookSummary failed for %s: %v\n", symbol, err)
+		} else {
+			micro = m
+		}
 	}
 
 	// 计算风险指标（需要在micro和volumePercentile15m之后）
@@ -704,6 +982,7 @@ func getMarketDataFromAPI(symbol string) (*Data, error) {
 
 	return &Data{
 		Symbol:                  symbol,
+		Timeframes:              timeframes,
 		CurrentPrice:            currentPrice,
 		PriceChange1h:           priceChange1h,
 		PriceChange4h:           priceChange4h,
@@ -712,14 +991,24 @@ func getMarketDataFromAPI(symbol string) (*Data, error) {
 		CurrentRSI7:             currentRSI7,
 		OpenInterest:            oiData,
 		FundingRate:             fundingRate,
+		FundingHistory:          fundingHistory,
+		NextFundingTime:         nextFundingTime,
+		VWAP5m:                  calculateSessionVWAP(sessionKlines5m),
+		VWAP15m:                 calculateSessionVWAP(klines15m),
+		VWAP1h:                  calculateSessionVWAP(klines1h),
+		DailyPivots:             dailyPivots,
 		IntradaySeries:          intradayData,
 		MidTermSeries15m:        midTermData15m,
 		MidTermSeries1h:         midTermData1h,
 		MidTermSeries4h:         midTermData4h,
+		ExtraSeries:             extraSeries,
 		FourHourZones:           fourHourZones,
 		FifteenMinZones:         fifteenMinZones,
 		Fib4h:                   fib4h,
 		Fib1h:                   fib1h,
+		FibConfluence:           fibConfluence,
+		VolumeProfile4h:         volumeProfile4h,
+		VolumeProfile15m:        volumeProfile15m,
 		PriceAction5m:           pa5,
 		PriceAction15m:          pa15,
 		PriceAction1h:           pa1h,
@@ -728,6 +1017,9 @@ func getMarketDataFromAPI(symbol string) (*Data, error) {
 		CandleShapes15m:         candles15m,
 		CandleShapes1h:          candles1h,
 		CandleShapes4h:          candles4h,
+		HeikinAshi15m:           heikinAshi15m,
+		HeikinAshi1h:            heikinAshi1h,
+		HeikinAshi4h:            heikinAshi4h,
 		Derivatives:             derivativesData,
 		KeyLevels:               keyLevels,
 		DistanceMetrics:         distanceMetrics,
@@ -971,7 +1263,7 @@ func detect15mZones(klines []Kline, ctx *MidTermData15m) []SRZone {
 		}
 	}
 
-	return zones
+	return consolidateZones(zones, zoneConfig.MergeTolerancePct)
 }
 
 // pickKeyZones 从一堆SRZone中选出每一侧(支撑/压力)最强且离当前价最近的若干个
@@ -1035,6 +1327,101 @@ func pickKeyZones(zones []SRZone, currentPrice float64, maxPerSide int) (support
 	return
 }
 
+// NearestZone 返回价格下方最近的支撑区（kind="support"）或上方最近的压力区（kind="resistance"）
+// 以区间中心判断方向与距离，没有符合条件的区间时返回 false
+func NearestZone(zones []SRZone, kind string, price float64) (SRZone, bool) {
+	var best SRZone
+	found := false
+	bestDist := math.MaxFloat64
+	for _, z := range zones {
+		if z.Kind != kind {
+			continue
+		}
+		center := (z.Lower + z.Upper) / 2
+		var dist float64
+		switch kind {
+		case "support":
+			dist = price - center
+		case "resistance":
+			dist = center - price
+		default:
+			continue
+		}
+		if dist <= 0 || dist >= bestDist {
+			continue
+		}
+		best, bestDist, found = z, dist, true
+	}
+	return best, found
+}
+
+// ZoneConfig 支撑/压力区后处理配置
+type ZoneConfig struct {
+	MergeTolerancePct float64 // 同类区间重叠或间距不超过区间中心价该百分比时合并，<=0 表示只合并重叠区间
+}
+
+// zoneConfig 包级别的支撑/压力区配置
+var zoneConfig = ZoneConfig{
+	MergeTolerancePct: 0.1, // 0.1%
+}
+
+// SetZoneConfig 设置支撑/压力区配置（在程序启动时调用）
+func SetZoneConfig(config ZoneConfig) {
+	zoneConfig = config
+}
+
+// consolidateZones 合并重叠或间距在 mergeTolerancePct 内的同类区间，避免价格围绕同一价位反复震荡时
+// 产生大量几乎相同的碎片区间：合并后区间取并集，Hits 累加，Strength 取最大，Basis 去重后以 "|" 连接
+func consolidateZones(zones []SRZone, mergeTolerancePct float64) []SRZone {
+	if len(zones) < 2 {
+		return zones
+	}
+
+	sorted := make([]SRZone, len(zones))
+	copy(sorted, zones)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Kind != sorted[j].Kind {
+			return sorted[i].Kind < sorted[j].Kind
+		}
+		return sorted[i].Lower < sorted[j].Lower
+	})
+
+	merged := make([]SRZone, 0, len(sorted))
+	for _, z := range sorted {
+		if n := len(merged); n > 0 && merged[n-1].Kind == z.Kind {
+			last := &merged[n-1]
+			center := (last.Lower + last.Upper) / 2
+			if z.Lower-last.Upper <= center*mergeTolerancePct/100 {
+				last.Upper = math.Max(last.Upper, z.Upper)
+				last.Hits += z.Hits
+				if z.Strength > last.Strength {
+					last.Strength = z.Strength
+				}
+				last.Basis = mergeZoneBasis(last.Basis, z.Basis)
+				continue
+			}
+		}
+		merged = append(merged, z)
+	}
+	return merged
+}
+
+// mergeZoneBasis 合并区间依据描述，已包含的依据不重复添加
+func mergeZoneBasis(a, b string) string {
+	if a == "" {
+		return b
+	}
+	for _, part := range strings.Split(a, "|") {
+		if part == b {
+			return a
+		}
+	}
+	if b == "" {
+		return a
+	}
+	return a + "|" + b
+}
+
 // findZoneIndex 在已有zones里查有没有同类且价格接近的
 func findZoneIndex(zones []SRZone, price float64, tol float64, kind string) int {
 	for i, z := range zones {
@@ -1111,18 +1498,173 @@ func calcFibFromKlines(klines []Kline, timeframe string) *FibSet {
 	}
 }
 
-// GetKlines 从Binance获取K线数据（导出给API使用）
+// isKeyFibRatio 是否为关键比例（0.382/0.5/0.618/0.65）
+func isKeyFibRatio(ratio float64) bool {
+	for _, r := range []float64{0.382, 0.5, 0.618, 0.65} {
+		if math.Abs(ratio-r) < 0.001 {
+			return true
+		}
+	}
+	return false
+}
+
+// FindFibConfluence 找出 4h 与 1h 斐波那契价位间距在 tolerancePct% 以内的共振区，按价格从低到高返回
+func FindFibConfluence(fib4h, fib1h *FibSet, tolerancePct float64) []FibConfluence {
+	if fib4h == nil || fib1h == nil || tolerancePct <= 0 {
+		return nil
+	}
+
+	var result []FibConfluence
+	for _, l4 := range fib4h.Levels {
+		for _, l1 := range fib1h.Levels {
+			if l4.Price <= 0 || l1.Price <= 0 {
+				continue
+			}
+			price := (l4.Price + l1.Price) / 2
+			gapPct := math.Abs(l4.Price-l1.Price) / price * 100
+			if gapPct > tolerancePct {
+				continue
+			}
+
+			strength := 1
+			if isKeyFibRatio(l4.Ratio) && isKeyFibRatio(l1.Ratio) {
+				strength++
+			}
+			if gapPct <= tolerancePct/2 {
+				strength++
+			}
+			result = append(result, FibConfluence{
+				Price:              price,
+				Ratio4h:            l4.Ratio,
+				Ratio1h:            l1.Ratio,
+				ConfluenceStrength: strength,
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Price < result[j].Price })
+	return result
+}
+
+// nearestFibConfluence 取距当前价最近的 limit 个共振区
+func nearestFibConfluence(zones []FibConfluence, currentPrice float64, limit int) []FibConfluence {
+	nearest := append([]FibConfluence(nil), zones...)
+	sort.SliceStable(nearest, func(i, j int) bool {
+		return math.Abs(nearest[i].Price-currentPrice) < math.Abs(nearest[j].Price-currentPrice)
+	})
+	if len(nearest) > limit {
+		nearest = nearest[:limit]
+	}
+	return nearest
+}
+
+// binanceFuturesBaseURL Binance U本位合约API地址（测试中可替换为mock server）
+var binanceFuturesBaseURL = "https://fapi.binance.com"
+
+// maxKlinesPerRequest 单次K线请求上限（Binance/Aster 为1500，按时间范围分页时各数据源统一使用）
+const maxKlinesPerRequest = 1500
+
+// GetKlines 从默认行情数据源（见 SetDefaultSource，未设置时为Binance）获取K线数据（导出给API使用），短时间内的重复请求由K线缓存直接返回
 func GetKlines(symbol, interval string, limit int) ([]Kline, error) {
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/klines?symbol=%s&interval=%s&limit=%d",
-		symbol, interval, limit)
+	return getKlinesContext(context.Background(), symbol, interval, limit)
+}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
+// getKlinesContext 同 GetKlines，ctx 取消时中断请求
+// 使用 ctx 携带的行情数据源（见 WithSource），未指定时为默认数据源
+func getKlinesContext(ctx context.Context, symbol, interval string, limit int) ([]Kline, error) {
+	source := SourceFromContext(ctx)
+	if klines, ok := getCachedKlines(source, symbol, interval, limit); ok {
+		return klines, nil
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	// 缓存未命中时合并同一数据源+symbol+interval 的并发请求
+	return fetchKlinesShared(ctx, source, symbol, interval, limit, func(ctx context.Context) ([]Kline, error) {
+		klines, err := source.GetKlines(ctx, symbol, interval, limit)
+		if err != nil {
+			return nil, err
+		}
+		storeKlines(source, symbol, interval, limit, klines)
+		return klines, nil
+	})
+}
+
+// GetKlinesRange 获取指定时间范围内的K线（回测用，不经过K线缓存），使用默认行情数据源
+// startTime 为零值时返回截止到 endTime 的最近 limit 根；否则从 startTime 向后获取至 endTime，
+// limit <= 0 表示不限数量。超过单次上限时自动分页。
+func GetKlinesRange(symbol, interval string, startTime, endTime time.Time, limit int) ([]Kline, error) {
+	return GetKlinesRangeContext(context.Background(), symbol, interval, startTime, endTime, limit)
+}
+
+// GetKlinesRangeContext 同 GetKlinesRange，使用 ctx 携带的行情数据源（见 WithSource），ctx 取消时中断请求
+func GetKlinesRangeContext(ctx context.Context, symbol, interval string, startTime, endTime time.Time, limit int) ([]Kline, error) {
+	source, ok := SourceFromContext(ctx).(KlineRangeSource)
+	if !ok {
+		return nil, fmt.Errorf("行情数据源 %T 不支持按时间范围获取K线", SourceFromContext(ctx))
+	}
+	if endTime.IsZero() {
+		endTime = time.Now()
+	}
+	if startTime.IsZero() {
+		return getKlinesBackward(ctx, source, symbol, interval, endTime.UnixMilli(), limit)
+	}
+	return getKlinesForward(ctx, source, symbol, interval, startTime.UnixMilli(), endTime.UnixMilli(), limit)
+}
+
+// getKlinesBackward 从 endMs 向前分页获取 limit 根K线（结果按时间正序）
+func getKlinesBackward(ctx context.Context, source KlineRangeSource, symbol, interval string, endMs int64, limit int) ([]Kline, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("未指定startTime时limit必须大于0")
+	}
+
+	var klines []Kline
+	for len(klines) < limit {
+		batch := limit - len(klines)
+		if batch > maxKlinesPerRequest {
+			batch = maxKlinesPerRequest
+		}
+		page, err := source.GetKlinesPage(ctx, symbol, interval, 0, endMs, batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		klines = append(page, klines...)
+		if len(page) < batch {
+			break // 已到最早数据
+		}
+		endMs = page[0].OpenTime - 1
+	}
+	return klines, nil
+}
+
+// getKlinesForward 从 startMs 向后分页获取至 endMs 的K线
+func getKlinesForward(ctx context.Context, source KlineRangeSource, symbol, interval string, startMs, endMs int64, limit int) ([]Kline, error) {
+	var klines []Kline
+	for startMs <= endMs && (limit <= 0 || len(klines) < limit) {
+		batch := maxKlinesPerRequest
+		if limit > 0 && limit-len(klines) < batch {
+			batch = limit - len(klines)
+		}
+		page, err := source.GetKlinesPage(ctx, symbol, interval, startMs, endMs, batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		klines = append(klines, page...)
+		if len(page) < batch {
+			break // 已到 endTime
+		}
+		startMs = page[len(page)-1].OpenTime + 1
+	}
+	return klines, nil
+}
+
+// fetchKlines 请求K线接口并解析
+func fetchKlines(ctx context.Context, url string) ([]Kline, error) {
+	body, err := httpGetWithRetry(ctx, url)
 	if err != nil {
 		return nil, err
 	}
@@ -1132,16 +1674,59 @@ func GetKlines(symbol, interval string, limit int) ([]Kline, error) {
 		return nil, err
 	}
 
-	klines := make([]Kline, len(rawData))
-	for i, item := range rawData {
-		openTime := int64(item[0].(float64))
-		open, _ := parseFloat(item[1])
-		high, _ := parseFloat(item[2])
-		low, _ := parseFloat(item[3])
-		closeVal, _ := parseFloat(item[4])
-		volume, _ := parseFloat(item[5])
-		closeTime := int64(item[6].(float64))
+	parsed, malformed := parseKlines(rawData)
+	klines, dropped := sanitizeKlines(parsed)
+	if malformed+dropped > 0 {
+		fmt.Printf("⚠ 丢弃 %d 根异常K线（格式错误/价格非正/high<low/时间非递增）: %s\n", malformed+dropped, url)
+	}
+	return klines, nil
+}
+
+// sanitizeKlines 数据质量校验：丢弃OHLC非正、high<low、openTime非严格递增的K线
+// 返回保留的K线与被丢弃的数量
+func sanitizeKlines(klines []Kline) ([]Kline, int) {
+	valid := klines[:0]
+	var lastOpenTime int64
+	for _, k := range klines {
+		if k.Open <= 0 || k.High <= 0 || k.Low <= 0 || k.Close <= 0 {
+			continue
+		}
+		if k.High < k.Low {
+			continue
+		}
+		if len(valid) > 0 && k.OpenTime <= lastOpenTime {
+			continue
+		}
+		valid = append(valid, k)
+		lastOpenTime = k.OpenTime
+	}
+	return valid, len(klines) - len(valid)
+}
+
+// parseKlines 解析Binance原始K线数组
+// 字段不足或必需字段类型不符的行直接跳过，返回解析出的K线与跳过的行数
+func parseKlines(rawData [][]interface{}) ([]Kline, int) {
+	klines := make([]Kline, 0, len(rawData))
+	for _, item := range rawData {
+		if len(item) < 7 {
+			continue
+		}
+		var fields [7]float64
+		valid := true
+		for j := range fields {
+			v, err := parseFloat(item[j])
+			if err != nil {
+				valid = false
+				break
+			}
+			fields[j] = v
+		}
+		if !valid {
+			continue
+		}
+		volume := fields[5]
 
+		// 可选字段解析失败时按0处理
 		quoteVol := 0.0
 		if len(item) > 7 {
 			quoteVol, _ = parseFloat(item[7])
@@ -1149,7 +1734,9 @@ func GetKlines(symbol, interval string, limit int) ([]Kline, error) {
 
 		trades := 0
 		if len(item) > 8 {
-			trades = int(item[8].(float64))
+			if v, err := parseFloat(item[8]); err == nil {
+				trades = int(v)
+			}
 		}
 
 		takerBuyBase := 0.0
@@ -1167,24 +1754,24 @@ func GetKlines(symbol, interval string, limit int) ([]Kline, error) {
 			buySellRatio = takerBuyBase / volume
 		}
 
-		klines[i] = Kline{
-			OpenTime:            openTime,
-			Open:                open,
-			High:                high,
-			Low:                 low,
-			Close:               closeVal,
+		klines = append(klines, Kline{
+			OpenTime:            int64(fields[0]),
+			Open:                fields[1],
+			High:                fields[2],
+			Low:                 fields[3],
+			Close:               fields[4],
 			Volume:              volume,
-			CloseTime:           closeTime,
+			CloseTime:           int64(fields[6]),
 			TakerBuyVolume:      takerBuyBase,
 			BuySellRatio:        buySellRatio,
 			QuoteVolume:         quoteVol,
 			Trades:              trades,
 			TakerBuyBaseVolume:  takerBuyBase,
 			TakerBuyQuoteVolume: takerBuyQuote,
-		}
+		})
 	}
 
-	return klines, nil
+	return klines, len(rawData) - len(klines)
 }
 
 // CalculateEMA 计算EMA指标（导出给API使用）
@@ -1248,8 +1835,8 @@ func getTechnicalIndicatorParams(timeframe string) (rsiShort, rsiLong, bollinger
 		// 小时周期：标准参数
 		return 7, 14, 20, 14, 3, 14, 14, 20, 2.0
 	case "4h":
-		// 长期周期：更平滑的参数
-		return 14, 21, 25, 20, 3, 14, 20, 25, 2.0
+		// 长期周期：更平滑的参数（ADX 统一使用标准14周期）
+		return 14, 21, 25, 14, 3, 14, 20, 25, 2.0
 	default:
 		// 默认参数
 		return 7, 14, 20, 14, 3, 14, 14, 20, 2.0
@@ -1448,6 +2035,118 @@ func CalculateRSI(klines []Kline, period int) float64 {
 	return rsi
 }
 
+const (
+	stochRSIPeriod  = 14 // StochRSI 的 RSI 周期与随机窗口
+	stochRSISmoothK = 3  // %K 平滑周期
+	stochRSISmoothD = 3  // %D 平滑周期
+	williamsRPeriod = 14 // Williams %R 回看周期
+	cciPeriod       = 14 // CCI 回看周期
+
+	parabolicSARInitialAF = 0.02 // 抛物线SAR初始加速因子（同时为步长）
+	parabolicSARMaxAF     = 0.20 // 抛物线SAR最大加速因子
+
+	ichimokuTenkanPeriod = 9  // 一目均衡表转换线周期
+	ichimokuKijunPeriod  = 26 // 一目均衡表基准线周期
+	ichimokuSpanBPeriod  = 52 // 一目均衡表先行带B周期
+	ichimokuDisplacement = 26 // 云带前移/迟行线后移周期
+
+	volumeProfileBuckets       = 24   // 成交量分布默认价格分桶数
+	volumeProfileValueArea     = 0.70 // 价值区包含的成交量比例
+	volumeProfileLowVolumeNode = 0.25 // 低于 POC 成交量该比例的局部低谷视为低成交量节点
+)
+
+// stochRSIMinBars 计算 StochRSI 所需的最少K线数量
+func stochRSIMinBars(rsiPeriod, stochPeriod int) int {
+	return rsiPeriod + stochPeriod + stochRSISmoothK + stochRSISmoothD - 1
+}
+
+// calculateRSISeries 计算完整的RSI序列（Wilder平滑，与 CalculateRSI 结果一致）
+// 返回值第 j 个元素对应 klines[period+j]
+func calculateRSISeries(klines []Kline, period int) []float64 {
+	if period <= 0 || len(klines) <= period {
+		return nil
+	}
+
+	gains := 0.0
+	losses := 0.0
+	for i := 1; i <= period; i++ {
+		change := klines[i].Close - klines[i-1].Close
+		if change > 0 {
+			gains += change
+		} else {
+			losses += -change
+		}
+	}
+	avgGain := gains / float64(period)
+	avgLoss := losses / float64(period)
+
+	toRSI := func() float64 {
+		if avgLoss == 0 {
+			return 100
+		}
+		return 100 - (100 / (1 + avgGain/avgLoss))
+	}
+
+	series := make([]float64, 0, len(klines)-period)
+	series = append(series, toRSI())
+	for i := period + 1; i < len(klines); i++ {
+		change := klines[i].Close - klines[i-1].Close
+		if change > 0 {
+			avgGain = (avgGain*float64(period-1) + change) / float64(period)
+			avgLoss = (avgLoss * float64(period-1)) / float64(period)
+		} else {
+			avgGain = (avgGain * float64(period-1)) / float64(period)
+			avgLoss = (avgLoss*float64(period-1) + (-change)) / float64(period)
+		}
+		series = append(series, toRSI())
+	}
+	return series
+}
+
+// calculateStochRSI 计算随机RSI（StochRSI）的 %K 与 %D（0-100）
+// stoch = (RSI - 最低RSI) / (最高RSI - 最低RSI)，窗口为 stochPeriod；
+// %K 为 stoch 的3周期SMA，%D 为 %K 的3周期SMA。数据不足时返回 0, 0
+func calculateStochRSI(klines []Kline, rsiPeriod, stochPeriod int) (k, d float64) {
+	if rsiPeriod <= 0 || stochPeriod <= 0 || len(klines) < stochRSIMinBars(rsiPeriod, stochPeriod) {
+		return 0, 0
+	}
+
+	rsiValues := calculateRSISeries(klines, rsiPeriod)
+
+	// 只需最后 smoothK+smoothD-1 个 stoch 值
+	needStoch := stochRSISmoothK + stochRSISmoothD - 1
+	stoch := make([]float64, 0, needStoch)
+	for end := len(rsiValues) - needStoch; end < len(rsiValues); end++ {
+		window := rsiValues[end-stochPeriod+1 : end+1]
+		lowest, highest := window[0], window[0]
+		for _, v := range window {
+			lowest = math.Min(lowest, v)
+			highest = math.Max(highest, v)
+		}
+		if highest == lowest {
+			stoch = append(stoch, 50) // RSI 无波动时视为中性
+			continue
+		}
+		stoch = append(stoch, (rsiValues[end]-lowest)/(highest-lowest)*100)
+	}
+
+	kValues := make([]float64, 0, stochRSISmoothD)
+	for end := stochRSISmoothK - 1; end < len(stoch); end++ {
+		sum := 0.0
+		for _, v := range stoch[end-stochRSISmoothK+1 : end+1] {
+			sum += v
+		}
+		kValues = append(kValues, sum/float64(stochRSISmoothK))
+	}
+
+	k = kValues[len(kValues)-1]
+	for _, v := range kValues {
+		d += v
+	}
+	d /= float64(len(kValues))
+	return k, d
+}
+
 // extractCandleShapes 从K线中提取最近lookback根的几何特征
 func extractCandleShapes(klines []Kline, lookback int, atrPeriod int) []CandleShape {
 	n := len(klines)
@@ -1520,6 +2219,71 @@ func extractCandleShapes(klines []Kline, lookback int, atrPeriod int) []CandleSh
 	return shapes
 }
 
+// convertToHeikinAshi 将普通K线转换为Heikin-Ashi K线（时间、成交量等字段保持不变）：
+// HA_Close=(O+H+L+C)/4，HA_Open=(前一根HA_Open+前一根HA_Close)/2（首根为(O+C)/2），
+// HA_High=max(H,HA_Open,HA_Close)，HA_Low=min(L,HA_Open,HA_Close)
+func convertToHeikinAshi(klines []Kline) []Kline {
+	if len(klines) == 0 {
+		return nil
+	}
+
+	ha := make([]Kline, len(klines))
+	for i, k := range klines {
+		haClose := (k.Open + k.High + k.Low + k.Close) / 4
+		haOpen := (k.Open + k.Close) / 2
+		if i > 0 {
+			haOpen = (ha[i-1].Open + ha[i-1].Close) / 2
+		}
+
+		ha[i] = k
+		ha[i].Open = haOpen
+		ha[i].Close = haClose
+		ha[i].High = math.Max(k.High, math.Max(haOpen, haClose))
+		ha[i].Low = math.Min(k.Low, math.Min(haOpen, haClose))
+	}
+	return ha
+}
+
+// haNoWickPct 影线占比低于该值视为无影线
+const haNoWickPct = 0.01
+
+// summarizeHeikinAshi 汇总最近的Heikin-Ashi趋势：最新K线起连续同向根数，以及其中连续无反向影线的根数
+// （阳线无下影、阴线无上影为强趋势特征），最新K线为十字星时返回空
+func summarizeHeikinAshi(shapes []CandleShape) string {
+	if len(shapes) == 0 {
+		return ""
+	}
+	dir := shapes[len(shapes)-1].Direction
+	if dir != "bull" && dir != "bear" {
+		return ""
+	}
+
+	streak, noWick := 0, 0
+	countingWick := true
+	for i := len(shapes) - 1; i >= 0 && shapes[i].Direction == dir; i-- {
+		streak++
+		wick := shapes[i].LowerWickPct
+		if dir == "bear" {
+			wick = shapes[i].UpperWickPct
+		}
+		if countingWick && wick < haNoWickPct {
+			noWick++
+		} else {
+			countingWick = false
+		}
+	}
+
+	wickSide := "lower"
+	if dir == "bear" {
+		wickSide = "upper"
+	}
+	summary := fmt.Sprintf("consecutive %s candles: %d", dir, streak)
+	if noWick > 0 {
+		summary += fmt.Sprintf(", no %s wicks for last %d", wickSide, noWick)
+	}
+	return summary
+}
+
 // calculateATR 计算ATR
 func calculateATR(klines []Kline, period int) float64 {
 	if len(klines) <= period {
@@ -1641,14 +2405,28 @@ func calculateIntradaySeries(klines []Kline) *IntradayData {
 			rsi14 := CalculateRSI(klines[:i+1], 14)
 			data.RSI14Values = append(data.RSI14Values, rsi14)
 		}
+		if i+1 >= stochRSIMinBars(stochRSIPeriod, stochRSIPeriod) {
+			k, d := calculateStochRSI(klines[:i+1], stochRSIPeriod, stochRSIPeriod)
+			data.StochRSIK = append(data.StochRSIK, k)
+			data.StochRSID = append(data.StochRSID, d)
+		}
 	}
 
-	// 计算OBV
+	// 计算OBV及背离
 	data.OBVValues = calculateOBV(klines)
+	data.OBVDivergence = detectOBVDivergence(klines, data.OBVValues, obvDivergenceLookback)
 	if len(data.OBVValues) > 10 {
 		data.OBVValues = data.OBVValues[len(data.OBVValues)-10:]
 	}
 
+	data.VolumeDeltas = calculateVolumeDeltas(klines)
+	if len(data.VolumeDeltas) > 10 {
+		data.VolumeDeltas = data.VolumeDeltas[len(data.VolumeDeltas)-10:]
+	}
+
+	data.ParabolicSARValues, data.ParabolicSARDirection = parabolicSARSummary(klines)
+	data.VWAPValues = rollingSessionVWAP(klines, 10)
+
 	return data
 }
 
@@ -1699,6 +2477,11 @@ func calculateMidTermSeries15m(klines []Kline) *MidTermData15m {
 			rsiLongVal := CalculateRSI(klines[:i+1], rsiLong)
 			data.RSI14Values = append(data.RSI14Values, rsiLongVal)
 		}
+		if i+1 >= stochRSIMinBars(stochRSIPeriod, stochRSIPeriod) {
+			k, d := calculateStochRSI(klines[:i+1], stochRSIPeriod, stochRSIPeriod)
+			data.StochRSIK = append(data.StochRSIK, k)
+			data.StochRSID = append(data.StochRSID, d)
+		}
 	}
 
 	_, _, bollingerPeriod, _, _, _, mfiPeriod, _, bollingerMult := getTechnicalIndicatorParams("15m")
@@ -1712,6 +2495,8 @@ func calculateMidTermSeries15m(klines []Kline) *MidTermData15m {
 		data.OBVValues = data.OBVValues[len(data.OBVValues)-10:]
 	}
 
+	data.ParabolicSARValues, data.ParabolicSARDirection = parabolicSARSummary(klines)
+
 	return data
 }
 
@@ -1774,12 +2559,20 @@ func calculateMidTermSeries1h(klines []Kline) *MidTermData1h {
 			rsiLongVal := CalculateRSI(klines[:i+1], rsiLong)
 			data.RSI14Values = append(data.RSI14Values, rsiLongVal)
 		}
+		if i+1 >= stochRSIMinBars(stochRSIPeriod, stochRSIPeriod) {
+			k, d := calculateStochRSI(klines[:i+1], stochRSIPeriod, stochRSIPeriod)
+			data.StochRSIK = append(data.StochRSIK, k)
+			data.StochRSID = append(data.StochRSID, d)
+		}
 	}
 
 	// 计算ADX和DI
 	_, _, _, adxPeriod, _, _, _, _, _ := getTechnicalIndicatorParams("1h")
 	data.ADX, data.DIPlus, data.DIMinus = calculateADX(klines, adxPeriod)
+	data.WilliamsR14 = calculateWilliamsR(klines, williamsRPeriod)
+	data.CCI14 = calculateCCI(klines, cciPeriod)
 	data.VWAP = calculateVWAP(klines)
+	data.Ichimoku = calculateIchimoku(klines)
 
 	// 计算OBV
 	data.OBVValues = calculateOBV(klines)
@@ -1849,14 +2642,23 @@ func calculateMidTermSeries4h(klines []Kline) *MidTermSeries4h {
 			rsiLongVal := CalculateRSI(klines[:i+1], rsiLong)
 			data.RSI14Values = append(data.RSI14Values, rsiLongVal)
 		}
+		if i+1 >= stochRSIMinBars(stochRSIPeriod, stochRSIPeriod) {
+			k, d := calculateStochRSI(klines[:i+1], stochRSIPeriod, stochRSIPeriod)
+			data.StochRSIK = append(data.StochRSIK, k)
+			data.StochRSID = append(data.StochRSID, d)
+		}
 	}
 
 	// 计算技术指标
 	_, _, bollingerPeriod, adxPeriod, atrShort, atrLong, _, cmfPeriod, bollingerMult := getTechnicalIndicatorParams("4h")
 	data.Bollinger = CalculateBollinger(klines, bollingerPeriod, bollingerMult)
 	data.ADX, data.DIPlus, data.DIMinus = calculateADX(klines, adxPeriod)
+	data.TrendStrength = classifyTrendStrength(data.ADX)
+	data.WilliamsR14 = calculateWilliamsR(klines, williamsRPeriod)
+	data.CCI14 = calculateCCI(klines, cciPeriod)
 	data.ATR3 = calculateATR(klines, atrShort)
 	data.ATR14 = calculateATR(klines, atrLong)
+	data.Ichimoku = calculateIchimoku(klines)
 
 	if len(klines) > 0 {
 		data.CurrentVolume = klines[len(klines)-1].Volume
@@ -1881,17 +2683,11 @@ func calculateMidTermSeries4h(klines []Kline) *MidTermSeries4h {
 	return data
 }
 
-// getOpenInterestData 获取OI数据
-func getOpenInterestData(symbol string) (*OIData, error) {
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/openInterest?symbol=%s", symbol)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+// getOpenInterestData 从Binance兼容接口（Binance/Aster）获取OI数据
+func getOpenInterestData(ctx context.Context, baseURL, symbol string) (*OIData, error) {
+	url := fmt.Sprintf("%s/fapi/v1/openInterest?symbol=%s", baseURL, symbol)
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := httpGetWithRetry(ctx, url)
 	if err != nil {
 		return nil, err
 	}
@@ -1914,19 +2710,50 @@ func getOpenInterestData(symbol string) (*OIData, error) {
 	}, nil
 }
 
-// getFundingRate 获取资金费率
-func getFundingRate(symbol string) (float64, error) {
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/premiumIndex?symbol=%s", symbol)
+// fundingHistoryLimit 提示词中展示的历史资金费率次数
+const fundingHistoryLimit = 8
+
+// getFundingRate 从Binance获取资金费率
+func getFundingRate(ctx context.Context, symbol string) (float64, error) {
+	rate, _, err := getPremiumIndex(ctx, binanceFuturesBaseURL, symbol)
+	return rate, err
+}
 
-	resp, err := http.Get(url)
+// getFundingInfo 从Binance兼容接口获取最新资金费率、下次结算时间及最近 historyLimit 次历史费率
+// 历史费率获取失败时只返回最新费率
+func getFundingInfo(ctx context.Context, baseURL, symbol string, historyLimit int) (*FundingInfo, error) {
+	rate, nextFundingTime, err := getPremiumIndex(ctx, baseURL, symbol)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	defer resp.Body.Close()
+	info := &FundingInfo{Rate: rate, NextFundingTime: nextFundingTime}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	url := fmt.Sprintf("%s/fapi/v1/fundingRate?symbol=%s&limit=%d", baseURL, symbol, historyLimit)
+	body, err := httpGetWithRetry(ctx, url)
 	if err != nil {
-		return 0, err
+		return info, nil
+	}
+	var raw []struct {
+		FundingRate string `json:"fundingRate"`
+		FundingTime int64  `json:"fundingTime"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return info, nil
+	}
+	sort.Slice(raw, func(i, j int) bool { return raw[i].FundingTime < raw[j].FundingTime })
+	for _, item := range raw {
+		info.History = append(info.History, safeParseFloat(item.FundingRate))
+	}
+	return info, nil
+}
+
+// getPremiumIndex 从Binance兼容接口获取最新资金费率与下次结算时间（毫秒）
+func getPremiumIndex(ctx context.Context, baseURL, symbol string) (float64, int64, error) {
+	url := fmt.Sprintf("%s/fapi/v1/premiumIndex?symbol=%s", baseURL, symbol)
+
+	body, err := httpGetWithRetry(ctx, url)
+	if err != nil {
+		return 0, 0, err
 	}
 
 	var result struct {
@@ -1940,15 +2767,15 @@ func getFundingRate(symbol string) (float64, error) {
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	rate, _ := strconv.ParseFloat(result.LastFundingRate, 64)
-	return rate, nil
+	return rate, result.NextFundingTime, nil
 }
 
 // fetchDerivativesSuite 抓取15m/1h/4h的衍生品指标
-func fetchDerivativesSuite(symbol string) *DerivativesData {
+func fetchDerivativesSuite(ctx context.Context, symbol string) *DerivativesData {
 	intervals := []string{"15m", "1h", "4h"}
 	limit := 30
 
@@ -1961,24 +2788,24 @@ func fetchDerivativesSuite(symbol string) *DerivativesData {
 	}
 
 	for _, interval := range intervals {
-		if entries, err := fetchOpenInterestHistory(symbol, interval, limit); err == nil && len(entries) > 0 {
+		if entries, err := fetchOpenInterestHistory(ctx, symbol, interval, limit); err == nil && len(entries) > 0 {
 			data.OpenInterestHist[interval] = entries
 		}
-		if entries, err := fetchTopLongShortRatio(symbol, interval, limit); err == nil && len(entries) > 0 {
+		if entries, err := fetchTopLongShortRatio(ctx, symbol, interval, limit); err == nil && len(entries) > 0 {
 			data.TopLongShortRatio[interval] = entries
 		}
-		if entries, err := fetchGlobalAccountRatio(symbol, interval, limit); err == nil && len(entries) > 0 {
+		if entries, err := fetchGlobalAccountRatio(ctx, symbol, interval, limit); err == nil && len(entries) > 0 {
 			data.GlobalLongShortAcct[interval] = entries
 		}
-		if entries, err := fetchTakerBuySellRatio(symbol, interval, limit); err == nil && len(entries) > 0 {
+		if entries, err := fetchTakerBuySellRatio(ctx, symbol, interval, limit); err == nil && len(entries) > 0 {
 			data.TakerBuySellVolume[interval] = entries
 		}
-		if entries, err := fetchBasisSeries(symbol, interval, limit); err == nil && len(entries) > 0 {
+		if entries, err := fetchBasisSeries(ctx, symbol, interval, limit); err == nil && len(entries) > 0 {
 			data.Basis[interval] = entries
 		}
 	}
 
-	if entries, err := fetchFundingRateHistory(symbol, limit); err == nil && len(entries) > 0 {
+	if entries, err := fetchFundingRateHistory(ctx, symbol, limit); err == nil && len(entries) > 0 {
 		data.FundingRateHistory = entries
 	}
 
@@ -2003,14 +2830,14 @@ func fetchDerivativesSuite(symbol string) *DerivativesData {
 	return data
 }
 
-func fetchOpenInterestHistory(symbol, period string, limit int) ([]OpenInterestHistEntry, error) {
+func fetchOpenInterestHistory(ctx context.Context, symbol, period string, limit int) ([]OpenInterestHistEntry, error) {
 	url := fmt.Sprintf("https://fapi.binance.com/futures/data/openInterestHist?symbol=%s&period=%s&limit=%d", symbol, period, limit)
 	var raw []struct {
 		SumOpenInterest      string `json:"sumOpenInterest"`
 		SumOpenInterestValue string `json:"sumOpenInterestValue"`
 		Timestamp            int64  `json:"timestamp"`
 	}
-	if err := performBinanceGET(url, &raw); err != nil {
+	if err := performBinanceGET(ctx, url, &raw); err != nil {
 		return nil, err
 	}
 	out := make([]OpenInterestHistEntry, 0, len(raw))
@@ -2024,7 +2851,7 @@ func fetchOpenInterestHistory(symbol, period string, limit int) ([]OpenInterestH
 	return out, nil
 }
 
-func fetchTopLongShortRatio(symbol, period string, limit int) ([]LongShortRatioEntry, error) {
+func fetchTopLongShortRatio(ctx context.Context, symbol, period string, limit int) ([]LongShortRatioEntry, error) {
 	url := fmt.Sprintf("https://fapi.binance.com/futures/data/topLongShortPositionRatio?symbol=%s&period=%s&limit=%d", symbol, period, limit)
 	var raw []struct {
 		LongShortRatio string `json:"longShortRatio"`
@@ -2032,7 +2859,7 @@ func fetchTopLongShortRatio(symbol, period string, limit int) ([]LongShortRatioE
 		ShortAccount   string `json:"shortAccount"`
 		Timestamp      int64  `json:"timestamp"`
 	}
-	if err := performBinanceGET(url, &raw); err != nil {
+	if err := performBinanceGET(ctx, url, &raw); err != nil {
 		return nil, err
 	}
 	out := make([]LongShortRatioEntry, 0, len(raw))
@@ -2047,7 +2874,7 @@ func fetchTopLongShortRatio(symbol, period string, limit int) ([]LongShortRatioE
 	return out, nil
 }
 
-func fetchGlobalAccountRatio(symbol, period string, limit int) ([]LongShortRatioEntry, error) {
+func fetchGlobalAccountRatio(ctx context.Context, symbol, period string, limit int) ([]LongShortRatioEntry, error) {
 	url := fmt.Sprintf("https://fapi.binance.com/futures/data/globalLongShortAccountRatio?symbol=%s&period=%s&limit=%d", symbol, period, limit)
 	var raw []struct {
 		LongShortRatio string `json:"longShortRatio"`
@@ -2055,7 +2882,7 @@ func fetchGlobalAccountRatio(symbol, period string, limit int) ([]LongShortRatio
 		ShortAccount   string `json:"shortAccount"`
 		Timestamp      int64  `json:"timestamp"`
 	}
-	if err := performBinanceGET(url, &raw); err != nil {
+	if err := performBinanceGET(ctx, url, &raw); err != nil {
 		return nil, err
 	}
 	out := make([]LongShortRatioEntry, 0, len(raw))
@@ -2070,7 +2897,7 @@ func fetchGlobalAccountRatio(symbol, period string, limit int) ([]LongShortRatio
 	return out, nil
 }
 
-func fetchTakerBuySellRatio(symbol, period string, limit int) ([]TakerBuySellEntry, error) {
+func fetchTakerBuySellRatio(ctx context.Context, symbol, period string, limit int) ([]TakerBuySellEntry, error) {
 	url := fmt.Sprintf("https://fapi.binance.com/futures/data/takerlongshortRatio?symbol=%s&period=%s&limit=%d", symbol, period, limit)
 	var raw []struct {
 		BuyVol       string `json:"buyVol"`
@@ -2078,7 +2905,7 @@ func fetchTakerBuySellRatio(symbol, period string, limit int) ([]TakerBuySellEnt
 		BuySellRatio string `json:"buySellRatio"`
 		Timestamp    int64  `json:"timestamp"`
 	}
-	if err := performBinanceGET(url, &raw); err != nil {
+	if err := performBinanceGET(ctx, url, &raw); err != nil {
 		return nil, err
 	}
 	out := make([]TakerBuySellEntry, 0, len(raw))
@@ -2093,7 +2920,7 @@ func fetchTakerBuySellRatio(symbol, period string, limit int) ([]TakerBuySellEnt
 	return out, nil
 }
 
-func fetchBasisSeries(symbol, period string, limit int) ([]BasisEntry, error) {
+func fetchBasisSeries(ctx context.Context, symbol, period string, limit int) ([]BasisEntry, error) {
 	url := fmt.Sprintf("https://fapi.binance.com/futures/data/basis?symbol=%s&period=%s&limit=%d", symbol, period, limit)
 	var raw []struct {
 		Basis        string `json:"basis"`
@@ -2102,7 +2929,7 @@ func fetchBasisSeries(symbol, period string, limit int) ([]BasisEntry, error) {
 		IndexPrice   string `json:"indexPrice"`
 		Timestamp    int64  `json:"timestamp"`
 	}
-	if err := performBinanceGET(url, &raw); err != nil {
+	if err := performBinanceGET(ctx, url, &raw); err != nil {
 		return nil, err
 	}
 	out := make([]BasisEntry, 0, len(raw))
@@ -2118,13 +2945,13 @@ func fetchBasisSeries(symbol, period string, limit int) ([]BasisEntry, error) {
 	return out, nil
 }
 
-func fetchFundingRateHistory(symbol string, limit int) ([]FundingRateEntry, error) {
+func fetchFundingRateHistory(ctx context.Context, symbol string, limit int) ([]FundingRateEntry, error) {
 	url := fmt.Sprintf("https://fapi.binance.com/futures/data/fundingRate?symbol=%s&limit=%d", symbol, limit)
 	var raw []struct {
 		FundingRate string `json:"fundingRate"`
 		FundingTime int64  `json:"fundingTime"`
 	}
-	if err := performBinanceGET(url, &raw); err != nil {
+	if err := performBinanceGET(ctx, url, &raw); err != nil {
 		return nil, err
 	}
 	out := make([]FundingRateEntry, 0, len(raw))
@@ -2137,44 +2964,44 @@ func fetchFundingRateHistory(symbol string, limit int) ([]FundingRateEntry, erro
 	return out, nil
 }
 
-// getOrderbookSummary 从 Binance U 期货深度接口抓取轻量订单簿摘要（非致命）
-func getOrderbookSummary(symbol string) (*MicrostructureSummary, error) {
-	type binanceDepthResp struct {
-		LastUpdateId int64      `json:"lastUpdateId"`
-		Bids         [][]string `json:"bids"`
-		Asks         [][]string `json:"asks"`
-	}
+// orderBookDepth Binance U 期货深度接口响应
+type orderBookDepth struct {
+	LastUpdateId int64      `json:"lastUpdateId"`
+	Bids         [][]string `json:"bids"`
+	Asks         [][]string `json:"asks"`
+}
 
-	// 请求带超时，避免阻塞主循环（建议 2s）
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+// getOrderBookDepth 获取 Binance U 期货订单簿深度（请求带 2s 超时，避免阻塞主循环）
+func getOrderBookDepth(parent context.Context, symbol string, limit int) (*orderBookDepth, error) {
+	ctx, cancel := context.WithTimeout(parent, 2*time.Second)
 	defer cancel()
 
-	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/depth?symbol=%s&limit=100", symbol)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := http.DefaultClient.Do(req)
+	url := fmt.Sprintf("%s/fapi/v1/depth?symbol=%s&limit=%d", binanceFuturesBaseURL, symbol, limit)
+	body, err := httpGetOnce(ctx, url)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		b, _ := ioutil.ReadAll(resp.Body)
-		return nil, fmt.Errorf("binance depth status %d: %s", resp.StatusCode, string(b))
+	var d orderBookDepth
+	if err := json.Unmarshal(body, &d); err != nil {
+		return nil, fmt.Errorf("解析深度数据失败: %w", err)
 	}
+	return &d, nil
+}
 
-	var d binanceDepthResp
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&d); err != nil {
+// getOrderbookSummary 抓取订单簿并计算轻量摘要（非致命）；盘口为空时返回 nil
+func getOrderbookSummary(parent context.Context, symbol string) (*MicrostructureSummary, error) {
+	d, err := getOrderBookDepth(parent, symbol, 100)
+	if err != nil {
 		return nil, err
 	}
+	return summarizeOrderBook(d), nil
+}
 
-	// 若无 bids/asks，返回空 summary（非致命）
-	if len(d.Bids) == 0 || len(d.Asks) == 0 {
-		return &MicrostructureSummary{TsMs: time.Now().UnixMilli()}, nil
+// summarizeOrderBook 由深度数据计算最优买卖价、点差、名义价值和深度比（无 bids/asks 时返回 nil）
+func summarizeOrderBook(d *orderBookDepth) *MicrostructureSummary {
+	if d == nil || len(d.Bids) == 0 || len(d.Asks) == 0 || len(d.Bids[0]) < 2 || len(d.Asks[0]) < 2 {
+		return nil
 	}
 
 	bestBidPrice := safeParseFloat(d.Bids[0][0])
@@ -2228,11 +3055,15 @@ func getOrderbookSummary(symbol string) (*MicrostructureSummary, error) {
 		DepthNotional10: depthNotional10,
 		DepthRatio:      depthRatio,
 		SpreadBps:       spreadBps,
-	}, nil
+	}
 }
 
-func performBinanceGET(url string, target interface{}) error {
-	resp, err := http.Get(url)
+func performBinanceGET(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := getHTTPClient().Do(req)
 	if err != nil {
 		return err
 	}
@@ -2263,7 +3094,16 @@ func safeParseFloat(val string) float64 {
 // ===== 价格行为：核心复刻（精简版） =====
 // 与 TradingView Pine Script 保持一致
 
-func calcPriceActionSummary(klines []Kline, timeframe string, zigzagLen, liquidityLen, trendLineLen int) *PriceActionSummary {
+const (
+	defaultMaxSignalAgeCandles = 30 // BOS/CHoCH 信号超过该根数视为过期，不再作为最近信号
+	freshSignalMaxAgeCandles   = 5  // 信号距今不超过该根数时视为新鲜
+)
+
+// calcPriceActionSummary 计算价格行为摘要；maxSignalAgeCandles 为最近信号的最大距今根数（<=0 使用默认30），更早的信号被过滤
+func calcPriceActionSummary(klines []Kline, timeframe string, zigzagLen, liquidityLen, trendLineLen, maxSignalAgeCandles int) *PriceActionSummary {
+	if maxSignalAgeCandles <= 0 {
+		maxSignalAgeCandles = defaultMaxSignalAgeCandles
+	}
 	n := len(klines)
 
 	// 至少需要一定数量的K线才能做结构/斜率判断：
@@ -2385,8 +3225,12 @@ func calcPriceActionSummary(klines []Kline, timeframe string, zigzagLen, liquidi
 		}
 	}
 
+	bullDivTimes := detectRSIDivergence(klines, lowValIdx, false)
+	bearDivTimes := detectRSIDivergence(klines, highValIdx, true)
+
 	lastSignal := "none"
 	var lastSignalTime int64
+	lastSignalIdx := -1
 	// 趋势偏差：0=中性, 1=多头, -1=空头（与 TradingView 的 trend.bias 一致）
 	trendBias := 0 // 初始为中性
 	atr14 := calculateATR(klines, 14)
@@ -2441,6 +3285,7 @@ func calcPriceActionSummary(klines []Kline, timeframe string, zigzagLen, liquidi
 				lastSignal = "BOS_up" // 多头延续（结构突破）
 			}
 			lastSignalTime = klines[i].CloseTime
+			lastSignalIdx = i
 			trendBias = 1      // 更新趋势偏差为多头
 			highCrossed = true // 标记已突破，防止重复触发
 
@@ -2473,6 +3318,7 @@ func calcPriceActionSummary(klines []Kline, timeframe string, zigzagLen, liquidi
 				lastSignal = "BOS_down" // 空头延续（结构突破）
 			}
 			lastSignalTime = klines[i].CloseTime
+			lastSignalIdx = i
 			trendBias = -1    // 更新趋势偏差为空头
 			lowCrossed = true // 标记已突破，防止重复触发
 
@@ -2533,6 +3379,15 @@ func calcPriceActionSummary(klines []Kline, timeframe string, zigzagLen, liquidi
 		}
 	}
 
+	// 信号时效：过期信号不再作为最近信号（趋势偏差仍按完整历史推导）
+	signalAge := 0
+	if lastSignalIdx >= 0 {
+		signalAge = n - 1 - lastSignalIdx
+		if signalAge > maxSignalAgeCandles {
+			lastSignal, lastSignalTime, signalAge = "none", 0, 0
+		}
+	}
+
 	// 5) liquidity sweep：使用 liquidityLen 作为 pivot 参数（与 Pine Script 一致）
 	liquidityPivotHighIdx, liquidityPivotLowIdx := computePivots(klines, liquidityLen)
 	sweptHighs := detectSweptHighs(klines, liquidityPivotHighIdx, 2)
@@ -2548,7 +3403,66 @@ func calcPriceActionSummary(klines []Kline, timeframe string, zigzagLen, liquidi
 		SweptLows:      sweptLows,
 		BullSlope:      bullSlope,
 		BearSlope:      bearSlope,
+
+		LastSignalAgeCandles: signalAge,
+		SignalFresh:          lastSignal != "none" && signalAge <= freshSignalMaxAgeCandles,
+
+		BullishDivergence:      bullDivTimes != nil,
+		BearishDivergence:      bearDivTimes != nil,
+		BullishDivergenceTimes: bullDivTimes,
+		BearishDivergenceTimes: bearDivTimes,
+	}
+}
+
+// detectRSIDivergence 检测最近两个pivot与RSI14的常规背离，返回两个pivot的时间（未背离返回nil）
+// high=false：价格低点更低而 RSI 低点抬高（看涨）；high=true：价格高点更高而 RSI 高点降低（看跌）
+func detectRSIDivergence(klines []Kline, pivotIdx []int, high bool) []int64 {
+	const period = 14
+	if len(pivotIdx) < 2 {
+		return nil
+	}
+	i1, i2 := pivotIdx[len(pivotIdx)-2], pivotIdx[len(pivotIdx)-1]
+	rsi := calculateRSISeries(klines, period)
+	if i1 < period || i2-period >= len(rsi) {
+		return nil
+	}
+	rsi1, rsi2 := rsi[i1-period], rsi[i2-period]
+
+	var diverged bool
+	if high {
+		diverged = klines[i2].High > klines[i1].High && rsi2 < rsi1
+	} else {
+		diverged = klines[i2].Low < klines[i1].Low && rsi2 > rsi1
+	}
+	if !diverged {
+		return nil
+	}
+	return []int64{klines[i1].OpenTime, klines[i2].OpenTime}
+}
+
+// formatPriceActionSignal 输出最近结构信号及其距今根数，非新鲜信号标注 STALE 以降低权重
+func formatPriceActionSignal(pa *PriceActionSummary) string {
+	age := ""
+	if pa.LastSignal != "none" && pa.LastSignal != "" {
+		age = fmt.Sprintf(" last_signal_age_candles=%d", pa.LastSignalAgeCandles)
+		if !pa.SignalFresh {
+			age += " [STALE - weight lower]"
+		}
 	}
+	return fmt.Sprintf("signal=%s time=%d%s bull_slope=%.6f bear_slope=%.6f\n",
+		pa.LastSignal, pa.LastSignalTime, age, pa.BullSlope, pa.BearSlope)
+}
+
+// formatRSIDivergence 输出价格行为中的RSI背离（无背离时返回空串）
+func formatRSIDivergence(pa *PriceActionSummary) string {
+	var sb strings.Builder
+	if pa.BullishDivergence && len(pa.BullishDivergenceTimes) == 2 {
+		sb.WriteString(fmt.Sprintf("rsi_divergence=bullish (pivot lows @%d → @%d)\n", pa.BullishDivergenceTimes[0], pa.BullishDivergenceTimes[1]))
+	}
+	if pa.BearishDivergence && len(pa.BearishDivergenceTimes) == 2 {
+		sb.WriteString(fmt.Sprintf("rsi_divergence=bearish (pivot highs @%d → @%d)\n", pa.BearishDivergenceTimes[0], pa.BearishDivergenceTimes[1]))
+	}
+	return sb.String()
 }
 
 // ---- ICT helpers ----
@@ -2815,6 +3729,16 @@ func Format(data *Data) string {
 	sb.WriteString(fmt.Sprintf("current_price = %.2f, current_ema20 = %.3f, current_macd = %.3f, current_rsi (7 period) = %.3f\n\n",
 		data.CurrentPrice, data.CurrentEMA20, data.CurrentMACD, data.CurrentRSI7))
 
+	// 会话VWAP（UTC日初锚定），附带当前价相对VWAP的偏离
+	if vwaps := formatSessionVWAP(data); vwaps != "" {
+		sb.WriteString("session_vwap (UTC day anchor): " + vwaps + "\n\n")
+	}
+
+	// 日线枢轴点：按距离列出离当前价最近的三个
+	if pivots := formatNearestPivots(data.DailyPivots, data.CurrentPrice, 3); pivots != "" {
+		sb.WriteString("daily_pivots (nearest): " + pivots + "\n\n")
+	}
+
 	// ICT 摘要（精简：每周期仅保留1-2个最近OB/FVG）
 	if len(data.ICTPOI) > 0 || data.ICTLiquidity != nil || data.ICTPremiumDiscount != nil {
 		sb.WriteString("ICT summary:\n")
@@ -2855,6 +3779,9 @@ func Format(data *Data) string {
 	}
 
 	sb.WriteString(fmt.Sprintf("Funding Rate: %.2e\n\n", data.FundingRate))
+	if line := formatFundingSchedule(data.FundingHistory, data.NextFundingTime, time.Now()); line != "" {
+		sb.WriteString(line + "\n\n")
+	}
 
 	// 显示距离历史极值指标
 	sb.WriteString(fmt.Sprintf("Distance to ATH: %.2f%%\n\n", data.DistanceToATH))
@@ -2889,6 +3816,23 @@ func Format(data *Data) string {
 	// 	sb.WriteString("Intraday series (5-minute intervals, oldest → latest):\n\n")
 	// 	... 已精简，不再输出5m长序列
 	// }
+	if data.IntradaySeries != nil {
+		sb.WriteString("5m indicators (current values):\n")
+		if len(data.IntradaySeries.StochRSIK) > 0 {
+			sb.WriteString(formatStochRSI(data.IntradaySeries.StochRSIK, data.IntradaySeries.StochRSID, 3))
+		}
+		if len(data.IntradaySeries.OBVValues) > 0 {
+			sb.WriteString(fmt.Sprintf("OBV (last %d): %s, divergence: %s\n",
+				len(data.IntradaySeries.OBVValues), formatFloatSlice(data.IntradaySeries.OBVValues), data.IntradaySeries.OBVDivergence))
+		}
+		if len(data.IntradaySeries.VolumeDeltas) > 0 {
+			sb.WriteString(fmt.Sprintf("Volume delta (taker buy - sell, last %d): %s\n",
+				len(data.IntradaySeries.VolumeDeltas), formatFloatSlice(data.IntradaySeries.VolumeDeltas)))
+		}
+		sb.WriteString(formatParabolicSAR(data.IntradaySeries.ParabolicSARValues, data.IntradaySeries.ParabolicSARDirection))
+		sb.WriteString(formatIntradayVWAP(data.IntradaySeries, data.CurrentPrice))
+		sb.WriteString("\n")
+	}
 
 	// 15m（精简：仅保留当前值+简要摘要，去掉长序列）
 	if data.MidTermSeries15m != nil {
@@ -2936,11 +3880,15 @@ func Format(data *Data) string {
 			recent := data.MidTermSeries15m.RSI7Values[len(data.MidTermSeries15m.RSI7Values)-lastN:]
 			sb.WriteString(fmt.Sprintf("RSI7 (last %d): %s\n", lastN, formatFloatSlice(recent)))
 		}
+		if len(data.MidTermSeries15m.StochRSIK) > 0 {
+			sb.WriteString(formatStochRSI(data.MidTermSeries15m.StochRSIK, data.MidTermSeries15m.StochRSID, 5))
+		}
 		if data.MidTermSeries15m.Bollinger != nil {
 			bb := data.MidTermSeries15m.Bollinger
 			sb.WriteString(fmt.Sprintf("15m Bollinger(20,2): upper=%.3f, middle=%.3f, lower=%.3f, width=%.4f, percent=%.3f\n",
 				bb.Upper, bb.Middle, bb.Lower, bb.Width, bb.Percent))
 		}
+		sb.WriteString(formatParabolicSAR(data.MidTermSeries15m.ParabolicSARValues, data.MidTermSeries15m.ParabolicSARDirection))
 		sb.WriteString("\n")
 	}
 
@@ -2989,6 +3937,12 @@ func Format(data *Data) string {
 			recent := data.MidTermSeries1h.RSI7Values[len(data.MidTermSeries1h.RSI7Values)-lastN:]
 			sb.WriteString(fmt.Sprintf("RSI7 (last %d): %s\n", lastN, formatFloatSlice(recent)))
 		}
+		if len(data.MidTermSeries1h.StochRSIK) > 0 {
+			sb.WriteString(formatStochRSI(data.MidTermSeries1h.StochRSIK, data.MidTermSeries1h.StochRSID, 3))
+		}
+		sb.WriteString(formatWilliamsRCCI(data.MidTermSeries1h.WilliamsR14, data.MidTermSeries1h.CCI14))
+		sb.WriteString(formatADX(data.MidTermSeries1h.ADX, data.MidTermSeries1h.DIPlus, data.MidTermSeries1h.DIMinus))
+		sb.WriteString(formatIchimoku(data.MidTermSeries1h.Ichimoku))
 		sb.WriteString("\n")
 	}
 
@@ -3030,14 +3984,26 @@ func Format(data *Data) string {
 			recent := data.MidTermSeries4h.RSI7Values[len(data.MidTermSeries4h.RSI7Values)-lastN:]
 			sb.WriteString(fmt.Sprintf("RSI7 (last %d): %s\n", lastN, formatFloatSlice(recent)))
 		}
+		if len(data.MidTermSeries4h.StochRSIK) > 0 {
+			sb.WriteString(formatStochRSI(data.MidTermSeries4h.StochRSIK, data.MidTermSeries4h.StochRSID, 3))
+		}
+		sb.WriteString(formatWilliamsRCCI(data.MidTermSeries4h.WilliamsR14, data.MidTermSeries4h.CCI14))
+		sb.WriteString(formatADX(data.MidTermSeries4h.ADX, data.MidTermSeries4h.DIPlus, data.MidTermSeries4h.DIMinus))
+		if data.MidTermSeries4h.TrendStrength != "" {
+			sb.WriteString(fmt.Sprintf("4h trend strength (ADX): %s\n", data.MidTermSeries4h.TrendStrength))
+		}
 		if data.MidTermSeries4h.Bollinger != nil {
 			bb := data.MidTermSeries4h.Bollinger
 			sb.WriteString(fmt.Sprintf("4h Bollinger(20,2): upper=%.3f, middle=%.3f, lower=%.3f, width=%.4f, percent=%.3f\n",
 				bb.Upper, bb.Middle, bb.Lower, bb.Width, bb.Percent))
 		}
+		sb.WriteString(formatIchimoku(data.MidTermSeries4h.Ichimoku))
 		sb.WriteString("\n")
 	}
 
+	// 自定义周期（如1m/1d）
+	appendExtraSeries(&sb, data)
+
 	// 打印 4h 区间
 	// 已注释：不再提交4h支撑/压力位给AI
 	/*
@@ -3131,12 +4097,29 @@ func Format(data *Data) string {
 		sb.WriteString("\n")
 	}
 
+	if len(data.FibConfluence) > 0 {
+		sb.WriteString("Fib confluence 4h×1h (nearest 3):\n")
+		for _, z := range nearestFibConfluence(data.FibConfluence, data.CurrentPrice, 3) {
+			distPct := 0.0
+			if data.CurrentPrice > 0 {
+				distPct = (z.Price - data.CurrentPrice) / data.CurrentPrice * 100
+			}
+			sb.WriteString(fmt.Sprintf("price=%.2f ratio_4h=%.3f ratio_1h=%.3f strength=%d dist=%+.2f%%\n",
+				z.Price, z.Ratio4h, z.Ratio1h, z.ConfluenceStrength, distPct))
+		}
+		sb.WriteString("\n")
+	}
+
+	// 成交量分布
+	sb.WriteString(formatVolumeProfile("4h", data.VolumeProfile4h))
+	sb.WriteString(formatVolumeProfile("15m", data.VolumeProfile15m))
+
 	// Price Action summary
 	if data.PriceAction4h != nil {
 		pa := data.PriceAction4h
 		sb.WriteString("4h Price Action:\n")
-		sb.WriteString(fmt.Sprintf("signal=%s time=%d bull_slope=%.6f bear_slope=%.6f\n",
-			pa.LastSignal, pa.LastSignalTime, pa.BullSlope, pa.BearSlope))
+		sb.WriteString(formatPriceActionSignal(pa))
+		sb.WriteString(formatRSIDivergence(pa))
 		// 精简：仅保留最近1-2个OB
 		if len(pa.BearishOB) > 0 {
 			maxShow := 2
@@ -3173,8 +4156,8 @@ func Format(data *Data) string {
 	if data.PriceAction1h != nil {
 		pa := data.PriceAction1h
 		sb.WriteString("1h Price Action:\n")
-		sb.WriteString(fmt.Sprintf("signal=%s time=%d bull_slope=%.6f bear_slope=%.6f\n",
-			pa.LastSignal, pa.LastSignalTime, pa.BullSlope, pa.BearSlope))
+		sb.WriteString(formatPriceActionSignal(pa))
+		sb.WriteString(formatRSIDivergence(pa))
 		// 精简：仅保留最近1-2个OB
 		if len(pa.BearishOB) > 0 {
 			maxShow := 2
@@ -3211,8 +4194,8 @@ func Format(data *Data) string {
 	if data.PriceAction15m != nil {
 		pa := data.PriceAction15m
 		sb.WriteString("15m Price Action:\n")
-		sb.WriteString(fmt.Sprintf("signal=%s time=%d bull_slope=%.6f bear_slope=%.6f\n",
-			pa.LastSignal, pa.LastSignalTime, pa.BullSlope, pa.BearSlope))
+		sb.WriteString(formatPriceActionSignal(pa))
+		sb.WriteString(formatRSIDivergence(pa))
 		// 精简：仅保留最近1-2个OB
 		if len(pa.BearishOB) > 0 {
 			maxShow := 2
@@ -3260,6 +4243,19 @@ func Format(data *Data) string {
 		}
 		sb.WriteString("\n")
 	}
+	// Heikin-Ashi 趋势摘要（连续同向K线数及无反向影线的根数）
+	var haParts []string
+	for _, ha := range []struct {
+		tf     string
+		shapes []CandleShape
+	}{{"15m", data.HeikinAshi15m}, {"1h", data.HeikinAshi1h}, {"4h", data.HeikinAshi4h}} {
+		if summary := summarizeHeikinAshi(ha.shapes); summary != "" {
+			haParts = append(haParts, ha.tf+" "+summary)
+		}
+	}
+	if len(haParts) > 0 {
+		sb.WriteString(fmt.Sprintf("heikin_ashi: %s\n\n", strings.Join(haParts, " | ")))
+	}
 	// 精简：去掉1h/4h K线形态
 	// if len(data.CandleShapes1h) > 0 { ... }
 	// if len(data.CandleShapes4h) > 0 { ... }
@@ -3417,6 +4413,33 @@ func appendDerivativesBasisSection(sb *strings.Builder, series map[string][]Basi
 	}
 }
 
+// formatFundingSchedule 资金费率历史与距下次结算的时间，如 "Funding history (last 8): ..., next funding in 37m"
+func formatFundingSchedule(history []float64, nextFundingTime int64, now time.Time) string {
+	var parts []string
+	if len(history) > 0 {
+		rates := make([]string, len(history))
+		for i, r := range history {
+			rates[i] = fmt.Sprintf("%.2e", r)
+		}
+		parts = append(parts, fmt.Sprintf("Funding history (last %d): %s", len(history), strings.Join(rates, ", ")))
+	}
+	if nextFundingTime > 0 {
+		if until := time.UnixMilli(nextFundingTime).Sub(now); until > 0 {
+			parts = append(parts, "next funding in "+formatFundingCountdown(until))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatFundingCountdown 将剩余时间格式化为 "1h05m" / "37m"
+func formatFundingCountdown(d time.Duration) string {
+	minutes := int(d.Round(time.Minute) / time.Minute)
+	if minutes >= 60 {
+		return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
 func appendFundingHistorySection(sb *strings.Builder, entries []FundingRateEntry) {
 	if len(entries) == 0 {
 		return
@@ -3434,6 +4457,253 @@ func appendFundingHistorySection(sb *strings.Builder, entries []FundingRateEntry
 }
 
 // formatFloatSlice 格式化float64切片为字符串
+// formatADX 输出 ADX 与 DI，并标注趋势强度（>=25 趋势市，<20 震荡市）
+func formatADX(adx, diPlus, diMinus float64) string {
+	regime := ""
+	switch {
+	case adx >= 25 && diPlus > diMinus:
+		regime = " [strong_uptrend]"
+	case adx >= 25:
+		regime = " [strong_downtrend]"
+	case adx < 20:
+		regime = " [ranging]"
+	}
+	return fmt.Sprintf("ADX(14): %.2f, +DI: %.2f, -DI: %.2f%s\n", adx, diPlus, diMinus, regime)
+}
+
+// calculateIchimoku 计算一目均衡表，至少需要 52+26 根K线（云带需前移26周期）
+func calculateIchimoku(klines []Kline) *IchimokuData {
+	n := len(klines)
+	if n < ichimokuSpanBPeriod+ichimokuDisplacement {
+		return nil
+	}
+
+	// 当前K线对应的云带由26周期前的数据计算
+	past := klines[:n-ichimokuDisplacement]
+	pastTenkan := highLowMidpoint(past, ichimokuTenkanPeriod)
+	pastKijun := highLowMidpoint(past, ichimokuKijunPeriod)
+
+	return &IchimokuData{
+		TenkanSen:   highLowMidpoint(klines, ichimokuTenkanPeriod),
+		KijunSen:    highLowMidpoint(klines, ichimokuKijunPeriod),
+		SenkouSpanA: (pastTenkan + pastKijun) / 2,
+		SenkouSpanB: highLowMidpoint(past, ichimokuSpanBPeriod),
+		ChikouSpan:  klines[n-1].Close,
+	}
+}
+
+// highLowMidpoint 最近 period 根K线最高价与最低价的中点
+func highLowMidpoint(klines []Kline, period int) float64 {
+	window := klines[len(klines)-period:]
+	high, low := window[0].High, window[0].Low
+	for _, k := range window[1:] {
+		high = math.Max(high, k.High)
+		low = math.Min(low, k.Low)
+	}
+	return (high + low) / 2
+}
+
+// formatIchimoku 单行输出：价格相对云带位置、TK关系、云带颜色
+func formatIchimoku(ich *IchimokuData) string {
+	if ich == nil {
+		return ""
+	}
+
+	price := ich.ChikouSpan
+	cloudTop := math.Max(ich.SenkouSpanA, ich.SenkouSpanB)
+	cloudBottom := math.Min(ich.SenkouSpanA, ich.SenkouSpanB)
+	position := "inside"
+	switch {
+	case price > cloudTop:
+		position = "above"
+	case price < cloudBottom:
+		position = "below"
+	}
+
+	tk := "tenkan=kijun"
+	switch {
+	case ich.TenkanSen > ich.KijunSen:
+		tk = "tenkan>kijun (bullish)"
+	case ich.TenkanSen < ich.KijunSen:
+		tk = "tenkan<kijun (bearish)"
+	}
+
+	color := "neutral"
+	switch {
+	case ich.SenkouSpanA > ich.SenkouSpanB:
+		color = "bullish"
+	case ich.SenkouSpanA < ich.SenkouSpanB:
+		color = "bearish"
+	}
+
+	return fmt.Sprintf("Ichimoku(9,26,52): price %s cloud [%.3f-%.3f], %s, cloud %s (tenkan=%.3f, kijun=%.3f)\n",
+		position, cloudBottom, cloudTop, tk, color, ich.TenkanSen, ich.KijunSen)
+}
+
+// calculateVolumeProfile 按价格将 [最低价, 最高价] 分为 buckets 个桶，每根K线的成交量按其价格区间与桶的重叠比例分摊
+// 价值区从 POC 向成交量较大的一侧逐桶扩展，直至覆盖70%成交量；K线不足或无成交量时返回nil
+func calculateVolumeProfile(klines []Kline, buckets int) *VolumeProfile {
+	if len(klines) == 0 {
+		return nil
+	}
+	if buckets <= 0 {
+		buckets = volumeProfileBuckets
+	}
+
+	low, high := klines[0].Low, klines[0].High
+	for _, k := range klines[1:] {
+		low = math.Min(low, k.Low)
+		high = math.Max(high, k.High)
+	}
+	if high <= low {
+		return nil
+	}
+	width := (high - low) / float64(buckets)
+	bucketIndex := func(price float64) int {
+		idx := int((price - low) / width)
+		if idx >= buckets {
+			idx = buckets - 1
+		}
+		return idx
+	}
+
+	volumes := make([]float64, buckets)
+	total := 0.0
+	for _, k := range klines {
+		if k.Volume <= 0 {
+			continue
+		}
+		total += k.Volume
+		if k.High <= k.Low {
+			volumes[bucketIndex(k.Close)] += k.Volume
+			continue
+		}
+		for i := bucketIndex(k.Low); i <= bucketIndex(k.High); i++ {
+			bucketLow := low + float64(i)*width
+			overlap := math.Min(k.High, bucketLow+width) - math.Max(k.Low, bucketLow)
+			if overlap > 0 {
+				volumes[i] += k.Volume * overlap / (k.High - k.Low)
+			}
+		}
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	poc := 0
+	for i, v := range volumes {
+		if v > volumes[poc] {
+			poc = i
+		}
+	}
+
+	// 价值区：从 POC 向两侧扩展
+	lo, hi := poc, poc
+	covered := volumes[poc]
+	for covered < total*volumeProfileValueArea && (lo > 0 || hi < buckets-1) {
+		below, above := -1.0, -1.0
+		if lo > 0 {
+			below = volumes[lo-1]
+		}
+		if hi < buckets-1 {
+			above = volumes[hi+1]
+		}
+		if above >= below {
+			hi++
+			covered += above
+		} else {
+			lo--
+			covered += below
+		}
+	}
+
+	center := func(i int) float64 { return low + (float64(i)+0.5)*width }
+	profile := &VolumeProfile{
+		POC: center(poc),
+		VAH: low + float64(hi+1)*width,
+		VAL: low + float64(lo)*width,
+	}
+	for i := 1; i < buckets-1; i++ {
+		if volumes[i] < volumes[poc]*volumeProfileLowVolumeNode &&
+			volumes[i] <= volumes[i-1] && volumes[i] <= volumes[i+1] {
+			profile.LowVolumeNodes = append(profile.LowVolumeNodes, center(i))
+		}
+	}
+	return profile
+}
+
+// formatVolumeProfile 单行输出 POC / 价值区 / 低成交量节点
+func formatVolumeProfile(timeframe string, vp *VolumeProfile) string {
+	if vp == nil {
+		return ""
+	}
+	line := fmt.Sprintf("%s Volume Profile: POC=%.4f, value area=[%.4f, %.4f]", timeframe, vp.POC, vp.VAL, vp.VAH)
+	if len(vp.LowVolumeNodes) > 0 {
+		nodes := make([]string, len(vp.LowVolumeNodes))
+		for i, p := range vp.LowVolumeNodes {
+			nodes[i] = fmt.Sprintf("%.4f", p)
+		}
+		line += ", low-volume nodes: " + strings.Join(nodes, ", ")
+	}
+	return line + "\n\n"
+}
+
+// classifyTrendStrength 按 ADX 划分趋势强度：>=40 strong，>=25 moderate，>=20 weak，其余 ranging
+func classifyTrendStrength(adx float64) string {
+	switch {
+	case adx >= 40:
+		return "strong"
+	case adx >= 25:
+		return "moderate"
+	case adx >= 20:
+		return "weak"
+	default:
+		return "ranging"
+	}
+}
+
+// formatWilliamsRCCI 输出 Williams %R 与 CCI 当前值，并标注超买/超卖区
+func formatWilliamsRCCI(williamsR, cci float64) string {
+	zone := ""
+	switch {
+	case williamsR > -20 && cci > 100:
+		zone = " [overbought]"
+	case williamsR < -80 && cci < -100:
+		zone = " [oversold]"
+	}
+	return fmt.Sprintf("Williams %%R(14): %.2f, CCI(14): %.2f%s\n", williamsR, cci, zone)
+}
+
+// formatStochRSI 输出最近 lastN 个 StochRSI %K/%D 值，并标注最新一根的交叉
+func formatStochRSI(kValues, dValues []float64, lastN int) string {
+	n := len(kValues)
+	if len(dValues) < n {
+		n = len(dValues)
+	}
+	if n == 0 {
+		return ""
+	}
+	if n < lastN {
+		lastN = n
+	}
+	kValues = kValues[len(kValues)-n:]
+	dValues = dValues[len(dValues)-n:]
+
+	crossStr := ""
+	if n >= 2 {
+		prevDiff := kValues[n-2] - dValues[n-2]
+		currDiff := kValues[n-1] - dValues[n-1]
+		if prevDiff <= 0 && currDiff > 0 {
+			crossStr = " [bullish_cross]"
+		} else if prevDiff >= 0 && currDiff < 0 {
+			crossStr = " [bearish_cross]"
+		}
+	}
+
+	return fmt.Sprintf("StochRSI(14,14,3,3) K (last %d): %s, D: %s%s\n",
+		lastN, formatFloatSlice(kValues[n-lastN:]), formatFloatSlice(dValues[n-lastN:]), crossStr)
+}
+
 func formatFloatSlice(values []float64) string {
 	strValues := make([]string, len(values))
 	for i, v := range values {
@@ -3444,7 +4714,7 @@ func formatFloatSlice(values []float64) string {
 
 // Normalize 标准化symbol,确保是USDT交易对
 func Normalize(symbol string) string {
-	symbol = strings.ToUpper(symbol)
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
 	if strings.HasSuffix(symbol, "USDT") {
 		return symbol
 	}
@@ -3635,7 +4905,7 @@ func detect4hZonesInternal(klines []Kline, ctx *MidTermSeries4h) []SRZone {
 		}
 	}
 
-	return zones
+	return consolidateZones(zones, zoneConfig.MergeTolerancePct)
 }
 
 // detect15mZonesInternal 内部使用的15m支撑/压力检测
@@ -3738,7 +5008,7 @@ func detect15mZonesInternal(klines []Kline, ctx *MidTermData15m) []SRZone {
 		}
 	}
 
-	return zones
+	return consolidateZones(zones, zoneConfig.MergeTolerancePct)
 }
 
 // calculateDistanceMetrics 计算距离度量指标
@@ -4120,6 +5390,145 @@ func calculateOBV(klines []Kline) []float64 {
 	return obv
 }
 
+const (
+	obvDivergenceLookback = 5     // OBV背离比较的K线数量
+	obvFlatPriceRatio     = 0.001 // 窗口内价格回归变化小于0.1%视为横盘
+)
+
+// detectOBVDivergence 比较最近 lookback 根OBV与收盘价的线性回归斜率：
+// 价格走平/下跌而OBV上升为 bullish（吸筹），价格走平/上涨而OBV下降为 bearish（派发）
+func detectOBVDivergence(klines []Kline, obv []float64, lookback int) string {
+	if lookback < 2 || len(klines) < lookback || len(obv) < lookback {
+		return "none"
+	}
+
+	closes := make([]float64, lookback)
+	for i, k := range klines[len(klines)-lookback:] {
+		closes[i] = k.Close
+	}
+	priceSlope := linearSlope(closes)
+	obvSlope := linearSlope(obv[len(obv)-lookback:])
+
+	lastClose := closes[lookback-1]
+	priceFlat := lastClose > 0 && math.Abs(priceSlope*float64(lookback-1))/lastClose < obvFlatPriceRatio
+
+	switch {
+	case obvSlope > 0 && (priceSlope < 0 || priceFlat):
+		return "bullish"
+	case obvSlope < 0 && (priceSlope > 0 || priceFlat):
+		return "bearish"
+	default:
+		return "none"
+	}
+}
+
+// linearSlope 最小二乘斜率（x 为 0..n-1）
+func linearSlope(values []float64) float64 {
+	n := float64(len(values))
+	if n < 2 {
+		return 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, v := range values {
+		x := float64(i)
+		sumX += x
+		sumY += v
+		sumXY += x * v
+		sumXX += x * x
+	}
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denom
+}
+
+// calculateVolumeDeltas 每根K线的主动买入量减主动卖出量
+func calculateVolumeDeltas(klines []Kline) []float64 {
+	deltas := make([]float64, len(klines))
+	for i, k := range klines {
+		deltas[i] = 2*k.TakerBuyBaseVolume - k.Volume
+	}
+	return deltas
+}
+
+// calculateParabolicSAR 计算抛物线SAR序列（Wilder），与 klines 一一对应，数据不足2根时返回 nil
+// 加速因子从 initialAF 起，每创新极值增加 initialAF，上限 maxAF；价格穿越SAR时反转
+func calculateParabolicSAR(klines []Kline, initialAF, maxAF float64) []float64 {
+	if len(klines) < 2 || initialAF <= 0 || maxAF < initialAF {
+		return nil
+	}
+
+	sar := make([]float64, len(klines))
+	uptrend := klines[1].Close >= klines[0].Close
+	af := initialAF
+	ep := klines[0].Low
+	sar[0] = klines[0].High
+	if uptrend {
+		ep = klines[0].High
+		sar[0] = klines[0].Low
+	}
+
+	for i := 1; i < len(klines); i++ {
+		next := sar[i-1] + af*(ep-sar[i-1])
+		if uptrend {
+			// SAR 不得高于前两根K线的最低点
+			next = math.Min(next, klines[i-1].Low)
+			if i >= 2 {
+				next = math.Min(next, klines[i-2].Low)
+			}
+			if klines[i].Low < next {
+				uptrend, next, ep, af = false, ep, klines[i].Low, initialAF
+			} else if klines[i].High > ep {
+				ep = klines[i].High
+				af = math.Min(af+initialAF, maxAF)
+			}
+		} else {
+			// SAR 不得低于前两根K线的最高点
+			next = math.Max(next, klines[i-1].High)
+			if i >= 2 {
+				next = math.Max(next, klines[i-2].High)
+			}
+			if klines[i].High > next {
+				uptrend, next, ep, af = true, ep, klines[i].High, initialAF
+			} else if klines[i].Low < ep {
+				ep = klines[i].Low
+				af = math.Min(af+initialAF, maxAF)
+			}
+		}
+		sar[i] = next
+	}
+	return sar
+}
+
+// parabolicSARSummary 取默认参数下最近10个SAR值，以及最新SAR相对收盘价的位置
+func parabolicSARSummary(klines []Kline) ([]float64, string) {
+	sar := calculateParabolicSAR(klines, parabolicSARInitialAF, parabolicSARMaxAF)
+	if len(sar) == 0 {
+		return nil, ""
+	}
+	direction := "below"
+	if sar[len(sar)-1] > klines[len(klines)-1].Close {
+		direction = "above"
+	}
+	if len(sar) > 10 {
+		sar = sar[len(sar)-10:]
+	}
+	return sar, direction
+}
+
+// formatParabolicSAR 输出最新SAR值及其相对价格的位置（无数据时返回空串）
+func formatParabolicSAR(values []float64, direction string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	trend := "bullish"
+	if direction == "above" {
+		trend = "bearish"
+	}
+	return fmt.Sprintf("Parabolic SAR(0.02,0.20): %.4f, SAR %s price [%s]\n", values[len(values)-1], direction, trend)
+}
+
 // calculateVWAP 计算VWAP
 func calculateVWAP(klines []Kline) float64 {
 	if len(klines) == 0 {
@@ -4139,60 +5548,245 @@ func calculateVWAP(klines []Kline) float64 {
 	return sumPV / sumV
 }
 
-// calculateADX 计算ADX及DI+/DI-
+// formatSessionVWAP 格式化各周期会话VWAP，全部缺失时返回空串
+func formatSessionVWAP(data *Data) string {
+	var parts []string
+	for _, item := range []struct {
+		tf   string
+		vwap float64
+	}{{"5m", data.VWAP5m}, {"15m", data.VWAP15m}, {"1h", data.VWAP1h}} {
+		if item.vwap <= 0 {
+			continue
+		}
+		part := fmt.Sprintf("%s = %.4f", item.tf, item.vwap)
+		if data.CurrentPrice > 0 {
+			part += fmt.Sprintf(" (price %+.2f%%)", (data.CurrentPrice-item.vwap)/item.vwap*100)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// calculateDailyPivots 按上一交易日K线计算经典枢轴点
+func calculateDailyPivots(dailyKline Kline) *PivotPoints {
+	high, low, closePrice := dailyKline.High, dailyKline.Low, dailyKline.Close
+	if high <= 0 || low <= 0 || high < low {
+		return nil
+	}
+	pp := (high + low + closePrice) / 3
+	return &PivotPoints{
+		PP: pp,
+		R1: 2*pp - low,
+		R2: pp + (high - low),
+		R3: high + 2*(pp-low),
+		S1: 2*pp - high,
+		S2: pp - (high - low),
+		S3: low - 2*(high-pp),
+	}
+}
+
+// priorSessionKline 返回在 beforeMs 之前已收盘的最后一根K线（实时数据中最后一根为当日未收盘K线）
+func priorSessionKline(klines []Kline, beforeMs int64) (Kline, bool) {
+	for i := len(klines) - 1; i >= 0; i-- {
+		if klines[i].CloseTime < beforeMs {
+			return klines[i], true
+		}
+	}
+	return Kline{}, false
+}
+
+// formatNearestPivots 按与当前价的距离列出最近的 n 个枢轴点，缺少数据时返回空串
+func formatNearestPivots(pivots *PivotPoints, price float64, n int) string {
+	if pivots == nil || price <= 0 {
+		return ""
+	}
+	levels := []struct {
+		name  string
+		price float64
+	}{
+		{"S3", pivots.S3}, {"S2", pivots.S2}, {"S1", pivots.S1}, {"PP", pivots.PP},
+		{"R1", pivots.R1}, {"R2", pivots.R2}, {"R3", pivots.R3},
+	}
+	sort.SliceStable(levels, func(i, j int) bool {
+		return math.Abs(levels[i].price-price) < math.Abs(levels[j].price-price)
+	})
+	if len(levels) > n {
+		levels = levels[:n]
+	}
+
+	parts := make([]string, 0, len(levels))
+	for _, lvl := range levels {
+		position := "above"
+		if lvl.price < price {
+			position = "below"
+		}
+		parts = append(parts, fmt.Sprintf("%s=%.4f (%s, %+.2f%%)", lvl.name, lvl.price, position, (lvl.price-price)/price*100))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// calculateAnchoredVWAP 计算从 anchorIndex 对应K线开始的锚定VWAP，索引越界返回0
+func calculateAnchoredVWAP(klines []Kline, anchorIndex int) float64 {
+	if anchorIndex < 0 || anchorIndex >= len(klines) {
+		return 0
+	}
+	return calculateVWAP(klines[anchorIndex:])
+}
+
+// sessionAnchorIndex 返回最后一根K线所在UTC日的第一根K线索引
+// K线未覆盖到日初时返回0（使用全部可用K线）
+func sessionAnchorIndex(klines []Kline) int {
+	if len(klines) == 0 {
+		return 0
+	}
+	last := time.UnixMilli(klines[len(klines)-1].OpenTime).UTC()
+	sessionStart := time.Date(last.Year(), last.Month(), last.Day(), 0, 0, 0, 0, time.UTC).UnixMilli()
+	for i, k := range klines {
+		if k.OpenTime >= sessionStart {
+			return i
+		}
+	}
+	return 0
+}
+
+// calculateSessionVWAP 计算UTC日初锚定的会话VWAP
+func calculateSessionVWAP(klines []Kline) float64 {
+	return calculateAnchoredVWAP(klines, sessionAnchorIndex(klines))
+}
+
+// rollingSessionVWAP 最近 n 根K线各自收盘时的会话VWAP；成交量为0时沿用上一个值（首个值退化为收盘价）
+func rollingSessionVWAP(klines []Kline, n int) []float64 {
+	start := len(klines) - n
+	if start < 0 {
+		start = 0
+	}
+
+	values := make([]float64, 0, len(klines)-start)
+	for i := start; i < len(klines); i++ {
+		vwap := calculateSessionVWAP(klines[:i+1])
+		if vwap == 0 {
+			vwap = klines[i].Close
+			if len(values) > 0 {
+				vwap = values[len(values)-1]
+			}
+		}
+		values = append(values, vwap)
+	}
+	return values
+}
+
+// anchoredVWAPPivotSpan 4h 摆动点左右各需的K线数
+const anchoredVWAPPivotSpan = 3
+
+// swingAnchoredVWAP 以最近一个4h摆动高/低点为锚计算VWAP：5m K线覆盖锚点时用5m，否则用4h K线
+// 无摆动点或成交量为0时返回 0
+func swingAnchoredVWAP(klines5m, klines4h []Kline) (vwap float64, from string, anchorTime int64) {
+	highIdx, lowIdx := computePivots(klines4h, anchoredVWAPPivotSpan)
+	anchor := -1
+	if len(highIdx) > 0 {
+		anchor, from = highIdx[len(highIdx)-1], "swing_high"
+	}
+	if len(lowIdx) > 0 && lowIdx[len(lowIdx)-1] > anchor {
+		anchor, from = lowIdx[len(lowIdx)-1], "swing_low"
+	}
+	if anchor < 0 {
+		return 0, "", 0
+	}
+	anchorTime = klines4h[anchor].OpenTime
+
+	if len(klines5m) > 0 && klines5m[0].OpenTime <= anchorTime {
+		for i, k := range klines5m {
+			if k.OpenTime >= anchorTime {
+				return calculateAnchoredVWAP(klines5m, i), from, anchorTime
+			}
+		}
+	}
+	return calculateAnchoredVWAP(klines4h, anchor), from, anchorTime
+}
+
+// formatIntradayVWAP 输出5m会话VWAP序列与4h摆动点锚定VWAP（附当前价偏离）
+func formatIntradayVWAP(intraday *IntradayData, currentPrice float64) string {
+	var sb strings.Builder
+	if len(intraday.VWAPValues) > 0 {
+		sb.WriteString(fmt.Sprintf("Session VWAP (last %d): %s\n", len(intraday.VWAPValues), formatFloatSlice(intraday.VWAPValues)))
+	}
+	if intraday.AnchoredVWAP > 0 {
+		line := fmt.Sprintf("Anchored VWAP (from 4h %s @%d): %.4f", intraday.AnchoredVWAPFrom, intraday.AnchoredVWAPTime, intraday.AnchoredVWAP)
+		if currentPrice > 0 {
+			line += fmt.Sprintf(" (price %+.2f%%)", (currentPrice-intraday.AnchoredVWAP)/intraday.AnchoredVWAP*100)
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+// calculateADX 计算ADX及DI+/DI-（Wilder平滑）
+// TR/+DM/-DM 先取前 period 根之和，之后按 prev - prev/period + cur 递推；
+// ADX 为前 period 个 DX 的均值，之后按 (prev*(period-1) + DX)/period 递推。
+// 数据不足 2*period 根时 ADX 退化为最新的 DX。
 func calculateADX(klines []Kline, period int) (adx, diPlus, diMinus float64) {
-	if len(klines) < period+1 {
+	if period <= 0 || len(klines) < period+1 {
 		return 0, 0, 0
 	}
 
-	// 计算+DM和-DM
-	var plusDMs, minusDMs, trs []float64
+	// 计算+DM、-DM和TR
+	n := len(klines) - 1
+	plusDMs := make([]float64, n)
+	minusDMs := make([]float64, n)
+	trs := make([]float64, n)
 	for i := 1; i < len(klines); i++ {
 		highDiff := klines[i].High - klines[i-1].High
 		lowDiff := klines[i-1].Low - klines[i].Low
 
-		plusDM := 0.0
 		if highDiff > lowDiff && highDiff > 0 {
-			plusDM = highDiff
+			plusDMs[i-1] = highDiff
 		}
-		minusDM := 0.0
 		if lowDiff > highDiff && lowDiff > 0 {
-			minusDM = lowDiff
+			minusDMs[i-1] = lowDiff
 		}
-
-		tr := math.Max(klines[i].High-klines[i].Low,
+		trs[i-1] = math.Max(klines[i].High-klines[i].Low,
 			math.Max(math.Abs(klines[i].High-klines[i-1].Close),
 				math.Abs(klines[i].Low-klines[i-1].Close)))
-
-		plusDMs = append(plusDMs, plusDM)
-		minusDMs = append(minusDMs, minusDM)
-		trs = append(trs, tr)
 	}
 
-	if len(plusDMs) < period {
-		return 0, 0, 0
-	}
-
-	// 计算平滑的+DM, -DM, TR
-	sumPlusDM := 0.0
-	sumMinusDM := 0.0
-	sumTR := 0.0
+	// 初始平滑值：前 period 根之和
+	var smoothPlusDM, smoothMinusDM, smoothTR float64
 	for i := 0; i < period; i++ {
-		sumPlusDM += plusDMs[i]
-		sumMinusDM += minusDMs[i]
-		sumTR += trs[i]
+		smoothPlusDM += plusDMs[i]
+		smoothMinusDM += minusDMs[i]
+		smoothTR += trs[i]
 	}
 
-	// 计算DI+和DI-
-	if sumTR > 0 {
-		diPlus = (sumPlusDM / sumTR) * 100
-		diMinus = (sumMinusDM / sumTR) * 100
-	}
+	p := float64(period)
+	var dxSum float64
+	dxCount := 0
+	for i := period - 1; i < n; i++ {
+		if i >= period {
+			smoothPlusDM = smoothPlusDM - smoothPlusDM/p + plusDMs[i]
+			smoothMinusDM = smoothMinusDM - smoothMinusDM/p + minusDMs[i]
+			smoothTR = smoothTR - smoothTR/p + trs[i]
+		}
+
+		diPlus, diMinus = 0, 0
+		if smoothTR > 0 {
+			diPlus = smoothPlusDM / smoothTR * 100
+			diMinus = smoothMinusDM / smoothTR * 100
+		}
+		dx := 0.0
+		if diPlus+diMinus > 0 {
+			dx = math.Abs(diPlus-diMinus) / (diPlus + diMinus) * 100
+		}
 
-	// 计算DX和ADX
-	if diPlus+diMinus > 0 {
-		dx := math.Abs(diPlus-diMinus) / (diPlus + diMinus) * 100
-		adx = dx // 简化版，实际应该用EMA平滑
+		dxCount++
+		switch {
+		case dxCount < period:
+			dxSum += dx
+			adx = dx
+		case dxCount == period:
+			adx = (dxSum + dx) / p
+		default:
+			adx = (adx*(p-1) + dx) / p
+		}
 	}
 
 	return adx, diPlus, diMinus
@@ -4229,6 +5823,50 @@ func calculateMFI(klines []Kline, period int) float64 {
 	return mfi
 }
 
+// calculateWilliamsR 计算威廉指标 %R（-100~0，高于-20超买，低于-80超卖）
+func calculateWilliamsR(klines []Kline, period int) float64 {
+	if period <= 0 || len(klines) < period {
+		return -50.0
+	}
+
+	window := klines[len(klines)-period:]
+	highest, lowest := window[0].High, window[0].Low
+	for _, k := range window[1:] {
+		highest = math.Max(highest, k.High)
+		lowest = math.Min(lowest, k.Low)
+	}
+	if highest == lowest {
+		return -50.0
+	}
+	return (highest - window[len(window)-1].Close) / (highest - lowest) * -100
+}
+
+// calculateCCI 计算顺势指标 CCI（典型价相对其均值的偏离，±100 以外视为超买/超卖）
+func calculateCCI(klines []Kline, period int) float64 {
+	if period <= 0 || len(klines) < period {
+		return 0
+	}
+
+	window := klines[len(klines)-period:]
+	typicals := make([]float64, len(window))
+	var sum float64
+	for i, k := range window {
+		typicals[i] = (k.High + k.Low + k.Close) / 3
+		sum += typicals[i]
+	}
+	mean := sum / float64(period)
+
+	var meanDev float64
+	for _, tp := range typicals {
+		meanDev += math.Abs(tp - mean)
+	}
+	meanDev /= float64(period)
+	if meanDev == 0 {
+		return 0
+	}
+	return (typicals[len(typicals)-1] - mean) / (0.015 * meanDev)
+}
+
 // calculateCMF 计算Chaikin Money Flow
 func calculateCMF(klines []Kline, period int) float64 {
 	if len(klines) < period {
@@ -4334,6 +5972,8 @@ type SymbolFilters struct {
 	TickSize    float64 `json:"tickSize"`
 	StepSize    float64 `json:"stepSize"`
 	MinNotional float64 `json:"minNotional,omitempty"`
+	MinQty      float64 `json:"minQty,omitempty"` // LOT_SIZE 最小下单数量，0 表示不限制
+	MaxQty      float64 `json:"maxQty,omitempty"` // LOT_SIZE 最大下单数量，0 表示不限制
 }
 
 // SymbolFiltersProvider 交易对过滤器提供者接口（用于测试注入）
@@ -4351,7 +5991,7 @@ func (p *DefaultSymbolFiltersProvider) GetSymbolFilters(symbol string) (*SymbolF
 // 全局提供者变量（可被测试注入）
 var symbolFiltersProvider SymbolFiltersProvider = &DefaultSymbolFiltersProvider{}
 
-// SetSymbolFiltersProvider 设置过滤器提供者（测试用）
+// SetSymbolFiltersProvider 设置过滤器提供者（测试注入，或由实盘交易器提供已缓存的 exchangeInfo）
 func SetSymbolFiltersProvider(provider SymbolFiltersProvider) {
 	symbolFiltersProvider = provider
 }
@@ -4366,11 +6006,39 @@ type MarketDataProvider interface {
 	Get(symbol string) (*Data, error)
 }
 
+// TimeframeMarketDataProvider 支持按分析周期获取数据的提供者（可选实现）
+type TimeframeMarketDataProvider interface {
+	GetWithTimeframes(symbol string, timeframes []string) (*Data, error)
+}
+
+// ContextMarketDataProvider 支持取消的提供者（可选实现），未实现时取消只在请求开始前生效
+type ContextMarketDataProvider interface {
+	GetWithTimeframesContext(ctx context.Context, symbol string, timeframes []string) (*Data, error)
+}
+
 // DefaultMarketDataProvider 默认实现
 type DefaultMarketDataProvider struct{}
 
 func (p *DefaultMarketDataProvider) Get(symbol string) (*Data, error) {
-	return getMarketDataFromAPI(symbol)
+	return p.GetWithTimeframesContext(context.Background(), symbol, nil)
+}
+
+func (p *DefaultMarketDataProvider) GetWithTimeframes(symbol string, timeframes []string) (*Data, error) {
+	return p.GetWithTimeframesContext(context.Background(), symbol, timeframes)
+}
+
+func (p *DefaultMarketDataProvider) GetWithTimeframesContext(ctx context.Context, symbol string, timeframes []string) (*Data, error) {
+	normalized, err := NormalizeTimeframes(timeframes)
+	if err != nil {
+		return nil, err
+	}
+	symbol = Normalize(symbol)
+	return getCachedData(ctx, symbol, normalized, func(ctx context.Context) (*Data, error) {
+		fetch := func(symbol, interval string, limit int) ([]Kline, error) {
+			return getKlinesContext(ctx, symbol, interval, limit)
+		}
+		return buildMarketData(ctx, symbol, fetch, true, normalized)
+	})
 }
 
 // 全局市场数据提供者变量（可被测试注入）
@@ -4379,11 +6047,17 @@ var marketDataProvider MarketDataProvider = &DefaultMarketDataProvider{}
 // SetMarketDataProvider 设置市场数据提供者（测试用）
 func SetMarketDataProvider(provider MarketDataProvider) {
 	marketDataProvider = provider
+	resetDataCache()
+	resetOverviewCache()
+	resetRiskRegimeCache()
 }
 
 // ResetMarketDataProvider 重置为默认提供者
 func ResetMarketDataProvider() {
 	marketDataProvider = &DefaultMarketDataProvider{}
+	resetDataCache()
+	resetOverviewCache()
+	resetRiskRegimeCache()
 }
 
 // ExchangeInfoCache 交易所信息缓存
@@ -4408,7 +6082,10 @@ type BinanceExchangeInfoResponse struct {
 			FilterType  string `json:"filterType"`
 			TickSize    string `json:"tickSize,omitempty"`
 			StepSize    string `json:"stepSize,omitempty"`
+			MinQty      string `json:"minQty,omitempty"`
+			MaxQty      string `json:"maxQty,omitempty"`
 			MinNotional string `json:"minNotional,omitempty"`
+			Notional    string `json:"notional,omitempty"` // U本位合约 MIN_NOTIONAL 使用 notional 字段
 		} `json:"filters"`
 	} `json:"symbols"`
 }
@@ -4416,7 +6093,7 @@ type BinanceExchangeInfoResponse struct {
 // fetchExchangeInfo 从Binance获取交易所信息
 func fetchExchangeInfo() (*BinanceExchangeInfoResponse, error) {
 	url := "https://fapi.binance.com/fapi/v1/exchangeInfo"
-	resp, err := http.Get(url)
+	resp, err := getHTTPClient().Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("获取交易所信息失败: %w", err)
 	}
@@ -4485,8 +6162,18 @@ func getSymbolFiltersFromCache(symbol string) (*SymbolFilters, error) {
 				if stepSize, err := strconv.ParseFloat(filter.StepSize, 64); err == nil {
 					filters.StepSize = stepSize
 				}
+				if minQty, err := strconv.ParseFloat(filter.MinQty, 64); err == nil {
+					filters.MinQty = minQty
+				}
+				if maxQty, err := strconv.ParseFloat(filter.MaxQty, 64); err == nil {
+					filters.MaxQty = maxQty
+				}
 			case "MIN_NOTIONAL":
-				if minNotional, err := strconv.ParseFloat(filter.MinNotional, 64); err == nil {
+				value := filter.Notional
+				if value == "" {
+					value = filter.MinNotional
+				}
+				if minNotional, err := strconv.ParseFloat(value, 64); err == nil {
 					filters.MinNotional = minNotional
 				}
 			}
@@ -4504,12 +6191,9 @@ func getSymbolFiltersFromCache(symbol string) (*SymbolFilters, error) {
 	return nil, fmt.Errorf("交易对 %s 的过滤器信息未找到", symbol)
 }
 
-// RoundToTick 将价格按tickSize四舍五入
+// RoundToTick 将价格按tickSize四舍五入（同 RoundToTickSize）
 func RoundToTick(price, tickSize float64) float64 {
-	if tickSize <= 0 {
-		return price
-	}
-	return math.Round(price/tickSize) * tickSize
+	return RoundToTickSize(price, tickSize)
 }
 
 // RoundToStep 将数量按stepSize四舍五入
@@ -4520,6 +6204,15 @@ func RoundToStep(qty, stepSize float64) float64 {
 	return math.Round(qty/stepSize) * stepSize
 }
 
+// FloorToStep 将数量按stepSize向下取整（下单数量不能超过保证金可开数量）
+// qty/stepSize 的浮点误差（如 0.3/0.1=2.9999999999999996）按整步处理
+func FloorToStep(qty, stepSize float64) float64 {
+	if stepSize <= 0 {
+		return qty
+	}
+	return math.Floor(qty/stepSize+1e-9) * stepSize
+}
+
 // DeriveOpenLimitPrice 基于盘口推导开仓限价（只用盘口，不做策略判断）
 func DeriveOpenLimitPrice(side string, microstructure *MicrostructureSummary, tickSize float64) (price float64, reason string) {
 	if microstructure == nil {
@@ -4564,7 +6257,7 @@ func DeriveOpenLimitPrice(side string, microstructure *MicrostructureSummary, ti
 	}
 
 	// 确保价格按tickSize对齐
-	price = RoundToTick(price, tickSize)
+	price = RoundToTickSize(price, tickSize)
 
 	return price, reason
 }
@@ -0,0 +1,178 @@
+package market
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultDataCacheTTL = 30 * time.Second // market.Get 结果默认缓存时间
+
+type dataCacheEntry struct {
+	data      *Data
+	fetchedAt time.Time
+}
+
+// dataCall 进行中的一次获取，同一 key 的并发请求等待同一结果
+type dataCall struct {
+	done    chan struct{}
+	data    *Data
+	err     error
+	waiters int                // 仍在等待结果的调用方数量（受 dataCache 锁保护）
+	cancel  context.CancelFunc // 所有调用方都放弃等待时中止获取
+}
+
+// dataCache 按 symbol+分析周期缓存完整市场数据（进程内共享），多个交易员同一轮扫描相同币种时只请求一次
+// 只作用于默认REST提供者，测试注入的 MarketDataProvider 不经过缓存
+var dataCache = struct {
+	sync.Mutex
+	entries  map[string]dataCacheEntry
+	inflight map[string]*dataCall
+	ttl      time.Duration
+}{
+	entries:  make(map[string]dataCacheEntry),
+	inflight: make(map[string]*dataCall),
+	ttl:      defaultDataCacheTTL,
+}
+
+// SetCacheTTL 设置 market.Get 结果缓存时间，ttl <= 0 表示不缓存（并发请求仍会合并）
+// K线缓存按周期配置，见 SetKlineCacheTTL
+func SetCacheTTL(ttl time.Duration) {
+	dataCache.Lock()
+	defer dataCache.Unlock()
+
+	dataCache.ttl = ttl
+	if ttl <= 0 {
+		dataCache.entries = make(map[string]dataCacheEntry)
+	}
+}
+
+// InvalidateCache 清除指定币种的市场数据缓存及其K线缓存，symbol 为空时清除全部
+func InvalidateCache(symbol string) {
+	if symbol == "" {
+		dataCache.Lock()
+		dataCache.entries = make(map[string]dataCacheEntry)
+		dataCache.Unlock()
+
+		klineCache.Lock()
+		klineCache.entries = make(map[string]*list.Element)
+		klineCache.lru.Init()
+		klineCache.Unlock()
+		return
+	}
+
+	symbol = Normalize(symbol)
+	prefix := symbol + "|"
+
+	dataCache.Lock()
+	for key := range dataCache.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(dataCache.entries, key)
+		}
+	}
+	dataCache.Unlock()
+
+	klineCache.Lock()
+	for key, elem := range klineCache.entries {
+		if strings.HasPrefix(key, prefix) {
+			klineCache.lru.Remove(elem)
+			delete(klineCache.entries, key)
+		}
+	}
+	klineCache.Unlock()
+}
+
+// resetDataCache 清空缓存并恢复默认缓存时间
+func resetDataCache() {
+	dataCache.Lock()
+	defer dataCache.Unlock()
+
+	dataCache.entries = make(map[string]dataCacheEntry)
+	dataCache.ttl = defaultDataCacheTTL
+}
+
+func dataCacheKey(source MarketDataSource, symbol string, timeframes []string) string {
+	return symbol + "|" + strings.Join(timeframes, ",") + "|" + sourceCacheKey(source)
+}
+
+// sharedFetchTimeout 合并请求的共享获取超时。共享获取与发起者的 ctx 解绑（仅继承其值），
+// 某个交易员停止（ctx 取消）只结束它自己的等待，不会让等待同一结果的其他交易员失败；
+// 所有等待者都放弃时才中止获取
+const sharedFetchTimeout = 30 * time.Second
+
+// detachedFetchContext 返回不随 ctx 取消、带共享获取超时的 ctx
+func detachedFetchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), sharedFetchTimeout)
+}
+
+// getCachedData 命中缓存时直接返回，否则由首个请求者发起一次共享获取，同 key 的并发请求共享其结果。
+// 共享获取在后台以解绑的 ctx 运行，每个调用方（含发起者）只在自己的 ctx 取消时提前返回。
+// 返回值为浅拷贝：调用方可替换顶层字段，嵌套的指针/切片（各周期序列、盘口摘要等）在调用方之间共享，必须只读
+func getCachedData(ctx context.Context, symbol string, timeframes []string, fetch func(context.Context) (*Data, error)) (*Data, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := dataCacheKey(SourceFromContext(ctx), symbol, timeframes)
+
+	dataCache.Lock()
+	if entry, ok := dataCache.entries[key]; ok && klineCacheNow().Sub(entry.fetchedAt) < dataCache.ttl {
+		dataCache.Unlock()
+		return copyData(entry.data), nil
+	}
+	call, ok := dataCache.inflight[key]
+	if !ok {
+		fetchCtx, cancel := detachedFetchContext(ctx)
+		call = &dataCall{done: make(chan struct{}), cancel: cancel}
+		dataCache.inflight[key] = call
+		go runDataCall(fetchCtx, key, call, fetch)
+	}
+	call.waiters++
+	dataCache.Unlock()
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return nil, call.err
+		}
+		return copyData(call.data), nil
+	case <-ctx.Done():
+		dataCache.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			if dataCache.inflight[key] == call {
+				delete(dataCache.inflight, key)
+			}
+		}
+		dataCache.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// runDataCall 执行一次共享获取并写入缓存
+func runDataCall(ctx context.Context, key string, call *dataCall, fetch func(context.Context) (*Data, error)) {
+	defer call.cancel()
+	data, err := fetch(ctx)
+
+	dataCache.Lock()
+	call.data, call.err = data, err
+	if dataCache.inflight[key] == call {
+		delete(dataCache.inflight, key)
+	}
+	if err == nil && dataCache.ttl > 0 {
+		dataCache.entries[key] = dataCacheEntry{data: data, fetchedAt: klineCacheNow()}
+	}
+	dataCache.Unlock()
+	close(call.done)
+}
+
+// copyData 浅拷贝（嵌套字段只读，见 getCachedData）
+func copyData(data *Data) *Data {
+	if data == nil {
+		return nil
+	}
+	cp := *data
+	return &cp
+}
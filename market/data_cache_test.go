@@ -0,0 +1,169 @@
+package market
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetCachedDataSharesConcurrentFetch(t *testing.T) {
+	ResetKlineCache()
+	t.Cleanup(ResetKlineCache)
+
+	var fetches int32
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (*Data, error) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		return &Data{Symbol: "BTCUSDT", CurrentPrice: 100}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*Data, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data, err := getCachedData(context.Background(), "BTCUSDT", defaultTimeframes, fetch)
+			if err != nil {
+				t.Errorf("getCachedData() error = %v", err)
+			}
+			results[i] = data
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Fatalf("并发请求同一币种应只获取 1 次，实际 %d 次", n)
+	}
+	results[0].CurrentPrice = -1 // 修改返回值不应影响其他调用方
+	if results[1].CurrentPrice != 100 {
+		t.Errorf("返回值应为独立副本，CurrentPrice=%.2f", results[1].CurrentPrice)
+	}
+
+	// TTL 内命中缓存
+	if _, err := getCachedData(context.Background(), "BTCUSDT", defaultTimeframes, fetch); err != nil {
+		t.Fatalf("getCachedData() error = %v", err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("TTL 内应命中缓存，实际获取 %d 次", n)
+	}
+}
+
+func TestGetCachedDataTTLAndInvalidate(t *testing.T) {
+	ResetKlineCache()
+	t.Cleanup(ResetKlineCache)
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	original := klineCacheNow
+	klineCacheNow = func() time.Time { return now }
+	t.Cleanup(func() { klineCacheNow = original })
+
+	var fetches int
+	fetch := func(ctx context.Context) (*Data, error) {
+		fetches++
+		return &Data{Symbol: "BTCUSDT"}, nil
+	}
+	get := func(symbol string, timeframes []string) {
+		if _, err := getCachedData(context.Background(), symbol, timeframes, fetch); err != nil {
+			t.Fatalf("getCachedData() error = %v", err)
+		}
+	}
+
+	get("BTCUSDT", defaultTimeframes)
+	get("BTCUSDT", []string{"1h"})
+	if fetches != 2 {
+		t.Fatalf("不同分析周期应分别缓存，实际获取 %d 次", fetches)
+	}
+
+	now = now.Add(defaultDataCacheTTL)
+	get("BTCUSDT", defaultTimeframes)
+	if fetches != 3 {
+		t.Errorf("超过默认 TTL 后应重新获取，实际获取 %d 次", fetches)
+	}
+
+	InvalidateCache("btc")
+	get("BTCUSDT", []string{"1h"})
+	if fetches != 4 {
+		t.Errorf("InvalidateCache 后应重新获取，实际获取 %d 次", fetches)
+	}
+
+	SetCacheTTL(0)
+	get("ETHUSDT", defaultTimeframes)
+	get("ETHUSDT", defaultTimeframes)
+	if fetches != 6 {
+		t.Errorf("TTL=0 时不应缓存，实际获取 %d 次", fetches)
+	}
+}
+
+type stubMarketDataProvider struct {
+	data *Data
+}
+
+func (p *stubMarketDataProvider) Get(symbol string) (*Data, error) {
+	return p.data, nil
+}
+
+func TestGetMockProviderBypassesDataCache(t *testing.T) {
+	provider := &stubMarketDataProvider{data: &Data{Symbol: "BTCUSDT", CurrentPrice: 100}}
+	SetMarketDataProvider(provider)
+	t.Cleanup(ResetMarketDataProvider)
+
+	if _, err := Get("BTCUSDT"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	provider.data = &Data{Symbol: "BTCUSDT", CurrentPrice: 200}
+	data, err := Get("BTCUSDT")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if data.CurrentPrice != 200 {
+		t.Errorf("注入的提供者不应经过缓存，CurrentPrice=%.2f", data.CurrentPrice)
+	}
+}
+
+func TestGetCachedDataLeaderCancelDoesNotFailWaiters(t *testing.T) {
+	ResetKlineCache()
+	t.Cleanup(ResetKlineCache)
+
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) (*Data, error) {
+		select {
+		case <-release:
+			return &Data{Symbol: "BTCUSDT", CurrentPrice: 100}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := getCachedData(leaderCtx, "BTCUSDT", defaultTimeframes, fetch)
+		leaderErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	waiter := make(chan *Data, 1)
+	go func() {
+		data, err := getCachedData(context.Background(), "BTCUSDT", defaultTimeframes, fetch)
+		if err != nil {
+			t.Errorf("发起者取消不应影响等待者: %v", err)
+		}
+		waiter <- data
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancelLeader()
+	if err := <-leaderErr; err != context.Canceled {
+		t.Errorf("发起者应因自身取消返回 context.Canceled，实际 %v", err)
+	}
+	close(release)
+	if data := <-waiter; data == nil || data.CurrentPrice != 100 {
+		t.Errorf("等待者应拿到共享获取的结果, got %+v", data)
+	}
+}
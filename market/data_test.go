@@ -0,0 +1,895 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newMockKlineServer 模拟Binance K线接口：按 endTime/startTime/limit 返回1分钟K线
+// 可用数据范围为 [firstOpenMs, lastOpenMs]
+func newMockKlineServer(t *testing.T, firstOpenMs, lastOpenMs int64, requests *[]map[string]string) *httptest.Server {
+	t.Helper()
+	const step = int64(time.Minute / time.Millisecond)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		*requests = append(*requests, map[string]string{
+			"startTime": q.Get("startTime"),
+			"endTime":   q.Get("endTime"),
+			"limit":     q.Get("limit"),
+		})
+
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		end := lastOpenMs
+		if v := q.Get("endTime"); v != "" {
+			e, _ := strconv.ParseInt(v, 10, 64)
+			if e < end {
+				end = e - e%step
+			}
+		}
+
+		var opens []int64
+		if v := q.Get("startTime"); v != "" {
+			start, _ := strconv.ParseInt(v, 10, 64)
+			if rem := start % step; rem != 0 {
+				start += step - rem
+			}
+			for ts := start; ts <= end && len(opens) < limit; ts += step {
+				opens = append(opens, ts)
+			}
+		} else {
+			for ts := end; ts >= firstOpenMs && len(opens) < limit; ts -= step {
+				opens = append([]int64{ts}, opens...)
+			}
+		}
+
+		raw := make([][]interface{}, 0, len(opens))
+		for _, ts := range opens {
+			raw = append(raw, []interface{}{ts, "100", "101", "99", "100.5", "10", ts + step - 1, "1000", 5, "4", "400"})
+		}
+		json.NewEncoder(w).Encode(raw)
+	}))
+
+	original := binanceFuturesBaseURL
+	binanceFuturesBaseURL = server.URL
+	ResetKlineCache()
+	t.Cleanup(func() {
+		binanceFuturesBaseURL = original
+		ResetKlineCache()
+		server.Close()
+	})
+	return server
+}
+
+func TestGetKlinesRangeEndTimeAndPagination(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	first := base.UnixMilli()
+	last := base.Add(5000 * time.Minute).UnixMilli()
+	var requests []map[string]string
+	newMockKlineServer(t, first, last, &requests)
+
+	endTime := base.Add(4000 * time.Minute)
+	klines, err := GetKlinesRange("BTCUSDT", "1m", time.Time{}, endTime, 2000)
+	if err != nil {
+		t.Fatalf("GetKlinesRange() error = %v", err)
+	}
+
+	if len(klines) != 2000 {
+		t.Fatalf("len(klines) = %d, expected 2000", len(klines))
+	}
+	if len(requests) != 2 {
+		t.Fatalf("requests = %d, expected 2 (pagination)", len(requests))
+	}
+	if requests[0]["endTime"] != strconv.FormatInt(endTime.UnixMilli(), 10) {
+		t.Errorf("first request endTime = %s, expected %d", requests[0]["endTime"], endTime.UnixMilli())
+	}
+	if requests[0]["limit"] != "1500" || requests[1]["limit"] != "500" {
+		t.Errorf("request limits = %s/%s, expected 1500/500", requests[0]["limit"], requests[1]["limit"])
+	}
+	if klines[len(klines)-1].OpenTime != endTime.UnixMilli() {
+		t.Errorf("last kline openTime = %d, expected %d", klines[len(klines)-1].OpenTime, endTime.UnixMilli())
+	}
+	for i := 1; i < len(klines); i++ {
+		if klines[i].OpenTime <= klines[i-1].OpenTime {
+			t.Fatalf("klines not strictly ascending at %d", i)
+		}
+	}
+}
+
+func TestGetKlinesRangeForward(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var requests []map[string]string
+	newMockKlineServer(t, base.UnixMilli(), base.Add(5000*time.Minute).UnixMilli(), &requests)
+
+	start := base.Add(100 * time.Minute)
+	end := base.Add(2099 * time.Minute)
+	klines, err := GetKlinesRange("BTCUSDT", "1m", start, end, 0)
+	if err != nil {
+		t.Fatalf("GetKlinesRange() error = %v", err)
+	}
+
+	if len(klines) != 2000 {
+		t.Fatalf("len(klines) = %d, expected 2000", len(klines))
+	}
+	if klines[0].OpenTime != start.UnixMilli() || klines[len(klines)-1].OpenTime != end.UnixMilli() {
+		t.Errorf("range = [%d, %d], expected [%d, %d]",
+			klines[0].OpenTime, klines[len(klines)-1].OpenTime, start.UnixMilli(), end.UnixMilli())
+	}
+	if len(requests) < 2 || requests[0]["startTime"] != strconv.FormatInt(start.UnixMilli(), 10) {
+		t.Errorf("expected paginated requests starting at startTime, got %v", requests)
+	}
+}
+
+// TestGetKlinesRangeUsesSource 按时间范围获取K线走 ctx 指定的数据源，不支持范围查询的数据源返回错误
+func TestGetKlinesRangeUsesSource(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var requests []map[string]string
+	server := newMockKlineServer(t, base.UnixMilli(), base.Add(100*time.Minute).UnixMilli(), &requests)
+	binanceFuturesBaseURL = "http://127.0.0.1:0" // 默认数据源不可用，请求只能发往 Aster
+	original := asterFuturesBaseURL
+	asterFuturesBaseURL = server.URL
+	defer func() { asterFuturesBaseURL = original }()
+
+	ctx := WithSource(context.Background(), &AsterSource{})
+	klines, err := GetKlinesRangeContext(ctx, "BTCUSDT", "1m", time.Time{}, base.Add(50*time.Minute), 10)
+	if err != nil || len(klines) != 10 || len(requests) != 1 {
+		t.Fatalf("应通过 Aster 获取10根K线, got %d, %v, requests=%d", len(klines), err, len(requests))
+	}
+
+	if _, err := GetKlinesRangeContext(WithSource(context.Background(), &fakeSource{}), "BTCUSDT", "1m", time.Time{}, base, 10); err == nil {
+		t.Error("不支持按时间范围获取的数据源应返回错误")
+	}
+}
+
+func TestClosedKlinesAtDropsBarInProgress(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var requests []map[string]string
+	newMockKlineServer(t, base.UnixMilli(), base.Add(5000*time.Minute).UnixMilli(), &requests)
+
+	// at 落在 00:100 这根K线中间，该K线尚未收盘，不能出现在结果中
+	at := base.Add(100*time.Minute + 30*time.Second)
+	klines, err := closedKlinesAt(at)("BTCUSDT", "1m", 50)
+	if err != nil {
+		t.Fatalf("closedKlinesAt() error = %v", err)
+	}
+
+	if len(klines) != 50 {
+		t.Fatalf("len(klines) = %d, expected 50", len(klines))
+	}
+	last := klines[len(klines)-1]
+	if last.CloseTime > at.UnixMilli() {
+		t.Errorf("last kline closes at %d, after at=%d", last.CloseTime, at.UnixMilli())
+	}
+	if want := base.Add(99 * time.Minute).UnixMilli(); last.OpenTime != want {
+		t.Errorf("last OpenTime = %d, expected %d", last.OpenTime, want)
+	}
+
+	// at 恰好在收盘时刻时，刚收盘的K线保留
+	at = base.Add(100*time.Minute - time.Millisecond)
+	klines, err = closedKlinesAt(at)("BTCUSDT", "1m", 50)
+	if err != nil {
+		t.Fatalf("closedKlinesAt() error = %v", err)
+	}
+	if want := base.Add(99 * time.Minute).UnixMilli(); len(klines) != 50 || klines[49].OpenTime != want {
+		t.Errorf("closed bar at boundary should be kept, got len=%d last=%d", len(klines), klines[len(klines)-1].OpenTime)
+	}
+}
+
+func TestGetKlinesDropsMalformedBars(t *testing.T) {
+	const step = int64(time.Minute / time.Millisecond)
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	bar := func(openTime int64, o, h, l, c string) []interface{} {
+		return []interface{}{openTime, o, h, l, c, "10", openTime + step - 1, "1000", 5, "4", "400"}
+	}
+	raw := [][]interface{}{
+		bar(base, "100", "101", "99", "100.5"),
+		bar(base+step, "0", "101", "99", "100"),    // 开盘价为0
+		bar(base+2*step, "100", "98", "99", "100"), // high < low
+		bar(base+3*step, "100", "101", "99", "-1"), // 收盘价为负
+		bar(base+4*step, "100", "102", "99", "101"),
+		bar(base+2*step, "100", "101", "99", "100"), // 时间倒退
+		bar(base+5*step, "101", "103", "100", "102"),
+		{base + 6*step, "101", "103"},                                               // 字段不足
+		{"not-a-time", "101", "103", "100", "102", "10", base + 7*step - 1},         // 开盘时间类型错误
+		{base + 6*step, "101", "103", "100", "102", "10", map[string]interface{}{}}, // 收盘时间类型错误
+		bar(base+6*step, "102", "104", "101", "103"),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(raw)
+	}))
+	original := binanceFuturesBaseURL
+	binanceFuturesBaseURL = server.URL
+	ResetKlineCache()
+	t.Cleanup(func() {
+		binanceFuturesBaseURL = original
+		ResetKlineCache()
+		server.Close()
+	})
+
+	klines, err := GetKlines("BTCUSDT", "1m", len(raw))
+	if err != nil {
+		t.Fatalf("GetKlines() error = %v", err)
+	}
+	expected := []int64{base, base + 4*step, base + 5*step, base + 6*step}
+	if len(klines) != len(expected) {
+		t.Fatalf("len(klines) = %d, expected %d", len(klines), len(expected))
+	}
+	for i, k := range klines {
+		if k.OpenTime != expected[i] {
+			t.Errorf("klines[%d].OpenTime = %d, expected %d", i, k.OpenTime, expected[i])
+		}
+	}
+}
+
+func TestSessionVWAP(t *testing.T) {
+	// 前一日最后两根 + 当日三根1h K线
+	dayStart := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	bar := func(offset time.Duration, price, volume float64) Kline {
+		return Kline{OpenTime: dayStart.Add(offset).UnixMilli(), High: price, Low: price, Close: price, Volume: volume}
+	}
+	klines := []Kline{
+		bar(-2*time.Hour, 90, 100),
+		bar(-time.Hour, 95, 100),
+		bar(0, 100, 1),
+		bar(time.Hour, 110, 2),
+		bar(2*time.Hour, 120, 1),
+	}
+
+	if idx := sessionAnchorIndex(klines); idx != 2 {
+		t.Fatalf("sessionAnchorIndex = %d, want 2", idx)
+	}
+	// (100×1 + 110×2 + 120×1) / 4 = 110
+	if got := calculateSessionVWAP(klines); got != 110 {
+		t.Errorf("calculateSessionVWAP = %.4f, want 110", got)
+	}
+	if got := calculateAnchoredVWAP(klines, 3); got != (110*2+120)/3.0 {
+		t.Errorf("calculateAnchoredVWAP(3) = %.4f", got)
+	}
+	if got := calculateAnchoredVWAP(klines, len(klines)); got != 0 {
+		t.Errorf("越界锚点应返回0，实际 %.4f", got)
+	}
+	// K线未覆盖日初时使用全部可用K线
+	if idx := sessionAnchorIndex(klines[3:]); idx != 0 {
+		t.Errorf("sessionAnchorIndex(当日K线) = %d, want 0", idx)
+	}
+}
+
+func TestIntradayVWAP(t *testing.T) {
+	dayStart := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	bar := func(offset time.Duration, price, volume float64) Kline {
+		return Kline{OpenTime: dayStart.Add(offset).UnixMilli(), High: price, Low: price, Close: price, Volume: volume}
+	}
+
+	// 日初前两根零成交量：沿用上一个值（首个退化为收盘价），不出现除零
+	rolling := rollingSessionVWAP([]Kline{bar(0, 100, 0), bar(5*time.Minute, 102, 0), bar(10*time.Minute, 104, 2), bar(15*time.Minute, 110, 2)}, 10)
+	if fmt.Sprint(rolling) != "[100 100 104 107]" {
+		t.Errorf("rollingSessionVWAP = %v, want [100 100 104 107]", rolling)
+	}
+
+	// 4h：第3根为摆动低点（左右各3根更高）
+	var klines4h []Kline
+	for i, low := range []float64{110, 108, 106, 100, 104, 106, 108, 109} {
+		klines4h = append(klines4h, Kline{OpenTime: dayStart.Add(time.Duration(i) * 4 * time.Hour).UnixMilli(), High: low + 2, Low: low, Close: low + 1, Volume: 1})
+	}
+	anchorTime := klines4h[3].OpenTime
+
+	// 5m 未覆盖锚点：用4h K线从锚点起计算 (101+105+107+109+110)/5
+	vwap, from, ts := swingAnchoredVWAP(nil, klines4h)
+	if from != "swing_low" || ts != anchorTime || math.Abs(vwap-(101+105+107+109+110)/5.0) > 1e-9 {
+		t.Errorf("4h 锚定VWAP = %.4f %s @%d", vwap, from, ts)
+	}
+
+	// 5m 覆盖锚点：只统计锚点之后的5m K线
+	klines5m := []Kline{
+		{OpenTime: anchorTime - 5*60*1000, High: 90, Low: 90, Close: 90, Volume: 10},
+		{OpenTime: anchorTime, High: 100, Low: 100, Close: 100, Volume: 1},
+		{OpenTime: anchorTime + 5*60*1000, High: 103, Low: 103, Close: 103, Volume: 2},
+	}
+	if vwap, _, _ := swingAnchoredVWAP(klines5m, klines4h); math.Abs(vwap-102) > 1e-9 {
+		t.Errorf("5m 锚定VWAP = %.4f, want 102", vwap)
+	}
+	if vwap, from, _ := swingAnchoredVWAP(klines5m, klines4h[:5]); vwap != 0 || from != "" {
+		t.Errorf("无摆动点时应返回0, got %.4f %s", vwap, from)
+	}
+
+	s := formatIntradayVWAP(&IntradayData{VWAPValues: []float64{100}, AnchoredVWAP: 100, AnchoredVWAPFrom: "swing_low", AnchoredVWAPTime: 1}, 102)
+	if !strings.Contains(s, "Anchored VWAP (from 4h swing_low @1): 100.0000 (price +2.00%)") {
+		t.Errorf("formatIntradayVWAP = %q", s)
+	}
+}
+
+// TestBuildMarketDataSessionVWAP5mCoversUTCDay 5m 会话VWAP应覆盖整个UTC日，日内序列仍只用最近40根
+func TestBuildMarketDataSessionVWAP5mCoversUTCDay(t *testing.T) {
+	dayStart := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	var limit5m int
+	fetch := func(symbol, interval string, limit int) ([]Kline, error) {
+		if interval != "5m" {
+			return syntheticKlines(limit, time.Duration(supportedTimeframes[interval].minutes)*time.Minute), nil
+		}
+		limit5m = limit
+		// 最后一根开盘于 23:55，前面多出的K线落在前一日
+		klines := make([]Kline, limit)
+		for i := range klines {
+			open := dayStart.Add(time.Duration(i-limit+288) * 5 * time.Minute).UnixMilli()
+			price := 100.0
+			if i >= limit-40 {
+				price = 200
+			}
+			klines[i] = Kline{OpenTime: open, Open: price, High: price, Low: price, Close: price, Volume: 1, CloseTime: open + 5*60*1000 - 1}
+		}
+		return klines, nil
+	}
+
+	data, err := buildMarketData(context.Background(), "BTCUSDT", fetch, false, defaultTimeframes)
+	if err != nil {
+		t.Fatalf("buildMarketData() error = %v", err)
+	}
+	if limit5m != sessionKlines5mLimit {
+		t.Errorf("5m 请求数量 = %d, want %d", limit5m, sessionKlines5mLimit)
+	}
+	want := (248*100.0 + 40*200.0) / 288
+	if math.Abs(data.VWAP5m-want) > 1e-9 {
+		t.Errorf("VWAP5m = %.4f, want %.4f（UTC日初起全部5m K线）", data.VWAP5m, want)
+	}
+	if got := data.IntradaySeries.VWAPValues; len(got) != 10 || math.Abs(got[len(got)-1]-want) > 1e-9 {
+		t.Errorf("日内会话VWAP序列 = %v, 最后一个值应为 %.4f", got, want)
+	}
+	if got := data.IntradaySeries.MidPrices; len(got) != supportedTimeframes["5m"].limit || got[0] != 200 {
+		t.Errorf("日内序列仍应只用最近的5m K线, MidPrices = %v", got)
+	}
+}
+
+func TestDailyPivots(t *testing.T) {
+	p := calculateDailyPivots(Kline{High: 110, Low: 90, Close: 100})
+	want := PivotPoints{PP: 100, R1: 110, R2: 120, R3: 130, S1: 90, S2: 80, S3: 70}
+	if p == nil || *p != want {
+		t.Fatalf("calculateDailyPivots() = %+v, want %+v", p, want)
+	}
+
+	// 日线最后一根为当日未收盘K线，应使用上一根计算
+	day := 24 * time.Hour
+	prior := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	fetch := func(symbol, interval string, limit int) ([]Kline, error) {
+		if interval != "1d" {
+			return syntheticKlines(limit, time.Duration(supportedTimeframes[interval].minutes)*time.Minute), nil
+		}
+		return []Kline{
+			{OpenTime: prior.UnixMilli(), High: 110, Low: 90, Close: 100, CloseTime: prior.Add(day).UnixMilli() - 1},
+			{OpenTime: prior.Add(day).UnixMilli(), High: 500, Low: 1, Close: 300, CloseTime: prior.Add(2*day).UnixMilli() - 1},
+		}, nil
+	}
+	data, err := buildMarketData(context.Background(), "BTCUSDT", fetch, false, defaultTimeframes)
+	if err != nil {
+		t.Fatalf("buildMarketData() error = %v", err)
+	}
+	if data.DailyPivots == nil || *data.DailyPivots != want {
+		t.Fatalf("DailyPivots = %+v, want %+v", data.DailyPivots, want)
+	}
+
+	got := formatNearestPivots(&want, 104, 3)
+	if got != "PP=100.0000 (below, -3.85%), R1=110.0000 (above, +5.77%), S1=90.0000 (below, -13.46%)" {
+		t.Errorf("formatNearestPivots() = %q", got)
+	}
+	if out := Format(data); !strings.Contains(out, "daily_pivots (nearest): ") {
+		t.Errorf("Format() 应包含日线枢轴点:\n%s", out)
+	}
+}
+
+func TestHeikinAshi(t *testing.T) {
+	klines := []Kline{
+		{OpenTime: 1, Open: 100, High: 110, Low: 95, Close: 105, Volume: 7},
+		{OpenTime: 2, Open: 105, High: 115, Low: 104, Close: 114},
+	}
+	ha := convertToHeikinAshi(klines)
+	if len(ha) != 2 {
+		t.Fatalf("len = %d, want 2", len(ha))
+	}
+	// 首根: HA_Open=(100+105)/2, HA_Close=(100+110+95+105)/4
+	if ha[0].Open != 102.5 || ha[0].Close != 102.5 || ha[0].High != 110 || ha[0].Low != 95 {
+		t.Errorf("首根HA = %+v", ha[0])
+	}
+	if ha[0].OpenTime != 1 || ha[0].Volume != 7 {
+		t.Errorf("时间/成交量应保持不变: %+v", ha[0])
+	}
+	// 第二根: HA_Open=(102.5+102.5)/2, HA_Close=(105+115+104+114)/4=109.5, HA_Low=min(104,102.5)
+	if ha[1].Open != 102.5 || ha[1].Close != 109.5 || ha[1].High != 115 || ha[1].Low != 102.5 {
+		t.Errorf("第二根HA = %+v", ha[1])
+	}
+
+	shapes := []CandleShape{
+		{Direction: "bear", UpperWickPct: 0},
+		{Direction: "bull", LowerWickPct: 0.2},
+		{Direction: "bull", LowerWickPct: 0.1},
+		{Direction: "bull", LowerWickPct: 0},
+		{Direction: "bull", LowerWickPct: 0},
+		{Direction: "bull", LowerWickPct: 0},
+	}
+	if got := summarizeHeikinAshi(shapes); got != "consecutive bull candles: 5, no lower wicks for last 3" {
+		t.Errorf("summarizeHeikinAshi() = %q", got)
+	}
+	if got := summarizeHeikinAshi([]CandleShape{{Direction: "bear", UpperWickPct: 0.3}}); got != "consecutive bear candles: 1" {
+		t.Errorf("summarizeHeikinAshi() = %q", got)
+	}
+	if got := summarizeHeikinAshi([]CandleShape{{Direction: "doji"}}); got != "" {
+		t.Errorf("最新为十字星时应返回空，实际 %q", got)
+	}
+
+	// 单边上涨：HA 全为阳线且无下影线
+	data, err := buildMarketData(context.Background(), "BTCUSDT", func(symbol, interval string, limit int) ([]Kline, error) {
+		klines := syntheticKlines(limit, time.Duration(supportedTimeframes[interval].minutes)*time.Minute)
+		for i := range klines {
+			price := 100 + float64(i)
+			klines[i].Open, klines[i].High, klines[i].Low, klines[i].Close = price, price+1.2, price-0.2, price+1
+		}
+		return klines, nil
+	}, false, defaultTimeframes)
+	if err != nil {
+		t.Fatalf("buildMarketData() error = %v", err)
+	}
+	if len(data.HeikinAshi15m) == 0 || len(data.HeikinAshi1h) == 0 || len(data.HeikinAshi4h) == 0 {
+		t.Fatalf("HeikinAshi 序列不应为空")
+	}
+	if out := Format(data); !strings.Contains(out, "heikin_ashi: 15m consecutive bull candles: 20, no lower wicks for last 20") {
+		t.Errorf("Format() 应包含 Heikin-Ashi 摘要:\n%s", out)
+	}
+}
+
+func TestConsolidateZones(t *testing.T) {
+	zones := []SRZone{
+		{Lower: 100.0, Upper: 100.2, Kind: "support", Strength: 1, Hits: 2, Basis: "15m_low"},
+		{Lower: 110.0, Upper: 110.2, Kind: "resistance", Strength: 1, Hits: 1, Basis: "15m_high"},
+		{Lower: 100.15, Upper: 100.35, Kind: "support", Strength: 2, Hits: 1, Basis: "15m_low+bb_low"}, // 重叠
+		{Lower: 100.4, Upper: 100.6, Kind: "support", Strength: 1, Hits: 3, Basis: "15m_low"},          // 间距0.05 ≈ 0.05%
+		{Lower: 102.0, Upper: 102.2, Kind: "support", Strength: 1, Hits: 1, Basis: "15m_low"},          // 距离过远
+		{Lower: 100.1, Upper: 100.3, Kind: "resistance", Strength: 3, Hits: 1, Basis: "15m_high"},      // 不同类不合并
+	}
+
+	got := consolidateZones(zones, 0.1)
+	if len(got) != 4 {
+		t.Fatalf("合并后应剩 4 个区间, got %d: %+v", len(got), got)
+	}
+	var merged *SRZone
+	for i := range got {
+		if got[i].Kind == "support" && got[i].Lower == 100.0 {
+			merged = &got[i]
+		}
+	}
+	if merged == nil {
+		t.Fatalf("缺少合并后的支撑区: %+v", got)
+	}
+	if merged.Upper != 100.6 || merged.Hits != 6 || merged.Strength != 2 || merged.Basis != "15m_low|15m_low+bb_low" {
+		t.Errorf("合并结果 = %+v", *merged)
+	}
+
+	// 容差为0时只合并重叠区间
+	if got := consolidateZones(zones, 0); len(got) != 5 {
+		t.Errorf("容差为0时应只合并重叠区间，剩 %d 个: %+v", len(got), got)
+	}
+}
+
+func TestFindFibConfluence(t *testing.T) {
+	fib4h := &FibSet{Timeframe: "4h", Levels: []FibLevel{{Ratio: 0.382, Price: 100}, {Ratio: 0.5, Price: 95}, {Ratio: 0.618, Price: 90}}}
+	fib1h := &FibSet{Timeframe: "1h", Levels: []FibLevel{{Ratio: 0.5, Price: 100.1}, {Ratio: 0.618, Price: 95.5}, {Ratio: 0.236, Price: 90.2}}}
+
+	got := FindFibConfluence(fib4h, fib1h, 0.3)
+	if len(got) != 2 {
+		t.Fatalf("应找到 2 个共振区, got %+v", got)
+	}
+	// 间距约0.22%，1h为非关键比例 → 强度1
+	if got[0].Ratio4h != 0.618 || got[0].Ratio1h != 0.236 || got[0].ConfluenceStrength != 1 || math.Abs(got[0].Price-90.1) > 1e-9 {
+		t.Errorf("低位共振区 = %+v", got[0])
+	}
+	// 间距约0.1%，两侧均为关键比例 → 强度3
+	if got[1].Ratio4h != 0.382 || got[1].Ratio1h != 0.5 || got[1].ConfluenceStrength != 3 || math.Abs(got[1].Price-100.05) > 1e-9 {
+		t.Errorf("高位共振区 = %+v", got[1])
+	}
+
+	if got := FindFibConfluence(fib4h, nil, 0.3); got != nil {
+		t.Errorf("缺少1h斐波那契时应返回nil, got %+v", got)
+	}
+
+	data := &Data{Symbol: "BTCUSDT", CurrentPrice: 99, FibConfluence: got}
+	out := Format(data)
+	if !strings.Contains(out, "Fib confluence 4h×1h (nearest 3):\nprice=100.05 ratio_4h=0.382 ratio_1h=0.500 strength=3") {
+		t.Errorf("Format() 应按距当前价由近到远列出共振区:\n%s", out)
+	}
+}
+
+func TestStochRSI(t *testing.T) {
+	// 先震荡下跌，再连续急涨：最新 %K 应处于高位且位于 %D 之上
+	var klines []Kline
+	price := 100.0
+	for i := 0; i < 40; i++ {
+		if i%2 == 0 {
+			price -= 2
+		} else {
+			price += 1
+		}
+		klines = append(klines, Kline{Close: price})
+	}
+	for i := 0; i < 3; i++ {
+		price += 3
+		klines = append(klines, Kline{Close: price})
+	}
+
+	rsiSeries := calculateRSISeries(klines, 14)
+	if got, want := rsiSeries[len(rsiSeries)-1], CalculateRSI(klines, 14); math.Abs(got-want) > 1e-9 {
+		t.Fatalf("RSI序列末值 %.6f 与 CalculateRSI %.6f 不一致", got, want)
+	}
+
+	k, d := calculateStochRSI(klines, 14, 14)
+	if k < 80 || k > 100 {
+		t.Errorf("急涨后 %%K 应接近100，实际 %.2f", k)
+	}
+	if k <= d {
+		t.Errorf("急涨后 %%K(%.2f) 应高于 %%D(%.2f)", k, d)
+	}
+
+	minBars := stochRSIMinBars(14, 14)
+	if k, d := calculateStochRSI(klines[:minBars-1], 14, 14); k != 0 || d != 0 {
+		t.Errorf("数据不足应返回 0,0，实际 %.2f,%.2f", k, d)
+	}
+	if k, _ := calculateStochRSI(klines[:minBars], 14, 14); k < 0 || k > 100 {
+		t.Errorf("%%K 超出范围: %.2f", k)
+	}
+
+	series := calculateMidTermSeries15m(klines)
+	if len(series.StochRSIK) == 0 || len(series.StochRSIK) != len(series.StochRSID) {
+		t.Fatalf("15m StochRSI 序列长度异常: K=%d D=%d", len(series.StochRSIK), len(series.StochRSID))
+	}
+	if series.StochRSIK[len(series.StochRSIK)-1] != k {
+		t.Errorf("15m 序列末值应等于 calculateStochRSI 结果")
+	}
+
+	if out := formatStochRSI([]float64{20, 40}, []float64{30, 35}, 3); !strings.Contains(out, "[bullish_cross]") {
+		t.Errorf("应标注金叉: %s", out)
+	}
+	if out := formatStochRSI([]float64{80, 60}, []float64{70, 65}, 3); !strings.Contains(out, "[bearish_cross]") {
+		t.Errorf("应标注死叉: %s", out)
+	}
+}
+
+func TestWilliamsRAndCCI(t *testing.T) {
+	// 14根K线：最高110、最低90，最新收盘105
+	var klines []Kline
+	for i := 0; i < 14; i++ {
+		klines = append(klines, Kline{High: 100 + float64(i%3), Low: 98, Close: 100})
+	}
+	klines[3].High = 110
+	klines[7].Low = 90
+	klines[13] = Kline{High: 106, Low: 104, Close: 105}
+
+	if got := calculateWilliamsR(klines, 14); math.Abs(got-(-25)) > 1e-9 {
+		t.Errorf("WilliamsR = %.4f, want -25", got)
+	}
+	if got := calculateWilliamsR(klines[:5], 14); got != -50 {
+		t.Errorf("数据不足时 WilliamsR 应为 -50，got %.4f", got)
+	}
+
+	if got := calculateCCI(klines, 14); got <= 100 {
+		t.Errorf("最新典型价显著高于均值时 CCI 应 > 100，got %.2f", got)
+	}
+	flat := make([]Kline, 14)
+	for i := range flat {
+		flat[i] = Kline{High: 100, Low: 100, Close: 100}
+	}
+	if got := calculateCCI(flat, 14); got != 0 {
+		t.Errorf("价格不变时 CCI 应为 0，got %.2f", got)
+	}
+
+	if s := formatWilliamsRCCI(-10, 150); !strings.Contains(s, "Williams %R(14): -10.00, CCI(14): 150.00 [overbought]") {
+		t.Errorf("formatWilliamsRCCI = %q", s)
+	}
+}
+
+func TestCalculateADX(t *testing.T) {
+	// 稳定上涨：每根高低点都抬高，ADX 应明显高于 25 且 +DI > -DI
+	var trending []Kline
+	for i := 0; i < 60; i++ {
+		base := 100 + float64(i)*1.5
+		trending = append(trending, Kline{High: base + 1, Low: base - 1, Close: base + 0.8})
+	}
+	adx, diPlus, diMinus := calculateADX(trending, 14)
+	if adx <= 25 {
+		t.Errorf("趋势行情 ADX = %.2f, want > 25", adx)
+	}
+	if diPlus <= diMinus {
+		t.Errorf("上涨趋势 +DI(%.2f) 应大于 -DI(%.2f)", diPlus, diMinus)
+	}
+
+	// 来回震荡：ADX 应低于趋势行情
+	var choppy []Kline
+	for i := 0; i < 60; i++ {
+		base := 100.0
+		if i%2 == 0 {
+			base = 101
+		}
+		choppy = append(choppy, Kline{High: base + 1, Low: base - 1, Close: base})
+	}
+	if chopADX, _, _ := calculateADX(choppy, 14); chopADX >= 20 {
+		t.Errorf("震荡行情 ADX = %.2f, want < 20", chopADX)
+	}
+
+	if adx, _, _ := calculateADX(trending[:10], 14); adx != 0 {
+		t.Errorf("数据不足时 ADX 应为 0，got %.2f", adx)
+	}
+	if s := formatADX(30, 25, 10); !strings.Contains(s, "ADX(14): 30.00, +DI: 25.00, -DI: 10.00 [strong_uptrend]") {
+		t.Errorf("formatADX = %q", s)
+	}
+
+	for _, tc := range []struct {
+		adx  float64
+		want string
+	}{{45, "strong"}, {30, "moderate"}, {22, "weak"}, {10, "ranging"}} {
+		if got := classifyTrendStrength(tc.adx); got != tc.want {
+			t.Errorf("classifyTrendStrength(%.0f) = %s, want %s", tc.adx, got, tc.want)
+		}
+	}
+}
+
+func TestOBVDivergence(t *testing.T) {
+	build := func(closes, volumes []float64) []Kline {
+		klines := make([]Kline, len(closes))
+		for i := range closes {
+			klines[i] = Kline{Close: closes[i], Volume: volumes[i]}
+		}
+		return klines
+	}
+
+	tests := []struct {
+		name    string
+		closes  []float64
+		volumes []float64
+		want    string
+	}{
+		// 横盘震荡但上涨K线放量：吸筹
+		{"横盘OBV上升", []float64{100, 100.02, 100.01, 100.03, 100.02, 100.04}, []float64{10, 50, 10, 50, 10, 50}, "bullish"},
+		// 价格上涨但下跌K线放量：派发
+		{"价格上涨OBV下降", []float64{100, 99, 101, 100, 102, 101}, []float64{10, 50, 10, 50, 10, 50}, "bearish"},
+		{"量价同向", []float64{100, 101, 102, 103, 104, 105}, []float64{10, 10, 10, 10, 10, 10}, "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			klines := build(tt.closes, tt.volumes)
+			obv := calculateOBV(klines)
+			if got := detectOBVDivergence(klines, obv, 5); got != tt.want {
+				t.Errorf("detectOBVDivergence() = %s, want %s (obv=%v)", got, tt.want, obv)
+			}
+		})
+	}
+
+	if got := detectOBVDivergence(nil, nil, 5); got != "none" {
+		t.Errorf("数据不足时应为 none, got %s", got)
+	}
+	if d := calculateVolumeDeltas([]Kline{{Volume: 10, TakerBuyBaseVolume: 7}}); d[0] != 4 {
+		t.Errorf("volume delta = %.2f, want 4", d[0])
+	}
+}
+
+func TestDetectRSIDivergence(t *testing.T) {
+	// 急跌至第一个低点(idx 20)，反弹后缓跌至略低的第二个低点(idx 35)：价格新低而RSI抬高
+	var klines []Kline
+	price := 100.0
+	for i := 0; i < 40; i++ {
+		switch {
+		case i <= 20:
+			price -= 2
+		case i <= 28:
+			price += 1.5
+		default:
+			price -= 1.8
+		}
+		klines = append(klines, Kline{OpenTime: int64(i), High: price + 0.5, Low: price - 0.5, Close: price})
+	}
+	// 第二个低点比第一个低
+	klines[35].Low = klines[20].Low - 1
+
+	if got := detectRSIDivergence(klines, []int{20, 35}, false); len(got) != 2 || got[0] != 20 || got[1] != 35 {
+		t.Errorf("应检测到看涨背离, got %v", got)
+	}
+	if got := detectRSIDivergence(klines, []int{20, 35}, true); got != nil {
+		t.Errorf("高点未创新高不应有看跌背离, got %v", got)
+	}
+	if got := detectRSIDivergence(klines, []int{35}, false); got != nil {
+		t.Errorf("pivot不足两个不应判定背离, got %v", got)
+	}
+
+	pa := &PriceActionSummary{BullishDivergence: true, BullishDivergenceTimes: []int64{20, 35}}
+	if s := formatRSIDivergence(pa); !strings.Contains(s, "rsi_divergence=bullish (pivot lows @20 → @35)") {
+		t.Errorf("formatRSIDivergence = %q", s)
+	}
+}
+
+// TestPriceActionSignalAge 测试结构信号时效：记录距今根数，过期信号被过滤，非新鲜信号在提示词中标注
+func TestPriceActionSignalAge(t *testing.T) {
+	// 上升波动中产生 BOS_up，第80根之后横盘
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var klines []Kline
+	for i := 0; i < 120; i++ {
+		x := math.Min(float64(i), 80)
+		price := 100 + 0.3*x + 5*math.Sin(x/3)
+		open := base.Add(time.Duration(i) * time.Hour).UnixMilli()
+		klines = append(klines, Kline{OpenTime: open, Open: price, High: price + 0.5, Low: price - 0.5, Close: price, Volume: 1, CloseTime: open + 3600000 - 1})
+	}
+
+	pa := calcPriceActionSummary(klines, "1h", 5, 10, 10, 1000)
+	if pa.LastSignal != "BOS_up" || pa.LastSignalAgeCandles != 42 || pa.SignalFresh {
+		t.Fatalf("signal=%s age=%d fresh=%v, want BOS_up 42 false", pa.LastSignal, pa.LastSignalAgeCandles, pa.SignalFresh)
+	}
+	if s := formatPriceActionSignal(pa); !strings.Contains(s, "last_signal_age_candles=42 [STALE") {
+		t.Errorf("formatPriceActionSignal = %q", s)
+	}
+
+	// 默认上限30根：42根前的信号被过滤
+	if pa := calcPriceActionSummary(klines, "1h", 5, 10, 10, 0); pa.LastSignal != "none" || pa.LastSignalTime != 0 || pa.SignalFresh {
+		t.Errorf("过期信号应被过滤, got signal=%s time=%d", pa.LastSignal, pa.LastSignalTime)
+	}
+
+	// 信号后仅3根：新鲜信号不标注
+	pa = calcPriceActionSummary(klines[:len(klines)-39], "1h", 5, 10, 10, 0)
+	if pa.LastSignal != "BOS_up" || pa.LastSignalAgeCandles != 3 || !pa.SignalFresh {
+		t.Fatalf("signal=%s age=%d fresh=%v, want BOS_up 3 true", pa.LastSignal, pa.LastSignalAgeCandles, pa.SignalFresh)
+	}
+	if s := formatPriceActionSignal(pa); !strings.Contains(s, "last_signal_age_candles=3 bull_slope") {
+		t.Errorf("formatPriceActionSignal = %q", s)
+	}
+}
+
+func TestGetOrderbookSummary(t *testing.T) {
+	depth := `{"lastUpdateId":1,"bids":[["100.0","5"],["99.9","10"]],"asks":[["100.2","2"],["100.3","4"]]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("symbol") {
+		case "BTCUSDT":
+			w.Write([]byte(depth))
+		case "EMPTYUSDT":
+			w.Write([]byte(`{"lastUpdateId":1,"bids":[],"asks":[]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	original := binanceFuturesBaseURL
+	binanceFuturesBaseURL = server.URL
+	defer func() { binanceFuturesBaseURL = original }()
+
+	m, err := getOrderbookSummary(context.Background(), "BTCUSDT")
+	if err != nil || m == nil {
+		t.Fatalf("getOrderbookSummary() = %v, %v", m, err)
+	}
+	if m.BestBidPrice != 100 || m.BestAskPrice != 100.2 || m.BestBidNotional != 500 || math.Abs(m.BestAskNotional-200.4) > 1e-9 {
+		t.Errorf("最优买卖价/名义价值错误: %+v", m)
+	}
+	if m.MinNotional != m.BestAskNotional || m.DepthRatio != 2.5 {
+		t.Errorf("MinNotional=%.2f DepthRatio=%.2f, want %.2f / 2.5", m.MinNotional, m.DepthRatio, m.BestAskNotional)
+	}
+	if want := 0.2 / 100.1 * 1e4; math.Abs(m.SpreadBps-want) > 1e-9 {
+		t.Errorf("SpreadBps = %.4f, want %.4f", m.SpreadBps, want)
+	}
+
+	if m, err := getOrderbookSummary(context.Background(), "EMPTYUSDT"); err != nil || m != nil {
+		t.Errorf("空盘口应返回 nil, nil, got %v, %v", m, err)
+	}
+	if _, err := getOrderbookSummary(context.Background(), "BADUSDT"); err == nil {
+		t.Error("非2xx响应应返回错误")
+	}
+}
+
+func TestParabolicSAR(t *testing.T) {
+	var klines []Kline
+	for i := 0; i < 30; i++ {
+		base := 100 + float64(i)
+		klines = append(klines, Kline{High: base + 0.5, Low: base - 0.5, Close: base})
+	}
+
+	sar := calculateParabolicSAR(klines, 0.02, 0.20)
+	if len(sar) != len(klines) {
+		t.Fatalf("SAR 长度 = %d, want %d", len(sar), len(klines))
+	}
+	for i := 1; i < len(sar); i++ {
+		if sar[i] >= klines[i].Low || sar[i] < sar[i-1] {
+			t.Fatalf("上涨趋势中 SAR 应位于最低价下方且逐步抬高: i=%d sar=%.4f low=%.4f prev=%.4f", i, sar[i], klines[i].Low, sar[i-1])
+		}
+	}
+	values, direction := parabolicSARSummary(klines)
+	if len(values) != 10 || direction != "below" {
+		t.Errorf("上涨趋势 summary = %d values, %s; want 10, below", len(values), direction)
+	}
+
+	// 急跌击穿 SAR 后反转为空头，SAR 移到价格上方
+	for i := 0; i < 5; i++ {
+		base := 120 - float64(i)*4
+		klines = append(klines, Kline{High: base + 0.5, Low: base - 0.5, Close: base})
+	}
+	if _, direction := parabolicSARSummary(klines); direction != "above" {
+		t.Errorf("反转后 direction = %s, want above", direction)
+	}
+	if s := formatParabolicSAR([]float64{101.5}, "above"); !strings.Contains(s, "Parabolic SAR(0.02,0.20): 101.5000, SAR above price [bearish]") {
+		t.Errorf("formatParabolicSAR = %q", s)
+	}
+	if calculateParabolicSAR(klines[:1], 0.02, 0.20) != nil {
+		t.Error("数据不足时应返回 nil")
+	}
+}
+
+func TestCalculateIchimoku(t *testing.T) {
+	var klines []Kline
+	for i := 0; i < 77; i++ {
+		base := 100 + float64(i)
+		klines = append(klines, Kline{High: base + 0.5, Low: base - 0.5, Close: base})
+	}
+	if ich := calculateIchimoku(klines); ich != nil {
+		t.Fatalf("不足 78 根K线应返回 nil, got %+v", ich)
+	}
+
+	for i := 77; i < 100; i++ {
+		base := 100 + float64(i)
+		klines = append(klines, Kline{High: base + 0.5, Low: base - 0.5, Close: base})
+	}
+	ich := calculateIchimoku(klines)
+	if ich == nil {
+		t.Fatal("100 根K线应计算出一目均衡表")
+	}
+	want := IchimokuData{TenkanSen: 195, KijunSen: 186.5, SenkouSpanA: 164.75, SenkouSpanB: 147.5, ChikouSpan: 199}
+	if *ich != want {
+		t.Errorf("calculateIchimoku = %+v, want %+v", *ich, want)
+	}
+
+	if s := formatIchimoku(ich); !strings.Contains(s, "price above cloud") ||
+		!strings.Contains(s, "tenkan>kijun (bullish)") || !strings.Contains(s, "cloud bullish") {
+		t.Errorf("formatIchimoku = %q", s)
+	}
+	bearish := &IchimokuData{TenkanSen: 90, KijunSen: 95, SenkouSpanA: 100, SenkouSpanB: 110, ChikouSpan: 85}
+	if s := formatIchimoku(bearish); !strings.Contains(s, "price below cloud") ||
+		!strings.Contains(s, "tenkan<kijun (bearish)") || !strings.Contains(s, "cloud bearish") {
+		t.Errorf("formatIchimoku = %q", s)
+	}
+	if formatIchimoku(nil) != "" {
+		t.Error("nil 时不应输出")
+	}
+}
+
+func TestCalculateVolumeProfile(t *testing.T) {
+	vols := []float64{10, 20, 50, 100, 60, 5, 40, 30, 10, 5}
+	var klines []Kline
+	for i, v := range vols {
+		base := 100 + float64(i)
+		klines = append(klines, Kline{Low: base, High: base + 1, Close: base + 0.5, Volume: v})
+	}
+
+	vp := calculateVolumeProfile(klines, 10)
+	if vp == nil {
+		t.Fatal("应计算出成交量分布")
+	}
+	if vp.POC != 103.5 {
+		t.Errorf("POC = %.2f, want 103.5", vp.POC)
+	}
+	// 价值区从 POC 扩展到覆盖 >=70% 成交量：[100, 105]
+	if vp.VAL != 100 || vp.VAH != 105 {
+		t.Errorf("value area = [%.2f, %.2f], want [100, 105]", vp.VAL, vp.VAH)
+	}
+	if fmt.Sprint(vp.LowVolumeNodes) != "[105.5]" {
+		t.Errorf("LowVolumeNodes = %v, want [105.5]", vp.LowVolumeNodes)
+	}
+
+	// 跨桶K线按重叠比例分摊成交量
+	spread := calculateVolumeProfile([]Kline{{Low: 0, High: 4, Volume: 40}, {Low: 2, High: 3, Volume: 5}}, 4)
+	if spread == nil || spread.POC != 2.5 {
+		t.Errorf("分摊后 POC 应为 2.5, got %+v", spread)
+	}
+
+	if calculateVolumeProfile(nil, 10) != nil || calculateVolumeProfile([]Kline{{Low: 1, High: 1}}, 10) != nil {
+		t.Error("无K线或无价格区间时应返回 nil")
+	}
+	if s := formatVolumeProfile("4h", vp); !strings.Contains(s, "4h Volume Profile: POC=103.5000, value area=[100.0000, 105.0000], low-volume nodes: 105.5000") {
+		t.Errorf("formatVolumeProfile = %q", s)
+	}
+}
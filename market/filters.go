@@ -0,0 +1,31 @@
+package market
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RoundToTickSize 将价格四舍五入到 tickSize 的整数倍，并去掉浮点误差
+// （如 0.1*3=0.30000000000000004），保证小数位数不超过 tickSize 的精度，
+// 避免交易所因价格精度拒单（Binance -1111）。tickSize<=0 时原样返回
+func RoundToTickSize(price, tickSize float64) float64 {
+	if tickSize <= 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+		return price
+	}
+	rounded := math.Round(price/tickSize) * tickSize
+	aligned, err := strconv.ParseFloat(strconv.FormatFloat(rounded, 'f', tickDecimals(tickSize), 64), 64)
+	if err != nil {
+		return rounded
+	}
+	return aligned
+}
+
+// tickDecimals tickSize 的小数位数（0.01 -> 2，0.5 -> 1，1 -> 0）
+func tickDecimals(tickSize float64) int {
+	s := strconv.FormatFloat(tickSize, 'f', -1, 64)
+	if idx := strings.IndexByte(s, '.'); idx >= 0 {
+		return len(s) - idx - 1
+	}
+	return 0
+}
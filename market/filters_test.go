@@ -0,0 +1,46 @@
+package market
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRoundToTickSize(t *testing.T) {
+	tests := []struct {
+		price, tickSize float64
+		want            string
+	}{
+		{0.1 * 3, 0.1, "0.3"}, // 0.30000000000000004
+		{1.2345678, 0.0001, "1.2346"},
+		{60250.015, 0.1, "60250"},
+		{123.456, 0.5, "123.5"},
+		{0.000123456, 0.0000001, "0.0001235"},
+		{64321.7, 10, "64320"},
+		{1.23456, 0, "1.23456"},
+		{math.NaN(), 0.01, "NaN"},
+		{math.Inf(1), 0.01, "+Inf"},
+	}
+	for _, tt := range tests {
+		got := RoundToTickSize(tt.price, tt.tickSize)
+		if s := strconv.FormatFloat(got, 'f', -1, 64); s != tt.want {
+			t.Errorf("RoundToTickSize(%v, %v) = %s, want %s", tt.price, tt.tickSize, s, tt.want)
+		}
+	}
+
+	// 任意价格对齐后的小数位数都不超过 tickSize 精度（交易所按此校验 -1111）
+	for _, tick := range []float64{0.1, 0.01, 0.001, 0.0001, 0.00001} {
+		maxDecimals := tickDecimals(tick)
+		for i := 1; i <= 1000; i++ {
+			price := float64(i) * 1.0000037
+			s := strconv.FormatFloat(RoundToTickSize(price, tick), 'f', -1, 64)
+			if idx := strings.IndexByte(s, '.'); idx >= 0 && len(s)-idx-1 > maxDecimals {
+				t.Fatalf("RoundToTickSize(%v, %v) = %s, 小数位超过 %d", price, tick, s, maxDecimals)
+			}
+			if RoundToTick(price, tick) != RoundToTickSize(price, tick) {
+				t.Fatalf("RoundToTick 应与 RoundToTickSize 结果一致: price=%v tick=%v", price, tick)
+			}
+		}
+	}
+}
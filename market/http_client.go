@@ -0,0 +1,196 @@
+package market
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout = 10 * time.Second // 默认请求超时，避免交易所连接挂起阻塞决策周期
+	httpMaxAttempts    = 3                // 最多尝试次数（含首次）
+	httpMaxRetryAfter  = 30 * time.Second // Retry-After 超过该值时不再等待重试，直接返回限频错误
+)
+
+// httpRetryBaseDelay 首次重试前的等待时间，之后每次翻倍（测试可调小）
+var httpRetryBaseDelay = 200 * time.Millisecond
+
+var (
+	httpClientMu sync.RWMutex
+	httpClient   = &http.Client{Timeout: defaultHTTPTimeout}
+)
+
+// ErrRateLimited 交易所限频（HTTP 429/418），调用方可用 errors.Is 判断后退避重试
+var ErrRateLimited = errors.New("binance rate limited")
+
+// httpStatusError 非2xx响应
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	RetryAfter time.Duration // 响应头 Retry-After（未提供时为0）
+}
+
+func (e *httpStatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("binance request failed: %s", e.Status)
+	}
+	return fmt.Sprintf("binance request failed: %s: %s", e.Status, e.Body)
+}
+
+// Is 使限频响应可通过 errors.Is(err, ErrRateLimited) 识别
+func (e *httpStatusError) Is(target error) bool {
+	return target == ErrRateLimited &&
+		(e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusTeapot)
+}
+
+// SetHTTPClient 替换market包使用的HTTP客户端（传nil恢复默认客户端）
+func SetHTTPClient(client *http.Client) {
+	if client == nil {
+		client = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	httpClientMu.Lock()
+	httpClient = client
+	httpClientMu.Unlock()
+}
+
+// SetHTTPTimeout 设置请求超时（<=0 表示不超时）
+func SetHTTPTimeout(timeout time.Duration) {
+	if timeout < 0 {
+		timeout = 0
+	}
+	httpClientMu.Lock()
+	client := *httpClient
+	client.Timeout = timeout
+	httpClient = &client
+	httpClientMu.Unlock()
+}
+
+func getHTTPClient() *http.Client {
+	httpClientMu.RLock()
+	defer httpClientMu.RUnlock()
+	return httpClient
+}
+
+// isRetryableHTTPError 网络错误、429限频与5xx可重试；其余4xx（含418封禁IP）直接返回
+func isRetryableHTTPError(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		if statusErr.StatusCode == http.StatusTooManyRequests {
+			return statusErr.RetryAfter <= httpMaxRetryAfter
+		}
+		return statusErr.StatusCode >= 500
+	}
+	return true
+}
+
+// parseRetryAfter 解析 Retry-After 响应头（秒数或HTTP日期），无法解析时返回0
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// httpGetOnce 发起一次GET请求，返回2xx响应体；ctx 取消时请求立即中断
+func httpGetOnce(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httpDoOnce(req)
+}
+
+// httpPostJSONOnce 发起一次JSON POST请求，返回2xx响应体
+func httpPostJSONOnce(ctx context.Context, url string, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return httpDoOnce(req)
+}
+
+// httpDoOnce 执行请求，非2xx响应转为 httpStatusError
+func httpDoOnce(req *http.Request) ([]byte, error) {
+	resp, err := getHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &httpStatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       string(body),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	return body, nil
+}
+
+// httpGetWithRetry GET请求，网络错误、429或5xx时按指数退避重试（优先使用 Retry-After）；ctx 取消后不再重试
+// 重试耗尽仍限频时返回的错误可通过 errors.Is(err, ErrRateLimited) 识别，调用方可据此跳过该币种
+func httpGetWithRetry(ctx context.Context, url string) ([]byte, error) {
+	return withHTTPRetry(ctx, func() ([]byte, error) { return httpGetOnce(ctx, url) })
+}
+
+// httpPostJSONWithRetry JSON POST请求（如 Hyperliquid /info），重试策略同 httpGetWithRetry
+func httpPostJSONWithRetry(ctx context.Context, url string, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return withHTTPRetry(ctx, func() ([]byte, error) { return httpPostJSONOnce(ctx, url, data) })
+}
+
+// withHTTPRetry 网络错误、429或5xx时按指数退避重试 do（优先使用 Retry-After）
+func withHTTPRetry(ctx context.Context, do func() ([]byte, error)) ([]byte, error) {
+	delay := httpRetryBaseDelay
+	var lastErr error
+	for attempt := 1; attempt <= httpMaxAttempts; attempt++ {
+		body, err := do()
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil || !isRetryableHTTPError(err) || attempt == httpMaxAttempts {
+			break
+		}
+		wait := delay
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			wait = statusErr.RetryAfter
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, lastErr
+		}
+		delay *= 2
+	}
+	return nil, lastErr
+}
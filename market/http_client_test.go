@@ -0,0 +1,211 @@
+package market
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func withFastRetry(t *testing.T) {
+	t.Helper()
+	prevDelay := httpRetryBaseDelay
+	httpRetryBaseDelay = time.Millisecond
+	t.Cleanup(func() {
+		httpRetryBaseDelay = prevDelay
+		SetHTTPClient(nil)
+	})
+}
+
+func TestHTTPGetWithRetry(t *testing.T) {
+	withFastRetry(t)
+
+	t.Run("5xx后重试成功", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`{"ok":true}`))
+		}))
+		defer srv.Close()
+
+		body, err := httpGetWithRetry(context.Background(), srv.URL)
+		if err != nil {
+			t.Fatalf("第3次应成功: %v", err)
+		}
+		if string(body) != `{"ok":true}` {
+			t.Errorf("响应体不符: %s", body)
+		}
+		if n := atomic.LoadInt32(&calls); n != 3 {
+			t.Errorf("请求次数 = %d, want 3", n)
+		}
+	})
+
+	t.Run("持续5xx返回最后错误", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		_, err := httpGetWithRetry(context.Background(), srv.URL)
+		var statusErr *httpStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("应返回503状态错误，实际 %v", err)
+		}
+		if n := atomic.LoadInt32(&calls); n != httpMaxAttempts {
+			t.Errorf("请求次数 = %d, want %d", n, httpMaxAttempts)
+		}
+	})
+
+	t.Run("4xx不重试", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+		}))
+		defer srv.Close()
+
+		if _, err := httpGetWithRetry(context.Background(), srv.URL); err == nil {
+			t.Fatal("400 应返回错误")
+		}
+		if n := atomic.LoadInt32(&calls); n != 1 {
+			t.Errorf("请求次数 = %d, want 1", n)
+		}
+	})
+
+	t.Run("429可识别为限频", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		_, err := httpGetWithRetry(context.Background(), srv.URL)
+		if !errors.Is(fmt.Errorf("获取5m K线失败: %w", err), ErrRateLimited) {
+			t.Errorf("429 应可通过 errors.Is 识别为 ErrRateLimited，实际 %v", err)
+		}
+		if errors.Is(&httpStatusError{StatusCode: http.StatusBadRequest}, ErrRateLimited) {
+			t.Error("400 不应识别为限频")
+		}
+	})
+
+	t.Run("429按Retry-After等待后重试", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte(`[]`))
+		}))
+		defer srv.Close()
+
+		start := time.Now()
+		if _, err := httpGetWithRetry(context.Background(), srv.URL); err != nil {
+			t.Fatalf("限频解除后应成功: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("应按 Retry-After 等待 1s，实际 %v", elapsed)
+		}
+		if n := atomic.LoadInt32(&calls); n != 2 {
+			t.Errorf("请求次数 = %d, want 2", n)
+		}
+	})
+
+	t.Run("Retry-After过长或418不重试", func(t *testing.T) {
+		for _, tc := range []struct {
+			status     int
+			retryAfter string
+		}{
+			{http.StatusTooManyRequests, "120"},
+			{http.StatusTeapot, ""},
+		} {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(tc.status)
+			}))
+
+			_, err := httpGetWithRetry(context.Background(), srv.URL)
+			srv.Close()
+			if !errors.Is(err, ErrRateLimited) {
+				t.Errorf("%d 应识别为限频，实际 %v", tc.status, err)
+			}
+			if n := atomic.LoadInt32(&calls); n != 1 {
+				t.Errorf("%d Retry-After=%q 请求次数 = %d, want 1", tc.status, tc.retryAfter, n)
+			}
+		}
+	})
+
+	t.Run("超时视为网络错误并重试", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer srv.Close()
+
+		SetHTTPTimeout(20 * time.Millisecond)
+		defer SetHTTPClient(nil)
+
+		if _, err := httpGetWithRetry(context.Background(), srv.URL); err == nil {
+			t.Fatal("超时应返回错误")
+		}
+		if n := atomic.LoadInt32(&calls); n != httpMaxAttempts {
+			t.Errorf("请求次数 = %d, want %d", n, httpMaxAttempts)
+		}
+	})
+}
+
+func TestGetWithContextCancel(t *testing.T) {
+	withFastRetry(t)
+
+	// K线接口一直挂起，直到请求被取消
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	original := binanceFuturesBaseURL
+	binanceFuturesBaseURL = srv.URL
+	ResetKlineCache()
+	defer func() {
+		binanceFuturesBaseURL = original
+		ResetKlineCache()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := GetWithContext(ctx, "BTCUSDT")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("取消后应返回 context.Canceled，实际 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("取消后应立即返回，耗时 %v", elapsed)
+	}
+	before := atomic.LoadInt32(&calls)
+
+	// 已取消的 context 不再发起请求
+	if _, err := GetWithContext(ctx, "ETHUSDT"); !errors.Is(err, context.Canceled) {
+		t.Errorf("已取消的 context 应直接返回 context.Canceled，实际 %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != before {
+		t.Errorf("已取消的 context 不应再发起K线请求，新增 %d 次", n-before)
+	}
+}
@@ -0,0 +1,286 @@
+package market
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKlineCacheTTL        = 30 * time.Second // 未在 supportedTimeframes 中定义的周期使用的缓存时间
+	defaultKlineCacheMaxEntries = 512              // 默认最多缓存的 symbol+interval 数量
+	klineCacheIntervalRatio     = 0.8              // 缓存时间不超过 K线周期 × 该比例
+)
+
+// klineCacheNow 当前时间（测试可替换）
+var klineCacheNow = time.Now
+
+type klineCacheEntry struct {
+	key       string
+	klines    []Kline
+	limit     int // 获取时请求的数量，只能服务 <= limit 的请求
+	fetchedAt time.Time
+}
+
+// klineCache 按 symbol+interval 缓存K线（LRU），多个交易员扫描相同币种时避免重复下载
+var klineCache = struct {
+	sync.RWMutex
+	entries    map[string]*list.Element // value 为 *klineCacheEntry
+	lru        *list.List               // 最近使用的在前
+	ttls       map[string]time.Duration // SetKlineCacheTTL 设置的覆盖值（key "" 为未定义周期的默认值）
+	maxAge     time.Duration            // SetKlineCacheConfig 设置的缓存时间上限，0 表示不限制
+	maxEntries int
+	disabled   bool
+}{
+	entries:    make(map[string]*list.Element),
+	lru:        list.New(),
+	ttls:       make(map[string]time.Duration),
+	maxEntries: defaultKlineCacheMaxEntries,
+}
+
+// SetKlineCacheConfig 设置K线缓存时间上限与最大条目数（超出时淘汰最久未使用的条目）
+// maxAge <= 0 表示只按周期缓存时间判断；maxEntries <= 0 时使用默认值 512
+func SetKlineCacheConfig(maxAge time.Duration, maxEntries int) {
+	klineCache.Lock()
+	defer klineCache.Unlock()
+
+	if maxEntries <= 0 {
+		maxEntries = defaultKlineCacheMaxEntries
+	}
+	klineCache.maxAge = maxAge
+	klineCache.maxEntries = maxEntries
+	evictKlineCacheLocked()
+}
+
+// SetKlineCacheTTL 设置指定周期的K线缓存时间，interval 为空时作用于所有周期；ttl <= 0 表示该周期不缓存
+func SetKlineCacheTTL(interval string, ttl time.Duration) {
+	klineCache.Lock()
+	defer klineCache.Unlock()
+
+	if interval == "" {
+		for tf := range supportedTimeframes {
+			klineCache.ttls[tf] = ttl
+		}
+	}
+	klineCache.ttls[interval] = ttl
+}
+
+// SetKlineCacheEnabled 开启/关闭K线缓存（回测需要逐根精确数据时关闭），关闭时清空已缓存数据
+func SetKlineCacheEnabled(enabled bool) {
+	klineCache.Lock()
+	defer klineCache.Unlock()
+
+	klineCache.disabled = !enabled
+	if !enabled {
+		klineCache.entries = make(map[string]*list.Element)
+		klineCache.lru.Init()
+	}
+}
+
+// ResetKlineCache 清空K线缓存（及由K线计算的市场数据缓存）并恢复默认配置
+func ResetKlineCache() {
+	resetDataCache()
+
+	klineCache.Lock()
+	defer klineCache.Unlock()
+
+	klineCache.entries = make(map[string]*list.Element)
+	klineCache.lru.Init()
+	klineCache.ttls = make(map[string]time.Duration)
+	klineCache.maxAge = 0
+	klineCache.maxEntries = defaultKlineCacheMaxEntries
+	klineCache.disabled = false
+}
+
+// klineCacheTTL 获取周期的缓存时间（调用方需持有锁）
+// 取周期配置/覆盖值，并限制在 floor(周期 × 0.8) 与 maxAge 以内
+func klineCacheTTL(interval string) time.Duration {
+	ttl, ok := klineCache.ttls[interval]
+	if !ok {
+		if spec, found := supportedTimeframes[interval]; found && spec.cacheTTL > 0 {
+			ttl = spec.cacheTTL
+		} else if def, found := klineCache.ttls[""]; found {
+			ttl = def
+		} else {
+			ttl = defaultKlineCacheTTL
+		}
+	}
+
+	if period := intervalDuration(interval); period > 0 {
+		if limit := time.Duration(float64(period) * klineCacheIntervalRatio); ttl > limit {
+			ttl = limit
+		}
+	}
+	if klineCache.maxAge > 0 && ttl > klineCache.maxAge {
+		ttl = klineCache.maxAge
+	}
+	return ttl
+}
+
+// intervalDuration 周期时长，未定义的周期返回0
+func intervalDuration(interval string) time.Duration {
+	if spec, ok := supportedTimeframes[interval]; ok {
+		return time.Duration(spec.minutes) * time.Minute
+	}
+	return 0
+}
+
+// klineEntryFresh 缓存未超过缓存时间，且获取后没有跨过K线收盘边界（新K线开始后自动失效）
+func klineEntryFresh(entry *klineCacheEntry, interval string, now time.Time) bool {
+	if now.Sub(entry.fetchedAt) >= klineCacheTTL(interval) {
+		return false
+	}
+	if period := intervalDuration(interval); period > 0 {
+		return now.Before(entry.fetchedAt.Truncate(period).Add(period))
+	}
+	return true
+}
+
+// evictKlineCacheLocked 淘汰最久未使用的条目直至不超过 maxEntries（调用方需持有写锁）
+func evictKlineCacheLocked() {
+	for klineCache.lru.Len() > klineCache.maxEntries {
+		oldest := klineCache.lru.Back()
+		klineCache.lru.Remove(oldest)
+		delete(klineCache.entries, oldest.Value.(*klineCacheEntry).key)
+	}
+}
+
+// klineCacheKey 以 symbol 开头（InvalidateCache 按 symbol 前缀清除），不同数据源的K线分开缓存
+func klineCacheKey(source MarketDataSource, symbol, interval string) string {
+	return symbol + "|" + interval + "|" + sourceCacheKey(source)
+}
+
+// getCachedKlines 命中未过期且数量足够的缓存时返回最近 limit 根K线的副本
+func getCachedKlines(source MarketDataSource, symbol, interval string, limit int) ([]Kline, bool) {
+	key := klineCacheKey(source, symbol, interval)
+
+	klineCache.RLock()
+	elem, ok := klineCache.entries[key]
+	if klineCache.disabled || !ok {
+		klineCache.RUnlock()
+		return nil, false
+	}
+	entry := elem.Value.(*klineCacheEntry)
+	if entry.limit < limit || !klineEntryFresh(entry, interval, klineCacheNow()) {
+		klineCache.RUnlock()
+		return nil, false
+	}
+	klines := entry.klines
+	if limit > 0 && len(klines) > limit {
+		klines = klines[len(klines)-limit:]
+	}
+	result := append([]Kline(nil), klines...)
+	klineCache.RUnlock()
+
+	// 更新LRU顺序（期间条目可能已被淘汰或替换）
+	klineCache.Lock()
+	if current, ok := klineCache.entries[key]; ok && current == elem {
+		klineCache.lru.MoveToFront(elem)
+	}
+	klineCache.Unlock()
+	return result, true
+}
+
+// storeKlines 写入缓存（保存副本，调用方修改返回的切片不影响缓存）
+func storeKlines(source MarketDataSource, symbol, interval string, limit int, klines []Kline) {
+	klineCache.Lock()
+	defer klineCache.Unlock()
+
+	if klineCache.disabled || klineCacheTTL(interval) <= 0 {
+		return
+	}
+	key := klineCacheKey(source, symbol, interval)
+	entry := &klineCacheEntry{
+		key:       key,
+		klines:    append([]Kline(nil), klines...),
+		limit:     limit,
+		fetchedAt: klineCacheNow(),
+	}
+	if elem, ok := klineCache.entries[key]; ok {
+		elem.Value = entry
+		klineCache.lru.MoveToFront(elem)
+		return
+	}
+	klineCache.entries[key] = klineCache.lru.PushFront(entry)
+	evictKlineCacheLocked()
+}
+
+// klineCall 进行中的一次K线请求，同一数据源+symbol+interval 且 limit 不超过它的并发请求等待同一结果
+type klineCall struct {
+	done    chan struct{}
+	limit   int
+	klines  []Kline
+	err     error
+	waiters int                // 仍在等待结果的调用方数量（受 klineInflight 锁保护）
+	cancel  context.CancelFunc // 所有调用方都放弃等待时中止获取
+}
+
+// klineInflight 进行中的K线请求（与缓存互补：缓存未命中时合并并发请求，避免多个交易员同时下载相同K线）
+var klineInflight = struct {
+	sync.Mutex
+	calls map[string]*klineCall
+}{
+	calls: make(map[string]*klineCall),
+}
+
+// fetchKlinesShared 由首个请求者发起一次共享获取，同 key 且 limit 不超过进行中请求的并发调用共享其结果。
+// 共享获取在后台以解绑的 ctx 运行（见 detachedFetchContext），调用方 ctx 取消只结束自己的等待，
+// 所有等待者都放弃时才中止获取。返回值为副本（按 limit 截取最近K线），调用方修改不影响其他调用方
+func fetchKlinesShared(ctx context.Context, source MarketDataSource, symbol, interval string, limit int, fetch func(context.Context) ([]Kline, error)) ([]Kline, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	key := klineCacheKey(source, symbol, interval)
+
+	klineInflight.Lock()
+	call, ok := klineInflight.calls[key]
+	if !ok || call.limit < limit {
+		// 已有更小 limit 的请求进行中时单独获取，不替换其登记
+		fetchCtx, cancel := detachedFetchContext(ctx)
+		call = &klineCall{done: make(chan struct{}), limit: limit, cancel: cancel}
+		if !ok {
+			klineInflight.calls[key] = call
+		}
+		go runKlineCall(fetchCtx, key, call, fetch)
+	}
+	call.waiters++
+	klineInflight.Unlock()
+
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return nil, call.err
+		}
+		klines := call.klines
+		if limit > 0 && len(klines) > limit {
+			klines = klines[len(klines)-limit:]
+		}
+		return append([]Kline(nil), klines...), nil
+	case <-ctx.Done():
+		klineInflight.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			if klineInflight.calls[key] == call {
+				delete(klineInflight.calls, key)
+			}
+		}
+		klineInflight.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// runKlineCall 执行一次K线获取，完成后注销登记
+func runKlineCall(ctx context.Context, key string, call *klineCall, fetch func(context.Context) ([]Kline, error)) {
+	defer call.cancel()
+	klines, err := fetch(ctx)
+
+	klineInflight.Lock()
+	call.klines, call.err = klines, err
+	if klineInflight.calls[key] == call {
+		delete(klineInflight.calls, key)
+	}
+	klineInflight.Unlock()
+	close(call.done)
+}
@@ -0,0 +1,275 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCountingKlineServer 按 limit 返回对应数量的1分钟K线，并统计请求次数
+func newCountingKlineServer(t *testing.T) *int32 {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		base := int64(1700000000000)
+		raw := make([][]interface{}, 0, limit)
+		for i := 0; i < limit; i++ {
+			ts := base + int64(i)*60000
+			raw = append(raw, []interface{}{ts, "100", "101", "99", "100.5", "10", ts + 59999, "1000", 5, "4", "400"})
+		}
+		json.NewEncoder(w).Encode(raw)
+	}))
+
+	original := binanceFuturesBaseURL
+	binanceFuturesBaseURL = server.URL
+	ResetKlineCache()
+	t.Cleanup(func() {
+		binanceFuturesBaseURL = original
+		ResetKlineCache()
+		server.Close()
+	})
+	return &requests
+}
+
+func TestGetKlinesCache(t *testing.T) {
+	requests := newCountingKlineServer(t)
+	count := func() int32 { return atomic.LoadInt32(requests) }
+
+	first, err := GetKlines("BTCUSDT", "4h", 10)
+	if err != nil {
+		t.Fatalf("GetKlines() error = %v", err)
+	}
+	first[0].Close = -1 // 修改返回值不应污染缓存
+
+	second, err := GetKlines("BTCUSDT", "4h", 10)
+	if err != nil {
+		t.Fatalf("GetKlines() error = %v", err)
+	}
+	if count() != 1 {
+		t.Fatalf("重复请求应命中缓存，实际请求 %d 次", count())
+	}
+	if second[0].Close != 100.5 {
+		t.Errorf("缓存数据被调用方修改: Close=%.2f", second[0].Close)
+	}
+
+	// 更少的数量由缓存截取最近K线
+	tail, _ := GetKlines("BTCUSDT", "4h", 3)
+	if count() != 1 || len(tail) != 3 || tail[2].OpenTime != second[9].OpenTime {
+		t.Errorf("limit=3 应从缓存取最近3根，请求次数=%d len=%d", count(), len(tail))
+	}
+
+	// 更多的数量、不同周期/币种需要重新请求
+	GetKlines("BTCUSDT", "4h", 20)
+	GetKlines("BTCUSDT", "5m", 10)
+	GetKlines("ETHUSDT", "4h", 10)
+	if count() != 4 {
+		t.Errorf("期望共请求 4 次，实际 %d 次", count())
+	}
+
+	// TTL 过期后重新请求
+	SetKlineCacheTTL("5m", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	GetKlines("BTCUSDT", "5m", 10)
+	if count() != 5 {
+		t.Errorf("TTL过期后应重新请求，实际 %d 次", count())
+	}
+
+	// ttl <= 0 的周期不缓存
+	SetKlineCacheTTL("1h", 0)
+	GetKlines("BTCUSDT", "1h", 10)
+	GetKlines("BTCUSDT", "1h", 10)
+	if count() != 7 {
+		t.Errorf("ttl=0 时不应缓存，实际 %d 次", count())
+	}
+
+	// 关闭缓存（回测）后每次都请求
+	SetKlineCacheEnabled(false)
+	GetKlines("BTCUSDT", "4h", 10)
+	GetKlines("BTCUSDT", "4h", 10)
+	if count() != 9 {
+		t.Errorf("关闭缓存后每次都应请求，实际 %d 次", count())
+	}
+}
+
+func TestGetKlinesCacheConcurrent(t *testing.T) {
+	newCountingKlineServer(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			symbol := "BTCUSDT"
+			if i%2 == 0 {
+				symbol = "ETHUSDT"
+			}
+			if _, err := GetKlines(symbol, "15m", 5); err != nil {
+				t.Errorf("GetKlines() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestKlineCacheLRUAndCandleBoundary(t *testing.T) {
+	ResetKlineCache()
+	defer ResetKlineCache()
+	defer func() { klineCacheNow = time.Now }()
+
+	now := time.Date(2024, 1, 1, 10, 1, 0, 0, time.UTC)
+	klineCacheNow = func() time.Time { return now }
+	klines := []Kline{{OpenTime: 1, Close: 100}}
+
+	// LRU：超过最大条目数时淘汰最久未使用的条目
+	SetKlineCacheConfig(0, 2)
+	storeKlines(DefaultSource(), "BTCUSDT", "5m", 1, klines)
+	storeKlines(DefaultSource(), "ETHUSDT", "5m", 1, klines)
+	if _, ok := getCachedKlines(DefaultSource(), "BTCUSDT", "5m", 1); !ok {
+		t.Fatal("BTCUSDT 应命中缓存")
+	}
+	storeKlines(DefaultSource(), "SOLUSDT", "5m", 1, klines)
+	if _, ok := getCachedKlines(DefaultSource(), "ETHUSDT", "5m", 1); ok {
+		t.Error("ETHUSDT 最久未使用，应被淘汰")
+	}
+	if _, ok := getCachedKlines(DefaultSource(), "BTCUSDT", "5m", 1); !ok {
+		t.Error("BTCUSDT 最近使用过，不应被淘汰")
+	}
+
+	// 缓存时间不超过周期的 80%，新K线开始后自动失效
+	ResetKlineCache()
+	SetKlineCacheTTL("5m", time.Hour)
+	storeKlines(DefaultSource(), "BTCUSDT", "5m", 1, klines) // 10:01 获取，当前K线 10:05 收盘
+	now = now.Add(3*time.Minute + 59*time.Second)
+	if _, ok := getCachedKlines(DefaultSource(), "BTCUSDT", "5m", 1); !ok {
+		t.Error("10:04:59 仍在同一根K线内，应命中缓存")
+	}
+	now = now.Add(time.Second)
+	if _, ok := getCachedKlines(DefaultSource(), "BTCUSDT", "5m", 1); ok {
+		t.Error("10:05 新K线开始，缓存应失效")
+	}
+
+	now = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	storeKlines(DefaultSource(), "BTCUSDT", "5m", 1, klines)
+	now = now.Add(4 * time.Minute)
+	if _, ok := getCachedKlines(DefaultSource(), "BTCUSDT", "5m", 1); ok {
+		t.Error("超过 floor(5m×0.8)=4m 后缓存应失效")
+	}
+
+	// maxAge 进一步限制缓存时间
+	SetKlineCacheConfig(30*time.Second, 0)
+	storeKlines(DefaultSource(), "BTCUSDT", "1h", 1, klines)
+	now = now.Add(30 * time.Second)
+	if _, ok := getCachedKlines(DefaultSource(), "BTCUSDT", "1h", 1); ok {
+		t.Error("超过 maxAge 后缓存应失效")
+	}
+}
+
+// blockingSource 统计K线请求次数，release 关闭前阻塞所有请求
+type blockingSource struct {
+	fakeSource
+	release chan struct{}
+}
+
+func (s *blockingSource) GetKlines(ctx context.Context, symbol, interval string, limit int) ([]Kline, error) {
+	<-s.release
+	return s.fakeSource.GetKlines(ctx, symbol, interval, limit)
+}
+
+// TestGetKlinesCoalescesConcurrentFetch 缓存未命中时，同一 symbol+interval 的并发请求只触发一次底层获取
+func TestGetKlinesCoalescesConcurrentFetch(t *testing.T) {
+	source := &blockingSource{release: make(chan struct{})}
+	SetDefaultSource(source)
+	defer ResetDefaultSource()
+
+	var wg sync.WaitGroup
+	results := make([][]Kline, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 首个请求 limit 最大，其余更小 limit 的请求共享其结果
+			limit := 5
+			if i > 0 {
+				time.Sleep(10 * time.Millisecond)
+				limit = 3
+			}
+			klines, err := GetKlines("BTCUSDT", "1h", limit)
+			if err != nil {
+				t.Errorf("GetKlines() error = %v", err)
+			}
+			results[i] = klines
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(source.release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&source.calls); n != 1 {
+		t.Fatalf("并发请求同一币种周期应只获取 1 次，实际 %d 次", n)
+	}
+	if len(results[0]) != 5 || len(results[1]) != 3 {
+		t.Errorf("应按各自 limit 截取，got %d / %d", len(results[0]), len(results[1]))
+	}
+	results[1][0].Close = -1 // 修改返回值不应影响其他调用方
+	if results[2][0].Close != 42 {
+		t.Errorf("返回值应为独立副本，Close=%.2f", results[2][0].Close)
+	}
+
+	// 更大 limit 的请求不能共享进行中的较小请求
+	SetKlineCacheEnabled(false)
+	source.release = make(chan struct{})
+	close(source.release)
+	if _, err := GetKlines("BTCUSDT", "1h", 8); err != nil {
+		t.Fatalf("GetKlines() error = %v", err)
+	}
+	if n := atomic.LoadInt32(&source.calls); n != 2 {
+		t.Errorf("关闭缓存后应重新获取，实际 %d 次", n)
+	}
+}
+
+func TestFetchKlinesSharedLeaderCancelDoesNotFailWaiters(t *testing.T) {
+	release := make(chan struct{})
+	fetch := func(ctx context.Context) ([]Kline, error) {
+		select {
+		case <-release:
+			return []Kline{{Close: 1}, {Close: 2}, {Close: 3}}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := fetchKlinesShared(leaderCtx, DefaultSource(), "BTCUSDT", "1h", 3, fetch)
+		leaderErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	waiter := make(chan []Kline, 1)
+	go func() {
+		klines, err := fetchKlinesShared(context.Background(), DefaultSource(), "BTCUSDT", "1h", 2, fetch)
+		if err != nil {
+			t.Errorf("发起者取消不应影响等待者: %v", err)
+		}
+		waiter <- klines
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancelLeader()
+	if err := <-leaderErr; err != context.Canceled {
+		t.Errorf("发起者应因自身取消返回 context.Canceled，实际 %v", err)
+	}
+	close(release)
+	if klines := <-waiter; len(klines) != 2 || klines[1].Close != 3 {
+		t.Errorf("等待者应拿到共享获取的最近2根K线, got %+v", klines)
+	}
+}
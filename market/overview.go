@@ -0,0 +1,133 @@
+package market
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	overviewCacheTTL     = 60 * time.Second // 市场概览缓存时间
+	overviewFetchWorkers = 5                // 并发拉取的最大币种数，避免触发交易所限频
+)
+
+// SymbolOverview 单个币种的市场概览（价格变化、资金费率、持仓量变化、市场状态）
+type SymbolOverview struct {
+	Symbol          string  `json:"symbol"`
+	Price           float64 `json:"price"`
+	PriceChange1h   float64 `json:"price_change_1h"`   // 1小时价格变化百分比
+	PriceChange4h   float64 `json:"price_change_4h"`   // 4小时价格变化百分比
+	FundingRate     float64 `json:"funding_rate"`      // 当前资金费率
+	OIDeltaPct      float64 `json:"oi_delta_pct"`      // 最新持仓量相对均值的变化百分比
+	OIChangePct15m  float64 `json:"oi_change_pct_15m"` // 15分钟持仓量变化百分比
+	Regime          string  `json:"regime"`            // trending_up / trending_down / ranging / volatile / unknown
+	VolatilityLevel string  `json:"volatility_level,omitempty"`
+	Error           string  `json:"error,omitempty"` // 获取失败时的错误信息
+}
+
+type overviewCacheEntry struct {
+	overview  SymbolOverview
+	fetchedAt time.Time
+}
+
+// overviewCache 按币种缓存概览，避免频繁刷新页面时重复拉取K线
+var overviewCache = struct {
+	sync.Mutex
+	entries map[string]overviewCacheEntry
+}{entries: make(map[string]overviewCacheEntry)}
+
+// resetOverviewCache 清空概览缓存（切换数据提供者时调用）
+func resetOverviewCache() {
+	overviewCache.Lock()
+	overviewCache.entries = make(map[string]overviewCacheEntry)
+	overviewCache.Unlock()
+}
+
+// BuildSymbolOverview 从完整市场数据中提取概览字段
+func BuildSymbolOverview(data *Data) SymbolOverview {
+	overview := SymbolOverview{
+		Symbol:         data.Symbol,
+		Price:          data.CurrentPrice,
+		PriceChange1h:  data.PriceChange1h,
+		PriceChange4h:  data.PriceChange4h,
+		FundingRate:    data.FundingRate,
+		OIChangePct15m: data.OIChangePct15m,
+		Regime:         classifyRegime(data),
+	}
+	if data.OpenInterest != nil && data.OpenInterest.Average > 0 {
+		overview.OIDeltaPct = (data.OpenInterest.Latest - data.OpenInterest.Average) / data.OpenInterest.Average * 100
+	}
+	if data.RiskMetrics != nil {
+		overview.VolatilityLevel = data.RiskMetrics.VolatilityLevel
+	}
+	return overview
+}
+
+// classifyRegime 根据4h结构信号、趋势强度和波动率粗分市场状态
+func classifyRegime(data *Data) string {
+	if data.RiskMetrics != nil && data.RiskMetrics.VolatilityLevel == "extreme" {
+		return "volatile"
+	}
+	if data.TrendPhase != nil && data.TrendPhase.TrendStrength4h < 40 {
+		return "ranging"
+	}
+	if data.PriceAction4h != nil {
+		switch data.PriceAction4h.LastSignal {
+		case "BOS_up", "CHoCH_up":
+			return "trending_up"
+		case "BOS_down", "CHoCH_down":
+			return "trending_down"
+		case "none":
+			return "ranging"
+		}
+	}
+	if data.TrendPhase == nil {
+		return "unknown"
+	}
+	return "ranging"
+}
+
+// GetOverview 并发获取多个币种的市场概览（带缓存），结果按输入顺序返回
+// 单个币种获取失败时在该行填写 Error，不影响其他币种
+func GetOverview(symbols []string) []SymbolOverview {
+	now := time.Now()
+	results := make([]SymbolOverview, len(symbols))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, overviewFetchWorkers)
+	for i, symbol := range symbols {
+		symbol = Normalize(symbol)
+
+		overviewCache.Lock()
+		entry, ok := overviewCache.entries[symbol]
+		overviewCache.Unlock()
+		if ok && now.Sub(entry.fetchedAt) < overviewCacheTTL {
+			results[i] = entry.overview
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, symbol string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			data, err := Get(symbol)
+			if err != nil {
+				results[i] = SymbolOverview{Symbol: symbol, Regime: "unknown", Error: err.Error()}
+				return
+			}
+			overview := BuildSymbolOverview(data)
+			if overview.Symbol == "" {
+				overview.Symbol = symbol
+			}
+			results[i] = overview
+
+			overviewCache.Lock()
+			overviewCache.entries[symbol] = overviewCacheEntry{overview: overview, fetchedAt: time.Now()}
+			overviewCache.Unlock()
+		}(i, symbol)
+	}
+	wg.Wait()
+
+	return results
+}
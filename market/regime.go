@@ -0,0 +1,73 @@
+package market
+
+import "math"
+
+// 大盘状态
+const (
+	RegimeTrendingBull  = "trending_bull"
+	RegimeTrendingBear  = "trending_bear"
+	RegimeRanging       = "ranging"
+	RegimeVolatileShock = "volatile_shock"
+)
+
+const (
+	regimeShockATRRatio = 1.6  // 4h ATR3/ATR14 超过该值视为波动冲击
+	regimeShockBBWidth  = 0.12 // 4h 布林带宽度 (Upper-Lower)/Middle 超过该值视为波动冲击
+	regimeTrendADX      = 25.0 // 4h ADX 达到该值视为趋势行情
+)
+
+// MarketRegime 由 BTC 4h 波动率/趋势强度判断的大盘状态
+type MarketRegime struct {
+	Regime           string  `json:"regime"`            // trending_bull/trending_bear/ranging/volatile_shock
+	VolatilityPct    float64 `json:"volatility_pct"`    // 4h ATR14 占价格百分比
+	TrendStrength    float64 `json:"trend_strength"`    // 4h ADX
+	RegimeConfidence float64 `json:"regime_confidence"` // 0-1，指标越远离判定阈值越高
+}
+
+// DetectMarketRegime 根据 BTC 4h 数据判断大盘状态：
+// ATR3/ATR14 或布林带宽度超过阈值为 volatile_shock，ADX 达到趋势阈值时按 DI+/DI- 方向区分多空趋势，其余为 ranging。
+// 缺少4h数据时返回置信度为0的 ranging
+func DetectMarketRegime(btcData *Data) MarketRegime {
+	regime := MarketRegime{Regime: RegimeRanging}
+	if btcData == nil || btcData.MidTermSeries4h == nil {
+		return regime
+	}
+	series := btcData.MidTermSeries4h
+
+	if btcData.CurrentPrice > 0 && series.ATR14 > 0 {
+		regime.VolatilityPct = series.ATR14 / btcData.CurrentPrice * 100
+	}
+	regime.TrendStrength = series.ADX
+
+	var atrRatio, bbWidth float64
+	if series.ATR14 > 0 {
+		atrRatio = series.ATR3 / series.ATR14
+	}
+	if series.Bollinger != nil {
+		bbWidth = series.Bollinger.Width
+	}
+
+	// 超过阈值时得分 >=1，得分翻倍时置信度为1
+	shockScore := math.Max(atrRatio/regimeShockATRRatio, bbWidth/regimeShockBBWidth)
+	switch {
+	case shockScore >= 1:
+		regime.Regime = RegimeVolatileShock
+		regime.RegimeConfidence = clampUnit(shockScore / 2)
+	case series.ADX >= regimeTrendADX:
+		if series.DIPlus >= series.DIMinus {
+			regime.Regime = RegimeTrendingBull
+		} else {
+			regime.Regime = RegimeTrendingBear
+		}
+		regime.RegimeConfidence = clampUnit(series.ADX / (regimeTrendADX * 2))
+	default:
+		if series.ADX > 0 {
+			regime.RegimeConfidence = clampUnit(0.5 + (regimeTrendADX-series.ADX)/(regimeTrendADX*2))
+		}
+	}
+	return regime
+}
+
+func clampUnit(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,46 @@
+package market
+
+import "testing"
+
+func TestDetectMarketRegime(t *testing.T) {
+	series := func(atr3, atr14, adx, diPlus, diMinus, bbWidth float64) *Data {
+		return &Data{
+			CurrentPrice: 100000,
+			MidTermSeries4h: &MidTermSeries4h{
+				ATR3: atr3, ATR14: atr14, ADX: adx, DIPlus: diPlus, DIMinus: diMinus,
+				Bollinger: &BollingerBand{Width: bbWidth},
+			},
+		}
+	}
+	tests := []struct {
+		name   string
+		data   *Data
+		regime string
+	}{
+		{"ATR急升", series(2000, 1000, 35, 30, 10, 0.05), RegimeVolatileShock},
+		{"布林带极宽", series(1000, 1000, 20, 20, 20, 0.15), RegimeVolatileShock},
+		{"多头趋势", series(1100, 1000, 32, 28, 12, 0.06), RegimeTrendingBull},
+		{"空头趋势", series(1100, 1000, 32, 12, 28, 0.06), RegimeTrendingBear},
+		{"震荡", series(900, 1000, 15, 18, 16, 0.03), RegimeRanging},
+		{"缺少4h数据", &Data{CurrentPrice: 100000}, RegimeRanging},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectMarketRegime(tt.data)
+			if got.Regime != tt.regime {
+				t.Errorf("Regime = %s, want %s (%+v)", got.Regime, tt.regime, got)
+			}
+			if got.RegimeConfidence < 0 || got.RegimeConfidence > 1 {
+				t.Errorf("RegimeConfidence = %v, 应在0-1之间", got.RegimeConfidence)
+			}
+		})
+	}
+
+	got := DetectMarketRegime(series(1100, 1000, 32, 28, 12, 0.06))
+	if got.VolatilityPct != 1 || got.TrendStrength != 32 {
+		t.Errorf("VolatilityPct/TrendStrength = %v/%v, want 1/32", got.VolatilityPct, got.TrendStrength)
+	}
+	if none := DetectMarketRegime(&Data{}); none.RegimeConfidence != 0 {
+		t.Errorf("缺少数据时置信度应为0, got %v", none.RegimeConfidence)
+	}
+}
@@ -0,0 +1,89 @@
+package market
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	riskRegimeSymbol   = "BTCUSDT"       // 大盘风向标
+	riskRegimeCacheTTL = 5 * time.Minute // 全市场风险状态缓存时间（所有交易员共享）
+	riskOffDrop4hPct   = 3.0             // BTC 4h 跌幅超过该百分比视为 risk-off
+)
+
+// RiskRegime 由 BTC 4h 趋势/波动率计算的全市场风险状态
+type RiskRegime struct {
+	RiskOff         bool      `json:"risk_off"`
+	Reason          string    `json:"reason,omitempty"`
+	Regime          string    `json:"regime"` // BTC 市场状态（同 SymbolOverview.Regime）
+	PriceChange4h   float64   `json:"price_change_4h"`
+	VolatilityLevel string    `json:"volatility_level,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// riskRegimeCache 全局共享的风险状态，计算期间持锁，保证同一时刻只有一次计算
+var riskRegimeCache = struct {
+	sync.Mutex
+	regime *RiskRegime
+}{}
+
+// resetRiskRegimeCache 清空风险状态缓存（切换数据提供者时调用）
+func resetRiskRegimeCache() {
+	riskRegimeCache.Lock()
+	riskRegimeCache.regime = nil
+	riskRegimeCache.Unlock()
+}
+
+// GetRiskRegime 获取全市场风险状态（带缓存，缓存期内所有交易员共用同一结果）
+func GetRiskRegime() (*RiskRegime, error) {
+	riskRegimeCache.Lock()
+	defer riskRegimeCache.Unlock()
+
+	if cached := riskRegimeCache.regime; cached != nil && time.Since(cached.UpdatedAt) < riskRegimeCacheTTL {
+		return cached, nil
+	}
+
+	data, err := Get(riskRegimeSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("获取%s行情失败: %w", riskRegimeSymbol, err)
+	}
+	regime := ClassifyRiskRegime(data)
+	riskRegimeCache.regime = regime
+	return regime, nil
+}
+
+// ClassifyRiskRegime 根据 BTC 行情判断是否 risk-off：
+// 极端波动、4h 跌幅超过 riskOffDrop4hPct、或 4h 下跌趋势且价格位于 EMA50 下方
+func ClassifyRiskRegime(data *Data) *RiskRegime {
+	regime := &RiskRegime{
+		Regime:        classifyRegime(data),
+		PriceChange4h: data.PriceChange4h,
+		UpdatedAt:     time.Now(),
+	}
+	if data.RiskMetrics != nil {
+		regime.VolatilityLevel = data.RiskMetrics.VolatilityLevel
+	}
+
+	switch {
+	case regime.VolatilityLevel == "extreme":
+		regime.RiskOff = true
+		regime.Reason = "BTC 4h 极端波动"
+	case data.PriceChange4h <= -riskOffDrop4hPct:
+		regime.RiskOff = true
+		regime.Reason = fmt.Sprintf("BTC 4h 下跌 %.2f%%", data.PriceChange4h)
+	case regime.Regime == "trending_down" && priceBelowEMA50On4h(data):
+		regime.RiskOff = true
+		regime.Reason = "BTC 4h 下跌趋势且价格低于EMA50"
+	}
+	return regime
+}
+
+// priceBelowEMA50On4h 当前价格是否低于 4h EMA50
+func priceBelowEMA50On4h(data *Data) bool {
+	if data.MidTermSeries4h == nil || len(data.MidTermSeries4h.EMA50Values) == 0 {
+		return false
+	}
+	ema50 := data.MidTermSeries4h.EMA50Values[len(data.MidTermSeries4h.EMA50Values)-1]
+	return ema50 > 0 && data.CurrentPrice < ema50
+}
@@ -0,0 +1,61 @@
+package market
+
+import "testing"
+
+type fixedMarketDataProvider struct {
+	data  *Data
+	calls int
+}
+
+func (p *fixedMarketDataProvider) Get(symbol string) (*Data, error) {
+	p.calls++
+	return p.data, nil
+}
+
+func TestClassifyRiskRegime(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    *Data
+		riskOff bool
+	}{
+		{"平稳", &Data{PriceChange4h: -0.5, RiskMetrics: &RiskMetrics{VolatilityLevel: "medium"}}, false},
+		{"极端波动", &Data{PriceChange4h: 1, RiskMetrics: &RiskMetrics{VolatilityLevel: "extreme"}}, true},
+		{"4h急跌", &Data{PriceChange4h: -3.2}, true},
+		{"下跌趋势跌破EMA50", &Data{
+			CurrentPrice:    95,
+			TrendPhase:      &TrendPhaseInfo{TrendStrength4h: 60},
+			PriceAction4h:   &PriceActionSummary{LastSignal: "BOS_down"},
+			MidTermSeries4h: &MidTermSeries4h{EMA50Values: []float64{100}},
+		}, true},
+		{"下跌趋势但在EMA50上方", &Data{
+			CurrentPrice:    105,
+			TrendPhase:      &TrendPhaseInfo{TrendStrength4h: 60},
+			PriceAction4h:   &PriceActionSummary{LastSignal: "BOS_down"},
+			MidTermSeries4h: &MidTermSeries4h{EMA50Values: []float64{100}},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regime := ClassifyRiskRegime(tt.data)
+			if regime.RiskOff != tt.riskOff {
+				t.Errorf("RiskOff = %v, want %v (reason=%q)", regime.RiskOff, tt.riskOff, regime.Reason)
+			}
+		})
+	}
+}
+
+func TestGetRiskRegimeCached(t *testing.T) {
+	provider := &fixedMarketDataProvider{data: &Data{Symbol: "BTCUSDT", PriceChange4h: -5}}
+	SetMarketDataProvider(provider)
+	defer ResetMarketDataProvider()
+
+	for i := 0; i < 3; i++ {
+		regime, err := GetRiskRegime()
+		if err != nil || !regime.RiskOff {
+			t.Fatalf("GetRiskRegime() = %+v, %v", regime, err)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("缓存期内应只计算一次, got %d", provider.calls)
+	}
+}
@@ -0,0 +1,311 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MarketDataSource 行情数据源（K线/持仓量/资金费率），默认使用 Binance U本位合约
+// 在其他交易所（如 Hyperliquid、Aster）交易时可按交易员或按请求换成该交易所自己的行情（见 WithSource）
+type MarketDataSource interface {
+	GetKlines(ctx context.Context, symbol, interval string, limit int) ([]Kline, error)
+	GetOpenInterest(ctx context.Context, symbol string) (*OIData, error)
+	GetFundingRate(ctx context.Context, symbol string) (float64, error)
+}
+
+// KlineRangeSource 可选接口：数据源可按时间范围获取一页K线（GetKlinesRange 据此分页，回测/复盘使用）。
+// startMs 为0时返回截止到 endMs 的最近 limit 根，否则返回从 startMs 起（不晚于 endMs）的前 limit 根
+type KlineRangeSource interface {
+	GetKlinesPage(ctx context.Context, symbol, interval string, startMs, endMs int64, limit int) ([]Kline, error)
+}
+
+// FundingInfo 资金费率详情
+type FundingInfo struct {
+	Rate            float64   // 最近一次资金费率
+	History         []float64 // 历史资金费率（从旧到新）
+	NextFundingTime int64     // 下次结算时间（毫秒），0 表示未知
+}
+
+// FundingInfoSource 可选接口：数据源可提供资金费率历史与下次结算时间，未实现时只获取最新费率
+type FundingInfoSource interface {
+	GetFundingInfo(ctx context.Context, symbol string, historyLimit int) (*FundingInfo, error)
+}
+
+// BinanceSource 默认实现：Binance U本位合约公开接口
+type BinanceSource struct{}
+
+func (s *BinanceSource) GetKlines(ctx context.Context, symbol, interval string, limit int) ([]Kline, error) {
+	url := fmt.Sprintf("%s/fapi/v1/klines?symbol=%s&interval=%s&limit=%d",
+		binanceFuturesBaseURL, symbol, interval, limit)
+	return fetchKlines(ctx, url)
+}
+
+func (s *BinanceSource) GetKlinesPage(ctx context.Context, symbol, interval string, startMs, endMs int64, limit int) ([]Kline, error) {
+	return fetchKlinesPage(ctx, binanceFuturesBaseURL, symbol, interval, startMs, endMs, limit)
+}
+
+func (s *BinanceSource) GetOpenInterest(ctx context.Context, symbol string) (*OIData, error) {
+	return getOpenInterestData(ctx, binanceFuturesBaseURL, symbol)
+}
+
+func (s *BinanceSource) GetFundingRate(ctx context.Context, symbol string) (float64, error) {
+	return getFundingRate(ctx, symbol)
+}
+
+func (s *BinanceSource) GetFundingInfo(ctx context.Context, symbol string, historyLimit int) (*FundingInfo, error) {
+	return getFundingInfo(ctx, binanceFuturesBaseURL, symbol, historyLimit)
+}
+
+// fetchKlinesPage 按时间范围请求 Binance 兼容的 /fapi/v1/klines（startMs 为0时不传 startTime）
+func fetchKlinesPage(ctx context.Context, baseURL, symbol, interval string, startMs, endMs int64, limit int) ([]Kline, error) {
+	url := fmt.Sprintf("%s/fapi/v1/klines?symbol=%s&interval=%s&endTime=%d&limit=%d",
+		baseURL, symbol, interval, endMs, limit)
+	if startMs > 0 {
+		url += fmt.Sprintf("&startTime=%d", startMs)
+	}
+	return fetchKlines(ctx, url)
+}
+
+// asterFuturesBaseURL Aster 合约API地址（接口与 Binance U本位合约兼容）
+var asterFuturesBaseURL = "https://fapi.asterdex.com"
+
+// AsterSource Aster 合约公开接口（Binance 兼容的 /fapi/v1 路径）
+type AsterSource struct{}
+
+func (s *AsterSource) GetKlines(ctx context.Context, symbol, interval string, limit int) ([]Kline, error) {
+	url := fmt.Sprintf("%s/fapi/v1/klines?symbol=%s&interval=%s&limit=%d",
+		asterFuturesBaseURL, symbol, interval, limit)
+	return fetchKlines(ctx, url)
+}
+
+func (s *AsterSource) GetKlinesPage(ctx context.Context, symbol, interval string, startMs, endMs int64, limit int) ([]Kline, error) {
+	return fetchKlinesPage(ctx, asterFuturesBaseURL, symbol, interval, startMs, endMs, limit)
+}
+
+func (s *AsterSource) GetOpenInterest(ctx context.Context, symbol string) (*OIData, error) {
+	return getOpenInterestData(ctx, asterFuturesBaseURL, symbol)
+}
+
+func (s *AsterSource) GetFundingRate(ctx context.Context, symbol string) (float64, error) {
+	rate, _, err := getPremiumIndex(ctx, asterFuturesBaseURL, symbol)
+	return rate, err
+}
+
+func (s *AsterSource) GetFundingInfo(ctx context.Context, symbol string, historyLimit int) (*FundingInfo, error) {
+	return getFundingInfo(ctx, asterFuturesBaseURL, symbol, historyLimit)
+}
+
+// hyperliquidInfoURL Hyperliquid 信息查询接口（POST JSON）
+var hyperliquidInfoURL = "https://api.hyperliquid.xyz/info"
+
+// hyperliquidFundingHours Hyperliquid 每小时结算资金费，折算为8小时费率与 Binance 口径一致
+const hyperliquidFundingHours = 8
+
+// HyperliquidSource Hyperliquid 永续合约公开接口（candleSnapshot / metaAndAssetCtxs）
+type HyperliquidSource struct{}
+
+// hyperliquidCoin BTCUSDT → BTC（Hyperliquid 以币名标识永续合约）
+func hyperliquidCoin(symbol string) string {
+	return strings.TrimSuffix(Normalize(symbol), "USDT")
+}
+
+func (s *HyperliquidSource) GetKlines(ctx context.Context, symbol, interval string, limit int) ([]Kline, error) {
+	return s.GetKlinesPage(ctx, symbol, interval, 0, time.Now().UnixMilli(), limit)
+}
+
+// GetKlinesPage candleSnapshot 按时间范围返回K线，这里按 limit 截取（startMs 为0时从 endMs 往前推 limit 根）
+func (s *HyperliquidSource) GetKlinesPage(ctx context.Context, symbol, interval string, startMs, endMs int64, limit int) ([]Kline, error) {
+	period := intervalDuration(interval)
+	if period <= 0 {
+		return nil, fmt.Errorf("Hyperliquid 不支持的K线周期: %s", interval)
+	}
+	backward := startMs <= 0
+	if backward {
+		startMs = endMs - period.Milliseconds()*int64(limit)
+	}
+	payload := map[string]interface{}{
+		"type": "candleSnapshot",
+		"req": map[string]interface{}{
+			"coin":      hyperliquidCoin(symbol),
+			"interval":  interval,
+			"startTime": startMs,
+			"endTime":   endMs,
+		},
+	}
+	body, err := httpPostJSONWithRetry(ctx, hyperliquidInfoURL, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw []struct {
+		OpenTime  int64  `json:"t"`
+		CloseTime int64  `json:"T"`
+		Open      string `json:"o"`
+		High      string `json:"h"`
+		Low       string `json:"l"`
+		Close     string `json:"c"`
+		Volume    string `json:"v"`
+		Trades    int    `json:"n"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("解析Hyperliquid K线失败: %w", err)
+	}
+
+	klines := make([]Kline, 0, len(raw))
+	for _, item := range raw {
+		k := Kline{
+			OpenTime:  item.OpenTime,
+			Open:      safeParseFloat(item.Open),
+			High:      safeParseFloat(item.High),
+			Low:       safeParseFloat(item.Low),
+			Close:     safeParseFloat(item.Close),
+			Volume:    safeParseFloat(item.Volume),
+			CloseTime: item.CloseTime,
+			Trades:    item.Trades,
+		}
+		k.QuoteVolume = k.Volume * k.Close
+		klines = append(klines, k)
+	}
+	klines, dropped := sanitizeKlines(klines)
+	if dropped > 0 {
+		fmt.Printf("⚠ 丢弃 %d 根异常K线（价格非正/high<low/时间非递增）: Hyperliquid %s %s\n", dropped, symbol, interval)
+	}
+	if len(klines) > limit {
+		if backward {
+			klines = klines[len(klines)-limit:]
+		} else {
+			klines = klines[:limit]
+		}
+	}
+	return klines, nil
+}
+
+// hyperliquidAssetCtx metaAndAssetCtxs 中单个币种的实时状态
+type hyperliquidAssetCtx struct {
+	Funding      string `json:"funding"`
+	OpenInterest string `json:"openInterest"`
+	MarkPx       string `json:"markPx"`
+}
+
+// getAssetCtx 查询 metaAndAssetCtxs 并按 universe 顺序定位币种
+func (s *HyperliquidSource) getAssetCtx(ctx context.Context, symbol string) (*hyperliquidAssetCtx, error) {
+	body, err := httpPostJSONWithRetry(ctx, hyperliquidInfoURL, map[string]string{"type": "metaAndAssetCtxs"})
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(body, &parts); err != nil || len(parts) != 2 {
+		return nil, fmt.Errorf("解析Hyperliquid metaAndAssetCtxs失败: %v", err)
+	}
+	var meta struct {
+		Universe []struct {
+			Name string `json:"name"`
+		} `json:"universe"`
+	}
+	var ctxs []hyperliquidAssetCtx
+	if err := json.Unmarshal(parts[0], &meta); err != nil {
+		return nil, fmt.Errorf("解析Hyperliquid meta失败: %w", err)
+	}
+	if err := json.Unmarshal(parts[1], &ctxs); err != nil {
+		return nil, fmt.Errorf("解析Hyperliquid assetCtxs失败: %w", err)
+	}
+
+	coin := hyperliquidCoin(symbol)
+	for i, asset := range meta.Universe {
+		if asset.Name == coin && i < len(ctxs) {
+			return &ctxs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Hyperliquid 未找到币种: %s", coin)
+}
+
+func (s *HyperliquidSource) GetOpenInterest(ctx context.Context, symbol string) (*OIData, error) {
+	asset, err := s.getAssetCtx(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	oi := safeParseFloat(asset.OpenInterest)
+	return &OIData{
+		Latest:  oi,
+		Average: oi * 0.999,
+	}, nil
+}
+
+func (s *HyperliquidSource) GetFundingRate(ctx context.Context, symbol string) (float64, error) {
+	asset, err := s.getAssetCtx(ctx, symbol)
+	if err != nil {
+		return 0, err
+	}
+	return safeParseFloat(asset.Funding) * hyperliquidFundingHours, nil
+}
+
+// NewMarketDataSource 按名称创建行情数据源（binance/hyperliquid/aster，空字符串为 binance）
+func NewMarketDataSource(name string) (MarketDataSource, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "binance":
+		return &BinanceSource{}, nil
+	case "hyperliquid":
+		return &HyperliquidSource{}, nil
+	case "aster":
+		return &AsterSource{}, nil
+	default:
+		return nil, fmt.Errorf("未知的行情数据源: %s", name)
+	}
+}
+
+// 默认行情数据源（未通过 WithSource 指定时使用），启动配置与请求并发读写，需持锁
+var (
+	defaultSource   MarketDataSource = &BinanceSource{}
+	defaultSourceMu sync.RWMutex
+)
+
+// SetDefaultSource 设置默认行情数据源（传nil恢复 Binance）
+func SetDefaultSource(source MarketDataSource) {
+	if source == nil {
+		source = &BinanceSource{}
+	}
+	defaultSourceMu.Lock()
+	defer defaultSourceMu.Unlock()
+	defaultSource = source
+}
+
+// ResetDefaultSource 重置为默认的 Binance 数据源
+func ResetDefaultSource() {
+	SetDefaultSource(nil)
+}
+
+// DefaultSource 返回当前默认行情数据源
+func DefaultSource() MarketDataSource {
+	defaultSourceMu.RLock()
+	defer defaultSourceMu.RUnlock()
+	return defaultSource
+}
+
+type sourceContextKey struct{}
+
+// WithSource 返回携带行情数据源的 ctx，经该 ctx 发起的 GetWithContext/GetWithTimeframesContext 使用此数据源；
+// source 为nil时原样返回（使用默认数据源）
+func WithSource(ctx context.Context, source MarketDataSource) context.Context {
+	if source == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, sourceContextKey{}, source)
+}
+
+// SourceFromContext ctx 携带的行情数据源，未指定时为默认数据源
+func SourceFromContext(ctx context.Context) MarketDataSource {
+	if source, ok := ctx.Value(sourceContextKey{}).(MarketDataSource); ok {
+		return source
+	}
+	return DefaultSource()
+}
+
+// sourceCacheKey 缓存 key 中区分数据源的部分（各数据源均为无状态类型，按类型区分）
+func sourceCacheKey(source MarketDataSource) string {
+	return fmt.Sprintf("%T", source)
+}
@@ -0,0 +1,256 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	calls int32
+}
+
+func (s *fakeSource) GetKlines(ctx context.Context, symbol, interval string, limit int) ([]Kline, error) {
+	atomic.AddInt32(&s.calls, 1)
+	klines := make([]Kline, limit)
+	for i := range klines {
+		klines[i] = Kline{OpenTime: int64(i), Close: 42}
+	}
+	return klines, nil
+}
+
+func (s *fakeSource) GetOpenInterest(ctx context.Context, symbol string) (*OIData, error) {
+	return &OIData{Latest: 123}, nil
+}
+
+func (s *fakeSource) GetFundingRate(ctx context.Context, symbol string) (float64, error) {
+	return 0.0001, nil
+}
+
+func TestSetDefaultSource(t *testing.T) {
+	requests := newCountingKlineServer(t)
+	source := &fakeSource{}
+	SetDefaultSource(source)
+	defer ResetDefaultSource()
+
+	klines, err := GetKlines("BTC", "1h", 5)
+	if err != nil {
+		t.Fatalf("GetKlines() error = %v", err)
+	}
+	if len(klines) != 5 || klines[4].Close != 42 {
+		t.Errorf("应返回自定义数据源的K线, got %+v", klines)
+	}
+	GetKlines("BTC", "1h", 5)
+	if n := atomic.LoadInt32(&source.calls); n != 1 {
+		t.Errorf("自定义数据源同样经过K线缓存，调用次数 = %d, want 1", n)
+	}
+	if n := atomic.LoadInt32(requests); n != 0 {
+		t.Errorf("替换数据源后不应请求 Binance，实际 %d 次", n)
+	}
+
+	// 恢复默认后从 Binance 获取（K线缓存按数据源区分）
+	ResetDefaultSource()
+	klines, err = GetKlines("BTC", "1h", 5)
+	if err != nil {
+		t.Fatalf("GetKlines() error = %v", err)
+	}
+	if atomic.LoadInt32(requests) != 1 || klines[0].Close != 100.5 {
+		t.Errorf("重置后应使用 Binance 数据源，请求 %d 次，Close=%.2f", atomic.LoadInt32(requests), klines[0].Close)
+	}
+}
+
+// TestWithSource 测试按请求指定数据源：只影响携带该数据源的请求，默认数据源不变，两者的K线分开缓存
+func TestWithSource(t *testing.T) {
+	requests := newCountingKlineServer(t)
+	source := &fakeSource{}
+	ctx := WithSource(context.Background(), source)
+
+	klines, err := getKlinesContext(ctx, "BTC", "1h", 5)
+	if err != nil || len(klines) != 5 || klines[4].Close != 42 {
+		t.Fatalf("应返回指定数据源的K线, got %+v, %v", klines, err)
+	}
+	if SourceFromContext(context.Background()) != DefaultSource() {
+		t.Error("未指定数据源的请求应使用默认数据源")
+	}
+
+	klines, err = GetKlines("BTC", "1h", 5)
+	if err != nil || klines[0].Close != 100.5 || atomic.LoadInt32(requests) != 1 {
+		t.Errorf("默认请求应从 Binance 获取而不是命中其他数据源的缓存, got %+v, %v", klines, err)
+	}
+	getKlinesContext(ctx, "BTC", "1h", 5)
+	if n := atomic.LoadInt32(&source.calls); n != 1 {
+		t.Errorf("指定数据源的K线应命中自己的缓存, 调用次数 = %d", n)
+	}
+	if WithSource(ctx, nil) != ctx {
+		t.Error("WithSource(nil) 应原样返回 ctx")
+	}
+}
+
+func TestBinanceSourceOIAndFunding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v1/openInterest":
+			w.Write([]byte(`{"openInterest":"1500.5","symbol":"BTCUSDT","time":1}`))
+		case "/fapi/v1/premiumIndex":
+			w.Write([]byte(`{"symbol":"BTCUSDT","lastFundingRate":"0.00025","nextFundingTime":1700000000000}`))
+		case "/fapi/v1/fundingRate":
+			if r.URL.Query().Get("limit") != "8" {
+				t.Errorf("fundingRate limit = %s, want 8", r.URL.Query().Get("limit"))
+			}
+			w.Write([]byte(`[{"fundingRate":"0.0002","fundingTime":2},{"fundingRate":"0.0001","fundingTime":1}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	original := binanceFuturesBaseURL
+	binanceFuturesBaseURL = srv.URL
+	defer func() { binanceFuturesBaseURL = original }()
+
+	source := &BinanceSource{}
+	oi, err := source.GetOpenInterest(context.Background(), "BTCUSDT")
+	if err != nil || oi.Latest != 1500.5 {
+		t.Errorf("GetOpenInterest = %+v, %v", oi, err)
+	}
+	rate, err := source.GetFundingRate(context.Background(), "BTCUSDT")
+	if err != nil || rate != 0.00025 {
+		t.Errorf("GetFundingRate = %v, %v", rate, err)
+	}
+	info, err := source.GetFundingInfo(context.Background(), "BTCUSDT", fundingHistoryLimit)
+	if err != nil || info.Rate != 0.00025 || info.NextFundingTime != 1700000000000 {
+		t.Fatalf("GetFundingInfo = %+v, %v", info, err)
+	}
+	if len(info.History) != 2 || info.History[0] != 0.0001 || info.History[1] != 0.0002 {
+		t.Errorf("History = %v, 应按结算时间从旧到新排列", info.History)
+	}
+}
+
+func TestAsterSourceUsesAsterEndpoints(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v1/klines":
+			w.Write([]byte(`[[1000,"10","11","9","10.5","100",1999]]`))
+		case "/fapi/v1/openInterest":
+			w.Write([]byte(`{"openInterest":"42","symbol":"BTCUSDT","time":1}`))
+		case "/fapi/v1/premiumIndex":
+			w.Write([]byte(`{"symbol":"BTCUSDT","lastFundingRate":"0.0003","nextFundingTime":1}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	original := asterFuturesBaseURL
+	asterFuturesBaseURL = srv.URL
+	defer func() { asterFuturesBaseURL = original }()
+
+	source := &AsterSource{}
+	klines, err := source.GetKlines(context.Background(), "BTCUSDT", "1h", 1)
+	if err != nil || len(klines) != 1 || klines[0].Close != 10.5 {
+		t.Fatalf("GetKlines = %+v, %v", klines, err)
+	}
+	if oi, err := source.GetOpenInterest(context.Background(), "BTCUSDT"); err != nil || oi.Latest != 42 {
+		t.Errorf("GetOpenInterest = %+v, %v", oi, err)
+	}
+	if rate, err := source.GetFundingRate(context.Background(), "BTCUSDT"); err != nil || rate != 0.0003 {
+		t.Errorf("GetFundingRate = %v, %v", rate, err)
+	}
+}
+
+func TestHyperliquidSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Type string `json:"type"`
+			Req  struct {
+				Coin     string `json:"coin"`
+				Interval string `json:"interval"`
+			} `json:"req"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("解析请求失败: %v", err)
+		}
+		switch req.Type {
+		case "candleSnapshot":
+			if req.Req.Coin != "ETH" || req.Req.Interval != "1h" {
+				t.Errorf("candleSnapshot req = %+v, want coin=ETH interval=1h", req.Req)
+			}
+			w.Write([]byte(`[
+				{"t":1000,"T":1999,"o":"10","h":"12","l":"9","c":"11","v":"5","n":3},
+				{"t":2000,"T":2999,"o":"11","h":"13","l":"10","c":"12","v":"6","n":4},
+				{"t":3000,"T":3999,"o":"12","h":"14","l":"11","c":"13","v":"7","n":5}
+			]`))
+		case "metaAndAssetCtxs":
+			w.Write([]byte(`[{"universe":[{"name":"BTC"},{"name":"ETH"}]},
+				[{"funding":"0.00001","openInterest":"100"},{"funding":"0.0000125","openInterest":"2500"}]]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	original := hyperliquidInfoURL
+	hyperliquidInfoURL = srv.URL
+	defer func() { hyperliquidInfoURL = original }()
+
+	source := &HyperliquidSource{}
+	klines, err := source.GetKlines(context.Background(), "ETHUSDT", "1h", 2)
+	if err != nil {
+		t.Fatalf("GetKlines: %v", err)
+	}
+	if len(klines) != 2 || klines[0].OpenTime != 2000 || klines[1].Close != 13 || klines[1].Trades != 5 {
+		t.Errorf("GetKlines 应返回最近2根，实际 %+v", klines)
+	}
+	if oi, err := source.GetOpenInterest(context.Background(), "ETHUSDT"); err != nil || oi.Latest != 2500 {
+		t.Errorf("GetOpenInterest = %+v, %v", oi, err)
+	}
+	if rate, err := source.GetFundingRate(context.Background(), "ETHUSDT"); err != nil || rate != 0.0001 {
+		t.Errorf("GetFundingRate = %v, %v，应折算为8小时费率", rate, err)
+	}
+	if _, err := source.GetFundingRate(context.Background(), "DOGEUSDT"); err == nil {
+		t.Error("未上线的币种应返回错误")
+	}
+}
+
+func TestNewMarketDataSource(t *testing.T) {
+	for name, want := range map[string]MarketDataSource{
+		"":            &BinanceSource{},
+		"Binance":     &BinanceSource{},
+		"hyperliquid": &HyperliquidSource{},
+		"aster":       &AsterSource{},
+	} {
+		got, err := NewMarketDataSource(name)
+		if err != nil {
+			t.Errorf("NewMarketDataSource(%q): %v", name, err)
+			continue
+		}
+		if gotType, wantType := fmt.Sprintf("%T", got), fmt.Sprintf("%T", want); gotType != wantType {
+			t.Errorf("NewMarketDataSource(%q) = %s, want %s", name, gotType, wantType)
+		}
+	}
+	if _, err := NewMarketDataSource("okx"); err == nil {
+		t.Error("未知数据源应返回错误")
+	}
+}
+
+func TestFormatFundingSchedule(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	next := now.Add(37 * time.Minute).UnixMilli()
+
+	got := formatFundingSchedule([]float64{0.0001, -0.00005}, next, now)
+	want := "Funding history (last 2): 1.00e-04, -5.00e-05, next funding in 37m"
+	if got != want {
+		t.Errorf("formatFundingSchedule = %q, want %q", got, want)
+	}
+	if got := formatFundingSchedule(nil, now.Add(65*time.Minute).UnixMilli(), now); got != "next funding in 1h05m" {
+		t.Errorf("formatFundingSchedule = %q", got)
+	}
+	if got := formatFundingSchedule(nil, now.Add(-time.Minute).UnixMilli(), now); got != "" {
+		t.Errorf("已过期的结算时间不应输出, got %q", got)
+	}
+}
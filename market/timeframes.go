@@ -0,0 +1,156 @@
+package market
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeframeSpec 分析周期定义：周期分钟数、每次获取的K线数量与K线缓存时间
+type timeframeSpec struct {
+	minutes  int
+	limit    int
+	cacheTTL time.Duration
+}
+
+// supportedTimeframes 支持的分析周期
+// 5m/15m/1h/4h 的K线数量与原有实现保持一致
+var supportedTimeframes = map[string]timeframeSpec{
+	"1m":  {minutes: 1, limit: 60, cacheTTL: 10 * time.Second},
+	"3m":  {minutes: 3, limit: 60, cacheTTL: 20 * time.Second},
+	"5m":  {minutes: 5, limit: 40, cacheTTL: 30 * time.Second},
+	"15m": {minutes: 15, limit: 120, cacheTTL: time.Minute},
+	"30m": {minutes: 30, limit: 120, cacheTTL: 90 * time.Second},
+	"1h":  {minutes: 60, limit: 120, cacheTTL: 2 * time.Minute},
+	"2h":  {minutes: 120, limit: 120, cacheTTL: 3 * time.Minute},
+	"4h":  {minutes: 240, limit: 120, cacheTTL: 5 * time.Minute},
+	"1d":  {minutes: 1440, limit: 120, cacheTTL: 10 * time.Minute},
+}
+
+// defaultTimeframes 默认分析周期
+var defaultTimeframes = []string{"5m", "15m", "1h", "4h"}
+
+// coreTimeframes 有专用指标序列的周期，其余周期计算到 ExtraSeries
+var coreTimeframes = map[string]bool{"5m": true, "15m": true, "1h": true, "4h": true}
+
+// DefaultTimeframes 返回默认分析周期（5m/15m/1h/4h）
+func DefaultTimeframes() []string {
+	return append([]string(nil), defaultTimeframes...)
+}
+
+// NormalizeTimeframes 校验并规范化分析周期：去重、按周期从小到大排序，空列表返回默认周期
+func NormalizeTimeframes(timeframes []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	for _, tf := range timeframes {
+		tf = strings.TrimSpace(tf)
+		if tf == "" || seen[tf] {
+			continue
+		}
+		if _, ok := supportedTimeframes[tf]; !ok {
+			return nil, fmt.Errorf("不支持的分析周期: %s", tf)
+		}
+		seen[tf] = true
+		result = append(result, tf)
+	}
+	if len(result) == 0 {
+		return DefaultTimeframes(), nil
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return supportedTimeframes[result[i]].minutes < supportedTimeframes[result[j]].minutes
+	})
+	return result, nil
+}
+
+// ParseTimeframes 解析逗号分隔的分析周期配置（如 "1h,4h"），空字符串返回默认周期
+func ParseTimeframes(value string) ([]string, error) {
+	return NormalizeTimeframes(strings.Split(value, ","))
+}
+
+// TimeframeSeries 非默认周期（如1m/1d）的通用指标序列
+type TimeframeSeries struct {
+	Timeframe     string        `json:"timeframe"`
+	MidPrices     []float64     `json:"mid_prices"`
+	EMA20Values   []float64     `json:"ema20"`
+	RSI7Values    []float64     `json:"rsi7"`
+	MACD          *MACDSignal   `json:"macd,omitempty"`
+	ATR14         float64       `json:"atr14"`
+	CurrentVolume float64       `json:"current_volume"`
+	AverageVolume float64       `json:"average_volume"`
+	Candles       []CandleShape `json:"candles,omitempty"`
+}
+
+// calculateTimeframeSeries 计算通用周期指标（保留最近10个值）
+func calculateTimeframeSeries(klines []Kline, timeframe string) *TimeframeSeries {
+	series := &TimeframeSeries{Timeframe: timeframe}
+	if len(klines) == 0 {
+		return series
+	}
+
+	start := len(klines) - 10
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(klines); i++ {
+		series.MidPrices = append(series.MidPrices, klines[i].Close)
+		if i >= 19 {
+			series.EMA20Values = append(series.EMA20Values, CalculateEMA(klines[:i+1], 20))
+		}
+		if i >= 7 {
+			series.RSI7Values = append(series.RSI7Values, CalculateRSI(klines[:i+1], 7))
+		}
+	}
+	series.MACD = CalculateMACDSignalWithTimeframe(klines, timeframe)
+	series.ATR14 = calculateATR(klines, 14)
+
+	sumVol := 0.0
+	for _, k := range klines {
+		sumVol += k.Volume
+	}
+	series.CurrentVolume = klines[len(klines)-1].Volume
+	series.AverageVolume = sumVol / float64(len(klines))
+	series.Candles = extractCandleShapes(klines, 5, 14)
+	return series
+}
+
+// priceChangePct 计算相对 barsBack 根K线之前收盘价的涨跌幅
+func priceChangePct(klines []Kline, barsBack int) float64 {
+	if barsBack <= 0 || len(klines) < barsBack+1 {
+		return 0
+	}
+	current := klines[len(klines)-1].Close
+	past := klines[len(klines)-1-barsBack].Close
+	if past <= 0 {
+		return 0
+	}
+	return (current - past) / past * 100
+}
+
+// appendExtraSeries 输出非默认周期的指标摘要
+func appendExtraSeries(sb *strings.Builder, data *Data) {
+	for _, tf := range data.Timeframes {
+		series := data.ExtraSeries[tf]
+		if series == nil || len(series.MidPrices) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("%s indicators (current values):\n", tf))
+		lastN := 5
+		if len(series.MidPrices) < lastN {
+			lastN = len(series.MidPrices)
+		}
+		sb.WriteString(fmt.Sprintf("Mid prices (last %d): %s\n", lastN, formatFloatSlice(series.MidPrices[len(series.MidPrices)-lastN:])))
+		if len(series.EMA20Values) > 0 {
+			sb.WriteString(fmt.Sprintf("EMA20: %.3f\n", series.EMA20Values[len(series.EMA20Values)-1]))
+		}
+		if len(series.RSI7Values) > 0 {
+			sb.WriteString(fmt.Sprintf("RSI7: %.3f\n", series.RSI7Values[len(series.RSI7Values)-1]))
+		}
+		if series.MACD != nil {
+			sb.WriteString(fmt.Sprintf("MACD=%.4f, Signal=%.4f, Hist=%.4f [%s]\n",
+				series.MACD.MACDLine, series.MACD.SignalLine, series.MACD.Histogram, series.MACD.Cross))
+		}
+		sb.WriteString(fmt.Sprintf("14-Period ATR: %.3f | Current Volume: %.3f vs. Average Volume: %.3f\n\n",
+			series.ATR14, series.CurrentVolume, series.AverageVolume))
+	}
+}
@@ -0,0 +1,136 @@
+package market
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syntheticKlines 生成带波动的合成K线
+func syntheticKlines(n int, step time.Duration) []Kline {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	klines := make([]Kline, n)
+	for i := range klines {
+		price := 100 + 5*math.Sin(float64(i)/5)
+		open := base.Add(time.Duration(i) * step).UnixMilli()
+		klines[i] = Kline{
+			OpenTime:  open,
+			Open:      price - 0.2,
+			High:      price + 1,
+			Low:       price - 1,
+			Close:     price,
+			Volume:    100 + float64(i%7),
+			CloseTime: open + step.Milliseconds() - 1,
+			Trades:    10,
+		}
+	}
+	return klines
+}
+
+// countingKlineFetcher 记录每个周期的K线请求次数（K线并发获取，计数需加锁）
+func countingKlineFetcher(calls map[string]int) klineFetcher {
+	var mu sync.Mutex
+	return func(symbol, interval string, limit int) ([]Kline, error) {
+		mu.Lock()
+		calls[interval]++
+		mu.Unlock()
+		return syntheticKlines(limit, time.Duration(supportedTimeframes[interval].minutes)*time.Minute), nil
+	}
+}
+
+func TestNormalizeTimeframes(t *testing.T) {
+	got, err := NormalizeTimeframes([]string{"4h", " 1h", "4h", ""})
+	if err != nil || !reflect.DeepEqual(got, []string{"1h", "4h"}) {
+		t.Fatalf("NormalizeTimeframes() = %v, %v, expected [1h 4h]", got, err)
+	}
+	if got, _ := ParseTimeframes(""); !reflect.DeepEqual(got, defaultTimeframes) {
+		t.Errorf("ParseTimeframes(\"\") = %v, expected defaults", got)
+	}
+	if _, err := ParseTimeframes("1h,7m"); err == nil {
+		t.Errorf("expected error for unsupported timeframe")
+	}
+}
+
+func TestBuildMarketDataSkipsDisabledTimeframes(t *testing.T) {
+	calls := make(map[string]int)
+	data, err := buildMarketData(context.Background(), "BTCUSDT", countingKlineFetcher(calls), false, []string{"1h", "4h"})
+	if err != nil {
+		t.Fatalf("buildMarketData() error = %v", err)
+	}
+
+	if calls["5m"] != 0 || calls["15m"] != 0 {
+		t.Errorf("5m/15m should not be fetched, calls = %v", calls)
+	}
+	if calls["1h"] != 1 || calls["4h"] != 1 {
+		t.Errorf("1h/4h should be fetched once, calls = %v", calls)
+	}
+	if data.IntradaySeries != nil || data.MidTermSeries15m != nil || data.PriceAction5m != nil {
+		t.Errorf("disabled timeframes should have nil series")
+	}
+	if data.MidTermSeries1h == nil || data.MidTermSeries4h == nil {
+		t.Fatalf("enabled timeframes should be computed")
+	}
+	if data.CurrentPrice <= 0 {
+		t.Errorf("current price should come from 1h klines, got %.4f", data.CurrentPrice)
+	}
+
+	out := Format(data)
+	if strings.Contains(out, "15m indicators") || !strings.Contains(out, "1h indicators") {
+		t.Errorf("Format() should only include enabled timeframes:\n%s", out)
+	}
+}
+
+func TestBuildMarketDataExtraTimeframe(t *testing.T) {
+	calls := make(map[string]int)
+	data, err := buildMarketData(context.Background(), "BTCUSDT", countingKlineFetcher(calls), false, []string{"1m", "4h", "1d"})
+	if err != nil {
+		t.Fatalf("buildMarketData() error = %v", err)
+	}
+	if len(calls) != 3 {
+		t.Errorf("calls = %v, expected only 1m/4h/1d", calls)
+	}
+	if data.ExtraSeries["1m"] == nil || data.ExtraSeries["1d"] == nil {
+		t.Fatalf("extra series for 1m/1d should be computed, got %v", data.ExtraSeries)
+	}
+	out := Format(data)
+	if !strings.Contains(out, "1m indicators") || !strings.Contains(out, "1d indicators") {
+		t.Errorf("Format() should include extra timeframes:\n%s", out)
+	}
+}
+
+func TestBuildMarketDataFetchesTimeframesConcurrently(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	slowFetcher := func(symbol, interval string, limit int) ([]Kline, error) {
+		time.Sleep(delay)
+		return syntheticKlines(limit, time.Duration(supportedTimeframes[interval].minutes)*time.Minute), nil
+	}
+
+	start := time.Now()
+	data, err := buildMarketData(context.Background(), "BTCUSDT", slowFetcher, false, defaultTimeframes)
+	if err != nil {
+		t.Fatalf("buildMarketData() error = %v", err)
+	}
+	// 串行需要 4×delay，并发应接近单次请求耗时
+	if elapsed := time.Since(start); elapsed >= 3*delay {
+		t.Errorf("elapsed = %v, expected concurrent fetch well under %v", elapsed, 4*delay)
+	}
+	if data.IntradaySeries == nil || data.MidTermSeries15m == nil || data.MidTermSeries1h == nil || data.MidTermSeries4h == nil {
+		t.Errorf("expected all default series to be populated")
+	}
+
+	// 任一周期失败时返回该周期的错误
+	failing := func(symbol, interval string, limit int) ([]Kline, error) {
+		if interval == "1h" {
+			return nil, fmt.Errorf("boom")
+		}
+		return syntheticKlines(limit, time.Duration(supportedTimeframes[interval].minutes)*time.Minute), nil
+	}
+	if _, err := buildMarketData(context.Background(), "BTCUSDT", failing, false, defaultTimeframes); err == nil || !strings.Contains(err.Error(), "获取1h K线失败") {
+		t.Errorf("expected 1h kline error, got %v", err)
+	}
+}
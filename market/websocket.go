@@ -0,0 +1,343 @@
+package market
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// binanceFuturesWSURL Binance U本位合约 WebSocket 地址（测试中可替换为mock server）
+var binanceFuturesWSURL = "wss://fstream.binance.com"
+
+const (
+	wsStreamsPerSymbol   = 3                // markPrice / depth5 / aggTrade
+	wsMaxStreamsPerConn  = 200              // Binance 单连接最多订阅的stream数
+	wsBaseRefresh        = 5 * time.Minute  // 快照基础指标（REST计算）在当前5m K线收盘前有效
+	wsLiveMaxAge         = 30 * time.Second // 实时字段超过该时间未更新视为断流，回退REST
+	wsReadTimeout        = time.Minute      // 读超时（markPrice 每秒推送，超时即重连）
+	wsReconnectBaseDelay = time.Second
+	wsReconnectMaxDelay  = 30 * time.Second
+)
+
+// WebSocketProvider 实时行情快照提供者，market.Get() 优先从快照返回，不可用时回退REST
+type WebSocketProvider interface {
+	// Snapshot 返回币种的实时快照（基础指标 + 实时价格/盘口/资金费率），不可用时返回 false
+	Snapshot(symbol string) (*Data, bool)
+	// SetBase 写入REST计算的完整市场数据，作为快照的指标部分
+	SetBase(data *Data)
+}
+
+// 全局实时行情提供者，nil 表示未启用（行情请求与启停可能在不同goroutine，读写需持锁）
+var (
+	webSocketProvider   WebSocketProvider
+	webSocketProviderMu sync.RWMutex
+)
+
+// SetWebSocketProvider 设置实时行情提供者（传nil关闭）
+func SetWebSocketProvider(provider WebSocketProvider) {
+	webSocketProviderMu.Lock()
+	defer webSocketProviderMu.Unlock()
+	webSocketProvider = provider
+}
+
+// ResetWebSocketProvider 关闭实时行情，market.Get() 全部走REST
+func ResetWebSocketProvider() {
+	SetWebSocketProvider(nil)
+}
+
+// currentWebSocketProvider 返回当前实时行情提供者，未启用时为nil
+func currentWebSocketProvider() WebSocketProvider {
+	webSocketProviderMu.RLock()
+	defer webSocketProviderMu.RUnlock()
+	return webSocketProvider
+}
+
+// wsSnapshot 单个币种的实时快照
+type wsSnapshot struct {
+	base        *Data     // REST计算的完整数据（指标部分）
+	baseFetched time.Time // base 获取时间
+
+	markPrice       float64
+	fundingRate     float64
+	nextFundingTime int64
+	lastTradePrice  float64
+	bids, asks      [][2]float64 // depth5 [价格, 数量]
+	liveUpdated     time.Time
+}
+
+// WebSocketFeed 订阅 Binance 合约 markPrice/depth5/aggTrade，维护各币种实时快照
+type WebSocketFeed struct {
+	onUpdate func(*Data)
+
+	mu        sync.RWMutex
+	snapshots map[string]*wsSnapshot
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	wg       sync.WaitGroup
+
+	connMu sync.Mutex
+	conns  map[*websocket.Conn]bool
+}
+
+// StartWebSocketFeed 订阅 symbols 的实时行情并注册为全局 WebSocketProvider，
+// 每次快照刷新时调用 onUpdate（可为nil）；调用 Stop 断开连接并恢复纯REST
+func StartWebSocketFeed(symbols []string, onUpdate func(*Data)) (*WebSocketFeed, error) {
+	feed := &WebSocketFeed{
+		onUpdate:  onUpdate,
+		snapshots: make(map[string]*wsSnapshot),
+		stop:      make(chan struct{}),
+		conns:     make(map[*websocket.Conn]bool),
+	}
+
+	var normalized []string
+	for _, symbol := range symbols {
+		symbol = Normalize(symbol)
+		if _, ok := feed.snapshots[symbol]; ok {
+			continue
+		}
+		feed.snapshots[symbol] = &wsSnapshot{}
+		normalized = append(normalized, symbol)
+	}
+	if len(normalized) == 0 {
+		return nil, fmt.Errorf("未指定订阅币种")
+	}
+
+	perConn := wsMaxStreamsPerConn / wsStreamsPerSymbol
+	for start := 0; start < len(normalized); start += perConn {
+		end := min(start+perConn, len(normalized))
+		feed.wg.Add(1)
+		go feed.run(normalized[start:end])
+	}
+
+	SetWebSocketProvider(feed)
+	log.Printf("📡 WebSocket 实时行情已启动: %d 个币种", len(normalized))
+	return feed, nil
+}
+
+// Stop 断开所有连接，并在当前提供者为自身时恢复纯REST
+func (f *WebSocketFeed) Stop() {
+	f.stopOnce.Do(func() {
+		close(f.stop)
+		f.connMu.Lock()
+		for conn := range f.conns {
+			conn.Close()
+		}
+		f.connMu.Unlock()
+		f.wg.Wait()
+		webSocketProviderMu.Lock()
+		if webSocketProvider == WebSocketProvider(f) {
+			webSocketProvider = nil
+		}
+		webSocketProviderMu.Unlock()
+	})
+}
+
+// Snapshot 基础指标仍在当前5m K线内且实时字段未断流时返回合并后的快照
+func (f *WebSocketFeed) Snapshot(symbol string) (*Data, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	snap, ok := f.snapshots[Normalize(symbol)]
+	if !ok || snap.base == nil {
+		return nil, false
+	}
+	now := time.Now()
+	if !now.Before(snap.baseFetched.Truncate(wsBaseRefresh).Add(wsBaseRefresh)) || now.Sub(snap.liveUpdated) > wsLiveMaxAge {
+		return nil, false
+	}
+	return snap.merge(), true
+}
+
+// SetBase 记录REST计算的完整数据（仅订阅中的币种）
+func (f *WebSocketFeed) SetBase(data *Data) {
+	if data == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if snap, ok := f.snapshots[Normalize(data.Symbol)]; ok {
+		snap.base = data
+		snap.baseFetched = time.Now()
+	}
+}
+
+// merge 以 base 为基础覆盖实时字段（调用方持有读锁）
+func (s *wsSnapshot) merge() *Data {
+	var data Data
+	if s.base != nil {
+		data = *s.base
+	}
+
+	if s.lastTradePrice > 0 {
+		data.CurrentPrice = s.lastTradePrice
+	} else if s.markPrice > 0 {
+		data.CurrentPrice = s.markPrice
+	}
+	if s.nextFundingTime > 0 {
+		data.FundingRate = s.fundingRate
+		data.NextFundingTime = s.nextFundingTime
+	}
+
+	if len(s.bids) > 0 && len(s.asks) > 0 {
+		micro := &MicrostructureSummary{}
+		if data.Microstructure != nil {
+			*micro = *data.Microstructure
+		}
+		micro.TsMs = s.liveUpdated.UnixMilli()
+		micro.BestBidPrice, micro.BestBidQty = s.bids[0][0], s.bids[0][1]
+		micro.BestAskPrice, micro.BestAskQty = s.asks[0][0], s.asks[0][1]
+		micro.BestBidNotional = micro.BestBidPrice * micro.BestBidQty
+		micro.BestAskNotional = micro.BestAskPrice * micro.BestAskQty
+		micro.MinNotional = min(micro.BestBidNotional, micro.BestAskNotional)
+		if mid := (micro.BestBidPrice + micro.BestAskPrice) / 2; mid > 0 {
+			micro.SpreadBps = (micro.BestAskPrice - micro.BestBidPrice) / mid * 10000
+		}
+		data.Microstructure = micro
+		data.Execution = EvaluateExecutionGate(micro, 0)
+	}
+	return &data
+}
+
+// run 维持一组币种的连接，断开后按指数退避重连，直到 Stop
+func (f *WebSocketFeed) run(symbols []string) {
+	defer f.wg.Done()
+
+	streams := make([]string, 0, len(symbols)*wsStreamsPerSymbol)
+	for _, symbol := range symbols {
+		lower := strings.ToLower(symbol)
+		streams = append(streams, lower+"@markPrice@1s", lower+"@depth5@100ms", lower+"@aggTrade")
+	}
+	url := fmt.Sprintf("%s/stream?streams=%s", binanceFuturesWSURL, strings.Join(streams, "/"))
+
+	delay := wsReconnectBaseDelay
+	for {
+		connected, err := f.readStream(url)
+		select {
+		case <-f.stop:
+			return
+		default:
+		}
+		if connected {
+			delay = wsReconnectBaseDelay
+		}
+		log.Printf("⚠️ WebSocket 行情连接断开，%v 后重连: %v", delay, err)
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, wsReconnectMaxDelay)
+	}
+}
+
+// readStream 建立一次连接并持续读取，返回是否曾连接成功及断开原因
+func (f *WebSocketFeed) readStream(url string) (bool, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return false, err
+	}
+	f.connMu.Lock()
+	select {
+	case <-f.stop:
+		f.connMu.Unlock()
+		conn.Close()
+		return true, nil
+	default:
+	}
+	f.conns[conn] = true
+	f.connMu.Unlock()
+	defer func() {
+		f.connMu.Lock()
+		delete(f.conns, conn)
+		f.connMu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(wsReadTimeout))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+		if err := f.handleMessage(message); err != nil {
+			log.Printf("⚠️ 解析WebSocket行情失败: %v", err)
+		}
+	}
+}
+
+// wsCombinedMessage 组合流消息
+type wsCombinedMessage struct {
+	Stream string          `json:"stream"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// wsEvent markPriceUpdate / depthUpdate / aggTrade 的公共字段
+type wsEvent struct {
+	EventType       string     `json:"e"`
+	Symbol          string     `json:"s"`
+	Price           string     `json:"p"` // markPrice: 标记价; aggTrade: 成交价
+	FundingRate     string     `json:"r"`
+	NextFundingTime int64      `json:"T"` // markPrice: 下次资金费时间; 其他事件为成交/撮合时间
+	Bids            [][]string `json:"b"`
+	Asks            [][]string `json:"a"`
+}
+
+// handleMessage 更新对应币种的快照并回调 onUpdate
+func (f *WebSocketFeed) handleMessage(message []byte) error {
+	var combined wsCombinedMessage
+	if err := json.Unmarshal(message, &combined); err != nil {
+		return err
+	}
+	var event wsEvent
+	if err := json.Unmarshal(combined.Data, &event); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	snap, ok := f.snapshots[event.Symbol]
+	if !ok {
+		f.mu.Unlock()
+		return nil
+	}
+	switch event.EventType {
+	case "markPriceUpdate":
+		snap.markPrice = safeParseFloat(event.Price)
+		snap.fundingRate = safeParseFloat(event.FundingRate)
+		snap.nextFundingTime = event.NextFundingTime
+	case "depthUpdate":
+		snap.bids = parseWSLevels(event.Bids)
+		snap.asks = parseWSLevels(event.Asks)
+	case "aggTrade":
+		snap.lastTradePrice = safeParseFloat(event.Price)
+	default:
+		f.mu.Unlock()
+		return nil
+	}
+	snap.liveUpdated = time.Now()
+	data := snap.merge()
+	data.Symbol = event.Symbol
+	f.mu.Unlock()
+
+	if f.onUpdate != nil {
+		f.onUpdate(data)
+	}
+	return nil
+}
+
+// parseWSLevels 解析盘口档位 [["价格","数量"], ...]
+func parseWSLevels(levels [][]string) [][2]float64 {
+	out := make([][2]float64, 0, len(levels))
+	for _, level := range levels {
+		if len(level) < 2 {
+			continue
+		}
+		out = append(out, [2]float64{safeParseFloat(level[0]), safeParseFloat(level[1])})
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package market
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketFeedSnapshot(t *testing.T) {
+	streams := make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streams <- r.URL.Query().Get("streams")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, msg := range []string{
+			`{"stream":"btcusdt@markPrice@1s","data":{"e":"markPriceUpdate","s":"BTCUSDT","p":"50010.5","r":"0.0001","T":1700000000000}}`,
+			`{"stream":"btcusdt@depth5@100ms","data":{"e":"depthUpdate","s":"BTCUSDT","b":[["50000","2"]],"a":[["50001","3"]]}}`,
+			`{"stream":"btcusdt@aggTrade","data":{"e":"aggTrade","s":"BTCUSDT","p":"50000.5","q":"0.1"}}`,
+		} {
+			conn.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+		conn.ReadMessage() // 保持连接直到客户端关闭
+	}))
+	defer srv.Close()
+
+	original := binanceFuturesWSURL
+	binanceFuturesWSURL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	defer func() { binanceFuturesWSURL = original }()
+
+	provider := &fixedMarketDataProvider{data: &Data{Symbol: "BTCUSDT", CurrentPrice: 49000, CurrentRSI7: 55}}
+	SetMarketDataProvider(provider)
+	defer ResetMarketDataProvider()
+
+	updates := make(chan *Data, 10)
+	feed, err := StartWebSocketFeed([]string{"btc"}, func(d *Data) { updates <- d })
+	if err != nil {
+		t.Fatalf("StartWebSocketFeed() error = %v", err)
+	}
+	defer feed.Stop()
+
+	if got := <-streams; got != "btcusdt@markPrice@1s/btcusdt@depth5@100ms/btcusdt@aggTrade" {
+		t.Errorf("streams = %s", got)
+	}
+	var last *Data
+	for i := 0; i < 3; i++ {
+		select {
+		case last = <-updates:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("第 %d 次快照刷新超时", i+1)
+		}
+	}
+	if last.CurrentPrice != 50000.5 || last.FundingRate != 0.0001 || last.Microstructure == nil || last.Microstructure.BestAskPrice != 50001 {
+		t.Errorf("快照 = price %.2f funding %v micro %+v", last.CurrentPrice, last.FundingRate, last.Microstructure)
+	}
+
+	// 首次 Get 无基础指标，回退REST并写入基础数据
+	data, err := Get("BTCUSDT")
+	if err != nil || data.CurrentPrice != 49000 || provider.calls != 1 {
+		t.Fatalf("首次 Get = %+v, %v (calls=%d)，应回退REST", data, err, provider.calls)
+	}
+	// 之后从实时快照返回：保留REST指标，价格/盘口为实时值
+	data, err = Get("BTCUSDT")
+	if err != nil || provider.calls != 1 {
+		t.Fatalf("第二次 Get 不应请求REST, calls=%d err=%v", provider.calls, err)
+	}
+	if data.CurrentPrice != 50000.5 || data.CurrentRSI7 != 55 || data.NextFundingTime != 1700000000000 {
+		t.Errorf("实时快照 = price %.2f rsi %.1f nextFunding %d", data.CurrentPrice, data.CurrentRSI7, data.NextFundingTime)
+	}
+	if data.Microstructure.SpreadBps <= 0 || data.Execution == nil {
+		t.Errorf("实时盘口应计算点差与执行门禁: %+v %+v", data.Microstructure, data.Execution)
+	}
+
+	feed.Stop()
+	if currentWebSocketProvider() != nil {
+		t.Error("Stop 后应恢复纯REST")
+	}
+}
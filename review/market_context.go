@@ -0,0 +1,146 @@
+package review
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"nofx/market"
+)
+
+// KlineFetcher 按时间范围获取K线（签名同 market.GetKlinesRange），用于复盘时还原开平仓前后的行情
+type KlineFetcher func(symbol, interval string, startTime, endTime time.Time, limit int) ([]market.Kline, error)
+
+const (
+	reviewLookbackBeforeEntry = 6 * time.Hour // 开仓前回看时长
+	reviewLookaheadAfterExit  = 2 * time.Hour // 平仓后观察时长
+	reviewMaxKlines           = 1000          // 单周期最多获取的K线数
+	reviewMaxListedBars       = 24            // 提示词中逐根列出的K线上限
+)
+
+// reviewKlineIntervals 复盘使用的K线周期
+var reviewKlineIntervals = []string{"15m", "1h"}
+
+// SetKlineFetcher 设置K线获取函数，设置后复盘提示词会附带开仓前6h至平仓后2h的15m/1h行情
+func (rg *ReviewGenerator) SetKlineFetcher(fetcher KlineFetcher) {
+	rg.klineFetcher = fetcher
+}
+
+// buildMarketDataSection 获取并汇总交易前后的K线，返回提示词段落和获取失败的说明。
+// 未设置获取函数时返回空段落；获取失败时段落中注明缺失原因，不影响复盘生成
+func (rg *ReviewGenerator) buildMarketDataSection(trade TradeInfo) (string, []string) {
+	if rg.klineFetcher == nil {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	var notes []string
+	sb.WriteString("【开平仓前后行情】\n")
+	if trade.EntryTime.IsZero() || trade.ExitTime.IsZero() {
+		note := "缺少开仓/平仓时间，无法获取历史K线"
+		sb.WriteString("⚠️ " + note + "，请仅基于决策记录复盘。\n\n")
+		return sb.String(), []string{note}
+	}
+
+	start := trade.EntryTime.Add(-reviewLookbackBeforeEntry)
+	end := trade.ExitTime.Add(reviewLookaheadAfterExit)
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+	sb.WriteString(fmt.Sprintf("区间: %s ~ %s（开仓前6h至平仓后2h）\n\n",
+		start.Format("2006-01-02 15:04"), end.Format("2006-01-02 15:04")))
+
+	for _, interval := range reviewKlineIntervals {
+		klines, err := rg.klineFetcher(trade.Symbol, interval, start, end, reviewMaxKlines)
+		if err == nil && len(klines) == 0 {
+			err = fmt.Errorf("无数据")
+		}
+		if err != nil {
+			note := fmt.Sprintf("无法获取%s %s K线: %v", trade.Symbol, interval, err)
+			notes = append(notes, note)
+			sb.WriteString(fmt.Sprintf("⚠️ %s，该周期行情缺失，请勿臆测价格结构。\n\n", note))
+			continue
+		}
+		sb.WriteString(summarizeTradeKlines(interval, klines, trade))
+		sb.WriteString("\n")
+	}
+	return sb.String(), notes
+}
+
+// summarizeTradeKlines 紧凑汇总一个周期的K线：区间高低点、持仓期间最大有利/不利波动、平仓后走势，
+// 并逐根列出关键K线（15m 为平仓前1h至平仓后，1h 为完整区间）
+func summarizeTradeKlines(interval string, klines []market.Kline, trade TradeInfo) string {
+	var sb strings.Builder
+	entryMs, exitMs := trade.EntryTime.UnixMilli(), trade.ExitTime.UnixMilli()
+
+	high, low := klines[0].High, klines[0].Low
+	highTime, lowTime := klines[0].OpenTime, klines[0].OpenTime
+	holdHigh, holdLow := 0.0, math.MaxFloat64
+	var lastAfterExit *market.Kline
+	for i := range klines {
+		k := &klines[i]
+		if k.High > high {
+			high, highTime = k.High, k.OpenTime
+		}
+		if k.Low < low {
+			low, lowTime = k.Low, k.OpenTime
+		}
+		if k.CloseTime >= entryMs && k.OpenTime <= exitMs {
+			holdHigh = math.Max(holdHigh, k.High)
+			holdLow = math.Min(holdLow, k.Low)
+		}
+		if k.OpenTime > exitMs {
+			lastAfterExit = k
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("%s K线 %d根 | 区间最高 %.4f (%s) | 区间最低 %.4f (%s)\n",
+		interval, len(klines), high, formatKlineTime(highTime), low, formatKlineTime(lowTime)))
+
+	if trade.EntryPrice > 0 && holdLow != math.MaxFloat64 {
+		favorable, adverse := holdHigh-trade.EntryPrice, trade.EntryPrice-holdLow
+		if strings.EqualFold(trade.Side, "short") {
+			favorable, adverse = adverse, favorable
+		}
+		sb.WriteString(fmt.Sprintf("持仓期间最大有利波动 %+.2f%% | 最大不利波动 %+.2f%%\n",
+			favorable/trade.EntryPrice*100, -adverse/trade.EntryPrice*100))
+	}
+	if lastAfterExit != nil && trade.ExitPrice > 0 {
+		sb.WriteString(fmt.Sprintf("平仓后走势: %.4f → %.4f (%+.2f%%)\n",
+			trade.ExitPrice, lastAfterExit.Close, (lastAfterExit.Close-trade.ExitPrice)/trade.ExitPrice*100))
+	}
+
+	listed := klines
+	if interval == "15m" {
+		from := trade.ExitTime.Add(-time.Hour).UnixMilli()
+		listed = nil
+		for _, k := range klines {
+			if k.OpenTime >= from {
+				listed = append(listed, k)
+			}
+		}
+	}
+	if len(listed) > reviewMaxListedBars {
+		listed = listed[len(listed)-reviewMaxListedBars:]
+	}
+	if len(listed) > 0 {
+		sb.WriteString("time open/high/low/close volume:\n")
+		for _, k := range listed {
+			marker := ""
+			switch {
+			case k.OpenTime <= entryMs && entryMs <= k.CloseTime:
+				marker = " ← 开仓"
+			case k.OpenTime <= exitMs && exitMs <= k.CloseTime:
+				marker = " ← 平仓"
+			}
+			sb.WriteString(fmt.Sprintf("%s %.4f/%.4f/%.4f/%.4f %.2f%s\n",
+				formatKlineTime(k.OpenTime), k.Open, k.High, k.Low, k.Close, k.Volume, marker))
+		}
+	}
+	return sb.String()
+}
+
+func formatKlineTime(ms int64) string {
+	return time.UnixMilli(ms).Format("01-02 15:04")
+}
@@ -0,0 +1,54 @@
+package review
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"nofx/market"
+)
+
+func TestBuildMarketDataSection(t *testing.T) {
+	entry := time.Date(2025, 3, 1, 10, 0, 0, 0, time.Local)
+	exit := entry.Add(3 * time.Hour)
+	trade := TradeInfo{Symbol: "BTCUSDT", Side: "long", EntryPrice: 100, ExitPrice: 98, EntryTime: entry, ExitTime: exit}
+
+	var requested []string
+	fetcher := func(symbol, interval string, start, end time.Time, limit int) ([]market.Kline, error) {
+		requested = append(requested, interval)
+		if !start.Equal(entry.Add(-6*time.Hour)) || !end.Equal(exit.Add(2*time.Hour)) {
+			t.Errorf("%s 区间 = %v ~ %v, 应为开仓前6h至平仓后2h", interval, start, end)
+		}
+		if interval == "15m" {
+			return nil, errors.New("symbol delisted")
+		}
+		var klines []market.Kline
+		for ts := start; ts.Before(end); ts = ts.Add(time.Hour) {
+			klines = append(klines, market.Kline{
+				OpenTime: ts.UnixMilli(), CloseTime: ts.Add(time.Hour).UnixMilli() - 1,
+				Open: 100, High: 103, Low: 97, Close: 99,
+			})
+		}
+		return klines, nil
+	}
+
+	rg := NewReviewGenerator(nil)
+	if section, notes := rg.buildMarketDataSection(trade); section != "" || notes != nil {
+		t.Errorf("未设置获取函数时不应输出行情段落: %q", section)
+	}
+
+	rg.SetKlineFetcher(fetcher)
+	section, notes := rg.buildMarketDataSection(trade)
+	if strings.Join(requested, ",") != "15m,1h" {
+		t.Errorf("请求周期 = %v, want 15m,1h", requested)
+	}
+	if len(notes) != 1 || !strings.Contains(notes[0], "symbol delisted") || !strings.Contains(section, "15m K线: symbol delisted") {
+		t.Errorf("15m 获取失败应在提示词中注明: notes=%v\n%s", notes, section)
+	}
+	for _, want := range []string{"1h K线 11根", "最大有利波动 +3.00%", "最大不利波动 -3.00%", "← 开仓", "← 平仓", "平仓后走势: 98.0000 → 99.0000"} {
+		if !strings.Contains(section, want) {
+			t.Errorf("行情段落缺少 %q:\n%s", want, section)
+		}
+	}
+}
@@ -14,7 +14,8 @@ import (
 
 // ReviewGenerator 复盘生成器
 type ReviewGenerator struct {
-	mcpClient *mcp.Client
+	mcpClient    *mcp.Client
+	klineFetcher KlineFetcher // 可选：获取开平仓前后的K线，nil 时提示词不含行情
 }
 
 // NewReviewGenerator 创建复盘生成器
@@ -26,6 +27,22 @@ func NewReviewGenerator(mcpClient *mcp.Client) *ReviewGenerator {
 
 // ExtractLossTrades 从决策日志中提取亏损的交易
 func ExtractLossTrades(decisionLogger *logger.DecisionLogger, limit int) ([]TradeInfo, error) {
+	trades, err := ExtractClosedTrades(decisionLogger, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var lossTrades []TradeInfo
+	for _, trade := range trades {
+		if trade.PnL < 0 {
+			lossTrades = append(lossTrades, trade)
+		}
+	}
+	return lossTrades, nil
+}
+
+// ExtractClosedTrades 从决策日志中按开平仓配对提取所有已平仓交易（按平仓时间从旧到新）
+func ExtractClosedTrades(decisionLogger *logger.DecisionLogger, limit int) ([]TradeInfo, error) {
 	records, err := decisionLogger.GetLatestRecords(limit)
 	if err != nil {
 		return nil, fmt.Errorf("获取决策记录失败: %w", err)
@@ -47,7 +64,7 @@ func ExtractLossTrades(decisionLogger *logger.DecisionLogger, limit int) ([]Trad
 	}
 
 	openPositions := make(map[string]*OpenPosition) // key: symbol_side
-	var lossTrades []TradeInfo
+	var closedTrades []TradeInfo
 
 	// 从旧到新遍历记录
 	for i := len(records) - 1; i >= 0; i-- {
@@ -119,36 +136,33 @@ func ExtractLossTrades(decisionLogger *logger.DecisionLogger, limit int) ([]Trad
 					pnlPct = ((openPos.EntryPrice - exitPrice) / openPos.EntryPrice) * 100
 				}
 
-				// 只记录亏损的交易
-				if pnl < 0 {
-					holdingMinutes := int(record.Timestamp.Sub(openPos.EntryTime).Minutes())
-
-					// 构建交易ID
-					tradeID := fmt.Sprintf("%s_%d_%d",
-						decision.Symbol,
-						openPos.EntryTime.Unix(),
-						record.Timestamp.Unix())
-
-					lossTrades = append(lossTrades, TradeInfo{
-						TradeID:        tradeID,
-						Symbol:         decision.Symbol,
-						Side:           side,
-						EntryPrice:     openPos.EntryPrice,
-						ExitPrice:      exitPrice,
-						EntryTime:      openPos.EntryTime,
-						ExitTime:       record.Timestamp,
-						Quantity:       openPos.Quantity,
-						Leverage:       openPos.Leverage,
-						PnL:            pnl,
-						PnLPct:         pnlPct,
-						HoldingMinutes: holdingMinutes,
-						StopLoss:       openPos.StopLoss,
-						TakeProfit:     openPos.TakeProfit,
-						EntryCycle:     openPos.CycleNumber,
-						ExitCycle:      record.CycleNumber,
-						EntryReasoning: openPos.Reasoning,
-					})
-				}
+				holdingMinutes := int(record.Timestamp.Sub(openPos.EntryTime).Minutes())
+
+				// 构建交易ID
+				tradeID := fmt.Sprintf("%s_%d_%d",
+					decision.Symbol,
+					openPos.EntryTime.Unix(),
+					record.Timestamp.Unix())
+
+				closedTrades = append(closedTrades, TradeInfo{
+					TradeID:        tradeID,
+					Symbol:         decision.Symbol,
+					Side:           side,
+					EntryPrice:     openPos.EntryPrice,
+					ExitPrice:      exitPrice,
+					EntryTime:      openPos.EntryTime,
+					ExitTime:       record.Timestamp,
+					Quantity:       openPos.Quantity,
+					Leverage:       openPos.Leverage,
+					PnL:            pnl,
+					PnLPct:         pnlPct,
+					HoldingMinutes: holdingMinutes,
+					StopLoss:       openPos.StopLoss,
+					TakeProfit:     openPos.TakeProfit,
+					EntryCycle:     openPos.CycleNumber,
+					ExitCycle:      record.CycleNumber,
+					EntryReasoning: openPos.Reasoning,
+				})
 
 				// 删除已平仓的持仓
 				delete(openPositions, posKey)
@@ -156,7 +170,7 @@ func ExtractLossTrades(decisionLogger *logger.DecisionLogger, limit int) ([]Trad
 		}
 	}
 
-	return lossTrades, nil
+	return closedTrades, nil
 }
 
 // FindTradeByID 从trade_id解析并查找对应的交易（不限制是否亏损）
@@ -564,8 +578,11 @@ func (rg *ReviewGenerator) GenerateReview(trade TradeInfo, decisionLogger *logge
 		cotTrace.WriteString(fmt.Sprintf("；Cycle%d 平仓：%s", exitRecord.CycleNumber, lifecycle[len(lifecycle)-1].Reasoning))
 	}
 
+	// 获取开平仓前后的行情（失败时在提示词中注明，不影响复盘）
+	marketSection, marketNotes := rg.buildMarketDataSection(trade)
+
 	// 构建AI提示词
-	prompt := rg.buildReviewPrompt(tradeSnapshot, lifecycle, marketContext, cotTrace.String())
+	prompt := rg.buildReviewPrompt(tradeSnapshot, lifecycle, marketContext, cotTrace.String(), marketSection)
 
 	// 调用AI生成复盘
 	reviewRecord, err := rg.callAIForReview(prompt)
@@ -587,6 +604,9 @@ func (rg *ReviewGenerator) GenerateReview(trade TradeInfo, decisionLogger *logge
 			"generated_by":           "ai-auto-review",
 		},
 	}
+	if len(marketNotes) > 0 {
+		reviewFile.AdditionalMetadata["market_data_notes"] = marketNotes
+	}
 
 	return reviewFile, nil
 }
@@ -597,6 +617,7 @@ func (rg *ReviewGenerator) buildReviewPrompt(
 	lifecycle []PositionLifecycleEntry,
 	marketContext MarketContextAtClose,
 	cotTrace string,
+	marketSection string,
 ) string {
 	var sb strings.Builder
 
@@ -641,6 +662,9 @@ func (rg *ReviewGenerator) buildReviewPrompt(
 	}
 	sb.WriteString("\n")
 
+	// 添加开平仓前后行情
+	sb.WriteString(marketSection)
+
 	// 添加思维链追踪
 	if cotTrace != "" {
 		sb.WriteString("【思维链追踪】\n")
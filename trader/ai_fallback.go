@@ -0,0 +1,67 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"nofx/decision"
+	"nofx/internal/metrics"
+	"nofx/mcp"
+)
+
+// newFallbackMCPClient 按备用AI配置创建客户端，未配置 FallbackAIModel 时返回nil
+func newFallbackMCPClient(config AutoTraderConfig) *mcp.Client {
+	if config.FallbackAIModel == "" {
+		return nil
+	}
+
+	client := mcp.New()
+	switch config.FallbackAIModel {
+	case "custom":
+		client.SetCustomAPI(config.FallbackAPIURL, config.FallbackAPIKey, config.FallbackModelName)
+	case "qwen":
+		client.SetQwenAPIKey(config.FallbackAPIKey, config.FallbackAPIURL, config.FallbackModelName)
+	case "deepseek":
+		client.SetDeepSeekAPIKey(config.FallbackAPIKey, config.FallbackAPIURL, config.FallbackModelName)
+	default:
+		log.Printf("⚠️ [%s] 未知的备用AI模型 %q，不启用备用模型", config.Name, config.FallbackAIModel)
+		return nil
+	}
+	log.Printf("🤖 [%s] 已配置备用AI: %s", config.Name, aiModelLabel(client))
+	return client
+}
+
+// aiModelLabel 模型标识（provider/model），用于决策记录
+func aiModelLabel(client *mcp.Client) string {
+	if client == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", client.Provider, client.Model)
+}
+
+// requestAIDecision 调用主模型获取决策，失败时（风控拦截除外）改用备用模型
+// 返回产生决策的模型标识
+func (at *AutoTrader) requestAIDecision(ctx *decision.Context, customPrompt string) (*decision.FullDecision, string, error) {
+	start := time.Now()
+	defer func() { metrics.AICallLatency.WithLabelValues(at.id).Observe(time.Since(start).Seconds()) }()
+
+	resp, err := decision.GetFullDecisionWithCustomPromptAndTraderID(ctx, at.mcpClient, customPrompt, at.overrideBasePrompt, at.systemPromptTemplate, at.id, at.globalConfig)
+	if err == nil || at.fallbackClient == nil || isValidationRejected(err) {
+		return resp, aiModelLabel(at.mcpClient), err
+	}
+
+	fallbackModel := aiModelLabel(at.fallbackClient)
+	log.Printf("⚠️ 主AI模型 %s 调用失败，改用备用模型 %s: %v", aiModelLabel(at.mcpClient), fallbackModel, err)
+	fallbackResp, fallbackErr := decision.GetFullDecisionWithCustomPromptAndTraderID(ctx, at.fallbackClient, customPrompt, at.overrideBasePrompt, at.systemPromptTemplate, at.id, at.globalConfig)
+	if fallbackErr != nil && !isValidationRejected(fallbackErr) {
+		return nil, fallbackModel, fmt.Errorf("主模型失败(%v)，备用模型也失败: %w", err, fallbackErr)
+	}
+	return fallbackResp, fallbackModel, fallbackErr
+}
+
+// isValidationRejected 决策被风控拦截（模型本身正常返回）
+func isValidationRejected(err error) bool {
+	decisionErr, ok := err.(*decision.DecisionError)
+	return ok && decisionErr.Type == decision.DECISION_VALIDATION_REJECTED
+}
@@ -32,6 +32,7 @@ type AsterTrader struct {
 	privateKey *ecdsa.PrivateKey // API钱包私钥
 	client     *http.Client
 	baseURL    string
+	clock      *exchangeClock // 服务器时间同步，用于签名时间戳
 
 	// 缓存交易对精度信息
 	symbolPrecision map[string]SymbolPrecision
@@ -57,7 +58,7 @@ func NewAsterTrader(user, signer, privateKeyHex string) (*AsterTrader, error) {
 		return nil, fmt.Errorf("解析私钥失败: %w", err)
 	}
 
-	return &AsterTrader{
+	t := &AsterTrader{
 		ctx:             context.Background(),
 		user:            user,
 		signer:          signer,
@@ -72,7 +73,9 @@ func NewAsterTrader(user, signer, privateKeyHex string) (*AsterTrader, error) {
 			},
 		},
 		baseURL: "https://fapi.asterdex.com",
-	}, nil
+	}
+	t.clock = newExchangeClock("Aster", httpServerTimeFetcher(t.client, t.baseURL+"/fapi/v1/time"), nil)
+	return t, nil
 }
 
 // genNonce 生成微秒时间戳
@@ -264,7 +267,7 @@ func (t *AsterTrader) normalize(v interface{}) (interface{}, error) {
 func (t *AsterTrader) sign(params map[string]interface{}, nonce uint64) error {
 	// 添加时间戳和接收窗口
 	params["recvWindow"] = "50000"
-	params["timestamp"] = strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	params["timestamp"] = strconv.FormatInt(t.clock.NowMs(), 10)
 
 	// 规范化参数为JSON字符串
 	jsonStr, err := t.normalizeAndStringify(params)
@@ -933,8 +936,16 @@ func (t *AsterTrader) GetMarketPrice(symbol string) (float64, error) {
 	return strconv.ParseFloat(priceStr, 64)
 }
 
+// setReduceOnly 单向持仓（positionSide=BOTH）时标记只减仓，触发时不会反向开仓；
+// 双向持仓（LONG/SHORT）时交易所不接受 reduceOnly，仓位方向本身保证只减仓
+func setReduceOnly(params map[string]interface{}) {
+	if params["positionSide"] == "BOTH" {
+		params["reduceOnly"] = "true"
+	}
+}
+
 // SetStopLoss 设置止损
-func (t *AsterTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+func (t *AsterTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64, reduceOnly bool) error {
 	side := "SELL"
 	if positionSide == "SHORT" {
 		side = "BUY"
@@ -969,13 +980,16 @@ func (t *AsterTrader) SetStopLoss(symbol string, positionSide string, quantity,
 		"quantity":     qtyStr,
 		"timeInForce":  "GTC",
 	}
+	if reduceOnly {
+		setReduceOnly(params)
+	}
 
 	_, err = t.request("POST", "/fapi/v3/order", params)
 	return err
 }
 
 // SetTakeProfit 设置止盈
-func (t *AsterTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+func (t *AsterTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64, reduceOnly bool) error {
 	side := "SELL"
 	if positionSide == "SHORT" {
 		side = "BUY"
@@ -1010,6 +1024,9 @@ func (t *AsterTrader) SetTakeProfit(symbol string, positionSide string, quantity
 		"quantity":     qtyStr,
 		"timeInForce":  "GTC",
 	}
+	if reduceOnly {
+		setReduceOnly(params)
+	}
 
 	_, err = t.request("POST", "/fapi/v3/order", params)
 	return err
@@ -1058,3 +1075,8 @@ func (t *AsterTrader) GetOrderStatus(symbol string, orderID int64) (map[string]i
 func (t *AsterTrader) CancelOrder(symbol string, orderID int64) error {
 	return fmt.Errorf("Aster 暂不支持限价单功能")
 }
+
+// GetTradeHistory Aster暂不支持成交记录查询
+func (t *AsterTrader) GetTradeHistory(symbol string, since int64) ([]TradeFill, error) {
+	return nil, fmt.Errorf("Aster 暂不支持成交记录查询")
+}
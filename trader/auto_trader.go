@@ -1,6 +1,7 @@
 package trader
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,6 +9,7 @@ import (
 	"math"
 	"nofx/config"
 	"nofx/decision"
+	"nofx/internal/metrics"
 	"nofx/logger"
 	"nofx/market"
 	"nofx/mcp"
@@ -15,8 +17,11 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -38,6 +43,39 @@ type LimitOrderExecutionReport struct {
 	EndTime        int64   `json:"end_time"`
 	DurationMs     int64   `json:"duration_ms"`
 	Error          string  `json:"error,omitempty"`
+	Commission     float64 `json:"commission"`   // 成交手续费（交易所成交回报提供时填充）
+	SlippageBps    float64 `json:"slippage_bps"` // 成交均价相对限价的滑点（基点），正值表示对本方不利
+}
+
+// recordFill 根据订单状态更新成交量、均价、手续费与滑点
+func (r *LimitOrderExecutionReport) recordFill(status map[string]interface{}) {
+	r.FilledQuantity, _ = status["executedQty"].(float64)
+	r.AvgFillPrice, _ = status["avgPrice"].(float64)
+	if commission, ok := status["commission"].(float64); ok {
+		r.Commission = commission
+	}
+	r.SlippageBps = limitSlippageBps(r.Side, r.LimitPrice, r.AvgFillPrice)
+}
+
+// limitSlippageBps 计算成交均价相对限价的滑点（基点）：买单成交高于限价、卖单成交低于限价为正
+func limitSlippageBps(side string, limitPrice, avgFillPrice float64) float64 {
+	if limitPrice <= 0 || avgFillPrice <= 0 {
+		return 0
+	}
+	slippage := (avgFillPrice - limitPrice) / limitPrice * 10000
+	if side == "SELL" {
+		slippage = -slippage
+	}
+	return slippage
+}
+
+// recordExecutionCosts 将执行报告中的手续费与滑点写入决策动作，供绩效分析统计扣费后的盈亏
+func recordExecutionCosts(actionRecord *logger.DecisionAction, report *LimitOrderExecutionReport) {
+	if report == nil {
+		return
+	}
+	actionRecord.Commission = report.Commission
+	actionRecord.SlippageBps = report.SlippageBps
 }
 
 // PositionTarget 用来记住这个持仓当初AI给的三个止盈点位，以及当前走到哪一段了
@@ -45,8 +83,15 @@ type PositionTarget struct {
 	TP1       float64 `json:"tp1"`
 	TP2       float64 `json:"tp2"`
 	TP3       float64 `json:"tp3"`
-	Stage     int     `json:"stage"`      // 0=还没到tp1, 1=到过tp1, 2=到过tp2, 3=到过tp3
-	CurrentSL float64 `json:"current_sl"` // 当前已生效的止损价（开仓时=初始止损）
+	Stage     int     `json:"stage"`                // 0=还没到tp1, 1=到过tp1, 2=到过tp2, 3=到过tp3
+	CurrentSL float64 `json:"current_sl"`           // 当前已生效的止损价（开仓时=初始止损）
+	CurrentTP float64 `json:"current_tp,omitempty"` // 当前已生效的止盈价（开仓时=take_profit）
+
+	// 连续移动止损（update_trailing_stop），二选一，均为0表示只按TP阶段移动
+	TrailingATRMult float64 `json:"trailing_atr_mult,omitempty"` // 距标记价 N×ATR14(4h)
+	TrailingPct     float64 `json:"trailing_pct,omitempty"`      // 距标记价百分比
+
+	TrailingAfterTP3 bool `json:"trailing_after_tp3,omitempty"` // 已在TP3撤销止盈单改为移动止损
 }
 
 // PendingOrder 待成交的限价单
@@ -78,7 +123,7 @@ type AutoTraderConfig struct {
 
 	// 交易平台选择
 	Exchange   string // "binance", "hyperliquid" 或 "aster"
-	TraderMode string // "paper" 或 "binance"，默认 "binance"
+	TraderMode string // "paper"、"shadow"（真实账户只读，不下单）或 "binance"，默认 "binance"
 
 	// M2.2: 限价订单生命周期管理配置
 	LimitOrderWaitSeconds    int  `json:"limit_order_wait_seconds"`     // 等待成交超时时间(秒)
@@ -87,6 +132,35 @@ type AutoTraderConfig struct {
 	CancelOnPartialFill      bool `json:"cancel_on_partial_fill"`       // 是否在部分成交时取消剩余
 	PostOnlyWhenLimitOnly    bool `json:"post_only_when_limit_only"`    // limit_only模式时是否使用post-only
 
+	// 仓位计算模式: "fixed"(默认，使用AI给出的仓位) 或 "kelly"（按历史胜率/盈亏比的分数Kelly，受分层风控上限约束）
+	PositionSizingMode   string        `json:"position_sizing_mode"`
+	KellyFraction        float64       `json:"kelly_fraction"`         // Kelly系数（0.25 表示 1/4 Kelly），<=0 时默认0.25
+	KellyMinTrades       int           `json:"kelly_min_trades"`       // 启用Kelly所需最少历史交易数，不足时回退固定仓位，<=0 时默认20
+	KellyRefreshInterval time.Duration `json:"kelly_refresh_interval"` // Kelly比例重新计算间隔，<=0 时默认1小时
+
+	// 挂单数量上限（按 pendingOrders 计数，0 表示不限制）
+	MaxPendingLimitOrders          int `json:"max_pending_limit_orders"`            // 同时挂着的限价单总数上限
+	MaxPendingLimitOrdersPerSymbol int `json:"max_pending_limit_orders_per_symbol"` // 单币种同时挂着的限价单上限
+
+	// 开仓止损放置方式: "ai"(默认，使用AI止损)、"structure"（用4h结构止损替换AI止损）或 "validate"（AI止损落在结构内时放宽到结构止损）
+	StopLossPlacement      string  `json:"stop_loss_placement"`
+	StructureStopATRBuffer float64 `json:"structure_stop_atr_buffer"` // 结构止损在支撑/压力区外侧的ATR缓冲倍数，<=0 时默认0.5
+
+	// 最低账户净值（USDT，0 表示不限制）：净值低于该值时只管理/平仓已有持仓，拒绝新开仓（与日亏损熔断相互独立）
+	MinAccountEquity float64 `json:"min_account_equity"`
+
+	// 决策币种不在本周期分析集合内时的处理: "lenient"(默认，按需补拉该币种数据) 或 "strict"（直接拒绝）
+	OffListSymbolPolicy string `json:"off_list_symbol_policy"`
+
+	// 开仓订单类型: "auto"(默认，按门禁/AI偏好) 或 "limit_maker"（所有开仓强制maker限价）
+	// 为空时使用全局配置 config.Config.OpeningOrderType
+	OpeningOrderType string `json:"opening_order_type"`
+
+	// limit_only 门禁下的平仓策略: "market"(默认，直接市价平仓)、"escalate"(先挂maker限价单，超时未成交升级为市价)、
+	// "limit"(仅maker限价单，未成交则放弃本次平仓)
+	CloseLimitOnlyPolicy  string `json:"close_limit_only_policy"`
+	CloseMakerWaitSeconds int    `json:"close_maker_wait_seconds"` // 平仓maker单最长等待时间(秒)，<=0 时使用 LimitOrderWaitSeconds
+
 	// 币安API配置
 	BinanceAPIKey    string
 	BinanceSecretKey string
@@ -117,6 +191,12 @@ type AutoTraderConfig struct {
 	CustomAPIKey    string
 	CustomModelName string
 
+	// 备用AI配置（主模型调用失败时改用，FallbackAIModel 为空表示不启用）
+	FallbackAIModel   string // "deepseek" / "qwen" / "custom"
+	FallbackAPIKey    string
+	FallbackAPIURL    string // 为空时使用对应provider的默认地址（custom 必填）
+	FallbackModelName string
+
 	// 扫描配置
 	ScanInterval time.Duration // 扫描间隔（建议3分钟）
 
@@ -128,12 +208,13 @@ type AutoTraderConfig struct {
 	AltcoinLeverage int // 山寨币的杠杆倍数
 
 	// 风险控制（仅作为提示，AI可自主决定）
-	MaxDailyLoss    float64       // 最大日亏损百分比（提示）
+	MaxDailyLoss    float64       // 最大日亏损百分比（相对初始余额，超过后停止开新仓并暂停 StopTradingTime）
 	MaxDrawdown     float64       // 最大回撤百分比（提示）
 	StopTradingTime time.Duration // 触发风控后暂停时长
 
 	// 仓位模式
 	IsCrossMargin bool // true=全仓模式, false=逐仓模式
+	IsHedgeMode   bool // true=双向持仓（同币种可同时持有多空）, false=单向持仓（同币种只允许一个方向）
 
 	// 币种配置
 	DefaultCoins []string // 默认币种列表（从数据库获取）
@@ -141,21 +222,77 @@ type AutoTraderConfig struct {
 
 	// 系统提示词模板
 	SystemPromptTemplate string // 系统提示词模板名称（如 "default", "aggressive"）
+	UserID               string // 交易员所属用户，用于解析用户自定义提示词模板
+
+	// 分析周期
+	AnalysisTimeframes    []string // 获取/分析的K线周期（如 ["1h","4h"]），为空使用默认5m/15m/1h/4h
+	MarketDataConcurrency int      // 每周期并发获取市场数据的币种数上限，<=0 时默认10
+	AnalysisBatchSize     int      // 每次AI调用分析的候选币数量（控制提示词长度），<=0 时一次分析全部
+	MaxPromptChars        int      // 用户提示词字符预算，超出时优先裁剪候选币的K线形态/指标序列，<=0 不限制
+
+	// 指标阈值规则
+	IndicatorRules []decision.IndicatorRule // 开仓硬性校验规则（如 4h RSI14 > 75 禁止开多），命中则拒绝
+
+	// 每日汇总
+	DailySummaryTime string // 每日汇总生成时间（本地时间 "HH:MM"），为空时使用全局配置，均为空则不生成
+
+	// 用户数据流：交易所推送订单成交/持仓变化，及时同步限价单与止损阶段（轮询仍作为兜底），false 时使用全局配置
+	UserDataStream bool
+
+	// 到达TP3后撤销止盈单，剩余仓位改为连续移动止损（让利润奔跑），均为0时使用全局配置，仍为0则TP3照常平仓
+	TP3TrailATRMult float64 // 距标记价 N×ATR14(4h)，优先于百分比
+	TP3TrailPct     float64 // 距标记价百分比
+
+	// 止损/止盈变更阈值（避免AI每周期微调价位导致反复改单），均为0时不限制
+	MinSLTPChangePct float64 // 新价位与当前价位的差距需超过当前价位的百分比（如 0.1 表示 0.1%）
+	MinSLTPChangeAbs float64 // 新价位与当前价位的差距需超过的绝对价格
+
+	// 看门狗：超过 WatchdogTimeout 未成功完成决策周期时告警并执行 WatchdogAction，0 表示关闭
+	WatchdogTimeout         time.Duration
+	WatchdogAction          string  // "alert"(仅告警，默认) / "flatten"(市价平掉全部持仓) / "tighten_stops"(收紧止损)
+	WatchdogStopDistancePct float64 // tighten_stops 时新止损距当前价的百分比，<=0 时默认 0.5
+
+	// 最大不利波动（MAE）硬性平仓：未实现亏损达到保证金的该百分比时强制市价平仓，独立于AI止损，0 表示关闭
+	MaxAdverseExcursionPct       float64
+	MaxAdverseExcursionPctSymbol map[string]float64 // 按币种覆盖（如 {"BTCUSDT": 30}），<=0 表示该币种关闭
+
+	// EMA反穿离场：所选周期已收盘K线逆持仓方向收穿 EMA 时，独立于AI平仓或收紧止损，EMACrossExitPeriod 为0表示关闭
+	EMACrossExitTimeframe       string  // "5m"/"15m"/"1h"/"4h"，默认 "1h"
+	EMACrossExitPeriod          int     // 须为该周期已计算的EMA（5m: 20；15m: 20/50；1h/4h: 20/50/100/200）
+	EMACrossExitAction          string  // "close"(市价平仓，默认) / "tighten_stop"(收紧止损)
+	EMACrossExitStopDistancePct float64 // tighten_stop 时新止损距当前价的百分比，<=0 时默认 0.5
+
+	// 净值快照记录间隔（设置了快照存储时生效），<=0 时默认5分钟
+	EquitySnapshotInterval time.Duration
+
+	// 决策日志缓冲写入（交易员较多时减少频繁小文件写入），均为0时逐条同步写入
+	DecisionLogBatchSize     int           // 每攒够多少条记录落盘一次，<=0 时默认20
+	DecisionLogFlushInterval time.Duration // 定时落盘间隔，<=0 时默认5秒
+
+	// 仅观察币种（如 BTC 作为大盘风向标）：获取行情并写入提示词，但拒绝任何开仓
+	ObserveOnlySymbols []string
+
+	// 大盘 risk-off 防护（按交易员启用）：BTC 4h 下跌趋势/急跌/极端波动时限制山寨币开仓，为空表示关闭
+	RiskOffGuard string // "block_alt_longs"(禁止山寨币开多) / "limit_only"(山寨币只允许限价开仓)
 }
 
 // AutoTrader 自动交易器
 type AutoTrader struct {
-	id                    string // Trader唯一标识
-	name                  string // Trader显示名称
-	aiModel               string // AI模型名称
-	exchange              string // 交易平台名称
+	id                    string                       // Trader唯一标识
+	name                  string                       // Trader显示名称
+	aiModel               string                       // AI模型名称
+	exchange              string                       // 交易平台名称
+	marketSource          market.MarketDataSource      // 行情数据源（Hyperliquid/Aster 使用交易所自己的行情），nil 使用默认数据源
+	symbolFilters         market.SymbolFiltersProvider // 交易所过滤器（币安实盘为交易器缓存的 exchangeInfo），nil 使用 market 的全局提供者
 	config                AutoTraderConfig
 	globalConfig          *config.Config // 全局配置（包含分层风控配置）
 	trader                Trader         // 使用Trader接口（支持多平台）
 	mcpClient             *mcp.Client
+	fallbackClient        *mcp.Client            // 备用AI客户端（未配置时为nil）
 	decisionLogger        *logger.DecisionLogger // 决策日志记录器
 	initialBalance        float64
 	dailyPnL              float64
+	dailyStartEquity      float64  // 当日首个周期的账户净值（计算 dailyPnL 的基准，0 表示待记录）
 	customPrompt          string   // 自定义交易策略prompt
 	overrideBasePrompt    bool     // 是否覆盖基础prompt
 	systemPromptTemplate  string   // 系统提示词模板名称
@@ -163,15 +300,27 @@ type AutoTrader struct {
 	tradingCoins          []string // 实际交易币种列表
 	lastResetTime         time.Time
 	stopUntil             time.Time
+	runMu                 sync.Mutex // 保护 isRunning/stopChan/扫描间隔（Run 与 Stop 在不同goroutine调用）
 	isRunning             bool
-	stopChan              chan struct{}    // 停止信号通道
-	startTime             time.Time        // 系统启动时间
-	callCount             int              // AI调用次数
-	positionFirstSeenTime map[string]int64 // 持仓首次出现时间 (symbol_side -> timestamp毫秒)
+	stopChan              chan struct{}      // 停止信号通道
+	intervalChan          chan time.Duration // 扫描间隔变更通知（运行中重置ticker）
+	runCtx                context.Context    // 运行期上下文，Stop 时取消以中断进行中的市场数据请求
+	runCancel             context.CancelFunc
+	cycleMu               sync.Mutex          // 决策周期互斥（同一时刻只执行一个周期，用户数据流事件和看门狗动作也在锁内处理）
+	cycleRunning          atomic.Bool         // 决策周期是否在执行（只由 runExclusiveCycle 设置，用于判断周期重叠）
+	skippedCycles         atomic.Int64        // 因上一周期未结束而跳过的扫描次数
+	startTime             time.Time           // 系统启动时间
+	callCount             int                 // AI调用次数
+	runtimeStore          RuntimeStateStore   // 运行状态持久化（nil 表示不持久化）
+	equityStore           EquitySnapshotStore // 净值快照持久化（nil 表示不记录）
+	positionFirstSeenTime map[string]int64    // 持仓首次出现时间 (symbol_side -> timestamp毫秒)
 
 	// 记住这个持仓当初AI给的TP1/TP2/TP3
 	positionTargets map[string]*PositionTarget // key: "BTCUSDT_long" / "ETHUSDT_short"
 
+	// 各持仓当前生效的止损/止盈条件单ID（OCO联动撤单），key 同 positionTargets
+	protectiveOrders map[string]*ProtectiveOrderIDs
+
 	// 记住最新的持仓快照（用于检测交易所自动平仓）
 	positionMemory  map[string]decision.PositionInfo
 	autoCloseEvents []logger.DecisionAction
@@ -191,6 +340,18 @@ type AutoTrader struct {
 
 	// 止损历史记录 (symbol_direction -> []stopLossTime_ms)
 	stopLossHistory map[string][]int64
+
+	// 最近一次周期的账户净值与Kelly仓位比例缓存
+	lastAccountEquity float64
+	kellySizing       kellySizingState
+
+	// 本周期已分析币种的市场数据（用于校验决策币种，宽松模式下按需补充）
+	cycleMarketData map[string]*market.Data
+
+	// 看门狗状态：最近一次成功完成周期的时间，以及本次停滞是否已触发过
+	watchdogMu       sync.Mutex
+	lastCycleSuccess time.Time
+	watchdogFired    bool
 }
 
 // NewAutoTrader 创建自动交易器
@@ -250,6 +411,8 @@ func NewAutoTrader(config AutoTraderConfig, globalConfig *config.Config) (*AutoT
 
 	// 根据配置创建对应的交易器
 	var trader Trader
+	var marketSource market.MarketDataSource
+	var symbolFilters market.SymbolFiltersProvider
 	var err error
 
 	// 记录仓位模式（通用）
@@ -265,30 +428,40 @@ func NewAutoTrader(config AutoTraderConfig, globalConfig *config.Config) (*AutoT
 		trader = NewPaperTrader()
 	} else {
 		// 真实交易模式
-	switch config.Exchange {
-	case "binance":
-		log.Printf("🏦 [%s] 使用币安合约交易", config.Name)
+		switch config.Exchange {
+		case "binance":
+			log.Printf("🏦 [%s] 使用币安合约交易", config.Name)
 			// 使用配置的止损工作类型，默认MARK_PRICE更抗插针
 			stopLossWorkingType := config.StopLossWorkingType
 			if stopLossWorkingType == "" {
 				stopLossWorkingType = "MARK_PRICE" // 默认值
 			}
-			trader = NewFuturesTraderWithConfig(config.BinanceAPIKey, config.BinanceSecretKey,
+			futuresTrader := NewFuturesTraderWithConfig(config.BinanceAPIKey, config.BinanceSecretKey,
 				stopLossWorkingType, config.EnablePriceProtect)
-	case "hyperliquid":
-		log.Printf("🏦 [%s] 使用Hyperliquid交易", config.Name)
-		trader, err = NewHyperliquidTrader(config.HyperliquidPrivateKey, config.HyperliquidWalletAddr, config.HyperliquidTestnet)
-		if err != nil {
-			return nil, fmt.Errorf("初始化Hyperliquid交易器失败: %w", err)
-		}
-	case "aster":
-		log.Printf("🏦 [%s] 使用Aster交易", config.Name)
-		trader, err = NewAsterTrader(config.AsterUser, config.AsterSigner, config.AsterPrivateKey)
-		if err != nil {
-			return nil, fmt.Errorf("初始化Aster交易器失败: %w", err)
+			// 启动时预加载 exchangeInfo 过滤器（之后按小时刷新），开仓前的数量/价格对齐使用该缓存
+			go futuresTrader.maybeRefreshSymbolFilters()
+			symbolFilters = futuresTrader
+			trader = futuresTrader
+		case "hyperliquid":
+			log.Printf("🏦 [%s] 使用Hyperliquid交易", config.Name)
+			trader, err = NewHyperliquidTrader(config.HyperliquidPrivateKey, config.HyperliquidWalletAddr, config.HyperliquidTestnet)
+			if err != nil {
+				return nil, fmt.Errorf("初始化Hyperliquid交易器失败: %w", err)
+			}
+			marketSource = &market.HyperliquidSource{}
+		case "aster":
+			log.Printf("🏦 [%s] 使用Aster交易", config.Name)
+			trader, err = NewAsterTrader(config.AsterUser, config.AsterSigner, config.AsterPrivateKey)
+			if err != nil {
+				return nil, fmt.Errorf("初始化Aster交易器失败: %w", err)
+			}
+			marketSource = &market.AsterSource{}
+		default:
+			return nil, fmt.Errorf("不支持的交易平台: %s", config.Exchange)
 		}
-	default:
-		return nil, fmt.Errorf("不支持的交易平台: %s", config.Exchange)
+		if config.TraderMode == "shadow" {
+			log.Printf("🕶 [%s] 使用影子模式 (读取真实账户余额/持仓，不发送任何订单)", config.Name)
+			trader = newShadowTrader(trader)
 		}
 	}
 
@@ -297,6 +470,15 @@ func NewAutoTrader(config AutoTraderConfig, globalConfig *config.Config) (*AutoT
 		return nil, fmt.Errorf("初始金额必须大于0，请在配置中设置InitialBalance")
 	}
 
+	if err := ValidateOpeningOrderType(config.OpeningOrderType); err != nil {
+		return nil, err
+	}
+	if config.DailySummaryTime != "" {
+		if _, _, err := logger.ParseReportTime(config.DailySummaryTime); err != nil {
+			return nil, err
+		}
+	}
+
 	// 初始化决策日志记录器（使用trader ID创建独立目录）
 	logDir := fmt.Sprintf("decision_logs/%s", config.ID)
 	decisionLogger := logger.NewDecisionLogger(logDir)
@@ -313,10 +495,13 @@ func NewAutoTrader(config AutoTraderConfig, globalConfig *config.Config) (*AutoT
 		name:                  config.Name,
 		aiModel:               config.AIModel,
 		exchange:              config.Exchange,
+		marketSource:          marketSource,
+		symbolFilters:         symbolFilters,
 		config:                config,
 		globalConfig:          globalConfig,
 		trader:                trader,
 		mcpClient:             mcpClient,
+		fallbackClient:        newFallbackMCPClient(config),
 		decisionLogger:        decisionLogger,
 		initialBalance:        config.InitialBalance,
 		systemPromptTemplate:  systemPromptTemplate,
@@ -328,6 +513,7 @@ func NewAutoTrader(config AutoTraderConfig, globalConfig *config.Config) (*AutoT
 		isRunning:             false,
 		positionFirstSeenTime: make(map[string]int64),
 		positionTargets:       make(map[string]*PositionTarget),
+		protectiveOrders:      make(map[string]*ProtectiveOrderIDs),
 		positionMemory:        make(map[string]decision.PositionInfo),
 		autoCloseEvents:       make([]logger.DecisionAction, 0),
 		pendingOrders:         make(map[string]*PendingOrder),
@@ -338,11 +524,18 @@ func NewAutoTrader(config AutoTraderConfig, globalConfig *config.Config) (*AutoT
 	}, nil
 }
 
+// dailyPairTradesPath 每日开单计数文件路径，与决策记录保存在同一目录
+func (at *AutoTrader) dailyPairTradesPath() string {
+	logDir := filepath.Join("decision_logs", at.id)
+	if at.decisionLogger != nil {
+		logDir = at.decisionLogger.LogDir()
+	}
+	return filepath.Join(logDir, "daily_pair_trades.json")
+}
+
 // loadDailyPairTrades 从磁盘加载每日开单计数（如果存在且为今天则恢复）
 func (at *AutoTrader) loadDailyPairTrades() {
-	// compute log dir (decision logger stores logs under decision_logs/<trader_id>)
-	logDir := filepath.Join("decision_logs", at.id)
-	path := filepath.Join(logDir, "daily_pair_trades.json")
+	path := at.dailyPairTradesPath()
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		// 文件不存在或无法读取，保持当前内存计数
@@ -369,11 +562,7 @@ func (at *AutoTrader) loadDailyPairTrades() {
 
 // saveDailyPairTrades 将当前每日开单计数写盘（覆盖）
 func (at *AutoTrader) saveDailyPairTrades() {
-	if at.decisionLogger == nil {
-		// still compute logDir based on trader id to allow persistence
-	}
-	logDir := filepath.Join("decision_logs", at.id)
-	path := filepath.Join(logDir, "daily_pair_trades.json")
+	path := at.dailyPairTradesPath()
 	payload := struct {
 		Date   string         `json:"date"`
 		Trades map[string]int `json:"trades"`
@@ -386,7 +575,7 @@ func (at *AutoTrader) saveDailyPairTrades() {
 		return
 	}
 	// 尝试创建目录（已由 DecisionLogger 创建过，但以防万一）
-	_ = os.MkdirAll(logDir, 0755)
+	_ = os.MkdirAll(filepath.Dir(path), 0755)
 	_ = ioutil.WriteFile(path, data, 0644)
 }
 
@@ -412,51 +601,238 @@ func (at *AutoTrader) decrementDailyPairTrades(symbol string) {
 	}
 }
 
+// defaultScanInterval 未配置扫描间隔时的默认值
+const defaultScanInterval = 3 * time.Minute
+
 // Run 运行自动交易主循环
 func (at *AutoTrader) Run() error {
+	stopChan := make(chan struct{})
+	intervalChan := make(chan time.Duration, 1)
+	runCtx, runCancel := context.WithCancel(context.Background())
+	defer runCancel()
+	at.runMu.Lock()
 	at.isRunning = true
-	at.stopChan = make(chan struct{})
+	at.stopChan = stopChan
+	at.intervalChan = intervalChan
+	at.runCtx = runCtx
+	at.runCancel = runCancel
+	at.runMu.Unlock()
+
+	scanInterval := at.ScanInterval()
 	log.Println("🚀 AI驱动自动交易系统启动")
 	log.Printf("💰 初始余额: %.2f USDT", at.initialBalance)
-	log.Printf("⚙️  扫描间隔: %v", at.config.ScanInterval)
+	log.Printf("⚙️  扫描间隔: %v", scanInterval)
 	log.Println("🤖 AI将全权决定杠杆、仓位大小、止损止盈等参数")
 
-	// 每3分钟扫描一次市场
-	ticker := time.NewTicker(3 * time.Minute)
+	// 决策日志缓冲写入，退出时落盘
+	if at.config.DecisionLogBatchSize > 0 || at.config.DecisionLogFlushInterval > 0 {
+		at.decisionLogger.EnableBuffering(at.config.DecisionLogBatchSize, at.config.DecisionLogFlushInterval)
+		defer at.decisionLogger.Stop()
+	}
+
+	// 每日汇总调度
+	if scheduler := at.newDailySummaryScheduler(); scheduler != nil {
+		scheduler.Start()
+		defer scheduler.Stop()
+	}
+
+	// 按配置的扫描间隔扫描市场（未配置时默认3分钟）
+	ticker := time.NewTicker(scanInterval)
 	defer ticker.Stop()
 
+	// 双向持仓模式：启动时切换交易所持仓模式（需在无持仓/挂单时才能切换成功）
+	at.applyPositionMode()
+
+	// 启动对账：接管交易所上已存在的止损/止盈条件单，避免重复挂单
+	if err := at.reconcileProtectiveOrders(); err != nil {
+		log.Printf("⚠️ 启动对账失败: %v", err)
+	}
+
+	// 看门狗：决策循环停滞时告警并按配置平仓或收紧止损
+	at.markCycleSuccess()
+	if at.config.WatchdogTimeout > 0 {
+		go at.runWatchdog(stopChan)
+	}
+
+	// 净值快照：独立于决策周期定时记录账户净值
+	if at.equityStore != nil {
+		go at.runEquitySnapshots(stopChan)
+	}
+
 	// 首次立即执行
-	if err := at.runCycle(); err != nil {
-		log.Printf("❌ 执行失败: %v", err)
+	at.tryRunCycle()
+
+	// 决策周期在独立goroutine中执行，主循环保持响应；退出前等待进行中的周期结束
+	var cycleWG sync.WaitGroup
+	defer cycleWG.Wait()
+
+	// 用户数据流（未启用或交易所不支持时为nil），事件与决策周期互斥处理
+	if userEvents := at.startUserDataStream(runCtx); userEvents != nil {
+		cycleWG.Add(1)
+		go func() {
+			defer cycleWG.Done()
+			at.consumeUserDataEvents(userEvents)
+		}()
 	}
 
-	for at.isRunning {
+	for {
 		select {
 		case <-ticker.C:
-			if err := at.runCycle(); err != nil {
-				log.Printf("❌ 执行失败: %v", err)
-			}
-		case <-at.stopChan:
+			cycleWG.Add(1)
+			go func() {
+				defer cycleWG.Done()
+				at.tryRunCycle()
+			}()
+		case interval := <-intervalChan:
+			ticker.Reset(interval)
+			log.Printf("⚙️  扫描间隔已更新为 %v", interval)
+		case <-stopChan:
 			log.Println("⏹ 收到停止信号，正在退出...")
+			runCancel() // 关闭用户数据流并中断进行中周期的市场数据请求
 			return nil
 		}
 	}
+}
 
-	return nil
+// tryRunCycle 非阻塞地执行一次决策周期：上一周期仍在执行（如AI响应慢于扫描间隔）时跳过本次，
+// 记录日志并计入 skipped_cycles，避免并发周期重复开仓、破坏 pendingOrders
+func (at *AutoTrader) tryRunCycle() bool {
+	return at.runExclusiveCycle(at.runCycle)
+}
+
+// runExclusiveCycle 在持有 cycleMu 的情况下执行 cycle，上一决策周期仍在执行时立即返回 false。
+// 重叠只按 cycleRunning 判断；cycleMu 仅被用户数据流事件或看门狗占用时阻塞等待其处理完，不跳过本次扫描
+func (at *AutoTrader) runExclusiveCycle(cycle func() error) bool {
+	if !at.cycleRunning.CompareAndSwap(false, true) {
+		skipped := at.skippedCycles.Add(1)
+		log.Printf("⏭️ [%s] 上一决策周期仍在执行，跳过本次扫描（累计跳过 %d 次）", at.name, skipped)
+		return false
+	}
+	defer at.cycleRunning.Store(false)
+
+	at.cycleMu.Lock()
+	defer at.cycleMu.Unlock()
+
+	if err := cycle(); err != nil {
+		log.Printf("❌ 执行失败: %v", err)
+	} else {
+		at.markCycleSuccess()
+	}
+	return true
+}
+
+// newDailySummaryScheduler 创建每日汇总调度器：汇总写入日志目录并输出到日志，未配置汇总时间时返回nil
+func (at *AutoTrader) newDailySummaryScheduler() *logger.DailySummaryScheduler {
+	reportTime := at.config.DailySummaryTime
+	if reportTime == "" && at.globalConfig != nil {
+		reportTime = at.globalConfig.DailySummaryTime
+	}
+	if reportTime == "" {
+		return nil
+	}
+
+	scheduler, err := logger.NewDailySummaryScheduler(at.decisionLogger, at.id, reportTime, logger.DefaultTakerFeeRate,
+		at.decisionLogger.SaveDailySummary,
+		func(summary *logger.DailySummary) error {
+			log.Print(summary.Format())
+			return nil
+		},
+	)
+	if err != nil {
+		log.Printf("⚠️ 每日汇总未启用: %v", err)
+		return nil
+	}
+	log.Printf("📊 每日汇总已启用，生成时间: %s", reportTime)
+	return scheduler
 }
 
-// Stop 停止自动交易
+// Stop 停止自动交易（可重复调用，重复调用时不做任何操作）
 func (at *AutoTrader) Stop() {
+	at.runMu.Lock()
+	defer at.runMu.Unlock()
+
 	at.isRunning = false
-	if at.stopChan != nil {
-		close(at.stopChan)
+	if at.stopChan == nil {
+		return
+	}
+	close(at.stopChan)
+	at.stopChan = nil
+	at.intervalChan = nil
+	if at.runCancel != nil {
+		at.runCancel() // 中断本周期进行中的市场数据请求
+	}
+	if at.decisionLogger != nil {
+		if err := at.decisionLogger.Flush(); err != nil {
+			log.Printf("⚠️ 决策日志落盘失败: %v", err)
+		}
 	}
 	log.Println("⏹ 自动交易系统停止")
 }
 
+// runContext 当前运行期上下文（未运行时为 Background，不可取消），携带本交易员的行情数据源
+func (at *AutoTrader) runContext() context.Context {
+	at.runMu.Lock()
+	defer at.runMu.Unlock()
+	if at.runCtx == nil {
+		return market.WithSource(context.Background(), at.marketSource)
+	}
+	return market.WithSource(at.runCtx, at.marketSource)
+}
+
+// getSymbolFilters 获取交易对过滤器，优先使用本交易员所在交易所的缓存（多个币安账户互不覆盖）
+func (at *AutoTrader) getSymbolFilters(symbol string) (*market.SymbolFilters, error) {
+	if at.symbolFilters != nil {
+		return at.symbolFilters.GetSymbolFilters(symbol)
+	}
+	return market.GetSymbolFilters(symbol)
+}
+
+// getMarketData 按本交易员的行情数据源获取市场数据
+func (at *AutoTrader) getMarketData(symbol string) (*market.Data, error) {
+	return market.GetWithContext(market.WithSource(context.Background(), at.marketSource), symbol)
+}
+
+// ScanInterval 当前使用的扫描间隔（未配置时为默认3分钟）
+func (at *AutoTrader) ScanInterval() time.Duration {
+	at.runMu.Lock()
+	defer at.runMu.Unlock()
+	if at.config.ScanInterval <= 0 {
+		return defaultScanInterval
+	}
+	return at.config.ScanInterval
+}
+
+// SetScanInterval 修改扫描间隔，运行中的主循环会立即按新间隔重置ticker（<=0 恢复默认3分钟）
+func (at *AutoTrader) SetScanInterval(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultScanInterval
+	}
+	at.runMu.Lock()
+	defer at.runMu.Unlock()
+	at.config.ScanInterval = interval
+	if at.intervalChan == nil {
+		return
+	}
+	// 丢弃尚未处理的旧值，只保留最新间隔
+	select {
+	case <-at.intervalChan:
+	default:
+	}
+	at.intervalChan <- interval
+}
+
+// IsRunning 交易主循环是否在运行
+func (at *AutoTrader) IsRunning() bool {
+	at.runMu.Lock()
+	defer at.runMu.Unlock()
+	return at.isRunning
+}
+
 // runCycle 运行一个交易周期（使用AI全权决策）
 func (at *AutoTrader) runCycle() error {
 	at.callCount++
+	metrics.DecisionCycles.WithLabelValues(at.id).Inc()
+	defer at.saveRuntimeState()
 
 	separator := strings.Repeat("=", 70)
 	log.Printf("\n%s", separator)
@@ -483,6 +859,7 @@ func (at *AutoTrader) runCycle() error {
 	currentDay := time.Now().Format("2006-01-02")
 	if time.Since(at.lastResetTime) > 24*time.Hour {
 		at.dailyPnL = 0
+		at.dailyStartEquity = 0
 		at.lastResetTime = time.Now()
 		log.Println("📅 日盈亏已重置")
 	}
@@ -499,8 +876,22 @@ func (at *AutoTrader) runCycle() error {
 		record.Success = false
 		record.ErrorMessage = fmt.Errorf("构建交易上下文失败: %v", err).Error()
 		at.decisionLogger.LogDecision(record)
+		metrics.DecisionFailures.WithLabelValues(at.id).Inc()
 		return fmt.Errorf("构建交易上下文失败: %w", err)
 	}
+	at.updateAccountMetrics(ctx)
+
+	at.lastAccountEquity = ctx.Account.TotalEquity
+	if at.dailyStartEquity == 0 {
+		at.dailyStartEquity = ctx.Account.TotalEquity
+	}
+	at.dailyPnL = ctx.Account.TotalEquity - at.dailyStartEquity
+	if floor := at.config.MinAccountEquity; floor > 0 && at.lastAccountEquity < floor {
+		msg := fmt.Sprintf("账户净值 %.2f USDT 低于最低净值 %.2f USDT，本周期仅管理已有持仓，不再开新仓", at.lastAccountEquity, floor)
+		log.Printf("⚠️ %s", msg)
+		record.ExecutionLog = append(record.ExecutionLog, "⚠️ "+msg)
+	}
+	at.cycleMarketData = ctx.MarketDataMap
 
 	// 保存账户状态快照
 	record.AccountState = logger.AccountSnapshot{
@@ -552,12 +943,33 @@ func (at *AutoTrader) runCycle() error {
 		log.Printf("⚠️ 同步限价单失败: %v", err)
 	}
 
+	// 3.55. 止损/止盈联动：一腿已成交时立即撤销另一腿
+	at.checkLinkedProtectiveOrders()
+
 	// 3.6. 自动检测TP触及并抬止损（代码层自动执行，不需要AI介入）
 	log.Println("🔍 检查持仓TP触及情况...")
 	if err := at.autoCheckAndUpdateStopLoss(); err != nil {
 		log.Printf("⚠️ 自动抬止损检查失败: %v", err)
 	}
 
+	// 3.7. 最大不利波动硬性平仓（防止AI止损过宽或止损单挂单失败）
+	if maeEvents := at.enforceMaxAdverseExcursion(); len(maeEvents) > 0 {
+		for _, evt := range maeEvents {
+			record.Decisions = append(record.Decisions, evt)
+			record.ExecutionLog = append(record.ExecutionLog,
+				fmt.Sprintf("🛑 %s %s 触发最大不利波动强制平仓: %s", evt.Symbol, evt.Action, evt.Reason))
+		}
+	}
+
+	// 3.8. EMA反穿离场（系统化离场，不依赖AI判断）
+	if emaEvents := at.enforceEMACrossExit(); len(emaEvents) > 0 {
+		for _, evt := range emaEvents {
+			record.Decisions = append(record.Decisions, evt)
+			record.ExecutionLog = append(record.ExecutionLog,
+				fmt.Sprintf("📉 %s %s 触发EMA反穿离场: %s", evt.Symbol, evt.Action, evt.Reason))
+		}
+	}
+
 	// 4. PreLLM Gate：检查冷却状态和极端波动
 	log.Println("🚪 执行PreLLM门控检查...")
 	skipLLM, allowedSymbols, cooldownSymbols, extremeSymbols := at.preLLMGate(ctx.CandidateCoins)
@@ -589,18 +1001,18 @@ func (at *AutoTrader) runCycle() error {
 		// 5. 调用AI获取完整决策（只对允许的symbols）
 		log.Printf("🤖 正在请求AI分析并决策... [模板: %s] [允许交易: %v]", at.systemPromptTemplate, allowedSymbols)
 
-	// 动态拼接当前持仓的TP1/TP2/TP3到本轮自定义prompt里
-	dynamicPrompt := at.buildDynamicPrompt(ctx)
-	finalPrompt := at.customPrompt
-	if dynamicPrompt != "" {
-		if finalPrompt != "" {
-			finalPrompt = finalPrompt + "\n\n" + dynamicPrompt
-		} else {
-			finalPrompt = dynamicPrompt
+		// 动态拼接当前持仓的TP1/TP2/TP3到本轮自定义prompt里
+		dynamicPrompt := at.buildDynamicPrompt(ctx)
+		finalPrompt := at.customPrompt
+		if dynamicPrompt != "" {
+			if finalPrompt != "" {
+				finalPrompt = finalPrompt + "\n\n" + dynamicPrompt
+			} else {
+				finalPrompt = dynamicPrompt
+			}
 		}
-	}
 
-		decisionResp, err = decision.GetFullDecisionWithCustomPromptAndTraderID(ctx, at.mcpClient, finalPrompt, at.overrideBasePrompt, at.systemPromptTemplate, at.id, at.globalConfig)
+		decisionResp, record.AIModel, err = at.requestAIDecision(ctx, finalPrompt)
 
 		// 如果LLM调用成功，合并冷却symbol的决策
 		if err == nil && decisionResp != nil {
@@ -616,12 +1028,12 @@ func (at *AutoTrader) runCycle() error {
 		record.SystemPrompt = decisionResp.SystemPrompt // 保存系统提示词
 		record.InputPrompt = decisionResp.UserPrompt
 		record.CoTTrace = decisionResp.CoTTrace
-		
+
 		// 保存当前思维链供下一周期参考
 		if decisionResp.CoTTrace != "" {
 			at.lastCoTTrace = decisionResp.CoTTrace
 		}
-		
+
 		if len(decisionResp.Decisions) > 0 {
 			decisionJSON, _ := json.MarshalIndent(decisionResp.Decisions, "", "  ")
 			record.DecisionJSON = string(decisionJSON)
@@ -653,11 +1065,11 @@ func (at *AutoTrader) runCycle() error {
 				log.Printf("⚠️ AI决策被风控拦截: %s", decisionErr.Message)
 			} else {
 				// 其他DecisionError类型仍按error处理
-		record.Success = false
+				record.Success = false
 				record.Status = "error"
 				record.ErrorType = string(decisionErr.Type)
 				record.ErrorSeverity = "error"
-		record.ErrorMessage = fmt.Sprintf("获取AI决策失败: %v", err)
+				record.ErrorMessage = fmt.Sprintf("获取AI决策失败: %v", err)
 			}
 		} else {
 			// 普通错误
@@ -694,7 +1106,8 @@ func (at *AutoTrader) runCycle() error {
 		if record.Status == "warning" && record.ErrorType == "DECISION_VALIDATION_REJECTED" {
 			log.Printf("✅ 继续执行流程（AI分析成功，仅决策被风控拦截）")
 		} else {
-		return fmt.Errorf("获取AI决策失败: %w", err)
+			metrics.DecisionFailures.WithLabelValues(at.id).Inc()
+			return fmt.Errorf("获取AI决策失败: %w", err)
 		}
 	}
 
@@ -709,6 +1122,20 @@ func (at *AutoTrader) runCycle() error {
 	}
 	log.Println()
 
+	// 日亏损熔断：超限后本周期拒绝所有开仓，并暂停 StopTradingTime
+	if breached, msg := at.checkDailyLossLimit(); breached {
+		log.Printf("🛑 %s", msg)
+		record.ExecutionLog = append(record.ExecutionLog, "🛑 "+msg)
+	}
+
+	// 并发仓位上限（按账户分层的 MaxConcurrentPositions）：持仓+待成交限价单已占用的位置之外，按信心度保留开仓决策，其余跳过
+	maxSlots := 0
+	if at.globalConfig != nil {
+		maxSlots = decision.GetMaxConcurrentSlots(ctx.Account.TotalEquity, &at.globalConfig.RiskManagement)
+	}
+	sortedDecisions, capReasons := validateConcurrentPositionCap(sortedDecisions, at.occupiedPositions(ctx.Positions), maxSlots)
+	record.ExecutionLog = append(record.ExecutionLog, capReasons...)
+
 	// 执行决策并记录结果
 	for _, d := range sortedDecisions {
 		actionRecord := logger.DecisionAction{
@@ -723,6 +1150,7 @@ func (at *AutoTrader) runCycle() error {
 
 		if err := at.executeDecisionWithRecord(&d, &actionRecord); err != nil {
 			log.Printf("❌ 执行决策失败 (%s %s): %v", d.Symbol, d.Action, err)
+			metrics.OrderFailures.WithLabelValues(at.id, d.Action).Inc()
 			actionRecord.Error = err.Error()
 			record.ExecutionLog = append(record.ExecutionLog, fmt.Sprintf("❌ %s %s 失败: %v", d.Symbol, d.Action, err))
 		} else {
@@ -735,6 +1163,13 @@ func (at *AutoTrader) runCycle() error {
 		record.Decisions = append(record.Decisions, actionRecord)
 	}
 
+	// 影子模式：所有动作均为模拟执行
+	if at.IsShadowMode() {
+		for i := range record.Decisions {
+			record.Decisions[i].Simulated = true
+		}
+	}
+
 	// 9. 保存决策记录
 	if err := at.decisionLogger.LogDecision(record); err != nil {
 		log.Printf("⚠ 保存决策记录失败: %v", err)
@@ -743,6 +1178,18 @@ func (at *AutoTrader) runCycle() error {
 	return nil
 }
 
+// updateAccountMetrics 用本周期的交易上下文更新账户相关指标
+func (at *AutoTrader) updateAccountMetrics(ctx *decision.Context) {
+	unrealizedPnL := 0.0
+	for _, pos := range ctx.Positions {
+		unrealizedPnL += pos.UnrealizedPnL
+	}
+	metrics.TraderEquity.WithLabelValues(at.id).Set(ctx.Account.TotalEquity)
+	metrics.TraderUnrealizedPnL.WithLabelValues(at.id).Set(unrealizedPnL)
+	metrics.TraderOpenPositions.WithLabelValues(at.id).Set(float64(len(ctx.Positions)))
+	metrics.TraderPendingOrders.WithLabelValues(at.id).Set(float64(len(ctx.PendingOrders)))
+}
+
 // syncPendingOrders 同步限价单状态，检测已成交的限价单并自动设置止盈止损
 func (at *AutoTrader) syncPendingOrders() error {
 	if len(at.pendingOrders) == 0 {
@@ -769,85 +1216,93 @@ func (at *AutoTrader) syncPendingOrders() error {
 
 		// 如果订单不存在，说明已成交或已取消
 		if !orderExists {
-			// 检查是否真的成交了（通过检查持仓）
-			positions, err := at.trader.GetPositions()
-			if err != nil {
-				log.Printf("  ⚠️ 获取持仓失败: %v", err)
-				// 即使获取持仓失败，也删除pending order（可能是已取消）
-				delete(at.pendingOrders, posKey)
-				delete(at.positionFirstSeenTime, posKey)
-				continue
-			}
+			at.resolvePendingOrder(posKey, pendingOrder)
+		}
+	}
 
-			// 检查是否有对应的持仓
-			hasPosition := false
-			for _, pos := range positions {
-				symbol, _ := pos["symbol"].(string)
-				side, _ := pos["side"].(string)
-				if symbol == pendingOrder.Symbol && strings.ToLower(side) == pendingOrder.Side {
-					hasPosition = true
-					
-					// 获取持仓数量
-					qty, _ := pos["positionAmt"].(float64)
-					if qty < 0 {
-						qty = -qty
-					}
+	return nil
+}
 
-					// 限价单成交后，自动设置止盈止损
-					log.Printf("  ✓ 限价单已成交: %s %s (订单ID: %d), 自动设置止盈止损",
-						pendingOrder.Symbol, pendingOrder.Side, pendingOrder.OrderID)
-					
-					// 设置止损
-					if pendingOrder.StopLoss > 0 {
-						if err := at.trader.SetStopLoss(pendingOrder.Symbol, strings.ToUpper(pendingOrder.Side), qty, pendingOrder.StopLoss); err != nil {
-							log.Printf("  ⚠️ 限价单成交后设置止损失败: %v", err)
-						} else {
-							log.Printf("  ✓ 止损已设置: %.4f", pendingOrder.StopLoss)
-						}
-					}
+// resolvePendingOrder 处理已不在挂单列表中的限价单：成交则设置止盈止损并记录TP点位，取消则直接移除
+// 由 syncPendingOrders 轮询或用户数据流推送触发
+func (at *AutoTrader) resolvePendingOrder(posKey string, pendingOrder *PendingOrder) {
+	// 检查是否真的成交了（通过检查持仓）
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		log.Printf("  ⚠️ 获取持仓失败: %v", err)
+		// 即使获取持仓失败，也删除pending order（可能是已取消）
+		delete(at.pendingOrders, posKey)
+		delete(at.positionFirstSeenTime, posKey)
+		return
+	}
 
-					// 设置止盈（TP3）
-					if pendingOrder.TakeProfit > 0 {
-						if err := at.trader.SetTakeProfit(pendingOrder.Symbol, strings.ToUpper(pendingOrder.Side), qty, pendingOrder.TakeProfit); err != nil {
-							log.Printf("  ⚠️ 限价单成交后设置止盈失败: %v", err)
-						} else {
-							log.Printf("  ✓ 止盈已设置: %.4f", pendingOrder.TakeProfit)
-						}
-					}
+	// 检查是否有对应的持仓
+	hasPosition := false
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		if symbol == pendingOrder.Symbol && strings.ToLower(side) == pendingOrder.Side {
+			hasPosition = true
 
-					// 记录AI给的三个止盈点位（与市价单相同）
-					at.positionTargets[posKey] = &PositionTarget{
-						TP1:       pendingOrder.TP1,
-						TP2:       pendingOrder.TP2,
-						TP3:       pendingOrder.TP3,
-						Stage:     0,
-						CurrentSL: pendingOrder.StopLoss,
-					}
+			// 获取持仓数量
+			qty, _ := pos["positionAmt"].(float64)
+			if qty < 0 {
+				qty = -qty
+			}
 
-					// 记录开仓时间
-					at.positionFirstSeenTime[posKey] = pendingOrder.CreateTime
+			// 限价单成交后，自动设置止盈止损
+			log.Printf("  ✓ 限价单已成交: %s %s (订单ID: %d), 自动设置止盈止损",
+				pendingOrder.Symbol, pendingOrder.Side, pendingOrder.OrderID)
 
-					break
+			// 设置止损
+			if pendingOrder.StopLoss > 0 {
+				if err := at.trader.SetStopLoss(pendingOrder.Symbol, strings.ToUpper(pendingOrder.Side), qty, pendingOrder.StopLoss, true); err != nil {
+					log.Printf("  ⚠️ 限价单成交后设置止损失败: %v", err)
+				} else {
+					log.Printf("  ✓ 止损已设置: %.4f", pendingOrder.StopLoss)
 				}
 			}
 
-			if hasPosition {
-				log.Printf("  ✓ 限价单已成交并完成止盈止损设置: %s %s (订单ID: %d)",
-					pendingOrder.Symbol, pendingOrder.Side, pendingOrder.OrderID)
-			} else {
-				log.Printf("  ✓ 限价单已取消: %s %s (订单ID: %d), 从待处理列表中移除",
-					pendingOrder.Symbol, pendingOrder.Side, pendingOrder.OrderID)
+			// 设置止盈（TP3）
+			if pendingOrder.TakeProfit > 0 {
+				if err := at.trader.SetTakeProfit(pendingOrder.Symbol, strings.ToUpper(pendingOrder.Side), qty, pendingOrder.TakeProfit, true); err != nil {
+					log.Printf("  ⚠️ 限价单成交后设置止盈失败: %v", err)
+				} else {
+					log.Printf("  ✓ 止盈已设置: %.4f", pendingOrder.TakeProfit)
+				}
 			}
-
-			// 从待处理列表中移除
-			delete(at.pendingOrders, posKey)
-			if !hasPosition {
-				delete(at.positionFirstSeenTime, posKey)
+			at.trackProtectiveOrders(pendingOrder.Symbol, pendingOrder.Side)
+
+			// 记录AI给的三个止盈点位（与市价单相同）
+			at.positionTargets[posKey] = &PositionTarget{
+				TP1:       pendingOrder.TP1,
+				TP2:       pendingOrder.TP2,
+				TP3:       pendingOrder.TP3,
+				Stage:     0,
+				CurrentSL: pendingOrder.StopLoss,
+				CurrentTP: pendingOrder.TakeProfit,
 			}
+
+			// 记录开仓时间
+			at.positionFirstSeenTime[posKey] = pendingOrder.CreateTime
+
+			break
 		}
 	}
 
-	return nil
+	if hasPosition {
+		log.Printf("  ✓ 限价单已成交并完成止盈止损设置: %s %s (订单ID: %d)",
+			pendingOrder.Symbol, pendingOrder.Side, pendingOrder.OrderID)
+	} else {
+		log.Printf("  ✓ 限价单已取消: %s %s (订单ID: %d), 从待处理列表中移除",
+			pendingOrder.Symbol, pendingOrder.Side, pendingOrder.OrderID)
+	}
+
+	// 从待处理列表中移除
+	delete(at.pendingOrders, posKey)
+	if !hasPosition {
+		delete(at.positionFirstSeenTime, posKey)
+	}
 }
 
 func (at *AutoTrader) autoCheckAndUpdateStopLoss() error {
@@ -881,7 +1336,7 @@ func (at *AutoTrader) autoCheckAndUpdateStopLoss() error {
 		}
 
 		// 获取当前市价
-		mkt, err := market.Get(symbol)
+		mkt, err := at.getMarketData(symbol)
 		if err != nil {
 			log.Printf("  ⚠️ %s 获取市价失败: %v", symbol, err)
 			continue
@@ -891,8 +1346,23 @@ func (at *AutoTrader) autoCheckAndUpdateStopLoss() error {
 		// 计算新的止损和阶段
 		newSL, newStage := computeTrailingSL(entry, strings.ToUpper(side), tgt, currentPrice)
 
+		// 连续移动止损与阶段止损合并取更紧者，同一周期只改一次止损单
+		markPrice, _ := pos["markPrice"].(float64)
+		if markPrice <= 0 {
+			markPrice = currentPrice
+		}
+		var atr float64
+		if mkt.MidTermSeries4h != nil {
+			atr = mkt.MidTermSeries4h.ATR14
+		}
+		// 启用TP3后移动止损时先切换（本周期即按标记价计算移动止损）
+		at.prepareTP3Trailing(symbol, side, tgt, newStage, markPrice, atr)
+		if trailSL := computeContinuousTrailingSL(side, tgt, markPrice, atr); trailSL > 0 {
+			newSL = tighterStop(side, newSL, trailSL)
+		}
+
 		// 如果没有变化，跳过
-		if newSL <= 0 || newSL == tgt.CurrentSL || newStage <= tgt.Stage {
+		if newSL <= 0 || newSL == tgt.CurrentSL {
 			continue
 		}
 
@@ -920,7 +1390,7 @@ func (at *AutoTrader) autoCheckAndUpdateStopLoss() error {
 					symbol, newSL, currentPrice, minSL)
 				newSL = minSL
 			}
-			if newSL >= tgt.CurrentSL {
+			if tgt.CurrentSL > 0 && newSL >= tgt.CurrentSL {
 				continue
 			}
 		}
@@ -938,9 +1408,11 @@ func (at *AutoTrader) autoCheckAndUpdateStopLoss() error {
 			case 2: // 到达 TP2：再平 1/3（剩余仓位的 1/3）
 				partialCloseQty = qty * (1.0 / 3.0)
 				partialCloseRatio = "1/3 剩余"
-			case 3: // 到达 TP3：交易所的止盈单会自动平掉全部
+			case 3: // 到达 TP3：交易所的止盈单会自动平掉全部（或已改为移动止损）
 				// 不需要手动平仓，TP3止盈单会自动触发
-				log.Printf("  🎯 %s %s 到达TP3，等待止盈单自动平仓", symbol, strings.ToUpper(side))
+				if !tgt.TrailingAfterTP3 {
+					log.Printf("  🎯 %s %s 到达TP3，等待止盈单自动平仓", symbol, strings.ToUpper(side))
+				}
 				partialCloseSuccess = true // TP3 不需要平仓，直接标记为成功
 			}
 
@@ -984,17 +1456,22 @@ func (at *AutoTrader) autoCheckAndUpdateStopLoss() error {
 			}
 		}
 
-		// 执行抬止损（无论平仓成功与否，都尝试抬止损）
+		// 执行抬止损（无论平仓成功与否，都尝试抬止损），中点价格需对齐 TickSize
+		newSL = at.roundPriceToTick(symbol, newSL)
 		log.Printf("  📈 自动抬止损: %s %s | 阶段 %d→%d | 止损 %.4f→%.4f",
 			symbol, strings.ToUpper(side), tgt.Stage, newStage, tgt.CurrentSL, newSL)
 
 		slUpdateSuccess := false
-		if err := at.trader.SetStopLoss(symbol, strings.ToUpper(side), qty, newSL); err != nil {
+		if err := at.trader.SetStopLoss(symbol, strings.ToUpper(side), qty, newSL, true); err != nil {
 			log.Printf("  ❌ %s 设置止损失败: %v", symbol, err)
 			// 抬止损失败，但继续执行 Stage 更新逻辑（如果平仓成功）
 		} else {
 			slUpdateSuccess = true
 		}
+		// 分批平仓后挂单数量已过期、新止损替换了旧止损：重新记录联动对并撤销旧单
+		if slUpdateSuccess || partialCloseQty > 0 {
+			at.trackProtectiveOrders(symbol, side)
+		}
 
 		// 更新内存记录
 		// 关键修复：只有平仓成功（或TP3不需要平仓）时，才更新 Stage
@@ -1052,14 +1529,22 @@ func (at *AutoTrader) buildDynamicPrompt(ctx *decision.Context) string {
 		sb.WriteString("# 当前持仓止盈结构（系统自动分批止盈+抬止损）\n")
 		sb.WriteString("# TP1: 自动平仓 1/4 + 抬止损到开仓价\n")
 		sb.WriteString("# TP2: 自动平仓 1/3剩余 + 抬止损到 (entry+TP1)/2\n")
-		sb.WriteString("# TP3: 止盈单自动平掉全部剩余仓位\n")
+		if atrMult, pct := at.tp3TrailSettings(); atrMult > 0 || pct > 0 {
+			sb.WriteString("# TP3: 不平仓，撤销止盈单后剩余仓位按移动止损跟随（让利润奔跑）\n")
+		} else {
+			sb.WriteString("# TP3: 止盈单自动平掉全部剩余仓位\n")
+		}
 		for _, pos := range ctx.Positions {
 			sideKey := strings.ToLower(pos.Side) // long / short
 			key := fmt.Sprintf("%s_%s", pos.Symbol, sideKey)
 			if target, ok := at.positionTargets[key]; ok && target != nil {
-				sb.WriteString(fmt.Sprintf("- %s %s | entry=%.4f | tp1=%.4f | tp2=%.4f | tp3=%.4f | stage=%d\n",
+				sb.WriteString(fmt.Sprintf("- %s %s | entry=%.4f | tp1=%.4f | tp2=%.4f | tp3=%.4f | stage=%d",
 					pos.Symbol, strings.ToUpper(pos.Side),
 					pos.EntryPrice, target.TP1, target.TP2, target.TP3, target.Stage))
+				if trailing := trailingStopDescription(target); trailing != "" {
+					sb.WriteString(fmt.Sprintf(" | trailing_stop=%s", trailing))
+				}
+				sb.WriteString("\n")
 			} else {
 				sb.WriteString(fmt.Sprintf("- %s %s | entry=%.4f | 未记录tp1/tp2/tp3，请按系统规则（1h/4h斐波那契+4h/15m区间核对）自行补全；到达tp1/tp2仅返回update_stop_loss。\n",
 					pos.Symbol, strings.ToUpper(pos.Side), pos.EntryPrice))
@@ -1172,18 +1657,7 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		if !currentPositionKeys[key] {
 			// 仓位消失了（可能被止损/止盈触发，或被強平）
 			// 提取币种名称（key 格式：BTCUSDT_long 或 SOLUSDT_short）
-			parts := strings.Split(key, "_")
-			if len(parts) == 2 {
-				symbol := parts[0]
-				log.Printf("⚠️ 检测到仓位消失: %s → 自动撤销委托单", symbol)
-
-				// 撤销该币种的所有委托单（清理孤儿止损/止盈單）
-				if err := at.trader.CancelAllOrders(symbol); err != nil {
-					log.Printf("  ⚠️ 撤销 %s 委托单失败: %v", symbol, err)
-				} else {
-					log.Printf("  ✓ 已撤销 %s 的所有委托单", symbol)
-				}
-			}
+			at.cancelOrphanOrders(key, currentPositionKeys)
 
 			// 记录自动平仓事件
 			at.recordAutoClosedPosition(key)
@@ -1191,6 +1665,7 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			delete(at.positionFirstSeenTime, key)
 			// 同步清理该持仓的TP记忆
 			delete(at.positionTargets, key)
+			delete(at.protectiveOrders, key)
 			delete(at.positionMemory, key)
 		}
 	}
@@ -1255,6 +1730,7 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		CallCount:       at.callCount,
 		BTCETHLeverage:  at.config.BTCETHLeverage,
 		AltcoinLeverage: at.config.AltcoinLeverage,
+		UserID:          at.config.UserID,
 		Account: decision.AccountInfo{
 			TotalEquity:      totalEquity,
 			AvailableBalance: availableBalance,
@@ -1264,17 +1740,79 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 			MarginUsedPct:    marginUsedPct,
 			PositionCount:    len(positionInfos),
 		},
-		Positions:            positionInfos,
-		PendingOrders:        pendingOrderInfos,
-		CandidateCoins:       candidateCoins,
-		DailyPairTrades:      at.dailyPairTrades,
-		Performance:          performance,
-		RiskManagementConfig: &at.globalConfig.RiskManagement,
+		Positions:             positionInfos,
+		PendingOrders:         pendingOrderInfos,
+		CandidateCoins:        candidateCoins,
+		DailyPairTrades:       at.dailyPairTrades,
+		Performance:           performance,
+		RiskManagementConfig:  &at.globalConfig.RiskManagement,
+		Timeframes:            at.config.AnalysisTimeframes,
+		IndicatorRules:        at.config.IndicatorRules,
+		ObserveOnlySymbols:    at.observeOnlySymbols(),
+		MarketDataConcurrency: at.config.MarketDataConcurrency,
+		AnalysisBatchSize:     at.config.AnalysisBatchSize,
+		MaxPromptChars:        at.config.MaxPromptChars,
+		RequestContext:        at.runContext(),
 	}
 
 	return ctx, nil
 }
 
+// applyPositionMode 启用双向持仓时切换交易所持仓模式，不支持切换的交易器（纸交易/影子模式等）直接跳过
+func (at *AutoTrader) applyPositionMode() {
+	if !at.config.IsHedgeMode {
+		return
+	}
+	setter, ok := at.trader.(PositionModeSetter)
+	if !ok {
+		log.Printf("⚠️ [%s] 当前交易器不支持切换持仓模式，双向持仓依赖交易所账户设置", at.name)
+		return
+	}
+	if err := setter.SetPositionMode(true); err != nil {
+		log.Printf("⚠️ [%s] 切换双向持仓模式失败: %v", at.name, err)
+	}
+}
+
+// cancelOrphanOrders 仓位消失后撤销其残留委托单（key 格式：BTCUSDT_long 或 SOLUSDT_short）。
+// 双向持仓且同币种反方向仍有持仓或限价单时，只撤销该仓位跟踪的止损/止盈单，避免误撤另一方向的委托
+func (at *AutoTrader) cancelOrphanOrders(posKey string, livePositionKeys map[string]bool) {
+	parts := strings.Split(posKey, "_")
+	if len(parts) != 2 {
+		return
+	}
+	symbol, side := parts[0], parts[1]
+	log.Printf("⚠️ 检测到仓位消失: %s → 自动撤销委托单", posKey)
+
+	oppositeKey := symbol + "_long"
+	if side == "long" {
+		oppositeKey = symbol + "_short"
+	}
+	_, oppositePending := at.pendingOrders[oppositeKey]
+	if at.config.IsHedgeMode && (livePositionKeys[oppositeKey] || oppositePending) {
+		ids := at.protectiveOrders[posKey]
+		if ids == nil {
+			return
+		}
+		for _, orderID := range []int64{ids.StopLossID, ids.TakeProfitID} {
+			if orderID == 0 {
+				continue
+			}
+			if err := at.trader.CancelOrder(symbol, orderID); err != nil {
+				log.Printf("  ⚠️ 撤销 %s 条件单 %d 失败: %v", posKey, orderID, err)
+			}
+		}
+		log.Printf("  ✓ 已撤销 %s 的止损/止盈单（保留反方向委托）", posKey)
+		return
+	}
+
+	// 撤销该币种的所有委托单（清理孤儿止损/止盈单）
+	if err := at.trader.CancelAllOrders(symbol); err != nil {
+		log.Printf("  ⚠️ 撤销 %s 委托单失败: %v", symbol, err)
+	} else {
+		log.Printf("  ✓ 已撤销 %s 的所有委托单", symbol)
+	}
+}
+
 // recordAutoClosedPosition 在检测到交易所自动平仓后，补写一条 close_long/close_short 记录
 func (at *AutoTrader) recordAutoClosedPosition(posKey string) {
 	info, ok := at.positionMemory[posKey]
@@ -1299,7 +1837,7 @@ func (at *AutoTrader) recordAutoClosedPosition(posKey string) {
 	target := at.positionTargets[posKey]
 
 	marketPrice := 0.0
-	if mkt, err := market.Get(symbol); err == nil && mkt.CurrentPrice > 0 {
+	if mkt, err := at.getMarketData(symbol); err == nil && mkt.CurrentPrice > 0 {
 		marketPrice = mkt.CurrentPrice
 	}
 
@@ -1471,7 +2009,7 @@ func (at *AutoTrader) preLLMGate(candidateCoins []decision.CandidateCoin) (skipL
 		}
 
 		// 检查极端波动
-		if marketData, err := market.Get(symbol); err == nil {
+		if marketData, err := at.getMarketData(symbol); err == nil {
 			if marketData.RiskMetrics != nil && marketData.RiskMetrics.VolatilityLevel == "extreme" {
 				hasExtreme = true
 				log.Printf("🌪️ %s 极端波动(extreme)，跳过LLM调用", symbol)
@@ -1628,7 +2166,7 @@ func (at *AutoTrader) validateVolatilityCircuitBreaker(decision *decision.Decisi
 	}
 
 	// 获取市场数据
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		return false, fmt.Sprintf("获取市场数据失败: %v", err)
 	}
@@ -1676,7 +2214,7 @@ func (at *AutoTrader) validateExecutionMode(decision *decision.Decision) (bool,
 	}
 
 	// 获取市场数据
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		return false, fmt.Sprintf("获取市场数据失败: %v", err)
 	}
@@ -1721,6 +2259,11 @@ func (at *AutoTrader) validateHedgeAntiHedge(decision *decision.Decision) (bool,
 		return true, "" // 非开仓动作，直接允许
 	}
 
+	// 双向持仓模式下多空仓位互不影响，允许同币种同时持有
+	if at.config.IsHedgeMode {
+		return true, ""
+	}
+
 	// 获取当前持仓
 	positions, err := at.trader.GetPositions()
 	if err != nil {
@@ -1831,25 +2374,212 @@ func parseGradeAndScoreFromReasoning(reasoning string) (grade string, score int,
 	return grade, score, nil
 }
 
-func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
-	// CooldownEnforcer 双保险（优先级最高）
-	if allowed, reason := at.validateCooldownEnforcer(decision); !allowed {
-		log.Printf("🚫 冷却强制拦截: %s", reason)
-		// 将决策改为hold，并记录拦截原因
-		decision.Action = "hold"
-		actionRecord.Action = "hold"
-		actionRecord.Error = fmt.Sprintf("冷却强制拦截: %s", reason)
-		return nil
+// isMinorLevelChange 新止损/止盈与当前生效价位差距未超过配置阈值时返回 true 及跳过原因
+// 当前价位未知（<=0）时总是允许更新
+func (at *AutoTrader) isMinorLevelChange(current, next float64) (bool, string) {
+	if current <= 0 {
+		return false, ""
+	}
+	diff := math.Abs(next - current)
+	if minAbs := at.config.MinSLTPChangeAbs; minAbs > 0 && diff <= minAbs {
+		return true, fmt.Sprintf("价位变化 %.4f -> %.4f (差 %.4f) 未超过阈值 %.4f", current, next, diff, minAbs)
 	}
+	if minPct := at.config.MinSLTPChangePct; minPct > 0 && diff/current*100 <= minPct {
+		return true, fmt.Sprintf("价位变化 %.4f -> %.4f (%.3f%%) 未超过阈值 %.3f%%", current, next, diff/current*100, minPct)
+	}
+	return false, ""
+}
 
-	// 决策一致性修复
-	if allowed, rejectReason, fixes := sanitizeDecision(decision); !allowed {
-		log.Printf("🚫 决策一致性拒绝: %s", rejectReason)
-		// 记录拒绝原因和可能的修复建议
-		decision.Action = "hold"
-		actionRecord.Action = "hold"
-		actionRecord.Error = fmt.Sprintf("决策一致性拒绝: %s", rejectReason)
-		if len(fixes) > 0 {
+// validatePendingOrderCap 挂单数量上限验证：已跟踪的限价单达到上限时拒绝新的限价开仓
+func (at *AutoTrader) validatePendingOrderCap(decision *decision.Decision) (bool, string) {
+	if decision.Action != "limit_open_long" && decision.Action != "limit_open_short" {
+		return true, ""
+	}
+
+	if limit := at.config.MaxPendingLimitOrders; limit > 0 && len(at.pendingOrders) >= limit {
+		return false, fmt.Sprintf("挂单上限拦截: 当前限价单 %d 个，已达上限 %d 个，拒绝 %s %s",
+			len(at.pendingOrders), limit, decision.Symbol, decision.Action)
+	}
+
+	if limit := at.config.MaxPendingLimitOrdersPerSymbol; limit > 0 {
+		count := 0
+		for _, order := range at.pendingOrders {
+			if order.Symbol == decision.Symbol {
+				count++
+			}
+		}
+		if count >= limit {
+			return false, fmt.Sprintf("挂单上限拦截: %s 当前限价单 %d 个，已达单币种上限 %d 个，拒绝 %s",
+				decision.Symbol, count, limit, decision.Action)
+		}
+	}
+
+	return true, ""
+}
+
+// validateMinAccountEquity 最低净值验证：本周期账户净值低于 MinAccountEquity 时拒绝新开仓
+// 平仓、减仓、调整止盈止损、撤单不受影响
+func (at *AutoTrader) validateMinAccountEquity(decision *decision.Decision) (bool, string) {
+	floor := at.config.MinAccountEquity
+	if floor <= 0 {
+		return true, ""
+	}
+	switch decision.Action {
+	case "open_long", "open_short", "limit_open_long", "limit_open_short":
+	default:
+		return true, ""
+	}
+
+	if at.lastAccountEquity < floor {
+		return false, fmt.Sprintf("最低净值拦截: 账户净值 %.2f USDT 低于下限 %.2f USDT，只管理已有持仓，拒绝 %s %s",
+			at.lastAccountEquity, floor, decision.Symbol, decision.Action)
+	}
+	return true, ""
+}
+
+// dailyLossPct 当日亏损占初始余额的百分比（盈利时为负）
+func (at *AutoTrader) dailyLossPct() float64 {
+	if at.initialBalance <= 0 {
+		return 0
+	}
+	return -at.dailyPnL / at.initialBalance * 100
+}
+
+// dailyLossLimitBreached 当日亏损是否达到 MaxDailyLoss（未配置时不限制）
+func (at *AutoTrader) dailyLossLimitBreached() bool {
+	return at.config.MaxDailyLoss > 0 && at.dailyLossPct() >= at.config.MaxDailyLoss
+}
+
+// checkDailyLossLimit 日亏损超限时设置 stopUntil，返回触发说明（写入决策记录）
+func (at *AutoTrader) checkDailyLossLimit() (bool, string) {
+	if !at.dailyLossLimitBreached() {
+		return false, ""
+	}
+	at.stopUntil = time.Now().Add(at.config.StopTradingTime)
+	return true, fmt.Sprintf("日亏损熔断触发: 当日盈亏 %.2f USDT (亏损 %.2f%% ≥ 上限 %.2f%%)，本周期拒绝开仓，暂停交易至 %s",
+		at.dailyPnL, at.dailyLossPct(), at.config.MaxDailyLoss, at.stopUntil.Format("2006-01-02 15:04:05"))
+}
+
+// validateDailyLossLimit 日亏损熔断验证：超限后拒绝开仓，平仓/止损调整照常放行
+func (at *AutoTrader) validateDailyLossLimit(decision *decision.Decision) (bool, string) {
+	switch decision.Action {
+	case "open_long", "open_short", "limit_open_long", "limit_open_short":
+	default:
+		return true, ""
+	}
+	if at.dailyLossLimitBreached() {
+		return false, fmt.Sprintf("日亏损熔断拦截: 当日亏损 %.2f%% 已达上限 %.2f%%，拒绝 %s %s",
+			at.dailyLossPct(), at.config.MaxDailyLoss, decision.Symbol, decision.Action)
+	}
+	return true, ""
+}
+
+// observeOnlySymbols 标准化后的仅观察币种
+func (at *AutoTrader) observeOnlySymbols() []string {
+	symbols := make([]string, 0, len(at.config.ObserveOnlySymbols))
+	for _, symbol := range at.config.ObserveOnlySymbols {
+		if strings.TrimSpace(symbol) != "" {
+			symbols = append(symbols, normalizeSymbol(symbol))
+		}
+	}
+	return symbols
+}
+
+// validateObserveOnly 仅观察币种验证：拒绝对仅观察币种开仓（平仓、调整止盈止损、撤单不受影响）
+func (at *AutoTrader) validateObserveOnly(decision *decision.Decision) (bool, string) {
+	switch decision.Action {
+	case "open_long", "open_short", "limit_open_long", "limit_open_short":
+	default:
+		return true, ""
+	}
+
+	symbol := normalizeSymbol(decision.Symbol)
+	for _, observed := range at.observeOnlySymbols() {
+		if observed == symbol {
+			return false, fmt.Sprintf("仅观察币种拦截: %s 只作为市场参考，拒绝 %s", symbol, decision.Action)
+		}
+	}
+	return true, ""
+}
+
+// validateRiskOffGuard 大盘 risk-off 验证：BTC 处于 risk-off 时按 RiskOffGuard 限制山寨币开仓
+// 风险状态获取失败时放行（仅告警），避免 BTC 行情异常导致所有交易员停摆
+func (at *AutoTrader) validateRiskOffGuard(decision *decision.Decision) (bool, string) {
+	mode := at.config.RiskOffGuard
+	if mode == "" {
+		return true, ""
+	}
+	switch decision.Action {
+	case "open_long", "open_short", "limit_open_long", "limit_open_short":
+	default:
+		return true, ""
+	}
+	symbol := normalizeSymbol(decision.Symbol)
+	if symbol == "BTCUSDT" || symbol == "ETHUSDT" {
+		return true, ""
+	}
+
+	regime, err := market.GetRiskRegime()
+	if err != nil {
+		log.Printf("⚠️ 获取大盘风险状态失败，跳过 risk-off 检查: %v", err)
+		return true, ""
+	}
+	if !regime.RiskOff {
+		return true, ""
+	}
+
+	switch mode {
+	case "block_alt_longs":
+		if decision.Action == "open_long" || decision.Action == "limit_open_long" {
+			return false, fmt.Sprintf("大盘risk-off拦截(%s): 禁止山寨币开多 %s", regime.Reason, symbol)
+		}
+	case "limit_only":
+		if decision.Action == "open_long" || decision.Action == "open_short" {
+			return false, fmt.Sprintf("大盘risk-off拦截(%s): 山寨币只允许限价开仓，拒绝 %s %s", regime.Reason, decision.Action, symbol)
+		}
+	default:
+		log.Printf("⚠️ 未知的 RiskOffGuard 模式: %s", mode)
+	}
+	return true, ""
+}
+
+func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	// CooldownEnforcer 双保险（优先级最高）
+	if allowed, reason := at.validateCooldownEnforcer(decision); !allowed {
+		log.Printf("🚫 冷却强制拦截: %s", reason)
+		// 将决策改为hold，并记录拦截原因
+		decision.Action = "hold"
+		actionRecord.Action = "hold"
+		actionRecord.Error = fmt.Sprintf("冷却强制拦截: %s", reason)
+		return nil
+	}
+
+	// 日亏损熔断验证（超限后只允许管理/平仓）
+	if allowed, reason := at.validateDailyLossLimit(decision); !allowed {
+		log.Printf("🚫 %s", reason)
+		decision.Action = "hold"
+		actionRecord.Action = "hold"
+		actionRecord.Error = reason
+		return nil
+	}
+
+	// 仅观察币种验证（只作市场参考，禁止开仓）
+	if allowed, reason := at.validateObserveOnly(decision); !allowed {
+		log.Printf("🚫 %s", reason)
+		decision.Action = "hold"
+		actionRecord.Action = "hold"
+		actionRecord.Error = reason
+		return nil
+	}
+
+	// 决策一致性修复
+	if allowed, rejectReason, fixes := sanitizeDecision(decision); !allowed {
+		log.Printf("🚫 决策一致性拒绝: %s", rejectReason)
+		// 记录拒绝原因和可能的修复建议
+		decision.Action = "hold"
+		actionRecord.Action = "hold"
+		actionRecord.Error = fmt.Sprintf("决策一致性拒绝: %s", rejectReason)
+		if len(fixes) > 0 {
 			log.Printf("💡 修复建议: %s", strings.Join(fixes, "; "))
 		}
 		return nil
@@ -1858,6 +2588,24 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 		log.Printf("🔧 自动修复决策: %s", strings.Join(fixes, "; "))
 	}
 
+	// 最低净值验证（净值过低时只允许管理/平仓）
+	if allowed, reason := at.validateMinAccountEquity(decision); !allowed {
+		log.Printf("🚫 %s", reason)
+		decision.Action = "hold"
+		actionRecord.Action = "hold"
+		actionRecord.Error = reason
+		return nil
+	}
+
+	// 决策币种必须在本周期分析集合内（strict拒绝，lenient按需补拉数据）
+	if allowed, reason := at.validateDecisionSymbol(decision, actionRecord); !allowed {
+		log.Printf("🚫 %s", reason)
+		decision.Action = "hold"
+		actionRecord.Action = "hold"
+		actionRecord.Error = reason
+		return nil
+	}
+
 	// 高波动熔断验证
 	if allowed, reason := at.validateVolatilityCircuitBreaker(decision); !allowed {
 		log.Printf("🚫 %s", reason)
@@ -1868,6 +2616,30 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 		return nil // 不执行原决策，但不返回错误
 	}
 
+	// 开仓订单类型覆盖（limit_maker：市价开仓统一转为maker限价开仓）
+	if err := at.applyOpeningOrderType(decision, actionRecord); err != nil {
+		log.Printf("🚫 %v", err)
+		decision.Action = "hold"
+		actionRecord.Action = "hold"
+		actionRecord.Error = err.Error()
+		return nil
+	}
+
+	// Kelly仓位调整（position_sizing_mode=kelly）
+	at.applyKellySizing(decision)
+
+	// 结构止损（stop_loss_placement=structure/validate）
+	at.applyStructureStopLoss(decision, actionRecord)
+
+	// 大盘 risk-off 验证（BTC 4h 走弱时限制山寨币开仓）
+	if allowed, reason := at.validateRiskOffGuard(decision); !allowed {
+		log.Printf("🚫 %s", reason)
+		decision.Action = "hold"
+		actionRecord.Action = "hold"
+		actionRecord.Error = reason
+		return nil
+	}
+
 	// Execution Mode强制验证
 	if allowed, reason := at.validateExecutionMode(decision); !allowed {
 		log.Printf("🚫 %s", reason)
@@ -1888,6 +2660,15 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 		return nil // 不执行原决策，但不返回错误
 	}
 
+	// 挂单数量上限验证
+	if allowed, reason := at.validatePendingOrderCap(decision); !allowed {
+		log.Printf("🚫 %s", reason)
+		decision.Action = "hold"
+		actionRecord.Action = "hold"
+		actionRecord.Error = reason
+		return nil
+	}
+
 	switch decision.Action {
 	case "open_long":
 		return at.executeOpenLongWithRecord(decision, actionRecord)
@@ -1905,9 +2686,17 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 		return at.executeUpdateStopLossWithRecord(decision, actionRecord)
 	case "update_take_profit":
 		return at.executeUpdateTakeProfitWithRecord(decision, actionRecord)
+	case "update_trailing_stop":
+		return at.executeUpdateTrailingStopWithRecord(decision, actionRecord)
 	case "limit_open_long":
+		if at.openingOrderType() == OpeningOrderTypeLimitMaker {
+			return at.executeMakerOpenWithRecord(decision, actionRecord, "long")
+		}
 		return at.executeLimitOpenLongWithRecord(decision, actionRecord)
 	case "limit_open_short":
+		if at.openingOrderType() == OpeningOrderTypeLimitMaker {
+			return at.executeMakerOpenWithRecord(decision, actionRecord, "short")
+		}
 		return at.executeLimitOpenShortWithRecord(decision, actionRecord)
 	case "cancel_limit_order":
 		return at.executeCancelLimitOrderWithRecord(decision, actionRecord)
@@ -1919,6 +2708,18 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 	}
 }
 
+// NoPositionError 需要已有持仓的操作（如 update_take_profit）找不到对应持仓，通常是持仓已被止损/止盈或手动平掉
+type NoPositionError struct {
+	Symbol string
+	Action string
+}
+
+func (e *NoPositionError) Error() string {
+	return fmt.Sprintf("当前没有 %s 的持仓，不能 %s", e.Symbol, e.Action)
+}
+
+// executeUpdateTakeProfitWithRecord 调整已有仓位的止盈：先撤销该持仓已有的止盈单再下新单
+// （币安同方向 closePosition 止盈单只允许一笔），新单失败时按原触发价恢复旧止盈，并记录新止盈单ID
 func (at *AutoTrader) executeUpdateTakeProfitWithRecord(dec *decision.Decision, actionRecord *logger.DecisionAction) error {
 	positions, err := at.trader.GetPositions()
 	if err != nil {
@@ -1937,33 +2738,77 @@ func (at *AutoTrader) executeUpdateTakeProfitWithRecord(dec *decision.Decision,
 			continue
 		}
 
-		s, _ := pos["side"].(string)
-		side = strings.ToUpper(s)
 		q, _ := pos["positionAmt"].(float64)
 		if q < 0 {
 			q = -q
 		}
+		if q == 0 {
+			continue
+		}
+		s, _ := pos["side"].(string)
+		side = strings.ToUpper(s)
 		qty = q
 		ok = true
 		break
 	}
 
 	if !ok {
-		return fmt.Errorf("当前没有 %s 的持仓，不能 update_take_profit", dec.Symbol)
+		return &NoPositionError{Symbol: dec.Symbol, Action: "update_take_profit"}
 	}
 
 	if dec.NewTakeProfit <= 0 {
 		return fmt.Errorf("update_take_profit 需要有效的新止盈价")
 	}
 
-	if err := at.trader.SetTakeProfit(dec.Symbol, side, qty, dec.NewTakeProfit); err != nil {
+	dec.NewTakeProfit = at.roundPriceToTick(dec.Symbol, dec.NewTakeProfit)
+
+	tgt := at.positionTargets[fmt.Sprintf("%s_%s", dec.Symbol, strings.ToLower(side))]
+	if tgt != nil {
+		if minor, reason := at.isMinorLevelChange(tgt.CurrentTP, dec.NewTakeProfit); minor {
+			log.Printf("  ℹ %s %s 止盈变化过小，跳过改单: %s", dec.Symbol, side, reason)
+			actionRecord.Status = "NO_OP"
+			actionRecord.Reason = reason
+			return nil
+		}
+	}
+
+	// 撤销已有止盈单，避免叠加挂单或被交易所拒绝
+	orders, err := at.trader.GetOpenOrders(dec.Symbol)
+	if err != nil {
+		return fmt.Errorf("获取挂单失败，无法替换止盈: %w", err)
+	}
+	_, existingTPs := classifyProtectiveOrders(orders, side)
+	previous, _ := pickProtectiveOrder(existingTPs, func(a, b protectiveOrder) bool { return a.OrderID > b.OrderID })
+	for _, old := range existingTPs {
+		if err := at.trader.CancelOrder(dec.Symbol, old.OrderID); err != nil {
+			return fmt.Errorf("撤销旧止盈单 %d 失败: %w", old.OrderID, err)
+		}
+		log.Printf("  🧹 已撤销 %s %s 旧止盈单 %d (触发价 %.4f)", dec.Symbol, side, old.OrderID, old.StopPrice)
+	}
+
+	if err := at.trader.SetTakeProfit(dec.Symbol, side, qty, dec.NewTakeProfit, true); err != nil {
+		if previous != nil {
+			if restoreErr := at.trader.SetTakeProfit(dec.Symbol, side, qty, previous.StopPrice, true); restoreErr != nil {
+				log.Printf("  ❌ %s %s 恢复原止盈 %.4f 失败，当前无止盈单: %v", dec.Symbol, side, previous.StopPrice, restoreErr)
+			} else {
+				log.Printf("  ↩️ %s %s 新止盈下单失败，已恢复原止盈 %.4f", dec.Symbol, side, previous.StopPrice)
+			}
+			at.trackProtectiveOrders(dec.Symbol, side)
+		}
 		return fmt.Errorf("设置止盈失败: %w", err)
 	}
+	at.trackProtectiveOrders(dec.Symbol, side)
 
 	actionRecord.Quantity = qty
 	actionRecord.Price = dec.NewTakeProfit
+	if ids := at.protectiveOrders[fmt.Sprintf("%s_%s", dec.Symbol, strings.ToLower(side))]; ids != nil {
+		actionRecord.OrderID = ids.TakeProfitID
+	}
+	if tgt != nil {
+		tgt.CurrentTP = dec.NewTakeProfit
+	}
 
-	log.Printf("  ✓ %s %s 止盈已更新为 %.4f", dec.Symbol, side, dec.NewTakeProfit)
+	log.Printf("  ✓ %s %s 止盈已更新为 %.4f (订单 %d)", dec.Symbol, side, dec.NewTakeProfit, actionRecord.OrderID)
 	return nil
 }
 
@@ -1984,21 +2829,21 @@ func computeTrailingSL(entry float64, side string, tgt *PositionTarget, lastPric
 		// TP1 → 抬到开仓价（保本）
 		// TP2 → 抬到 (entry + TP1) / 2
 		// TP3 → 抬到 (TP1 + TP2) / 2
-		if lastPrice >= tgt.TP1 && tgt.Stage < 1 {
+		if tgt.TP1 > 0 && lastPrice >= tgt.TP1 && tgt.Stage < 1 {
 			target := entry // 到达TP1：保本
 			if target > newSL {
 				newSL = target
 				newStage = 1
 			}
 		}
-		if lastPrice >= tgt.TP2 && tgt.Stage < 2 {
+		if tgt.TP2 > 0 && lastPrice >= tgt.TP2 && tgt.Stage < 2 {
 			target := (entry + tgt.TP1) / 2 // 到达TP2：entry和TP1中点
 			if target > newSL {
 				newSL = target
 				newStage = 2
 			}
 		}
-		if lastPrice >= tgt.TP3 && tgt.Stage < 3 {
+		if tgt.TP3 > 0 && lastPrice >= tgt.TP3 && tgt.Stage < 3 {
 			target := (tgt.TP1 + tgt.TP2) / 2 // 到达TP3：TP1和TP2中点
 			if target > newSL {
 				newSL = target
@@ -2012,21 +2857,21 @@ func computeTrailingSL(entry float64, side string, tgt *PositionTarget, lastPric
 		// TP1 → 抬到开仓价（保本）
 		// TP2 → 抬到 (entry + TP1) / 2
 		// TP3 → 抬到 (TP1 + TP2) / 2
-		if lastPrice <= tgt.TP1 && tgt.Stage < 1 {
+		if tgt.TP1 > 0 && lastPrice <= tgt.TP1 && tgt.Stage < 1 {
 			target := entry // 到达TP1：保本
 			if newSL == 0 || target < newSL {
 				newSL = target
 				newStage = 1
 			}
 		}
-		if lastPrice <= tgt.TP2 && tgt.Stage < 2 {
+		if tgt.TP2 > 0 && lastPrice <= tgt.TP2 && tgt.Stage < 2 {
 			target := (entry + tgt.TP1) / 2 // 到达TP2：entry和TP1中点
 			if newSL == 0 || target < newSL {
 				newSL = target
 				newStage = 2
 			}
 		}
-		if lastPrice <= tgt.TP3 && tgt.Stage < 3 {
+		if tgt.TP3 > 0 && lastPrice <= tgt.TP3 && tgt.Stage < 3 {
 			target := (tgt.TP1 + tgt.TP2) / 2 // 到达TP3：TP1和TP2中点
 			if newSL == 0 || target < newSL {
 				newSL = target
@@ -2089,7 +2934,7 @@ func (at *AutoTrader) executeUpdateStopLossWithRecord(dec *decision.Decision, ac
 	}
 
 	// 获取当前市价
-	mkt, err := market.Get(dec.Symbol)
+	mkt, err := at.getMarketData(dec.Symbol)
 	if err != nil {
 		return fmt.Errorf("获取行情失败: %w", err)
 	}
@@ -2210,10 +3055,21 @@ func (at *AutoTrader) executeUpdateStopLossWithRecord(dec *decision.Decision, ac
 		}
 	}
 
+	// 对齐交易所价格精度，避免 -1111
+	newSL = at.roundPriceToTick(dec.Symbol, newSL)
+
+	if minor, reason := at.isMinorLevelChange(tgt.CurrentSL, newSL); minor {
+		log.Printf("  ℹ %s %s 止损变化过小，跳过改单: %s", dec.Symbol, side, reason)
+		actionRecord.Status = "NO_OP"
+		actionRecord.Reason = reason
+		return nil
+	}
+
 	// 真正下改单
-	if err := at.trader.SetStopLoss(dec.Symbol, side, qty, newSL); err != nil {
+	if err := at.trader.SetStopLoss(dec.Symbol, side, qty, newSL, true); err != nil {
 		return fmt.Errorf("设置止损失败: %w", err)
 	}
+	at.trackProtectiveOrders(dec.Symbol, side)
 
 	actionRecord.Quantity = qty
 	actionRecord.Price = newSL
@@ -2242,11 +3098,11 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 	if !decision.IsAddOn {
 		positions, err := at.trader.GetPositions()
 		if err == nil {
-			// 检查总持仓数量是否已达上限（3个）
-			if len(positions) >= 3 {
-				return fmt.Errorf("❌ 总持仓数已达上限（3个），拒绝开新仓。当前持仓：%d", len(positions))
+			// 检查总占用（持仓+待成交限价单）是否已达账户分层的并发上限
+			if err := at.checkConcurrentPositionCap(positions); err != nil {
+				return err
 			}
-			
+
 			// 检查同币种同方向是否已有持仓
 			for _, pos := range positions {
 				if pos["symbol"] == decision.Symbol && pos["side"] == "long" {
@@ -2257,14 +3113,17 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 	}
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		return err
 	}
 
-	// 计算数量
+	// 计算数量（按交易所步长/最小名义价值对齐）
 	margin := decision.PositionSizeUSD
-	quantity := (margin * float64(decision.Leverage)) / marketData.CurrentPrice
+	quantity, err := at.alignOpenOrder(decision, (margin*float64(decision.Leverage))/marketData.CurrentPrice, marketData.CurrentPrice)
+	if err != nil {
+		return err
+	}
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
 
@@ -2275,7 +3134,7 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 	}
 
 	// 开仓
-	order, err := at.trader.OpenLong(decision.Symbol, quantity, decision.Leverage)
+	order, err := at.placeOpenLong(decision.Symbol, quantity, decision.Leverage)
 	if err != nil {
 		return err
 	}
@@ -2295,12 +3154,13 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 	at.incrementDailyPairTrades(decision.Symbol)
 
 	// 设置止损止盈（注意：只挂最终止盈TP3，即 decision.TakeProfit 应当等于 TP3）
-	if err := at.trader.SetStopLoss(decision.Symbol, "LONG", quantity, decision.StopLoss); err != nil {
+	if err := at.trader.SetStopLoss(decision.Symbol, "LONG", quantity, decision.StopLoss, true); err != nil {
 		log.Printf("  ⚠ 设置止损失败: %v", err)
 	}
-	if err := at.trader.SetTakeProfit(decision.Symbol, "LONG", quantity, decision.TakeProfit); err != nil {
+	if err := at.trader.SetTakeProfit(decision.Symbol, "LONG", quantity, decision.TakeProfit, true); err != nil {
 		log.Printf("  ⚠ 设置止盈失败: %v", err)
 	}
+	at.trackProtectiveOrders(decision.Symbol, "LONG")
 
 	// 记录AI给的三个止盈点位
 	at.positionTargets[posKey] = &PositionTarget{
@@ -2309,6 +3169,7 @@ func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, act
 		TP3:       decision.TP3,
 		Stage:     0,
 		CurrentSL: decision.StopLoss,
+		CurrentTP: decision.TakeProfit,
 	}
 
 	return nil
@@ -2327,11 +3188,11 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 	if !decision.IsAddOn {
 		positions, err := at.trader.GetPositions()
 		if err == nil {
-			// 检查总持仓数量是否已达上限（3个）
-			if len(positions) >= 3 {
-				return fmt.Errorf("❌ 总持仓数已达上限（3个），拒绝开新仓。当前持仓：%d", len(positions))
+			// 检查总占用（持仓+待成交限价单）是否已达账户分层的并发上限
+			if err := at.checkConcurrentPositionCap(positions); err != nil {
+				return err
 			}
-			
+
 			// 检查同币种同方向是否已有持仓
 			for _, pos := range positions {
 				if pos["symbol"] == decision.Symbol && pos["side"] == "short" {
@@ -2342,14 +3203,17 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 	}
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		return err
 	}
 
-	// 计算数量
+	// 计算数量（按交易所步长/最小名义价值对齐）
 	margin := decision.PositionSizeUSD
-	quantity := (margin * float64(decision.Leverage)) / marketData.CurrentPrice
+	quantity, err := at.alignOpenOrder(decision, (margin*float64(decision.Leverage))/marketData.CurrentPrice, marketData.CurrentPrice)
+	if err != nil {
+		return err
+	}
 	actionRecord.Quantity = quantity
 	actionRecord.Price = marketData.CurrentPrice
 
@@ -2360,7 +3224,7 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 	}
 
 	// 开仓
-	order, err := at.trader.OpenShort(decision.Symbol, quantity, decision.Leverage)
+	order, err := at.placeOpenShort(decision.Symbol, quantity, decision.Leverage)
 	if err != nil {
 		return err
 	}
@@ -2380,12 +3244,13 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 	at.incrementDailyPairTrades(decision.Symbol)
 
 	// 设置止损止盈（注意：只挂最终止盈TP3，即 decision.TakeProfit 应当等于 TP3）
-	if err := at.trader.SetStopLoss(decision.Symbol, "SHORT", quantity, decision.StopLoss); err != nil {
+	if err := at.trader.SetStopLoss(decision.Symbol, "SHORT", quantity, decision.StopLoss, true); err != nil {
 		log.Printf("  ⚠ 设置止损失败: %v", err)
 	}
-	if err := at.trader.SetTakeProfit(decision.Symbol, "SHORT", quantity, decision.TakeProfit); err != nil {
+	if err := at.trader.SetTakeProfit(decision.Symbol, "SHORT", quantity, decision.TakeProfit, true); err != nil {
 		log.Printf("  ⚠ 设置止盈失败: %v", err)
 	}
+	at.trackProtectiveOrders(decision.Symbol, "SHORT")
 
 	// 记录AI给的三个止盈点位
 	at.positionTargets[posKey] = &PositionTarget{
@@ -2394,6 +3259,7 @@ func (at *AutoTrader) executeOpenShortWithRecord(decision *decision.Decision, ac
 		TP3:       decision.TP3,
 		Stage:     0,
 		CurrentSL: decision.StopLoss,
+		CurrentTP: decision.TakeProfit,
 	}
 
 	return nil
@@ -2404,7 +3270,7 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 	log.Printf("  🔄 平多仓: %s", decision.Symbol)
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		return err
 	}
@@ -2473,7 +3339,7 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 	}
 
 	// 平仓（quantity=0 仍然代表“全平”，保持原有语义）
-	order, err := at.trader.CloseLong(decision.Symbol, closeQty)
+	order, err := at.closePositionWithPolicy(decision, actionRecord, "long", closeQty, currentQty, marketData)
 	if err != nil {
 		return err
 	}
@@ -2486,6 +3352,7 @@ func (at *AutoTrader) executeCloseLongWithRecord(decision *decision.Decision, ac
 	// 仅当被视为“全平”时，才清理该持仓的tp记忆
 	if closeQty == 0 {
 		delete(at.positionTargets, decision.Symbol+"_long")
+		delete(at.protectiveOrders, decision.Symbol+"_long")
 		delete(at.positionFirstSeenTime, decision.Symbol+"_long")
 		delete(at.positionMemory, decision.Symbol+"_long")
 		log.Printf("  ✓ 全平成功，已清理 TP 记忆")
@@ -2501,7 +3368,7 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 	log.Printf("  🔄 平空仓: %s", decision.Symbol)
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		return err
 	}
@@ -2564,7 +3431,7 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 	}
 
 	// 平仓（0 仍然表示“全平”）
-	order, err := at.trader.CloseShort(decision.Symbol, closeQty)
+	order, err := at.closePositionWithPolicy(decision, actionRecord, "short", closeQty, currentQty, marketData)
 	if err != nil {
 		return err
 	}
@@ -2577,6 +3444,7 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 	// 仅当被视为“全平”时，才清理该持仓的tp记忆
 	if closeQty == 0 {
 		delete(at.positionTargets, decision.Symbol+"_short")
+		delete(at.protectiveOrders, decision.Symbol+"_short")
 		delete(at.positionFirstSeenTime, decision.Symbol+"_short")
 		delete(at.positionMemory, decision.Symbol+"_short")
 		log.Printf("  ✓ 全平成功，已清理 TP 记忆")
@@ -2587,13 +3455,54 @@ func (at *AutoTrader) executeCloseShortWithRecord(decision *decision.Decision, a
 	return nil
 }
 
+// partialCloseQuantity 计算部分平仓数量：close_quantity 优先，否则按 close_ratio（限制在 (0,1]，>1 视为百分比）
+// 数量按交易对 StepSize 取整且不超过当前仓位，剩余不足一个步长时平掉全部
+func (at *AutoTrader) partialCloseQuantity(d *decision.Decision, currentQty float64) (float64, error) {
+	var closeQty float64
+	switch {
+	case d.CloseQuantity > 0:
+		closeQty = d.CloseQuantity
+	case d.CloseRatio > 0:
+		ratio := d.CloseRatio
+		if ratio > 1 {
+			// 容错：如果AI给的是百分比（例如 33），转换为 0.33
+			ratio /= 100.0
+		}
+		closeQty = currentQty * math.Min(ratio, 1)
+	default:
+		return 0, fmt.Errorf("❌ %s 部分平仓必须提供 close_quantity 或 close_ratio 字段", d.Symbol)
+	}
+
+	filters, err := at.getSymbolFilters(d.Symbol)
+	if err != nil {
+		return 0, fmt.Errorf("获取交易所过滤器失败: %w", err)
+	}
+	closeQty = math.Min(market.RoundToStep(closeQty, filters.StepSize), currentQty)
+	if filters.StepSize > 0 && currentQty-closeQty < filters.StepSize {
+		closeQty = currentQty
+	}
+
+	if closeQty <= 0 {
+		return 0, fmt.Errorf("❌ %s 部分平仓数量按步长(%g)取整后为0", d.Symbol, filters.StepSize)
+	}
+	return closeQty, nil
+}
+
+// clearPositionTracking 持仓全部平掉后清理 TP 记忆、首次出现时间和持仓记忆
+func (at *AutoTrader) clearPositionTracking(posKey string) {
+	delete(at.positionTargets, posKey)
+	delete(at.protectiveOrders, posKey)
+	delete(at.positionFirstSeenTime, posKey)
+	delete(at.positionMemory, posKey)
+}
+
 // executePartialCloseLongWithRecord 执行部分平多仓并记录详细信息
-// 与 close_long 的区别：强制要求提供 close_quantity 或 close_ratio，不允许全平
+// 与 close_long 的区别：强制要求提供 close_quantity 或 close_ratio（比例为1时等同全平）
 func (at *AutoTrader) executePartialCloseLongWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	log.Printf("  🔄 部分平多仓: %s", decision.Symbol)
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		return err
 	}
@@ -2623,25 +3532,9 @@ func (at *AutoTrader) executePartialCloseLongWithRecord(decision *decision.Decis
 	}
 
 	// 部分平仓必须提供 close_quantity 或 close_ratio
-	var closeQty float64
-	if decision.CloseQuantity > 0 {
-		closeQty = decision.CloseQuantity
-	} else if decision.CloseRatio > 0 {
-		if decision.CloseRatio > 1 {
-			closeQty = currentQty * (decision.CloseRatio / 100.0)
-		} else {
-			closeQty = currentQty * decision.CloseRatio
-		}
-	} else {
-		return fmt.Errorf("❌ %s 部分平仓必须提供 close_quantity 或 close_ratio 字段", decision.Symbol)
-	}
-
-	// 验证部分平仓数量
-	if closeQty <= 0 {
-		return fmt.Errorf("❌ %s 部分平仓数量必须大于0，当前: %.4f", decision.Symbol, closeQty)
-	}
-	if closeQty >= currentQty {
-		return fmt.Errorf("❌ %s 部分平仓数量(%.4f)不能大于等于当前仓位(%.4f)，如需全平请使用 close_long", decision.Symbol, closeQty, currentQty)
+	closeQty, err := at.partialCloseQuantity(decision, currentQty)
+	if err != nil {
+		return err
 	}
 
 	// 检查是否到达 TP 点位
@@ -2674,10 +3567,18 @@ func (at *AutoTrader) executePartialCloseLongWithRecord(decision *decision.Decis
 	}
 
 	// 记录订单ID
+	actionRecord.Quantity = closeQty
 	if orderID, ok := order["orderId"].(int64); ok {
 		actionRecord.OrderID = orderID
 	}
 
+	// 比例为1或剩余不足一个步长时已全部平掉，与全平一样清理持仓跟踪
+	if closeQty >= currentQty {
+		at.clearPositionTracking(posKey)
+		log.Printf("  ✓ 部分平多仓已平掉全部仓位: %s %.4f，已清理 TP 记忆", decision.Symbol, closeQty)
+		return nil
+	}
+
 	log.Printf("  ✓ 部分平多仓成功: %s 平掉 %.4f (%.2f%%)，剩余仓位 %.4f 继续跟踪 TP 结构",
 		decision.Symbol, closeQty, closeRatioPercent, currentQty-closeQty)
 
@@ -2685,12 +3586,12 @@ func (at *AutoTrader) executePartialCloseLongWithRecord(decision *decision.Decis
 }
 
 // executePartialCloseShortWithRecord 执行部分平空仓并记录详细信息
-// 与 close_short 的区别：强制要求提供 close_quantity 或 close_ratio，不允许全平
+// 与 close_short 的区别：强制要求提供 close_quantity 或 close_ratio（比例为1时等同全平）
 func (at *AutoTrader) executePartialCloseShortWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	log.Printf("  🔄 部分平空仓: %s", decision.Symbol)
 
 	// 获取当前价格
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		return err
 	}
@@ -2720,25 +3621,9 @@ func (at *AutoTrader) executePartialCloseShortWithRecord(decision *decision.Deci
 	}
 
 	// 部分平仓必须提供 close_quantity 或 close_ratio
-	var closeQty float64
-	if decision.CloseQuantity > 0 {
-		closeQty = decision.CloseQuantity
-	} else if decision.CloseRatio > 0 {
-		if decision.CloseRatio > 1 {
-			closeQty = currentQty * (decision.CloseRatio / 100.0)
-		} else {
-			closeQty = currentQty * decision.CloseRatio
-		}
-	} else {
-		return fmt.Errorf("❌ %s 部分平仓必须提供 close_quantity 或 close_ratio 字段", decision.Symbol)
-	}
-
-	// 验证部分平仓数量
-	if closeQty <= 0 {
-		return fmt.Errorf("❌ %s 部分平仓数量必须大于0，当前: %.4f", decision.Symbol, closeQty)
-	}
-	if closeQty >= currentQty {
-		return fmt.Errorf("❌ %s 部分平仓数量(%.4f)不能大于等于当前仓位(%.4f)，如需全平请使用 close_short", decision.Symbol, closeQty, currentQty)
+	closeQty, err := at.partialCloseQuantity(decision, currentQty)
+	if err != nil {
+		return err
 	}
 
 	// 检查是否到达 TP 点位
@@ -2771,10 +3656,18 @@ func (at *AutoTrader) executePartialCloseShortWithRecord(decision *decision.Deci
 	}
 
 	// 记录订单ID
+	actionRecord.Quantity = closeQty
 	if orderID, ok := order["orderId"].(int64); ok {
 		actionRecord.OrderID = orderID
 	}
 
+	// 比例为1或剩余不足一个步长时已全部平掉，与全平一样清理持仓跟踪
+	if closeQty >= currentQty {
+		at.clearPositionTracking(posKey)
+		log.Printf("  ✓ 部分平空仓已平掉全部仓位: %s %.4f，已清理 TP 记忆", decision.Symbol, closeQty)
+		return nil
+	}
+
 	log.Printf("  ✓ 部分平空仓成功: %s 平掉 %.4f (%.2f%%)，剩余仓位 %.4f 继续跟踪 TP 结构",
 		decision.Symbol, closeQty, closeRatioPercent, currentQty-closeQty)
 
@@ -2816,16 +3709,86 @@ func (at *AutoTrader) SetSystemPromptTemplate(templateName string) {
 	at.systemPromptTemplate = templateName
 }
 
+// GetUserID 获取交易员所属用户ID
+func (at *AutoTrader) GetUserID() string {
+	return at.config.UserID
+}
+
 // GetSystemPromptTemplate 获取当前系统提示词模板名称
 func (at *AutoTrader) GetSystemPromptTemplate() string {
 	return at.systemPromptTemplate
 }
 
+// GetMCPClient 获取主AI模型客户端
+func (at *AutoTrader) GetMCPClient() *mcp.Client {
+	return at.mcpClient
+}
+
+// GetGlobalConfig 获取全局配置（分层风控等），可能为nil
+func (at *AutoTrader) GetGlobalConfig() *config.Config {
+	return at.globalConfig
+}
+
 // GetDecisionLogger 获取决策日志记录器
 func (at *AutoTrader) GetDecisionLogger() *logger.DecisionLogger {
 	return at.decisionLogger
 }
 
+// IsPaperMode 是否为纸交易模式
+func (at *AutoTrader) IsPaperMode() bool {
+	_, ok := at.trader.(*PaperTrader)
+	return at.config.TraderMode == "paper" && ok
+}
+
+// IsShadowMode 是否为影子模式（读取真实账户，不发送订单）
+func (at *AutoTrader) IsShadowMode() bool {
+	_, ok := at.trader.(*shadowTrader)
+	return at.config.TraderMode == "shadow" && ok
+}
+
+// ResetPaperState 重置纸交易员：恢复初始余额，清空持仓、挂单和内部跟踪状态
+// wipeDecisionLog 为 true 时同时删除全部决策记录
+func (at *AutoTrader) ResetPaperState(wipeDecisionLog bool) error {
+	if !at.IsPaperMode() {
+		return fmt.Errorf("仅纸交易模式的交易员支持重置")
+	}
+	if at.IsRunning() {
+		return fmt.Errorf("交易员运行中，请先停止再重置")
+	}
+
+	at.trader.(*PaperTrader).Reset()
+
+	at.initialBalance = at.config.InitialBalance
+	at.dailyPnL = 0
+	at.dailyStartEquity = 0
+	at.stopUntil = time.Time{}
+	at.lastResetTime = time.Now()
+	at.callCount = 0
+	at.lastCoTTrace = ""
+	at.positionFirstSeenTime = make(map[string]int64)
+	at.positionTargets = make(map[string]*PositionTarget)
+	at.protectiveOrders = make(map[string]*ProtectiveOrderIDs)
+	at.positionMemory = make(map[string]decision.PositionInfo)
+	at.autoCloseEvents = make([]logger.DecisionAction, 0)
+	at.pendingOrders = make(map[string]*PendingOrder)
+	at.dailyPairTrades = make(map[string]int)
+	at.dailyTradesResetDay = time.Now().Format("2006-01-02")
+	at.cooldownStates = make(map[string]int64)
+	at.stopLossHistory = make(map[string][]int64)
+	at.saveRuntimeState()
+	// 删除持久化的每日开单计数，避免重启后恢复旧计数
+	_ = os.Remove(at.dailyPairTradesPath())
+
+	if wipeDecisionLog {
+		if err := at.decisionLogger.Clear(); err != nil {
+			return fmt.Errorf("清空决策记录失败: %w", err)
+		}
+	}
+
+	log.Printf("🔄 [%s] 纸交易状态已重置 (清空决策记录: %v)", at.name, wipeDecisionLog)
+	return nil
+}
+
 // GetStatus 获取系统状态（用于API）
 func (at *AutoTrader) GetStatus() map[string]interface{} {
 	aiProvider := "DeepSeek"
@@ -2838,15 +3801,17 @@ func (at *AutoTrader) GetStatus() map[string]interface{} {
 		"trader_name":     at.name,
 		"ai_model":        at.aiModel,
 		"exchange":        at.exchange,
-		"is_running":      at.isRunning,
+		"trader_mode":     at.config.TraderMode,
+		"is_running":      at.IsRunning(),
 		"start_time":      at.startTime.Format(time.RFC3339),
 		"runtime_minutes": int(time.Since(at.startTime).Minutes()),
 		"call_count":      at.callCount,
 		"initial_balance": at.initialBalance,
-		"scan_interval":   at.config.ScanInterval.String(),
+		"scan_interval":   at.ScanInterval().String(),
 		"stop_until":      at.stopUntil.Format(time.RFC3339),
 		"last_reset_time": at.lastResetTime.Format(time.RFC3339),
 		"ai_provider":     aiProvider,
+		"skipped_cycles":  at.skippedCycles.Load(),
 	}
 }
 
@@ -2983,6 +3948,30 @@ func (at *AutoTrader) GetPositions() ([]map[string]interface{}, error) {
 	return result, nil
 }
 
+// GetTradeHistory 获取交易所成交记录（用于API，与AI记录的盈亏对账）。
+// symbol 为空时依次查询交易币种列表（未配置时使用默认币种），合并后按时间升序返回
+func (at *AutoTrader) GetTradeHistory(symbol string, since int64) ([]TradeFill, error) {
+	symbols := []string{symbol}
+	if symbol == "" {
+		coins := at.tradingCoins
+		if len(coins) == 0 {
+			coins = at.defaultCoins
+		}
+		symbols = append(symbols[:0], coins...)
+	}
+
+	fills := make([]TradeFill, 0)
+	for _, sym := range symbols {
+		symbolFills, err := at.trader.GetTradeHistory(market.Normalize(sym), since)
+		if err != nil {
+			return nil, fmt.Errorf("获取 %s 成交记录失败: %w", sym, err)
+		}
+		fills = append(fills, symbolFills...)
+	}
+	sort.SliceStable(fills, func(i, j int) bool { return fills[i].Time < fills[j].Time })
+	return fills, nil
+}
+
 // GetPendingOrders 获取待成交的限价单列表（用于API）
 func (at *AutoTrader) GetPendingOrders() []map[string]interface{} {
 	var result []map[string]interface{}
@@ -3047,6 +4036,142 @@ func sortDecisionsByPriority(decisions []decision.Decision) []decision.Decision
 	return sorted
 }
 
+// isOpenAction 是否为占用新仓位的开仓动作（市价开仓或限价开仓挂单）
+func isOpenAction(action string) bool {
+	switch action {
+	case "open_long", "open_short", "limit_open_long", "limit_open_short":
+		return true
+	}
+	return false
+}
+
+// checkConcurrentPositionCap 开仓前按账户分层（以最近一次记录的净值判断）的 MaxConcurrentPositions 校验总占用：
+// 与决策阶段的 validateConcurrentPositionCap 同一口径（持仓 + 待成交限价单），达到上限时拒绝开仓
+func (at *AutoTrader) checkConcurrentPositionCap(positions []map[string]interface{}) error {
+	var rm *config.RiskManagementConfig
+	if at.globalConfig != nil {
+		rm = &at.globalConfig.RiskManagement
+	}
+	maxSlots := decision.GetMaxConcurrentSlots(at.lastAccountEquity, rm)
+	if maxSlots <= 0 {
+		return nil
+	}
+
+	held := make([]decision.PositionInfo, 0, len(positions))
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		held = append(held, decision.PositionInfo{Symbol: symbol, Side: side})
+	}
+	occupied := len(occupiedPositionKeys(at.occupiedPositions(held)))
+	if occupied >= maxSlots {
+		return fmt.Errorf("❌ 并发仓位已达上限（%d/%d，净值%.2f），拒绝开新仓。当前：%d持仓 + %d限价单",
+			occupied, maxSlots, at.lastAccountEquity, len(positions), len(at.pendingOrders))
+	}
+	return nil
+}
+
+// occupiedPositions 占用并发仓位的持仓及待成交限价单
+func (at *AutoTrader) occupiedPositions(positions []decision.PositionInfo) []decision.PositionInfo {
+	occupied := append([]decision.PositionInfo(nil), positions...)
+	for _, order := range at.pendingOrders {
+		occupied = append(occupied, decision.PositionInfo{Symbol: order.Symbol, Side: order.Side})
+	}
+	return occupied
+}
+
+// occupiedPositionKeys 已占用位置的 key 集合（"SYMBOL_side"），同币种同方向只占一个位置
+func occupiedPositionKeys(positions []decision.PositionInfo) map[string]bool {
+	keys := make(map[string]bool, len(positions))
+	for _, pos := range positions {
+		keys[pos.Symbol+"_"+strings.ToLower(pos.Side)] = true
+	}
+	return keys
+}
+
+// validateConcurrentPositionCap 按并发仓位上限过滤本轮决策：平仓/调整类决策全部保留，
+// 本轮全平的持仓释放其位置，对已有同向持仓的补仓不占新位置；剩余位置不足时按信心度保留开仓决策，其余保持原有顺序。
+// currentPositions 为已占用的位置（持仓及待成交限价单），maxPositions <= 0 表示不限制；
+// 返回保留的决策和被跳过开仓的原因（写入决策记录的执行日志）
+func validateConcurrentPositionCap(decisions []decision.Decision, currentPositions []decision.PositionInfo, maxPositions int) ([]decision.Decision, []string) {
+	if maxPositions <= 0 {
+		return decisions, nil
+	}
+
+	held := occupiedPositionKeys(currentPositions)
+	closing := make(map[string]bool)
+	for _, d := range decisions {
+		switch d.Action {
+		case "close_long":
+			closing[d.Symbol+"_long"] = true
+		case "close_short":
+			closing[d.Symbol+"_short"] = true
+		}
+	}
+	occupied := len(held)
+	for key := range closing {
+		if held[key] {
+			occupied--
+		}
+	}
+	remaining := max(maxPositions-occupied, 0)
+
+	// 对已有同向持仓的补仓不占新位置，不参与裁剪
+	capped := func(d decision.Decision) bool {
+		return isOpenAction(d.Action) && !(d.IsAddOn && held[d.Symbol+"_"+openActionSide(d.Action)])
+	}
+	var openIdx []int
+	for i, d := range decisions {
+		if capped(d) {
+			openIdx = append(openIdx, i)
+		}
+	}
+	if len(openIdx) <= remaining {
+		return decisions, nil
+	}
+
+	sort.SliceStable(openIdx, func(a, b int) bool {
+		return decisions[openIdx[a]].Confidence > decisions[openIdx[b]].Confidence
+	})
+	allowed := make(map[int]bool, remaining)
+	for _, i := range openIdx[:remaining] {
+		allowed[i] = true
+	}
+
+	kept := make([]decision.Decision, 0, len(decisions))
+	var reasons []string
+	for i, d := range decisions {
+		if capped(d) && !allowed[i] {
+			log.Printf("⏭️ %s %s 已跳过: 并发仓位已达上限 (%d/%d)", d.Symbol, d.Action, occupied, maxPositions)
+			reasons = append(reasons, fmt.Sprintf("⏭️ %s %s skipped: position cap reached (%d/%d)", d.Symbol, d.Action, occupied, maxPositions))
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept, reasons
+}
+
+// openActionSide 开仓动作对应的持仓方向
+func openActionSide(action string) string {
+	if strings.HasSuffix(action, "_short") {
+		return "short"
+	}
+	return "long"
+}
+
+// GetCandidateSymbols 获取交易员当前的候选币种（用于市场概览等接口）
+func (at *AutoTrader) GetCandidateSymbols() ([]string, error) {
+	coins, err := at.getCandidateCoins()
+	if err != nil {
+		return nil, err
+	}
+	symbols := make([]string, 0, len(coins))
+	for _, coin := range coins {
+		symbols = append(symbols, coin.Symbol)
+	}
+	return symbols, nil
+}
+
 // getCandidateCoins 获取交易员的候选币种列表
 func (at *AutoTrader) getCandidateCoins() ([]decision.CandidateCoin, error) {
 	if len(at.tradingCoins) == 0 {
@@ -3140,9 +4265,9 @@ func (at *AutoTrader) executeLimitOrderLifecycle(
 		var err error
 
 		if side == "BUY" {
-			orderResult, err = at.trader.LimitOpenLong(symbol, remainingQty, 1, limitPrice, 0) // 止损设为0表示不设置
+			orderResult, err = at.placeLimitOpenLong(symbol, remainingQty, 1, limitPrice, 0) // 止损设为0表示不设置
 		} else {
-			orderResult, err = at.trader.LimitOpenShort(symbol, remainingQty, 1, limitPrice, 0)
+			orderResult, err = at.placeLimitOpenShort(symbol, remainingQty, 1, limitPrice, 0)
 		}
 
 		if err != nil {
@@ -3193,13 +4318,13 @@ func (at *AutoTrader) executeLimitOrderLifecycle(
 					log.Printf("  🔄 准备重试 #%d...", attempt+2)
 
 					// 重新获取市场数据和定价
-					marketData, err := market.Get(symbol)
+					marketData, err := at.getMarketData(symbol)
 					if err != nil {
 						report.Error = fmt.Sprintf("重试时获取市场数据失败: %v", err)
 						return false, report, err
 					}
 
-					filters, err := market.GetSymbolFilters(symbol)
+					filters, err := at.getSymbolFilters(symbol)
 					if err != nil {
 						report.Error = fmt.Sprintf("重试时获取过滤器失败: %v", err)
 						return false, report, err
@@ -3238,11 +4363,8 @@ func (at *AutoTrader) executeLimitOrderLifecycle(
 					continue
 				}
 
-				executedQty, _ := orderStatus["executedQty"].(float64)
-				avgPrice, _ := orderStatus["avgPrice"].(float64)
-
-				report.FilledQuantity = executedQty
-				report.AvgFillPrice = avgPrice
+				report.recordFill(orderStatus)
+				executedQty, avgPrice := report.FilledQuantity, report.AvgFillPrice
 
 				switch status {
 				case "FILLED":
@@ -3294,14 +4416,21 @@ func (at *AutoTrader) ExecuteLimitOpenLongForTest(decision *decision.Decision, a
 
 // executeLimitOpenLongWithRecord 执行限价开多仓并记录
 func (at *AutoTrader) executeLimitOpenLongWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	// 并发仓位上限（持仓+待成交限价单），生命周期管理与普通挂单都受约束
+	if positions, err := at.trader.GetPositions(); err == nil {
+		if err := at.checkConcurrentPositionCap(positions); err != nil {
+			return err
+		}
+	}
+
 	// 获取市场数据用于定价
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		return fmt.Errorf("获取市场数据失败: %w", err)
 	}
 
 	// 获取交易所过滤器信息
-	filters, err := market.GetSymbolFilters(decision.Symbol)
+	filters, err := at.getSymbolFilters(decision.Symbol)
 	if err != nil {
 		return fmt.Errorf("获取交易所过滤器失败: %w", err)
 	}
@@ -3315,7 +4444,10 @@ func (at *AutoTrader) executeLimitOpenLongWithRecord(decision *decision.Decision
 	// 计算并对齐数量
 	margin := decision.PositionSizeUSD
 	rawQuantity := (margin * float64(decision.Leverage)) / limitPrice
-	quantity := market.RoundToStep(rawQuantity, filters.StepSize)
+	quantity, err := alignOrderToFilters(decision, rawQuantity, limitPrice, filters)
+	if err != nil {
+		return err
+	}
 
 	// 检查 ExecutionGate mode - 只有 limit_only 时才启用生命周期管理
 	// 这里使用 evaluateExecutionGate 函数（小写，未导出）
@@ -3357,6 +4489,7 @@ func (at *AutoTrader) executeLimitOpenLongWithRecord(decision *decision.Decision
 		actionRecord.Price = report.AvgFillPrice
 		actionRecord.Status = "EXECUTED"
 		actionRecord.ExecutionReport = report
+		recordExecutionCosts(actionRecord, report)
 
 		log.Printf("  ✅ 生命周期管理完成: 成交 %.6f @ %.4f", report.FilledQuantity, report.AvgFillPrice)
 		return nil
@@ -3373,12 +4506,6 @@ func (at *AutoTrader) executeLimitOpenLongWithRecord(decision *decision.Decision
 
 	positions, err := at.trader.GetPositions()
 	if err == nil {
-		// 检查总持仓数量（持仓+限价单）是否已达上限
-		totalPositions := len(positions) + len(at.pendingOrders)
-		if totalPositions >= 3 {
-			return fmt.Errorf("❌ 总持仓数（含限价单）已达上限（3个），拒绝挂新单。当前：%d持仓 + %d限价单", len(positions), len(at.pendingOrders))
-		}
-		
 		// 检查同币种同方向是否已有持仓
 		for _, pos := range positions {
 			if pos["symbol"] == decision.Symbol && pos["side"] == "long" {
@@ -3393,7 +4520,7 @@ func (at *AutoTrader) executeLimitOpenLongWithRecord(decision *decision.Decision
 	actionRecord.Price = limitPrice
 
 	// 下限价单
-	order, err := at.trader.LimitOpenLong(decision.Symbol, quantity, decision.Leverage, limitPrice, decision.StopLoss)
+	order, err := at.placeLimitOpenLong(decision.Symbol, quantity, decision.Leverage, limitPrice, decision.StopLoss)
 	if err != nil {
 		return err
 	}
@@ -3436,14 +4563,21 @@ func (at *AutoTrader) executeLimitOpenLongWithRecord(decision *decision.Decision
 
 // executeLimitOpenShortWithRecord 执行限价开空仓并记录
 func (at *AutoTrader) executeLimitOpenShortWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	// 并发仓位上限（持仓+待成交限价单），生命周期管理与普通挂单都受约束
+	if positions, err := at.trader.GetPositions(); err == nil {
+		if err := at.checkConcurrentPositionCap(positions); err != nil {
+			return err
+		}
+	}
+
 	// 获取市场数据用于定价
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		return fmt.Errorf("获取市场数据失败: %w", err)
 	}
 
 	// 获取交易所过滤器信息
-	filters, err := market.GetSymbolFilters(decision.Symbol)
+	filters, err := at.getSymbolFilters(decision.Symbol)
 	if err != nil {
 		return fmt.Errorf("获取交易所过滤器失败: %w", err)
 	}
@@ -3457,7 +4591,10 @@ func (at *AutoTrader) executeLimitOpenShortWithRecord(decision *decision.Decisio
 	// 计算并对齐数量
 	margin := decision.PositionSizeUSD
 	rawQuantity := (margin * float64(decision.Leverage)) / limitPrice
-	quantity := market.RoundToStep(rawQuantity, filters.StepSize)
+	quantity, err := alignOrderToFilters(decision, rawQuantity, limitPrice, filters)
+	if err != nil {
+		return err
+	}
 
 	// 检查 ExecutionGate mode - 只有 limit_only 时才启用生命周期管理
 	// 这里使用 evaluateExecutionGate 函数（小写，未导出）
@@ -3499,6 +4636,7 @@ func (at *AutoTrader) executeLimitOpenShortWithRecord(decision *decision.Decisio
 		actionRecord.Price = report.AvgFillPrice
 		actionRecord.Status = "EXECUTED"
 		actionRecord.ExecutionReport = report
+		recordExecutionCosts(actionRecord, report)
 
 		log.Printf("  ✅ 生命周期管理完成: 成交 %.6f @ %.4f", report.FilledQuantity, report.AvgFillPrice)
 		return nil
@@ -3515,12 +4653,6 @@ func (at *AutoTrader) executeLimitOpenShortWithRecord(decision *decision.Decisio
 
 	positions, err := at.trader.GetPositions()
 	if err == nil {
-		// 检查总持仓数量（持仓+限价单）是否已达上限
-		totalPositions := len(positions) + len(at.pendingOrders)
-		if totalPositions >= 3 {
-			return fmt.Errorf("❌ 总持仓数（含限价单）已达上限（3个），拒绝挂新单。当前：%d持仓 + %d限价单", len(positions), len(at.pendingOrders))
-		}
-		
 		// 检查同币种同方向是否已有持仓
 		for _, pos := range positions {
 			if pos["symbol"] == decision.Symbol && pos["side"] == "short" {
@@ -3540,7 +4672,7 @@ func (at *AutoTrader) executeLimitOpenShortWithRecord(decision *decision.Decisio
 	actionRecord.Price = limitPrice
 
 	// 下限价单
-	order, err := at.trader.LimitOpenShort(decision.Symbol, quantity, decision.Leverage, limitPrice, decision.StopLoss)
+	order, err := at.placeLimitOpenShort(decision.Symbol, quantity, decision.Leverage, limitPrice, decision.StopLoss)
 	if err != nil {
 		return err
 	}
@@ -3628,7 +4760,7 @@ func (at *AutoTrader) executeCancelLimitOrderWithRecord(decision *decision.Decis
 		delete(at.pendingOrders, posKey)
 		delete(at.positionFirstSeenTime, posKey)
 	}
-	
+
 	// ⚠️ 重要修复：无论是否在pendingOrders中找到，只要取消成功，都应该减少计数
 	// 因为限价单可能因为同步延迟等原因不在pendingOrders中，但确实存在并已取消
 	if at.dailyPairTrades[decision.Symbol] > 0 {
@@ -3639,6 +4771,159 @@ func (at *AutoTrader) executeCancelLimitOrderWithRecord(decision *decision.Decis
 	return nil
 }
 
+// 开仓订单类型
+const (
+	OpeningOrderTypeAuto       = "auto"        // 按执行门禁与AI偏好决定
+	OpeningOrderTypeLimitMaker = "limit_maker" // 所有开仓强制使用maker限价单
+)
+
+// ValidateOpeningOrderType 校验开仓订单类型，空值表示跟随全局配置
+func ValidateOpeningOrderType(orderType string) error {
+	switch orderType {
+	case "", OpeningOrderTypeAuto, OpeningOrderTypeLimitMaker:
+		return nil
+	}
+	return fmt.Errorf("无效的开仓订单类型: %s（可选 %s/%s）", orderType, OpeningOrderTypeAuto, OpeningOrderTypeLimitMaker)
+}
+
+// openingOrderType 返回生效的开仓订单类型（交易员配置优先，其次全局配置）
+func (at *AutoTrader) openingOrderType() string {
+	if at.config.OpeningOrderType != "" {
+		return at.config.OpeningOrderType
+	}
+	if at.globalConfig != nil && at.globalConfig.OpeningOrderType != "" {
+		return at.globalConfig.OpeningOrderType
+	}
+	return OpeningOrderTypeAuto
+}
+
+// applyOpeningOrderType 开仓订单类型为 limit_maker 时，将 open_* 转为 limit_open_* 并推导maker限价
+// （limit_open_* 同样改用推导的maker限价），之后由 executeMakerOpenWithRecord 按该限价与决策杠杆挂post-only单。
+// 优先级高于执行门禁与 PostOnlyWhenLimitOnly，open_* 的转换结果记录到 actionRecord 的 override 字段
+func (at *AutoTrader) applyOpeningOrderType(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	if at.openingOrderType() != OpeningOrderTypeLimitMaker {
+		return nil
+	}
+
+	var side, limitAction string
+	switch decision.Action {
+	case "open_long", "limit_open_long":
+		side, limitAction = "BUY", "limit_open_long"
+	case "open_short", "limit_open_short":
+		side, limitAction = "SELL", "limit_open_short"
+	default:
+		return nil
+	}
+
+	marketData, err := at.getMarketData(decision.Symbol)
+	if err != nil {
+		return fmt.Errorf("limit_maker开仓获取市场数据失败: %w", err)
+	}
+	filters, err := at.getSymbolFilters(decision.Symbol)
+	if err != nil {
+		return fmt.Errorf("limit_maker开仓获取交易所过滤器失败: %w", err)
+	}
+	limitPrice, priceReason := market.DeriveOpenLimitPrice(side, marketData.Microstructure, filters.TickSize)
+	if limitPrice <= 0 {
+		return fmt.Errorf("limit_maker开仓推导maker限价失败: %s", priceReason)
+	}
+
+	log.Printf("🎛️ 开仓订单类型覆盖: %s %s → %s @ %.4f (%s)",
+		decision.Symbol, decision.Action, limitAction, limitPrice, priceReason)
+
+	decision.LimitPrice = limitPrice
+	actionRecord.Price = limitPrice
+	if decision.Action == limitAction {
+		return nil
+	}
+	decision.Action = limitAction
+	actionRecord.Action = limitAction
+	actionRecord.ExecutionPreference = "limit"
+	actionRecord.FinalExecution = "limit"
+	actionRecord.Override = true
+	actionRecord.OverrideReason = "opening_order_type_limit_maker"
+	return nil
+}
+
+// executeMakerOpenWithRecord limit_maker 开仓：按 applyOpeningOrderType 推导的maker限价与决策杠杆挂post-only单后按限价单跟踪。
+// 不走限价生命周期管理（其按1倍杠杆追价重挂，会丢失决策杠杆）
+func (at *AutoTrader) executeMakerOpenWithRecord(dec *decision.Decision, actionRecord *logger.DecisionAction, side string) error {
+	if dec.LimitPrice <= 0 {
+		return fmt.Errorf("limit_maker开仓缺少maker限价")
+	}
+
+	posKey := dec.Symbol + "_" + side
+	if _, exists := at.pendingOrders[posKey]; exists {
+		return fmt.Errorf("❌ %s 已有%s单限价单挂单中，请先取消或等待成交", dec.Symbol, side)
+	}
+	if positions, err := at.trader.GetPositions(); err == nil {
+		// 并发仓位上限（持仓+待成交限价单）
+		if err := at.checkConcurrentPositionCap(positions); err != nil {
+			return err
+		}
+		for _, pos := range positions {
+			if pos["symbol"] == dec.Symbol && pos["side"] == side {
+				return fmt.Errorf("❌ %s 已有%s仓，无法再挂限价单", dec.Symbol, side)
+			}
+		}
+	}
+
+	filters, err := at.getSymbolFilters(dec.Symbol)
+	if err != nil {
+		return fmt.Errorf("获取交易所过滤器失败: %w", err)
+	}
+	quantity, err := alignOrderToFilters(dec, dec.PositionSizeUSD*float64(dec.Leverage)/dec.LimitPrice, dec.LimitPrice, filters)
+	if err != nil {
+		return err
+	}
+	actionRecord.Quantity = quantity
+	actionRecord.Price = dec.LimitPrice
+
+	log.Printf("  📌 post-only限价开%s: %s %.6f @ %.4f (%dx)", side, dec.Symbol, quantity, dec.LimitPrice, dec.Leverage)
+	var order map[string]interface{}
+	if side == "long" {
+		order, err = at.placePostOnlyOpenLong(dec.Symbol, quantity, dec.Leverage, dec.LimitPrice, dec.StopLoss)
+	} else {
+		order, err = at.placePostOnlyOpenShort(dec.Symbol, quantity, dec.Leverage, dec.LimitPrice, dec.StopLoss)
+	}
+	if err != nil {
+		return err
+	}
+	// 会吃单的post-only单由交易所直接过期，不挂单
+	if status := fmt.Sprint(order["status"]); status == "EXPIRED" || status == "REJECTED" {
+		return fmt.Errorf("❌ %s post-only限价单未能以maker挂单（%s），放弃开仓", dec.Symbol, status)
+	}
+
+	orderID, ok := order["orderId"].(int64)
+	if !ok {
+		return nil
+	}
+	actionRecord.OrderID = orderID
+	at.pendingOrders[posKey] = &PendingOrder{
+		Symbol:           dec.Symbol,
+		Side:             side,
+		LimitPrice:       dec.LimitPrice,
+		Quantity:         quantity,
+		Leverage:         dec.Leverage,
+		OrderID:          orderID,
+		TP1:              dec.TP1,
+		TP2:              dec.TP2,
+		TP3:              dec.TP3,
+		StopLoss:         dec.StopLoss,
+		TakeProfit:       dec.TakeProfit,
+		CreateTime:       time.Now().UnixMilli(),
+		Confidence:       dec.Confidence,
+		Reasoning:        dec.Reasoning,
+		Thesis:           generateThesisFromReasoning(dec.Reasoning),
+		CancelConditions: generateCancelConditions(dec),
+	}
+	at.positionFirstSeenTime[posKey] = time.Now().UnixMilli()
+	at.incrementDailyPairTrades(dec.Symbol)
+
+	log.Printf("  ✓ post-only限价%s单已挂: 订单ID %d, 限价%.4f, 等待成交", side, orderID, dec.LimitPrice)
+	return nil
+}
+
 // checkExecutionGate 执行门禁检查（仅对市价开仓生效）
 // determineFinalExecutionMode 确定最终执行方式
 func (at *AutoTrader) determineFinalExecutionMode(gateMode, executionPreference string) (finalExecution string, override bool, overrideReason string) {
@@ -3662,7 +4947,7 @@ func (at *AutoTrader) determineFinalExecutionMode(gateMode, executionPreference
 
 func (at *AutoTrader) checkExecutionGate(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	// 获取本轮的市场数据（应该已经获取过了，避免重复网络请求）
-	marketData, err := market.Get(decision.Symbol)
+	marketData, err := at.getMarketData(decision.Symbol)
 	if err != nil {
 		// 如果获取失败，记录警告但不阻止交易（保守策略）
 		log.Printf("⚠️ 执行门禁检查失败，获取市场数据出错: %v，将允许市价开仓", err)
@@ -3719,6 +5004,209 @@ func (at *AutoTrader) checkExecutionGate(decision *decision.Decision, actionReco
 	return nil
 }
 
+// limit_only 门禁下的平仓策略
+const (
+	CloseLimitOnlyPolicyMarket   = "market"   // 直接市价平仓
+	CloseLimitOnlyPolicyEscalate = "escalate" // 先挂maker限价单，超时未成交部分升级为市价
+	CloseLimitOnlyPolicyLimit    = "limit"    // 仅maker限价单，未成交则放弃
+)
+
+// closePositionWithPolicy 按 limit_only 平仓策略执行平仓（closeQty=0 表示全平）
+// 门禁为 limit_only 且策略非 market 时先挂一次maker限价平仓单并等待有限时间；
+// escalate 策略下未成交的剩余部分升级为市价平仓（出场安全优先于成本），升级记录到 actionRecord 的 override 字段
+func (at *AutoTrader) closePositionWithPolicy(decision *decision.Decision, actionRecord *logger.DecisionAction, side string, closeQty, currentQty float64, marketData *market.Data) (map[string]interface{}, error) {
+	marketClose := func(quantity float64) (map[string]interface{}, error) {
+		if side == "long" {
+			return at.trader.CloseLong(decision.Symbol, quantity)
+		}
+		return at.trader.CloseShort(decision.Symbol, quantity)
+	}
+
+	policy := at.config.CloseLimitOnlyPolicy
+	if policy == "" {
+		policy = CloseLimitOnlyPolicyMarket
+	}
+	if policy == CloseLimitOnlyPolicyMarket || marketData.Execution == nil || marketData.Execution.Mode != "limit_only" {
+		return marketClose(closeQty)
+	}
+
+	closer, ok := at.trader.(LimitCloser)
+	if !ok {
+		log.Printf("  ⚠️ %s 当前交易器不支持限价平仓，limit_only 门禁下直接市价平仓", decision.Symbol)
+		return marketClose(closeQty)
+	}
+
+	makerQty := closeQty
+	if makerQty == 0 {
+		makerQty = currentQty
+	}
+	if makerQty <= 0 {
+		return marketClose(closeQty)
+	}
+
+	actionRecord.GateMode = marketData.Execution.Mode
+	actionRecord.GateReason = marketData.Execution.Reason
+	actionRecord.ExecutionPreference = decision.ExecutionPreference
+	if actionRecord.ExecutionPreference == "" {
+		actionRecord.ExecutionPreference = "auto"
+	}
+	actionRecord.FinalExecution = "limit"
+
+	report, err := at.attemptMakerClose(closer, decision.Symbol, side, makerQty, marketData)
+	actionRecord.ExecutionReport = report
+	recordExecutionCosts(actionRecord, report)
+	if err != nil && policy != CloseLimitOnlyPolicyEscalate {
+		return nil, err
+	}
+	if err == nil && report.Status == "FILLED" {
+		actionRecord.Price = report.AvgFillPrice
+		actionRecord.Status = "EXECUTED"
+		log.Printf("  ✅ %s maker平仓成交: %.6f @ %.4f", decision.Symbol, report.FilledQuantity, report.AvgFillPrice)
+		return map[string]interface{}{"orderId": report.OrderID}, nil
+	}
+	if policy == CloseLimitOnlyPolicyLimit {
+		return nil, fmt.Errorf("limit_only平仓maker单未成交(%s)，持仓保留", report.Status)
+	}
+
+	// escalate：maker尝试失败或超时，剩余部分升级为市价
+	remainingQty := closeQty
+	if closeQty > 0 {
+		remainingQty = closeQty - report.FilledQuantity
+		if remainingQty <= 0 {
+			actionRecord.Status = "EXECUTED"
+			return map[string]interface{}{"orderId": report.OrderID}, nil
+		}
+	}
+	if err != nil {
+		log.Printf("  ⚠️ %s maker平仓失败: %v，升级为市价平仓", decision.Symbol, err)
+	} else {
+		log.Printf("  ⏫ %s maker平仓未成交(%s，已成交%.6f)，剩余部分升级为市价平仓", decision.Symbol, report.Status, report.FilledQuantity)
+	}
+	report.Status = "ESCALATED_TO_MARKET"
+	actionRecord.FinalExecution = "market"
+	actionRecord.Override = true
+	actionRecord.OverrideReason = "close_limit_timeout_escalated_market"
+
+	order, err := marketClose(remainingQty)
+	if err != nil {
+		return nil, err
+	}
+	actionRecord.Status = "EXECUTED"
+	return order, nil
+}
+
+// attemptMakerClose 挂一次maker限价平仓单并在 CloseMakerWaitSeconds 内轮询成交，超时后撤单
+// 返回的报告 Status 为 FILLED/TIMEOUT/CANCELED/EXPIRED；下单或定价失败时返回 error
+func (at *AutoTrader) attemptMakerClose(closer LimitCloser, symbol, side string, quantity float64, marketData *market.Data) (*LimitOrderExecutionReport, error) {
+	orderSide := "SELL"
+	if side == "short" {
+		orderSide = "BUY"
+	}
+	report := &LimitOrderExecutionReport{
+		Symbol:       symbol,
+		Side:         orderSide,
+		Quantity:     quantity,
+		AttemptIndex: 1,
+		Status:       "STARTING",
+		StartTime:    time.Now().UnixMilli(),
+	}
+	finish := func(status string) {
+		report.Status = status
+		report.EndTime = time.Now().UnixMilli()
+		report.DurationMs = report.EndTime - report.StartTime
+	}
+
+	filters, err := at.getSymbolFilters(symbol)
+	if err != nil {
+		report.Error = fmt.Sprintf("获取过滤器失败: %v", err)
+		finish("PRICING_FAILED")
+		return report, fmt.Errorf("maker平仓获取交易所过滤器失败: %w", err)
+	}
+	limitPrice, priceReason := market.DeriveOpenLimitPrice(orderSide, marketData.Microstructure, filters.TickSize)
+	if limitPrice <= 0 {
+		report.Error = priceReason
+		finish("PRICING_FAILED")
+		return report, fmt.Errorf("maker平仓推导限价失败: %s", priceReason)
+	}
+	report.LimitPrice = limitPrice
+	report.PricingReason = priceReason
+
+	var order map[string]interface{}
+	if side == "long" {
+		order, err = closer.LimitCloseLong(symbol, quantity, limitPrice)
+	} else {
+		order, err = closer.LimitCloseShort(symbol, quantity, limitPrice)
+	}
+	if err != nil {
+		report.Error = fmt.Sprintf("下单失败: %v", err)
+		finish("ORDER_FAILED")
+		return report, fmt.Errorf("挂maker平仓单失败: %w", err)
+	}
+
+	switch id := order["orderId"].(type) {
+	case float64:
+		report.OrderID = int64(id)
+	case int64:
+		report.OrderID = id
+	case int:
+		report.OrderID = int64(id)
+	default:
+		report.Error = "订单ID格式错误"
+		finish("INVALID_ORDER_ID")
+		return report, fmt.Errorf("订单ID格式错误: %T", order["orderId"])
+	}
+
+	waitSeconds := at.config.CloseMakerWaitSeconds
+	if waitSeconds <= 0 {
+		waitSeconds = at.config.LimitOrderWaitSeconds
+	}
+	pollMs := at.config.LimitOrderPollIntervalMs
+	if pollMs <= 0 {
+		pollMs = 300
+	}
+	log.Printf("  📋 %s maker平仓单已挂: ID=%d %s %.6f @ %.4f (%s)，最长等待 %ds",
+		symbol, report.OrderID, orderSide, quantity, limitPrice, priceReason, waitSeconds)
+
+	timeout := time.After(time.Duration(waitSeconds) * time.Second)
+	ticker := time.NewTicker(time.Duration(pollMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeout:
+			if cancelErr := at.trader.CancelOrder(symbol, report.OrderID); cancelErr != nil {
+				log.Printf("  ⚠️ 取消maker平仓单失败: %v", cancelErr)
+			}
+			// 撤单后再查询一次，记录撤单前的最终成交量
+			if status, err := at.trader.GetOrderStatus(symbol, report.OrderID); err == nil {
+				report.recordFill(status)
+				if s, _ := status["status"].(string); s == "FILLED" {
+					finish("FILLED")
+					return report, nil
+				}
+			}
+			finish("TIMEOUT")
+			return report, nil
+
+		case <-ticker.C:
+			status, err := at.trader.GetOrderStatus(symbol, report.OrderID)
+			if err != nil {
+				log.Printf("  ⚠️ 查询maker平仓单状态失败: %v", err)
+				continue
+			}
+			report.recordFill(status)
+			switch s, _ := status["status"].(string); s {
+			case "FILLED":
+				finish("FILLED")
+				return report, nil
+			case "CANCELED", "EXPIRED":
+				finish(s)
+				return report, nil
+			}
+		}
+	}
+}
+
 // generateThesisFromReasoning 从reasoning中生成thesis（入场逻辑的一句话总结）
 func generateThesisFromReasoning(reasoning string) string {
 	if reasoning == "" {
@@ -1,13 +1,30 @@
 package trader
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"nofx/config"
 	"nofx/decision"
 	"nofx/logger"
 	"nofx/market"
+
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/adshao/go-binance/v2/futures"
 )
 
 // TestLimitOrderConfig 测试限价订单配置
@@ -566,6 +583,8 @@ func TestLimitOrderLifecyclePartialFill(t *testing.T) {
 
 // TestDetermineFinalExecutionMode 测试执行方式选择逻辑
 func TestDetermineFinalExecutionMode(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
 	config := AutoTraderConfig{
 		ID:             "test-trader",
 		Name:           "Test Trader",
@@ -655,6 +674,8 @@ func TestDetermineFinalExecutionMode(t *testing.T) {
 
 // TestExecutionPreferenceIntegration 测试 execution_preference 集成：当 gate=limit_only 时，即使 AI 选 market 也会被 override
 func TestExecutionPreferenceIntegration(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
 	// 设置 ExecutionGate 配置（强制 limit_only）
 	market.SetExecutionGateConfig(market.ExecutionGateConfig{
 		MaxSpreadBpsLimitOnly:             50.0,
@@ -765,6 +786,8 @@ func TestExecutionPreferenceIntegration(t *testing.T) {
 
 // TestPreLLMGate 测试LLM前置门控
 func TestPreLLMGate(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
 	// 创建测试用的AutoTrader
 	config := AutoTraderConfig{
 		ID:             "test-prellm",
@@ -817,6 +840,8 @@ func TestPreLLMGate(t *testing.T) {
 
 // TestCooldownEnforcer 测试冷却强制执行器
 func TestCooldownEnforcer(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
 	// 创建测试用的AutoTrader
 	config := AutoTraderConfig{
 		ID:             "test-cooldown",
@@ -1000,4 +1025,2882 @@ func TestDecisionSanitizer(t *testing.T) {
 			t.Logf("测试通过: 允许=%v, 拒绝='%s', 修复=%v", allowed, rejection, fixes)
 		})
 	}
-}
\ No newline at end of file
+}
+// TestOpeningOrderTypeLimitMaker 测试 limit_maker 开仓订单类型：open_long 被转换为maker限价开仓
+func TestOpeningOrderTypeLimitMaker(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
+	// 盘口充足，执行门禁本身允许市价
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{
+		Symbol:       "BTCUSDT",
+		CurrentPrice: 50000.0,
+		Microstructure: &market.MicrostructureSummary{
+			BestBidPrice: 50000.0,
+			BestAskPrice: 50001.0,
+			MinNotional:  5000000.0,
+		},
+		Execution:   &market.ExecutionGate{Mode: "market_ok", Reason: "ok"},
+		RiskMetrics: &market.RiskMetrics{VolatilityLevel: "medium"},
+	}})
+	defer market.ResetMarketDataProvider()
+	filters := NewMockSymbolFiltersProvider()
+	filters.SetFilters("BTCUSDT", 0.1, 0.001, 10.0)
+	market.SetSymbolFiltersProvider(filters)
+	defer market.ResetSymbolFiltersProvider()
+
+	newTrader := func(traderType string, global *config.Config) *AutoTrader {
+		at, err := NewAutoTrader(AutoTraderConfig{
+			ID:               "test-opening-order-type",
+			TraderMode:       "paper",
+			Exchange:         "binance",
+			InitialBalance:   100000.0,
+			OpeningOrderType: traderType,
+		}, global)
+		if err != nil {
+			t.Fatalf("创建 AutoTrader 失败: %v", err)
+		}
+		return at
+	}
+
+	t.Run("交易员配置limit_maker", func(t *testing.T) {
+		at := newTrader(OpeningOrderTypeLimitMaker, nil)
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long", ExecutionPreference: "market", PositionSizeUSD: 1000, Leverage: 5}
+		record := &logger.DecisionAction{Action: dec.Action, Symbol: dec.Symbol}
+
+		if err := at.applyOpeningOrderType(dec, record); err != nil {
+			t.Fatalf("applyOpeningOrderType 失败: %v", err)
+		}
+		if dec.Action != "limit_open_long" || record.Action != "limit_open_long" {
+			t.Errorf("期望转换为 limit_open_long，实际 decision=%s record=%s", dec.Action, record.Action)
+		}
+		// spread=1.0 >= 2*tick，maker价为 best_bid + 1 tick
+		if diff := dec.LimitPrice - 50000.1; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("期望maker限价 50000.1，实际 %.4f", dec.LimitPrice)
+		}
+		if !record.Override || record.OverrideReason != "opening_order_type_limit_maker" || record.FinalExecution != "limit" {
+			t.Errorf("期望记录override，实际 override=%v reason=%s final=%s", record.Override, record.OverrideReason, record.FinalExecution)
+		}
+	})
+
+	t.Run("全局配置limit_maker", func(t *testing.T) {
+		at := newTrader("", &config.Config{OpeningOrderType: OpeningOrderTypeLimitMaker})
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_short"}
+		record := &logger.DecisionAction{Action: dec.Action, Symbol: dec.Symbol}
+		if err := at.applyOpeningOrderType(dec, record); err != nil {
+			t.Fatalf("applyOpeningOrderType 失败: %v", err)
+		}
+		if dec.Action != "limit_open_short" || dec.LimitPrice <= 50000.0 {
+			t.Errorf("期望转换为卖方maker限价，实际 action=%s price=%.4f", dec.Action, dec.LimitPrice)
+		}
+	})
+
+	t.Run("转换后按决策杠杆与maker限价挂post-only单", func(t *testing.T) {
+		at := newTrader(OpeningOrderTypeLimitMaker, nil)
+		opener := &postOnlyRecorder{MockTrader: NewMockTrader()}
+		at.trader = opener
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long", ExecutionPreference: "market",
+			PositionSizeUSD: 1000, Leverage: 7, StopLoss: 49000, TakeProfit: 52000, Confidence: 80,
+			Reasoning: "grade=A score=80 测试"}
+		record := &logger.DecisionAction{Action: dec.Action, Symbol: dec.Symbol}
+
+		if err := at.executeDecisionWithRecord(dec, record); err != nil {
+			t.Fatalf("executeDecisionWithRecord 失败: %v (record: %+v)", err, record)
+		}
+		if len(opener.calls) != 1 {
+			t.Fatalf("应挂 1 笔post-only单，实际 %d (record: %+v)", len(opener.calls), record)
+		}
+		call := opener.calls[0]
+		if call.side != "long" || call.leverage != 7 {
+			t.Errorf("post-only单应保留决策杠杆 7x，实际 %+v", call)
+		}
+		if diff := call.price - 50000.1; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("post-only单应使用推导的maker限价 50000.1，实际 %.4f", call.price)
+		}
+		pending := at.pendingOrders["BTCUSDT_long"]
+		if pending == nil || pending.Leverage != 7 || pending.LimitPrice != call.price {
+			t.Errorf("应按决策杠杆与限价跟踪挂单，实际 %+v", pending)
+		}
+	})
+
+	t.Run("auto不转换", func(t *testing.T) {
+		at := newTrader("", nil)
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long"}
+		record := &logger.DecisionAction{Action: dec.Action, Symbol: dec.Symbol}
+		if err := at.applyOpeningOrderType(dec, record); err != nil {
+			t.Fatalf("applyOpeningOrderType 失败: %v", err)
+		}
+		if dec.Action != "open_long" || record.Override {
+			t.Errorf("auto模式不应转换，实际 action=%s override=%v", dec.Action, record.Override)
+		}
+	})
+
+	t.Run("无效类型拒绝创建", func(t *testing.T) {
+		_, err := NewAutoTrader(AutoTraderConfig{
+			ID:               "test-opening-order-type",
+			TraderMode:       "paper",
+			Exchange:         "binance",
+			InitialBalance:   100000.0,
+			OpeningOrderType: "maker",
+		}, nil)
+		if err == nil {
+			t.Error("无效的开仓订单类型应返回错误")
+		}
+	})
+}
+
+// postOnlyRecorder 记录post-only开仓调用的交易器
+type postOnlyRecorder struct {
+	*MockTrader
+	calls []postOnlyCall
+}
+
+type postOnlyCall struct {
+	side     string
+	leverage int
+	price    float64
+}
+
+func (t *postOnlyRecorder) PostOnlyOpenLong(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error) {
+	t.calls = append(t.calls, postOnlyCall{side: "long", leverage: leverage, price: limitPrice})
+	return map[string]interface{}{"orderId": int64(len(t.calls)), "symbol": symbol, "status": "NEW"}, nil
+}
+
+func (t *postOnlyRecorder) PostOnlyOpenShort(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error) {
+	t.calls = append(t.calls, postOnlyCall{side: "short", leverage: leverage, price: limitPrice})
+	return map[string]interface{}{"orderId": int64(len(t.calls)), "symbol": symbol, "status": "NEW"}, nil
+}
+
+// TestCloseLimitOnlyEscalation 测试 limit_only 门禁下平仓maker单超时后升级为市价
+func TestCloseLimitOnlyEscalation(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{
+		Symbol:       "BTCUSDT",
+		CurrentPrice: 50000.0,
+		Microstructure: &market.MicrostructureSummary{
+			BestBidPrice: 50000.0,
+			BestAskPrice: 50001.0,
+			MinNotional:  5000.0,
+		},
+		Execution: &market.ExecutionGate{Mode: "limit_only", Reason: "thin_book"},
+	}})
+	defer market.ResetMarketDataProvider()
+	filters := NewMockSymbolFiltersProvider()
+	filters.SetFilters("BTCUSDT", 0.1, 0.001, 10.0)
+	market.SetSymbolFiltersProvider(filters)
+	defer market.ResetSymbolFiltersProvider()
+
+	newTrader := func(policy string, behavior *DeterministicBehavior) *AutoTrader {
+		at, err := NewAutoTrader(AutoTraderConfig{
+			ID:                       "test-close-limit-only",
+			TraderMode:               "paper",
+			Exchange:                 "binance",
+			InitialBalance:           100000.0,
+			LimitOrderPollIntervalMs: 20,
+			CloseLimitOnlyPolicy:     policy,
+			CloseMakerWaitSeconds:    1,
+		}, nil)
+		if err != nil {
+			t.Fatalf("创建 AutoTrader 失败: %v", err)
+		}
+		paper := at.trader.(*PaperTrader)
+		paper.SetDeterministicBehavior(behavior)
+		paper.positions = []map[string]interface{}{
+			{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.5},
+		}
+		return at
+	}
+	closeLong := func(at *AutoTrader) (*logger.DecisionAction, error) {
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "close_long", ExecutionPreference: "market"}
+		record := &logger.DecisionAction{Action: dec.Action, Symbol: dec.Symbol}
+		return record, at.executeCloseLongWithRecord(dec, record)
+	}
+
+	t.Run("maker超时升级市价", func(t *testing.T) {
+		at := newTrader(CloseLimitOnlyPolicyEscalate, &DeterministicBehavior{Enabled: true, NeverFill: true})
+		record, err := closeLong(at)
+		if err != nil {
+			t.Fatalf("平仓失败: %v", err)
+		}
+		if record.FinalExecution != "market" || !record.Override || record.OverrideReason != "close_limit_timeout_escalated_market" {
+			t.Errorf("期望记录升级为市价，实际 final=%s override=%v reason=%s", record.FinalExecution, record.Override, record.OverrideReason)
+		}
+		report, ok := record.ExecutionReport.(*LimitOrderExecutionReport)
+		if !ok || report.Status != "ESCALATED_TO_MARKET" || report.Side != "SELL" {
+			t.Fatalf("期望执行报告状态 ESCALATED_TO_MARKET，实际 %+v", record.ExecutionReport)
+		}
+		// 平多为卖出，spread=1.0 >= 2*tick，maker价为 best_ask - 1 tick
+		if diff := report.LimitPrice - 50000.9; diff > 1e-9 || diff < -1e-9 || report.Quantity != 0.5 {
+			t.Errorf("期望maker单 0.5 @ 50000.9，实际 %.4f @ %.4f", report.Quantity, report.LimitPrice)
+		}
+	})
+
+	t.Run("maker成交不升级", func(t *testing.T) {
+		at := newTrader(CloseLimitOnlyPolicyEscalate, &DeterministicBehavior{Enabled: true, FillDelayMs: 10, FixedFillPrice: 50001.0})
+		record, err := closeLong(at)
+		if err != nil {
+			t.Fatalf("平仓失败: %v", err)
+		}
+		if record.FinalExecution != "limit" || record.Override || record.Price != 50001.0 {
+			t.Errorf("期望maker成交，实际 final=%s override=%v price=%.4f", record.FinalExecution, record.Override, record.Price)
+		}
+	})
+
+	t.Run("仅限价策略超时放弃", func(t *testing.T) {
+		at := newTrader(CloseLimitOnlyPolicyLimit, &DeterministicBehavior{Enabled: true, NeverFill: true})
+		if _, err := closeLong(at); err == nil {
+			t.Error("期望 limit 策略下maker未成交返回错误")
+		}
+	})
+}
+
+// TestPendingLimitOrderCap 测试挂单数量上限（总数与单币种）
+func TestPendingLimitOrderCap(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录与每日开单计数写入临时目录
+
+	// 盘口充足，限价单走普通挂单路径并记录到 pendingOrders
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{
+		Symbol:       "BTCUSDT",
+		CurrentPrice: 50000.0,
+		Microstructure: &market.MicrostructureSummary{
+			BestBidPrice: 50000.0,
+			BestAskPrice: 50001.0,
+			MinNotional:  5000000.0,
+		},
+		Execution: &market.ExecutionGate{Mode: "market_ok", Reason: "ok"},
+	}})
+	defer market.ResetMarketDataProvider()
+	market.SetSymbolFiltersProvider(NewMockSymbolFiltersProvider())
+	defer market.ResetSymbolFiltersProvider()
+
+	at, err := NewAutoTrader(AutoTraderConfig{
+		ID:                             "test-pending-cap",
+		TraderMode:                     "paper",
+		Exchange:                       "binance",
+		InitialBalance:                 100000.0,
+		MaxPendingLimitOrders:          2,
+		MaxPendingLimitOrdersPerSymbol: 1,
+	}, nil)
+	if err != nil {
+		t.Fatalf("创建 AutoTrader 失败: %v", err)
+	}
+	at.trader.(*PaperTrader).SetDeterministicBehavior(&DeterministicBehavior{Enabled: true, NeverFill: true})
+
+	place := func(symbol, action string) error {
+		dec := &decision.Decision{Symbol: symbol, Action: action, PositionSizeUSD: 100, Leverage: 5}
+		if allowed, reason := at.validatePendingOrderCap(dec); !allowed {
+			return errors.New(reason)
+		}
+		record := &logger.DecisionAction{Action: action, Symbol: symbol}
+		if action == "limit_open_long" {
+			return at.executeLimitOpenLongWithRecord(dec, record)
+		}
+		return at.executeLimitOpenShortWithRecord(dec, record)
+	}
+
+	if err := place("BTCUSDT", "limit_open_long"); err != nil {
+		t.Fatalf("第1个限价单应成功: %v", err)
+	}
+	// 单币种上限为1：同币种反向挂单被拒绝
+	if err := place("BTCUSDT", "limit_open_short"); err == nil || !strings.Contains(err.Error(), "单币种上限") {
+		t.Fatalf("期望单币种上限拦截，实际 %v", err)
+	}
+	if err := place("ETHUSDT", "limit_open_long"); err != nil {
+		t.Fatalf("第2个限价单应成功: %v", err)
+	}
+	if len(at.pendingOrders) != 2 {
+		t.Fatalf("期望跟踪 2 个挂单，实际 %d", len(at.pendingOrders))
+	}
+	// 总数上限为2：第3个币种被拒绝
+	if err := place("SOLUSDT", "limit_open_long"); err == nil || !strings.Contains(err.Error(), "已达上限 2 个") {
+		t.Fatalf("期望总数上限拦截，实际 %v", err)
+	}
+
+	// 撤掉一个挂单后可以继续挂单
+	delete(at.pendingOrders, "ETHUSDT_long")
+	if err := place("SOLUSDT", "limit_open_long"); err != nil {
+		t.Fatalf("释放名额后应允许挂单: %v", err)
+	}
+}
+
+// TestKellyPositionSizing 测试分数Kelly仓位：正期望时放大仓位并受分层风控上限约束，样本不足回退固定仓位
+func TestKellyPositionSizing(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
+	global := &config.Config{}
+	global.RiskManagement.ConservativeMode.MarginUsageLimitPct = 50.0
+	global.RiskManagement.ConservativeMode.NotionalCapPct = 200.0
+
+	newTrader := func(wins, losses int) *AutoTrader {
+		at, err := NewAutoTrader(AutoTraderConfig{
+			ID:                 "test-kelly-sizing",
+			TraderMode:         "paper",
+			Exchange:           "binance",
+			InitialBalance:     100000.0,
+			PositionSizingMode: PositionSizingKelly,
+			KellyFraction:      0.25,
+			KellyMinTrades:     20,
+		}, global)
+		if err != nil {
+			t.Fatalf("创建 AutoTrader 失败: %v", err)
+		}
+		at.decisionLogger = logger.NewDecisionLogger(t.TempDir())
+		at.lastAccountEquity = 100000.0
+
+		// 每笔交易的开平仓写在同一条记录中，保证配对顺序
+		seed := func(closePrice float64) {
+			now := time.Now()
+			at.decisionLogger.LogDecision(&logger.DecisionRecord{
+				Success: true,
+				Decisions: []logger.DecisionAction{
+					{Action: "open_long", Symbol: "BTCUSDT", Quantity: 1, Leverage: 10, Price: 100, Timestamp: now, Success: true},
+					{Action: "close_long", Symbol: "BTCUSDT", Quantity: 1, Price: closePrice, Timestamp: now, Success: true},
+				},
+			})
+		}
+		for i := 0; i < wins; i++ {
+			seed(102) // +2
+		}
+		for i := 0; i < losses; i++ {
+			seed(99) // -1
+		}
+		return at
+	}
+
+	// 胜率75%，盈亏比2 → Kelly = 0.75 - 0.25/2 = 0.625，1/4 Kelly = 0.15625
+	t.Run("正期望放大仓位", func(t *testing.T) {
+		at := newTrader(15, 5)
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long", PositionSizeUSD: 1000, Leverage: 5}
+		at.applyKellySizing(dec)
+		if diff := dec.PositionSizeUSD - 15625.0; diff > 1e-6 || diff < -1e-6 {
+			t.Errorf("期望Kelly仓位 15625，实际 %.2f", dec.PositionSizeUSD)
+		}
+	})
+
+	t.Run("受分层风控上限约束", func(t *testing.T) {
+		at := newTrader(15, 5)
+		// 保守模式名义价值上限 200% / 20x → 保证金上限 10000
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "limit_open_long", PositionSizeUSD: 1000, Leverage: 20}
+		at.applyKellySizing(dec)
+		if dec.PositionSizeUSD <= 1000 || dec.PositionSizeUSD != 10000.0 {
+			t.Errorf("期望仓位被限制为 10000，实际 %.2f", dec.PositionSizeUSD)
+		}
+	})
+
+	t.Run("样本不足回退固定仓位", func(t *testing.T) {
+		at := newTrader(4, 1)
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long", PositionSizeUSD: 1000, Leverage: 5}
+		at.applyKellySizing(dec)
+		if dec.PositionSizeUSD != 1000 {
+			t.Errorf("样本不足时应保持固定仓位 1000，实际 %.2f", dec.PositionSizeUSD)
+		}
+	})
+
+	t.Run("负期望不放大", func(t *testing.T) {
+		at := newTrader(5, 15)
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long", PositionSizeUSD: 1000, Leverage: 5}
+		at.applyKellySizing(dec)
+		if dec.PositionSizeUSD != 1000 {
+			t.Errorf("无正期望时应保持固定仓位 1000，实际 %.2f", dec.PositionSizeUSD)
+		}
+	})
+}
+
+// TestStructureStopLoss 测试结构止损放置在最近4h支撑/压力区外侧 ATR 缓冲处
+func TestStructureStopLoss(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
+	marketData := &market.Data{
+		Symbol:          "BTCUSDT",
+		CurrentPrice:    100000.0,
+		MidTermSeries4h: &market.MidTermSeries4h{ATR14: 1000.0},
+		FourHourZones: []market.SRZone{
+			{Lower: 95000, Upper: 96000, Kind: "support"},
+			{Lower: 97500, Upper: 98500, Kind: "support"},      // 最近支撑
+			{Lower: 101000, Upper: 101500, Kind: "resistance"}, // 最近压力
+			{Lower: 104000, Upper: 105000, Kind: "resistance"},
+		},
+	}
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: marketData})
+	defer market.ResetMarketDataProvider()
+
+	newTrader := func(mode string) *AutoTrader {
+		at, err := NewAutoTrader(AutoTraderConfig{
+			ID:                     "test-structure-stop",
+			TraderMode:             "paper",
+			Exchange:               "binance",
+			InitialBalance:         10000.0,
+			StopLossPlacement:      mode,
+			StructureStopATRBuffer: 0.5,
+		}, nil)
+		if err != nil {
+			t.Fatalf("创建 AutoTrader 失败: %v", err)
+		}
+		return at
+	}
+
+	t.Run("多单止损在最近支撑下方", func(t *testing.T) {
+		at := newTrader(StopLossPlacementStructure)
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long", StopLoss: 99000}
+		record := &logger.DecisionAction{}
+		at.applyStructureStopLoss(dec, record)
+		// 97500 - 0.5 × 1000
+		if dec.StopLoss != 97000 {
+			t.Errorf("期望结构止损 97000，实际 %.2f", dec.StopLoss)
+		}
+		if !strings.HasPrefix(record.StopLossSource, "structure_4h_support") {
+			t.Errorf("止损依据记录错误: %q", record.StopLossSource)
+		}
+	})
+
+	t.Run("空单止损在最近压力上方", func(t *testing.T) {
+		at := newTrader(StopLossPlacementStructure)
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_short", StopLoss: 100500}
+		record := &logger.DecisionAction{}
+		at.applyStructureStopLoss(dec, record)
+		// 101500 + 0.5 × 1000
+		if dec.StopLoss != 102000 {
+			t.Errorf("期望结构止损 102000，实际 %.2f", dec.StopLoss)
+		}
+		if !strings.HasPrefix(record.StopLossSource, "structure_4h_resistance") {
+			t.Errorf("止损依据记录错误: %q", record.StopLossSource)
+		}
+	})
+
+	t.Run("校验模式保留更宽的AI止损", func(t *testing.T) {
+		at := newTrader(StopLossPlacementValidate)
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long", StopLoss: 96500}
+		record := &logger.DecisionAction{}
+		at.applyStructureStopLoss(dec, record)
+		if dec.StopLoss != 96500 {
+			t.Errorf("AI止损已在结构外侧，应保留 96500，实际 %.2f", dec.StopLoss)
+		}
+		if !strings.HasPrefix(record.StopLossSource, "ai_validated") {
+			t.Errorf("止损依据记录错误: %q", record.StopLossSource)
+		}
+	})
+
+	t.Run("校验模式放宽过紧的AI止损", func(t *testing.T) {
+		at := newTrader(StopLossPlacementValidate)
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long", StopLoss: 99000}
+		at.applyStructureStopLoss(dec, &logger.DecisionAction{})
+		if dec.StopLoss != 97000 {
+			t.Errorf("AI止损在支撑内侧，应放宽到 97000，实际 %.2f", dec.StopLoss)
+		}
+	})
+
+	t.Run("默认模式不修改", func(t *testing.T) {
+		at := newTrader("")
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "open_long", StopLoss: 99000}
+		at.applyStructureStopLoss(dec, &logger.DecisionAction{})
+		if dec.StopLoss != 99000 {
+			t.Errorf("默认模式不应修改止损，实际 %.2f", dec.StopLoss)
+		}
+	})
+}
+
+// TestOffListSymbolPolicy 测试决策币种不在本周期分析集合内时的严格/宽松处理
+func TestOffListSymbolPolicy(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{Symbol: "DOGEUSDT", CurrentPrice: 0.2}})
+	defer market.ResetMarketDataProvider()
+
+	newTrader := func(policy string) *AutoTrader {
+		at, err := NewAutoTrader(AutoTraderConfig{
+			ID:                  "test-off-list-symbol",
+			TraderMode:          "paper",
+			Exchange:            "binance",
+			InitialBalance:      10000.0,
+			OffListSymbolPolicy: policy,
+		}, nil)
+		if err != nil {
+			t.Fatalf("创建 AutoTrader 失败: %v", err)
+		}
+		at.cycleMarketData = map[string]*market.Data{"BTCUSDT": {Symbol: "BTCUSDT", CurrentPrice: 100000}}
+		return at
+	}
+
+	t.Run("严格模式拒绝不在集合内的币种", func(t *testing.T) {
+		at := newTrader(OffListSymbolStrict)
+		dec := &decision.Decision{Symbol: "DOGEUSDT", Action: "open_long"}
+		record := &logger.DecisionAction{}
+		allowed, reason := at.validateDecisionSymbol(dec, record)
+		if allowed || !strings.Contains(reason, "严格模式拒绝") {
+			t.Errorf("期望被拒绝并给出原因，实际 allowed=%v reason=%q", allowed, reason)
+		}
+		if _, fetched := at.cycleMarketData["DOGEUSDT"]; fetched {
+			t.Errorf("严格模式不应补拉数据")
+		}
+	})
+
+	t.Run("宽松模式按需补拉数据", func(t *testing.T) {
+		at := newTrader(OffListSymbolLenient)
+		dec := &decision.Decision{Symbol: "DOGEUSDT", Action: "open_long"}
+		record := &logger.DecisionAction{}
+		if allowed, reason := at.validateDecisionSymbol(dec, record); !allowed {
+			t.Fatalf("宽松模式应放行: %s", reason)
+		}
+		if record.SymbolDataSource != symbolDataSourceLazyFetch {
+			t.Errorf("期望记录 lazy_fetch，实际 %q", record.SymbolDataSource)
+		}
+		if at.cycleMarketData["DOGEUSDT"] == nil || dec.CurrentPrice != 0.2 {
+			t.Errorf("补拉的数据应写入本周期缓存并回填价格，CurrentPrice=%.4f", dec.CurrentPrice)
+		}
+	})
+
+	t.Run("集合内币种记录来源", func(t *testing.T) {
+		at := newTrader(OffListSymbolStrict)
+		record := &logger.DecisionAction{}
+		if allowed, _ := at.validateDecisionSymbol(&decision.Decision{Symbol: "BTCUSDT", Action: "close_long"}, record); !allowed {
+			t.Fatalf("集合内币种应放行")
+		}
+		if record.SymbolDataSource != symbolDataSourceCycle {
+			t.Errorf("期望记录 cycle，实际 %q", record.SymbolDataSource)
+		}
+
+		// 未规范化的币种名按规范化后的键查找
+		if allowed, reason := at.validateDecisionSymbol(&decision.Decision{Symbol: "btc", Action: "open_long"}, record); !allowed {
+			t.Errorf("btc 应匹配本周期的 BTCUSDT: %s", reason)
+		}
+	})
+
+	t.Run("严格模式不限制非开仓动作", func(t *testing.T) {
+		at := newTrader(OffListSymbolStrict)
+		for _, action := range []string{"close_short", "cancel_limit_order", "update_stop_loss"} {
+			record := &logger.DecisionAction{}
+			if allowed, reason := at.validateDecisionSymbol(&decision.Decision{Symbol: "DOGEUSDT", Action: action}, record); !allowed {
+				t.Errorf("%s 针对已有持仓/挂单，不应被拒绝: %s", action, reason)
+			}
+		}
+		if _, fetched := at.cycleMarketData["DOGEUSDT"]; fetched {
+			t.Errorf("非开仓动作不应补拉数据")
+		}
+	})
+}
+
+func TestMinAccountEquityFloor(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
+	at, err := NewAutoTrader(AutoTraderConfig{
+		ID:               "test-min-equity",
+		TraderMode:       "paper",
+		Exchange:         "binance",
+		InitialBalance:   10000.0,
+		MinAccountEquity: 50,
+	}, nil)
+	if err != nil {
+		t.Fatalf("创建 AutoTrader 失败: %v", err)
+	}
+
+	t.Run("低于下限拒绝开仓", func(t *testing.T) {
+		at.lastAccountEquity = 12.5
+		for _, action := range []string{"open_long", "open_short", "limit_open_long", "limit_open_short"} {
+			allowed, reason := at.validateMinAccountEquity(&decision.Decision{Symbol: "BTCUSDT", Action: action})
+			if allowed || !strings.Contains(reason, "最低净值拦截") {
+				t.Errorf("%s 期望被拒绝，实际 allowed=%v reason=%q", action, allowed, reason)
+			}
+		}
+	})
+
+	t.Run("低于下限仍可管理持仓", func(t *testing.T) {
+		at.lastAccountEquity = 12.5
+		for _, action := range []string{"close_long", "partial_close_short", "update_stop_loss", "cancel_limit_order", "hold"} {
+			if allowed, reason := at.validateMinAccountEquity(&decision.Decision{Symbol: "BTCUSDT", Action: action}); !allowed {
+				t.Errorf("%s 不应被拦截: %s", action, reason)
+			}
+		}
+	})
+
+	t.Run("高于下限正常开仓", func(t *testing.T) {
+		at.lastAccountEquity = 50.01
+		if allowed, reason := at.validateMinAccountEquity(&decision.Decision{Symbol: "BTCUSDT", Action: "open_long"}); !allowed {
+			t.Errorf("净值高于下限应放行: %s", reason)
+		}
+	})
+
+	t.Run("未配置时不限制", func(t *testing.T) {
+		at.config.MinAccountEquity = 0
+		at.lastAccountEquity = 1
+		if allowed, reason := at.validateMinAccountEquity(&decision.Decision{Symbol: "BTCUSDT", Action: "open_long"}); !allowed {
+			t.Errorf("未配置下限时不应拦截: %s", reason)
+		}
+	})
+}
+
+func TestDailyLossCircuitBreaker(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
+	at, err := NewAutoTrader(AutoTraderConfig{
+		ID:              "test-daily-loss",
+		TraderMode:      "paper",
+		Exchange:        "binance",
+		InitialBalance:  1000.0,
+		MaxDailyLoss:    5,
+		StopTradingTime: 60 * time.Minute,
+	}, nil)
+	if err != nil {
+		t.Fatalf("创建 AutoTrader 失败: %v", err)
+	}
+
+	at.dailyPnL = -30 // 3%，未超限
+	if breached, _ := at.checkDailyLossLimit(); breached {
+		t.Fatal("亏损 3% 不应触发熔断")
+	}
+	if !at.stopUntil.IsZero() {
+		t.Fatal("未触发熔断时不应设置 stopUntil")
+	}
+
+	at.dailyPnL = -60 // 6%，超过 5% 上限
+	breached, msg := at.checkDailyLossLimit()
+	if !breached || !strings.Contains(msg, "日亏损熔断触发") {
+		t.Fatalf("期望触发熔断，实际 breached=%v msg=%q", breached, msg)
+	}
+	if remaining := time.Until(at.stopUntil); remaining < 59*time.Minute || remaining > 61*time.Minute {
+		t.Errorf("stopUntil 应为约 60 分钟后，实际剩余 %v", remaining)
+	}
+
+	for _, action := range []string{"open_long", "open_short", "limit_open_long", "limit_open_short"} {
+		d := &decision.Decision{Symbol: "BTCUSDT", Action: action, Leverage: 5, PositionSizeUSD: 100, StopLoss: 40000, TakeProfit: 60000}
+		record := &logger.DecisionAction{Action: action, Symbol: "BTCUSDT"}
+		if err := at.executeDecisionWithRecord(d, record); err != nil {
+			t.Fatalf("%s 被拦截时不应返回错误: %v", action, err)
+		}
+		if record.Action != "hold" || !strings.Contains(record.Error, "日亏损熔断拦截") {
+			t.Errorf("%s 期望被熔断拦截，实际 action=%s error=%q", action, record.Action, record.Error)
+		}
+	}
+
+	for _, action := range []string{"close_long", "close_short", "partial_close_long", "update_stop_loss", "cancel_limit_order", "hold"} {
+		if allowed, reason := at.validateDailyLossLimit(&decision.Decision{Symbol: "BTCUSDT", Action: action}); !allowed {
+			t.Errorf("%s 不应被熔断拦截: %s", action, reason)
+		}
+	}
+
+	at.config.MaxDailyLoss = 0
+	if allowed, reason := at.validateDailyLossLimit(&decision.Decision{Symbol: "BTCUSDT", Action: "open_long"}); !allowed {
+		t.Errorf("未配置日亏损上限时不应拦截: %s", reason)
+	}
+}
+
+// TestRuntimeStateSurvivesRestart 模拟重启：调用次数/运行时长/风控暂停从数据库恢复并继续累计
+func TestRuntimeStateSurvivesRestart(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db, err := config.NewDatabase("runtime.db")
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	cfg := AutoTraderConfig{
+		ID:             "test-runtime-state",
+		TraderMode:     "paper",
+		Exchange:       "binance",
+		InitialBalance: 1000.0,
+	}
+	first, err := NewAutoTrader(cfg, nil)
+	if err != nil {
+		t.Fatalf("创建 AutoTrader 失败: %v", err)
+	}
+	first.SetRuntimeStateStore(db)
+	if first.callCount != 0 {
+		t.Fatalf("首次启动调用次数应为0，实际 %d", first.callCount)
+	}
+
+	startedAt := time.Now().Add(-90 * time.Minute).Truncate(time.Second)
+	stopUntil := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	first.startTime = startedAt
+	first.callCount = 41
+	first.stopUntil = stopUntil
+	first.saveRuntimeState()
+
+	// 重启：新实例从数据库恢复
+	second, err := NewAutoTrader(cfg, nil)
+	if err != nil {
+		t.Fatalf("创建 AutoTrader 失败: %v", err)
+	}
+	second.SetRuntimeStateStore(db)
+
+	status := second.GetStatus()
+	if got := status["call_count"]; got != 41 {
+		t.Errorf("恢复后调用次数应为41，实际 %v", got)
+	}
+	if got := status["runtime_minutes"].(int); got < 90 {
+		t.Errorf("恢复后运行时长应从上次启动时间累计(>=90分钟)，实际 %d", got)
+	}
+	if !second.stopUntil.Equal(stopUntil) {
+		t.Errorf("风控暂停时间应恢复为 %v，实际 %v", stopUntil, second.stopUntil)
+	}
+
+	// 下一周期继续累计而不是从1开始
+	second.callCount++
+	second.saveRuntimeState()
+	state, err := db.GetTraderRuntimeState(cfg.ID)
+	if err != nil {
+		t.Fatalf("读取运行状态失败: %v", err)
+	}
+	if state.CallCount != 42 || !state.StartTime.Equal(startedAt) {
+		t.Errorf("期望保存 call_count=42 start_time=%v，实际 %d %v", startedAt, state.CallCount, state.StartTime)
+	}
+}
+
+// TestStopIdempotent 回归测试：并发/重复调用 Stop 不应 panic（close of closed channel）
+func TestStopIdempotent(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
+	at, err := NewAutoTrader(AutoTraderConfig{
+		ID:             "test-stop-idempotent",
+		TraderMode:     "paper",
+		Exchange:       "binance",
+		InitialBalance: 10000.0,
+	}, nil)
+	if err != nil {
+		t.Fatalf("创建 AutoTrader 失败: %v", err)
+	}
+
+	// 未启动时调用 Stop 不应出错
+	at.Stop()
+
+	// 模拟 Run 已启动
+	stopChan := make(chan struct{})
+	at.runMu.Lock()
+	at.isRunning = true
+	at.stopChan = stopChan
+	at.runMu.Unlock()
+	if !at.IsRunning() {
+		t.Fatal("启动后 IsRunning 应为 true")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			at.Stop()
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-stopChan:
+	default:
+		t.Error("Stop 后停止信号通道应已关闭")
+	}
+	if at.IsRunning() {
+		t.Error("Stop 后 IsRunning 应为 false")
+	}
+	at.Stop()
+}
+
+// TestReconcileAdoptsExistingProtectiveOrders 启动对账接管交易所已有的止损/止盈单，重复单被撤销且不重新下单
+func TestReconcileAdoptsExistingProtectiveOrders(t *testing.T) {
+	mockTrader := NewMockTrader()
+	mockTrader.SetPositions([]map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "entryPrice": 100.0, "positionAmt": 2.0},
+		{"symbol": "ETHUSDT", "side": "short", "entryPrice": 50.0, "positionAmt": -3.0},
+	})
+	staleSL := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "SELL", Type: "STOP_MARKET", StopPrice: 95})
+	breakevenSL := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "SELL", Type: "STOP_MARKET", StopPrice: 100})
+	oldTP := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "SELL", Type: "TAKE_PROFIT_MARKET", StopPrice: 118})
+	newTP := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "SELL", Type: "TAKE_PROFIT_MARKET", StopPrice: 120})
+	limitOrder := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "BUY", Type: "LIMIT", Price: 90})
+	mockTrader.AddOrder(&MockOrder{Symbol: "ETHUSDT", Side: "BUY", Type: "STOP_MARKET", StopPrice: 52})
+
+	at := &AutoTrader{
+		id:              "test-reconcile",
+		trader:          mockTrader,
+		positionTargets: make(map[string]*PositionTarget),
+	}
+
+	if err := at.reconcileProtectiveOrders(); err != nil {
+		t.Fatalf("对账失败: %v", err)
+	}
+
+	btc := at.positionTargets["BTCUSDT_long"]
+	if btc == nil {
+		t.Fatal("BTCUSDT 多单条件单未被接管")
+	}
+	if btc.CurrentSL != 100 || btc.Stage != 1 || btc.TP3 != 120 {
+		t.Errorf("BTCUSDT 接管结果错误: SL=%.2f stage=%d TP3=%.2f, want SL=100 stage=1 TP3=120", btc.CurrentSL, btc.Stage, btc.TP3)
+	}
+	eth := at.positionTargets["ETHUSDT_short"]
+	if eth == nil || eth.CurrentSL != 52 || eth.Stage != 0 {
+		t.Errorf("ETHUSDT 空单接管结果错误: %+v", eth)
+	}
+
+	status := func(orderID int64) string {
+		mockTrader.mu.RLock()
+		defer mockTrader.mu.RUnlock()
+		return mockTrader.orders[orderID].Status
+	}
+	for _, id := range []int64{staleSL, oldTP} {
+		if got := status(id); got != "CANCELED" {
+			t.Errorf("重复条件单 %d 应被撤销，实际状态 %s", id, got)
+		}
+	}
+	for _, id := range []int64{breakevenSL, newTP, limitOrder} {
+		if got := status(id); got != "NEW" {
+			t.Errorf("订单 %d 应保留，实际状态 %s", id, got)
+		}
+	}
+	if calls := mockTrader.ProtectiveOrderCalls(); calls != 0 {
+		t.Errorf("对账不应重新下止损/止盈单，实际调用 %d 次", calls)
+	}
+
+	// 再次对账不应产生变化
+	if err := at.reconcileProtectiveOrders(); err != nil {
+		t.Fatalf("再次对账失败: %v", err)
+	}
+	if btc := at.positionTargets["BTCUSDT_long"]; btc.CurrentSL != 100 || btc.TP3 != 120 {
+		t.Errorf("再次对账后结果变化: %+v", btc)
+	}
+}
+
+func TestInferTrailingStage(t *testing.T) {
+	tgt := &PositionTarget{TP1: 110, TP2: 120, TP3: 130}
+	cases := []struct {
+		side string
+		sl   float64
+		want int
+	}{
+		{"LONG", 95, 0},
+		{"LONG", 100, 1},
+		{"LONG", 105, 2},   // (entry+TP1)/2
+		{"LONG", 115, 3},   // (TP1+TP2)/2
+		{"LONG", 99.95, 1}, // 价格精度取整后仍视为保本
+	}
+	for _, c := range cases {
+		if got := inferTrailingStage(100, c.side, tgt, c.sl); got != c.want {
+			t.Errorf("%s SL=%.2f stage=%d, want %d", c.side, c.sl, got, c.want)
+		}
+	}
+
+	short := &PositionTarget{TP1: 90, TP2: 80}
+	if got := inferTrailingStage(100, "SHORT", short, 95); got != 2 {
+		t.Errorf("SHORT SL=95 stage=%d, want 2", got)
+	}
+	// TP未知时最多推断到保本阶段
+	if got := inferTrailingStage(100, "LONG", &PositionTarget{}, 108); got != 1 {
+		t.Errorf("TP未知时 stage=%d, want 1", got)
+	}
+}
+
+func TestScanInterval(t *testing.T) {
+	t.Chdir(t.TempDir()) // 决策记录等运行时文件写入临时目录
+
+	at, err := NewAutoTrader(AutoTraderConfig{
+		ID:             "test-scan-interval",
+		TraderMode:     "paper",
+		Exchange:       "binance",
+		InitialBalance: 10000.0,
+	}, nil)
+	if err != nil {
+		t.Fatalf("创建 AutoTrader 失败: %v", err)
+	}
+
+	if got := at.ScanInterval(); got != 3*time.Minute {
+		t.Errorf("未配置时扫描间隔 = %v, want 3m", got)
+	}
+
+	// 未运行时只更新配置
+	at.SetScanInterval(5 * time.Minute)
+	if got := at.GetStatus()["scan_interval"]; got != "5m0s" {
+		t.Errorf("GetStatus scan_interval = %v, want 5m0s", got)
+	}
+
+	// 运行中连续修改，主循环只收到最新值
+	intervalChan := make(chan time.Duration, 1)
+	at.runMu.Lock()
+	at.intervalChan = intervalChan
+	at.runMu.Unlock()
+
+	at.SetScanInterval(10 * time.Minute)
+	at.SetScanInterval(15 * time.Minute)
+	select {
+	case got := <-intervalChan:
+		if got != 15*time.Minute {
+			t.Errorf("运行中收到的扫描间隔 = %v, want 15m", got)
+		}
+	default:
+		t.Fatal("运行中修改扫描间隔应通知主循环")
+	}
+
+	at.SetScanInterval(0)
+	if got := at.ScanInterval(); got != 3*time.Minute {
+		t.Errorf("<=0 应恢复默认3分钟，实际 %v", got)
+	}
+}
+
+// newChatServer 模拟 OpenAI 兼容接口：status 非 200 时返回错误，否则返回固定决策
+func newChatServer(t *testing.T, status int, content string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			http.Error(w, "unauthorized", status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": content}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestAIFallbackModel 测试主模型失败时改用备用模型并记录模型来源
+func TestAIFallbackModel(t *testing.T) {
+	t.Chdir(t.TempDir())
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{Symbol: "BTCUSDT", CurrentPrice: 100000}})
+	defer market.ResetMarketDataProvider()
+
+	primary := newChatServer(t, http.StatusUnauthorized, "")
+	fallback := newChatServer(t, http.StatusOK, `分析完成 [{"symbol":"BTCUSDT","action":"hold","reasoning":"备用模型"}]`)
+
+	newTrader := func(fallbackURL string) *AutoTrader {
+		at, err := NewAutoTrader(AutoTraderConfig{
+			ID:                "test-ai-fallback",
+			TraderMode:        "paper",
+			Exchange:          "binance",
+			InitialBalance:    10000.0,
+			AIModel:           "custom",
+			CustomAPIURL:      primary.URL,
+			CustomAPIKey:      "primary-key",
+			CustomModelName:   "primary-model",
+			FallbackAIModel:   "custom",
+			FallbackAPIURL:    fallbackURL,
+			FallbackAPIKey:    "fallback-key",
+			FallbackModelName: "fallback-model",
+		}, nil)
+		if err != nil {
+			t.Fatalf("创建 AutoTrader 失败: %v", err)
+		}
+		at.mcpClient.SetUseStream(false)
+		if at.fallbackClient != nil {
+			at.fallbackClient.SetUseStream(false)
+		}
+		at.overrideBasePrompt = true
+		return at
+	}
+	newCtx := func() *decision.Context {
+		return &decision.Context{
+			Account:        decision.AccountInfo{TotalEquity: 10000, AvailableBalance: 10000},
+			CandidateCoins: []decision.CandidateCoin{{Symbol: "BTCUSDT"}},
+		}
+	}
+
+	t.Run("主模型失败时使用备用模型", func(t *testing.T) {
+		at := newTrader(fallback.URL)
+		resp, model, err := at.requestAIDecision(newCtx(), "system")
+		if err != nil {
+			t.Fatalf("备用模型应产生决策: %v", err)
+		}
+		if model != "custom/fallback-model" {
+			t.Errorf("决策模型 = %q, want custom/fallback-model", model)
+		}
+		if len(resp.Decisions) != 1 || resp.Decisions[0].Action != "hold" {
+			t.Errorf("决策 = %+v", resp.Decisions)
+		}
+	})
+
+	t.Run("备用模型也失败时返回错误", func(t *testing.T) {
+		at := newTrader(primary.URL)
+		if _, _, err := at.requestAIDecision(newCtx(), "system"); err == nil || !strings.Contains(err.Error(), "备用模型也失败") {
+			t.Errorf("期望主备均失败的错误，实际 %v", err)
+		}
+	})
+
+	t.Run("未配置备用模型", func(t *testing.T) {
+		if client := newFallbackMCPClient(AutoTraderConfig{}); client != nil {
+			t.Errorf("未配置 FallbackAIModel 时不应创建备用客户端")
+		}
+	})
+}
+
+// TestPartialClose 部分平仓按 StepSize 取整，比例为1时全部平掉并清理持仓跟踪
+func TestPartialClose(t *testing.T) {
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{Symbol: "BTCUSDT", CurrentPrice: 50000.0}})
+	defer market.ResetMarketDataProvider()
+	filters := NewMockSymbolFiltersProvider()
+	filters.SetFilters("BTCUSDT", 0.1, 0.001, 10.0)
+	market.SetSymbolFiltersProvider(filters)
+	defer market.ResetSymbolFiltersProvider()
+
+	mockTrader := NewMockTrader()
+	mockTrader.SetPositions([]map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "entryPrice": 48000.0, "positionAmt": 1.0},
+		{"symbol": "BTCUSDT", "side": "short", "entryPrice": 52000.0, "positionAmt": -0.5},
+	})
+	at := &AutoTrader{
+		id:                    "test-partial-close",
+		trader:                mockTrader,
+		positionTargets:       map[string]*PositionTarget{"BTCUSDT_long": {TP1: 51000, CurrentSL: 47000}, "BTCUSDT_short": {TP1: 49000}},
+		positionFirstSeenTime: map[string]int64{"BTCUSDT_short": 1},
+		positionMemory:        map[string]decision.PositionInfo{"BTCUSDT_short": {Symbol: "BTCUSDT"}},
+	}
+
+	var longRecord logger.DecisionAction
+	if err := at.executePartialCloseLongWithRecord(&decision.Decision{Symbol: "BTCUSDT", Action: "partial_close_long", CloseRatio: 0.3333}, &longRecord); err != nil {
+		t.Fatalf("部分平多失败: %v", err)
+	}
+	if math.Abs(longRecord.Quantity-0.333) > 1e-9 || longRecord.Price != 50000.0 || longRecord.OrderID == 0 {
+		t.Errorf("部分平多记录错误: qty=%.6f price=%.2f orderID=%d, want qty=0.333", longRecord.Quantity, longRecord.Price, longRecord.OrderID)
+	}
+	if tgt := at.positionTargets["BTCUSDT_long"]; tgt == nil || tgt.TP1 != 51000 || tgt.CurrentSL != 47000 {
+		t.Errorf("部分平仓后剩余仓位应保留止盈止损跟踪, got %+v", tgt)
+	}
+
+	var shortRecord logger.DecisionAction
+	if err := at.executePartialCloseShortWithRecord(&decision.Decision{Symbol: "BTCUSDT", Action: "partial_close_short", CloseRatio: 1.0}, &shortRecord); err != nil {
+		t.Fatalf("部分平空失败: %v", err)
+	}
+	if shortRecord.Quantity != 0.5 {
+		t.Errorf("比例为1应平掉全部空仓, got qty=%.6f", shortRecord.Quantity)
+	}
+	_, hasTarget := at.positionTargets["BTCUSDT_short"]
+	_, hasSeen := at.positionFirstSeenTime["BTCUSDT_short"]
+	_, hasMemory := at.positionMemory["BTCUSDT_short"]
+	if hasTarget || hasSeen || hasMemory {
+		t.Error("全部平掉后应清理 positionTargets/positionFirstSeenTime/positionMemory")
+	}
+
+	if _, err := at.partialCloseQuantity(&decision.Decision{Symbol: "BTCUSDT", CloseRatio: 0.0001}, 1.0); err == nil {
+		t.Error("取整后数量为0应返回错误")
+	}
+}
+
+// TestMinorSLTPChangeIgnored 止损/止盈变化未超过阈值时跳过改单并记录 NO_OP，变化足够大时正常改单
+func TestMinorSLTPChangeIgnored(t *testing.T) {
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{Symbol: "BTCUSDT", CurrentPrice: 110.0}})
+	defer market.ResetMarketDataProvider()
+
+	mockTrader := NewMockTrader()
+	mockTrader.SetPositions([]map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "entryPrice": 100.0, "positionAmt": 1.0},
+	})
+	tgt := &PositionTarget{TP1: 105, TP2: 110, TP3: 120, CurrentSL: 95, CurrentTP: 120}
+	at := &AutoTrader{
+		id:              "test-sltp-diff",
+		trader:          mockTrader,
+		config:          AutoTraderConfig{MinSLTPChangePct: 0.5},
+		positionTargets: map[string]*PositionTarget{"BTCUSDT_long": tgt},
+	}
+
+	var minorSL logger.DecisionAction
+	if err := at.executeUpdateStopLossWithRecord(&decision.Decision{Symbol: "BTCUSDT", NewStopLoss: 95.2, Leverage: 5}, &minorSL); err != nil {
+		t.Fatalf("update_stop_loss 失败: %v", err)
+	}
+	if minorSL.Status != "NO_OP" || minorSL.Reason == "" || tgt.CurrentSL != 95 {
+		t.Errorf("0.2%% 的止损变化应被跳过: status=%s reason=%q SL=%.2f", minorSL.Status, minorSL.Reason, tgt.CurrentSL)
+	}
+
+	var minorTP logger.DecisionAction
+	if err := at.executeUpdateTakeProfitWithRecord(&decision.Decision{Symbol: "BTCUSDT", NewTakeProfit: 120.3}, &minorTP); err != nil {
+		t.Fatalf("update_take_profit 失败: %v", err)
+	}
+	if minorTP.Status != "NO_OP" || tgt.CurrentTP != 120 {
+		t.Errorf("0.25%% 的止盈变化应被跳过: status=%s TP=%.2f", minorTP.Status, tgt.CurrentTP)
+	}
+	if calls := mockTrader.ProtectiveOrderCalls(); calls != 0 {
+		t.Fatalf("微小变化不应改单，实际调用 %d 次", calls)
+	}
+
+	var majorSL logger.DecisionAction
+	if err := at.executeUpdateStopLossWithRecord(&decision.Decision{Symbol: "BTCUSDT", NewStopLoss: 98, Leverage: 5}, &majorSL); err != nil {
+		t.Fatalf("update_stop_loss 失败: %v", err)
+	}
+	if majorSL.Status == "NO_OP" || tgt.CurrentSL != 98 {
+		t.Errorf("足够大的止损变化应生效: status=%s SL=%.2f", majorSL.Status, tgt.CurrentSL)
+	}
+	if calls := mockTrader.ProtectiveOrderCalls(); calls != 1 {
+		t.Errorf("有效止损变化应改单1次，实际 %d 次", calls)
+	}
+}
+
+// TestBinanceTimeSyncOffset 签名请求的 timestamp 按交易所服务器时间偏移校正
+func TestBinanceTimeSyncOffset(t *testing.T) {
+	const skewMs = 5000 // 本地时钟比服务器快5秒
+	var signedTimestamp int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v1/time":
+			json.NewEncoder(w).Encode(map[string]int64{"serverTime": time.Now().UnixMilli() - skewMs})
+		case "/fapi/v2/account":
+			signedTimestamp, _ = strconv.ParseInt(r.URL.Query().Get("timestamp"), 10, 64)
+			w.Write([]byte(`{"totalWalletBalance":"100","availableBalance":"100","totalUnrealizedProfit":"0","assets":[],"positions":[]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ft := NewFuturesTrader("test-key", "test-secret")
+	ft.client.BaseURL = server.URL
+
+	if _, err := ft.GetBalance(); err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+	if offset := ft.clock.OffsetMs(); math.Abs(float64(offset-skewMs)) > 1000 {
+		t.Errorf("时钟偏移 = %dms, want ≈%dms", offset, skewMs)
+	}
+	if drift := time.Now().UnixMilli() - skewMs - signedTimestamp; math.Abs(float64(drift)) > 1000 {
+		t.Errorf("签名请求 timestamp 未按服务器时间校正: 相差 %dms", drift)
+	}
+}
+
+// TestAlignOrderToFilters 开仓数量按步长向下取整、价格对齐tick、名义价值低于最小值时拒绝
+func TestAlignOrderToFilters(t *testing.T) {
+	doge := &market.SymbolFilters{TickSize: 0.00001, StepSize: 1, MinNotional: 5}
+
+	t.Run("数量恰好在步长边界", func(t *testing.T) {
+		for _, tc := range []struct {
+			qty, step float64
+		}{{0.3, 0.1}, {1.0, 0.001}, {63, 1}} {
+			got, err := alignOrderToFilters(&decision.Decision{Symbol: "TESTUSDT"}, tc.qty, 100, &market.SymbolFilters{StepSize: tc.step})
+			if err != nil || math.Abs(got-tc.qty) > 1e-12 {
+				t.Errorf("qty=%v step=%v: 边界数量不应被向下多取一步，实际 %v, %v", tc.qty, tc.step, got, err)
+			}
+		}
+	})
+
+	t.Run("向下取整不超过保证金", func(t *testing.T) {
+		got, err := alignOrderToFilters(&decision.Decision{Symbol: "DOGEUSDT"}, 123.999, 0.08, doge)
+		if err != nil || got != 123 {
+			t.Errorf("期望 123，实际 %v, %v", got, err)
+		}
+	})
+
+	t.Run("名义价值刚好低于最小值", func(t *testing.T) {
+		// 62.9 → 62，62 × 0.08 = 4.96 < 5
+		_, err := alignOrderToFilters(&decision.Decision{Symbol: "DOGEUSDT"}, 62.9, 0.08, doge)
+		if err == nil || !strings.Contains(err.Error(), "最小名义价值") {
+			t.Errorf("期望因最小名义价值拒绝，实际 %v", err)
+		}
+		// 63 × 0.08 = 5.04 ≥ 5
+		if got, err := alignOrderToFilters(&decision.Decision{Symbol: "DOGEUSDT"}, 63.4, 0.08, doge); err != nil || got != 63 {
+			t.Errorf("名义价值达到最小值应放行，实际 %v, %v", got, err)
+		}
+	})
+
+	t.Run("不足一个步长", func(t *testing.T) {
+		if _, err := alignOrderToFilters(&decision.Decision{Symbol: "BTCUSDT"}, 0.00099, 50000, &market.SymbolFilters{StepSize: 0.001}); err == nil {
+			t.Error("数量不足一个步长应拒绝")
+		}
+	})
+
+	t.Run("最小/最大下单数量", func(t *testing.T) {
+		provider := NewMockSymbolFiltersProvider()
+		provider.filters["BTCUSDT"] = &market.SymbolFilters{TickSize: 0.1, StepSize: 0.001, MinNotional: 5, MinQty: 0.002, MaxQty: 120}
+		market.SetSymbolFiltersProvider(provider)
+		defer market.ResetSymbolFiltersProvider()
+		at := &AutoTrader{}
+
+		// 恰好等于最小数量放行，低于最小数量拒绝并给出原因
+		if got, err := at.alignOpenOrder(&decision.Decision{Symbol: "BTCUSDT"}, 0.002, 50000); err != nil || math.Abs(got-0.002) > 1e-12 {
+			t.Errorf("等于最小数量应放行，实际 %v, %v", got, err)
+		}
+		if _, err := at.alignOpenOrder(&decision.Decision{Symbol: "BTCUSDT"}, 0.0019, 50000); err == nil || !strings.Contains(err.Error(), "最小数量") {
+			t.Errorf("低于最小数量应拒绝，实际 %v", err)
+		}
+
+		// 恰好等于最大数量不变，超过最大数量下调到最大值
+		if got, err := at.alignOpenOrder(&decision.Decision{Symbol: "BTCUSDT"}, 120, 50000); err != nil || got != 120 {
+			t.Errorf("等于最大数量应保持不变，实际 %v, %v", got, err)
+		}
+		if got, err := at.alignOpenOrder(&decision.Decision{Symbol: "BTCUSDT"}, 150.5, 50000); err != nil || got != 120 {
+			t.Errorf("超过最大数量应下调为 120，实际 %v, %v", got, err)
+		}
+	})
+
+	t.Run("交易员自己的过滤器优先", func(t *testing.T) {
+		global := NewMockSymbolFiltersProvider()
+		global.filters["BTCUSDT"] = &market.SymbolFilters{StepSize: 0.1}
+		market.SetSymbolFiltersProvider(global)
+		defer market.ResetSymbolFiltersProvider()
+		own := NewMockSymbolFiltersProvider()
+		own.filters["BTCUSDT"] = &market.SymbolFilters{StepSize: 0.001}
+
+		// 另一个交易员的全局过滤器不影响本交易员下单
+		at := &AutoTrader{symbolFilters: own}
+		if got, err := at.alignOpenOrder(&decision.Decision{Symbol: "BTCUSDT"}, 0.0123, 50000); err != nil || math.Abs(got-0.012) > 1e-12 {
+			t.Errorf("应按本交易员的步长 0.001 取整，实际 %v, %v", got, err)
+		}
+		if got, _ := (&AutoTrader{}).alignOpenOrder(&decision.Decision{Symbol: "BTCUSDT"}, 0.25, 50000); math.Abs(got-0.2) > 1e-12 {
+			t.Errorf("未设置时应使用全局过滤器，实际 %v", got)
+		}
+	})
+
+	t.Run("止损止盈对齐tick", func(t *testing.T) {
+		d := &decision.Decision{Symbol: "DOGEUSDT", StopLoss: 0.0751234, TakeProfit: 0.0912349, TP1: 0.0851, TP3: 0.0912349}
+		if _, err := alignOrderToFilters(d, 100, 0.08, doge); err != nil {
+			t.Fatalf("alignOrderToFilters: %v", err)
+		}
+		if math.Abs(d.StopLoss-0.07512) > 1e-12 || math.Abs(d.TakeProfit-0.09123) > 1e-12 || math.Abs(d.TP3-0.09123) > 1e-12 {
+			t.Errorf("价格未对齐tick: SL=%v TP=%v TP3=%v", d.StopLoss, d.TakeProfit, d.TP3)
+		}
+		if d.TP2 != 0 {
+			t.Errorf("未设置的TP2应保持0，实际 %v", d.TP2)
+		}
+	})
+}
+
+// TestFuturesTraderFormatsWithCachedExchangeInfo 币安下单数量/价格按缓存的 exchangeInfo 过滤器格式化
+func TestFuturesTraderFormatsWithCachedExchangeInfo(t *testing.T) {
+	var exchangeInfoCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fapi/v1/exchangeInfo" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&exchangeInfoCalls, 1)
+		w.Write([]byte(`{"symbols":[{"symbol":"DOGEUSDT","filters":[
+			{"filterType":"PRICE_FILTER","tickSize":"0.000010"},
+			{"filterType":"LOT_SIZE","stepSize":"1"},
+			{"filterType":"MIN_NOTIONAL","notional":"5"}]}]}`))
+	}))
+	defer server.Close()
+
+	ft := NewFuturesTrader("test-key", "test-secret")
+	ft.client.BaseURL = server.URL
+
+	filters, err := ft.GetSymbolFilters("DOGEUSDT")
+	if err != nil {
+		t.Fatalf("GetSymbolFilters: %v", err)
+	}
+	if filters.TickSize != 0.00001 || filters.StepSize != 1 || filters.MinNotional != 5 {
+		t.Errorf("过滤器解析错误: %+v", filters)
+	}
+	if qty, _ := ft.FormatQuantity("DOGEUSDT", 123.999); qty != "123" {
+		t.Errorf("FormatQuantity = %s, want 123（向下取整）", qty)
+	}
+	if price := ft.FormatPrice("DOGEUSDT", 0.0812349); price != "0.08123" {
+		t.Errorf("FormatPrice = %s, want 0.08123", price)
+	}
+	if calls := atomic.LoadInt32(&exchangeInfoCalls); calls != 1 {
+		t.Errorf("exchangeInfo 应缓存，实际请求 %d 次", calls)
+	}
+}
+
+// TestFuturesTraderProtectiveOrderParams 只减仓的止损/止盈以 closePosition 下单且不带 quantity，否则按数量下单
+func TestFuturesTraderProtectiveOrderParams(t *testing.T) {
+	var orders []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fapi/v1/exchangeInfo":
+			w.Write([]byte(`{"symbols":[{"symbol":"BTCUSDT","filters":[
+				{"filterType":"PRICE_FILTER","tickSize":"0.10"},
+				{"filterType":"LOT_SIZE","stepSize":"0.001"}]}]}`))
+		case "/fapi/v1/order":
+			r.ParseForm()
+			orders = append(orders, r.Form)
+			w.Write([]byte(`{"orderId":1}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	ft := NewFuturesTrader("test-key", "test-secret")
+	ft.client.BaseURL = server.URL
+
+	if err := ft.SetStopLoss("BTCUSDT", "LONG", 0.5, 49000, true); err != nil {
+		t.Fatalf("SetStopLoss: %v", err)
+	}
+	if err := ft.SetTakeProfit("BTCUSDT", "SHORT", 0.5, 45000, false); err != nil {
+		t.Fatalf("SetTakeProfit: %v", err)
+	}
+	if len(orders) != 2 {
+		t.Fatalf("应下 2 笔条件单, got %d", len(orders))
+	}
+	if stop := orders[0]; stop.Get("closePosition") != "true" || stop.Has("quantity") || stop.Has("reduceOnly") {
+		t.Errorf("只减仓止损应为 closePosition 且不带 quantity/reduceOnly, got %v", stop)
+	}
+	if tp := orders[1]; tp.Get("quantity") != "0.500" || tp.Has("closePosition") {
+		t.Errorf("非只减仓止盈应按数量下单, got %v", tp)
+	}
+}
+
+// TestFuturesTraderPostOnlyOpen 币安post-only开仓以GTX挂单并按传入杠杆设置杠杆，普通限价开仓仍为GTC
+func TestFuturesTraderPostOnlyOpen(t *testing.T) {
+	prevCooldown := leverageCooldown
+	leverageCooldown = 0
+	defer func() { leverageCooldown = prevCooldown }()
+
+	var orders, leverages []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/fapi/v1/exchangeInfo":
+			w.Write([]byte(`{"symbols":[{"symbol":"BTCUSDT","filters":[
+				{"filterType":"PRICE_FILTER","tickSize":"0.10"},
+				{"filterType":"LOT_SIZE","stepSize":"0.001"}]}]}`))
+		case "/fapi/v1/leverage":
+			leverages = append(leverages, r.Form)
+			w.Write([]byte(`{"leverage":7,"symbol":"BTCUSDT"}`))
+		case "/fapi/v1/order":
+			orders = append(orders, r.Form)
+			w.Write([]byte(`{"orderId":1,"status":"NEW"}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	ft := NewFuturesTrader("test-key", "test-secret")
+	ft.client.BaseURL = server.URL
+
+	if _, err := ft.PostOnlyOpenLong("BTCUSDT", 0.02, 7, 50000.1, 49000, "cid-1"); err != nil {
+		t.Fatalf("PostOnlyOpenLong: %v", err)
+	}
+	if _, err := ft.LimitOpenShort("BTCUSDT", 0.02, 3, 50010, 51000); err != nil {
+		t.Fatalf("LimitOpenShort: %v", err)
+	}
+	if len(orders) != 2 || len(leverages) != 2 {
+		t.Fatalf("应下 2 笔限价单并设置 2 次杠杆, got orders=%d leverages=%d", len(orders), len(leverages))
+	}
+	if o := orders[0]; o.Get("timeInForce") != "GTX" || o.Get("price") != "50000.1" || o.Get("newClientOrderId") != "cid-1" {
+		t.Errorf("post-only开仓应为GTX并保留限价与clientOrderId, got %v", o)
+	}
+	if leverages[0].Get("leverage") != "7" {
+		t.Errorf("post-only开仓应按传入杠杆 7 设置, got %v", leverages[0])
+	}
+	if o := orders[1]; o.Get("timeInForce") != "GTC" {
+		t.Errorf("普通限价开仓应为GTC, got %v", o)
+	}
+}
+
+// TestNewTraderFromCredentialsTestnet 币安凭证校验按 Testnet 选择测试网地址
+func TestNewTraderFromCredentialsTestnet(t *testing.T) {
+	for testnet, want := range map[bool]string{true: futures.BaseApiTestnetUrl, false: futures.BaseApiMainUrl} {
+		tr, err := NewTraderFromCredentials("binance", ExchangeCredentials{APIKey: "key", SecretKey: "secret", Testnet: testnet})
+		if err != nil {
+			t.Fatalf("NewTraderFromCredentials: %v", err)
+		}
+		if got := tr.(*FuturesTrader).client.BaseURL; got != want {
+			t.Errorf("Testnet=%v 时 BaseURL = %s, want %s", testnet, got, want)
+		}
+	}
+}
+
+// TestVerifyExchangeCredentialsTimeout 交易器构造阻塞（如 Hyperliquid 拉取元数据）同样受校验超时约束
+func TestVerifyExchangeCredentialsTimeout(t *testing.T) {
+	prevTimeout, prevConstructor := credentialCheckTimeout, newCredentialTrader
+	defer func() { credentialCheckTimeout, newCredentialTrader = prevTimeout, prevConstructor }()
+	credentialCheckTimeout = 50 * time.Millisecond
+
+	release := make(chan struct{})
+	defer close(release)
+	newCredentialTrader = func(exchangeID string, creds ExchangeCredentials) (Trader, error) {
+		<-release
+		return NewMockTrader(), nil
+	}
+	start := time.Now()
+	err := VerifyExchangeCredentials("hyperliquid", ExchangeCredentials{APIKey: "key"})
+	if err == nil || !strings.Contains(err.Error(), "超时") {
+		t.Fatalf("构造阻塞时应返回超时错误, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("应在超时后立即返回, 耗时 %v", elapsed)
+	}
+
+	newCredentialTrader = func(exchangeID string, creds ExchangeCredentials) (Trader, error) {
+		return NewMockTrader(), nil
+	}
+	if err := VerifyExchangeCredentials("binance", ExchangeCredentials{}); err != nil {
+		t.Errorf("构造与余额查询成功时不应报错, got %v", err)
+	}
+}
+
+// TestWatchdogFlattensStalledLoop 决策循环停滞超过阈值时看门狗平掉全部持仓，且每次停滞只触发一次
+func TestWatchdogFlattensStalledLoop(t *testing.T) {
+	mockTrader := NewMockTrader()
+	mockTrader.SetPositions([]map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "entryPrice": 100.0, "positionAmt": 1.0},
+		{"symbol": "ETHUSDT", "side": "short", "entryPrice": 50.0, "positionAmt": -2.0},
+	})
+	at := &AutoTrader{
+		id:                    "test-watchdog",
+		name:                  "test-watchdog",
+		trader:                mockTrader,
+		config:                AutoTraderConfig{WatchdogTimeout: 10 * time.Minute, WatchdogAction: "flatten"},
+		positionTargets:       map[string]*PositionTarget{"BTCUSDT_long": {CurrentSL: 95}},
+		positionFirstSeenTime: map[string]int64{},
+		positionMemory:        map[string]decision.PositionInfo{},
+	}
+
+	at.markCycleSuccess()
+	now := time.Now()
+	if at.checkWatchdog(now.Add(5 * time.Minute)) {
+		t.Fatal("未超过阈值不应触发看门狗")
+	}
+
+	// 周期仍在执行时推迟动作，不与可能正在开仓的周期并发
+	at.cycleMu.Lock()
+	if at.checkWatchdog(now.Add(11 * time.Minute)) {
+		t.Fatal("决策周期执行中时看门狗应推迟平仓")
+	}
+	at.cycleMu.Unlock()
+	if len(mockTrader.CloseCalls()) != 0 {
+		t.Fatal("推迟期间不应平仓")
+	}
+
+	// 模拟循环卡住：超过阈值仍无成功周期
+	if !at.checkWatchdog(now.Add(11 * time.Minute)) {
+		t.Fatal("循环停滞超过阈值应触发看门狗")
+	}
+	if got := fmt.Sprint(mockTrader.CloseCalls()); got != "[BTCUSDT_long ETHUSDT_short]" {
+		t.Errorf("看门狗应平掉全部持仓, got %s", got)
+	}
+	if _, ok := at.positionTargets["BTCUSDT_long"]; ok {
+		t.Error("平仓后应清理 TP 记忆")
+	}
+	if at.checkWatchdog(now.Add(20 * time.Minute)) {
+		t.Error("同一次停滞不应重复触发")
+	}
+
+	// 恢复成功周期后重新计时
+	at.markCycleSuccess()
+	if at.checkWatchdog(time.Now().Add(time.Minute)) {
+		t.Error("成功周期后不应触发")
+	}
+}
+
+func TestMaxAdverseExcursionForceClose(t *testing.T) {
+	mockTrader := NewMockTrader()
+	mockTrader.SetPositions([]map[string]interface{}{
+		// 10x 多单下跌 4% → 亏损 40% 保证金，超过 30%
+		{"symbol": "BTCUSDT", "side": "long", "entryPrice": 100.0, "markPrice": 96.0, "positionAmt": 1.0, "leverage": 10.0},
+		// 5x 空单上涨 2% → 亏损 10% 保证金，未达阈值
+		{"symbol": "ETHUSDT", "side": "short", "entryPrice": 50.0, "markPrice": 51.0, "positionAmt": -2.0, "leverage": 5.0},
+		// SOL 单独配置 5%：3x 空单上涨 2% → 亏损 6%
+		{"symbol": "SOLUSDT", "side": "short", "entryPrice": 20.0, "markPrice": 20.4, "positionAmt": -3.0, "leverage": 3.0},
+	})
+	at := &AutoTrader{
+		id:     "test-mae",
+		name:   "test-mae",
+		trader: mockTrader,
+		config: AutoTraderConfig{
+			MaxAdverseExcursionPct:       30,
+			MaxAdverseExcursionPctSymbol: map[string]float64{"SOLUSDT": 5},
+		},
+		positionTargets:       map[string]*PositionTarget{"BTCUSDT_long": {CurrentSL: 80}},
+		positionFirstSeenTime: map[string]int64{},
+		positionMemory:        map[string]decision.PositionInfo{},
+		cooldownStates:        map[string]int64{},
+		stopLossHistory:       map[string][]int64{},
+	}
+
+	events := at.enforceMaxAdverseExcursion()
+	if got := fmt.Sprint(mockTrader.CloseCalls()); got != "[BTCUSDT_long SOLUSDT_short]" {
+		t.Fatalf("超过MAE阈值的持仓应被强制平仓, got %s", got)
+	}
+	if len(events) != 2 {
+		t.Fatalf("期望 2 条自动平仓记录, got %d", len(events))
+	}
+	btc := events[0]
+	if btc.Action != "close_long" || !btc.Success || !btc.WasStopLoss || btc.Price != 96.0 ||
+		!strings.HasPrefix(btc.Reason, "max_adverse_excursion") {
+		t.Errorf("自动平仓记录不正确: %+v", btc)
+	}
+	if _, ok := at.positionTargets["BTCUSDT_long"]; ok {
+		t.Error("强制平仓后应清理 TP 记忆")
+	}
+	if !at.isInCooldown("BTCUSDT", "long") {
+		t.Error("强制平仓应按止损进入冷却")
+	}
+
+	// 关闭时不检查
+	at.config = AutoTraderConfig{}
+	if events := at.enforceMaxAdverseExcursion(); events != nil {
+		t.Errorf("未配置阈值不应平仓, got %+v", events)
+	}
+}
+
+func TestObserveOnlySymbolsBlockOpens(t *testing.T) {
+	at := &AutoTrader{
+		id:     "test-observe-only",
+		name:   "test-observe-only",
+		trader: NewMockTrader(),
+		config: AutoTraderConfig{ObserveOnlySymbols: []string{"btc", " "}},
+	}
+
+	if got := fmt.Sprint(at.observeOnlySymbols()); got != "[BTCUSDT]" {
+		t.Errorf("observeOnlySymbols = %s, want [BTCUSDT]", got)
+	}
+
+	for _, action := range []string{"open_long", "open_short", "limit_open_long", "limit_open_short"} {
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: action, PositionSizeUSD: 100, Leverage: 5}
+		record := &logger.DecisionAction{Action: action, Symbol: "BTCUSDT"}
+		if err := at.executeDecisionWithRecord(dec, record); err != nil {
+			t.Fatalf("%s: %v", action, err)
+		}
+		if record.Action != "hold" || !strings.Contains(record.Error, "仅观察币种拦截") {
+			t.Errorf("%s 仅观察币种开仓应被拦截, got action=%s error=%q", action, record.Action, record.Error)
+		}
+	}
+
+	for _, action := range []string{"close_long", "update_stop_loss", "cancel_limit_order"} {
+		if allowed, reason := at.validateObserveOnly(&decision.Decision{Symbol: "BTCUSDT", Action: action}); !allowed {
+			t.Errorf("%s 不应被拦截: %s", action, reason)
+		}
+	}
+	if allowed, reason := at.validateObserveOnly(&decision.Decision{Symbol: "ETHUSDT", Action: "open_long"}); !allowed {
+		t.Errorf("非观察币种应放行: %s", reason)
+	}
+}
+
+func TestRiskOffGuardBlocksAltOpens(t *testing.T) {
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{
+		Symbol:        "BTCUSDT",
+		CurrentPrice:  60000,
+		PriceChange4h: -4.5,
+		RiskMetrics:   &market.RiskMetrics{VolatilityLevel: "high"},
+	}})
+	defer market.ResetMarketDataProvider()
+
+	at := &AutoTrader{
+		id:     "test-risk-off",
+		name:   "test-risk-off",
+		trader: NewMockTrader(),
+		config: AutoTraderConfig{RiskOffGuard: "block_alt_longs"},
+	}
+
+	for _, action := range []string{"open_long", "limit_open_long"} {
+		allowed, reason := at.validateRiskOffGuard(&decision.Decision{Symbol: "SOLUSDT", Action: action})
+		if allowed || !strings.Contains(reason, "大盘risk-off拦截") {
+			t.Errorf("%s 山寨币开多应被拦截, got allowed=%v reason=%q", action, allowed, reason)
+		}
+	}
+	for _, dec := range []decision.Decision{
+		{Symbol: "SOLUSDT", Action: "open_short"},
+		{Symbol: "SOLUSDT", Action: "close_long"},
+		{Symbol: "BTCUSDT", Action: "open_long"},
+	} {
+		if allowed, reason := at.validateRiskOffGuard(&dec); !allowed {
+			t.Errorf("%s %s 不应被拦截: %s", dec.Symbol, dec.Action, reason)
+		}
+	}
+
+	at.config.RiskOffGuard = "limit_only"
+	if allowed, _ := at.validateRiskOffGuard(&decision.Decision{Symbol: "SOLUSDT", Action: "open_short"}); allowed {
+		t.Error("limit_only 模式下山寨币市价开仓应被拦截")
+	}
+	if allowed, reason := at.validateRiskOffGuard(&decision.Decision{Symbol: "SOLUSDT", Action: "limit_open_long"}); !allowed {
+		t.Errorf("limit_only 模式下山寨币限价开仓应放行: %s", reason)
+	}
+
+	// 未启用时不拦截
+	at.config.RiskOffGuard = ""
+	if allowed, reason := at.validateRiskOffGuard(&decision.Decision{Symbol: "SOLUSDT", Action: "open_long"}); !allowed {
+		t.Errorf("未启用防护时不应拦截: %s", reason)
+	}
+}
+
+// TestShadowModeSimulatesOrders 测试影子模式：读取真实账户，不发送订单，记录模拟成交并更新止盈止损跟踪
+func TestShadowModeSimulatesOrders(t *testing.T) {
+	t.Chdir(t.TempDir()) // 每日开单计数写入临时目录
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{
+		Symbol:       "ETHUSDT",
+		CurrentPrice: 3000.0,
+		Execution:    &market.ExecutionGate{Mode: "market_ok"},
+	}})
+	defer market.ResetMarketDataProvider()
+
+	inner := NewMockTrader()
+	inner.SetPositions([]map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.1, "entryPrice": 48000.0, "markPrice": 50000.0, "leverage": 5.0},
+	})
+	at := &AutoTrader{
+		id:                    "test-shadow",
+		name:                  "test-shadow",
+		trader:                newShadowTrader(inner),
+		config:                AutoTraderConfig{TraderMode: "shadow"},
+		positionTargets:       make(map[string]*PositionTarget),
+		positionFirstSeenTime: make(map[string]int64),
+		positionMemory:        make(map[string]decision.PositionInfo),
+		dailyPairTrades:       make(map[string]int),
+	}
+	if !at.IsShadowMode() {
+		t.Fatal("IsShadowMode 应为 true")
+	}
+	if status := at.GetStatus(); status["trader_mode"] != "shadow" {
+		t.Errorf("GetStatus trader_mode = %v, want shadow", status["trader_mode"])
+	}
+
+	// 只读接口直连真实账户
+	positions, err := at.trader.GetPositions()
+	if err != nil || len(positions) != 1 {
+		t.Fatalf("GetPositions = %v, %v", positions, err)
+	}
+
+	dec := &decision.Decision{
+		Symbol: "ETHUSDT", Action: "open_long", PositionSizeUSD: 100, Leverage: 5,
+		StopLoss: 2900, TakeProfit: 3300, TP1: 3100, TP2: 3200, TP3: 3300,
+	}
+	record := &logger.DecisionAction{Action: dec.Action, Symbol: dec.Symbol}
+	if err := at.executeOpenLongWithRecord(dec, record); err != nil {
+		t.Fatalf("影子模式开仓失败: %v", err)
+	}
+	if inner.ProtectiveOrderCalls() != 0 {
+		t.Errorf("影子模式不应设置真实止盈止损, got %d 次", inner.ProtectiveOrderCalls())
+	}
+	if record.OrderID <= shadowOrderIDBase {
+		t.Errorf("应记录模拟订单ID, got %d", record.OrderID)
+	}
+	if tgt := at.positionTargets["ETHUSDT_long"]; tgt == nil || tgt.TP1 != 3100 || tgt.CurrentSL != 2900 {
+		t.Errorf("影子模式应更新 positionTargets, got %+v", tgt)
+	}
+
+	order, err := at.trader.CloseLong("BTCUSDT", 0)
+	if err != nil || order["simulated"] != true || order["avgPrice"] != 50000.0 {
+		t.Fatalf("CloseLong = %v, %v, 期望按标记价模拟成交", order, err)
+	}
+	if calls := inner.CloseCalls(); len(calls) != 0 {
+		t.Errorf("影子模式不应向交易所发送平仓, got %v", calls)
+	}
+	status, err := at.trader.GetOrderStatus("BTCUSDT", order["orderId"].(int64))
+	if err != nil || status["status"] != "FILLED" {
+		t.Errorf("模拟订单状态 = %v, %v, want FILLED", status, err)
+	}
+}
+
+func TestResetPaperStateUsesDecisionLoggerDir(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	at, err := NewAutoTrader(AutoTraderConfig{
+		ID:             "test-paper-reset",
+		TraderMode:     "paper",
+		Exchange:       "binance",
+		InitialBalance: 10000.0,
+	}, nil)
+	if err != nil {
+		t.Fatalf("创建 AutoTrader 失败: %v", err)
+	}
+	logDir := t.TempDir()
+	at.decisionLogger = logger.NewDecisionLogger(logDir)
+
+	at.dailyPairTrades["BTCUSDT"] = 2
+	at.saveDailyPairTrades()
+	path := filepath.Join(logDir, "daily_pair_trades.json")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("每日开单计数应写入决策记录目录: %v", err)
+	}
+
+	if err := at.ResetPaperState(false); err != nil {
+		t.Fatalf("ResetPaperState() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("重置后应删除决策记录目录中的每日开单计数, stat err = %v", err)
+	}
+}
+
+// TestLimitOrderReportFillCosts 测试执行报告的手续费与滑点：滑点按方向计算，并写入决策动作
+func TestLimitOrderReportFillCosts(t *testing.T) {
+	buy := &LimitOrderExecutionReport{Side: "BUY", LimitPrice: 100}
+	buy.recordFill(map[string]interface{}{"executedQty": 2.0, "avgPrice": 100.1, "commission": 0.08})
+	if buy.FilledQuantity != 2 || buy.Commission != 0.08 || math.Abs(buy.SlippageBps-10) > 1e-6 {
+		t.Errorf("买单: qty=%.2f commission=%.4f slippage=%.4f, want 2 0.08 10", buy.FilledQuantity, buy.Commission, buy.SlippageBps)
+	}
+
+	// 卖单成交高于限价为有利滑点（负值）；无手续费字段时保持0
+	sell := &LimitOrderExecutionReport{Side: "SELL", LimitPrice: 100}
+	sell.recordFill(map[string]interface{}{"executedQty": 1.0, "avgPrice": 100.2})
+	if sell.Commission != 0 || math.Abs(sell.SlippageBps+20) > 1e-6 {
+		t.Errorf("卖单: commission=%.4f slippage=%.4f, want 0 -20", sell.Commission, sell.SlippageBps)
+	}
+
+	// 未成交不计算滑点
+	if got := limitSlippageBps("BUY", 100, 0); got != 0 {
+		t.Errorf("未成交滑点 = %.4f, want 0", got)
+	}
+
+	record := &logger.DecisionAction{}
+	recordExecutionCosts(record, buy)
+	if record.Commission != 0.08 || math.Abs(record.SlippageBps-10) > 1e-6 {
+		t.Errorf("决策动作未记录成本: commission=%.4f slippage=%.4f", record.Commission, record.SlippageBps)
+	}
+	recordExecutionCosts(record, nil) // 无报告时不修改
+	if record.Commission != 0.08 {
+		t.Errorf("nil 报告不应修改决策动作")
+	}
+}
+
+func TestHandleUserDataEvent(t *testing.T) {
+	mockTrader := NewMockTrader()
+	mockTrader.SetPositions([]map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.01, "entryPrice": 60000.0},
+	})
+
+	at := &AutoTrader{
+		id:                    "test-user-data",
+		name:                  "test-user-data",
+		trader:                mockTrader,
+		config:                AutoTraderConfig{UserDataStream: true},
+		positionFirstSeenTime: make(map[string]int64),
+		positionTargets:       make(map[string]*PositionTarget),
+		pendingOrders: map[string]*PendingOrder{
+			"BTCUSDT_long": {Symbol: "BTCUSDT", Side: "long", OrderID: 42, StopLoss: 59000, TakeProfit: 63000, TP3: 63000, CreateTime: 1700000000000},
+		},
+	}
+
+	// MockTrader 不支持用户数据流，回退轮询
+	if events := at.startUserDataStream(context.Background()); events != nil {
+		t.Error("不支持用户数据流的交易器应返回 nil")
+	}
+
+	// 其他订单的事件不影响挂单
+	at.handleUserDataEvent(UserDataEvent{Type: UserDataOrderUpdate, Symbol: "BTCUSDT", OrderID: 7, Status: "FILLED", OrderType: "LIMIT"})
+	if len(at.pendingOrders) != 1 {
+		t.Fatalf("非跟踪订单的事件不应移除挂单")
+	}
+
+	// 部分成交时继续等待
+	at.handleUserDataEvent(UserDataEvent{Type: UserDataOrderUpdate, Symbol: "BTCUSDT", OrderID: 42, Status: "PARTIALLY_FILLED", OrderType: "LIMIT"})
+	if len(at.pendingOrders) != 1 {
+		t.Fatalf("部分成交时不应移除挂单")
+	}
+
+	at.handleUserDataEvent(UserDataEvent{Type: UserDataOrderUpdate, Symbol: "BTCUSDT", OrderID: 42, Status: "FILLED", OrderType: "LIMIT"})
+	if len(at.pendingOrders) != 0 {
+		t.Errorf("限价单成交推送后应移除挂单，剩余 %d", len(at.pendingOrders))
+	}
+	if tgt := at.positionTargets["BTCUSDT_long"]; tgt == nil || tgt.TP3 != 63000 || tgt.CurrentSL != 59000 {
+		t.Errorf("成交后应记录TP点位, got %+v", tgt)
+	}
+	if got := at.positionFirstSeenTime["BTCUSDT_long"]; got != 1700000000000 {
+		t.Errorf("开仓时间应为挂单创建时间, got %d", got)
+	}
+	if calls := mockTrader.ProtectiveOrderCalls(); calls != 2 {
+		t.Errorf("成交后应设置止损和止盈，实际调用 %d 次", calls)
+	}
+
+	// 持仓变化推送记录新持仓的首次出现时间，平仓留给周期内的持仓对比处理
+	at.handleUserDataEvent(UserDataEvent{Type: UserDataAccountUpdate, Positions: []UserDataPosition{
+		{Symbol: "ETHUSDT", Side: "short", Amount: 0.5},
+		{Symbol: "BTCUSDT", Side: "long", Amount: 0},
+	}})
+	if _, ok := at.positionFirstSeenTime["ETHUSDT_short"]; !ok {
+		t.Error("新持仓应记录首次出现时间")
+	}
+	if got := at.positionFirstSeenTime["BTCUSDT_long"]; got != 1700000000000 {
+		t.Errorf("平仓推送不应直接清理持仓记录, got %d", got)
+	}
+
+	if !isTakeProfitFill(UserDataEvent{Status: "FILLED", OrderType: "TAKE_PROFIT_MARKET"}) {
+		t.Error("TAKE_PROFIT_MARKET 成交应视为止盈成交")
+	}
+	if isTakeProfitFill(UserDataEvent{Status: "FILLED", OrderType: "LIMIT"}) {
+		t.Error("非减仓限价单成交不应视为止盈成交")
+	}
+}
+
+func TestContinuousTrailingStop(t *testing.T) {
+	provider := &MockMarketDataProvider{data: &market.Data{Symbol: "BTCUSDT", CurrentPrice: 60500}}
+	market.SetMarketDataProvider(provider)
+	defer market.ResetMarketDataProvider()
+
+	mockTrader := NewMockTrader()
+	setMark := func(price float64) {
+		provider.data = &market.Data{Symbol: "BTCUSDT", CurrentPrice: price}
+		mockTrader.SetPositions([]map[string]interface{}{
+			{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.04, "entryPrice": 60000.0, "markPrice": price},
+		})
+	}
+	setMark(60500)
+
+	at := &AutoTrader{
+		id:                    "test-trailing",
+		name:                  "test-trailing",
+		trader:                mockTrader,
+		positionFirstSeenTime: make(map[string]int64),
+		positionTargets: map[string]*PositionTarget{
+			"BTCUSDT_long": {TP1: 61000, TP2: 62000, TP3: 63000, CurrentSL: 59000, CurrentTP: 63000},
+		},
+	}
+
+	// 参数校验：二选一
+	record := &logger.DecisionAction{}
+	if err := at.executeUpdateTrailingStopWithRecord(&decision.Decision{Symbol: "BTCUSDT", Action: "update_trailing_stop"}, record); err == nil {
+		t.Error("未提供移动距离应返回错误")
+	}
+	if err := at.executeUpdateTrailingStopWithRecord(&decision.Decision{Symbol: "ETHUSDT", Action: "update_trailing_stop", TrailingPct: 1}, record); err == nil {
+		t.Error("无持仓时应返回错误")
+	}
+	if err := at.executeUpdateTrailingStopWithRecord(&decision.Decision{Symbol: "BTCUSDT", Action: "update_trailing_stop", TrailingPct: 1}, record); err != nil {
+		t.Fatalf("executeUpdateTrailingStopWithRecord() error = %v", err)
+	}
+	tgt := at.positionTargets["BTCUSDT_long"]
+	if tgt.TrailingPct != 1 || mockTrader.ProtectiveOrderCalls() != 0 {
+		t.Fatalf("动作只记录配置，不应立即改单: pct=%.2f calls=%d", tgt.TrailingPct, mockTrader.ProtectiveOrderCalls())
+	}
+
+	// 未到TP1：按标记价 1% 收紧止损
+	if err := at.autoCheckAndUpdateStopLoss(); err != nil {
+		t.Fatalf("autoCheckAndUpdateStopLoss() error = %v", err)
+	}
+	if math.Abs(tgt.CurrentSL-59895) > 1e-6 || tgt.Stage != 0 {
+		t.Errorf("移动止损应为 59895 且阶段不变, got sl=%.4f stage=%d", tgt.CurrentSL, tgt.Stage)
+	}
+
+	// 价格回落：只收紧不放宽
+	setMark(60200)
+	if err := at.autoCheckAndUpdateStopLoss(); err != nil {
+		t.Fatalf("autoCheckAndUpdateStopLoss() error = %v", err)
+	}
+	if math.Abs(tgt.CurrentSL-59895) > 1e-6 {
+		t.Errorf("价格回落不应放宽止损, got %.4f", tgt.CurrentSL)
+	}
+	if calls := mockTrader.ProtectiveOrderCalls(); calls != 1 {
+		t.Errorf("止损仅应修改 1 次，实际 %d 次", calls)
+	}
+
+	// 到达TP1：阶段止损（保本60000）与移动止损（60588）合并取更紧者，只改一次单
+	setMark(61200)
+	if err := at.autoCheckAndUpdateStopLoss(); err != nil {
+		t.Fatalf("autoCheckAndUpdateStopLoss() error = %v", err)
+	}
+	if math.Abs(tgt.CurrentSL-60588) > 1e-6 || tgt.Stage != 1 {
+		t.Errorf("应取更紧的移动止损并推进阶段, got sl=%.4f stage=%d", tgt.CurrentSL, tgt.Stage)
+	}
+	if calls := mockTrader.ProtectiveOrderCalls(); calls != 2 {
+		t.Errorf("同一周期只应修改一次止损，累计调用 %d 次", calls)
+	}
+	if closes := mockTrader.CloseCalls(); len(closes) != 1 {
+		t.Errorf("到达TP1应分批平仓一次, got %v", closes)
+	}
+
+	if got := computeContinuousTrailingSL("SHORT", &PositionTarget{TrailingATRMult: 2}, 100, 1.5); got != 103 {
+		t.Errorf("空单ATR移动止损 = %.4f, want 103", got)
+	}
+	if got := computeContinuousTrailingSL("LONG", &PositionTarget{TrailingATRMult: 2}, 100, 0); got != 0 {
+		t.Errorf("缺少ATR时不应计算移动止损, got %.4f", got)
+	}
+}
+
+// TestRunCycleSkipsWhileBusy 测试上一周期（AI响应阻塞）未结束时新的扫描被跳过，同一时刻只执行一个周期
+func TestRunCycleSkipsWhileBusy(t *testing.T) {
+	t.Chdir(t.TempDir())
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{Symbol: "BTCUSDT", CurrentPrice: 100000}})
+	defer market.ResetMarketDataProvider()
+
+	var inFlight, maxInFlight int32
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			cur := atomic.LoadInt32(&maxInFlight)
+			if n <= cur || atomic.CompareAndSwapInt32(&maxInFlight, cur, n) {
+				break
+			}
+		}
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": `[{"symbol":"BTCUSDT","action":"hold","reasoning":"阻塞"}]`}}},
+		})
+	}))
+	defer server.Close()
+
+	at, err := NewAutoTrader(AutoTraderConfig{
+		ID:              "test-cycle-guard",
+		TraderMode:      "paper",
+		Exchange:        "binance",
+		InitialBalance:  10000.0,
+		AIModel:         "custom",
+		CustomAPIURL:    server.URL,
+		CustomAPIKey:    "key",
+		CustomModelName: "model",
+	}, nil)
+	if err != nil {
+		t.Fatalf("创建 AutoTrader 失败: %v", err)
+	}
+	at.mcpClient.SetUseStream(false)
+	at.overrideBasePrompt = true
+
+	cycle := func() error {
+		_, _, err := at.requestAIDecision(&decision.Context{
+			Account:        decision.AccountInfo{TotalEquity: 10000, AvailableBalance: 10000},
+			CandidateCoins: []decision.CandidateCoin{{Symbol: "BTCUSDT"}},
+		}, "system")
+		return err
+	}
+
+	done := make(chan bool)
+	go func() { done <- at.runExclusiveCycle(cycle) }()
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		close(release)
+		t.Fatal("首个周期未发起AI请求")
+	}
+
+	for i := 0; i < 3; i++ {
+		if at.runExclusiveCycle(cycle) {
+			t.Errorf("上一周期未结束时第 %d 次扫描不应执行", i+1)
+		}
+	}
+	if got := at.GetStatus()["skipped_cycles"]; got != int64(3) {
+		t.Errorf("skipped_cycles = %v, want 3", got)
+	}
+
+	close(release)
+	if !<-done {
+		t.Error("首个周期应正常执行")
+	}
+	if n := atomic.LoadInt32(&maxInFlight); n != 1 {
+		t.Errorf("同一时刻应只有 1 个周期请求AI，实际最多 %d 个", n)
+	}
+
+	// 上一周期结束后恢复正常执行
+	if !at.runExclusiveCycle(func() error { return nil }) {
+		t.Error("上一周期结束后新的扫描应执行")
+	}
+
+	// cycleMu 被用户数据流事件占用时等待其处理完再执行，不计为跳过
+	at.cycleMu.Lock()
+	eventDone := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		at.cycleMu.Unlock()
+		close(eventDone)
+	}()
+	if !at.runExclusiveCycle(func() error { return nil }) {
+		t.Error("事件处理占用 cycleMu 时决策周期应等待而非跳过")
+	}
+	<-eventDone
+	if got := at.GetStatus()["skipped_cycles"]; got != int64(3) {
+		t.Errorf("等待事件处理不应计入 skipped_cycles, got %v", got)
+	}
+}
+
+// TestTrailAfterTP3 测试启用TP3后移动止损时：到达TP2撤销止盈单，到达TP3剩余仓位不平仓而改为移动止损，且止损只向有利方向移动
+func TestTrailAfterTP3(t *testing.T) {
+	provider := &MockMarketDataProvider{data: &market.Data{Symbol: "BTCUSDT", CurrentPrice: 61500}}
+	market.SetMarketDataProvider(provider)
+	defer market.ResetMarketDataProvider()
+
+	mockTrader := NewMockTrader()
+	setMark := func(price float64) {
+		provider.data = &market.Data{Symbol: "BTCUSDT", CurrentPrice: price}
+		mockTrader.SetPositions([]map[string]interface{}{
+			{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.03, "entryPrice": 60000.0, "markPrice": price},
+		})
+	}
+	tpOrderID := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "SELL", Type: "TAKE_PROFIT_MARKET", StopPrice: 63000, Quantity: 0.03})
+
+	at := &AutoTrader{
+		id:                    "test-tp3-trail",
+		name:                  "test-tp3-trail",
+		trader:                mockTrader,
+		config:                AutoTraderConfig{TP3TrailPct: 1},
+		positionFirstSeenTime: make(map[string]int64),
+		positionTargets: map[string]*PositionTarget{
+			"BTCUSDT_long": {TP1: 61000, TP2: 62000, TP3: 63000, Stage: 1, CurrentSL: 60000, CurrentTP: 63000},
+		},
+	}
+	tgt := at.positionTargets["BTCUSDT_long"]
+	check := func(price float64) {
+		t.Helper()
+		setMark(price)
+		if err := at.autoCheckAndUpdateStopLoss(); err != nil {
+			t.Fatalf("autoCheckAndUpdateStopLoss() error = %v", err)
+		}
+	}
+	hasTPOrder := func() bool {
+		orders, _ := mockTrader.GetOpenOrders("BTCUSDT")
+		for _, order := range orders {
+			if order["orderId"] == tpOrderID {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 到达TP2：分批平仓并撤销止盈单，尚未启用移动止损
+	check(62100)
+	if tgt.Stage != 2 || hasTPOrder() || tgt.CurrentTP != 0 {
+		t.Fatalf("到达TP2应撤销止盈单: stage=%d tp_order=%v current_tp=%.2f", tgt.Stage, hasTPOrder(), tgt.CurrentTP)
+	}
+	if tgt.TrailingAfterTP3 || tgt.TrailingPct != 0 {
+		t.Errorf("未到TP3不应启用移动止损: %+v", tgt)
+	}
+
+	// 到达TP3：不平仓，改为 1% 移动止损（63200×0.99 比阶段止损 61500 更紧）
+	closesBefore := len(mockTrader.CloseCalls())
+	check(63200)
+	if !tgt.TrailingAfterTP3 || tgt.TrailingPct != 1 || tgt.Stage != 3 {
+		t.Fatalf("到达TP3应切换为移动止损: %+v", tgt)
+	}
+	if math.Abs(tgt.CurrentSL-62568) > 1e-6 {
+		t.Errorf("TP3后止损 = %.4f, want 62568", tgt.CurrentSL)
+	}
+	if closes := mockTrader.CloseCalls(); len(closes) != closesBefore {
+		t.Errorf("到达TP3不应平仓, got %v", closes)
+	}
+
+	// 继续上涨：止损跟随上移；回落：止损不放宽
+	check(64000)
+	if math.Abs(tgt.CurrentSL-63360) > 1e-6 {
+		t.Errorf("上涨后止损 = %.4f, want 63360", tgt.CurrentSL)
+	}
+	check(63500)
+	if math.Abs(tgt.CurrentSL-63360) > 1e-6 {
+		t.Errorf("回落不应放宽止损, got %.4f", tgt.CurrentSL)
+	}
+
+	// 未启用时到达TP3照常等待止盈单平仓
+	plain := &PositionTarget{TP1: 61000, TP2: 62000, TP3: 63000, Stage: 2, CurrentSL: 60500, CurrentTP: 63000}
+	at.config = AutoTraderConfig{}
+	at.positionTargets["BTCUSDT_long"] = plain
+	check(63200)
+	if plain.TrailingAfterTP3 || plain.CurrentTP != 63000 || plain.Stage != 3 {
+		t.Errorf("未启用时TP3应保留止盈单: %+v", plain)
+	}
+}
+
+// TestLinkedProtectiveOrders 测试止损/止盈联动：记录最新的一对条件单并撤销旧单，一腿成交后立即撤销另一腿
+func TestLinkedProtectiveOrders(t *testing.T) {
+	mockTrader := NewMockTrader()
+	mockTrader.SetOrderStatuses(nil) // 查询订单状态时不推进状态
+	staleSL := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "SELL", Type: "STOP_MARKET", StopPrice: 59000})
+	slID := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "SELL", Type: "STOP_MARKET", StopPrice: 60000})
+	tp := &MockOrder{Symbol: "BTCUSDT", Side: "SELL", Type: "TAKE_PROFIT_MARKET", StopPrice: 63000}
+	tpID := mockTrader.AddOrder(tp)
+	shortSL := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "BUY", Type: "STOP_MARKET", StopPrice: 65000})
+
+	at := &AutoTrader{name: "test-oco", trader: mockTrader}
+	openIDs := func(symbol string) map[int64]bool {
+		orders, _ := mockTrader.GetOpenOrders(symbol)
+		ids := make(map[int64]bool)
+		for _, order := range orders {
+			ids[order["orderId"].(int64)] = true
+		}
+		return ids
+	}
+
+	at.trackProtectiveOrders("BTCUSDT", "long")
+	ids := at.protectiveOrders["BTCUSDT_long"]
+	if ids == nil || ids.StopLossID != slID || ids.TakeProfitID != tpID {
+		t.Fatalf("应记录最新的止损/止盈单, got %+v", ids)
+	}
+	if open := openIDs("BTCUSDT"); open[staleSL] || !open[shortSL] {
+		t.Errorf("应只撤销同方向被替换的旧止损: %v", open)
+	}
+
+	// 轮询：止盈单已成交 → 撤销止损单
+	tp.Status = "FILLED"
+	at.checkLinkedProtectiveOrders()
+	if openIDs("BTCUSDT")[slID] {
+		t.Error("止盈成交后应立即撤销联动止损单")
+	}
+	if _, ok := at.protectiveOrders["BTCUSDT_long"]; ok {
+		t.Error("联动完成后应清除跟踪记录")
+	}
+
+	// 推送：止损成交 → 撤销止盈单
+	slID = mockTrader.AddOrder(&MockOrder{Symbol: "ETHUSDT", Side: "BUY", Type: "STOP_MARKET", StopPrice: 3200})
+	tpID = mockTrader.AddOrder(&MockOrder{Symbol: "ETHUSDT", Side: "BUY", Type: "TAKE_PROFIT_MARKET", StopPrice: 2800})
+	at.trackProtectiveOrders("ETHUSDT", "short")
+	at.handleUserDataEvent(UserDataEvent{Type: UserDataOrderUpdate, Symbol: "ETHUSDT", OrderID: slID, OrderType: "STOP_MARKET", Status: "FILLED"})
+	if openIDs("ETHUSDT")[tpID] {
+		t.Error("止损成交推送后应立即撤销联动止盈单")
+	}
+
+	// 被撤销的腿只清除记录，不撤销另一腿
+	slID = mockTrader.AddOrder(&MockOrder{Symbol: "SOLUSDT", Side: "SELL", Type: "STOP_MARKET", StopPrice: 90})
+	tpID = mockTrader.AddOrder(&MockOrder{Symbol: "SOLUSDT", Side: "SELL", Type: "TAKE_PROFIT_MARKET", StopPrice: 120})
+	at.trackProtectiveOrders("SOLUSDT", "long")
+	mockTrader.CancelOrder("SOLUSDT", tpID)
+	at.checkLinkedProtectiveOrders()
+	if ids := at.protectiveOrders["SOLUSDT_long"]; ids == nil || ids.StopLossID != slID || ids.TakeProfitID != 0 {
+		t.Errorf("止盈被撤销后应保留止损跟踪, got %+v", ids)
+	}
+}
+
+// tpOrderTrader 止盈下单会在挂单中生成 TAKE_PROFIT_MARKET 单；rejectTP 为 true 时拒绝下一笔止盈
+type tpOrderTrader struct {
+	*MockTrader
+	rejectTP bool
+}
+
+func (t *tpOrderTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64, reduceOnly bool) error {
+	if t.rejectTP {
+		t.rejectTP = false
+		return errors.New("Order would immediately trigger")
+	}
+	closeSide := "SELL"
+	if positionSide == "SHORT" {
+		closeSide = "BUY"
+	}
+	t.AddOrder(&MockOrder{Symbol: symbol, Side: closeSide, Type: "TAKE_PROFIT_MARKET", StopPrice: takeProfitPrice, Quantity: quantity})
+	return t.MockTrader.SetTakeProfit(symbol, positionSide, quantity, takeProfitPrice, reduceOnly)
+}
+
+// TestUpdateTakeProfitReplacesExisting 测试 update_take_profit 撤销旧止盈后下新单并记录订单ID，持仓不存在时返回 NoPositionError
+func TestUpdateTakeProfitReplacesExisting(t *testing.T) {
+	market.SetSymbolFiltersProvider(NewMockSymbolFiltersProvider())
+	defer market.ResetSymbolFiltersProvider()
+
+	setup := func() (*AutoTrader, *tpOrderTrader, int64) {
+		tt := &tpOrderTrader{MockTrader: NewMockTrader()}
+		tt.SetOrderStatuses(nil)
+		tt.SetPositions([]map[string]interface{}{
+			{"symbol": "BTCUSDT", "side": "long", "entryPrice": 60000.0, "positionAmt": 0.1},
+		})
+		oldTP := tt.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "SELL", Type: "TAKE_PROFIT_MARKET", StopPrice: 63000, Quantity: 0.1})
+		return &AutoTrader{name: "test-tp", trader: tt, positionTargets: make(map[string]*PositionTarget)}, tt, oldTP
+	}
+	openTPs := func(tt *tpOrderTrader) []map[string]interface{} {
+		orders, _ := tt.GetOpenOrders("BTCUSDT")
+		var tps []map[string]interface{}
+		for _, order := range orders {
+			if order["type"] == "TAKE_PROFIT_MARKET" {
+				tps = append(tps, order)
+			}
+		}
+		return tps
+	}
+
+	t.Run("替换已有止盈", func(t *testing.T) {
+		at, tt, oldTP := setup()
+		record := &logger.DecisionAction{}
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "update_take_profit", NewTakeProfit: 64000}
+		if err := at.executeUpdateTakeProfitWithRecord(dec, record); err != nil {
+			t.Fatalf("executeUpdateTakeProfitWithRecord() error = %v", err)
+		}
+
+		tps := openTPs(tt)
+		if len(tps) != 1 || tps[0]["stopPrice"] != 64000.0 {
+			t.Fatalf("应只保留新止盈单, got %+v", tps)
+		}
+		newID := tps[0]["orderId"].(int64)
+		if newID == oldTP {
+			t.Fatal("旧止盈单应被撤销")
+		}
+		if record.OrderID != newID || record.Price != 64000 || record.Quantity != 0.1 {
+			t.Errorf("执行记录应包含新止盈单, got %+v", record)
+		}
+		if ids := at.protectiveOrders["BTCUSDT_long"]; ids == nil || ids.TakeProfitID != newID {
+			t.Errorf("应跟踪新止盈单ID %d, got %+v", newID, ids)
+		}
+	})
+
+	t.Run("新止盈被拒绝时恢复原止盈", func(t *testing.T) {
+		at, tt, _ := setup()
+		tt.rejectTP = true
+		dec := &decision.Decision{Symbol: "BTCUSDT", Action: "update_take_profit", NewTakeProfit: 64000}
+		if err := at.executeUpdateTakeProfitWithRecord(dec, &logger.DecisionAction{}); err == nil {
+			t.Fatal("新止盈下单失败时应返回错误")
+		}
+		if tps := openTPs(tt); len(tps) != 1 || tps[0]["stopPrice"] != 63000.0 {
+			t.Errorf("应恢复原止盈 63000, got %+v", tps)
+		}
+	})
+
+	t.Run("持仓不存在", func(t *testing.T) {
+		at, tt, oldTP := setup()
+		dec := &decision.Decision{Symbol: "ETHUSDT", Action: "update_take_profit", NewTakeProfit: 3500}
+		err := at.executeUpdateTakeProfitWithRecord(dec, &logger.DecisionAction{})
+		var noPos *NoPositionError
+		if !errors.As(err, &noPos) || noPos.Symbol != "ETHUSDT" || noPos.Action != "update_take_profit" {
+			t.Fatalf("应返回 NoPositionError, got %v", err)
+		}
+		if tt.ProtectiveOrderCalls() != 0 {
+			t.Error("持仓不存在时不应下止盈单")
+		}
+		if tps := openTPs(tt); len(tps) != 1 || tps[0]["orderId"] != oldTP {
+			t.Errorf("持仓不存在时不应撤销其他挂单, got %+v", tps)
+		}
+	})
+}
+
+// TestProtectiveOrdersReduceOnly 测试分批止盈后重新设置的止损单为只减仓
+func TestProtectiveOrdersReduceOnly(t *testing.T) {
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{Symbol: "BTCUSDT", CurrentPrice: 61200}})
+	defer market.ResetMarketDataProvider()
+
+	mockTrader := NewMockTrader()
+	mockTrader.SetPositions([]map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.04, "entryPrice": 60000.0, "markPrice": 61200.0},
+	})
+	at := &AutoTrader{
+		name:                  "test-reduce-only",
+		trader:                mockTrader,
+		positionFirstSeenTime: make(map[string]int64),
+		positionTargets: map[string]*PositionTarget{
+			"BTCUSDT_long": {TP1: 61000, TP2: 62000, TP3: 63000, CurrentSL: 59000, CurrentTP: 63000},
+		},
+	}
+
+	if err := at.autoCheckAndUpdateStopLoss(); err != nil {
+		t.Fatalf("autoCheckAndUpdateStopLoss() error = %v", err)
+	}
+	if closes := mockTrader.CloseCalls(); len(closes) != 1 {
+		t.Fatalf("到达TP1应分批平仓一次, got %v", closes)
+	}
+	orders := mockTrader.ProtectiveOrders()
+	if len(orders) != 1 || orders[0].Kind != "stop_loss" || orders[0].Price != 60000 {
+		t.Fatalf("分批平仓后应重新设置保本止损, got %+v", orders)
+	}
+	if !orders[0].ReduceOnly {
+		t.Error("分批平仓后设置的止损单必须为只减仓")
+	}
+}
+
+// TestValidateConcurrentPositionCap 测试并发仓位上限：平仓释放位置、补仓不占位置，超出的开仓给出拒绝原因
+func TestValidateConcurrentPositionCap(t *testing.T) {
+	positions := []decision.PositionInfo{
+		{Symbol: "BTCUSDT", Side: "long"},
+		{Symbol: "ETHUSDT", Side: "short"},
+	}
+	decisions := sortDecisionsByPriority([]decision.Decision{
+		{Symbol: "SOLUSDT", Action: "open_long", Confidence: 70},
+		{Symbol: "BTCUSDT", Action: "open_long", IsAddOn: true, Confidence: 50},
+		{Symbol: "ETHUSDT", Action: "close_short"},
+		{Symbol: "BNBUSDT", Action: "limit_open_short", Confidence: 90},
+		{Symbol: "BTCUSDT", Action: "update_stop_loss"},
+	})
+
+	// 上限3：ETH 平仓后占用1个，剩余2个位置给 BNB(90) 和 SOL(70)，BTC 补仓不占位置
+	kept, reasons := validateConcurrentPositionCap(decisions, positions, 3)
+	if len(kept) != len(decisions) || len(reasons) != 0 {
+		t.Errorf("平仓释放位置后全部决策应保留, kept=%d reasons=%v", len(kept), reasons)
+	}
+
+	// 上限2：只剩1个新位置，保留信心度更高的 BNB
+	kept, reasons = validateConcurrentPositionCap(decisions, positions, 2)
+	var keptKeys []string
+	for _, d := range kept {
+		keptKeys = append(keptKeys, d.Symbol+":"+d.Action)
+	}
+	for _, want := range []string{"ETHUSDT:close_short", "BTCUSDT:update_stop_loss", "BTCUSDT:open_long", "BNBUSDT:limit_open_short"} {
+		if !strings.Contains(strings.Join(keptKeys, ","), want) {
+			t.Errorf("应保留 %s, got %v", want, keptKeys)
+		}
+	}
+	if len(kept) != 4 || len(reasons) != 1 || !strings.Contains(reasons[0], "SOLUSDT open_long skipped: position cap reached (1/2)") {
+		t.Errorf("应只跳过 SOL 开仓并给出原因, kept=%v reasons=%v", keptKeys, reasons)
+	}
+
+	// 未配置上限不过滤
+	if kept, reasons := validateConcurrentPositionCap(decisions, positions, 0); len(kept) != len(decisions) || reasons != nil {
+		t.Error("未配置上限时不应过滤")
+	}
+
+	// 非补仓的同向开仓仍占新位置
+	full := []decision.PositionInfo{{Symbol: "BTCUSDT", Side: "long"}, {Symbol: "ETHUSDT", Side: "long"}}
+	kept, reasons = validateConcurrentPositionCap([]decision.Decision{{Symbol: "BTCUSDT", Action: "open_long"}}, full, 2)
+	if len(kept) != 0 || len(reasons) != 1 {
+		t.Errorf("位置已满时非补仓开仓应被跳过, kept=%d reasons=%v", len(kept), reasons)
+	}
+}
+
+// TestEMACrossExit 测试1h收盘价逆向收穿EMA时平掉多单，同向穿越不平仓
+func TestEMACrossExit(t *testing.T) {
+	newTrader := func(closes []float64) (*AutoTrader, *MockTrader) {
+		market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{
+			Symbol:       "BTCUSDT",
+			CurrentPrice: closes[len(closes)-1],
+			MidTermSeries1h: &market.MidTermData1h{
+				MidPrices:   closes,
+				EMA50Values: []float64{100, 100, 100, 100}, // 最后一根为未收盘K线
+			},
+		}})
+		mockTrader := NewMockTrader()
+		mockTrader.SetPositions([]map[string]interface{}{
+			{"symbol": "BTCUSDT", "side": "long", "entryPrice": 98.0, "markPrice": closes[len(closes)-1], "positionAmt": 1.0},
+		})
+		return &AutoTrader{
+			name:   "test-ema-cross",
+			trader: mockTrader,
+			config: AutoTraderConfig{
+				EMACrossExitTimeframe: "1h",
+				EMACrossExitPeriod:    50,
+			},
+			positionTargets:       map[string]*PositionTarget{"BTCUSDT_long": {CurrentSL: 95}},
+			positionFirstSeenTime: map[string]int64{},
+			positionMemory:        map[string]decision.PositionInfo{},
+		}, mockTrader
+	}
+	defer market.ResetMarketDataProvider()
+
+	// 看跌穿越：上一根收于EMA上方，最近收盘跌破EMA → 平多
+	at, mockTrader := newTrader([]float64{102, 101, 99, 99.5})
+	events := at.enforceEMACrossExit()
+	if got := fmt.Sprint(mockTrader.CloseCalls()); got != "[BTCUSDT_long]" {
+		t.Fatalf("看跌EMA穿越应平掉多单, got %s", got)
+	}
+	if len(events) != 1 || events[0].Action != "close_long" || !events[0].Success ||
+		!strings.HasPrefix(events[0].Reason, "ema_cross_exit: 1h") {
+		t.Errorf("EMA反穿离场记录不正确: %+v", events)
+	}
+	if _, ok := at.positionTargets["BTCUSDT_long"]; ok {
+		t.Error("平仓后应清理持仓跟踪")
+	}
+
+	// 看涨穿越：与多单同向，不平仓
+	at, mockTrader = newTrader([]float64{98, 99, 101, 100.5})
+	if events := at.enforceEMACrossExit(); len(events) != 0 || len(mockTrader.CloseCalls()) != 0 {
+		t.Errorf("看涨EMA穿越不应平掉多单, events=%+v closes=%v", events, mockTrader.CloseCalls())
+	}
+
+	// tighten_stop：看跌穿越时收紧止损而不平仓
+	at, mockTrader = newTrader([]float64{102, 101, 99, 99.5})
+	at.config.EMACrossExitAction = "tighten_stop"
+	events = at.enforceEMACrossExit()
+	if len(mockTrader.CloseCalls()) != 0 {
+		t.Errorf("tighten_stop 不应平仓, got %v", mockTrader.CloseCalls())
+	}
+	if len(events) != 1 || events[0].Action != "update_stop_loss" || at.positionTargets["BTCUSDT_long"].CurrentSL <= 95 {
+		t.Errorf("tighten_stop 应收紧止损, events=%+v", events)
+	}
+}
+
+// equityTestTrader 返回固定账户余额的 MockTrader（用于净值快照测试）
+type equityTestTrader struct {
+	*MockTrader
+	equity float64
+}
+
+func (t *equityTestTrader) GetBalance() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"totalWalletBalance":    t.equity,
+		"totalUnrealizedProfit": 0.0,
+		"availableBalance":      t.equity * 0.8,
+	}, nil
+}
+
+// TestEquitySnapshots 测试净值快照独立写入数据库并可按时间区间读取
+func TestEquitySnapshots(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db, err := config.NewDatabase("equity.db")
+	if err != nil {
+		t.Fatalf("创建测试数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	mockTrader := &equityTestTrader{MockTrader: NewMockTrader(), equity: 1000}
+	mockTrader.SetPositions([]map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.01, "markPrice": 50000.0, "unRealizedProfit": 0.0, "leverage": 10.0},
+	})
+	at := &AutoTrader{id: "test-equity", name: "test-equity", trader: mockTrader}
+
+	// 未设置存储时忽略
+	if err := at.recordEquitySnapshot(); err != nil {
+		t.Fatalf("未设置存储不应报错: %v", err)
+	}
+
+	at.SetEquitySnapshotStore(db)
+	before := time.Now()
+	if err := at.recordEquitySnapshot(); err != nil {
+		t.Fatalf("记录净值快照失败: %v", err)
+	}
+	mockTrader.equity = 1050
+	if err := at.recordEquitySnapshot(); err != nil {
+		t.Fatalf("记录净值快照失败: %v", err)
+	}
+
+	snapshots, err := db.ListEquitySnapshots("test-equity", time.Time{}, time.Time{})
+	if err != nil || len(snapshots) != 2 {
+		t.Fatalf("期望2条净值快照, got %d err=%v", len(snapshots), err)
+	}
+	first := snapshots[0]
+	if first.TotalEquity != 1000 || first.AvailableBalance != 800 || first.MarginUsed != 50 || first.PositionCount != 1 {
+		t.Errorf("净值快照内容不正确: %+v", *first)
+	}
+	if snapshots[1].TotalEquity != 1050 {
+		t.Errorf("快照应按时间升序, got %+v", *snapshots[1])
+	}
+
+	if got, _ := db.ListEquitySnapshots("test-equity", time.Now().Add(time.Hour), time.Time{}); len(got) != 0 {
+		t.Errorf("from 之后无快照, got %d", len(got))
+	}
+	if got, _ := db.ListEquitySnapshots("test-equity", before.Add(-time.Second), time.Now().Add(time.Second)); len(got) != 2 {
+		t.Errorf("区间内应有2条快照, got %d", len(got))
+	}
+	if got, _ := db.ListEquitySnapshots("other-trader", time.Time{}, time.Time{}); len(got) != 0 {
+		t.Errorf("不应读取其他交易员的快照, got %d", len(got))
+	}
+}
+
+// TestHedgeModeOpposingPositions 测试双向持仓模式下同币种多空共存及孤儿委托单清理
+func TestHedgeModeOpposingPositions(t *testing.T) {
+	mockTrader := NewMockTrader()
+	mockTrader.SetOrderStatuses(nil)
+	mockTrader.SetPositions([]map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.01, "entryPrice": 60000.0},
+	})
+	openShort := &decision.Decision{Symbol: "BTCUSDT", Action: "open_short", Reasoning: "grade=B score=70"}
+
+	// 单向持仓：保留反向开仓拦截，不切换持仓模式
+	at := &AutoTrader{name: "test-hedge", trader: mockTrader}
+	if allowed, _ := at.validateHedgeAntiHedge(openShort); allowed {
+		t.Error("单向持仓模式下已有多仓时反向开空应被拦截")
+	}
+	at.applyPositionMode()
+	if _, called := mockTrader.PositionMode(); called {
+		t.Error("未启用双向持仓时不应切换持仓模式")
+	}
+
+	// 双向持仓：允许反向开仓，启动时切换为双向持仓
+	at.config.IsHedgeMode = true
+	if allowed, reason := at.validateHedgeAntiHedge(openShort); !allowed {
+		t.Errorf("双向持仓模式下应允许同币种反向开仓: %s", reason)
+	}
+	at.applyPositionMode()
+	if dualSide, called := mockTrader.PositionMode(); !called || !dualSide {
+		t.Error("启用双向持仓时应切换交易所为双向持仓模式")
+	}
+
+	// 多空两个仓位的止损/止盈单分别跟踪，key 互不覆盖
+	longSL := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "SELL", PositionSide: "LONG", Type: "STOP_MARKET", StopPrice: 58000})
+	longTP := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "SELL", PositionSide: "LONG", Type: "TAKE_PROFIT_MARKET", StopPrice: 64000})
+	shortSL := mockTrader.AddOrder(&MockOrder{Symbol: "BTCUSDT", Side: "BUY", PositionSide: "SHORT", Type: "STOP_MARKET", StopPrice: 62000})
+	at.trackProtectiveOrders("BTCUSDT", "long")
+	at.trackProtectiveOrders("BTCUSDT", "short")
+	if ids := at.protectiveOrders["BTCUSDT_long"]; ids == nil || ids.StopLossID != longSL || ids.TakeProfitID != longTP {
+		t.Fatalf("多仓止损/止盈记录错误: %+v", ids)
+	}
+	if ids := at.protectiveOrders["BTCUSDT_short"]; ids == nil || ids.StopLossID != shortSL {
+		t.Fatalf("空仓止损记录错误: %+v", ids)
+	}
+
+	// 多仓消失但空仓仍在：只撤销多仓的条件单
+	at.cancelOrphanOrders("BTCUSDT_long", map[string]bool{"BTCUSDT_short": true})
+	open := make(map[int64]bool)
+	orders, _ := mockTrader.GetOpenOrders("BTCUSDT")
+	for _, order := range orders {
+		open[order["orderId"].(int64)] = true
+	}
+	if open[longSL] || open[longTP] || !open[shortSL] {
+		t.Errorf("应只撤销消失仓位的条件单并保留反方向止损: %v", open)
+	}
+	if calls := mockTrader.CancelAllCalls(); len(calls) != 0 {
+		t.Errorf("反方向仍有持仓时不应撤销全部委托, got %v", calls)
+	}
+
+	// 反方向只有限价单挂单时同样不能整币种撤单
+	at.pendingOrders = map[string]*PendingOrder{"ETHUSDT_long": {Symbol: "ETHUSDT", Side: "long"}}
+	at.cancelOrphanOrders("ETHUSDT_short", map[string]bool{})
+	if calls := mockTrader.CancelAllCalls(); len(calls) != 0 {
+		t.Errorf("反方向有限价单时不应撤销全部委托, got %v", calls)
+	}
+
+	// 反方向无持仓/挂单，或单向持仓模式：整币种撤单
+	at.cancelOrphanOrders("SOLUSDT_long", map[string]bool{})
+	at.config.IsHedgeMode = false
+	at.cancelOrphanOrders("BTCUSDT_short", map[string]bool{"BTCUSDT_long": true})
+	if got := fmt.Sprint(mockTrader.CancelAllCalls()); got != "[SOLUSDT BTCUSDT]" {
+		t.Errorf("CancelAllOrders 调用 = %s, want [SOLUSDT BTCUSDT]", got)
+	}
+}
+
+// TestGetTradeHistoryMergesSymbols 测试未指定币种时合并交易币种的成交记录并按时间排序
+func TestGetTradeHistoryMergesSymbols(t *testing.T) {
+	mockTrader := NewMockTrader()
+	mockTrader.SetTradeFills([]TradeFill{
+		{Time: 3000, Symbol: "BTCUSDT", Side: "SELL", Price: 61000, Quantity: 0.01, RealizedPnL: 10},
+		{Time: 1000, Symbol: "BTCUSDT", Side: "BUY", Price: 60000, Quantity: 0.01, Fee: 0.24},
+		{Time: 2000, Symbol: "ETHUSDT", Side: "SELL", Price: 3000, Quantity: 0.1},
+		{Time: 500, Symbol: "ETHUSDT", Side: "BUY", Price: 2900, Quantity: 0.1},
+		{Time: 2500, Symbol: "SOLUSDT", Side: "BUY", Price: 150, Quantity: 1},
+	})
+	at := &AutoTrader{trader: mockTrader, tradingCoins: []string{"btc", "ETHUSDT"}}
+
+	fills, err := at.GetTradeHistory("", 1000)
+	if err != nil {
+		t.Fatalf("获取成交记录失败: %v", err)
+	}
+	var got []int64
+	for _, fill := range fills {
+		got = append(got, fill.Time)
+	}
+	if fmt.Sprint(got) != "[1000 2000 3000]" {
+		t.Errorf("应合并交易币种 since 之后的成交并按时间升序, got %v", got)
+	}
+
+	fills, err = at.GetTradeHistory("sol", 0)
+	if err != nil || len(fills) != 1 || fills[0].Symbol != "SOLUSDT" {
+		t.Errorf("指定币种时只查询该币种, got %+v err=%v", fills, err)
+	}
+}
+
+// TestProtectivePricesAlignedToTick 测试止损/止盈改单价格按 TickSize 对齐（避免 -1111 精度拒单）
+func TestProtectivePricesAlignedToTick(t *testing.T) {
+	market.SetMarketDataProvider(&MockMarketDataProvider{data: &market.Data{Symbol: "BTCUSDT", CurrentPrice: 61100.0}})
+	defer market.ResetMarketDataProvider()
+	filters := NewMockSymbolFiltersProvider()
+	filters.SetFilters("BTCUSDT", 0.1, 0.001, 10.0)
+	market.SetSymbolFiltersProvider(filters)
+	defer market.ResetSymbolFiltersProvider()
+
+	mockTrader := NewMockTrader()
+	mockTrader.SetPositions([]map[string]interface{}{
+		{"symbol": "BTCUSDT", "side": "long", "positionAmt": 0.01, "entryPrice": 60000.03},
+	})
+	at := &AutoTrader{
+		name:             "test-tick",
+		trader:           mockTrader,
+		protectiveOrders: make(map[string]*ProtectiveOrderIDs),
+		positionTargets: map[string]*PositionTarget{
+			"BTCUSDT_long": {TP1: 60500, TP2: 61000.05, TP3: 62000, CurrentSL: 59000, CurrentTP: 62000},
+		},
+	}
+
+	// 到达TP2：公式止损为 (entry+TP1)/2 = 60250.015，需对齐为 60250.0
+	updateSL := &decision.Decision{Symbol: "BTCUSDT", Action: "update_stop_loss", Leverage: 5}
+	if err := at.executeUpdateStopLossWithRecord(updateSL, &logger.DecisionAction{}); err != nil {
+		t.Fatalf("update_stop_loss 失败: %v", err)
+	}
+	updateTP := &decision.Decision{Symbol: "BTCUSDT", Action: "update_take_profit", NewTakeProfit: 63333.337}
+	if err := at.executeUpdateTakeProfitWithRecord(updateTP, &logger.DecisionAction{}); err != nil {
+		t.Fatalf("update_take_profit 失败: %v", err)
+	}
+
+	orders := mockTrader.ProtectiveOrders()
+	if len(orders) != 2 {
+		t.Fatalf("期望2次改单，实际 %+v", orders)
+	}
+	for _, order := range orders {
+		if got := market.RoundToTickSize(order.Price, 0.1); got != order.Price {
+			t.Errorf("%s 价格 %v 未对齐到 TickSize 0.1", order.Kind, order.Price)
+		}
+	}
+	if orders[0].Price != 60250.0 || orders[1].Price != 63333.3 {
+		t.Errorf("期望止损 60250 / 止盈 63333.3，实际 %v / %v", orders[0].Price, orders[1].Price)
+	}
+	if tgt := at.positionTargets["BTCUSDT_long"]; tgt.CurrentSL != 60250.0 || tgt.CurrentTP != 63333.3 {
+		t.Errorf("内存止损/止盈应记录对齐后的价格，实际 %v / %v", tgt.CurrentSL, tgt.CurrentTP)
+	}
+
+	// 开仓路径：alignOrderToFilters 对齐止损/止盈及三段止盈
+	open := &decision.Decision{Symbol: "BTCUSDT", StopLoss: 0.1 * 3 * 200000, TakeProfit: 63333.337, TP1: 61111.111, TP2: 62222.229, TP3: 63333.337}
+	if _, err := alignOrderToFilters(open, 0.01, 61100, &market.SymbolFilters{TickSize: 0.1, StepSize: 0.001}); err != nil {
+		t.Fatalf("alignOrderToFilters 失败: %v", err)
+	}
+	for _, p := range []float64{open.StopLoss, open.TakeProfit, open.TP1, open.TP2, open.TP3} {
+		if market.RoundToTickSize(p, 0.1) != p {
+			t.Errorf("开仓价格 %v 未对齐到 TickSize", p)
+		}
+	}
+}
+
+// TestConcurrentPositionCapByTier 测试执行时按账户分层的 MaxConcurrentPositions 拦截开仓（持仓+待成交限价单）
+func TestConcurrentPositionCapByTier(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RiskManagement.AggressiveMode.MaxConcurrentPositions = 1
+	cfg.RiskManagement.StandardMode.MaxConcurrentPositions = 2
+	cfg.RiskManagement.ConservativeMode.MaxConcurrentPositions = 4
+
+	tiers := []struct {
+		name     string
+		equity   float64
+		maxSlots int
+	}{
+		{"激进模式", 150, 1},
+		{"标准模式", 800, 2},
+		{"保守模式", 5000, 4},
+	}
+	for _, tier := range tiers {
+		t.Run(tier.name, func(t *testing.T) {
+			mockTrader := NewMockTrader()
+			var positions []map[string]interface{}
+			for i := 0; i < tier.maxSlots-1; i++ {
+				positions = append(positions, map[string]interface{}{"symbol": fmt.Sprintf("COIN%dUSDT", i), "side": "long", "positionAmt": 1.0})
+			}
+			mockTrader.SetPositions(positions)
+			at := &AutoTrader{
+				name:              "test-cap",
+				trader:            mockTrader,
+				globalConfig:      cfg,
+				lastAccountEquity: tier.equity,
+				pendingOrders:     make(map[string]*PendingOrder),
+			}
+
+			// 还剩1个空位：允许开仓
+			if err := at.checkConcurrentPositionCap(positions); err != nil {
+				t.Fatalf("占用 %d/%d 时应允许开仓: %v", len(positions), tier.maxSlots, err)
+			}
+
+			// 待成交限价单占满最后一个空位：市价与限价开仓都被拒绝
+			at.pendingOrders["ETHUSDT_short"] = &PendingOrder{Symbol: "ETHUSDT", Side: "short"}
+			err := at.checkConcurrentPositionCap(positions)
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("并发仓位已达上限（%d/%d", tier.maxSlots, tier.maxSlots)) {
+				t.Errorf("占满后应拒绝开仓, got %v", err)
+			}
+			limitOpen := &decision.Decision{Symbol: "BTCUSDT", Action: "limit_open_long", Leverage: 5, PositionSizeUSD: 50}
+			if err := at.executeLimitOpenLongWithRecord(limitOpen, &logger.DecisionAction{}); err == nil || !strings.Contains(err.Error(), "并发仓位已达上限") {
+				t.Errorf("限价开多应被并发上限拦截, got %v", err)
+			}
+			if err := at.executeLimitOpenShortWithRecord(limitOpen, &logger.DecisionAction{}); err == nil || !strings.Contains(err.Error(), "并发仓位已达上限") {
+				t.Errorf("限价开空应被并发上限拦截, got %v", err)
+			}
+		})
+	}
+}
+
+func simulationConfig(aiResponse string) SimulationConfig {
+	globalCfg := &config.Config{}
+	globalCfg.RiskManagement.ConservativeMode.MaxLeverage = 100
+	return SimulationConfig{
+		Trader: AutoTraderConfig{
+			ID:                       "simulate-cycle",
+			Name:                     "Simulate Cycle",
+			InitialBalance:           10000,
+			BTCETHLeverage:           100,
+			AltcoinLeverage:          75,
+			TradingCoins:             []string{"BTCUSDT"},
+			LimitOrderWaitSeconds:    5,
+			LimitOrderMaxRetries:     3,
+			LimitOrderPollIntervalMs: 100,
+		},
+		Global:     globalCfg,
+		AIResponse: aiResponse,
+		Filters:    map[string]*market.SymbolFilters{"BTCUSDT": {TickSize: 0.1, StepSize: 0.001, MinNotional: 10}},
+	}
+}
+
+func simulationMarketDataFor(symbol string, price float64) map[string]*market.Data {
+	return map[string]*market.Data{symbol: {
+		Symbol:       symbol,
+		CurrentPrice: price,
+		Microstructure: &market.MicrostructureSummary{
+			BestBidPrice: price,
+			BestAskPrice: price + 5,
+			SpreadBps:    1.0,
+			MinNotional:  5000.0, // < 10000，走限价生命周期管理
+			DepthRatio:   1.0,
+		},
+		RiskMetrics: &market.RiskMetrics{VolatilityLevel: "medium"}, // 开仓前的高波动熔断需要风险指标
+	}}
+}
+
+func TestSimulateCycleExecutesCannedDecision(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	aiResponse := `BTC 回踩支撑，挂限价多单。
+[{"symbol":"BTCUSDT","action":"limit_open_long","leverage":50,"position_size_usd":1000,"limit_price":50000,"stop_loss":49500,"take_profit":51800,"tp1":50600,"tp2":51200,"tp3":51800,"reasoning":"grade=S score=90 回踩支撑"}]`
+	behavior := &DeterministicBehavior{Enabled: true, FillDelayMs: 10, FixedFillPrice: 50000}
+
+	record, err := SimulateCycle(simulationConfig(aiResponse), simulationMarketDataFor("BTCUSDT", 50000), behavior)
+	if err != nil {
+		t.Fatalf("SimulateCycle() error = %v", err)
+	}
+
+	if !record.Success || record.ErrorMessage != "" {
+		t.Fatalf("周期应成功, got success=%v err=%q", record.Success, record.ErrorMessage)
+	}
+	if record.AccountState.TotalBalance != 10000 {
+		t.Errorf("账户快照应为纸交易初始余额 10000, got %.2f", record.AccountState.TotalBalance)
+	}
+	if len(record.CandidateCoins) != 1 || record.CandidateCoins[0] != "BTCUSDT" {
+		t.Errorf("候选币种应为 [BTCUSDT], got %v", record.CandidateCoins)
+	}
+	if !strings.Contains(record.CoTTrace, "回踩支撑") || !strings.Contains(record.DecisionJSON, "limit_open_long") {
+		t.Errorf("记录应包含模拟AI的思维链和决策, cot=%q json=%q", record.CoTTrace, record.DecisionJSON)
+	}
+	if record.AIModel == "" || record.InputPrompt == "" {
+		t.Errorf("记录应包含模型标识和输入提示词, model=%q prompt长度=%d", record.AIModel, len(record.InputPrompt))
+	}
+
+	if len(record.Decisions) != 1 {
+		t.Fatalf("应执行 1 个动作, got %d: %+v", len(record.Decisions), record.Decisions)
+	}
+	action := record.Decisions[0]
+	if action.Action != "limit_open_long" || !action.Success || action.Status != "EXECUTED" {
+		t.Errorf("限价开多应在纸交易中成交, got %+v", action)
+	}
+	if action.Price != 50000 || action.Quantity <= 0 {
+		t.Errorf("成交价应为 50000 且数量 > 0, got price=%.2f qty=%.6f", action.Price, action.Quantity)
+	}
+}
+
+func TestSimulateCycleRecordsRejectedDecision(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	// 平仓缺少 reasoning：风控拦截，周期仍记录为 warning 并继续
+	aiResponse := `无持仓可平。
+[{"symbol":"BTCUSDT","action":"close_long","reasoning":""}]`
+
+	record, err := SimulateCycle(simulationConfig(aiResponse), simulationMarketDataFor("BTCUSDT", 50000), nil)
+	if err != nil {
+		t.Fatalf("风控拦截不应返回错误: %v", err)
+	}
+	if record.Status != "warning" || record.ErrorType != string(decision.DECISION_VALIDATION_REJECTED) {
+		t.Errorf("应记录为风控拦截, got status=%q type=%q", record.Status, record.ErrorType)
+	}
+	if !strings.Contains(record.ErrorMessage, "close_long 需要给出reasoning说明") {
+		t.Errorf("拦截原因应包含缺少reasoning, got %q", record.ErrorMessage)
+	}
+	if len(record.ValidationErrors) != 1 {
+		t.Errorf("应记录 1 条验证错误, got %+v", record.ValidationErrors)
+	}
+}
+
+// flakyOrderTrader 前 failures 次下单返回网络错误；landOnFail 时失败的请求实际已被交易所接受，
+// landOnAttempt > 0 时仅第 landOnAttempt 次失败的请求已被接受
+type flakyOrderTrader struct {
+	*MockTrader
+	failures      int
+	landOnFail    bool
+	landOnAttempt int
+	rejectErr  error
+	sent       []string
+	landed     map[string]map[string]interface{}
+}
+
+func (t *flakyOrderTrader) place(symbol, clientOrderID string) (map[string]interface{}, error) {
+	t.sent = append(t.sent, clientOrderID)
+	if t.rejectErr != nil {
+		return nil, t.rejectErr
+	}
+	order := map[string]interface{}{"orderId": int64(len(t.sent)), "symbol": symbol, "status": "NEW", "clientOrderId": clientOrderID}
+	if len(t.sent) <= t.failures {
+		if t.landOnFail || len(t.sent) == t.landOnAttempt {
+			t.landed[clientOrderID] = order
+		}
+		return nil, errors.New("read tcp: i/o timeout")
+	}
+	t.landed[clientOrderID] = order
+	return order, nil
+}
+
+func (t *flakyOrderTrader) OpenLongWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
+	return t.place(symbol, clientOrderID)
+}
+
+func (t *flakyOrderTrader) OpenShortWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
+	return t.place(symbol, clientOrderID)
+}
+
+func (t *flakyOrderTrader) LimitOpenLongWithClientID(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error) {
+	return t.place(symbol, clientOrderID)
+}
+
+func (t *flakyOrderTrader) LimitOpenShortWithClientID(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error) {
+	return t.place(symbol, clientOrderID)
+}
+
+func (t *flakyOrderTrader) GetOrderByClientID(symbol, clientOrderID string) (map[string]interface{}, error) {
+	return t.landed[clientOrderID], nil
+}
+
+func TestPlaceOrderWithRetry(t *testing.T) {
+	prevDelay := orderRetryBaseDelay
+	orderRetryBaseDelay = time.Millisecond
+	defer func() { orderRetryBaseDelay = prevDelay }()
+
+	newTrader := func(ft *flakyOrderTrader) *AutoTrader {
+		ft.MockTrader = NewMockTrader()
+		ft.landed = make(map[string]map[string]interface{})
+		return &AutoTrader{id: "retry-test", trader: ft}
+	}
+
+	t.Run("上一次请求已落地时不重发", func(t *testing.T) {
+		ft := &flakyOrderTrader{failures: 1, landOnFail: true}
+		at := newTrader(ft)
+		order, err := at.placeOpenLong("BTCUSDT", 0.01, 10)
+		if err != nil {
+			t.Fatalf("placeOpenLong() error = %v", err)
+		}
+		if len(ft.sent) != 1 {
+			t.Errorf("已落地的订单不应重发, 发送 %d 次", len(ft.sent))
+		}
+		if order["clientOrderId"] != ft.sent[0] {
+			t.Errorf("应返回已落地的订单, got %v", order)
+		}
+	})
+
+	t.Run("未落地时用同一clientOrderId重发", func(t *testing.T) {
+		ft := &flakyOrderTrader{failures: 2}
+		at := newTrader(ft)
+		if _, err := at.placeLimitOpenShort("ETHUSDT", 0.1, 10, 3000, 3100); err != nil {
+			t.Fatalf("placeLimitOpenShort() error = %v", err)
+		}
+		if len(ft.sent) != 3 {
+			t.Fatalf("应尝试 3 次, got %d", len(ft.sent))
+		}
+		if ft.sent[0] != ft.sent[1] || ft.sent[1] != ft.sent[2] {
+			t.Errorf("重试应复用同一 clientOrderId, got %v", ft.sent)
+		}
+		if !strings.HasPrefix(ft.sent[0], "retry-test-ETHUSDT-") {
+			t.Errorf("clientOrderId 应由交易员ID+币种+时间戳组成, got %q", ft.sent[0])
+		}
+	})
+
+	t.Run("重试耗尽返回错误", func(t *testing.T) {
+		ft := &flakyOrderTrader{failures: orderPlaceMaxAttempts}
+		at := newTrader(ft)
+		if _, err := at.placeOpenShort("BTCUSDT", 0.01, 10); err == nil || !strings.Contains(err.Error(), "下单重试") {
+			t.Errorf("重试耗尽应返回错误, got %v", err)
+		}
+		if len(ft.sent) != orderPlaceMaxAttempts {
+			t.Errorf("应尝试 %d 次, got %d", orderPlaceMaxAttempts, len(ft.sent))
+		}
+	})
+
+	t.Run("最后一次超时的请求已落地时按成功返回", func(t *testing.T) {
+		ft := &flakyOrderTrader{failures: orderPlaceMaxAttempts, landOnAttempt: orderPlaceMaxAttempts}
+		at := newTrader(ft)
+		order, err := at.placeLimitOpenLong("BTCUSDT", 0.01, 10, 50000, 49000)
+		if err != nil {
+			t.Fatalf("最后一次请求已落地应返回成功, got %v", err)
+		}
+		if order["clientOrderId"] != ft.sent[0] {
+			t.Errorf("应返回已落地的订单, got %v", order)
+		}
+	})
+
+	t.Run("重发前按实时持仓重新校验并发上限", func(t *testing.T) {
+		ft := &flakyOrderTrader{failures: 1}
+		at := newTrader(ft)
+		ft.SetPositions([]map[string]interface{}{
+			{"symbol": "ETHUSDT", "side": "long"},
+			{"symbol": "SOLUSDT", "side": "long"},
+			{"symbol": "BNBUSDT", "side": "short"},
+		})
+		if _, err := at.placeOpenLong("BTCUSDT", 0.01, 10); err == nil || !strings.Contains(err.Error(), "并发仓位已达上限") {
+			t.Fatalf("退避期间仓位已满应停止重发, got %v", err)
+		}
+		if len(ft.sent) != 1 {
+			t.Errorf("仓位已满时不应重发, 发送 %d 次", len(ft.sent))
+		}
+	})
+
+	t.Run("交易所明确拒绝不重试", func(t *testing.T) {
+		ft := &flakyOrderTrader{rejectErr: fmt.Errorf("开多仓失败: %w", &common.APIError{Code: -2019, Message: "Margin is insufficient."})}
+		at := newTrader(ft)
+		if _, err := at.placeOpenLong("BTCUSDT", 0.01, 10); err == nil {
+			t.Fatal("保证金不足应返回错误")
+		}
+		if len(ft.sent) != 1 {
+			t.Errorf("交易所拒绝不应重试, 发送 %d 次", len(ft.sent))
+		}
+	})
+
+	t.Run("不支持clientOrderId的交易器只下单一次", func(t *testing.T) {
+		mockTrader := NewMockTrader()
+		at := &AutoTrader{id: "retry-test", trader: mockTrader}
+		if _, err := at.placeOpenLong("BTCUSDT", 0.01, 10); err != nil {
+			t.Fatalf("placeOpenLong() error = %v", err)
+		}
+	})
+}
+
+func TestNewClientOrderID(t *testing.T) {
+	id := newClientOrderID("binance_user@example.com_deepseek_1700000000", "1000PEPEUSDT")
+	if len(id) > clientOrderIDMaxLen {
+		t.Errorf("clientOrderId 不应超过 %d 字符, got %d (%s)", clientOrderIDMaxLen, len(id), id)
+	}
+	if strings.Contains(id, "@") {
+		t.Errorf("clientOrderId 应替换非法字符, got %s", id)
+	}
+	if !strings.Contains(id, "-1000PEPEUSDT-") {
+		t.Errorf("截短时应保留完整币种, got %s", id)
+	}
+}
@@ -2,15 +2,24 @@ package trader
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"nofx/market"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/adshao/go-binance/v2/common"
 	"github.com/adshao/go-binance/v2/futures"
 )
 
+const (
+	symbolFiltersRefreshInterval = time.Hour        // exchangeInfo 过滤器刷新间隔
+	symbolFiltersRetryDelay      = time.Minute      // 获取失败后的最短重试间隔
+	symbolFiltersTimeout         = 10 * time.Second // 单次 exchangeInfo 请求超时
+)
+
 // FuturesTrader 币安合约交易器
 type FuturesTrader struct {
 	client *futures.Client
@@ -29,8 +38,20 @@ type FuturesTrader struct {
 	positionsCacheTime  time.Time
 	positionsCacheMutex sync.RWMutex
 
+	// 双向持仓模式（SetPositionMode 开启后，开仓/全平只撤销同方向的委托，避免误撤另一方向持仓的止损止盈）
+	dualSide bool
+
 	// 缓存有效期（15秒）
 	cacheDuration time.Duration
+
+	// 服务器时间同步（偏移写入 client.TimeOffset）
+	clock *exchangeClock
+
+	// 交易对过滤器缓存（exchangeInfo 的 tickSize/stepSize/minNotional）
+	filtersMu        sync.Mutex
+	symbolFilters    map[string]market.SymbolFilters
+	filtersFetchedAt time.Time
+	filtersAttemptAt time.Time
 }
 
 // NewFuturesTrader 创建合约交易器
@@ -46,9 +67,18 @@ func NewFuturesTraderWithConfig(apiKey, secretKey, stopLossWorkingType string, e
 		stopLossWorkingType:  stopLossWorkingType,
 		enablePriceProtect:   enablePriceProtect,
 		cacheDuration:        15 * time.Second, // 15秒缓存
+		clock:                newBinanceClock(client),
 	}
 }
 
+// newBinanceClock 币安服务器时间同步，偏移由SDK在签名请求时扣除
+func newBinanceClock(client *futures.Client) *exchangeClock {
+	return newExchangeClock("Binance",
+		func(ctx context.Context) (int64, error) { return client.NewServerTimeService().Do(ctx) },
+		func(offsetMs int64) { client.TimeOffset = offsetMs },
+	)
+}
+
 // GetBalance 获取账户余额（带缓存）
 func (t *FuturesTrader) GetBalance() (map[string]interface{}, error) {
 	// 先检查缓存是否有效
@@ -62,6 +92,7 @@ func (t *FuturesTrader) GetBalance() (map[string]interface{}, error) {
 	t.balanceCacheMutex.RUnlock()
 
 	// 缓存过期或不存在，调用API
+	t.clock.maybeSync()
 	log.Printf("🔄 缓存过期，正在调用币安API获取账户余额...")
 	account, err := t.client.NewGetAccountService().Do(context.Background())
 	if err != nil {
@@ -101,6 +132,7 @@ func (t *FuturesTrader) GetPositions() ([]map[string]interface{}, error) {
 	t.positionsCacheMutex.RUnlock()
 
 	// 缓存过期或不存在，调用API
+	t.clock.maybeSync()
 	log.Printf("🔄 缓存过期，正在调用币安API获取持仓信息...")
 	positions, err := t.client.NewGetPositionRiskService().Do(context.Background())
 	if err != nil {
@@ -182,6 +214,9 @@ func (t *FuturesTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
 	return nil
 }
 
+// leverageCooldown 切换杠杆后的等待时间（测试中可调小）
+var leverageCooldown = 5 * time.Second
+
 // SetLeverage 设置杠杆（智能判断+冷却期）
 func (t *FuturesTrader) SetLeverage(symbol string, leverage int) error {
 	// 先尝试获取当前杠杆（从持仓信息）
@@ -221,17 +256,22 @@ func (t *FuturesTrader) SetLeverage(symbol string, leverage int) error {
 
 	log.Printf("  ✓ %s 杠杆已切换为 %dx", symbol, leverage)
 
-	// 切换杠杆后等待5秒（避免冷却期错误）
-	log.Printf("  ⏱ 等待5秒冷却期...")
-	time.Sleep(5 * time.Second)
+	// 切换杠杆后等待冷却期（避免冷却期错误）
+	log.Printf("  ⏱ 等待%v冷却期...", leverageCooldown)
+	time.Sleep(leverageCooldown)
 
 	return nil
 }
 
 // OpenLong 开多仓
 func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.OpenLongWithClientID(symbol, quantity, leverage, "")
+}
+
+// OpenLongWithClientID 开多仓并指定 clientOrderId（为空时由交易所生成）
+func (t *FuturesTrader) OpenLongWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
 	// 先取消该币种的所有委托单（清理旧的止损止盈单）
-	if err := t.CancelAllOrders(symbol); err != nil {
+	if err := t.cancelPositionSideOrders(symbol, futures.PositionSideTypeLong); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
 	}
 
@@ -249,13 +289,16 @@ func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int)
 	}
 
 	// 创建市价买入订单
-	order, err := t.client.NewCreateOrderService().
+	service := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeBuy).
 		PositionSide(futures.PositionSideTypeLong).
 		Type(futures.OrderTypeMarket).
-		Quantity(quantityStr).
-		Do(context.Background())
+		Quantity(quantityStr)
+	if clientOrderID != "" {
+		service = service.NewClientOrderID(clientOrderID)
+	}
+	order, err := service.Do(context.Background())
 
 	if err != nil {
 		return nil, fmt.Errorf("开多仓失败: %w", err)
@@ -268,13 +311,19 @@ func (t *FuturesTrader) OpenLong(symbol string, quantity float64, leverage int)
 	result["orderId"] = order.OrderID
 	result["symbol"] = order.Symbol
 	result["status"] = order.Status
+	result["clientOrderId"] = order.ClientOrderID
 	return result, nil
 }
 
 // OpenShort 开空仓
 func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.OpenShortWithClientID(symbol, quantity, leverage, "")
+}
+
+// OpenShortWithClientID 开空仓并指定 clientOrderId（为空时由交易所生成）
+func (t *FuturesTrader) OpenShortWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error) {
 	// 先取消该币种的所有委托单（清理旧的止损止盈单）
-	if err := t.CancelAllOrders(symbol); err != nil {
+	if err := t.cancelPositionSideOrders(symbol, futures.PositionSideTypeShort); err != nil {
 		log.Printf("  ⚠ 取消旧委托单失败（可能没有委托单）: %v", err)
 	}
 
@@ -292,13 +341,16 @@ func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int)
 	}
 
 	// 创建市价卖出订单
-	order, err := t.client.NewCreateOrderService().
+	service := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(futures.SideTypeSell).
 		PositionSide(futures.PositionSideTypeShort).
 		Type(futures.OrderTypeMarket).
-		Quantity(quantityStr).
-		Do(context.Background())
+		Quantity(quantityStr)
+	if clientOrderID != "" {
+		service = service.NewClientOrderID(clientOrderID)
+	}
+	order, err := service.Do(context.Background())
 
 	if err != nil {
 		return nil, fmt.Errorf("开空仓失败: %w", err)
@@ -311,6 +363,7 @@ func (t *FuturesTrader) OpenShort(symbol string, quantity float64, leverage int)
 	result["orderId"] = order.OrderID
 	result["symbol"] = order.Symbol
 	result["status"] = order.Status
+	result["clientOrderId"] = order.ClientOrderID
 	return result, nil
 }
 
@@ -373,7 +426,7 @@ func (t *FuturesTrader) CloseLong(symbol string, quantity float64) (map[string]i
 		}
 		// 只有全平时才取消挂单
 		if !hasRemainingPosition {
-			if err := t.CancelAllOrders(symbol); err != nil {
+			if err := t.cancelPositionSideOrders(symbol, futures.PositionSideTypeLong); err != nil {
 				log.Printf("  ⚠ 取消挂单失败: %v", err)
 			} else {
 				log.Printf("  ✓ 全平完成，已取消所有挂单")
@@ -453,7 +506,7 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 		}
 		// 只有全平时才取消挂单
 		if !hasRemainingPosition {
-			if err := t.CancelAllOrders(symbol); err != nil {
+			if err := t.cancelPositionSideOrders(symbol, futures.PositionSideTypeShort); err != nil {
 				log.Printf("  ⚠ 取消挂单失败: %v", err)
 			} else {
 				log.Printf("  ✓ 全平完成，已取消所有挂单")
@@ -471,6 +524,54 @@ func (t *FuturesTrader) CloseShort(symbol string, quantity float64) (map[string]
 	return result, nil
 }
 
+// SetPositionMode 设置持仓模式（true=双向持仓，false=单向持仓）
+func (t *FuturesTrader) SetPositionMode(dualSide bool) error {
+	modeStr := "单向持仓"
+	if dualSide {
+		modeStr = "双向持仓"
+	}
+
+	err := t.client.NewChangePositionModeService().
+		DualSide(dualSide).
+		Do(context.Background())
+	if err != nil {
+		// 账户已是目标模式
+		if contains(err.Error(), "No need to change position side") {
+			log.Printf("  ✓ 持仓模式已是 %s", modeStr)
+			t.dualSide = dualSide
+			return nil
+		}
+		return fmt.Errorf("设置持仓模式失败: %w", err)
+	}
+
+	t.dualSide = dualSide
+	log.Printf("  ✓ 持仓模式已设置为 %s", modeStr)
+	return nil
+}
+
+// cancelPositionSideOrders 撤销该币种某一方向的委托；单向持仓模式下撤销全部挂单
+func (t *FuturesTrader) cancelPositionSideOrders(symbol string, positionSide futures.PositionSideType) error {
+	if !t.dualSide {
+		return t.CancelAllOrders(symbol)
+	}
+
+	orders, err := t.client.NewListOpenOrdersService().
+		Symbol(symbol).
+		Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("获取挂单失败: %w", err)
+	}
+	for _, order := range orders {
+		if order.PositionSide != positionSide {
+			continue
+		}
+		if err := t.CancelOrder(symbol, order.OrderID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // CancelAllOrders 取消该币种的所有挂单
 func (t *FuturesTrader) CancelAllOrders(symbol string) error {
 	err := t.client.NewCancelAllOpenOrdersService().
@@ -513,7 +614,7 @@ func (t *FuturesTrader) CalculatePositionSize(balance, riskPercent, price float6
 }
 
 // SetStopLoss 设置止损单
-func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64, reduceOnly bool) error {
 	var side futures.SideType
 	var posSide futures.PositionSideType
 
@@ -525,20 +626,22 @@ func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity
 		posSide = futures.PositionSideTypeShort
 	}
 
-	// 格式化数量
-	quantityStr, err := t.FormatQuantity(symbol, quantity)
-	if err != nil {
-		return err
-	}
-
 	orderService := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(side).
 		PositionSide(posSide).
 		Type(futures.OrderTypeStopMarket).
-		StopPrice(fmt.Sprintf("%.8f", stopPrice)).
-		Quantity(quantityStr).
-		ClosePosition(true)
+		StopPrice(t.FormatPrice(symbol, stopPrice))
+	if reduceOnly {
+		// closePosition 条件单触发时平掉该方向全部仓位且不会反向开仓（不能同时传 quantity；双向持仓模式不接受 reduceOnly 参数）
+		orderService.ClosePosition(true)
+	} else {
+		quantityStr, err := t.FormatQuantity(symbol, quantity)
+		if err != nil {
+			return err
+		}
+		orderService.Quantity(quantityStr)
+	}
 
 	// 设置工作类型
 	if t.stopLossWorkingType == "MARK_PRICE" {
@@ -553,7 +656,7 @@ func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity
 		// orderService.PriceProtect(true)
 	}
 
-	_, err = orderService.Do(context.Background())
+	_, err := orderService.Do(context.Background())
 
 	if err != nil {
 		return fmt.Errorf("设置止损失败: %w", err)
@@ -564,7 +667,7 @@ func (t *FuturesTrader) SetStopLoss(symbol string, positionSide string, quantity
 }
 
 // SetTakeProfit 设置止盈单
-func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64, reduceOnly bool) error {
 	var side futures.SideType
 	var posSide futures.PositionSideType
 
@@ -576,20 +679,22 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 		posSide = futures.PositionSideTypeShort
 	}
 
-	// 格式化数量
-	quantityStr, err := t.FormatQuantity(symbol, quantity)
-	if err != nil {
-		return err
-	}
-
 	orderService := t.client.NewCreateOrderService().
 		Symbol(symbol).
 		Side(side).
 		PositionSide(posSide).
 		Type(futures.OrderTypeTakeProfitMarket).
-		StopPrice(fmt.Sprintf("%.8f", takeProfitPrice)).
-		Quantity(quantityStr).
-		ClosePosition(true)
+		StopPrice(t.FormatPrice(symbol, takeProfitPrice))
+	if reduceOnly {
+		// closePosition 条件单触发时平掉该方向全部仓位且不会反向开仓（不能同时传 quantity；双向持仓模式不接受 reduceOnly 参数）
+		orderService.ClosePosition(true)
+	} else {
+		quantityStr, err := t.FormatQuantity(symbol, quantity)
+		if err != nil {
+			return err
+		}
+		orderService.Quantity(quantityStr)
+	}
 
 	// TakeProfit默认使用CONTRACT_PRICE，但也可以配置
 	// 用户建议：StopLoss用MARK_PRICE，TakeProfit用CONTRACT_PRICE
@@ -601,7 +706,7 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 		// orderService.PriceProtect(true)
 	}
 
-	_, err = orderService.Do(context.Background())
+	_, err := orderService.Do(context.Background())
 
 	if err != nil {
 		return fmt.Errorf("设置止盈失败: %w", err)
@@ -611,29 +716,99 @@ func (t *FuturesTrader) SetTakeProfit(symbol string, positionSide string, quanti
 	return nil
 }
 
-// GetSymbolPrecision 获取交易对的数量精度
-func (t *FuturesTrader) GetSymbolPrecision(symbol string) (int, error) {
-	exchangeInfo, err := t.client.NewExchangeInfoService().Do(context.Background())
+// RefreshSymbolFilters 从 exchangeInfo 拉取全部交易对的过滤器并替换缓存（请求期间不持锁，读取方继续使用旧缓存）
+func (t *FuturesTrader) RefreshSymbolFilters(ctx context.Context) error {
+	t.filtersMu.Lock()
+	t.filtersAttemptAt = time.Now()
+	t.filtersMu.Unlock()
+	return t.refreshSymbolFilters(ctx)
+}
+
+// refreshSymbolFilters 拉取并替换缓存，调用方已更新 filtersAttemptAt
+func (t *FuturesTrader) refreshSymbolFilters(ctx context.Context) error {
+	exchangeInfo, err := t.client.NewExchangeInfoService().Do(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("获取交易规则失败: %w", err)
+		return fmt.Errorf("获取交易规则失败: %w", err)
 	}
 
+	filters := make(map[string]market.SymbolFilters, len(exchangeInfo.Symbols))
 	for _, s := range exchangeInfo.Symbols {
-		if s.Symbol == symbol {
-			// 从LOT_SIZE filter获取精度
-			for _, filter := range s.Filters {
-				if filter["filterType"] == "LOT_SIZE" {
-					stepSize := filter["stepSize"].(string)
-					precision := calculatePrecision(stepSize)
-					log.Printf("  %s 数量精度: %d (stepSize: %s)", symbol, precision, stepSize)
-					return precision, nil
-				}
+		var f market.SymbolFilters
+		for _, filter := range s.Filters {
+			switch filter["filterType"] {
+			case "PRICE_FILTER":
+				f.TickSize = filterFloat(filter, "tickSize")
+			case "LOT_SIZE":
+				f.StepSize = filterFloat(filter, "stepSize")
+				f.MinQty = filterFloat(filter, "minQty")
+				f.MaxQty = filterFloat(filter, "maxQty")
+			case "MIN_NOTIONAL":
+				f.MinNotional = filterFloat(filter, "notional")
 			}
 		}
+		filters[s.Symbol] = f
 	}
 
-	log.Printf("  ⚠ %s 未找到精度信息，使用默认精度3", symbol)
-	return 3, nil // 默认精度为3
+	t.filtersMu.Lock()
+	t.symbolFilters = filters
+	t.filtersFetchedAt = time.Now()
+	t.filtersMu.Unlock()
+	log.Printf("✓ 已缓存币安交易规则: %d 个交易对", len(filters))
+	return nil
+}
+
+// filterFloat 读取 exchangeInfo filter 中的字符串数值
+func filterFloat(filter map[string]interface{}, key string) float64 {
+	value, _ := filter[key].(string)
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+// maybeRefreshSymbolFilters 缓存超过 symbolFiltersRefreshInterval 时重新拉取（失败后至少间隔 symbolFiltersRetryDelay 再试）。
+// 发起刷新前先记录尝试时间，同时到达的调用方不会重复请求，刷新期间继续使用旧缓存
+func (t *FuturesTrader) maybeRefreshSymbolFilters() {
+	t.filtersMu.Lock()
+	if time.Since(t.filtersFetchedAt) < symbolFiltersRefreshInterval || time.Since(t.filtersAttemptAt) < symbolFiltersRetryDelay {
+		t.filtersMu.Unlock()
+		return
+	}
+	t.filtersAttemptAt = time.Now()
+	t.filtersMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), symbolFiltersTimeout)
+	defer cancel()
+	if err := t.refreshSymbolFilters(ctx); err != nil {
+		log.Printf("⚠️ 刷新币安交易规则失败，继续使用旧缓存: %v", err)
+	}
+}
+
+// GetSymbolFilters 获取交易对过滤器（实现 market.SymbolFiltersProvider）
+func (t *FuturesTrader) GetSymbolFilters(symbol string) (*market.SymbolFilters, error) {
+	t.maybeRefreshSymbolFilters()
+
+	t.filtersMu.Lock()
+	defer t.filtersMu.Unlock()
+	if t.symbolFilters == nil {
+		return nil, fmt.Errorf("币安交易规则尚未加载")
+	}
+	filters, ok := t.symbolFilters[symbol]
+	if !ok {
+		return nil, fmt.Errorf("交易对 %s 的过滤器信息未找到", symbol)
+	}
+	return &filters, nil
+}
+
+// GetSymbolPrecision 获取交易对的数量精度
+func (t *FuturesTrader) GetSymbolPrecision(symbol string) (int, error) {
+	filters, err := t.GetSymbolFilters(symbol)
+	if err != nil {
+		return 0, err
+	}
+	if filters.StepSize <= 0 {
+		log.Printf("  ⚠ %s 未找到精度信息，使用默认精度3", symbol)
+		return 3, nil // 默认精度为3
+	}
+	return calculatePrecision(strconv.FormatFloat(filters.StepSize, 'f', -1, 64)), nil
 }
 
 // calculatePrecision 从stepSize计算精度
@@ -679,16 +854,27 @@ func trimTrailingZeros(s string) string {
 	return s
 }
 
-// FormatQuantity 格式化数量到正确的精度
+// FormatQuantity 数量按 stepSize 向下取整并格式化到对应精度（避免 -1111 精度错误/LOT_SIZE 超限）
 func (t *FuturesTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
-	precision, err := t.GetSymbolPrecision(symbol)
-	if err != nil {
+	filters, err := t.GetSymbolFilters(symbol)
+	if err != nil || filters.StepSize <= 0 {
 		// 如果获取失败，使用默认格式
 		return fmt.Sprintf("%.3f", quantity), nil
 	}
 
-	format := fmt.Sprintf("%%.%df", precision)
-	return fmt.Sprintf(format, quantity), nil
+	precision := calculatePrecision(strconv.FormatFloat(filters.StepSize, 'f', -1, 64))
+	return strconv.FormatFloat(market.FloorToStep(quantity, filters.StepSize), 'f', precision, 64), nil
+}
+
+// FormatPrice 价格按 tickSize 取整并格式化到对应精度
+func (t *FuturesTrader) FormatPrice(symbol string, price float64) string {
+	filters, err := t.GetSymbolFilters(symbol)
+	if err != nil || filters.TickSize <= 0 {
+		return fmt.Sprintf("%.8f", price)
+	}
+
+	precision := calculatePrecision(strconv.FormatFloat(filters.TickSize, 'f', -1, 64))
+	return strconv.FormatFloat(market.RoundToTickSize(price, filters.TickSize), 'f', precision, 64)
 }
 
 // 辅助函数
@@ -707,6 +893,41 @@ func stringContains(s, substr string) bool {
 
 // LimitOpenLong 限价开多仓（使用限价单+止损保护）
 func (t *FuturesTrader) LimitOpenLong(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64) (map[string]interface{}, error) {
+	return t.LimitOpenLongWithClientID(symbol, quantity, leverage, limitPrice, stopLoss, "")
+}
+
+// LimitOpenLongWithClientID 限价开多仓并指定 clientOrderId（为空时由交易所生成）
+func (t *FuturesTrader) LimitOpenLongWithClientID(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error) {
+	return t.limitOpen(symbol, futures.SideTypeBuy, futures.PositionSideTypeLong, quantity, leverage, limitPrice, stopLoss, clientOrderID, futures.TimeInForceTypeGTC)
+}
+
+// LimitOpenShort 限价开空仓（使用限价单+止损保护）
+func (t *FuturesTrader) LimitOpenShort(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64) (map[string]interface{}, error) {
+	return t.LimitOpenShortWithClientID(symbol, quantity, leverage, limitPrice, stopLoss, "")
+}
+
+// LimitOpenShortWithClientID 限价开空仓并指定 clientOrderId（为空时由交易所生成）
+func (t *FuturesTrader) LimitOpenShortWithClientID(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error) {
+	return t.limitOpen(symbol, futures.SideTypeSell, futures.PositionSideTypeShort, quantity, leverage, limitPrice, stopLoss, clientOrderID, futures.TimeInForceTypeGTC)
+}
+
+// PostOnlyOpenLong post-only限价开多仓（GTX，会立即成交的价格由交易所拒绝，保证maker成交）
+func (t *FuturesTrader) PostOnlyOpenLong(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error) {
+	return t.limitOpen(symbol, futures.SideTypeBuy, futures.PositionSideTypeLong, quantity, leverage, limitPrice, stopLoss, clientOrderID, futures.TimeInForceTypeGTX)
+}
+
+// PostOnlyOpenShort post-only限价开空仓（GTX）
+func (t *FuturesTrader) PostOnlyOpenShort(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error) {
+	return t.limitOpen(symbol, futures.SideTypeSell, futures.PositionSideTypeShort, quantity, leverage, limitPrice, stopLoss, clientOrderID, futures.TimeInForceTypeGTX)
+}
+
+// limitOpen 设置杠杆后挂限价开仓单，timeInForce 为 GTC（普通挂单）或 GTX（post-only）
+func (t *FuturesTrader) limitOpen(symbol string, side futures.SideType, positionSide futures.PositionSideType, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string, timeInForce futures.TimeInForceType) (map[string]interface{}, error) {
+	direction := "多"
+	if positionSide == futures.PositionSideTypeShort {
+		direction = "空"
+	}
+
 	// 设置杠杆
 	if err := t.SetLeverage(symbol, leverage); err != nil {
 		return nil, err
@@ -718,22 +939,24 @@ func (t *FuturesTrader) LimitOpenLong(symbol string, quantity float64, leverage
 		return nil, err
 	}
 
-	// 创建限价开多单
-	order, err := t.client.NewCreateOrderService().
+	service := t.client.NewCreateOrderService().
 		Symbol(symbol).
-		Side(futures.SideTypeBuy).
-		PositionSide(futures.PositionSideTypeLong).
+		Side(side).
+		PositionSide(positionSide).
 		Type(futures.OrderTypeLimit).
-		TimeInForce(futures.TimeInForceTypeGTC). // Good Till Cancel
+		TimeInForce(timeInForce).
 		Quantity(quantityStr).
-		Price(fmt.Sprintf("%.8f", limitPrice)).
-		Do(context.Background())
+		Price(t.FormatPrice(symbol, limitPrice))
+	if clientOrderID != "" {
+		service = service.NewClientOrderID(clientOrderID)
+	}
+	order, err := service.Do(context.Background())
 
 	if err != nil {
-		return nil, fmt.Errorf("限价开多仓失败: %w", err)
+		return nil, fmt.Errorf("限价开%s仓失败: %w", direction, err)
 	}
 
-	log.Printf("✓ 限价开多单已挂: %s 数量: %s 限价: %.4f 止损: %.4f", symbol, quantityStr, limitPrice, stopLoss)
+	log.Printf("✓ 限价开%s单已挂: %s 数量: %s 限价: %.4f 止损: %.4f (%s)", direction, symbol, quantityStr, limitPrice, stopLoss, timeInForce)
 	log.Printf("  订单ID: %d", order.OrderID)
 
 	result := make(map[string]interface{})
@@ -742,47 +965,49 @@ func (t *FuturesTrader) LimitOpenLong(symbol string, quantity float64, leverage
 	result["status"] = order.Status
 	result["limitPrice"] = limitPrice
 	result["stopLoss"] = stopLoss
+	result["clientOrderId"] = order.ClientOrderID
 
 	return result, nil
 }
 
-// LimitOpenShort 限价开空仓（使用限价单+止损保护）
-func (t *FuturesTrader) LimitOpenShort(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64) (map[string]interface{}, error) {
-	// 设置杠杆
-	if err := t.SetLeverage(symbol, leverage); err != nil {
-		return nil, err
-	}
+// LimitCloseLong 限价平多仓（post-only maker单，只减仓）
+func (t *FuturesTrader) LimitCloseLong(symbol string, quantity, limitPrice float64) (map[string]interface{}, error) {
+	return t.limitClose(symbol, futures.SideTypeSell, futures.PositionSideTypeLong, quantity, limitPrice)
+}
 
-	// 格式化数量
+// LimitCloseShort 限价平空仓（post-only maker单，只减仓）
+func (t *FuturesTrader) LimitCloseShort(symbol string, quantity, limitPrice float64) (map[string]interface{}, error) {
+	return t.limitClose(symbol, futures.SideTypeBuy, futures.PositionSideTypeShort, quantity, limitPrice)
+}
+
+// limitClose 挂post-only限价平仓单
+func (t *FuturesTrader) limitClose(symbol string, side futures.SideType, positionSide futures.PositionSideType, quantity, limitPrice float64) (map[string]interface{}, error) {
 	quantityStr, err := t.FormatQuantity(symbol, quantity)
 	if err != nil {
 		return nil, err
 	}
 
-	// 创建限价开空单
 	order, err := t.client.NewCreateOrderService().
 		Symbol(symbol).
-		Side(futures.SideTypeSell).
-		PositionSide(futures.PositionSideTypeShort).
+		Side(side).
+		PositionSide(positionSide).
 		Type(futures.OrderTypeLimit).
-		TimeInForce(futures.TimeInForceTypeGTC).
+		TimeInForce(futures.TimeInForceTypeGTX). // Post Only，保证maker成交
 		Quantity(quantityStr).
-		Price(fmt.Sprintf("%.8f", limitPrice)).
+		Price(t.FormatPrice(symbol, limitPrice)).
+		ReduceOnly(true). // 强制只减仓，防止意外开反向仓
 		Do(context.Background())
-
 	if err != nil {
-		return nil, fmt.Errorf("限价开空仓失败: %w", err)
+		return nil, fmt.Errorf("限价平仓失败: %w", err)
 	}
 
-	log.Printf("✓ 限价开空单已挂: %s 数量: %s 限价: %.4f 止损: %.4f", symbol, quantityStr, limitPrice, stopLoss)
-	log.Printf("  订单ID: %d", order.OrderID)
+	log.Printf("✓ 限价平仓单已挂: %s %s 数量: %s 限价: %.4f (订单ID: %d)", symbol, positionSide, quantityStr, limitPrice, order.OrderID)
 
 	result := make(map[string]interface{})
 	result["orderId"] = order.OrderID
 	result["symbol"] = symbol
 	result["status"] = order.Status
 	result["limitPrice"] = limitPrice
-	result["stopLoss"] = stopLoss
 
 	return result, nil
 }
@@ -800,18 +1025,22 @@ func (t *FuturesTrader) GetOpenOrders(symbol string) ([]map[string]interface{},
 	result := make([]map[string]interface{}, 0, len(orders))
 	for _, order := range orders {
 		price, _ := strconv.ParseFloat(order.Price, 64)
+		stopPrice, _ := strconv.ParseFloat(order.StopPrice, 64)
 		qty, _ := strconv.ParseFloat(order.OrigQuantity, 64)
 
 		orderMap := map[string]interface{}{
-			"orderId":      order.OrderID,
-			"symbol":       order.Symbol,
-			"side":         string(order.Side),
-			"positionSide": string(order.PositionSide),
-			"type":         string(order.Type),
-			"price":        price,
-			"quantity":     qty,
-			"status":       string(order.Status),
-			"time":         order.Time,
+			"orderId":       order.OrderID,
+			"symbol":        order.Symbol,
+			"side":          string(order.Side),
+			"positionSide":  string(order.PositionSide),
+			"type":          string(order.Type),
+			"price":         price,
+			"stopPrice":     stopPrice,
+			"closePosition": order.ClosePosition,
+			"reduceOnly":    order.ReduceOnly,
+			"quantity":      qty,
+			"status":        string(order.Status),
+			"time":          order.Time,
 		}
 		result = append(result, orderMap)
 	}
@@ -835,7 +1064,7 @@ func (t *FuturesTrader) GetOrderStatus(symbol string, orderID int64) (map[string
 	executedQty, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
 	avgPrice, _ := strconv.ParseFloat(order.AvgPrice, 64)
 
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"orderId":         order.OrderID,
 		"symbol":          order.Symbol,
 		"side":            string(order.Side),
@@ -848,9 +1077,101 @@ func (t *FuturesTrader) GetOrderStatus(symbol string, orderID int64) (map[string
 		"status":          string(order.Status),
 		"time":            order.Time,
 		"updateTime":      order.UpdateTime,
+	}
+
+	// 有成交时从成交明细汇总手续费（查询失败不影响订单状态）
+	if executedQty > 0 {
+		if commission, err := t.getOrderCommission(symbol, orderID); err != nil {
+			log.Printf("  ⚠️ 查询订单 #%d 手续费失败: %v", orderID, err)
+		} else {
+			result["commission"] = commission
+		}
+	}
+	return result, nil
+}
+
+// binanceOrderNotExist 币安"订单不存在"错误码
+const binanceOrderNotExist = -2013
+
+// GetOrderByClientID 按 clientOrderId 查询订单（含已成交/已撤销），订单不存在时返回 (nil, nil)
+func (t *FuturesTrader) GetOrderByClientID(symbol, clientOrderID string) (map[string]interface{}, error) {
+	order, err := t.client.NewGetOrderService().
+		Symbol(symbol).
+		OrigClientOrderID(clientOrderID).
+		Do(context.Background())
+	if err != nil {
+		var apiErr *common.APIError
+		if errors.As(err, &apiErr) && apiErr.Code == binanceOrderNotExist {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("按clientOrderId查询订单失败: %w", err)
+	}
+
+	executedQty, _ := strconv.ParseFloat(order.ExecutedQuantity, 64)
+	avgPrice, _ := strconv.ParseFloat(order.AvgPrice, 64)
+	return map[string]interface{}{
+		"orderId":       order.OrderID,
+		"clientOrderId": order.ClientOrderID,
+		"symbol":        order.Symbol,
+		"status":        string(order.Status),
+		"executedQty":   executedQty,
+		"avgPrice":      avgPrice,
 	}, nil
 }
 
+// getOrderCommission 汇总订单各笔成交的手续费
+func (t *FuturesTrader) getOrderCommission(symbol string, orderID int64) (float64, error) {
+	trades, err := t.client.NewListAccountTradeService().
+		Symbol(symbol).
+		OrderID(orderID).
+		Do(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+	for _, trade := range trades {
+		commission, _ := strconv.ParseFloat(trade.Commission, 64)
+		total += commission
+	}
+	return total, nil
+}
+
+// GetTradeHistory 获取该币种 since 之后的成交记录（币安单次最多返回7天窗口内的1000笔）
+func (t *FuturesTrader) GetTradeHistory(symbol string, since int64) ([]TradeFill, error) {
+	service := t.client.NewListAccountTradeService().
+		Symbol(symbol).
+		Limit(1000)
+	if since > 0 {
+		service = service.StartTime(since)
+	}
+	trades, err := service.Do(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("获取成交记录失败: %w", err)
+	}
+
+	fills := make([]TradeFill, 0, len(trades))
+	for _, trade := range trades {
+		price, _ := strconv.ParseFloat(trade.Price, 64)
+		qty, _ := strconv.ParseFloat(trade.Quantity, 64)
+		commission, _ := strconv.ParseFloat(trade.Commission, 64)
+		realizedPnL, _ := strconv.ParseFloat(trade.RealizedPnl, 64)
+		fills = append(fills, TradeFill{
+			Time:         trade.Time,
+			Symbol:       trade.Symbol,
+			OrderID:      trade.OrderID,
+			Side:         string(trade.Side),
+			PositionSide: string(trade.PositionSide),
+			Price:        price,
+			Quantity:     qty,
+			Fee:          commission,
+			FeeAsset:     trade.CommissionAsset,
+			RealizedPnL:  realizedPnL,
+		})
+	}
+	return fills, nil
+}
+
 // CancelOrder 取消指定订单
 func (t *FuturesTrader) CancelOrder(symbol string, orderID int64) error {
 	_, err := t.client.NewCancelOrderService().
@@ -0,0 +1,80 @@
+package trader
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+)
+
+// credentialCheckTimeout 凭证校验最长等待时间，交易所无响应时不长时间阻塞保存请求
+var credentialCheckTimeout = 8 * time.Second
+
+// ExchangeCredentials 交易所凭证（用于保存前校验）
+type ExchangeCredentials struct {
+	APIKey                string
+	SecretKey             string
+	Testnet               bool
+	HyperliquidWalletAddr string
+	AsterUser             string
+	AsterSigner           string
+	AsterPrivateKey       string
+}
+
+// CredentialVerifier 凭证校验函数，返回nil表示凭证可用
+type CredentialVerifier func(exchangeID string, creds ExchangeCredentials) error
+
+// NewTraderFromCredentials 根据交易所ID和凭证创建交易器
+func NewTraderFromCredentials(exchangeID string, creds ExchangeCredentials) (Trader, error) {
+	switch exchangeID {
+	case "binance":
+		if creds.APIKey == "" || creds.SecretKey == "" {
+			return nil, fmt.Errorf("币安需要配置API Key和Secret Key")
+		}
+		ft := NewFuturesTrader(creds.APIKey, creds.SecretKey)
+		if creds.Testnet {
+			ft.client.BaseURL = futures.BaseApiTestnetUrl
+		}
+		return ft, nil
+	case "hyperliquid":
+		if creds.APIKey == "" {
+			return nil, fmt.Errorf("Hyperliquid需要配置私钥")
+		}
+		return NewHyperliquidTrader(creds.APIKey, creds.HyperliquidWalletAddr, creds.Testnet)
+	case "aster":
+		if creds.AsterUser == "" || creds.AsterSigner == "" || creds.AsterPrivateKey == "" {
+			return nil, fmt.Errorf("Aster需要配置user、signer和私钥")
+		}
+		return NewAsterTrader(creds.AsterUser, creds.AsterSigner, creds.AsterPrivateKey)
+	default:
+		return nil, fmt.Errorf("不支持的交易平台: %s", exchangeID)
+	}
+}
+
+// newCredentialTrader 凭证校验使用的交易器构造函数（测试中可替换）
+var newCredentialTrader = NewTraderFromCredentials
+
+// VerifyExchangeCredentials 通过一次只读的余额查询校验凭证是否可用，超过 credentialCheckTimeout 视为失败。
+// 交易器构造同样计入超时（Hyperliquid 构造时会请求交易所元数据）
+func VerifyExchangeCredentials(exchangeID string, creds ExchangeCredentials) error {
+	// 构造与 GetBalance 均不支持 context，超时后放弃等待（请求在后台结束）
+	done := make(chan error, 1)
+	go func() {
+		t, err := newCredentialTrader(exchangeID, creds)
+		if err != nil {
+			done <- err
+			return
+		}
+		if _, err := t.GetBalance(); err != nil {
+			done <- fmt.Errorf("查询账户余额失败: %w", err)
+			return
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(credentialCheckTimeout):
+		return fmt.Errorf("校验交易所凭证超时（%v），请检查网络或交易所状态", credentialCheckTimeout)
+	}
+}
@@ -0,0 +1,228 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"nofx/logger"
+	"nofx/market"
+)
+
+const (
+	defaultEMACrossExitTimeframe   = "1h"
+	defaultEMACrossStopDistancePct = 0.5 // tighten_stop 默认止损距离（%）
+)
+
+// emaCrossSeries 从行情数据中取出指定周期的收盘价序列和对应EMA序列（两者尾部对齐），不支持的组合返回 false
+func emaCrossSeries(data *market.Data, timeframe string, period int) ([]float64, []float64, bool) {
+	if data == nil {
+		return nil, nil, false
+	}
+	switch timeframe {
+	case "5m":
+		if s := data.IntradaySeries; s != nil && period == 20 {
+			return s.MidPrices, s.EMA20Values, true
+		}
+	case "15m":
+		if s := data.MidTermSeries15m; s != nil {
+			switch period {
+			case 20:
+				return s.MidPrices, s.EMA20Values, true
+			case 50:
+				return s.MidPrices, s.EMA50Values, true
+			}
+		}
+	case "1h":
+		if s := data.MidTermSeries1h; s != nil {
+			return pickLongTermEMA(s.MidPrices, period, s.EMA20Values, s.EMA50Values, s.EMA100Values, s.EMA200Values)
+		}
+	case "4h":
+		if s := data.MidTermSeries4h; s != nil {
+			return pickLongTermEMA(s.MidPrices, period, s.EMA20Values, s.EMA50Values, s.EMA100Values, s.EMA200Values)
+		}
+	}
+	return nil, nil, false
+}
+
+// pickLongTermEMA 1h/4h 按周期选择 EMA20/50/100/200 序列
+func pickLongTermEMA(closes []float64, period int, ema20, ema50, ema100, ema200 []float64) ([]float64, []float64, bool) {
+	switch period {
+	case 20:
+		return closes, ema20, true
+	case 50:
+		return closes, ema50, true
+	case 100:
+		return closes, ema100, true
+	case 200:
+		return closes, ema200, true
+	}
+	return nil, nil, false
+}
+
+// emaCrossAgainst 判断最近一根已收盘K线是否逆持仓方向收穿EMA（多单：由上方收到下方；空单：由下方收到上方）
+// 序列最后一根为未收盘K线，不参与判断；返回穿越时的收盘价与EMA值
+func emaCrossAgainst(side string, closes, ema []float64) (bool, float64, float64) {
+	if len(closes) < 3 || len(ema) < 3 {
+		return false, 0, 0
+	}
+	lastClose, prevClose := closes[len(closes)-2], closes[len(closes)-3]
+	emaNow, emaPrev := ema[len(ema)-2], ema[len(ema)-3]
+	if emaNow <= 0 || emaPrev <= 0 {
+		return false, 0, 0
+	}
+
+	if strings.EqualFold(side, "short") {
+		return prevClose <= emaPrev && lastClose > emaNow, lastClose, emaNow
+	}
+	return prevClose >= emaPrev && lastClose < emaNow, lastClose, emaNow
+}
+
+// enforceEMACrossExit 检查所有持仓，所选周期收盘价逆向收穿EMA时平仓或收紧止损，返回执行记录
+func (at *AutoTrader) enforceEMACrossExit() []logger.DecisionAction {
+	period := at.config.EMACrossExitPeriod
+	if period <= 0 {
+		return nil
+	}
+	timeframe := at.config.EMACrossExitTimeframe
+	if timeframe == "" {
+		timeframe = defaultEMACrossExitTimeframe
+	}
+	action := at.config.EMACrossExitAction
+	if action == "" {
+		action = "close"
+	}
+	if action != "close" && action != "tighten_stop" {
+		log.Printf("⚠️ 未知的EMA反穿离场动作: %s", action)
+		return nil
+	}
+
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		log.Printf("⚠️ EMA反穿离场检查获取持仓失败: %v", err)
+		return nil
+	}
+
+	var events []logger.DecisionAction
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		side = strings.ToLower(side)
+
+		mkt, err := at.getMarketData(symbol)
+		if err != nil {
+			log.Printf("⚠️ %s EMA反穿离场获取行情失败: %v", symbol, err)
+			continue
+		}
+		closes, ema, ok := emaCrossSeries(mkt, timeframe, period)
+		if !ok {
+			log.Printf("⚠️ %s 无 %s EMA%d 序列，跳过EMA反穿离场检查", symbol, timeframe, period)
+			continue
+		}
+		crossed, closePrice, emaValue := emaCrossAgainst(side, closes, ema)
+		if !crossed {
+			continue
+		}
+
+		qty, _ := pos["positionAmt"].(float64)
+		if qty < 0 {
+			qty = -qty
+		}
+		direction := "跌破"
+		if side == "short" {
+			direction = "升破"
+		}
+		reason := fmt.Sprintf("ema_cross_exit: %s 收盘 %.4f %s EMA%d %.4f", timeframe, closePrice, direction, period, emaValue)
+		log.Printf("📉 %s %s 触发EMA反穿离场（%s）: %s", symbol, strings.ToUpper(side), action, reason)
+
+		var event logger.DecisionAction
+		if action == "tighten_stop" {
+			event = at.tightenStopOnEMACross(symbol, side, qty, mkt.CurrentPrice, reason)
+		} else {
+			event = at.closeOnEMACross(symbol, side, qty, mkt.CurrentPrice, reason)
+		}
+		if event.Action != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// closeOnEMACross 市价全平并清理持仓跟踪
+func (at *AutoTrader) closeOnEMACross(symbol, side string, qty, price float64, reason string) logger.DecisionAction {
+	action := "close_long"
+	if side == "short" {
+		action = "close_short"
+	}
+	event := logger.DecisionAction{
+		Action:    action,
+		Symbol:    symbol,
+		Quantity:  qty,
+		Price:     price,
+		Timestamp: time.Now(),
+		Reason:    reason,
+	}
+
+	var order map[string]interface{}
+	var err error
+	if side == "short" {
+		order, err = at.trader.CloseShort(symbol, 0) // 0 = 全部平仓
+	} else {
+		order, err = at.trader.CloseLong(symbol, 0)
+	}
+	if err != nil {
+		log.Printf("❌ %s %s EMA反穿平仓失败: %v", symbol, strings.ToUpper(side), err)
+		event.Error = err.Error()
+		event.Status = "ORDER_FAILED"
+		return event
+	}
+	if orderID, ok := order["orderId"].(int64); ok {
+		event.OrderID = orderID
+	}
+	event.Success = true
+	event.Status = "EXECUTED"
+	at.clearPositionTracking(symbol + "_" + side)
+	return event
+}
+
+// tightenStopOnEMACross 将止损收紧到距当前价 EMACrossExitStopDistancePct%（只往有利方向移动，已更紧时不产生记录）
+func (at *AutoTrader) tightenStopOnEMACross(symbol, side string, qty, price float64, reason string) logger.DecisionAction {
+	distancePct := at.config.EMACrossExitStopDistancePct
+	if distancePct <= 0 {
+		distancePct = defaultEMACrossStopDistancePct
+	}
+	newSL := price * (1 - distancePct/100)
+	if side == "short" {
+		newSL = price * (1 + distancePct/100)
+	}
+
+	posKey := symbol + "_" + side
+	tgt := at.positionTargets[posKey]
+	if tgt != nil && tgt.CurrentSL > 0 &&
+		((side == "long" && newSL <= tgt.CurrentSL) || (side == "short" && newSL >= tgt.CurrentSL)) {
+		return logger.DecisionAction{} // 现有止损已更紧
+	}
+
+	event := logger.DecisionAction{
+		Action:    "update_stop_loss",
+		Symbol:    symbol,
+		Quantity:  qty,
+		Price:     newSL,
+		Timestamp: time.Now(),
+		Reason:    reason,
+	}
+	if err := at.trader.SetStopLoss(symbol, strings.ToUpper(side), qty, newSL, true); err != nil {
+		log.Printf("❌ %s %s EMA反穿收紧止损失败: %v", symbol, strings.ToUpper(side), err)
+		event.Error = err.Error()
+		event.Status = "ORDER_FAILED"
+		return event
+	}
+	if tgt != nil {
+		tgt.CurrentSL = newSL
+	}
+	at.trackProtectiveOrders(symbol, side)
+	event.Success = true
+	event.Status = "EXECUTED"
+	return event
+}
@@ -0,0 +1,63 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/config"
+	"time"
+)
+
+const defaultEquitySnapshotInterval = 5 * time.Minute
+
+// EquitySnapshotStore 账户净值快照持久化（*config.Database 实现）
+type EquitySnapshotStore interface {
+	CreateEquitySnapshot(snapshot *config.EquitySnapshot) error
+}
+
+// SetEquitySnapshotStore 设置净值快照存储，运行期间按 EquitySnapshotInterval 定时记录（nil 表示不记录）
+func (at *AutoTrader) SetEquitySnapshotStore(store EquitySnapshotStore) {
+	at.equityStore = store
+}
+
+// runEquitySnapshots 启动时立即记录一次，之后定时记录，直到 stopChan 关闭；与决策周期相互独立，
+// AI 出错或周期被跳过时收益曲线也不会断档
+func (at *AutoTrader) runEquitySnapshots(stopChan chan struct{}) {
+	interval := at.config.EquitySnapshotInterval
+	if interval <= 0 {
+		interval = defaultEquitySnapshotInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := at.recordEquitySnapshot(); err != nil {
+			log.Printf("⚠️ [%s] 记录净值快照失败: %v", at.name, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+// recordEquitySnapshot 查询账户并写入一条净值快照（未设置存储时忽略）
+func (at *AutoTrader) recordEquitySnapshot() error {
+	if at.equityStore == nil {
+		return nil
+	}
+	info, err := at.GetAccountInfo()
+	if err != nil {
+		return fmt.Errorf("获取账户信息失败: %w", err)
+	}
+
+	snapshot := &config.EquitySnapshot{
+		TraderID:  at.id,
+		Timestamp: time.Now(),
+	}
+	snapshot.TotalEquity, _ = info["total_equity"].(float64)
+	snapshot.AvailableBalance, _ = info["available_balance"].(float64)
+	snapshot.MarginUsed, _ = info["margin_used"].(float64)
+	snapshot.PositionCount, _ = info["position_count"].(int)
+	return at.equityStore.CreateEquitySnapshot(snapshot)
+}
@@ -568,7 +568,7 @@ func (t *HyperliquidTrader) GetMarketPrice(symbol string) (float64, error) {
 }
 
 // SetStopLoss 设置止损单
-func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64, reduceOnly bool) error {
 	coin := convertSymbolToHyperliquid(symbol)
 
 	isBuy := positionSide == "SHORT" // 空仓止损=买入，多仓止损=卖出
@@ -592,7 +592,7 @@ func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quan
 				Tpsl:      "sl", // stop loss
 			},
 		},
-		ReduceOnly: true,
+		ReduceOnly: reduceOnly,
 	}
 
 	_, err := t.exchange.Order(t.ctx, order, nil)
@@ -605,7 +605,7 @@ func (t *HyperliquidTrader) SetStopLoss(symbol string, positionSide string, quan
 }
 
 // SetTakeProfit 设置止盈单
-func (t *HyperliquidTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+func (t *HyperliquidTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64, reduceOnly bool) error {
 	coin := convertSymbolToHyperliquid(symbol)
 
 	isBuy := positionSide == "SHORT" // 空仓止盈=买入，多仓止盈=卖出
@@ -629,7 +629,7 @@ func (t *HyperliquidTrader) SetTakeProfit(symbol string, positionSide string, qu
 				Tpsl:      "tp", // take profit
 			},
 		},
-		ReduceOnly: true,
+		ReduceOnly: reduceOnly,
 	}
 
 	_, err := t.exchange.Order(t.ctx, order, nil)
@@ -763,3 +763,8 @@ func (t *HyperliquidTrader) GetOrderStatus(symbol string, orderID int64) (map[st
 func (t *HyperliquidTrader) CancelOrder(symbol string, orderID int64) error {
 	return fmt.Errorf("Hyperliquid 暂不支持限价单功能")
 }
+
+// GetTradeHistory Hyperliquid暂不支持成交记录查询
+func (t *HyperliquidTrader) GetTradeHistory(symbol string, since int64) ([]TradeFill, error) {
+	return nil, fmt.Errorf("Hyperliquid 暂不支持成交记录查询")
+}
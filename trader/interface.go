@@ -1,5 +1,7 @@
 package trader
 
+import "context"
+
 // Trader 交易器统一接口
 // 支持多个交易平台（币安、Hyperliquid等）
 type Trader interface {
@@ -30,11 +32,11 @@ type Trader interface {
 	// GetMarketPrice 获取市场价格
 	GetMarketPrice(symbol string) (float64, error)
 
-	// SetStopLoss 设置止损单
-	SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error
+	// SetStopLoss 设置止损单（reduceOnly=true 时只减仓，触发后不会反向开仓；保护性订单应始终传 true）
+	SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64, reduceOnly bool) error
 
-	// SetTakeProfit 设置止盈单
-	SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error
+	// SetTakeProfit 设置止盈单（reduceOnly 同 SetStopLoss）
+	SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64, reduceOnly bool) error
 
 	// CancelAllOrders 取消该币种的所有挂单
 	CancelAllOrders(symbol string) error
@@ -56,4 +58,71 @@ type Trader interface {
 
 	// FormatQuantity 格式化数量到正确的精度
 	FormatQuantity(symbol string, quantity float64) (string, error)
+
+	// GetTradeHistory 获取该币种 since（毫秒时间戳）之后的成交记录，按时间升序
+	GetTradeHistory(symbol string, since int64) ([]TradeFill, error)
+}
+
+// TradeFill 交易所成交记录（各交易所统一格式，用于对账AI记录的盈亏）
+type TradeFill struct {
+	Time         int64   `json:"time"` // 成交时间（毫秒）
+	Symbol       string  `json:"symbol"`
+	OrderID      int64   `json:"order_id"`
+	Side         string  `json:"side"`          // BUY/SELL
+	PositionSide string  `json:"position_side"` // LONG/SHORT/BOTH
+	Price        float64 `json:"price"`
+	Quantity     float64 `json:"quantity"`
+	Fee          float64 `json:"fee"`
+	FeeAsset     string  `json:"fee_asset"`
+	RealizedPnL  float64 `json:"realized_pnl"` // 该笔成交的已实现盈亏（平仓成交才有）
+}
+
+// LimitCloser 支持限价（maker）平仓的交易器（可选实现）
+type LimitCloser interface {
+	// LimitCloseLong 限价平多仓
+	LimitCloseLong(symbol string, quantity, limitPrice float64) (map[string]interface{}, error)
+
+	// LimitCloseShort 限价平空仓
+	LimitCloseShort(symbol string, quantity, limitPrice float64) (map[string]interface{}, error)
+}
+
+// PositionModeSetter 支持切换单向/双向持仓模式的交易器（可选实现）
+type PositionModeSetter interface {
+	// SetPositionMode 设置持仓模式（true=双向持仓，同币种可同时持有多空）
+	SetPositionMode(dualSide bool) error
+}
+
+// UserDataStreamer 支持推送账户事件（用户数据流）的交易器（可选实现），未实现时仅靠每周期轮询同步
+type UserDataStreamer interface {
+	// StartUserDataStream 启动用户数据流，ctx 取消时关闭连接并关闭返回的通道
+	StartUserDataStream(ctx context.Context) (<-chan UserDataEvent, error)
+}
+
+// ClientOrderIDPlacer 支持携带 clientOrderId 开仓并按其查询订单的交易器（可选实现），
+// 下单失败重试前用于确认上一次请求是否已被交易所接受，避免网络抖动导致重复开仓
+type ClientOrderIDPlacer interface {
+	// OpenLongWithClientID 市价开多仓
+	OpenLongWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error)
+
+	// OpenShortWithClientID 市价开空仓
+	OpenShortWithClientID(symbol string, quantity float64, leverage int, clientOrderID string) (map[string]interface{}, error)
+
+	// LimitOpenLongWithClientID 限价开多仓
+	LimitOpenLongWithClientID(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error)
+
+	// LimitOpenShortWithClientID 限价开空仓
+	LimitOpenShortWithClientID(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error)
+
+	// GetOrderByClientID 按 clientOrderId 查询订单（含已成交/已撤销），订单不存在时返回 (nil, nil)
+	GetOrderByClientID(symbol, clientOrderID string) (map[string]interface{}, error)
+}
+
+// PostOnlyOpener 支持post-only（只做maker）限价开仓的交易器（可选实现），开仓订单类型为 limit_maker 时使用；
+// 会立即成交（吃单）的价格由交易所直接拒绝，不会以taker成交
+type PostOnlyOpener interface {
+	// PostOnlyOpenLong post-only限价开多仓，clientOrderID 为空时由交易所生成
+	PostOnlyOpenLong(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error)
+
+	// PostOnlyOpenShort post-only限价开空仓
+	PostOnlyOpenShort(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64, clientOrderID string) (map[string]interface{}, error)
 }
@@ -0,0 +1,132 @@
+package trader
+
+import (
+	"log"
+	"time"
+
+	"nofx/config"
+	"nofx/decision"
+)
+
+// 仓位计算模式
+const (
+	PositionSizingFixed = "fixed" // 使用AI给出的仓位
+	PositionSizingKelly = "kelly" // 分数Kelly仓位
+)
+
+const (
+	defaultKellyFraction        = 0.25      // 默认 1/4 Kelly
+	defaultKellyMinTrades       = 20        // 样本不足时回退固定仓位
+	defaultKellyRefreshInterval = time.Hour // 默认每小时重新计算
+	kellyLookbackCycles         = 1000      // 计算胜率/盈亏比时回看的周期数
+)
+
+// kellySizingState 缓存的Kelly仓位比例
+type kellySizingState struct {
+	fraction  float64   // 分数Kelly后的保证金占净值比例，<=0 表示无优势或样本不足
+	trades    int       // 计算时使用的历史交易数
+	updatedAt time.Time // 上次计算时间
+}
+
+// kellyFraction 计算完整Kelly比例 f* = W - (1-W)/R
+// winRatePct 为胜率（%），avgWin 为平均盈利，avgLoss 为平均亏损（负数或正数均可）
+func kellyFraction(winRatePct, avgWin, avgLoss float64) float64 {
+	if avgLoss < 0 {
+		avgLoss = -avgLoss
+	}
+	if avgWin <= 0 || avgLoss <= 0 {
+		return 0
+	}
+	winRate := winRatePct / 100
+	payoff := avgWin / avgLoss
+	return winRate - (1-winRate)/payoff
+}
+
+// refreshKellySizing 按配置间隔用历史表现重新计算Kelly比例
+func (at *AutoTrader) refreshKellySizing(now time.Time) {
+	interval := at.config.KellyRefreshInterval
+	if interval <= 0 {
+		interval = defaultKellyRefreshInterval
+	}
+	if !at.kellySizing.updatedAt.IsZero() && now.Sub(at.kellySizing.updatedAt) < interval {
+		return
+	}
+
+	at.kellySizing = kellySizingState{updatedAt: now}
+	performance, err := at.decisionLogger.AnalyzePerformance(kellyLookbackCycles)
+	if err != nil {
+		log.Printf("⚠️ Kelly仓位: 分析历史表现失败，使用固定仓位: %v", err)
+		return
+	}
+	at.kellySizing.trades = performance.TotalTrades
+
+	minTrades := at.config.KellyMinTrades
+	if minTrades <= 0 {
+		minTrades = defaultKellyMinTrades
+	}
+	if performance.TotalTrades < minTrades {
+		log.Printf("📐 Kelly仓位: 历史交易 %d 笔不足 %d 笔，使用固定仓位", performance.TotalTrades, minTrades)
+		return
+	}
+
+	multiplier := at.config.KellyFraction
+	if multiplier <= 0 {
+		multiplier = defaultKellyFraction
+	}
+	full := kellyFraction(performance.WinRate, performance.AvgWin, performance.AvgLoss)
+	if full > 0 {
+		at.kellySizing.fraction = full * multiplier
+	}
+	log.Printf("📐 Kelly仓位: 胜率 %.1f%%，平均盈利 %.2f / 平均亏损 %.2f，Kelly=%.3f，实际比例=%.3f",
+		performance.WinRate, performance.AvgWin, performance.AvgLoss, full, at.kellySizing.fraction)
+}
+
+// applyKellySizing 开仓前按分数Kelly调整保证金（PositionSizeUSD），并受账户分层风控上限约束
+// 样本不足或无正期望时保持AI给出的固定仓位
+func (at *AutoTrader) applyKellySizing(decision *decision.Decision) {
+	if at.config.PositionSizingMode != PositionSizingKelly {
+		return
+	}
+	switch decision.Action {
+	case "open_long", "open_short", "limit_open_long", "limit_open_short":
+	default:
+		return
+	}
+
+	at.refreshKellySizing(time.Now())
+	equity := at.lastAccountEquity
+	if at.kellySizing.fraction <= 0 || equity <= 0 {
+		return
+	}
+
+	size := equity * at.kellySizing.fraction
+	if at.globalConfig != nil {
+		if limit := riskTierMarginCap(&at.globalConfig.RiskManagement, equity, decision.Leverage); limit > 0 && size > limit {
+			size = limit
+		}
+	}
+
+	log.Printf("📐 Kelly仓位: %s %s 保证金 %.2f → %.2f (净值 %.2f × %.3f)",
+		decision.Symbol, decision.Action, decision.PositionSizeUSD, size, equity, at.kellySizing.fraction)
+	decision.PositionSizeUSD = size
+}
+
+// riskTierMarginCap 按账户分层风控返回单笔保证金上限，0 表示不限制
+// 激进模式以单笔风险预算上限作为保证金上限；标准/保守模式使用保证金使用率上限，保守模式再受名义价值上限约束
+func riskTierMarginCap(rm *config.RiskManagementConfig, equity float64, leverage int) float64 {
+	switch {
+	case equity <= 200:
+		return equity * rm.AggressiveMode.RiskUsdMaxPct / 100
+	case equity <= 1000:
+		return equity * rm.StandardMode.MarginUsageLimitPct / 100
+	default:
+		limit := equity * rm.ConservativeMode.MarginUsageLimitPct / 100
+		if rm.ConservativeMode.NotionalCapPct > 0 && leverage > 0 {
+			notionalLimit := equity * rm.ConservativeMode.NotionalCapPct / 100 / float64(leverage)
+			if limit <= 0 || notionalLimit < limit {
+				limit = notionalLimit
+			}
+		}
+		return limit
+	}
+}
@@ -0,0 +1,127 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"nofx/logger"
+)
+
+// maxAdverseExcursionLimit 获取币种的最大不利波动阈值（保证金百分比），0 表示关闭
+func (at *AutoTrader) maxAdverseExcursionLimit(symbol string) float64 {
+	if limit, ok := at.config.MaxAdverseExcursionPctSymbol[symbol]; ok {
+		if limit < 0 {
+			return 0
+		}
+		return limit
+	}
+	return at.config.MaxAdverseExcursionPct
+}
+
+// adverseExcursionPct 按标记价与开仓价计算未实现亏损占保证金的百分比（盈利时返回0）
+func adverseExcursionPct(side string, entry, mark, leverage float64) float64 {
+	if entry <= 0 || mark <= 0 {
+		return 0
+	}
+	if leverage <= 0 {
+		leverage = 1
+	}
+
+	move := (mark - entry) / entry
+	if strings.EqualFold(side, "short") {
+		move = -move
+	}
+	if move >= 0 {
+		return 0
+	}
+	return -move * leverage * 100
+}
+
+// enforceMaxAdverseExcursion 检查所有持仓，亏损达到阈值的直接市价平仓，返回自动平仓记录
+func (at *AutoTrader) enforceMaxAdverseExcursion() []logger.DecisionAction {
+	if at.config.MaxAdverseExcursionPct <= 0 && len(at.config.MaxAdverseExcursionPctSymbol) == 0 {
+		return nil
+	}
+
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		log.Printf("⚠️ 最大不利波动检查获取持仓失败: %v", err)
+		return nil
+	}
+
+	var events []logger.DecisionAction
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		side = strings.ToLower(side)
+		limit := at.maxAdverseExcursionLimit(symbol)
+		if limit <= 0 {
+			continue
+		}
+
+		posKey := symbol + "_" + side
+		entry, _ := pos["entryPrice"].(float64)
+		mark, _ := pos["markPrice"].(float64)
+		if mark <= 0 {
+			if mkt, err := at.getMarketData(symbol); err == nil {
+				mark = mkt.CurrentPrice
+			}
+		}
+		leverage, _ := pos["leverage"].(float64)
+		if leverage <= 0 {
+			leverage = float64(at.positionMemory[posKey].Leverage)
+		}
+		qty, _ := pos["positionAmt"].(float64)
+		if qty < 0 {
+			qty = -qty
+		}
+
+		lossPct := adverseExcursionPct(side, entry, mark, leverage)
+		if lossPct < limit {
+			continue
+		}
+
+		action := "close_long"
+		if side == "short" {
+			action = "close_short"
+		}
+		event := logger.DecisionAction{
+			Action:      action,
+			Symbol:      symbol,
+			Quantity:    qty,
+			Leverage:    int(leverage),
+			Price:       mark,
+			Timestamp:   time.Now(),
+			WasStopLoss: true,
+			Reason: fmt.Sprintf("max_adverse_excursion: 未实现亏损 %.2f%% 保证金 ≥ 阈值 %.2f%%（开仓 %.4f，标记价 %.4f）",
+				lossPct, limit, entry, mark),
+		}
+		log.Printf("🛑 %s %s 触发最大不利波动: 亏损 %.2f%% 保证金 ≥ %.2f%%，强制平仓", symbol, strings.ToUpper(side), lossPct, limit)
+
+		var order map[string]interface{}
+		if side == "short" {
+			order, err = at.trader.CloseShort(symbol, 0) // 0 = 全部平仓
+		} else {
+			order, err = at.trader.CloseLong(symbol, 0)
+		}
+		if err != nil {
+			log.Printf("❌ %s %s 强制平仓失败: %v", symbol, strings.ToUpper(side), err)
+			event.Error = err.Error()
+			event.Status = "ORDER_FAILED"
+			events = append(events, event)
+			continue
+		}
+		if orderID, ok := order["orderId"].(int64); ok {
+			event.OrderID = orderID
+		}
+		event.Success = true
+		event.Status = "EXECUTED"
+		events = append(events, event)
+
+		at.updateCooldownState(symbol, side)
+		at.clearPositionTracking(posKey)
+	}
+	return events
+}
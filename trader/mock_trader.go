@@ -14,6 +14,23 @@ type MockTrader struct {
 	nextOrderID    int64
 	orderStatuses  []string // 用于控制订单状态变化
 	statusIndex    int
+	positions      []map[string]interface{} // 预设持仓（GetPositions 返回）
+	stopOrderCalls int                      // SetStopLoss/SetTakeProfit 调用次数
+	stopOrders     []MockProtectiveOrder    // SetStopLoss/SetTakeProfit 调用记录
+	closeCalls     []string                 // CloseLong/CloseShort 调用记录（"BTCUSDT_long"）
+	cancelAllCalls []string                 // CancelAllOrders 调用记录（symbol）
+	dualSide       *bool                    // SetPositionMode 最近一次设置（nil 表示未调用）
+	tradeFills     []TradeFill              // 预设成交记录（GetTradeHistory 返回）
+}
+
+// MockProtectiveOrder 一次 SetStopLoss/SetTakeProfit 调用的参数
+type MockProtectiveOrder struct {
+	Kind         string // "stop_loss" / "take_profit"
+	Symbol       string
+	PositionSide string
+	Quantity     float64
+	Price        float64
+	ReduceOnly   bool
 }
 
 // MockOrder 模拟订单
@@ -22,7 +39,9 @@ type MockOrder struct {
 	Symbol         string
 	Side           string
 	Type           string
+	PositionSide   string  // LONG/SHORT（条件单使用）
 	Price          float64
+	StopPrice      float64 // 触发价（STOP_MARKET/TAKE_PROFIT_MARKET）
 	Quantity       float64
 	ExecutedQty    float64
 	AvgPrice       float64
@@ -60,9 +79,54 @@ func (t *MockTrader) GetBalance() (map[string]interface{}, error) {
 	}, nil
 }
 
+// SetPositions 预设持仓，用于测试持仓相关逻辑
+func (t *MockTrader) SetPositions(positions []map[string]interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.positions = positions
+}
+
+// AddOrder 预置一笔挂单（如上次运行遗留的止损/止盈条件单），返回订单ID
+func (t *MockTrader) AddOrder(order *MockOrder) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if order.OrderID == 0 {
+		order.OrderID = t.nextOrderID
+		t.nextOrderID++
+	}
+	if order.Status == "" {
+		order.Status = "NEW"
+	}
+	t.orders[order.OrderID] = order
+	return order.OrderID
+}
+
+// ProtectiveOrderCalls 返回 SetStopLoss/SetTakeProfit 的调用次数
+func (t *MockTrader) ProtectiveOrderCalls() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.stopOrderCalls
+}
+
+// ProtectiveOrders 返回 SetStopLoss/SetTakeProfit 的调用记录
+func (t *MockTrader) ProtectiveOrders() []MockProtectiveOrder {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]MockProtectiveOrder(nil), t.stopOrders...)
+}
+
+// CloseCalls 返回 CloseLong/CloseShort 调用记录（"symbol_side"）
+func (t *MockTrader) CloseCalls() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]string(nil), t.closeCalls...)
+}
+
 // GetPositions 模拟获取持仓
 func (t *MockTrader) GetPositions() ([]map[string]interface{}, error) {
-	return []map[string]interface{}{}, nil
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]map[string]interface{}{}, t.positions...), nil
 }
 
 // OpenLong 模拟开多仓
@@ -91,7 +155,14 @@ func (t *MockTrader) OpenShort(symbol string, quantity float64, leverage int) (m
 
 // CloseLong 模拟平多仓
 func (t *MockTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+	t.mu.Lock()
+	orderID := t.nextOrderID
+	t.nextOrderID++
+	t.closeCalls = append(t.closeCalls, symbol+"_long")
+	t.mu.Unlock()
+
 	return map[string]interface{}{
+		"orderId":  orderID,
 		"symbol":   symbol,
 		"side":     "SELL",
 		"quantity": quantity,
@@ -101,7 +172,14 @@ func (t *MockTrader) CloseLong(symbol string, quantity float64) (map[string]inte
 
 // CloseShort 模拟平空仓
 func (t *MockTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+	t.mu.Lock()
+	orderID := t.nextOrderID
+	t.nextOrderID++
+	t.closeCalls = append(t.closeCalls, symbol+"_short")
+	t.mu.Unlock()
+
 	return map[string]interface{}{
+		"orderId":  orderID,
 		"symbol":   symbol,
 		"side":     "BUY",
 		"quantity": quantity,
@@ -125,20 +203,56 @@ func (t *MockTrader) GetMarketPrice(symbol string) (float64, error) {
 }
 
 // SetStopLoss 模拟设置止损单
-func (t *MockTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+func (t *MockTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64, reduceOnly bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopOrderCalls++
+	t.stopOrders = append(t.stopOrders, MockProtectiveOrder{Kind: "stop_loss", Symbol: symbol, PositionSide: positionSide, Quantity: quantity, Price: stopPrice, ReduceOnly: reduceOnly})
 	return nil
 }
 
 // SetTakeProfit 模拟设置止盈单
-func (t *MockTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+func (t *MockTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64, reduceOnly bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopOrderCalls++
+	t.stopOrders = append(t.stopOrders, MockProtectiveOrder{Kind: "take_profit", Symbol: symbol, PositionSide: positionSide, Quantity: quantity, Price: takeProfitPrice, ReduceOnly: reduceOnly})
 	return nil
 }
 
 // CancelAllOrders 模拟取消所有挂单
 func (t *MockTrader) CancelAllOrders(symbol string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cancelAllCalls = append(t.cancelAllCalls, symbol)
+	return nil
+}
+
+// CancelAllCalls 返回 CancelAllOrders 调用记录
+func (t *MockTrader) CancelAllCalls() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]string(nil), t.cancelAllCalls...)
+}
+
+// SetPositionMode 模拟设置持仓模式
+func (t *MockTrader) SetPositionMode(dualSide bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.dualSide = &dualSide
 	return nil
 }
 
+// PositionMode 返回最近一次设置的持仓模式，未设置时 ok=false
+func (t *MockTrader) PositionMode() (dualSide bool, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.dualSide == nil {
+		return false, false
+	}
+	return *t.dualSide, true
+}
+
 // LimitOpenLong 模拟限价开多仓
 func (t *MockTrader) LimitOpenLong(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64) (map[string]interface{}, error) {
 	t.mu.Lock()
@@ -217,8 +331,10 @@ func (t *MockTrader) GetOpenOrders(symbol string) ([]map[string]interface{}, err
 				"orderId":     order.OrderID,
 				"symbol":      order.Symbol,
 				"side":        order.Side,
+				"positionSide": order.PositionSide,
 				"type":        order.Type,
 				"price":       order.Price,
+				"stopPrice":   order.StopPrice,
 				"quantity":    order.Quantity,
 				"executedQty": order.ExecutedQty,
 				"avgPrice":    order.AvgPrice,
@@ -298,3 +414,24 @@ func (t *MockTrader) CancelOrder(symbol string, orderID int64) error {
 func (t *MockTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
 	return fmt.Sprintf("%.6f", quantity), nil
 }
+
+// SetTradeFills 预设成交记录，用于测试成交对账相关逻辑
+func (t *MockTrader) SetTradeFills(fills []TradeFill) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tradeFills = fills
+}
+
+// GetTradeHistory 模拟获取成交记录
+func (t *MockTrader) GetTradeHistory(symbol string, since int64) ([]TradeFill, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	fills := make([]TradeFill, 0)
+	for _, fill := range t.tradeFills {
+		if fill.Symbol == symbol && fill.Time >= since {
+			fills = append(fills, fill)
+		}
+	}
+	return fills, nil
+}
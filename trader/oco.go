@@ -0,0 +1,131 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ProtectiveOrderIDs 同一持仓当前生效的止损/止盈条件单（OCO联动：一腿成交后立即撤销另一腿）
+type ProtectiveOrderIDs struct {
+	StopLossID   int64
+	TakeProfitID int64
+}
+
+// trackProtectiveOrders 下止损/止盈单或部分平仓后调用：从挂单中找出该持仓最新的止损单和止盈单作为联动对，
+// 同类旧条件单（被新单替换、数量已过期）一并撤销，避免仓位平掉后残留孤儿单
+func (at *AutoTrader) trackProtectiveOrders(symbol, side string) {
+	side = strings.ToUpper(side)
+	orders, err := at.trader.GetOpenOrders(symbol)
+	if err != nil {
+		log.Printf("  ⚠️ %s 获取挂单失败，无法记录止损/止盈联动: %v", symbol, err)
+		return
+	}
+
+	newest := func(a, b protectiveOrder) bool { return a.OrderID > b.OrderID }
+	stopLosses, takeProfits := classifyProtectiveOrders(orders, side)
+	sl, staleSL := pickProtectiveOrder(stopLosses, newest)
+	tp, staleTP := pickProtectiveOrder(takeProfits, newest)
+
+	for _, stale := range append(staleSL, staleTP...) {
+		if err := at.trader.CancelOrder(symbol, stale.OrderID); err != nil {
+			log.Printf("  ⚠️ 撤销 %s %s 旧条件单 %d 失败: %v", symbol, side, stale.OrderID, err)
+			continue
+		}
+		log.Printf("  🧹 已撤销 %s %s 被替换的旧条件单 %d (触发价 %.4f)", symbol, side, stale.OrderID, stale.StopPrice)
+	}
+
+	posKey := fmt.Sprintf("%s_%s", symbol, strings.ToLower(side))
+	if sl == nil && tp == nil {
+		delete(at.protectiveOrders, posKey)
+		return
+	}
+	ids := &ProtectiveOrderIDs{}
+	if sl != nil {
+		ids.StopLossID = sl.OrderID
+	}
+	if tp != nil {
+		ids.TakeProfitID = tp.OrderID
+	}
+	if at.protectiveOrders == nil {
+		at.protectiveOrders = make(map[string]*ProtectiveOrderIDs)
+	}
+	at.protectiveOrders[posKey] = ids
+}
+
+// handleProtectiveFill 条件单成交时撤销同一持仓的另一腿，返回该订单是否为被跟踪的止损/止盈单
+func (at *AutoTrader) handleProtectiveFill(symbol string, orderID int64) bool {
+	for posKey, ids := range at.protectiveOrders {
+		if !strings.HasPrefix(posKey, symbol+"_") {
+			continue
+		}
+
+		var filledLeg string
+		var sibling int64
+		switch orderID {
+		case ids.StopLossID:
+			filledLeg, sibling = "止损", ids.TakeProfitID
+		case ids.TakeProfitID:
+			filledLeg, sibling = "止盈", ids.StopLossID
+		default:
+			continue
+		}
+
+		delete(at.protectiveOrders, posKey)
+		if sibling <= 0 {
+			return true
+		}
+		if err := at.trader.CancelOrder(symbol, sibling); err != nil {
+			log.Printf("  ⚠️ %s %s单 %d 已成交，撤销联动条件单 %d 失败: %v", posKey, filledLeg, orderID, sibling, err)
+			return true
+		}
+		log.Printf("  🔗 %s %s单 %d 已成交，已撤销联动条件单 %d", posKey, filledLeg, orderID, sibling)
+		return true
+	}
+	return false
+}
+
+// checkLinkedProtectiveOrders 轮询兜底：被跟踪的条件单已不在挂单中时查询其状态，
+// 已成交则立即撤销另一腿；被撤销/过期则只清除该腿记录
+func (at *AutoTrader) checkLinkedProtectiveOrders() {
+	openBySymbol := make(map[string]map[int64]bool)
+	for posKey, ids := range at.protectiveOrders {
+		symbol := strings.SplitN(posKey, "_", 2)[0]
+		open, fetched := openBySymbol[symbol]
+		if !fetched {
+			orders, err := at.trader.GetOpenOrders(symbol)
+			if err != nil {
+				log.Printf("  ⚠️ %s 获取挂单失败，跳过止损/止盈联动检查: %v", symbol, err)
+				continue
+			}
+			open = make(map[int64]bool, len(orders))
+			for _, order := range orders {
+				if id, ok := order["orderId"].(int64); ok {
+					open[id] = true
+				}
+			}
+			openBySymbol[symbol] = open
+		}
+
+		for _, leg := range []*int64{&ids.StopLossID, &ids.TakeProfitID} {
+			orderID := *leg
+			if orderID <= 0 || open[orderID] {
+				continue
+			}
+			status, err := at.trader.GetOrderStatus(symbol, orderID)
+			if err != nil {
+				log.Printf("  ⚠️ 查询 %s 条件单 %d 状态失败: %v", symbol, orderID, err)
+				continue
+			}
+			if s, _ := status["status"].(string); s == "FILLED" {
+				at.handleProtectiveFill(symbol, orderID)
+				break
+			}
+			*leg = 0
+		}
+
+		if ids.StopLossID == 0 && ids.TakeProfitID == 0 {
+			delete(at.protectiveOrders, posKey)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"nofx/decision"
+	"nofx/market"
+)
+
+// alignOpenOrder 下单前按交易所过滤器对齐开仓参数（见 alignOrderToFilters）
+// 过滤器获取失败时保持原始数量，由交易所校验
+func (at *AutoTrader) alignOpenOrder(d *decision.Decision, quantity, price float64) (float64, error) {
+	filters, err := at.getSymbolFilters(d.Symbol)
+	if err != nil {
+		log.Printf("  ⚠️ 获取 %s 交易所过滤器失败，按原始数量下单: %v", d.Symbol, err)
+		return quantity, nil
+	}
+	return alignOrderToFilters(d, quantity, price, filters)
+}
+
+// alignOrderToFilters 数量向下取整到 StepSize，超过 MaxQty 时下调到最大数量，止损/止盈价格对齐 TickSize；
+// 取整后数量为0、低于 MinQty 或名义价值低于 MinNotional 时拒绝下单
+func alignOrderToFilters(d *decision.Decision, quantity, price float64, filters *market.SymbolFilters) (float64, error) {
+	aligned := market.FloorToStep(quantity, filters.StepSize)
+	if aligned <= 0 {
+		return 0, fmt.Errorf("❌ %s 下单数量 %.8f 按步长(%g)向下取整后为0，请增加仓位", d.Symbol, quantity, filters.StepSize)
+	}
+	if filters.MaxQty > 0 && aligned > filters.MaxQty {
+		maxQty := market.FloorToStep(filters.MaxQty, filters.StepSize)
+		log.Printf("  ⚠️ %s 下单数量 %.8f 超过交易所最大数量 %g，下调为 %.8f", d.Symbol, aligned, filters.MaxQty, maxQty)
+		aligned = maxQty
+	}
+	if filters.MinQty > 0 && aligned < filters.MinQty {
+		return 0, fmt.Errorf("❌ %s 下单数量 %.8f 低于交易所最小数量 %g，拒绝开仓", d.Symbol, aligned, filters.MinQty)
+	}
+	if notional := aligned * price; filters.MinNotional > 0 && notional < filters.MinNotional {
+		return 0, fmt.Errorf("❌ %s 名义价值 %.2f USDT 低于交易所最小名义价值 %.2f USDT，拒绝开仓", d.Symbol, notional, filters.MinNotional)
+	}
+
+	for _, p := range []*float64{&d.StopLoss, &d.TakeProfit, &d.TP1, &d.TP2, &d.TP3} {
+		if *p > 0 {
+			*p = market.RoundToTickSize(*p, filters.TickSize)
+		}
+	}
+	return aligned, nil
+}
+
+// roundPriceToTick 改单前将止损/止盈价格对齐到交易所 TickSize，过滤器获取失败时保持原价
+func (at *AutoTrader) roundPriceToTick(symbol string, price float64) float64 {
+	filters, err := at.getSymbolFilters(symbol)
+	if err != nil {
+		log.Printf("  ⚠️ 获取 %s 交易所过滤器失败，价格未按TickSize对齐: %v", symbol, err)
+		return price
+	}
+	return market.RoundToTickSize(price, filters.TickSize)
+}
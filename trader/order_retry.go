@@ -0,0 +1,194 @@
+package trader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/adshao/go-binance/v2/common"
+)
+
+const (
+	orderPlaceMaxAttempts = 3  // 开仓下单最多尝试次数（含首次）
+	clientOrderIDMaxLen   = 36 // 币安 clientOrderId 长度上限
+)
+
+// orderRetryBaseDelay 首次重试前的等待时间，之后每次翻倍（测试中可调小）
+var orderRetryBaseDelay = 500 * time.Millisecond
+
+// newClientOrderID 生成 clientOrderId：交易员ID-币种-毫秒时间戳。
+// 只保留币安允许的字符，超长时截短交易员ID部分，币种和时间戳始终完整
+func newClientOrderID(traderID, symbol string) string {
+	sanitize := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.', r == ':', r == '/':
+				return r
+			}
+			return '_'
+		}, s)
+	}
+	suffix := fmt.Sprintf("-%s-%d", sanitize(symbol), time.Now().UnixMilli())
+	id := sanitize(traderID)
+	if room := clientOrderIDMaxLen - len(suffix); len(id) > room {
+		if room < 0 {
+			room = 0
+		}
+		id = id[:room]
+	}
+	return id + suffix
+}
+
+// isRetryableOrderError 判断下单失败是否可能是临时性的（网络抖动/超时）；
+// 交易所明确拒绝（返回错误码，如保证金不足、参数错误）时重试无意义
+func isRetryableOrderError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *common.APIError
+	return !errors.As(err, &apiErr)
+}
+
+// orderLanded 按 clientOrderId 查到的订单是否仍有效（未被撤销/拒绝/过期）
+func orderLanded(order map[string]interface{}) bool {
+	if order == nil {
+		return false
+	}
+	status, _ := order["status"].(string)
+	switch status {
+	case "CANCELED", "REJECTED", "EXPIRED":
+		return false
+	}
+	return true
+}
+
+// placeOrderWithRetry 开仓下单：交易器支持 clientOrderId 时，临时性失败后按指数退避重试，
+// 每次重发前先按 clientOrderId 查询上一次请求是否已被交易所接受（仅响应丢失），已接受则直接返回该订单；
+// 未被接受时按实时持仓重新校验并发上限（退避期间其他超时的开仓可能已落地），已满则不再重发。
+// 重试耗尽后再确认一次，最后一次超时的请求若已落地同样按成功返回，以便调用方记录并计入占用。
+// 交易器不支持 clientOrderId 时只下单一次（无法判断是否重复，不做重试）
+func (at *AutoTrader) placeOrderWithRetry(symbol string, place func() (map[string]interface{}, error), placeWithID func(p ClientOrderIDPlacer, clientOrderID string) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	placer, ok := at.trader.(ClientOrderIDPlacer)
+	if !ok {
+		return place()
+	}
+
+	clientOrderID := newClientOrderID(at.id, symbol)
+	var lastErr error
+	for attempt := 1; attempt <= orderPlaceMaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(orderRetryBaseDelay << (attempt - 2))
+
+			existing, err := placer.GetOrderByClientID(symbol, clientOrderID)
+			if err != nil {
+				// 无法确认上一次请求的结果，不重发，避免重复开仓
+				lastErr = fmt.Errorf("确认订单 %s 状态失败: %w", clientOrderID, err)
+				log.Printf("  ⚠️ %s 第%d/%d次: %v", symbol, attempt, orderPlaceMaxAttempts, lastErr)
+				continue
+			}
+			if orderLanded(existing) {
+				log.Printf("  ✓ %s 上一次下单已被交易所接受 (clientOrderId: %s)，不再重发", symbol, clientOrderID)
+				return existing, nil
+			}
+			if positions, err := at.trader.GetPositions(); err == nil {
+				if err := at.checkConcurrentPositionCap(positions); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		order, err := placeWithID(placer, clientOrderID)
+		if err == nil {
+			return order, nil
+		}
+		lastErr = err
+		if !isRetryableOrderError(err) {
+			return nil, err
+		}
+		log.Printf("  ⚠️ %s 下单失败（第%d/%d次，clientOrderId: %s）: %v", symbol, attempt, orderPlaceMaxAttempts, clientOrderID, err)
+	}
+
+	time.Sleep(orderRetryBaseDelay << (orderPlaceMaxAttempts - 1))
+	if existing, err := placer.GetOrderByClientID(symbol, clientOrderID); err == nil && orderLanded(existing) {
+		log.Printf("  ✓ %s 最后一次下单已被交易所接受 (clientOrderId: %s)", symbol, clientOrderID)
+		return existing, nil
+	}
+	return nil, fmt.Errorf("下单重试%d次后仍失败: %w", orderPlaceMaxAttempts, lastErr)
+}
+
+// placeOpenLong 市价开多（带重试与 clientOrderId 去重）
+func (at *AutoTrader) placeOpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return at.placeOrderWithRetry(symbol,
+		func() (map[string]interface{}, error) { return at.trader.OpenLong(symbol, quantity, leverage) },
+		func(p ClientOrderIDPlacer, id string) (map[string]interface{}, error) {
+			return p.OpenLongWithClientID(symbol, quantity, leverage, id)
+		})
+}
+
+// placeOpenShort 市价开空（带重试与 clientOrderId 去重）
+func (at *AutoTrader) placeOpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return at.placeOrderWithRetry(symbol,
+		func() (map[string]interface{}, error) { return at.trader.OpenShort(symbol, quantity, leverage) },
+		func(p ClientOrderIDPlacer, id string) (map[string]interface{}, error) {
+			return p.OpenShortWithClientID(symbol, quantity, leverage, id)
+		})
+}
+
+// placeLimitOpenLong 限价开多（带重试与 clientOrderId 去重）
+func (at *AutoTrader) placeLimitOpenLong(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64) (map[string]interface{}, error) {
+	return at.placeOrderWithRetry(symbol,
+		func() (map[string]interface{}, error) {
+			return at.trader.LimitOpenLong(symbol, quantity, leverage, limitPrice, stopLoss)
+		},
+		func(p ClientOrderIDPlacer, id string) (map[string]interface{}, error) {
+			return p.LimitOpenLongWithClientID(symbol, quantity, leverage, limitPrice, stopLoss, id)
+		})
+}
+
+// placeLimitOpenShort 限价开空（带重试与 clientOrderId 去重）
+func (at *AutoTrader) placeLimitOpenShort(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64) (map[string]interface{}, error) {
+	return at.placeOrderWithRetry(symbol,
+		func() (map[string]interface{}, error) {
+			return at.trader.LimitOpenShort(symbol, quantity, leverage, limitPrice, stopLoss)
+		},
+		func(p ClientOrderIDPlacer, id string) (map[string]interface{}, error) {
+			return p.LimitOpenShortWithClientID(symbol, quantity, leverage, limitPrice, stopLoss, id)
+		})
+}
+
+// placePostOnlyOpenLong post-only限价开多（带重试与 clientOrderId 去重）；
+// 交易器不支持post-only时退化为普通限价单
+func (at *AutoTrader) placePostOnlyOpenLong(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64) (map[string]interface{}, error) {
+	opener, ok := at.trader.(PostOnlyOpener)
+	if !ok {
+		log.Printf("  ⚠️ 当前交易器不支持post-only开仓，%s 按普通限价单挂单", symbol)
+		return at.placeLimitOpenLong(symbol, quantity, leverage, limitPrice, stopLoss)
+	}
+	return at.placeOrderWithRetry(symbol,
+		func() (map[string]interface{}, error) {
+			return opener.PostOnlyOpenLong(symbol, quantity, leverage, limitPrice, stopLoss, "")
+		},
+		func(_ ClientOrderIDPlacer, id string) (map[string]interface{}, error) {
+			return opener.PostOnlyOpenLong(symbol, quantity, leverage, limitPrice, stopLoss, id)
+		})
+}
+
+// placePostOnlyOpenShort post-only限价开空（带重试与 clientOrderId 去重）；
+// 交易器不支持post-only时退化为普通限价单
+func (at *AutoTrader) placePostOnlyOpenShort(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64) (map[string]interface{}, error) {
+	opener, ok := at.trader.(PostOnlyOpener)
+	if !ok {
+		log.Printf("  ⚠️ 当前交易器不支持post-only开仓，%s 按普通限价单挂单", symbol)
+		return at.placeLimitOpenShort(symbol, quantity, leverage, limitPrice, stopLoss)
+	}
+	return at.placeOrderWithRetry(symbol,
+		func() (map[string]interface{}, error) {
+			return opener.PostOnlyOpenShort(symbol, quantity, leverage, limitPrice, stopLoss, "")
+		},
+		func(_ ClientOrderIDPlacer, id string) (map[string]interface{}, error) {
+			return opener.PostOnlyOpenShort(symbol, quantity, leverage, limitPrice, stopLoss, id)
+		})
+}
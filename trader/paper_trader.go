@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -44,6 +45,7 @@ type PaperTrader struct {
 	orders         map[int64]*PaperOrder
 	nextOrderID    int64
 	balances       map[string]float64
+	initialBalance float64 // 初始USDT余额（重置时恢复）
 	positions      []map[string]interface{}
 	fillDelayMinMs int  // 最小成交延迟(ms)
 	fillDelayMaxMs int  // 最大成交延迟(ms)
@@ -59,6 +61,7 @@ func NewPaperTrader() *PaperTrader {
 		orders:         make(map[int64]*PaperOrder),
 		nextOrderID:    2000000, // 从200万开始，与真实订单ID区分
 		balances:       map[string]float64{"USDT": 100000.0},
+		initialBalance: 100000.0,
 		positions:      make([]map[string]interface{}, 0),
 		fillDelayMinMs: 500,   // 默认500ms最小延迟
 		fillDelayMaxMs: 3000,  // 默认3秒最大延迟
@@ -74,6 +77,33 @@ func (t *PaperTrader) SetFillDelays(minMs, maxMs int) {
 	t.fillDelayMaxMs = maxMs
 }
 
+// SetInitialBalance 设置初始USDT余额并立即生效
+func (t *PaperTrader) SetInitialBalance(balance float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.initialBalance = balance
+	t.balances["USDT"] = balance
+}
+
+// Reset 重置为初始余额，取消所有挂单并清空订单和持仓
+func (t *PaperTrader) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// 标记未完成订单为已取消，让仍在运行的生命周期协程退出
+	for _, order := range t.orders {
+		if order.Status == "NEW" || order.Status == "PARTIALLY_FILLED" {
+			order.Status = "CANCELED"
+			order.UpdateTime = time.Now().UnixMilli()
+		}
+	}
+
+	t.orders = make(map[int64]*PaperOrder)
+	t.balances = map[string]float64{"USDT": t.initialBalance}
+	t.positions = make([]map[string]interface{}, 0)
+	log.Printf("📝 纸交易器已重置，余额恢复为 %.2f USDT", t.initialBalance)
+}
+
 // SetNeverFillRatio 设置永不成交订单比例
 func (t *PaperTrader) SetNeverFillRatio(ratio float64) {
 	t.mu.Lock()
@@ -268,6 +298,10 @@ func (t *PaperTrader) GetBalance() (map[string]interface{}, error) {
 			"total":    amount,
 		}
 	}
+	// 与真实交易器一致的账户字段，供构建交易上下文使用
+	result["totalWalletBalance"] = t.balances["USDT"]
+	result["availableBalance"] = t.balances["USDT"]
+	result["totalUnrealizedProfit"] = 0.0
 	return result, nil
 }
 
@@ -342,12 +376,12 @@ func (t *PaperTrader) GetMarketPrice(symbol string) (float64, error) {
 }
 
 // SetStopLoss 设置止损单
-func (t *PaperTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64) error {
+func (t *PaperTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64, reduceOnly bool) error {
 	return nil
 }
 
 // SetTakeProfit 设置止盈单
-func (t *PaperTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64) error {
+func (t *PaperTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64, reduceOnly bool) error {
 	return nil
 }
 
@@ -432,6 +466,51 @@ func (t *PaperTrader) LimitOpenShort(symbol string, quantity float64, leverage i
 	}, nil
 }
 
+// LimitCloseLong 限价平多仓
+func (t *PaperTrader) LimitCloseLong(symbol string, quantity, limitPrice float64) (map[string]interface{}, error) {
+	return t.placeLimitClose(symbol, "SELL", quantity, limitPrice)
+}
+
+// LimitCloseShort 限价平空仓
+func (t *PaperTrader) LimitCloseShort(symbol string, quantity, limitPrice float64) (map[string]interface{}, error) {
+	return t.placeLimitClose(symbol, "BUY", quantity, limitPrice)
+}
+
+// placeLimitClose 挂限价平仓单（与开仓单共用订单生命周期模拟）
+func (t *PaperTrader) placeLimitClose(symbol, side string, quantity, limitPrice float64) (map[string]interface{}, error) {
+	t.mu.Lock()
+	orderID := t.nextOrderID
+	t.nextOrderID++
+
+	order := &PaperOrder{
+		OrderID:    orderID,
+		Symbol:     symbol,
+		Side:       side,
+		Type:       "LIMIT",
+		Price:      limitPrice,
+		Quantity:   quantity,
+		Status:     "NEW",
+		CreateTime: time.Now().UnixMilli(),
+		UpdateTime: time.Now().UnixMilli(),
+	}
+	t.orders[orderID] = order
+	t.mu.Unlock()
+
+	log.Printf("📝 纸交易限价平仓: %s %s %.6f @ %.4f (订单ID: %d)", symbol, side, quantity, limitPrice, orderID)
+
+	t.startOrderLifecycle(order)
+
+	return map[string]interface{}{
+		"symbol":   symbol,
+		"orderId":  orderID,
+		"side":     side,
+		"type":     "LIMIT",
+		"price":    limitPrice,
+		"quantity": quantity,
+		"status":   "NEW",
+	}, nil
+}
+
 // GetOpenOrders 获取挂单
 func (t *PaperTrader) GetOpenOrders(symbol string) ([]map[string]interface{}, error) {
 	t.mu.RLock()
@@ -503,6 +582,29 @@ func (t *PaperTrader) CancelOrder(symbol string, orderID int64) error {
 	return nil
 }
 
+// GetTradeHistory 以已成交（含部分成交）的纸交易订单作为成交记录（无手续费和已实现盈亏）
+func (t *PaperTrader) GetTradeHistory(symbol string, since int64) ([]TradeFill, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	fills := make([]TradeFill, 0)
+	for _, order := range t.orders {
+		if order.Symbol != symbol || order.ExecutedQty <= 0 || order.UpdateTime < since {
+			continue
+		}
+		fills = append(fills, TradeFill{
+			Time:     order.UpdateTime,
+			Symbol:   order.Symbol,
+			OrderID:  order.OrderID,
+			Side:     order.Side,
+			Price:    order.AvgPrice,
+			Quantity: order.ExecutedQty,
+		})
+	}
+	sort.Slice(fills, func(i, j int) bool { return fills[i].Time < fills[j].Time })
+	return fills, nil
+}
+
 // FormatQuantity 格式化数量
 func (t *PaperTrader) FormatQuantity(symbol string, quantity float64) (string, error) {
 	return fmt.Sprintf("%.6f", quantity), nil
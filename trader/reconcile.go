@@ -0,0 +1,197 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// trailingStageTolerance 推断跟踪止损阶段时的价格容差（交易所价格精度取整、安全间隔调整）
+const trailingStageTolerance = 0.001 // 0.1%
+
+// protectiveOrder 交易所上已存在的止损/止盈条件单
+type protectiveOrder struct {
+	OrderID   int64
+	StopPrice float64
+}
+
+// reconcileProtectiveOrders 启动对账：识别交易所上已存在的止损/止盈条件单并纳入跟踪
+// 同一持仓存在多笔止损（或止盈）时只保留一笔并撤销其余，避免重启后叠加挂单；
+// 已有止损价用于推断跟踪止损所处阶段
+func (at *AutoTrader) reconcileProtectiveOrders() error {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return fmt.Errorf("获取持仓失败: %w", err)
+	}
+
+	ordersBySymbol := make(map[string][]map[string]interface{})
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		entry, _ := pos["entryPrice"].(float64)
+		if symbol == "" || side == "" {
+			continue
+		}
+		side = strings.ToUpper(side)
+
+		orders, fetched := ordersBySymbol[symbol]
+		if !fetched {
+			orders, err = at.trader.GetOpenOrders(symbol)
+			if err != nil {
+				log.Printf("  ⚠️ 对账: 获取 %s 挂单失败: %v", symbol, err)
+				continue
+			}
+			ordersBySymbol[symbol] = orders
+		}
+
+		stopLosses, takeProfits := classifyProtectiveOrders(orders, side)
+		if len(stopLosses) == 0 && len(takeProfits) == 0 {
+			continue
+		}
+
+		sl, slDuplicates := pickProtectiveOrder(stopLosses, func(a, b protectiveOrder) bool {
+			// 止损保留最紧的一笔（多单最高、空单最低），跟踪止损只会向有利方向移动
+			if side == "LONG" {
+				return a.StopPrice > b.StopPrice
+			}
+			return a.StopPrice < b.StopPrice
+		})
+		tp, tpDuplicates := pickProtectiveOrder(takeProfits, func(a, b protectiveOrder) bool {
+			return a.OrderID > b.OrderID // 止盈保留最近下的一笔
+		})
+
+		for _, dup := range append(slDuplicates, tpDuplicates...) {
+			if err := at.trader.CancelOrder(symbol, dup.OrderID); err != nil {
+				log.Printf("  ⚠️ 对账: 撤销 %s 重复条件单 %d 失败: %v", symbol, dup.OrderID, err)
+				continue
+			}
+			log.Printf("  🧹 对账: 已撤销 %s %s 重复条件单 %d (触发价 %.4f)", symbol, side, dup.OrderID, dup.StopPrice)
+		}
+
+		posKey := fmt.Sprintf("%s_%s", symbol, strings.ToLower(side))
+		tgt, ok := at.positionTargets[posKey]
+		if !ok || tgt == nil {
+			tgt = &PositionTarget{}
+			at.positionTargets[posKey] = tgt
+		}
+		if tp != nil {
+			tgt.CurrentTP = tp.StopPrice
+			if tgt.TP3 <= 0 {
+				tgt.TP3 = tp.StopPrice
+			}
+		}
+		if sl != nil {
+			tgt.CurrentSL = sl.StopPrice
+			if stage := inferTrailingStage(entry, side, tgt, sl.StopPrice); stage > tgt.Stage {
+				tgt.Stage = stage
+			}
+		}
+
+		// 纳入止损/止盈联动跟踪
+		ids := &ProtectiveOrderIDs{}
+		if sl != nil {
+			ids.StopLossID = sl.OrderID
+		}
+		if tp != nil {
+			ids.TakeProfitID = tp.OrderID
+		}
+		if at.protectiveOrders == nil {
+			at.protectiveOrders = make(map[string]*ProtectiveOrderIDs)
+		}
+		at.protectiveOrders[posKey] = ids
+
+		log.Printf("  🔗 对账: 已接管 %s %s 条件单 (SL=%.4f TP=%.4f stage=%d, 撤销重复 %d 笔)",
+			symbol, side, tgt.CurrentSL, tgt.TP3, tgt.Stage, len(slDuplicates)+len(tpDuplicates))
+	}
+
+	return nil
+}
+
+// classifyProtectiveOrders 从挂单中筛选属于指定方向持仓的止损单和止盈单
+func classifyProtectiveOrders(orders []map[string]interface{}, side string) (stopLosses, takeProfits []protectiveOrder) {
+	// 平多为卖单，平空为买单
+	closeSide := "SELL"
+	if side == "SHORT" {
+		closeSide = "BUY"
+	}
+
+	for _, order := range orders {
+		orderSide, _ := order["side"].(string)
+		if positionSide, _ := order["positionSide"].(string); positionSide != "" && positionSide != "BOTH" {
+			if !strings.EqualFold(positionSide, side) {
+				continue
+			}
+		} else if !strings.EqualFold(orderSide, closeSide) {
+			continue
+		}
+
+		stopPrice, _ := order["stopPrice"].(float64)
+		if stopPrice <= 0 {
+			stopPrice, _ = order["price"].(float64)
+		}
+		if stopPrice <= 0 {
+			continue
+		}
+		orderID, _ := order["orderId"].(int64)
+		po := protectiveOrder{OrderID: orderID, StopPrice: stopPrice}
+
+		orderType, _ := order["type"].(string)
+		switch strings.ToUpper(orderType) {
+		case "STOP_MARKET", "STOP":
+			stopLosses = append(stopLosses, po)
+		case "TAKE_PROFIT_MARKET", "TAKE_PROFIT":
+			takeProfits = append(takeProfits, po)
+		}
+	}
+	return stopLosses, takeProfits
+}
+
+// pickProtectiveOrder 按 better 选出保留的一笔，其余作为重复单返回
+func pickProtectiveOrder(orders []protectiveOrder, better func(a, b protectiveOrder) bool) (*protectiveOrder, []protectiveOrder) {
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	keep := 0
+	for i := 1; i < len(orders); i++ {
+		if better(orders[i], orders[keep]) {
+			keep = i
+		}
+	}
+	kept := orders[keep]
+	duplicates := make([]protectiveOrder, 0, len(orders)-1)
+	for i, order := range orders {
+		if i != keep {
+			duplicates = append(duplicates, order)
+		}
+	}
+	return &kept, duplicates
+}
+
+// inferTrailingStage 根据已生效的止损价反推跟踪止损阶段（与 computeTrailingSL 的阶梯一致）
+// stage1=保本(entry)，stage2=(entry+TP1)/2，stage3=(TP1+TP2)/2；TP未知的阶段无法确认
+func inferTrailingStage(entry float64, side string, tgt *PositionTarget, stopPrice float64) int {
+	if entry <= 0 || stopPrice <= 0 || tgt == nil {
+		return 0
+	}
+
+	// atOrBetter 止损是否已达到（或优于）某一阶梯价
+	atOrBetter := func(level float64) bool {
+		tolerance := level * trailingStageTolerance
+		if strings.ToUpper(side) == "SHORT" {
+			return stopPrice <= level+tolerance
+		}
+		return stopPrice >= level-tolerance
+	}
+
+	stage := 0
+	if atOrBetter(entry) {
+		stage = 1
+	}
+	if stage == 1 && tgt.TP1 > 0 && atOrBetter((entry+tgt.TP1)/2) {
+		stage = 2
+	}
+	if stage == 2 && tgt.TP2 > 0 && atOrBetter((tgt.TP1+tgt.TP2)/2) {
+		stage = 3
+	}
+	return stage
+}
@@ -0,0 +1,57 @@
+package trader
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"nofx/config"
+)
+
+// RuntimeStateStore 交易员运行状态持久化（*config.Database 实现）
+type RuntimeStateStore interface {
+	GetTraderRuntimeState(traderID string) (*config.TraderRuntimeState, error)
+	SaveTraderRuntimeState(state *config.TraderRuntimeState) error
+}
+
+// SetRuntimeStateStore 设置运行状态存储，并恢复上次保存的调用次数/启动时间/日盈亏重置时间/风控暂停
+func (at *AutoTrader) SetRuntimeStateStore(store RuntimeStateStore) {
+	at.runtimeStore = store
+	if store == nil {
+		return
+	}
+
+	state, err := store.GetTraderRuntimeState(at.id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("⚠️ [%s] 加载运行状态失败，按新交易员启动: %v", at.name, err)
+		}
+		return
+	}
+
+	at.callCount = state.CallCount
+	if !state.StartTime.IsZero() {
+		at.startTime = state.StartTime
+	}
+	if !state.LastResetTime.IsZero() {
+		at.lastResetTime = state.LastResetTime
+	}
+	at.stopUntil = state.StopUntil
+	log.Printf("♻️ [%s] 已恢复运行状态: 周期 #%d, 启动于 %s", at.name, at.callCount, at.startTime.Format("2006-01-02 15:04:05"))
+}
+
+// saveRuntimeState 保存当前运行状态（未设置存储时忽略）
+func (at *AutoTrader) saveRuntimeState() {
+	if at.runtimeStore == nil {
+		return
+	}
+	state := &config.TraderRuntimeState{
+		TraderID:      at.id,
+		CallCount:     at.callCount,
+		StartTime:     at.startTime,
+		LastResetTime: at.lastResetTime,
+		StopUntil:     at.stopUntil,
+	}
+	if err := at.runtimeStore.SaveTraderRuntimeState(state); err != nil {
+		log.Printf("⚠️ [%s] 保存运行状态失败: %v", at.name, err)
+	}
+}
@@ -363,14 +363,14 @@ func TestScenario_PartialFill_Behavior(t *testing.T) {
 		{
 			name:             "CancelOnPartialFill=false",
 			cancelOnPartial:  false,
-			expectedFinalQty: 0.1, // 完全成交 (实际计算出的数量)
+			expectedFinalQty: 0.099, // 完全成交 (5000/50000.1 按步长0.001向下取整)
 			expectedStatus:   "FILLED",
 			expectedAttempts: 1,
 		},
 		{
 			name:             "CancelOnPartialFill=true",
 			cancelOnPartial:  true,
-			expectedFinalQty: 0.04, // 部分成交后取消，但已有成交部分
+			expectedFinalQty: 0.0396, // 部分成交后取消，但已有成交部分（0.099 × 40%）
 			expectedStatus:   "PARTIALLY_FILLED",
 			expectedAttempts: 1,
 		},
@@ -0,0 +1,128 @@
+package trader
+
+import (
+	"log"
+	"sync"
+)
+
+// shadowOrderIDBase 模拟订单ID起点（远大于交易所真实订单ID，便于区分）
+const shadowOrderIDBase int64 = 9_000_000_000_000
+
+// shadowTrader 影子模式交易器：余额/持仓/行情等只读接口直连真实交易所，
+// 所有下单、撤单、止盈止损、杠杆设置均不发送，只记录日志并按标记价返回模拟成交
+type shadowTrader struct {
+	Trader // 真实交易所交易器（仅用于只读查询）
+
+	mu          sync.Mutex
+	nextOrderID int64
+	orders      map[int64]map[string]interface{} // 模拟订单（供 GetOrderStatus 查询）
+}
+
+func newShadowTrader(inner Trader) *shadowTrader {
+	return &shadowTrader{
+		Trader:      inner,
+		nextOrderID: shadowOrderIDBase,
+		orders:      make(map[int64]map[string]interface{}),
+	}
+}
+
+// simulateFill 记录一笔按标记价（限价单按限价）立即成交的模拟订单
+func (t *shadowTrader) simulateFill(action, symbol, side string, quantity, price float64) map[string]interface{} {
+	if price <= 0 {
+		if mark, err := t.Trader.GetMarketPrice(symbol); err == nil {
+			price = mark
+		}
+	}
+
+	t.mu.Lock()
+	t.nextOrderID++
+	orderID := t.nextOrderID
+	order := map[string]interface{}{
+		"orderId":     orderID,
+		"symbol":      symbol,
+		"side":        side,
+		"status":      "FILLED",
+		"avgPrice":    price,
+		"price":       price,
+		"origQty":     quantity,
+		"executedQty": quantity,
+		"simulated":   true,
+	}
+	t.orders[orderID] = order
+	t.mu.Unlock()
+
+	log.Printf("  🕶 [影子模式] 模拟%s %s 数量 %.6f @ %.4f（未发送订单，模拟订单ID %d）", action, symbol, quantity, price, orderID)
+	return order
+}
+
+func (t *shadowTrader) OpenLong(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.simulateFill("开多", symbol, "BUY", quantity, 0), nil
+}
+
+func (t *shadowTrader) OpenShort(symbol string, quantity float64, leverage int) (map[string]interface{}, error) {
+	return t.simulateFill("开空", symbol, "SELL", quantity, 0), nil
+}
+
+func (t *shadowTrader) CloseLong(symbol string, quantity float64) (map[string]interface{}, error) {
+	return t.simulateFill("平多", symbol, "SELL", quantity, 0), nil
+}
+
+func (t *shadowTrader) CloseShort(symbol string, quantity float64) (map[string]interface{}, error) {
+	return t.simulateFill("平空", symbol, "BUY", quantity, 0), nil
+}
+
+func (t *shadowTrader) LimitOpenLong(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64) (map[string]interface{}, error) {
+	return t.simulateFill("限价开多", symbol, "BUY", quantity, limitPrice), nil
+}
+
+func (t *shadowTrader) LimitOpenShort(symbol string, quantity float64, leverage int, limitPrice, stopLoss float64) (map[string]interface{}, error) {
+	return t.simulateFill("限价开空", symbol, "SELL", quantity, limitPrice), nil
+}
+
+func (t *shadowTrader) LimitCloseLong(symbol string, quantity, limitPrice float64) (map[string]interface{}, error) {
+	return t.simulateFill("限价平多", symbol, "SELL", quantity, limitPrice), nil
+}
+
+func (t *shadowTrader) LimitCloseShort(symbol string, quantity, limitPrice float64) (map[string]interface{}, error) {
+	return t.simulateFill("限价平空", symbol, "BUY", quantity, limitPrice), nil
+}
+
+func (t *shadowTrader) SetLeverage(symbol string, leverage int) error {
+	log.Printf("  🕶 [影子模式] 跳过设置杠杆: %s %dx", symbol, leverage)
+	return nil
+}
+
+func (t *shadowTrader) SetMarginMode(symbol string, isCrossMargin bool) error {
+	return nil
+}
+
+func (t *shadowTrader) SetStopLoss(symbol string, positionSide string, quantity, stopPrice float64, reduceOnly bool) error {
+	log.Printf("  🕶 [影子模式] 跳过设置止损: %s %s @ %.4f", symbol, positionSide, stopPrice)
+	return nil
+}
+
+func (t *shadowTrader) SetTakeProfit(symbol string, positionSide string, quantity, takeProfitPrice float64, reduceOnly bool) error {
+	log.Printf("  🕶 [影子模式] 跳过设置止盈: %s %s @ %.4f", symbol, positionSide, takeProfitPrice)
+	return nil
+}
+
+func (t *shadowTrader) CancelAllOrders(symbol string) error {
+	log.Printf("  🕶 [影子模式] 跳过撤销全部挂单: %s", symbol)
+	return nil
+}
+
+func (t *shadowTrader) CancelOrder(symbol string, orderID int64) error {
+	log.Printf("  🕶 [影子模式] 跳过撤单: %s #%d", symbol, orderID)
+	return nil
+}
+
+// GetOrderStatus 模拟订单返回本地记录，其余订单查询真实交易所
+func (t *shadowTrader) GetOrderStatus(symbol string, orderID int64) (map[string]interface{}, error) {
+	t.mu.Lock()
+	order, ok := t.orders[orderID]
+	t.mu.Unlock()
+	if ok {
+		return order, nil
+	}
+	return t.Trader.GetOrderStatus(symbol, orderID)
+}
@@ -0,0 +1,129 @@
+package trader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+
+	"nofx/config"
+	"nofx/logger"
+	"nofx/market"
+)
+
+// SimulationConfig 单周期模拟配置
+type SimulationConfig struct {
+	Trader     AutoTraderConfig                 // 交易员配置（强制使用纸交易，AI 指向本地模拟接口）
+	Global     *config.Config                   // 全局配置（分层风控等），为nil时使用空配置
+	AIResponse string                           // 模拟AI的完整回复（思维链 + JSON决策数组）
+	Filters    map[string]*market.SymbolFilters // 交易所过滤器，未设置的币种使用默认值
+}
+
+// simulationMarketData 按币种返回固定行情的数据提供者
+type simulationMarketData struct {
+	data map[string]*market.Data
+}
+
+func (p *simulationMarketData) Get(symbol string) (*market.Data, error) {
+	if data, ok := p.data[market.Normalize(symbol)]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("模拟行情中没有 %s", symbol)
+}
+
+// simulationFilters 固定的交易所过滤器提供者
+type simulationFilters struct {
+	filters map[string]*market.SymbolFilters
+}
+
+func (p *simulationFilters) GetSymbolFilters(symbol string) (*market.SymbolFilters, error) {
+	if filters, ok := p.filters[market.Normalize(symbol)]; ok {
+		return filters, nil
+	}
+	return &market.SymbolFilters{
+		TickSize:    0.1,
+		StepSize:    0.001,
+		MinNotional: 10.0,
+	}, nil
+}
+
+// SimulateCycle 用模拟行情、确定性纸交易和固定AI回复运行一个完整决策周期，返回本周期的决策记录。
+// 行情/过滤器提供者在返回前恢复默认；决策记录写入当前工作目录下的 decision_logs/<交易员ID>，
+// 测试中应先切换到临时目录
+func SimulateCycle(cfg SimulationConfig, marketData map[string]*market.Data, behavior *DeterministicBehavior) (*logger.DecisionRecord, error) {
+	normalized := make(map[string]*market.Data, len(marketData))
+	for symbol, data := range marketData {
+		normalized[market.Normalize(symbol)] = data
+	}
+	market.SetMarketDataProvider(&simulationMarketData{data: normalized})
+	defer market.ResetMarketDataProvider()
+
+	filters := make(map[string]*market.SymbolFilters, len(cfg.Filters))
+	for symbol, f := range cfg.Filters {
+		filters[market.Normalize(symbol)] = f
+	}
+	market.SetSymbolFiltersProvider(&simulationFilters{filters: filters})
+	defer market.ResetSymbolFiltersProvider()
+
+	// 本地 OpenAI 兼容接口，每次调用都返回同一段回复
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"content": cfg.AIResponse}}},
+		})
+	}))
+	defer server.Close()
+
+	traderCfg := cfg.Trader
+	traderCfg.TraderMode = "paper"
+	traderCfg.AIModel = "custom"
+	traderCfg.CustomAPIURL = server.URL
+	traderCfg.CustomAPIKey = "simulate"
+	traderCfg.CustomModelName = "simulate"
+	traderCfg.FallbackAIModel = ""
+	if traderCfg.ID == "" {
+		traderCfg.ID = "simulate"
+	}
+	if traderCfg.InitialBalance <= 0 {
+		traderCfg.InitialBalance = 10000
+	}
+	// 未指定币种时以模拟行情中的币种为候选，避免访问币种池接口
+	if len(traderCfg.TradingCoins) == 0 && len(traderCfg.DefaultCoins) == 0 {
+		for symbol := range normalized {
+			traderCfg.TradingCoins = append(traderCfg.TradingCoins, symbol)
+		}
+		sort.Strings(traderCfg.TradingCoins)
+	}
+
+	globalConfig := cfg.Global
+	if globalConfig == nil {
+		globalConfig = &config.Config{}
+	}
+
+	at, err := NewAutoTrader(traderCfg, globalConfig)
+	if err != nil {
+		return nil, fmt.Errorf("创建模拟交易员失败: %w", err)
+	}
+	at.mcpClient.SetUseStream(false)
+
+	paper, ok := at.trader.(*PaperTrader)
+	if !ok {
+		return nil, fmt.Errorf("模拟交易员未使用纸交易")
+	}
+	paper.SetInitialBalance(traderCfg.InitialBalance)
+	paper.SetDeterministicBehavior(behavior)
+
+	cycleErr := at.runCycle()
+
+	records, err := at.decisionLogger.GetLatestRecords(1)
+	if err != nil {
+		return nil, fmt.Errorf("读取决策记录失败: %w", err)
+	}
+	if len(records) == 0 {
+		if cycleErr != nil {
+			return nil, cycleErr
+		}
+		return nil, fmt.Errorf("决策周期未生成决策记录")
+	}
+	return records[0], cycleErr
+}
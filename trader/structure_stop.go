@@ -0,0 +1,105 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+
+	"nofx/decision"
+	"nofx/logger"
+	"nofx/market"
+)
+
+// 开仓止损放置方式
+const (
+	StopLossPlacementAI        = "ai"        // 使用AI给出的止损
+	StopLossPlacementStructure = "structure" // 用4h结构止损替换AI止损
+	StopLossPlacementValidate  = "validate"  // AI止损落在结构止损内侧（更紧）时放宽到结构止损
+)
+
+const defaultStructureStopATRBuffer = 0.5 // 默认在支撑/压力区外侧留 0.5×ATR14(4h)
+
+// computeStructureStop 计算结构止损：多单放在入场价下方最近4h支撑区下沿再减ATR缓冲，
+// 空单放在入场价上方最近4h压力区上沿再加ATR缓冲。返回止损价和依据，缺少区间或ATR时返回 false
+func computeStructureStop(data *market.Data, side string, entry, atrBuffer float64) (float64, string, bool) {
+	if data == nil || data.MidTermSeries4h == nil || data.MidTermSeries4h.ATR14 <= 0 || entry <= 0 {
+		return 0, "", false
+	}
+	buffer := atrBuffer * data.MidTermSeries4h.ATR14
+
+	switch side {
+	case "long":
+		zone, ok := market.NearestZone(data.FourHourZones, "support", entry)
+		if !ok {
+			return 0, "", false
+		}
+		stop := zone.Lower - buffer
+		if stop <= 0 || stop >= entry {
+			return 0, "", false
+		}
+		return stop, fmt.Sprintf("structure_4h_support(%.4f~%.4f)-%.2fATR", zone.Lower, zone.Upper, atrBuffer), true
+	case "short":
+		zone, ok := market.NearestZone(data.FourHourZones, "resistance", entry)
+		if !ok {
+			return 0, "", false
+		}
+		stop := zone.Upper + buffer
+		if stop <= entry {
+			return 0, "", false
+		}
+		return stop, fmt.Sprintf("structure_4h_resistance(%.4f~%.4f)+%.2fATR", zone.Lower, zone.Upper, atrBuffer), true
+	}
+	return 0, "", false
+}
+
+// applyStructureStopLoss 开仓前按配置用结构止损替换或校验AI止损，并在 StopLossSource 中记录依据
+func (at *AutoTrader) applyStructureStopLoss(decision *decision.Decision, actionRecord *logger.DecisionAction) {
+	mode := at.config.StopLossPlacement
+	if mode != StopLossPlacementStructure && mode != StopLossPlacementValidate {
+		return
+	}
+
+	var side string
+	switch decision.Action {
+	case "open_long", "limit_open_long":
+		side = "long"
+	case "open_short", "limit_open_short":
+		side = "short"
+	default:
+		return
+	}
+	actionRecord.StopLossSource = "ai"
+
+	marketData, err := at.getMarketData(decision.Symbol)
+	if err != nil {
+		log.Printf("  ⚠ %s 结构止损: 获取市场数据失败，保留AI止损: %v", decision.Symbol, err)
+		return
+	}
+
+	entry := marketData.CurrentPrice
+	if decision.LimitPrice > 0 && (decision.Action == "limit_open_long" || decision.Action == "limit_open_short") {
+		entry = decision.LimitPrice
+	}
+
+	atrBuffer := at.config.StructureStopATRBuffer
+	if atrBuffer <= 0 {
+		atrBuffer = defaultStructureStopATRBuffer
+	}
+
+	stop, basis, ok := computeStructureStop(marketData, side, entry, atrBuffer)
+	if !ok {
+		log.Printf("  ℹ %s 结构止损: 入场价 %.4f 附近无可用4h支撑/压力区，保留AI止损 %.4f", decision.Symbol, entry, decision.StopLoss)
+		return
+	}
+
+	if mode == StopLossPlacementValidate && decision.StopLoss > 0 {
+		// AI止损已在结构止损外侧（更宽）时保留
+		if (side == "long" && decision.StopLoss <= stop) || (side == "short" && decision.StopLoss >= stop) {
+			actionRecord.StopLossSource = "ai_validated:" + basis
+			return
+		}
+	}
+
+	log.Printf("  📐 %s 结构止损: AI止损 %.4f → %.4f (%s)", decision.Symbol, decision.StopLoss, stop, basis)
+	decision.StopLoss = stop
+	actionRecord.StopLossSource = basis
+}
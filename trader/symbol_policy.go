@@ -0,0 +1,64 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+
+	"nofx/decision"
+	"nofx/logger"
+	"nofx/market"
+)
+
+// 决策币种不在本周期分析集合内时的处理方式
+const (
+	OffListSymbolLenient = "lenient" // 按需补拉该币种市场数据后继续执行
+	OffListSymbolStrict  = "strict"  // 直接拒绝该决策
+)
+
+// 决策币种数据来源
+const (
+	symbolDataSourceCycle     = "cycle"
+	symbolDataSourceLazyFetch = "lazy_fetch"
+)
+
+// validateDecisionSymbol 校验开仓决策的币种是否在本周期已分析的集合内
+// strict 模式直接拒绝；lenient 模式补拉该币种数据并加入本周期缓存，补拉失败同样拒绝
+// 平仓、撤单、调整止损止盈等动作针对已有持仓/挂单，其币种不一定在候选集合内，不做限制
+func (at *AutoTrader) validateDecisionSymbol(decision *decision.Decision, actionRecord *logger.DecisionAction) (bool, string) {
+	switch decision.Action {
+	case "hold", "wait", "":
+		return true, ""
+	}
+	// 未经过完整周期（如手动执行）时没有分析集合，不做校验
+	if at.cycleMarketData == nil {
+		return true, ""
+	}
+
+	symbol := market.Normalize(decision.Symbol)
+	if data, ok := at.cycleMarketData[symbol]; ok && data != nil {
+		actionRecord.SymbolDataSource = symbolDataSourceCycle
+		return true, ""
+	}
+
+	switch decision.Action {
+	case "open_long", "open_short", "limit_open_long", "limit_open_short":
+	default:
+		return true, ""
+	}
+
+	if at.config.OffListSymbolPolicy == OffListSymbolStrict {
+		return false, fmt.Sprintf("%s 不在本周期分析的币种内，严格模式拒绝 %s", decision.Symbol, decision.Action)
+	}
+
+	data, err := at.getMarketData(decision.Symbol)
+	if err != nil {
+		return false, fmt.Sprintf("%s 不在本周期分析的币种内，补拉市场数据失败: %v", decision.Symbol, err)
+	}
+	at.cycleMarketData[symbol] = data
+	if decision.CurrentPrice <= 0 {
+		decision.CurrentPrice = data.CurrentPrice
+	}
+	actionRecord.SymbolDataSource = symbolDataSourceLazyFetch
+	log.Printf("  ⚠️ %s 不在本周期分析的币种内，已按需补拉市场数据（价格 %.4f）", decision.Symbol, data.CurrentPrice)
+	return true, ""
+}
@@ -0,0 +1,128 @@
+package trader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	timeSyncInterval   = 30 * time.Minute // 服务器时间同步间隔
+	timeSyncRetryDelay = time.Minute      // 同步失败后的最短重试间隔
+	timeSyncTimeout    = 5 * time.Second  // 单次同步请求超时
+	maxClockDrift      = time.Second      // 本地时钟偏差超过该值时告警
+)
+
+// exchangeClock 交易所服务器时间同步：记录本地时钟与服务器时钟的偏移，
+// 签名请求的 timestamp 按偏移校正，避免本地时钟漂移导致交易所拒单（-1021）
+type exchangeClock struct {
+	name            string
+	fetchServerTime func(ctx context.Context) (int64, error) // 返回服务器时间（毫秒）
+	onSync          func(offsetMs int64)                     // 同步成功后回调（如写入SDK客户端的 TimeOffset）
+
+	mu          sync.Mutex
+	offsetMs    int64 // 本地时间 - 服务器时间（毫秒）
+	lastSync    time.Time
+	lastAttempt time.Time
+}
+
+func newExchangeClock(name string, fetchServerTime func(ctx context.Context) (int64, error), onSync func(offsetMs int64)) *exchangeClock {
+	return &exchangeClock{name: name, fetchServerTime: fetchServerTime, onSync: onSync}
+}
+
+// Sync 获取一次服务器时间并更新偏移（以请求往返的中点作为本地时间）
+func (c *exchangeClock) Sync(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.syncLocked(ctx)
+}
+
+func (c *exchangeClock) syncLocked(ctx context.Context) (int64, error) {
+	c.lastAttempt = time.Now()
+	before := time.Now().UnixMilli()
+	serverTime, err := c.fetchServerTime(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("获取%s服务器时间失败: %w", c.name, err)
+	}
+	after := time.Now().UnixMilli()
+
+	offset := (before+after)/2 - serverTime
+	c.offsetMs = offset
+	c.lastSync = time.Now()
+	if c.onSync != nil {
+		c.onSync(offset)
+	}
+
+	drift := time.Duration(offset) * time.Millisecond
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > maxClockDrift {
+		log.Printf("⚠️ [%s] 本地时钟与交易所服务器相差 %v，已按偏移校正签名时间戳，建议校准系统时间", c.name, drift)
+	}
+	return offset, nil
+}
+
+// maybeSync 距上次同步超过 timeSyncInterval 时重新同步（失败后至少间隔 timeSyncRetryDelay 再试）
+func (c *exchangeClock) maybeSync() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.lastSync) < timeSyncInterval || time.Since(c.lastAttempt) < timeSyncRetryDelay {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeSyncTimeout)
+	defer cancel()
+	if _, err := c.syncLocked(ctx); err != nil {
+		log.Printf("⚠️ %v，继续使用上次偏移 %dms", err, c.offsetMs)
+	}
+}
+
+// OffsetMs 当前偏移（本地时间 - 服务器时间，毫秒）
+func (c *exchangeClock) OffsetMs() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offsetMs
+}
+
+// NowMs 按服务器时间校正后的当前毫秒时间戳（必要时先同步）
+func (c *exchangeClock) NowMs() int64 {
+	c.maybeSync()
+	return time.Now().UnixMilli() - c.OffsetMs()
+}
+
+// httpServerTimeFetcher Binance 兼容的 /fapi/v1/time 接口（返回 {"serverTime": 毫秒}）
+func httpServerTimeFetcher(client *http.Client, url string) func(ctx context.Context) (int64, error) {
+	return func(ctx context.Context) (int64, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return 0, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return 0, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		}
+
+		var result struct {
+			ServerTime int64 `json:"serverTime"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return 0, fmt.Errorf("解析服务器时间失败: %w", err)
+		}
+		return result.ServerTime, nil
+	}
+}
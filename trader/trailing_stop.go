@@ -0,0 +1,188 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"nofx/decision"
+	"nofx/logger"
+)
+
+// computeContinuousTrailingSL 按当前标记价计算连续移动止损：距离为 TrailingATRMult×ATR14(4h) 或 TrailingPct%，
+// 未启用、缺少ATR或价格无效时返回0
+func computeContinuousTrailingSL(side string, tgt *PositionTarget, markPrice, atr float64) float64 {
+	if tgt == nil || markPrice <= 0 {
+		return 0
+	}
+
+	var distance float64
+	switch {
+	case tgt.TrailingATRMult > 0:
+		if atr <= 0 {
+			return 0
+		}
+		distance = tgt.TrailingATRMult * atr
+	case tgt.TrailingPct > 0:
+		distance = markPrice * tgt.TrailingPct / 100
+	default:
+		return 0
+	}
+
+	switch strings.ToUpper(side) {
+	case "LONG":
+		if markPrice-distance <= 0 {
+			return 0
+		}
+		return markPrice - distance
+	case "SHORT":
+		return markPrice + distance
+	}
+	return 0
+}
+
+// tighterStop 返回两个止损中更紧的一个（多单取高、空单取低），0 表示未设置
+func tighterStop(side string, a, b float64) float64 {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 {
+		return a
+	}
+	if strings.ToUpper(side) == "SHORT" {
+		return math.Min(a, b)
+	}
+	return math.Max(a, b)
+}
+
+// trailingStopDescription 移动止损配置的简短描述（日志/提示词），未启用时返回空
+func trailingStopDescription(tgt *PositionTarget) string {
+	switch {
+	case tgt == nil:
+		return ""
+	case tgt.TrailingATRMult > 0:
+		return fmt.Sprintf("%gATR", tgt.TrailingATRMult)
+	case tgt.TrailingPct > 0:
+		return fmt.Sprintf("%g%%", tgt.TrailingPct)
+	}
+	return ""
+}
+
+// executeUpdateTrailingStopWithRecord 为已有持仓启用/调整连续移动止损。
+// 只记录配置，止损由 autoCheckAndUpdateStopLoss 每周期按标记价重新计算（与TP阶段止损合并，同一周期只改一次单）
+func (at *AutoTrader) executeUpdateTrailingStopWithRecord(dec *decision.Decision, actionRecord *logger.DecisionAction) error {
+	if (dec.TrailingATRMult > 0) == (dec.TrailingPct > 0) {
+		return fmt.Errorf("update_trailing_stop 需要提供 trailing_atr_mult 或 trailing_pct（二选一）")
+	}
+
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return fmt.Errorf("获取持仓失败: %w", err)
+	}
+
+	var side string
+	for _, pos := range positions {
+		if sym, _ := pos["symbol"].(string); sym == dec.Symbol {
+			side, _ = pos["side"].(string)
+			break
+		}
+	}
+	if side == "" {
+		return fmt.Errorf("当前没有 %s 的持仓，不能 update_trailing_stop", dec.Symbol)
+	}
+
+	if dec.TrailingATRMult > 0 {
+		data, err := at.getMarketData(dec.Symbol)
+		if err != nil {
+			return fmt.Errorf("获取行情失败: %w", err)
+		}
+		if data.MidTermSeries4h == nil || data.MidTermSeries4h.ATR14 <= 0 {
+			return fmt.Errorf("%s 缺少4h ATR14，无法按ATR倍数设置移动止损", dec.Symbol)
+		}
+	}
+
+	posKey := fmt.Sprintf("%s_%s", dec.Symbol, strings.ToLower(side))
+	tgt := at.positionTargets[posKey]
+	if tgt == nil {
+		// 没有TP记录的持仓也允许移动止损（阶段逻辑因TP为0不会触发）
+		tgt = &PositionTarget{}
+		at.positionTargets[posKey] = tgt
+	}
+	tgt.TrailingATRMult = dec.TrailingATRMult
+	tgt.TrailingPct = dec.TrailingPct
+
+	actionRecord.Status = "EXECUTED"
+	actionRecord.Reason = fmt.Sprintf("移动止损距离 %s，下个检查周期起按标记价只收紧不放宽", trailingStopDescription(tgt))
+	log.Printf("  ✓ %s %s 已启用移动止损: %s", dec.Symbol, strings.ToUpper(side), trailingStopDescription(tgt))
+	return nil
+}
+
+// tp3TrailSettings 到达TP3后移动止损的距离配置（交易员配置优先，其次全局配置），均为0表示TP3照常止盈平仓
+func (at *AutoTrader) tp3TrailSettings() (atrMult, pct float64) {
+	if at.config.TP3TrailATRMult > 0 || at.config.TP3TrailPct > 0 {
+		return at.config.TP3TrailATRMult, at.config.TP3TrailPct
+	}
+	if at.globalConfig != nil {
+		return at.globalConfig.TP3TrailATRMult, at.globalConfig.TP3TrailPct
+	}
+	return 0, 0
+}
+
+// prepareTP3Trailing 启用TP3后移动止损时处理止盈单与移动止损的切换：
+//   - 到达TP2后撤销止盈单：止盈单通常挂在TP3，价格触及TP3时交易所会先于本地检查平掉剩余仓位
+//   - 到达TP3后为剩余仓位启用移动止损（AI已通过 update_trailing_stop 设置时沿用其距离）并记录切换
+//
+// 按当前标记价算不出有效移动止损（如ATR缺失）时保留止盈单不切换，避免剩余仓位只剩静态止损
+func (at *AutoTrader) prepareTP3Trailing(symbol, side string, tgt *PositionTarget, newStage int, markPrice, atr float64) {
+	if tgt == nil || tgt.TrailingAfterTP3 || newStage < 2 || newStage <= tgt.Stage {
+		return
+	}
+	atrMult, pct := at.tp3TrailSettings()
+	if atrMult <= 0 && pct <= 0 {
+		return
+	}
+
+	trail := &PositionTarget{TrailingATRMult: tgt.TrailingATRMult, TrailingPct: tgt.TrailingPct}
+	if trail.TrailingATRMult <= 0 && trail.TrailingPct <= 0 {
+		trail.TrailingATRMult = atrMult
+		if atrMult <= 0 || atr <= 0 {
+			trail.TrailingATRMult, trail.TrailingPct = 0, pct // ATR缺失时退回百分比
+		}
+	}
+	if computeContinuousTrailingSL(side, trail, markPrice, atr) <= 0 {
+		log.Printf("  ⚠️ %s %s 无法计算TP3后移动止损，保留止盈单", symbol, strings.ToUpper(side))
+		return
+	}
+
+	if err := at.cancelTakeProfitOrders(symbol, side); err != nil {
+		log.Printf("  ⚠️ %s %s 撤销止盈单失败，保留原止盈: %v", symbol, strings.ToUpper(side), err)
+		return
+	}
+	tgt.CurrentTP = 0
+
+	if newStage < 3 {
+		log.Printf("  🏃 %s %s 到达TP2，已撤销止盈单，到达TP3后剩余仓位改为移动止损", symbol, strings.ToUpper(side))
+		return
+	}
+	tgt.TrailingATRMult = trail.TrailingATRMult
+	tgt.TrailingPct = trail.TrailingPct
+	tgt.TrailingAfterTP3 = true
+	log.Printf("  🏃 %s %s 到达TP3，不再止盈平仓，剩余仓位改为移动止损: %s",
+		symbol, strings.ToUpper(side), trailingStopDescription(tgt))
+}
+
+// cancelTakeProfitOrders 撤销指定持仓方向的全部止盈条件单
+func (at *AutoTrader) cancelTakeProfitOrders(symbol, side string) error {
+	orders, err := at.trader.GetOpenOrders(symbol)
+	if err != nil {
+		return fmt.Errorf("获取挂单失败: %w", err)
+	}
+	_, takeProfits := classifyProtectiveOrders(orders, strings.ToUpper(side))
+	for _, tp := range takeProfits {
+		if err := at.trader.CancelOrder(symbol, tp.OrderID); err != nil {
+			return fmt.Errorf("撤销止盈单 %d 失败: %w", tp.OrderID, err)
+		}
+	}
+	return nil
+}
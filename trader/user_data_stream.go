@@ -0,0 +1,342 @@
+package trader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+)
+
+// 用户数据流事件类型
+const (
+	UserDataOrderUpdate   = "order_update"   // 订单状态变化（币安 ORDER_TRADE_UPDATE）
+	UserDataAccountUpdate = "account_update" // 余额/持仓变化（币安 ACCOUNT_UPDATE）
+)
+
+const (
+	userStreamKeepaliveInterval = 30 * time.Minute // listenKey 保活间隔（币安60分钟过期）
+	userStreamReconnectDelay    = 5 * time.Second  // 断线/获取listenKey失败后的重连间隔
+	userStreamRequestTimeout    = 10 * time.Second // listenKey 相关REST请求超时
+	userStreamEventBuffer       = 64               // 事件通道缓冲
+)
+
+// UserDataPosition ACCOUNT_UPDATE 中变化后的持仓
+type UserDataPosition struct {
+	Symbol     string
+	Side       string  // "long" / "short"，单向持仓模式下数量为0时为空
+	Amount     float64 // 持仓数量（绝对值），0 表示已平仓
+	EntryPrice float64
+}
+
+// UserDataEvent 交易所推送的账户事件（与交易所无关的精简结构）
+type UserDataEvent struct {
+	Type       string // UserDataOrderUpdate / UserDataAccountUpdate
+	Time       int64  // 事件时间（毫秒）
+	Symbol     string
+	OrderID    int64
+	Side       string  // BUY / SELL
+	OrderType  string  // 原始订单类型，如 LIMIT / STOP_MARKET / TAKE_PROFIT_MARKET
+	Status     string  // NEW / PARTIALLY_FILLED / FILLED / CANCELED / EXPIRED
+	FilledQty  float64 // 累计成交数量
+	AvgPrice   float64 // 成交均价
+	ReduceOnly bool
+	Positions  []UserDataPosition // 仅 UserDataAccountUpdate
+}
+
+// StartUserDataStream 启动币安合约用户数据流：获取listenKey并定期保活，断线或listenKey过期时自动重连，
+// ctx 取消时关闭listenKey并关闭返回的通道
+func (t *FuturesTrader) StartUserDataStream(ctx context.Context) (<-chan UserDataEvent, error) {
+	listenKey, err := t.startListenKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan UserDataEvent, userStreamEventBuffer)
+	go t.runUserDataStream(ctx, listenKey, events)
+	return events, nil
+}
+
+func (t *FuturesTrader) startListenKey(ctx context.Context) (string, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, userStreamRequestTimeout)
+	defer cancel()
+	listenKey, err := t.client.NewStartUserStreamService().Do(reqCtx)
+	if err != nil {
+		return "", fmt.Errorf("获取listenKey失败: %w", err)
+	}
+	return listenKey, nil
+}
+
+// runUserDataStream 维持websocket连接直到 ctx 取消
+func (t *FuturesTrader) runUserDataStream(ctx context.Context, listenKey string, events chan<- UserDataEvent) {
+	defer close(events)
+
+	keepalive := time.NewTicker(userStreamKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		if listenKey == "" {
+			key, err := t.startListenKey(ctx)
+			if err != nil {
+				log.Printf("⚠️ 用户数据流: %v", err)
+				if !sleepCtx(ctx, userStreamReconnectDelay) {
+					return
+				}
+				continue
+			}
+			listenKey = key
+		}
+
+		expired := make(chan struct{}, 1)
+		handler := func(event *futures.WsUserDataEvent) {
+			if event.Event == futures.UserDataEventTypeListenKeyExpired {
+				select {
+				case expired <- struct{}{}:
+				default:
+				}
+				return
+			}
+			converted, ok := convertBinanceUserDataEvent(event)
+			if !ok {
+				return
+			}
+			t.invalidateAccountCache()
+			select {
+			case events <- converted:
+			case <-ctx.Done():
+			}
+		}
+		errHandler := func(err error) {
+			log.Printf("⚠️ 用户数据流错误: %v", err)
+		}
+
+		doneC, stopC, err := futures.WsUserDataServe(listenKey, handler, errHandler)
+		if err != nil {
+			log.Printf("⚠️ 用户数据流连接失败: %v", err)
+			if !sleepCtx(ctx, userStreamReconnectDelay) {
+				return
+			}
+			continue
+		}
+		log.Printf("🔌 用户数据流已连接")
+
+		connected := true
+		for connected {
+			select {
+			case <-ctx.Done():
+				close(stopC)
+				<-doneC
+				t.closeListenKey(listenKey)
+				log.Printf("🔌 用户数据流已关闭")
+				return
+			case <-keepalive.C:
+				reqCtx, cancel := context.WithTimeout(ctx, userStreamRequestTimeout)
+				err := t.client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(reqCtx)
+				cancel()
+				if err != nil {
+					log.Printf("⚠️ listenKey 保活失败，重新建立用户数据流: %v", err)
+					close(stopC)
+					<-doneC
+					listenKey = ""
+					connected = false
+				}
+			case <-expired:
+				log.Printf("⚠️ listenKey 已过期，重新建立用户数据流")
+				close(stopC)
+				<-doneC
+				listenKey = ""
+				connected = false
+			case <-doneC:
+				log.Printf("⚠️ 用户数据流连接断开，%v 后重连", userStreamReconnectDelay)
+				connected = false
+			}
+		}
+
+		if !sleepCtx(ctx, userStreamReconnectDelay) {
+			t.closeListenKey(listenKey)
+			return
+		}
+	}
+}
+
+func (t *FuturesTrader) closeListenKey(listenKey string) {
+	if listenKey == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), userStreamRequestTimeout)
+	defer cancel()
+	if err := t.client.NewCloseUserStreamService().ListenKey(listenKey).Do(ctx); err != nil {
+		log.Printf("⚠️ 关闭listenKey失败: %v", err)
+	}
+}
+
+// invalidateAccountCache 账户发生变化时使余额/持仓缓存失效，下次查询直接请求交易所
+func (t *FuturesTrader) invalidateAccountCache() {
+	t.balanceCacheMutex.Lock()
+	t.balanceCacheTime = time.Time{}
+	t.balanceCacheMutex.Unlock()
+
+	t.positionsCacheMutex.Lock()
+	t.positionsCacheTime = time.Time{}
+	t.positionsCacheMutex.Unlock()
+}
+
+// convertBinanceUserDataEvent 转换币安推送事件，只保留订单和持仓变化
+func convertBinanceUserDataEvent(event *futures.WsUserDataEvent) (UserDataEvent, bool) {
+	switch event.Event {
+	case futures.UserDataEventTypeOrderTradeUpdate:
+		order := event.OrderTradeUpdate
+		filledQty, _ := strconv.ParseFloat(order.AccumulatedFilledQty, 64)
+		avgPrice, _ := strconv.ParseFloat(order.AveragePrice, 64)
+		return UserDataEvent{
+			Type:       UserDataOrderUpdate,
+			Time:       event.Time,
+			Symbol:     order.Symbol,
+			OrderID:    order.ID,
+			Side:       string(order.Side),
+			OrderType:  string(order.OriginalType),
+			Status:     string(order.Status),
+			FilledQty:  filledQty,
+			AvgPrice:   avgPrice,
+			ReduceOnly: order.IsReduceOnly || order.IsClosingPosition,
+		}, true
+	case futures.UserDataEventTypeAccountUpdate:
+		positions := make([]UserDataPosition, 0, len(event.AccountUpdate.Positions))
+		for _, pos := range event.AccountUpdate.Positions {
+			amount, _ := strconv.ParseFloat(pos.Amount, 64)
+			entryPrice, _ := strconv.ParseFloat(pos.EntryPrice, 64)
+			side := strings.ToLower(string(pos.Side))
+			if side == "both" || side == "" {
+				switch {
+				case amount > 0:
+					side = "long"
+				case amount < 0:
+					side = "short"
+				default:
+					side = ""
+				}
+			}
+			if amount < 0 {
+				amount = -amount
+			}
+			positions = append(positions, UserDataPosition{
+				Symbol:     pos.Symbol,
+				Side:       side,
+				Amount:     amount,
+				EntryPrice: entryPrice,
+			})
+		}
+		return UserDataEvent{
+			Type:      UserDataAccountUpdate,
+			Time:      event.Time,
+			Positions: positions,
+		}, true
+	}
+	return UserDataEvent{}, false
+}
+
+// sleepCtx 等待 d 或 ctx 取消，ctx 取消时返回 false
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// useUserDataStream 是否启用用户数据流（交易员配置优先，其次全局配置）
+func (at *AutoTrader) useUserDataStream() bool {
+	if at.config.UserDataStream {
+		return true
+	}
+	return at.globalConfig != nil && at.globalConfig.UserDataStream
+}
+
+// startUserDataStream 启用且交易器支持时启动用户数据流，否则返回 nil（仅靠每周期轮询同步）
+func (at *AutoTrader) startUserDataStream(ctx context.Context) <-chan UserDataEvent {
+	if !at.useUserDataStream() {
+		return nil
+	}
+	streamer, ok := at.trader.(UserDataStreamer)
+	if !ok {
+		log.Printf("ℹ️ [%s] 交易平台不支持用户数据流，使用轮询同步订单状态", at.name)
+		return nil
+	}
+	events, err := streamer.StartUserDataStream(ctx)
+	if err != nil {
+		log.Printf("⚠️ [%s] 用户数据流启动失败，使用轮询同步订单状态: %v", at.name, err)
+		return nil
+	}
+	log.Printf("📡 [%s] 用户数据流已启用", at.name)
+	return events
+}
+
+// consumeUserDataEvents 按顺序处理推送事件直到通道关闭，每个事件持有 cycleMu 处理，与决策周期互斥
+func (at *AutoTrader) consumeUserDataEvents(events <-chan UserDataEvent) {
+	for event := range events {
+		at.cycleMu.Lock()
+		at.handleUserDataEvent(event)
+		at.cycleMu.Unlock()
+	}
+	log.Printf("ℹ️ [%s] 用户数据流已关闭，继续使用轮询同步", at.name)
+}
+
+// handleUserDataEvent 处理交易所推送的账户事件（调用方需持有 cycleMu）
+// 限价单成交/撤销时立即同步 pendingOrders，止盈单成交时立即检查移动止损阶段
+func (at *AutoTrader) handleUserDataEvent(event UserDataEvent) {
+	switch event.Type {
+	case UserDataOrderUpdate:
+		for posKey, pendingOrder := range at.pendingOrders {
+			if pendingOrder.Symbol != event.Symbol || pendingOrder.OrderID != event.OrderID {
+				continue
+			}
+			switch event.Status {
+			case "FILLED", "CANCELED", "EXPIRED", "REJECTED":
+				at.resolvePendingOrder(posKey, pendingOrder)
+			}
+			return
+		}
+
+		if event.Status == "FILLED" {
+			at.handleProtectiveFill(event.Symbol, event.OrderID) // 止损/止盈一腿成交，立即撤销另一腿
+		}
+		if isTakeProfitFill(event) {
+			log.Printf("  📡 %s 止盈单成交 (订单ID: %d, 均价: %.4f)，立即检查止损阶段",
+				event.Symbol, event.OrderID, event.AvgPrice)
+			if err := at.autoCheckAndUpdateStopLoss(); err != nil {
+				log.Printf("⚠️ 自动止损检查失败: %v", err)
+			}
+		}
+	case UserDataAccountUpdate:
+		now := time.Now().UnixMilli()
+		for _, pos := range event.Positions {
+			if pos.Amount <= 0 || pos.Side == "" {
+				continue // 平仓由下一周期的持仓对比统一处理（撤销孤儿委托、记录自动平仓）
+			}
+			posKey := pos.Symbol + "_" + pos.Side
+			if _, exists := at.positionFirstSeenTime[posKey]; !exists {
+				at.positionFirstSeenTime[posKey] = now
+			}
+		}
+	}
+}
+
+// isTakeProfitFill 是否为止盈/减仓单成交
+func isTakeProfitFill(event UserDataEvent) bool {
+	if event.Status != "FILLED" && event.Status != "PARTIALLY_FILLED" {
+		return false
+	}
+	switch event.OrderType {
+	case "TAKE_PROFIT", "TAKE_PROFIT_MARKET":
+		return true
+	case "LIMIT":
+		return event.ReduceOnly
+	}
+	return false
+}
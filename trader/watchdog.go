@@ -0,0 +1,179 @@
+package trader
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+)
+
+const defaultWatchdogStopDistancePct = 0.5 // tighten_stops 默认止损距离（%）
+
+// markCycleSuccess 记录决策周期成功完成，并重置看门狗触发状态
+func (at *AutoTrader) markCycleSuccess() {
+	at.watchdogMu.Lock()
+	defer at.watchdogMu.Unlock()
+	at.lastCycleSuccess = time.Now()
+	at.watchdogFired = false
+}
+
+// runWatchdog 定期检查决策循环是否停滞，直到 stopChan 关闭
+func (at *AutoTrader) runWatchdog(stopChan chan struct{}) {
+	interval := at.config.WatchdogTimeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			at.checkWatchdog(now)
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+// checkWatchdog 超过 WatchdogTimeout 未成功完成周期时告警并执行配置的动作（每次停滞只触发一次）
+// flatten/tighten_stops 会读写持仓跟踪并下单，须持有 cycleMu 与决策周期（及用户数据流事件）互斥：
+// 周期仍在执行（可能正在开仓）时推迟到下次检查，不标记为已触发。返回本次是否触发
+func (at *AutoTrader) checkWatchdog(now time.Time) bool {
+	timeout := at.config.WatchdogTimeout
+	if timeout <= 0 {
+		return false
+	}
+
+	action := at.config.WatchdogAction
+	if action == "" {
+		action = "alert"
+	}
+
+	if action != "alert" {
+		if !at.cycleMu.TryLock() {
+			at.watchdogMu.Lock()
+			pending := now.Sub(at.lastCycleSuccess) >= timeout && !at.watchdogFired
+			at.watchdogMu.Unlock()
+			if pending {
+				log.Printf("⏳ [%s] 看门狗: 决策周期仍在执行，%s 推迟到下次检查", at.name, action)
+			}
+			return false
+		}
+		defer at.cycleMu.Unlock()
+	}
+
+	at.watchdogMu.Lock()
+	stalled := now.Sub(at.lastCycleSuccess)
+	if stalled < timeout || at.watchdogFired {
+		at.watchdogMu.Unlock()
+		return false
+	}
+	at.watchdogFired = true
+	at.watchdogMu.Unlock()
+
+	log.Printf("🚨 [%s] 看门狗告警: 已 %v 未成功完成决策周期（阈值 %v），执行动作: %s",
+		at.name, stalled.Round(time.Second), timeout, action)
+
+	var err error
+	switch action {
+	case "flatten":
+		err = at.watchdogFlatten()
+	case "tighten_stops":
+		err = at.watchdogTightenStops()
+	case "alert":
+	default:
+		err = fmt.Errorf("未知的看门狗动作: %s", action)
+	}
+	if err != nil {
+		log.Printf("❌ [%s] 看门狗动作 %s 执行失败: %v", at.name, action, err)
+	}
+	return true
+}
+
+// watchdogFlatten 市价平掉全部持仓并清理持仓跟踪（调用方需持有 cycleMu）
+func (at *AutoTrader) watchdogFlatten() error {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return fmt.Errorf("获取持仓失败: %w", err)
+	}
+
+	var failed []string
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		side = strings.ToLower(side)
+
+		if side == "long" {
+			_, err = at.trader.CloseLong(symbol, 0) // 0 = 全部平仓
+		} else {
+			_, err = at.trader.CloseShort(symbol, 0)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s %s: %v", symbol, side, err))
+			continue
+		}
+		at.clearPositionTracking(symbol + "_" + side)
+		log.Printf("  🛑 看门狗已平仓: %s %s", symbol, side)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("部分持仓平仓失败: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// watchdogTightenStops 将各持仓止损收紧到距当前价 WatchdogStopDistancePct%（只往有利方向移动，调用方需持有 cycleMu）
+func (at *AutoTrader) watchdogTightenStops() error {
+	distancePct := at.config.WatchdogStopDistancePct
+	if distancePct <= 0 {
+		distancePct = defaultWatchdogStopDistancePct
+	}
+
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return fmt.Errorf("获取持仓失败: %w", err)
+	}
+
+	var failed []string
+	for _, pos := range positions {
+		symbol, _ := pos["symbol"].(string)
+		side, _ := pos["side"].(string)
+		side = strings.ToUpper(side)
+		qty, _ := pos["positionAmt"].(float64)
+		if qty < 0 {
+			qty = -qty
+		}
+
+		mkt, err := at.getMarketData(symbol)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: 获取行情失败: %v", symbol, err))
+			continue
+		}
+
+		tgt := at.positionTargets[symbol+"_"+strings.ToLower(side)]
+		newSL := mkt.CurrentPrice * (1 - distancePct/100)
+		if side == "SHORT" {
+			newSL = mkt.CurrentPrice * (1 + distancePct/100)
+		}
+		if tgt != nil && tgt.CurrentSL > 0 &&
+			((side == "LONG" && newSL <= tgt.CurrentSL) || (side == "SHORT" && newSL >= tgt.CurrentSL)) {
+			continue // 现有止损已更紧
+		}
+
+		if err := at.trader.SetStopLoss(symbol, side, qty, newSL, true); err != nil {
+			failed = append(failed, fmt.Sprintf("%s %s: %v", symbol, side, err))
+			continue
+		}
+		if tgt != nil {
+			tgt.CurrentSL = newSL
+		}
+		log.Printf("  🛡 看门狗已收紧止损: %s %s -> %.4f", symbol, side, newSL)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("部分持仓收紧止损失败: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -94,7 +94,7 @@ export interface ValidationError {
 export interface DecisionRecord {
   timestamp: string;
   cycle_number: number;
-  input_prompt: string;
+  input_prompt?: string; // 交易员开启提示词脱敏时可能被省略
   cot_trace: string;
   decision_json: string;
   account_state: AccountSnapshot;